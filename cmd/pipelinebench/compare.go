@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// result is what a benchmark measured, per value, as written by -o.
+type result struct {
+	Name        string  `json:"name"`
+	N           int     `json:"n"`
+	NsPerOp     int64   `json:"ns_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+	PerSecond   float64 `json:"values_per_second"`
+}
+
+// limits are how much worse a benchmark may get before it counts as a
+// regression.
+type limits struct {
+	// slowdown and bytes are fractions of the old ns and bytes per value
+	slowdown float64
+	bytes    float64
+	// allocs are allocations per value
+	allocs int64
+}
+
+// delta is how a benchmark changed between two runs.
+type delta struct {
+	name     string
+	old, new *result
+	// regressions says what got worse past the limits
+	regressions []string
+}
+
+// compare matches the benchmarks of two runs by name, in the order of old
+// followed by those only new has.
+func compare(old, new []result, l limits) []delta {
+	byName := make(map[string]*result, len(new))
+	for i := range new {
+		byName[new[i].Name] = &new[i]
+	}
+
+	var deltas []delta
+	seen := make(map[string]bool, len(old))
+	for i := range old {
+		d := delta{name: old[i].Name, old: &old[i], new: byName[old[i].Name]}
+		seen[d.name] = true
+		if d.new != nil {
+			if change(d.old.NsPerOp, d.new.NsPerOp) > l.slowdown {
+				d.regressions = append(d.regressions, "time")
+			}
+			if change(d.old.BytesPerOp, d.new.BytesPerOp) > l.bytes {
+				d.regressions = append(d.regressions, "bytes")
+			}
+			if d.new.AllocsPerOp-d.old.AllocsPerOp > l.allocs {
+				d.regressions = append(d.regressions, "allocs")
+			}
+		}
+		deltas = append(deltas, d)
+	}
+	for i := range new {
+		if !seen[new[i].Name] {
+			deltas = append(deltas, delta{name: new[i].Name, new: &new[i]})
+		}
+	}
+
+	return deltas
+}
+
+// change returns the change from old to new as a fraction of old, treating
+// any growth from zero as infinitely large.
+func change(old, new int64) float64 {
+	switch {
+	case old == new:
+		return 0
+	case old == 0:
+		return float64(new)
+	default:
+		return float64(new-old) / float64(old)
+	}
+}
+
+// printDeltas writes a table of deltas to w and reports whether any of them
+// regressed.
+func printDeltas(w io.Writer, deltas []delta) (regressed bool) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "benchmark\tns/op\tdelta\tB/op\tdelta\tallocs/op\tvalues/s\t")
+	for _, d := range deltas {
+		switch {
+		case d.new == nil:
+			fmt.Fprintf(tw, "%s\t%d\t\t%d\t\t%d\t%.0f\tonly in old\n", d.name, d.old.NsPerOp, d.old.BytesPerOp, d.old.AllocsPerOp, d.old.PerSecond)
+		case d.old == nil:
+			fmt.Fprintf(tw, "%s\t%d\t\t%d\t\t%d\t%.0f\tonly in new\n", d.name, d.new.NsPerOp, d.new.BytesPerOp, d.new.AllocsPerOp, d.new.PerSecond)
+		default:
+			verdict := ""
+			if len(d.regressions) > 0 {
+				regressed = true
+				verdict = fmt.Sprintf("REGRESSED %v", d.regressions)
+			}
+			fmt.Fprintf(tw, "%s\t%d → %d\t%+.1f%%\t%d → %d\t%+.1f%%\t%d → %d\t%.0f → %.0f\t%s\n",
+				d.name, d.old.NsPerOp, d.new.NsPerOp, 100*change(d.old.NsPerOp, d.new.NsPerOp),
+				d.old.BytesPerOp, d.new.BytesPerOp, 100*change(d.old.BytesPerOp, d.new.BytesPerOp),
+				d.old.AllocsPerOp, d.new.AllocsPerOp, d.old.PerSecond, d.new.PerSecond, verdict)
+		}
+	}
+	tw.Flush()
+
+	return regressed
+}
+
+// runCompare is the compare command: it compares the results of two runs
+// written with -o, exiting with 1 if a benchmark regressed.
+func runCompare(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var l limits
+	fs.Float64Var(&l.slowdown, "max-slowdown", 0.1, "how much slower per value a benchmark may get, as a fraction")
+	fs.Float64Var(&l.bytes, "max-bytes", 0.1, "how many more bytes per value a benchmark may allocate, as a fraction")
+	fs.Int64Var(&l.allocs, "max-allocs", 0, "how many more allocations per value a benchmark may make")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pipelinebench compare [flags] old.json new.json")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var runs [2][]result
+	for i, path := range fs.Args() {
+		var err error
+		if runs[i], err = readResults(path); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	if printDeltas(stdout, compare(runs[0], runs[1], l)) {
+		return 1
+	}
+	return 0
+}
+
+func readResults(path string) ([]result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return results, nil
+}
+
+func writeResults(path string, results []result) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
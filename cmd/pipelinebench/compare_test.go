@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	base := result{Name: "Step", NsPerOp: 100, BytesPerOp: 40, AllocsPerOp: 1}
+	l := limits{slowdown: 0.1, bytes: 0.1, allocs: 0}
+
+	tests := []struct {
+		name string
+		new  result
+		want []string
+	}{
+		{name: "unchanged", new: base},
+		{name: "within limits", new: result{Name: "Step", NsPerOp: 110, BytesPerOp: 44, AllocsPerOp: 1}},
+		{name: "faster", new: result{Name: "Step", NsPerOp: 50, BytesPerOp: 0, AllocsPerOp: 0}},
+		{name: "slower", new: result{Name: "Step", NsPerOp: 111, BytesPerOp: 40, AllocsPerOp: 1}, want: []string{"time"}},
+		{
+			name: "allocates more",
+			new:  result{Name: "Step", NsPerOp: 100, BytesPerOp: 80, AllocsPerOp: 2},
+			want: []string{"bytes", "allocs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deltas := compare([]result{base}, []result{tt.new}, l)
+			if len(deltas) != 1 {
+				t.Fatalf("got %d deltas, want 1", len(deltas))
+			}
+			if got := deltas[0].regressions; !slices.Equal(got, tt.want) {
+				t.Errorf("regressions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareUnmatched(t *testing.T) {
+	deltas := compare([]result{{Name: "a"}, {Name: "b"}}, []result{{Name: "c"}, {Name: "b"}}, limits{})
+
+	var names []string
+	for _, d := range deltas {
+		names = append(names, d.name)
+	}
+	if !slices.Equal(names, []string{"a", "b", "c"}) {
+		t.Errorf("compared %v, want a, b and c", names)
+	}
+	if deltas[0].new != nil || deltas[2].old != nil {
+		t.Errorf("benchmarks of a single run matched up")
+	}
+}
+
+func TestRunCompare(t *testing.T) {
+	dir := t.TempDir()
+	old, fast, slow := filepath.Join(dir, "old.json"), filepath.Join(dir, "fast.json"), filepath.Join(dir, "slow.json")
+	for path, ns := range map[string]int64{old: 100, fast: 90, slow: 200} {
+		if err := writeResults(path, []result{{Name: "Pipeline", NsPerOp: ns, PerSecond: 1e9 / float64(ns)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		out  string
+	}{
+		{name: "faster", args: []string{old, fast}, code: 0, out: "-10.0%"},
+		{name: "regressed", args: []string{old, slow}, code: 1, out: "REGRESSED [time]"},
+		{name: "within a looser limit", args: []string{"-max-slowdown", "2", old, slow}, code: 0, out: "+100.0%"},
+		{name: "missing file", args: []string{old, filepath.Join(dir, "none.json")}, code: 2},
+		{name: "one file", args: []string{old}, code: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runCompare(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("exit code %d, want %d, stderr: %s", code, tt.code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.out) {
+				t.Errorf("output %q, want %q in it", stdout.String(), tt.out)
+			}
+		})
+	}
+}
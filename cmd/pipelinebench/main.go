@@ -0,0 +1,176 @@
+// Command pipelinebench measures the throughput of the pipeline package's
+// building blocks on small values, where the per-value overhead of the
+// library dominates:
+//
+//	go run ./cmd/pipelinebench
+//	go run ./cmd/pipelinebench -run 'Step/ordered' -benchtime 2s
+//
+// Every benchmark is reported in ns, bytes and allocations per value, along
+// with the values per second that makes. With -o the results are also
+// written to a file, and the compare command reports how they changed from
+// one run to another, e.g. before and after a change to the package or with
+// GOMAXPROCS set differently, exiting with 1 if a benchmark got slower or
+// allocates more than the limits allow:
+//
+//	git stash && go run ./cmd/pipelinebench -o old.json && git stash pop
+//	go run ./cmd/pipelinebench -o new.json
+//	go run ./cmd/pipelinebench compare -max-slowdown 0.05 old.json new.json
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+type benchmark struct {
+	name string
+	fn   func(b *testing.B)
+}
+
+func double(n int) (int, error) { return n * 2, nil }
+
+// source emits b.N values, as fast as they are read.
+func source(ctx context.Context, b *testing.B) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := range b.N {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- i:
+			}
+		}
+	}()
+	return out
+}
+
+func drain[T any](values <-chan T, errs <-chan error) {
+	for values != nil || errs != nil {
+		select {
+		case _, ok := <-values:
+			if !ok {
+				values = nil
+			}
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+			}
+		}
+	}
+}
+
+func benchStep(opts ...pipeline.StepOption) func(b *testing.B) {
+	return func(b *testing.B) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		drain(pipeline.Step(ctx, source(ctx, b), double, opts...))
+	}
+}
+
+func benchMerge(inputs int) func(b *testing.B) {
+	return func(b *testing.B) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		cs := make([]<-chan int, inputs)
+		for i := range cs {
+			cs[i] = pipeline.FromSeq(ctx, func(yield func(int) bool) {
+				for j := i; j < b.N; j += inputs {
+					if !yield(j) {
+						return
+					}
+				}
+			})
+		}
+		for range pipeline.Merge(ctx, cs...) {
+		}
+	}
+}
+
+func benchPipeline(b *testing.B) {
+	values := make([]int, b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+	err := pipeline.New(pipeline.SliceSource(values)).
+		Then(double).
+		Then(double).
+		Sink(func(int) error { return nil }).
+		Run(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+var benchmarks = []benchmark{
+	{"Step/concurrency=1", benchStep(pipeline.WithConcurrency(1))},
+	{"Step/concurrency=8", benchStep(pipeline.WithConcurrency(8))},
+	{"Step/ordered", benchStep(pipeline.WithConcurrency(8), pipeline.WithOrderedOutput())},
+	{"Step/buffered", benchStep(pipeline.WithConcurrency(8), pipeline.WithBuffer(64))},
+	{"Step/pool", benchStep(pipeline.WithConcurrency(8), pipeline.WithWorkerPool())},
+	{"Step/pool-ordered", benchStep(pipeline.WithConcurrency(8), pipeline.WithWorkerPool(), pipeline.WithOrderedOutput())},
+	{"Merge/inputs=2", benchMerge(2)},
+	{"Merge/inputs=8", benchMerge(8)},
+	{"Pipeline/steps=2", benchPipeline},
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		os.Exit(runCompare(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	run := flag.String("run", ".", "only run the benchmarks matching this regular expression")
+	benchtime := flag.Duration("benchtime", time.Second, "how long to run each benchmark for")
+	out := flag.String("o", "", "also write the results to this file, as JSON, for compare")
+	testing.Init()
+	flag.Parse()
+
+	match, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := flag.Set("test.benchtime", benchtime.String()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var results []result
+	for _, bm := range benchmarks {
+		if !match.MatchString(bm.name) {
+			continue
+		}
+
+		r := testing.Benchmark(bm.fn)
+		res := result{
+			Name:        bm.name,
+			N:           r.N,
+			NsPerOp:     r.NsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+			AllocsPerOp: r.AllocsPerOp(),
+			PerSecond:   float64(r.N) / r.T.Seconds(),
+		}
+		results = append(results, res)
+		fmt.Printf("%-24s %12d %10d ns/op %8d B/op %6d allocs/op %12.0f values/s\n",
+			res.Name, res.N, res.NsPerOp, res.BytesPerOp, res.AllocsPerOp, res.PerSecond)
+	}
+
+	if *out != "" {
+		if err := writeResults(*out, results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestBenchmarks(t *testing.T) {
+	// a few values are enough to see every benchmark runs to completion
+	benchtime := flag.Lookup("test.benchtime").Value.String()
+	if err := flag.Set("test.benchtime", "100x"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.Set("test.benchtime", benchtime) })
+
+	for _, bm := range benchmarks {
+		t.Run(bm.name, func(t *testing.T) {
+			r := testing.Benchmark(bm.fn)
+			if r.N != 100 {
+				t.Errorf("ran %d values, want 100", r.N)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Command pipelinectl runs pipelines described by config files, see
+// pipelineconfig, from the line-based components built into it:
+//
+//	go run ./cmd/pipelinectl run -concurrency upper=4 pipeline.yaml < in.txt
+//
+// with pipeline.yaml reading:
+//
+//	sources:
+//	  - name: stdin
+//	stages:
+//	  - name: upper
+//	    inputs: [stdin]
+//	sinks:
+//	  - name: stdout
+//	    inputs: [upper]
+//
+// It registers the source "stdin", emitting the lines of standard input,
+// the stages "upper", "lower" and "trim" on strings, and the sink "stdout",
+// printing every value on a line of its own. Programs with components of
+// their own build their pipelinectl with pipelineconfig.Main.
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineconfig"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	code := pipelineconfig.Main(ctx, registry(os.Stdin, os.Stdout), os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func registry(stdin io.Reader, stdout io.Writer) *pipelineconfig.Registry {
+	r := pipelineconfig.NewRegistry()
+
+	// a read error, such as a line too long to scan, fails the run
+	pipelineconfig.RegisterSource(r, "stdin", pipeline.GeneratorSource(func(ctx context.Context, emit func(string) error) error {
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			if err := emit(scanner.Text()); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("reading stdin: %w", err)
+		}
+		return nil
+	}))
+
+	pipelineconfig.RegisterStage(r, "upper", func(s string) (string, error) { return strings.ToUpper(s), nil })
+	pipelineconfig.RegisterStage(r, "lower", func(s string) (string, error) { return strings.ToLower(s), nil })
+	pipelineconfig.RegisterStage(r, "trim", func(s string) (string, error) { return strings.TrimSpace(s), nil })
+
+	var mu sync.Mutex
+	pipelineconfig.RegisterSink(r, "stdout", func(v string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := fmt.Fprintln(stdout, v)
+		return err
+	})
+
+	return r
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineconfig"
+)
+
+func TestRun(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	config := `
+sources:
+  - name: stdin
+stages:
+  - name: upper
+    inputs: [stdin]
+sinks:
+  - name: stdout
+    inputs: [upper]
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		stdin    string
+		wantCode int
+		wantOut  string
+		wantErr  string
+	}{
+		{name: "lines", stdin: "a\nb\n", wantOut: "A\nB\n"},
+		// a line longer than bufio.MaxScanTokenSize can't be read
+		{name: "line too long", stdin: "a\n" + strings.Repeat("x", 1<<16) + "\nb\n", wantCode: 1, wantErr: "reading stdin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			r := registry(strings.NewReader(tt.stdin), &stdout)
+			code := pipelineconfig.Main(context.Background(), r, []string{"run", path}, &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Errorf("exit code %d, want %d, stderr: %s", code, tt.wantCode, stderr.String())
+			}
+			if tt.wantOut != "" && stdout.String() != tt.wantOut {
+				t.Errorf("stdout %q, want %q", stdout.String(), tt.wantOut)
+			}
+			if !strings.Contains(stderr.String(), tt.wantErr) {
+				t.Errorf("stderr %q, want it to contain %q", stderr.String(), tt.wantErr)
+			}
+		})
+	}
+}
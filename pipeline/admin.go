@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Status is a snapshot of a pipeline for inspecting it at runtime, see
+// Pipeline.Status.
+type Status struct {
+	Running bool `json:"running"`
+	Paused  bool `json:"paused"`
+	// Started is when the current run started, zero if it isn't running.
+	Started time.Time `json:"started"`
+	// Produced, Done and Failed count the values of the current run as for
+	// Progress.
+	Produced int64 `json:"produced"`
+	Done     int64 `json:"done"`
+	Failed   int64 `json:"failed"`
+	// Stages describes every step, in order.
+	Stages []StageStatus `json:"stages"`
+}
+
+// StageStatus is the part of a Status about a step. Its counts are those of
+// StageProgress, 0 while the pipeline isn't running.
+type StageStatus struct {
+	Name string `json:"name"`
+	// Details are the step's options as Describe shows them, e.g.
+	// "concurrency: 4".
+	Details   []string `json:"details,omitempty"`
+	Processed int64    `json:"processed"`
+	Failed    int64    `json:"failed"`
+	// Throughput is how many values the step has processed per second
+	// since the run started.
+	Throughput float64 `json:"throughput"`
+	InFlight   int64   `json:"in_flight"`
+	QueueDepth int64   `json:"queue_depth"`
+}
+
+// Status returns a snapshot of the pipeline's topology and, while it runs,
+// of what its steps are doing. It is safe to call from any goroutine.
+func (p *Pipeline[T]) Status() Status {
+	p.mu.Lock()
+	r := p.run
+	var counter *progressCounter
+	if r != nil {
+		counter = r.counter
+	}
+	p.mu.Unlock()
+
+	s := Status{
+		Running: r != nil,
+		Paused:  p.Paused(),
+		Stages:  make([]StageStatus, len(p.stages)),
+	}
+	for i, st := range p.stages {
+		cfg := newStepConfig(st.opts)
+		s.Stages[i] = StageStatus{Name: cfg.name, Details: stepDetails(cfg)}
+		if cfg.name == "" {
+			s.Stages[i].Name = "step " + strconv.Itoa(i+1)
+		}
+	}
+	if counter == nil {
+		return s
+	}
+
+	progress := counter.snapshot()
+	s.Started = counter.start
+	s.Produced, s.Done, s.Failed = progress.Produced, progress.Done, progress.Failed
+	for i, sp := range progress.Stages {
+		if i >= len(s.Stages) {
+			break
+		}
+		st := &s.Stages[i]
+		st.Processed, st.Failed = sp.Processed, sp.Failed
+		st.InFlight, st.QueueDepth = sp.InFlight, sp.Queued
+		if secs := progress.Elapsed.Seconds(); secs > 0 {
+			st.Throughput = float64(sp.Processed) / secs
+		}
+	}
+
+	return s
+}
+
+// defaultAdminGrace is how long a drain requested through the AdminHandler
+// waits for the pipeline to flush unless told otherwise.
+const defaultAdminGrace = 30 * time.Second
+
+// AdminHandler returns an http.Handler for operators to inspect and manage
+// the pipeline while it runs, to be mounted wherever suits, e.g. next to
+// the pprof handlers:
+//
+//	http.Handle("/debug/pipeline/", http.StripPrefix("/debug/pipeline", p.AdminHandler()))
+//
+// It serves:
+//
+//	GET  /        the Status as JSON
+//	POST /pause   Pause, then the Status
+//	POST /resume  Resume, then the Status
+//	POST /drain   Shutdown, then the Status
+//
+// A drain waits for the pipeline to flush for the grace period given as a
+// duration in the grace parameter, e.g. /drain?grace=1m, or 30s, after which
+// it is cancelled; the request going away doesn't cut it short. The handler
+// has no access control of its own, so don't expose it to the outside.
+func (p *Pipeline[T]) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	status := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p.Status())
+	}
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		status(w)
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		p.Pause()
+		status(w)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		p.Resume()
+		status(w)
+	})
+	mux.HandleFunc("POST /drain", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel, err := graceContext(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer cancel()
+		if err := p.Drain(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		status(w)
+	})
+
+	return mux
+}
+
+// graceContext is the context of an operation requested with a grace
+// period in the grace parameter, defaultAdminGrace without one; the request
+// going away doesn't cut it short.
+func graceContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	grace := defaultAdminGrace
+	if g := r.URL.Query().Get("grace"); g != "" {
+		d, err := time.ParseDuration(g)
+		if err != nil || d <= 0 {
+			return nil, nil, badRequest{errors.New("grace must be a positive duration")}
+		}
+		grace = d
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), grace)
+	return ctx, cancel, nil
+}
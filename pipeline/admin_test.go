@@ -0,0 +1,125 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// blockingSource emits 1, 2, 3... until ctx is done.
+func blockingSource(ctx context.Context) (<-chan int, error) {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := 1; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- i:
+			}
+		}
+	}()
+	return out, nil
+}
+
+func TestStatusWhileRunning(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	p := pipeline.New(blockingSource).
+		Then(func(v int) (int, error) { return v, nil }, pipeline.WithName("id"), pipeline.WithConcurrency(2)).
+		Then(func(v int) (int, error) { return v, nil }).
+		Sink(func(int) error { return nil })
+
+	if s := p.Status(); s.Running || len(s.Stages) != 2 || s.Stages[0].Name != "id" || s.Stages[1].Name != "step 2" {
+		t.Fatalf("Status before Run = %+v", s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	// polled while the run starts up and goes on, for the race detector
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s := p.Status()
+		if s.Running && s.Done > 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Status never showed progress: %+v", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if s := p.Status(); s.Running {
+		t.Errorf("Status after Run = %+v", s)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	p := pipeline.New(blockingSource).
+		Then(func(v int) (int, error) { return v, nil }, pipeline.WithName("id")).
+		Sink(func(int) error { return nil })
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+	for !p.Status().Running {
+		time.Sleep(time.Millisecond)
+	}
+
+	srv := httptest.NewServer(p.AdminHandler())
+	defer srv.Close()
+
+	tests := []struct {
+		method, path string
+		wantCode     int
+		wantPaused   bool
+		wantRunning  bool
+	}{
+		{method: http.MethodGet, path: "/", wantCode: http.StatusOK, wantRunning: true},
+		{method: http.MethodPost, path: "/pause", wantCode: http.StatusOK, wantRunning: true, wantPaused: true},
+		{method: http.MethodPost, path: "/resume", wantCode: http.StatusOK, wantRunning: true},
+		{method: http.MethodPost, path: "/drain?grace=soon", wantCode: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/pause", wantCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/drain?grace=10s", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s pipeline.Status
+		decodeErr := json.NewDecoder(resp.Body).Decode(&s)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantCode {
+			t.Fatalf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.wantCode)
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		if decodeErr != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, decodeErr)
+		}
+		if s.Running != tt.wantRunning || s.Paused != tt.wantPaused {
+			t.Errorf("%s %s: running %v, paused %v, want %v, %v", tt.method, tt.path, s.Running, s.Paused, tt.wantRunning, tt.wantPaused)
+		}
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("Run returned %v after the drain", err)
+	}
+}
@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// MaxInFlight caps how many values the pipeline holds at a time, across all
+// of its steps and the sink, whatever their concurrency and buffers add up
+// to. Once n values have been let in and not yet handled, no more are until
+// one is, and the source is read no further ahead than the value waiting to
+// be let in, so the producer blocks instead of the process running out of
+// memory. A value a step drops, see WithBackpressure, makes room as it is
+// dropped. See MaxInFlightBytes to cap their size instead.
+func (p *Pipeline[T]) MaxInFlight(n int) *Pipeline[T] {
+	p.admitLimit = int64(max(n, 1))
+	p.admitSize = nil
+	return p
+}
+
+// MaxInFlightBytes is MaxInFlight for the estimated size of the values held,
+// as told by size when they are read from the source, for pipelines of large
+// records. A value larger than limit is let in once nothing else is held.
+// Only the last of MaxInFlight and MaxInFlightBytes applies.
+func (p *Pipeline[T]) MaxInFlightBytes(limit int64, size func(T) int64) *Pipeline[T] {
+	p.admitLimit = max(limit, 1)
+	p.admitSize = size
+	return p
+}
+
+// admission bounds what a run holds at a time. A nil admission bounds
+// nothing.
+type admission[T any] struct {
+	sem   *semaphore.Weighted
+	limit int64
+	size  func(T) int64
+}
+
+func newAdmission[T any](limit int64, size func(T) int64) *admission[T] {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &admission[T]{sem: semaphore.NewWeighted(limit), limit: limit, size: size}
+}
+
+// admit passes on the values from in as the held ones leave room for them,
+// recording in each value the weight to release once it is done.
+func (a *admission[T]) admit(ctx context.Context, in <-chan sequenced[T]) <-chan sequenced[T] {
+	if a == nil {
+		return in
+	}
+
+	outChannel := make(chan sequenced[T])
+
+	go func() {
+		defer close(outChannel)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				v.weight = 1
+				if a.size != nil {
+					// clamped so a huge value waits for an empty pipeline
+					// rather than forever
+					v.weight = min(max(a.size(v.value), 0), a.limit)
+				}
+				if err := a.sem.Acquire(ctx, v.weight); err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- v:
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// release makes room for as much as v took up.
+func (a *admission[T]) release(v sequenced[T]) {
+	if a != nil && v.weight > 0 {
+		a.sem.Release(v.weight)
+	}
+}
@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// AlertRule is a condition Alerts watches every step for.
+type AlertRule struct {
+	name      string
+	threshold float64
+	// minValues is how many values an error rate needs to be taken seriously
+	minValues int64
+	kind      alertKind
+}
+
+type alertKind int
+
+const (
+	errorRateAlert alertKind = iota
+	consecutiveAlert
+	stalledAlert
+)
+
+// ErrorRateAbove fires once more than rate, between 0 and 1, of the values a
+// step finished in an interval of Alerts failed, provided it finished at
+// least minValues of them; quieter intervals leave the alert as it was.
+func ErrorRateAbove(rate float64, minValues int) AlertRule {
+	return AlertRule{name: "error rate", threshold: rate, minValues: int64(minValues), kind: errorRateAlert}
+}
+
+// ConsecutiveFailures fires once the last n values a step finished have all
+// failed, and clears with the next one it processes.
+func ConsecutiveFailures(n int) AlertRule {
+	return AlertRule{name: "consecutive failures", threshold: float64(n), kind: consecutiveAlert}
+}
+
+// StalledFor fires once a step has had values in flight for d without
+// finishing any, as the Watchdog would flag it.
+func StalledFor(d time.Duration) AlertRule {
+	return AlertRule{name: "stalled", threshold: d.Seconds(), kind: stalledAlert}
+}
+
+// Alert is a rule of Alerts firing for a step, or clearing again.
+type Alert struct {
+	// Rule is the name of the rule: "error rate", "consecutive failures"
+	// or "stalled".
+	Rule  string
+	Stage string
+	// Value is what the rule measured, the error rate, the number of
+	// failures in a row or how many seconds the step has been stalled for,
+	// and Threshold what the rule compares it against.
+	Value     float64
+	Threshold float64
+	// Resolved is set once the condition the alert fired for has cleared.
+	Resolved bool
+	At       time.Time
+}
+
+// Alerts checks every step against rules every interval while the pipeline
+// runs, calling fire when one of them starts to hold for a step, and again
+// with Resolved set once it stops, so alerts reach PagerDuty or Slack
+// without anyone scraping logs:
+//
+//	p.Alerts(10*time.Second, notify,
+//		pipeline.ErrorRateAbove(0.05, 100),
+//		pipeline.ConsecutiveFailures(20),
+//		pipeline.StalledFor(time.Minute))
+//
+// fire is called from a goroutine of its own, one alert at a time, and never
+// after Run has returned.
+func (p *Pipeline[T]) Alerts(interval time.Duration, fire func(Alert), rules ...AlertRule) *Pipeline[T] {
+	p.alertEvery = interval
+	p.alertFire = fire
+	p.alertRules = rules
+	return p
+}
+
+// alert checks the steps counted by counter against rules every interval
+// until the returned func is called, which waits for it to stop.
+func alert(ctx context.Context, counter *progressCounter, interval time.Duration, rules []AlertRule, fire func(Alert)) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := counter.clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		// firing is whether each rule holds for each step, processed and
+		// failed what each step had finished at the last check
+		firing := make([][]bool, len(counter.stages))
+		for i := range firing {
+			firing[i] = make([]bool, len(rules))
+		}
+		processed := make([]int64, len(counter.stages))
+		failed := make([]int64, len(counter.stages))
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C():
+				for i, counts := range counter.stages {
+					p, f := counts.processed.Load(), counts.failed.Load()
+					dp, df := p-processed[i], f-failed[i]
+					processed[i], failed[i] = p, f
+
+					for j, rule := range rules {
+						var value float64
+						holds := firing[i][j]
+						switch rule.kind {
+						case errorRateAlert:
+							if n := dp + df; n > 0 && n >= rule.minValues {
+								value = float64(df) / float64(n)
+								holds = value > rule.threshold
+							}
+						case consecutiveAlert:
+							value = float64(counts.consecutive.Load())
+							holds = value >= rule.threshold
+						case stalledAlert:
+							idle := now.Sub(time.Unix(0, counts.active.Load()))
+							value = idle.Seconds()
+							holds = counts.inFlight.Load() > 0 && value >= rule.threshold
+						}
+						if holds == firing[i][j] {
+							continue
+						}
+						firing[i][j] = holds
+
+						fire(Alert{
+							Rule:      rule.name,
+							Stage:     counter.names[i],
+							Value:     value,
+							Threshold: rule.threshold,
+							Resolved:  !holds,
+							At:        now,
+						})
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,89 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestAlerts(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	alerts := make(chan pipeline.Alert, 10)
+	src := pipelinetest.NewSource[int]()
+	sink := pipelinetest.NewSink[int]()
+	step := pipelinetest.NewScript(func(_ context.Context, v int) (int, error) { return v, nil }).
+		Fail(errBad).
+		Fail(errBad)
+	p := pipeline.New(src.Open).
+		ThenCtx(step.Fn, pipeline.WithName("work"), pipeline.WithConcurrency(1)).
+		Sink(sink.Handle).
+		OnError(pipeline.SkipErrors()).
+		Alerts(10*time.Second, func(a pipeline.Alert) { alerts <- a },
+			pipeline.ErrorRateAbove(0.5, 2),
+			pipeline.ConsecutiveFailures(2),
+			pipeline.StalledFor(30*time.Second))
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	clock.WaitForTimers(1)
+
+	// tick moves the clock on to the next check and returns the alerts it
+	// raised
+	tick := func(d time.Duration, want int) []pipeline.Alert {
+		t.Helper()
+		clock.Advance(d)
+		got := make([]pipeline.Alert, want)
+		for i := range got {
+			got[i] = pipelinetest.Receive(t, alerts)
+		}
+		assertNothing(t, alerts)
+		return got
+	}
+	check := func(a pipeline.Alert, rule string, resolved bool, value float64) {
+		t.Helper()
+		if a.Rule != rule || a.Stage != "work" || a.Resolved != resolved || a.Value != value {
+			t.Errorf("got %+v, want %s resolved %v at %v", a, rule, resolved, value)
+		}
+	}
+
+	src.Send(t, 1, 2)
+	waitFor(t, "both values to fail", func() bool { return p.Stats().Stages[0].Failed == 2 })
+	got := tick(10*time.Second, 2)
+	check(got[0], "error rate", false, 1)
+	check(got[1], "consecutive failures", false, 2)
+
+	// too few values to change the error rate, enough to end the streak
+	src.Send(t, 3)
+	sink.Next(t)
+	got = tick(10*time.Second, 1)
+	check(got[0], "consecutive failures", true, 0)
+
+	step.Hang()
+	src.Send(t, 4)
+	// past the calls with 1 to 3, to the one now hanging
+	for want := 1; want <= 4; want++ {
+		if got := step.Next(t); got != want {
+			t.Fatalf("call with %d, want %d", got, want)
+		}
+	}
+	tick(20*time.Second, 0)
+	got = tick(10*time.Second, 1)
+	check(got[0], "stalled", false, 30)
+
+	step.Release()
+	sink.Next(t)
+	got = tick(10*time.Second, 1)
+	if got[0].Rule != "stalled" || !got[0].Resolved {
+		t.Errorf("got %+v, want the stall resolved", got[0])
+	}
+
+	src.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
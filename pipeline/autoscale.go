@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ScaleEvent describes a scaling decision of an autoscaled step, see
+// WithScaleHook.
+type ScaleEvent struct {
+	// Stage is the name of the step, or for an unnamed step of a Pipeline
+	// the "step N" it is known as there.
+	Stage string
+	// From and To are the number of workers before and after the decision.
+	From, To int
+	// Backlog is the number of values that were waiting for a worker.
+	Backlog int
+	// AvgLatency is the average time a value took to process over the last
+	// interval, zero if none finished.
+	AvgLatency time.Duration
+}
+
+// WithAutoscale replaces the fixed limit set by WithConcurrency with one that
+// moves between minWorkers and maxWorkers. Every interval the step looks at how
+// many values are backed up in front of it and how long values take to
+// process: while there is a backlog it adds workers, and when the values
+// arriving could be handled by fewer workers it removes them, one per
+// interval. The step starts with minWorkers. Intervals of zero or less
+// default to a second.
+//
+// This suits pipelines whose stages have wildly different costs, where any
+// fixed split of workers leaves some stages starved and others idle.
+func WithAutoscale(minWorkers, maxWorkers int, interval time.Duration) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.scaleMin = max(minWorkers, 1)
+		cfg.scaleMax = max(maxWorkers, cfg.scaleMin)
+		cfg.scaleInterval = interval
+		if interval <= 0 {
+			cfg.scaleInterval = time.Second
+		}
+	}
+}
+
+// WithScaleHook calls fn with every scaling decision of an autoscaled step.
+// fn is called from the step's scaling goroutine and should return quickly.
+func WithScaleHook(fn func(ScaleEvent)) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.scaleHook = fn
+	}
+}
+
+// scaler grows and shrinks the number of workers of a step by holding back
+// some of its semaphore's weight.
+type scaler struct {
+	cfg     stepConfig
+	sem     *semaphore.Weighted
+	in      func() int
+	current int
+
+	mu       sync.Mutex
+	waiting  bool
+	arrived  int
+	finished int
+	busy     time.Duration
+}
+
+// newScaler returns the semaphore for the step to acquire workers from, sized
+// for the maximum and with everything above the minimum held back.
+func newScaler(cfg stepConfig, in func() int) *scaler {
+	sem := semaphore.NewWeighted(int64(cfg.scaleMax))
+	sem.TryAcquire(int64(cfg.scaleMax - cfg.scaleMin))
+
+	return &scaler{cfg: cfg, sem: sem, in: in, current: cfg.scaleMin}
+}
+
+// arrive records a value read from the step's input.
+func (s *scaler) arrive() {
+	s.mu.Lock()
+	s.arrived++
+	s.mu.Unlock()
+}
+
+// setWaiting records whether the step is blocked waiting for a free worker.
+func (s *scaler) setWaiting(w bool) {
+	s.mu.Lock()
+	s.waiting = w
+	s.mu.Unlock()
+}
+
+// finish records how long a value took to process.
+func (s *scaler) finish(d time.Duration) {
+	s.mu.Lock()
+	s.finished++
+	s.busy += d
+	s.mu.Unlock()
+}
+
+// run makes a scaling decision every interval until ctx is done or done is
+// closed.
+func (s *scaler) run(ctx context.Context, done <-chan struct{}) {
+	ticker := ClockFrom(ctx).NewTicker(s.cfg.scaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C():
+			s.tick()
+		}
+	}
+}
+
+func (s *scaler) tick() {
+	s.mu.Lock()
+	backlog := s.in()
+	if s.waiting {
+		backlog++
+	}
+	arrived, finished, busy := s.arrived, s.finished, s.busy
+	s.arrived, s.finished, s.busy = 0, 0, 0
+	s.mu.Unlock()
+
+	var avg time.Duration
+	if finished > 0 {
+		avg = busy / time.Duration(finished)
+	}
+
+	// by Little's law the workers needed to keep up are the arrival rate
+	// times the time each value takes
+	needed := s.current
+	switch {
+	case avg > 0:
+		rate := float64(arrived) / s.cfg.scaleInterval.Seconds()
+		needed = int(math.Ceil(rate * avg.Seconds()))
+	case arrived == 0 && backlog == 0:
+		// an idle step needs none, rather than keeping the workers it had
+		needed = 0
+	}
+
+	target := s.current
+	switch {
+	case backlog > 0:
+		target = max(s.current+1, needed)
+	case needed < s.current:
+		target = s.current - 1
+	}
+	target = min(max(target, s.cfg.scaleMin), s.cfg.scaleMax)
+	if target == s.current {
+		return
+	}
+
+	from := s.current
+	if target > s.current {
+		s.sem.Release(int64(target - s.current))
+		s.current = target
+	} else if s.sem.TryAcquire(int64(s.current - target)) {
+		s.current = target
+	} else {
+		// every worker is busy, try again next time
+		return
+	}
+
+	s.cfg.logger.Debug("scaled workers", "from", from, "to", s.current, "backlog", backlog, "avg_latency", avg)
+	if s.cfg.scaleHook != nil {
+		s.cfg.scaleHook(ScaleEvent{
+			Stage:      s.cfg.label,
+			From:       from,
+			To:         s.current,
+			Backlog:    backlog,
+			AvgLatency: avg,
+		})
+	}
+}
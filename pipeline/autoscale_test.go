@@ -0,0 +1,116 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestAutoscale(t *testing.T) {
+	const interval = time.Second
+
+	tests := []struct {
+		name     string
+		min, max int
+		// up is how the workers grow while every value is stuck, down how
+		// they shrink once the values are let through
+		up, down []string
+	}{
+		{name: "one to four", min: 1, max: 4, up: []string{"1→2", "2→3", "3→4"}, down: []string{"4→3", "3→2", "2→1"}},
+		{name: "kept above the minimum", min: 2, max: 3, up: []string{"2→3"}, down: []string{"3→2"}},
+		{name: "fixed", min: 2, max: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			ctx, clock := fakeContext(t)
+
+			events := make(chan string, 16)
+			release := make(chan struct{})
+			in := make(chan int)
+			out, errs := pipeline.Step(ctx, in, func(v int) (int, error) {
+				<-release
+				return v, nil
+			}, pipeline.WithName("scaled"), pipeline.WithAutoscale(tt.min, tt.max, interval), pipeline.WithScaleHook(func(e pipeline.ScaleEvent) {
+				if e.Stage != "scaled" {
+					t.Errorf("scaled %q, want the step's name", e.Stage)
+				}
+				events <- fmt.Sprintf("%d→%d", e.From, e.To)
+			}))
+			go func() {
+				for i := range 10 {
+					in <- i
+				}
+			}()
+			clock.WaitForTimers(1)
+
+			// scale advances the clock until there are n decisions, then for
+			// a few intervals more, in which there must be none
+			scale := func(n int) []string {
+				var got []string
+				for quiet, i := 0, 0; quiet < 5 && i < 50; i++ {
+					clock.Advance(interval)
+					select {
+					case e := <-events:
+						got = append(got, e)
+					case <-time.After(10 * time.Millisecond):
+						if len(got) >= n {
+							quiet++
+						}
+					}
+				}
+				return got
+			}
+
+			if got := scale(len(tt.up)); !slices.Equal(got, tt.up) {
+				t.Errorf("scaled up %v, want %v", got, tt.up)
+			}
+			close(release)
+			for range 10 {
+				pipelinetest.Receive(t, out)
+			}
+			if got := scale(len(tt.down)); !slices.Equal(got, tt.down) {
+				t.Errorf("scaled down %v, want %v", got, tt.down)
+			}
+
+			close(in)
+			pipelinetest.Collect(t, out)
+			pipelinetest.Collect(t, errs)
+		})
+	}
+}
+
+// TestAutoscalePipelineStage checks scaling an unnamed step of a Pipeline
+// is reported as the "step N" it is known as elsewhere.
+func TestAutoscalePipelineStage(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	stages := make(chan string, 16)
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(pipeline.SliceSource([]int{1, 2, 3, 4})).
+			Then(func(v int) (int, error) {
+				<-release
+				return v, nil
+			}, pipeline.WithAutoscale(1, 2, time.Millisecond), pipeline.WithScaleHook(func(e pipeline.ScaleEvent) {
+				stages <- e.Stage
+			})).
+			Sink(func(int) error { return nil }).
+			Run(context.Background())
+	}()
+
+	if got := pipelinetest.Receive(t, stages); got != "step 1" {
+		t.Errorf("scaled %q, want step 1", got)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+)
+
+// BackpressurePolicy decides what a step does with a result when the buffer
+// in front of the next stage is full, see WithBackpressure.
+type BackpressurePolicy int
+
+const (
+	// Block makes workers wait until the next stage makes room. Nothing is
+	// lost, but a slow consumer stalls every stage before it. This is the
+	// default.
+	Block BackpressurePolicy = iota
+	// DropOldest discards the oldest buffered result to make room for the
+	// new one, keeping the freshest data flowing.
+	DropOldest
+	// DropNewest discards the new result, keeping what is already buffered.
+	DropNewest
+)
+
+// dropReason returns what the results discarded under p are reported as.
+func (p BackpressurePolicy) dropReason() DropReason {
+	if p == DropOldest {
+		return DroppedOldest
+	}
+	return DroppedNewest
+}
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	default:
+		return "unknown"
+	}
+}
+
+// WithBuffer buffers up to n results between the step and whatever reads its
+// output, so a briefly slow consumer doesn't stall the workers. Steps are
+// unbuffered by default.
+func WithBuffer(n int) StepOption {
+	return func(cfg *stepConfig) {
+		if n >= 0 {
+			cfg.buffer = n
+		}
+	}
+}
+
+// WithBackpressure sets what happens when the step's output buffer is full.
+// The drop policies need somewhere to drop from, so they buffer at least one
+// result even without WithBuffer. Dropped results are logged at debug level
+// and handed to the OnItemDropped hook as DroppedOldest or DroppedNewest, see
+// WithHooks.
+func WithBackpressure(p BackpressurePolicy) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.backpressure = p
+	}
+}
+
+// dropping forwards values from in to a channel buffering up to size values,
+// discarding one according to policy whenever the buffer is full and handing
+// it to onDrop, if not nil. Buffered values are flushed once in is closed,
+// unless ctx is done first.
+func dropping[T any](ctx context.Context, in <-chan T, size int, policy BackpressurePolicy, logger *slog.Logger, onDrop func(T)) <-chan T {
+	if size < 1 {
+		size = 1
+	}
+
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		queue := make([]T, 0, size)
+		for in != nil || len(queue) > 0 {
+			// only offer a value downstream when there is one
+			var (
+				out  chan<- T
+				head T
+			)
+			if len(queue) > 0 {
+				out = outChannel
+				head = queue[0]
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- head:
+				queue = queue[1:]
+			case v, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+
+				if len(queue) < size {
+					queue = append(queue, v)
+					continue
+				}
+
+				logger.Debug("buffer full, dropping result", "policy", policy)
+				dropped := v
+				if policy == DropOldest {
+					dropped = queue[0]
+					queue = append(queue[1:], v)
+				}
+				if onDrop != nil {
+					onDrop(dropped)
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
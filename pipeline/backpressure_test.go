@@ -0,0 +1,105 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestBackpressureDrops(t *testing.T) {
+	tests := []struct {
+		policy      pipeline.BackpressurePolicy
+		reason      pipeline.DropReason
+		wantKept    []int
+		wantDropped []int
+	}{
+		{policy: pipeline.DropNewest, reason: pipeline.DroppedNewest, wantKept: []int{1, 2}, wantDropped: []int{3, 4, 5, 6}},
+		{policy: pipeline.DropOldest, reason: pipeline.DroppedOldest, wantKept: []int{5, 6}, wantDropped: []int{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			ctx := context.Background()
+
+			var mu sync.Mutex
+			var dropped []int
+			allDropped := make(chan struct{})
+			out, errs := pipeline.Step(ctx, pipeline.FromSlice(ctx, []int{1, 2, 3, 4, 5, 6}),
+				func(v int) (int, error) { return v, nil },
+				pipeline.WithName("shed"),
+				pipeline.WithConcurrency(1),
+				pipeline.WithBuffer(2),
+				pipeline.WithBackpressure(tt.policy),
+				pipeline.WithHooks(pipeline.Hooks{
+					OnItemDropped: func(stage string, output any, reason pipeline.DropReason) {
+						if stage != "shed" || reason != tt.reason {
+							t.Errorf("OnItemDropped(%q, %v, %v)", stage, output, reason)
+						}
+						mu.Lock()
+						defer mu.Unlock()
+						dropped = append(dropped, output.(int))
+						if len(dropped) == len(tt.wantDropped) {
+							close(allDropped)
+						}
+					},
+				}),
+			)
+
+			// nothing is read until the buffer has overflowed
+			select {
+			case <-allDropped:
+			case <-time.After(10 * time.Second):
+				t.Fatal("values never dropped")
+			}
+			kept := pipelinetest.Collect(t, out)
+			pipelinetest.Collect(t, errs)
+
+			if !slices.Equal(kept, tt.wantKept) {
+				t.Errorf("kept %v, want %v", kept, tt.wantKept)
+			}
+			if !slices.Equal(dropped, tt.wantDropped) {
+				t.Errorf("dropped %v, want %v", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+// TestBackpressureDropsMakeRoom drops values from a pipeline holding at most
+// three at a time while its sink is stuck on the first, which only keeps
+// taking in values if every dropped one makes room again.
+func TestBackpressureDropsMakeRoom(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	in := make(chan int)
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(pipeline.ChanSource(in)).
+			Then(func(v int) (int, error) { return v, nil }, pipeline.WithBackpressure(pipeline.DropNewest)).
+			Sink(func(int) error {
+				<-release
+				return nil
+			}).
+			MaxInFlight(3).
+			Run(context.Background())
+	}()
+
+	for i := range 20 {
+		select {
+		case in <- i:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("value %d not taken in, dropped values still held", i)
+		}
+	}
+	close(release)
+	close(in)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
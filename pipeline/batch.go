@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// Batch groups values from in into slices of up to size values, so the next
+// stage can do bulk work such as a single database insert per batch.
+//
+// A batch is sent once it is full, or maxWait after its first value arrived,
+// whichever comes first; a maxWait of zero or less waits for a full batch.
+// The last, possibly partial, batch is sent when in is closed. The output is
+// closed after that, or as soon as ctx is done.
+func Batch[T any](ctx context.Context, in <-chan T, size int, maxWait time.Duration) <-chan []T {
+	if size < 1 {
+		size = 1
+	}
+
+	outChannel := make(chan []T)
+
+	go func() {
+		defer close(outChannel)
+
+		clock := ClockFrom(ctx)
+		var (
+			batch []T
+			timer Timer
+			// stays nil, and so never fires, while there is no partial batch
+			expired <-chan time.Time
+		)
+
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+				timer, expired = nil, nil
+			}
+			if len(batch) == 0 {
+				return true
+			}
+
+			select {
+			case <-ctx.Done():
+				return false
+			case outChannel <- batch:
+			}
+			batch = nil
+
+			return true
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-expired:
+				if !flush() {
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+
+				if batch == nil {
+					batch = make([]T, 0, size)
+					if maxWait > 0 {
+						timer = clock.NewTimer(maxWait)
+						expired = timer.C()
+					}
+				}
+				batch = append(batch, v)
+
+				if len(batch) == size && !flush() {
+					return
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// Flatten is the inverse of Batch: it sends every value of every slice
+// received from in, in order. The output is closed once in is closed or ctx
+// is done.
+func Flatten[T any](ctx context.Context, in <-chan []T) <-chan T {
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case batch, ok := <-in:
+				if !ok {
+					return
+				}
+
+				for _, v := range batch {
+					select {
+					case <-ctx.Done():
+						return
+					case outChannel <- v:
+					}
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// FlatMap is a Step whose fn turns each input into any number of outputs,
+// which are sent downstream one by one. It accepts the same options as Step.
+func FlatMap[In any, Out any](
+	ctx context.Context,
+	inputChannel <-chan In,
+	fn func(In) ([]Out, error),
+	opts ...StepOption,
+) (<-chan Out, <-chan error) {
+	batches, errs := Step(ctx, inputChannel, fn, opts...)
+	return Flatten(ctx, batches), errs
+}
@@ -0,0 +1,69 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestFlatten(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.Flatten(context.Background(), waiting([]int{1, 2}, nil, []int{3})))
+	if want := []int{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFlattenStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan []int, 1)
+	defer close(in)
+	in <- []int{1, 2, 3}
+
+	out := pipeline.Flatten(ctx, in)
+	if got := pipelinetest.Receive(t, out); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	cancel()
+	// the rest of the batch may race the cancellation, but the output closes
+	pipelinetest.Collect(t, out)
+}
+
+func TestFlatMap(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	out, errs := pipeline.FlatMap(ctx, pipeline.FromSlice(ctx, []string{"a b", "", "bad", "c"}),
+		func(s string) ([]string, error) {
+			if s == "bad" {
+				return nil, errBad
+			}
+			return strings.Fields(s), nil
+		},
+		pipeline.WithOrderedOutput(),
+	)
+
+	failures := make(chan []error)
+	go func() {
+		var got []error
+		for err := range errs {
+			got = append(got, err)
+		}
+		failures <- got
+	}()
+
+	if got, want := pipelinetest.Collect(t, out), []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := <-failures; len(got) != 1 || !errors.Is(got[0], errBad) {
+		t.Errorf("got errors %v, want %v", got, errBad)
+	}
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// WithCircuitBreaker stops the step from hammering a dependency that keeps
+// failing, e.g. a downed API. After threshold consecutive failed calls of fn
+// the circuit opens and the step pauses: no calls are made, and so no more
+// values are taken in, for cooldown. Then a single call is let through to
+// probe the dependency. If it succeeds the circuit closes and the step picks
+// up where it left off, otherwise it stays open for another cooldown.
+//
+// Every call counts, including retries. Only errors classified as
+// ErrorRetry count as failures, see WithErrorClassifier. Others, like those
+// marked with Permanent, are about the value rather than the dependency, so
+// they count as successful calls.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) StepOption {
+	return func(cfg *stepConfig) {
+		// a fresh breaker per step, even when the option value is shared
+		cfg.breaker = newBreaker(max(threshold, 1), cooldown)
+	}
+}
+
+type breakerState int
+
+const (
+	circuitClosed breakerState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openUntil time.Time
+	// changed is closed, and replaced, whenever state changes so waiting
+	// workers can look again
+	changed chan struct{}
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		changed:   make(chan struct{}),
+	}
+}
+
+// wait blocks until a call may be made, or ctx is done. Once the cooldown of
+// an open circuit has passed, exactly one caller is let through as the probe.
+func (b *breaker) wait(ctx context.Context) error {
+	clock := ClockFrom(ctx)
+	for {
+		b.mu.Lock()
+		state, changed := b.state, b.changed
+		var timer Timer
+		switch state {
+		case circuitClosed:
+			b.mu.Unlock()
+			return nil
+		case circuitOpen:
+			d := b.openUntil.Sub(clock.Now())
+			if d <= 0 {
+				b.setState(circuitHalfOpen)
+				b.mu.Unlock()
+				return nil
+			}
+			timer = clock.NewTimer(d)
+		}
+		b.mu.Unlock()
+
+		// a half-open circuit has no timer, the probe's outcome decides
+		var expired <-chan time.Time
+		if timer != nil {
+			expired = timer.C()
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+		case <-changed:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// record feeds the outcome of a call, made up to now, into the breaker.
+func (b *breaker) record(err error, now time.Time, logger *slog.Logger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		if b.state != circuitClosed {
+			b.setState(circuitClosed)
+			logger.Info("circuit closed")
+		}
+		return
+	}
+
+	switch b.state {
+	case circuitHalfOpen:
+		b.open(now)
+		logger.Warn("circuit reopened", "cooldown", b.cooldown, "error", err)
+	case circuitClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			logger.Warn("circuit opened", "failures", b.failures, "cooldown", b.cooldown, "error", err)
+			b.open(now)
+		}
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.failures = 0
+	b.openUntil = now.Add(b.cooldown)
+	b.setState(circuitOpen)
+}
+
+// setState must be called with mu held.
+func (b *breaker) setState(s breakerState) {
+	b.state = s
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
@@ -0,0 +1,107 @@
+package pipeline_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = time.Minute
+	down := errors.New("down")
+	permanent := pipeline.Permanent(errBad)
+
+	tests := []struct {
+		name      string
+		threshold int
+		// outcomes are what the calls return, one value each
+		outcomes []error
+		// at is when every call is made, after the first
+		at []time.Duration
+	}{
+		{
+			name:      "never failing",
+			threshold: 1,
+			outcomes:  []error{nil, nil, nil},
+			at:        []time.Duration{0, 0, 0},
+		},
+		{
+			name:      "opened, then closed by the probe",
+			threshold: 2,
+			outcomes:  []error{down, down, nil, nil},
+			at:        []time.Duration{0, 0, cooldown, cooldown},
+		},
+		{
+			name:      "reopened by the probe",
+			threshold: 2,
+			outcomes:  []error{down, down, down, nil, nil},
+			at:        []time.Duration{0, 0, cooldown, 2 * cooldown, 2 * cooldown},
+		},
+		{
+			name:      "successes reset the count",
+			threshold: 2,
+			outcomes:  []error{down, nil, down, nil, down, down, nil},
+			at:        []time.Duration{0, 0, 0, 0, 0, 0, cooldown},
+		},
+		{
+			name:      "permanent errors don't count",
+			threshold: 1,
+			outcomes:  []error{permanent, permanent, down, nil},
+			at:        []time.Duration{0, 0, 0, cooldown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			ctx, clock := fakeContext(t)
+			start := clock.Now()
+
+			var mu sync.Mutex
+			var at []time.Duration
+			values := make([]int, len(tt.outcomes))
+			for i := range values {
+				values[i] = i
+			}
+			out, errs := pipeline.Step(ctx, pipeline.FromSlice(ctx, values), func(v int) (int, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				at = append(at, clock.Now().Sub(start))
+				return v, tt.outcomes[v]
+			}, pipeline.WithConcurrency(1), pipeline.WithCircuitBreaker(tt.threshold, cooldown))
+
+			var got []int
+			var failed []error
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				got = pipelinetest.Collect(t, out)
+			}()
+			go func() {
+				defer wg.Done()
+				failed = pipelinetest.Collect(t, errs)
+			}()
+			// every cooldown is waited out on a timer of the breaker
+			for range tt.at[len(tt.at)-1] / cooldown {
+				clock.WaitForTimers(1)
+				clock.Advance(cooldown)
+			}
+			wg.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(at, tt.at) {
+				t.Errorf("calls made at %v, want %v", at, tt.at)
+			}
+			if len(got)+len(failed) != len(tt.outcomes) {
+				t.Errorf("%d results and %d errors, want one of either per value", len(got), len(failed))
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrBudgetExceeded is wrapped by the error a step fails with once it has
+// run for longer than its WithBudget.
+var ErrBudgetExceeded = errors.New("pipeline: stage budget exceeded")
+
+// ErrDeadlineExceeded is wrapped by the error Run returns once the
+// pipeline's Timeout or Deadline has passed, along with
+// context.DeadlineExceeded.
+var ErrDeadlineExceeded = errors.New("pipeline: deadline exceeded")
+
+// WithBudget limits how long the step may run as a whole, from the moment it
+// is started, so one slow stage of a batch job can't keep it running
+// unbounded. Once d has passed the step stops taking in values, gives up on
+// the ones in flight and closes its channels, the last error it reports
+// being a *StageError wrapping ErrBudgetExceeded. Its Stage is the name of
+// the step, or for an unnamed step of a Pipeline the "step N" it is known
+// as there. The error is marked Fatal, a step that has stopped taking in
+// values would otherwise leave the ones before it blocked, so within a
+// Pipeline it stops the run whatever the ErrorPolicy.
+//
+// See WithItemTimeout to limit the calls of fn instead.
+func WithBudget(d time.Duration) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.budget = d
+	}
+}
+
+// Timeout limits how long Run may take, starting when it is called. Once d
+// has passed the run is cancelled and Run returns an error wrapping
+// ErrDeadlineExceeded. See WithBudget to limit single steps.
+func (p *Pipeline[T]) Timeout(d time.Duration) *Pipeline[T] {
+	p.timeout = d
+	return p
+}
+
+// Deadline is Timeout for a point in time: once t has passed the run is
+// cancelled and Run returns an error wrapping ErrDeadlineExceeded. With both
+// a Timeout and a Deadline the earlier one applies.
+func (p *Pipeline[T]) Deadline(t time.Time) *Pipeline[T] {
+	p.deadline = t
+	return p
+}
+
+// withDeadline returns a copy of ctx done once the pipeline's Timeout or
+// Deadline, whichever is earlier, has passed, if it has any.
+func (p *Pipeline[T]) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	clock := ClockFrom(ctx)
+	deadline := p.deadline
+	if p.timeout > 0 {
+		if d := clock.Now().Add(p.timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	if deadline.IsZero() {
+		return ctx, func() {}
+	}
+
+	cause := fmt.Errorf("%w at %s: %w", ErrDeadlineExceeded, deadline.Format(time.RFC3339), context.DeadlineExceeded)
+	return withClockTimeoutCause(ctx, deadline.Sub(clock.Now()), cause)
+}
+
+// runWithBudget runs the step with a context that is done once its budget
+// has passed, reporting it on the error channel if it was.
+func runWithBudget[In any, Out any](
+	ctx context.Context,
+	inputChannel <-chan In,
+	fn func(context.Context, In) (Out, error),
+	cfg stepConfig,
+) (<-chan Out, <-chan error) {
+	return withBudget(ctx, cfg, func(ctx context.Context, cfg stepConfig) (<-chan Out, <-chan error) {
+		return runStep(ctx, inputChannel, fn, cfg)
+	})
+}
+
+// withBudget calls run with a context that is done once cfg's budget has
+// passed and cfg without the budget, reporting on the error channel if it
+// was exceeded.
+func withBudget[Out any](
+	ctx context.Context,
+	cfg stepConfig,
+	run func(context.Context, stepConfig) (<-chan Out, <-chan error),
+) (<-chan Out, <-chan error) {
+	budget := cfg.budget
+	cfg.budget = 0
+	exceeded := fmt.Errorf("%w: ran for longer than %s", ErrBudgetExceeded, budget)
+
+	stepCtx, cancel := withClockTimeoutCause(ctx, budget, exceeded)
+	values, errs := run(stepCtx, cfg)
+
+	errorChannel := make(chan error)
+	go func() {
+		defer close(errorChannel)
+		defer cancel()
+
+		for err := range errs {
+			select {
+			case <-ctx.Done():
+				return
+			case errorChannel <- err:
+			}
+		}
+
+		if ctx.Err() == nil && context.Cause(stepCtx) == exceeded {
+			select {
+			case <-ctx.Done():
+			case errorChannel <- &StageError{Stage: cfg.label, Err: Fatal(exceeded)}:
+			}
+		}
+	}()
+
+	return values, errorChannel
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrBusClosed is returned when publishing to a bus that has been closed.
+var ErrBusClosed = errors.New("pipeline: bus closed")
+
+// Bus is an in-process publish/subscribe topic. The sink of one pipeline
+// publishes into it and the sources of other pipelines subscribe to it, so
+// pipelines can be wired together while keeping their own lifecycles.
+//
+// Publishing blocks until every current subscriber has accepted the value,
+// which means a slow subscriber applies backpressure to the publisher once
+// its buffer is full.
+type Bus[T any] struct {
+	mu   sync.RWMutex
+	subs map[*subscription[T]]struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type subscription[T any] struct {
+	values chan T
+	done   chan struct{}
+}
+
+// NewBus returns a bus with no subscribers.
+func NewBus[T any]() *Bus[T] {
+	return &Bus[T]{
+		subs: make(map[*subscription[T]]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Subscribe returns a channel that receives every value published after the
+// call. The channel is closed when ctx is done or the bus is closed, so
+// cancelling a downstream pipeline detaches it without affecting the others.
+func (b *Bus[T]) Subscribe(ctx context.Context, buffer int) <-chan T {
+	sub := &subscription[T]{
+		values: make(chan T, buffer),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	select {
+	case <-b.done:
+		// bus already closed, hand back a closed channel
+		b.mu.Unlock()
+		close(sub.values)
+		return sub.values
+	default:
+	}
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-b.done:
+		}
+		// unblock any publisher stuck sending to us before we take the lock
+		close(sub.done)
+
+		b.mu.Lock()
+		delete(b.subs, sub)
+		close(sub.values)
+		b.mu.Unlock()
+	}()
+
+	return sub.values
+}
+
+// Publish delivers v to every current subscriber. It returns early with the
+// context's error if ctx is done, or ErrBusClosed once the bus is closed.
+func (b *Bus[T]) Publish(ctx context.Context, v T) error {
+	select {
+	case <-b.done:
+		return ErrBusClosed
+	default:
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return ErrBusClosed
+		case <-sub.done:
+			// subscriber went away mid-publish
+		case sub.values <- v:
+		}
+	}
+
+	return nil
+}
+
+// Pipe publishes every value read from in until in is closed, ctx is done or
+// the bus is closed. It is meant to be used as the sink end of a pipeline.
+func (b *Bus[T]) Pipe(ctx context.Context, in <-chan T) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case v, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if err := b.Publish(ctx, v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Close detaches every subscriber, closing their channels. Publishing after
+// Close returns ErrBusClosed.
+func (b *Bus[T]) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+}
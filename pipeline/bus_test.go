@@ -0,0 +1,101 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestBusFanOut(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	bus := pipeline.NewBus[int]()
+	subs := []<-chan int{bus.Subscribe(ctx, 0), bus.Subscribe(ctx, 4)}
+
+	var wg sync.WaitGroup
+	got := make([][]int, len(subs))
+	for i, sub := range subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = pipelinetest.Collect(t, sub)
+		}()
+	}
+	if err := bus.Pipe(ctx, pipeline.FromSlice(ctx, []int{1, 2, 3})); err != nil {
+		t.Fatal(err)
+	}
+	bus.Close()
+	wg.Wait()
+
+	for i, values := range got {
+		if len(values) != 3 || values[0] != 1 || values[2] != 3 {
+			t.Errorf("subscriber %d got %v, want [1 2 3]", i, values)
+		}
+	}
+}
+
+func TestBusClosed(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	bus := pipeline.NewBus[int]()
+	bus.Close()
+
+	if err := bus.Publish(ctx, 1); !errors.Is(err, pipeline.ErrBusClosed) {
+		t.Errorf("Publish returned %v, want ErrBusClosed", err)
+	}
+	if got := pipelinetest.Collect(t, bus.Subscribe(ctx, 0)); len(got) != 0 {
+		t.Errorf("late subscriber got %v", got)
+	}
+}
+
+func TestBusUnsubscribeUnblocksPublish(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	bus := pipeline.NewBus[int]()
+	defer bus.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	bus.Subscribe(ctx, 0) // never read
+
+	published := make(chan error)
+	go func() { published <- bus.Publish(context.Background(), 1) }()
+	cancel()
+
+	if err := <-published; err != nil {
+		t.Errorf("Publish returned %v once the subscriber left", err)
+	}
+}
+
+func TestBusConcurrentPublishers(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	bus := pipeline.NewBus[int]()
+	sub := bus.Subscribe(ctx, 0)
+	done := make(chan []int)
+	go func() { done <- pipelinetest.Collect(t, sub) }()
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				if err := bus.Publish(ctx, i*100+j); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	bus.Close()
+
+	if got := <-done; len(got) != 800 {
+		t.Errorf("subscriber got %d values, want 800", len(got))
+	}
+}
@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Cache stores the results of a step, see WithCache. Implementations must be
+// safe for concurrent use. Those backed by a network service, such as Redis,
+// should deal with their own errors: a failed Get is best reported as a miss
+// and a failed Set can be dropped, the value is simply computed again.
+type Cache[V any] interface {
+	// Get returns the value stored under key and whether there was one.
+	Get(ctx context.Context, key string) (V, bool)
+	// Set stores value under key.
+	Set(ctx context.Context, key string, value V)
+}
+
+// WithCache memoizes the step's fn: results are stored in cache under
+// keyFn(input), and inputs whose key is already there skip fn. Only
+// successful results are cached. In and Out must be the step's input and
+// output types, calls fail with an error wrapping ErrUnexpectedType
+// otherwise.
+//
+//	pipeline.Step(ctx, ids, fetchUser, pipeline.WithCache(
+//		func(id int) string { return strconv.Itoa(id) },
+//		pipeline.NewLRU[User](10_000),
+//	))
+//
+// Concurrent calls for a key that isn't cached yet all run fn, see
+// WithSingleflight.
+func WithCache[In any, Out any](keyFn func(In) string, cache Cache[Out]) StepOption {
+	return WithMiddleware(func(next StepFunc) StepFunc {
+		return func(ctx context.Context, v any) (any, error) {
+			in, err := as[In](v)
+			if err != nil {
+				return nil, fmt.Errorf("caching: %w", err)
+			}
+			key := keyFn(in)
+			if out, ok := cache.Get(ctx, key); ok {
+				return out, nil
+			}
+
+			v, err = next(ctx, v)
+			if err != nil {
+				return v, err
+			}
+			out, err := as[Out](v)
+			if err != nil {
+				return nil, fmt.Errorf("caching: %w", err)
+			}
+			cache.Set(ctx, key, out)
+			return out, nil
+		}
+	})
+}
+
+// LRU is an in-memory Cache holding up to a fixed number of values, evicting
+// the least recently used one to make room.
+type LRU[V any] struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+var _ Cache[any] = (*LRU[any])(nil)
+
+// NewLRU returns an LRU holding up to size values, at least one.
+func NewLRU[V any](size int) *LRU[V] {
+	return &LRU[V]{
+		size:  max(size, 1),
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored under key, marking it as recently used.
+func (c *LRU[V]) Get(_ context.Context, key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(lruEntry[V]).value, true
+}
+
+// Set stores value under key, evicting the least recently used value if the
+// cache is full.
+func (c *LRU[V]) Set(_ context.Context, key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		e.Value = lruEntry[V]{key: key, value: value}
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(lruEntry[V]{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(lruEntry[V]).key)
+	}
+}
+
+// Len returns the number of values in the cache.
+func (c *LRU[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
@@ -0,0 +1,112 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestWithCache(t *testing.T) {
+	var calls atomic.Int64
+	square := func(v int) (int, error) {
+		calls.Add(1)
+		return v * v, nil
+	}
+	cache := pipeline.NewLRU[int](10)
+
+	out, errs := pipelinetest.RunStage(t, square, []int{1, 2, 1, 2, 3},
+		pipeline.WithConcurrency(1),
+		pipeline.WithCache(func(v int) string { return strconv.Itoa(v) }, cache),
+	)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if want := []int{1, 4, 1, 4, 9}; len(out) != len(want) || out[2] != 1 || out[4] != 9 {
+		t.Errorf("got %v, want %v", out, want)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("fn called %d times, want 3", calls.Load())
+	}
+}
+
+func TestWithCacheWrongTypes(t *testing.T) {
+	identity := func(v int) (int, error) { return v, nil }
+
+	// the cache is declared for string inputs on an int step
+	_, errs := pipelinetest.RunStage(t, identity, []int{1},
+		pipeline.WithCache(func(s string) string { return s }, pipeline.NewLRU[int](10)),
+	)
+
+	if len(errs) != 1 || !errors.Is(errs[0], pipeline.ErrUnexpectedType) {
+		t.Errorf("got errors %v, want an ErrUnexpectedType", errs)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		size    int
+		ops     func(c *pipeline.LRU[int])
+		present []string
+		absent  []string
+	}{
+		{
+			name: "evicts the oldest",
+			size: 2,
+			ops: func(c *pipeline.LRU[int]) {
+				c.Set(ctx, "a", 1)
+				c.Set(ctx, "b", 2)
+				c.Set(ctx, "c", 3)
+			},
+			present: []string{"b", "c"},
+			absent:  []string{"a"},
+		},
+		{
+			name: "get refreshes",
+			size: 2,
+			ops: func(c *pipeline.LRU[int]) {
+				c.Set(ctx, "a", 1)
+				c.Set(ctx, "b", 2)
+				c.Get(ctx, "a")
+				c.Set(ctx, "c", 3)
+			},
+			present: []string{"a", "c"},
+			absent:  []string{"b"},
+		},
+		{
+			name: "size below one holds one",
+			size: 0,
+			ops: func(c *pipeline.LRU[int]) {
+				c.Set(ctx, "a", 1)
+				c.Set(ctx, "b", 2)
+			},
+			present: []string{"b"},
+			absent:  []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := pipeline.NewLRU[int](tt.size)
+			tt.ops(c)
+
+			for _, key := range tt.present {
+				if _, ok := c.Get(ctx, key); !ok {
+					t.Errorf("%s missing", key)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := c.Get(ctx, key); ok {
+					t.Errorf("%s still cached", key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Checkpointer persists how far a pipeline has got through its source, so a
+// restarted pipeline can resume instead of reprocessing everything. The
+// offset is the number of values from the start of the source that have been
+// handled, see Pipeline.Checkpoint.
+type Checkpointer interface {
+	// Load returns the last saved offset, or 0 if nothing was saved yet.
+	Load(ctx context.Context) (int64, error)
+	// Save records offset, replacing the previous one.
+	Save(ctx context.Context, offset int64) error
+}
+
+// CheckpointHistory is implemented by the Checkpointers that keep the offsets
+// saved before the last, so a pipeline can be rewound to one of them by
+// saving it again, e.g. after a bad deploy, see KeepCheckpoints and the
+// pipelineredis and pipelines3 packages.
+type CheckpointHistory interface {
+	// Checkpoints returns the offsets kept, the last saved first.
+	Checkpoints(ctx context.Context) ([]int64, error)
+}
+
+// Checkpoint makes the pipeline resumable. Run starts by loading the offset
+// saved in cp and skipping that many values from the source, then saves the
+// new offset every interval and once more when it returns. With an interval
+// of zero or less it is only saved when Run returns.
+//
+// The offset only moves past a value once it and every value before it have
+// been handed to the sink, or failed and been let through by the pipeline's
+// ErrorPolicy, or been skipped or dropped by a step, see WithBackpressure.
+// A value that stopped the run is therefore processed again on the next one.
+// For this to work the source must produce the same values in the same order
+// every time.
+func (p *Pipeline[T]) Checkpoint(cp Checkpointer, interval time.Duration) *Pipeline[T] {
+	p.checkpointer = cp
+	p.checkpointEvery = interval
+	return p
+}
+
+// sequenced is a value tagged with its position in the source, which is how
+// Run tracks what can be checkpointed.
+type sequenced[T any] struct {
+	seq   int64
+	value T
+	// weight is what the value takes up of the run's MaxInFlight
+	weight int64
+}
+
+// sequence numbers the values from in starting at offset, after skipping the
+// first offset of them, counting the ones it emits in produced.
+func sequence[T any](ctx context.Context, in <-chan T, offset int64, produced *atomic.Int64) <-chan sequenced[T] {
+	outChannel := make(chan sequenced[T])
+
+	go func() {
+		defer close(outChannel)
+
+		var skipped int64
+		seq := offset
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				if skipped < offset {
+					skipped++
+					continue
+				}
+
+				// counted before it is handed on, so it is never done before
+				// it was produced
+				produced.Add(1)
+				select {
+				case <-ctx.Done():
+					produced.Add(-1)
+					return
+				case outChannel <- sequenced[T]{seq: seq, value: v}:
+				}
+				seq++
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// watermark tracks the lowest position below which every value is done.
+// Values are marked done by the run as well as by the steps dropping them.
+type watermark struct {
+	mu   sync.Mutex
+	next int64
+	done map[int64]struct{}
+}
+
+func newWatermark(offset int64) *watermark {
+	return &watermark{next: offset, done: make(map[int64]struct{})}
+}
+
+// offset returns the position below which every value is done.
+func (w *watermark) offset() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.next
+}
+
+func (w *watermark) mark(seq int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.done[seq] = struct{}{}
+	for {
+		if _, ok := w.done[w.next]; !ok {
+			return
+		}
+		delete(w.done, w.next)
+		w.next++
+	}
+}
+
+// MemoryCheckpointer keeps the offset in memory, which lets a pipeline be
+// rerun within the same process. The zero value is ready to use.
+type MemoryCheckpointer struct {
+	mu     sync.Mutex
+	offset int64
+}
+
+// Load returns the last saved offset.
+func (c *MemoryCheckpointer) Load(context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.offset, nil
+}
+
+// Save records offset.
+func (c *MemoryCheckpointer) Save(_ context.Context, offset int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.offset = offset
+	return nil
+}
+
+// FileCheckpointer keeps the offset in a file, so a pipeline can resume after
+// the process restarts.
+type FileCheckpointer struct {
+	path string
+	keep int
+}
+
+var _ CheckpointHistory = (*FileCheckpointer)(nil)
+
+// CheckpointerOption configures a FileCheckpointer.
+type CheckpointerOption func(*FileCheckpointer)
+
+// KeepCheckpoints keeps the last n offsets saved, newest first, one per line
+// of the file, instead of only the last.
+func KeepCheckpoints(n int) CheckpointerOption {
+	return func(c *FileCheckpointer) {
+		if n >= 1 {
+			c.keep = n
+		}
+	}
+}
+
+// NewFileCheckpointer returns a Checkpointer storing the offset at path. The
+// file is created on the first Save.
+func NewFileCheckpointer(path string, opts ...CheckpointerOption) *FileCheckpointer {
+	c := &FileCheckpointer{path: path, keep: 1}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Load reads the offset from the file, returning 0 if it doesn't exist yet.
+func (c *FileCheckpointer) Load(ctx context.Context) (int64, error) {
+	offsets, err := c.Checkpoints(ctx)
+	if err != nil || len(offsets) == 0 {
+		return 0, err
+	}
+
+	return offsets[0], nil
+}
+
+// Checkpoints reads the offsets kept in the file, none if it doesn't exist
+// yet.
+func (c *FileCheckpointer) Checkpoints(context.Context) ([]int64, error) {
+	b, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var offsets []int64
+	for _, line := range strings.Fields(string(b)) {
+		offset, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: invalid checkpoint in %s: %w", c.path, err)
+		}
+		offsets = append(offsets, offset)
+	}
+
+	return offsets, nil
+}
+
+// Save writes offset to the file, ahead of the ones kept before it. It
+// writes to a temporary file first and renames it over the old one, so a
+// crash never leaves a torn checkpoint.
+func (c *FileCheckpointer) Save(ctx context.Context, offset int64) error {
+	offsets := []int64{offset}
+	if c.keep > 1 {
+		previous, err := c.Checkpoints(ctx)
+		if err != nil {
+			return err
+		}
+		offsets = append(offsets, previous[:min(len(previous), c.keep-1)]...)
+	}
+
+	var b strings.Builder
+	for _, offset := range offsets {
+		b.WriteString(strconv.FormatInt(offset, 10) + "\n")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
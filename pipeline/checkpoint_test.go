@@ -0,0 +1,161 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestFileCheckpointer(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []pipeline.CheckpointerOption
+		want []int64
+	}{
+		{name: "last", want: []int64{5}},
+		{name: "keep", opts: []pipeline.CheckpointerOption{pipeline.KeepCheckpoints(3)}, want: []int64{5, 4, 3}},
+		{name: "keep more than saved", opts: []pipeline.CheckpointerOption{pipeline.KeepCheckpoints(10)}, want: []int64{5, 4, 3, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			cp := pipeline.NewFileCheckpointer(filepath.Join(dir, "offset"), tt.opts...)
+
+			if offset, err := cp.Load(ctx); offset != 0 || err != nil {
+				t.Fatalf("Load before any Save = %d, %v, want 0, nil", offset, err)
+			}
+
+			for offset := int64(1); offset <= 5; offset++ {
+				if err := cp.Save(ctx, offset); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if offset, err := cp.Load(ctx); offset != 5 || err != nil {
+				t.Errorf("Load = %d, %v, want 5, nil", offset, err)
+			}
+			got, err := cp.Checkpoints(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Checkpoints = %v, want %v", got, tt.want)
+			}
+
+			// the temporary files are renamed or removed
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Errorf("%d files in the directory, want only the checkpoint", len(entries))
+			}
+		})
+	}
+}
+
+func TestFileCheckpointerInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offset")
+	if err := os.WriteFile(path, []byte("12\nnope\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pipeline.NewFileCheckpointer(path).Load(context.Background()); err == nil {
+		t.Error("Load of a corrupt checkpoint succeeded")
+	}
+}
+
+func TestPipelineCheckpointResumes(t *testing.T) {
+	values := make([]int, 20)
+	for i := range values {
+		values[i] = i
+	}
+
+	cp := &pipeline.MemoryCheckpointer{}
+	run := func(failOn int) ([]int, error) {
+		var mu sync.Mutex
+		var sunk []int
+		err := pipeline.New(pipeline.SliceSource(values)).
+			Then(func(v int) (int, error) {
+				// out of order, so the checkpoint can't just follow the
+				// values handled
+				time.Sleep(time.Duration(v%3) * time.Millisecond)
+				if v == failOn {
+					return 0, errBad
+				}
+				return v, nil
+			}, pipeline.WithConcurrency(4)).
+			Sink(func(v int) error {
+				mu.Lock()
+				defer mu.Unlock()
+				sunk = append(sunk, v)
+				return nil
+			}).
+			Checkpoint(cp, 0).
+			Run(context.Background())
+		slices.Sort(sunk)
+		return sunk, err
+	}
+
+	first, err := run(10)
+	if !errors.Is(err, errBad) {
+		t.Fatalf("first run = %v, want %v", err, errBad)
+	}
+	offset, _ := cp.Load(context.Background())
+	if offset > 10 {
+		t.Fatalf("checkpoint at %d, past the value that failed", offset)
+	}
+	for v := range offset {
+		if !slices.Contains(first, int(v)) {
+			t.Fatalf("checkpoint at %d though %d never reached the sink", offset, v)
+		}
+	}
+
+	second, err := run(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := values[offset:]; !slices.Equal(second, want) {
+		t.Errorf("second run handled %v, want %v, from the checkpoint on", second, want)
+	}
+	if offset, _ := cp.Load(context.Background()); offset != int64(len(values)) {
+		t.Errorf("checkpoint at %d after the second run, want %d", offset, len(values))
+	}
+}
+
+// TestPipelineCheckpointPastDrops holds up the sink until a step dropped a
+// value, after which the checkpoint still has to get to the end.
+func TestPipelineCheckpointPastDrops(t *testing.T) {
+	cp := &pipeline.MemoryCheckpointer{}
+	dropped := make(chan struct{})
+	var once sync.Once
+
+	values := make([]int, 20)
+	err := pipeline.New(pipeline.SliceSource(values)).
+		Then(func(v int) (int, error) { return v, nil },
+			pipeline.WithBackpressure(pipeline.DropNewest),
+			pipeline.WithHooks(pipeline.Hooks{
+				OnItemDropped: func(string, any, pipeline.DropReason) {
+					once.Do(func() { close(dropped) })
+				},
+			})).
+		Sink(func(int) error {
+			<-dropped
+			return nil
+		}).
+		Checkpoint(cp, 0).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if offset, _ := cp.Load(context.Background()); offset != 20 {
+		t.Errorf("checkpointed %d, want 20", offset)
+	}
+}
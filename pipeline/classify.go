@@ -0,0 +1,163 @@
+package pipeline
+
+import "errors"
+
+// ErrorClass is what a failed call means for its value and for the run, see
+// ErrorClassifier.
+type ErrorClass int
+
+const (
+	// ErrorRetry is worth trying again: the value is retried as set with
+	// WithRetry and counts against a circuit breaker. Once its attempts run
+	// out it is handled like ErrorFail.
+	ErrorRetry ErrorClass = iota
+	// ErrorFail fails the value without retrying it. It is reported and the
+	// pipeline's ErrorPolicy decides what happens next.
+	ErrorFail
+	// ErrorSkip drops the value without retrying or reporting it, as if it
+	// had been filtered out. It doesn't count against the ErrorPolicy.
+	ErrorSkip
+	// ErrorFatal stops the run whatever the ErrorPolicy, without retrying.
+	ErrorFatal
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorRetry:
+		return "retry"
+	case ErrorFail:
+		return "fail"
+	case ErrorSkip:
+		return "skip"
+	case ErrorFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorClassifier sorts errors into classes, so a step can tell a timeout
+// worth retrying from bad input worth skipping and a revoked credential that
+// should stop everything:
+//
+//	classify := func(err error) pipeline.ErrorClass {
+//		switch {
+//		case errors.Is(err, ErrUnauthorized):
+//			return pipeline.ErrorFatal
+//		case errors.Is(err, ErrMalformed):
+//			return pipeline.ErrorSkip
+//		default:
+//			return pipeline.DefaultErrorClass(err)
+//		}
+//	}
+//
+// Panics are never retried, a panic classified as ErrorRetry is handled
+// like ErrorFail.
+type ErrorClassifier func(error) ErrorClass
+
+// DefaultErrorClass is how errors are classified without an
+// ErrorClassifier: errors marked with Fatal are ErrorFatal, those marked
+// with Skip are ErrorSkip, those marked with Permanent and panics are
+// ErrorFail, and everything else is ErrorRetry.
+func DefaultErrorClass(err error) ErrorClass {
+	var p *PanicError
+	switch {
+	case IsFatal(err):
+		return ErrorFatal
+	case IsSkip(err):
+		return ErrorSkip
+	case IsPermanent(err) || errors.As(err, &p):
+		return ErrorFail
+	default:
+		return ErrorRetry
+	}
+}
+
+// WithErrorClassifier makes the step classify the errors of its calls with
+// c rather than DefaultErrorClass, deciding which are retried, which count
+// against a circuit breaker, which values are skipped and which errors stop
+// the run.
+func WithErrorClassifier(c ErrorClassifier) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.classify = c
+	}
+}
+
+// ClassifyErrors classifies the errors of every step without its own
+// WithErrorClassifier, and of the sink, with c, see ErrorClassifier.
+func (p *Pipeline[T]) ClassifyErrors(c ErrorClassifier) *Pipeline[T] {
+	p.classify = c
+	return p
+}
+
+// classify returns the class of err according to c, or DefaultErrorClass if
+// c is nil.
+func classify(c ErrorClassifier, err error) ErrorClass {
+	if c == nil {
+		return DefaultErrorClass(err)
+	}
+
+	class := c(err)
+	var p *PanicError
+	if class == ErrorRetry && errors.As(err, &p) {
+		return ErrorFail
+	}
+	return class
+}
+
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string { return e.err.Error() }
+func (e *fatalError) Unwrap() error { return e.err }
+
+// Fatal marks err as stopping the run, whatever the ErrorPolicy says. It is
+// not retried either. The original error is still reachable with errors.Is
+// and errors.As.
+func Fatal(err error) error {
+	if err == nil || IsFatal(err) {
+		return err
+	}
+
+	return &fatalError{err: err}
+}
+
+// IsFatal reports whether err, or any error it wraps, was marked with Fatal.
+func IsFatal(err error) bool {
+	var f *fatalError
+	return errors.As(err, &f)
+}
+
+type skipError struct {
+	err error
+}
+
+func (e *skipError) Error() string { return e.err.Error() }
+func (e *skipError) Unwrap() error { return e.err }
+
+// Skip marks err as only meaning its value should be dropped, so fn can
+// skip a value it has no use for without it being reported, see ErrorSkip.
+// The original error is still reachable with errors.Is and errors.As.
+func Skip(err error) error {
+	if err == nil || IsSkip(err) {
+		return err
+	}
+
+	return &skipError{err: err}
+}
+
+// IsSkip reports whether err, or any error it wraps, was marked with Skip.
+func IsSkip(err error) bool {
+	var s *skipError
+	return errors.As(err, &s)
+}
+
+// skippedError is how a step tells Pipeline about a value it skipped, see
+// reportSkips.
+type skippedError struct {
+	err error
+}
+
+func (e *skippedError) Error() string { return e.err.Error() }
+func (e *skippedError) Unwrap() error { return e.err }
@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is where everything that waits on or measures time gets it from: the
+// windows, Batch, Throttle, Debounce, Join, Dedupe, the tickers and cron
+// schedules, WithItemTimeout, WithBudget, retry backoffs, circuit breakers,
+// autoscaling and step latencies, and a Pipeline's Timeout, checkpoints,
+// Progress, Watchdog and AtLeastOnce redeliveries. It is the real clock
+// unless the context the stage, or Run, is started with carries another one,
+// see WithClock, which lets tests drive them with a fake clock instead of
+// sleeping. The connectors of the subpackages wait on it too, for their
+// backoffs, flush intervals and leases.
+//
+// Under testing/synctest the real clock is the bubble's, so a pipeline run
+// in a bubble needs no WithClock to run in virtual time: a test waiting out
+// an hour long window returns at once, the same way every time.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a time.Timer obtained from a Clock. Like time.Timer in Go 1.23,
+// no stale time is received from C after Stop or Reset returns.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a time.Ticker obtained from a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type clockKey struct{}
+
+// WithClock returns a copy of ctx that makes the stages started with it use
+// c, see Clock.
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// ClockFrom returns the Clock ctx carries, see WithClock, or the real clock if
+// it carries none, for sources, sinks and middleware waiting on time
+// themselves.
+func ClockFrom(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return c
+	}
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// withClockTimeout is context.WithTimeout on ctx's clock. The context package
+// only knows the real clock, so with any other one the returned context is
+// cancelled with context.DeadlineExceeded as its cause once the clock's timer
+// fires.
+func withClockTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return withClockTimeoutCause(ctx, d, nil)
+}
+
+// withClockTimeoutCause is withClockTimeout reporting cause, if not nil, as
+// the reason the returned context is done once d has passed, see
+// context.WithTimeoutCause.
+func withClockTimeoutCause(ctx context.Context, d time.Duration, cause error) (context.Context, context.CancelFunc) {
+	clock := ClockFrom(ctx)
+	if _, ok := clock.(realClock); ok {
+		return context.WithTimeoutCause(ctx, d, cause)
+	}
+	if cause == nil {
+		cause = context.DeadlineExceeded
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := clock.NewTimer(d)
+	go func() {
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-timer.C():
+			cancel(cause)
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
@@ -0,0 +1,270 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// fakeContext returns a context carrying a FakeClock, cancelled once the
+// test ends.
+func fakeContext(t *testing.T) (context.Context, *pipelinetest.FakeClock) {
+	clock := pipelinetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(pipeline.WithClock(context.Background(), clock))
+	t.Cleanup(cancel)
+	return ctx, clock
+}
+
+// assertNothing fails the test if in has a value ready.
+func assertNothing[T any](t *testing.T, in <-chan T) {
+	t.Helper()
+
+	select {
+	case v, ok := <-in:
+		t.Fatalf("got %v (open: %v), want nothing yet", v, ok)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestDedupeFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	in := make(chan string)
+	out := pipeline.Dedupe(ctx, in, func(s string) string { return s }, time.Minute)
+	send := func(s string) {
+		select {
+		case in <- s:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Dedupe not reading")
+		}
+	}
+
+	send("a")
+	if got := pipelinetest.Receive(t, out); got != "a" {
+		t.Fatalf("got %q, want a", got)
+	}
+	clock.Advance(30 * time.Second)
+	send("a") // within the window
+	send("b")
+	if got := pipelinetest.Receive(t, out); got != "b" {
+		t.Fatalf("got %q, want the duplicate dropped and b", got)
+	}
+	clock.Advance(31 * time.Second)
+	send("a")
+	if got := pipelinetest.Receive(t, out); got != "a" {
+		t.Fatalf("got %q, want a again once its window passed", got)
+	}
+	close(in)
+	pipelinetest.Collect(t, out)
+}
+
+func TestJoinFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	left, right := make(chan string), make(chan string)
+	key := func(s string) string { return s }
+	out := pipeline.Join(ctx, left, right, key, key, time.Minute)
+
+	left <- "k1"
+	clock.WaitForTimers(1)
+	clock.Advance(30 * time.Second)
+	left <- "k2"
+	clock.Advance(30 * time.Second)
+	// k1 has expired once the timer is set again for k2
+	clock.WaitForTimers(1)
+
+	right <- "k1"
+	right <- "k2"
+	if got := pipelinetest.Receive(t, out); got.First != "k2" {
+		t.Fatalf("got %+v, want k2 matched", got)
+	}
+	close(left)
+	close(right)
+	if rest := pipelinetest.Collect(t, out); len(rest) > 0 {
+		t.Errorf("got %+v, want k1 expired", rest)
+	}
+}
+
+func TestRetryBackoffFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	var calls atomic.Int64
+	in := make(chan int, 1)
+	in <- 1
+	close(in)
+	out, errs := pipeline.Step(ctx, in, func(v int) (int, error) {
+		if calls.Add(1) == 1 {
+			return 0, errors.New("flaky")
+		}
+		return v, nil
+	}, pipeline.WithRetry(2, pipeline.ConstantBackoff(time.Hour)))
+
+	clock.WaitForTimers(1)
+	assertNothing(t, out)
+	clock.Advance(time.Hour)
+	if got := pipelinetest.Receive(t, out); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	pipelinetest.Collect(t, out)
+	if failures := pipelinetest.Collect(t, errs); len(failures) > 0 {
+		t.Error(failures)
+	}
+}
+
+func TestCircuitBreakerFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	var down atomic.Bool
+	down.Store(true)
+	in := make(chan int, 2)
+	in <- 1
+	in <- 2
+	close(in)
+	out, errs := pipeline.Step(ctx, in, func(v int) (int, error) {
+		if down.Load() {
+			return 0, errors.New("down")
+		}
+		return v, nil
+	}, pipeline.WithConcurrency(1), pipeline.WithCircuitBreaker(1, time.Minute))
+
+	pipelinetest.Receive(t, errs)
+	// the second value waits out the cooldown
+	clock.WaitForTimers(1)
+	down.Store(false)
+	assertNothing(t, out)
+	clock.Advance(time.Minute)
+	if got := pipelinetest.Receive(t, out); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+	pipelinetest.Collect(t, out)
+	pipelinetest.Collect(t, errs)
+}
+
+func TestPipelineTimeoutFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	never := func(ctx context.Context) (<-chan int, error) {
+		out := make(chan int)
+		go func() {
+			<-ctx.Done()
+			close(out)
+		}()
+		return out, nil
+	}
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(never).Sink(func(int) error { return nil }).Timeout(time.Hour).Run(ctx)
+	}()
+
+	clock.WaitForTimers(1)
+	assertNothing(t, done)
+	clock.Advance(time.Hour)
+	if err := <-done; !errors.Is(err, pipeline.ErrDeadlineExceeded) {
+		t.Errorf("Run returned %v, want ErrDeadlineExceeded", err)
+	}
+}
+
+// TestBudgetFakeClock runs out the budget of a step that hangs while values
+// keep coming, with errors collected rather than stopping the run, which
+// would leave the steps before it blocked if the budget didn't stop it.
+func TestBudgetFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	values := make([]int, 100)
+	hang := func(ctx context.Context, v int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(pipeline.SliceSource(values)).
+			Then(func(v int) (int, error) { return v, nil }).
+			ThenCtx(hang, pipeline.WithName("hang"), pipeline.WithBudget(time.Minute)).
+			Sink(func(int) error { return nil }).
+			OnError(pipeline.CollectErrors()).
+			Run(ctx)
+	}()
+
+	clock.WaitForTimers(1)
+	assertNothing(t, done)
+	clock.Advance(time.Minute)
+	err := <-done
+	var stageErr *pipeline.StageError
+	if !errors.Is(err, pipeline.ErrBudgetExceeded) || !errors.As(err, &stageErr) || stageErr.Stage != "hang" {
+		t.Errorf("Run returned %v, want ErrBudgetExceeded from hang", err)
+	}
+}
+
+func TestAtLeastOnceFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	var calls atomic.Int64
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(pipeline.SliceSource([]int{1})).
+			Sink(func(int) error {
+				if calls.Add(1) == 1 {
+					return errors.New("unavailable")
+				}
+				return nil
+			}).
+			AtLeastOnce(10, 0, pipeline.ConstantBackoff(time.Hour)).
+			Run(ctx)
+	}()
+
+	clock.WaitForTimers(1)
+	assertNothing(t, done)
+	clock.Advance(time.Hour)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("sink called %d times, want 2", calls.Load())
+	}
+}
+
+func TestWatchdogFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(pipeline.SliceSource([]int{1})).
+			ThenCtx(func(ctx context.Context, v int) (int, error) {
+				close(started)
+				<-ctx.Done()
+				return 0, ctx.Err()
+			}, pipeline.WithName("hung")).
+			Sink(func(int) error { return nil }).
+			Watchdog(time.Minute, true).
+			Run(ctx)
+	}()
+
+	<-started
+	clock.WaitForTimers(1)
+	for range 1000 {
+		clock.Advance(15 * time.Second)
+		select {
+		case err := <-done:
+			if !errors.Is(err, pipeline.ErrStalled) {
+				t.Errorf("Run returned %v, want ErrStalled", err)
+			}
+			return
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	t.Fatal("Watchdog never stopped the run")
+}
@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Codec turns values into bytes and back, for the stages that write values
+// outside the process, such as Spill and Record. Codecs can be wrapped to
+// compress or encrypt what they encode, see GzipCodec and AESCodec, and the
+// pipelinezstd package for zstd.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes values with encoding/json.
+func JSONCodec[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+type jsonCodec[T any] struct{}
+
+func (jsonCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GzipCodec compresses what inner encodes with gzip, e.g. for values spilled
+// to disk or recorded with Record that compress well.
+func GzipCodec[T any](inner Codec[T]) Codec[T] {
+	return byteCodec[T]{
+		inner: inner,
+		encode: func(data []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			if _, err := w.Write(data); err != nil {
+				return nil, err
+			}
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		},
+		decode: func(data []byte) ([]byte, error) {
+			r, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return io.ReadAll(r)
+		},
+	}
+}
+
+// AESCodec encrypts what inner encodes with AES-GCM under key, which must be
+// 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256, so data persisted
+// by the pipeline is safe at rest. Every value gets a random nonce, and
+// decoding fails if the data was tampered with or encrypted under another
+// key. Compress before encrypting, encrypted data doesn't compress:
+//
+//	codec, err := pipeline.AESCodec(pipeline.GzipCodec(pipeline.JSONCodec[Order]()), key)
+func AESCodec[T any](inner Codec[T], key []byte) (Codec[T], error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline: AES codec: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline: AES codec: %w", err)
+	}
+
+	return byteCodec[T]{
+		inner: inner,
+		encode: func(data []byte) ([]byte, error) {
+			nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+			if _, err := rand.Read(nonce); err != nil {
+				return nil, err
+			}
+			// the nonce goes first, the ciphertext is appended to it
+			return aead.Seal(nonce, nonce, data, nil), nil
+		},
+		decode: func(data []byte) ([]byte, error) {
+			if len(data) < aead.NonceSize() {
+				return nil, errors.New("pipeline: AES codec: data too short")
+			}
+			nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+			return aead.Open(nil, nonce, ciphertext, nil)
+		},
+	}, nil
+}
+
+// byteCodec transforms the bytes of inner, encode after inner's Encode and
+// decode before its Decode.
+type byteCodec[T any] struct {
+	inner  Codec[T]
+	encode func([]byte) ([]byte, error)
+	decode func([]byte) ([]byte, error)
+}
+
+func (c byteCodec[T]) Encode(v T) ([]byte, error) {
+	data, err := c.inner.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.encode(data)
+}
+
+func (c byteCodec[T]) Decode(data []byte) (T, error) {
+	data, err := c.decode(data)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.inner.Decode(data)
+}
@@ -0,0 +1,87 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+type payload struct {
+	ID   int
+	Body string
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	aes, err := pipeline.AESCodec(pipeline.GzipCodec(pipeline.JSONCodec[payload]()), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		codec pipeline.Codec[payload]
+	}{
+		{name: "json", codec: pipeline.JSONCodec[payload]()},
+		{name: "gzip", codec: pipeline.GzipCodec(pipeline.JSONCodec[payload]())},
+		{name: "aes over gzip", codec: aes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := payload{ID: 1, Body: "hello"}
+			data, err := tt.codec.Encode(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.codec.Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != v {
+				t.Errorf("round trip gave %+v, want %+v", got, v)
+			}
+		})
+	}
+}
+
+func TestAESCodecRejects(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 16)
+	codec, err := pipeline.AESCodec(pipeline.JSONCodec[payload](), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := pipeline.AESCodec(pipeline.JSONCodec[payload](), bytes.Repeat([]byte{8}, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := codec.Encode(payload{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name  string
+		codec pipeline.Codec[payload]
+		data  []byte
+	}{
+		{name: "tampered", codec: codec, data: tampered},
+		{name: "other key", codec: other, data: data},
+		{name: "too short", codec: codec, data: data[:4]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.codec.Decode(tt.data); err == nil {
+				t.Error("Decode succeeded")
+			}
+		})
+	}
+
+	if _, err := pipeline.AESCodec(pipeline.JSONCodec[payload](), []byte("short")); err == nil {
+		t.Error("AESCodec accepted a 5 byte key")
+	}
+}
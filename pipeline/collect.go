@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+)
+
+// Collect is a sink that gathers everything a pipeline produces instead of
+// logging it, so pipelines can be used from services and tests. It reads
+// values and errs until both are closed and returns the values in the order
+// they arrived along with every error joined by errors.Join. Unlike Sink it
+// doesn't stop at the first error.
+//
+// If ctx is done first, Collect returns what it had gathered so far with the
+// context's cause joined to the others, see context.Cause, so a drained or
+// timed out pipeline can be told apart from a cancelled one.
+func Collect[T any](ctx context.Context, values <-chan T, errs <-chan error) ([]T, error) {
+	var (
+		results []T
+		errList []error
+	)
+
+	for values != nil || errs != nil {
+		select {
+		case <-ctx.Done():
+			errList = append(errList, context.Cause(ctx))
+			return results, errors.Join(errList...)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			errList = append(errList, err)
+		case v, ok := <-values:
+			if !ok {
+				values = nil
+				continue
+			}
+			results = append(results, v)
+		}
+	}
+
+	return results, errors.Join(errList...)
+}
@@ -0,0 +1,44 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestCollect(t *testing.T) {
+	got, err := pipeline.Collect(context.Background(), waiting(1, 2, 3), waiting(errBad))
+	if !slices.Equal(got, []int{1, 2, 3}) || !errors.Is(err, errBad) {
+		t.Errorf("Collect = %v, %v, want [1 2 3], %v", got, err, errBad)
+	}
+}
+
+// TestCollectCause checks Collect reports why ctx is done rather than just
+// that it was cancelled.
+func TestCollectCause(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	values, errs := make(chan int), make(chan error)
+	defer close(values)
+	defer close(errs)
+
+	done := make(chan struct{})
+	var got []int
+	var err error
+	go func() {
+		defer close(done)
+		got, err = pipeline.Collect(ctx, values, errs)
+	}()
+	values <- 1
+	cancel(pipeline.ErrDrained)
+	<-done
+
+	if !slices.Equal(got, []int{1}) || !errors.Is(err, pipeline.ErrDrained) {
+		t.Errorf("Collect = %v, %v, want [1], %v", got, err, pipeline.ErrDrained)
+	}
+}
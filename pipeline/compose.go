@@ -0,0 +1,75 @@
+package pipeline
+
+import "context"
+
+// Stage is a step of a pipeline that hasn't been started yet. Unlike the
+// steps of a Pipeline, stages may change the type of the values flowing
+// through them, and Compose2 and friends check at compile time that each
+// stage accepts what the previous one produces:
+//
+//	parse := pipeline.NewStage(strconv.Atoi)
+//	square := pipeline.NewStage(func(n int) (int, error) { return n * n, nil })
+//	format := pipeline.NewStage(func(n int) (string, error) { return strconv.Itoa(n), nil })
+//
+//	out, errs := pipeline.Compose3(parse, square, format)(ctx, lines)
+//
+// Calling a Stage starts it, with the same channel semantics as Step.
+type Stage[In any, Out any] func(ctx context.Context, in <-chan In) (<-chan Out, <-chan error)
+
+// NewStage returns a Stage running fn with the given options, see Step.
+func NewStage[In any, Out any](fn func(In) (Out, error), opts ...StepOption) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In) (<-chan Out, <-chan error) {
+		return Step(ctx, in, fn, opts...)
+	}
+}
+
+// NewStageCtx returns a Stage running a context-aware fn with the given
+// options, see StepCtx.
+func NewStageCtx[In any, Out any](fn func(context.Context, In) (Out, error), opts ...StepOption) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In) (<-chan Out, <-chan error) {
+		return StepCtx(ctx, in, fn, opts...)
+	}
+}
+
+// Lift turns a combinator that can't fail, such as Batch or Filter, into a
+// Stage whose error channel is closed once its output is.
+//
+//	batch := pipeline.Lift(func(ctx context.Context, in <-chan int) <-chan []int {
+//		return pipeline.Batch(ctx, in, 100, time.Second)
+//	})
+func Lift[In any, Out any](fn func(ctx context.Context, in <-chan In) <-chan Out) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In) (<-chan Out, <-chan error) {
+		errs := make(chan error)
+		close(errs)
+
+		return fn(ctx, in), errs
+	}
+}
+
+// Compose2 chains two stages into one. The errors of both are merged into
+// the returned error channel.
+func Compose2[A any, B any, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(ctx context.Context, in <-chan A) (<-chan C, <-chan error) {
+		b, errsB := first(ctx, in)
+		c, errsC := second(ctx, b)
+
+		return c, Merge(ctx, errsB, errsC)
+	}
+}
+
+// Compose3 chains three stages into one, see Compose2.
+func Compose3[A any, B any, C any, D any](first Stage[A, B], second Stage[B, C], third Stage[C, D]) Stage[A, D] {
+	return Compose2(Compose2(first, second), third)
+}
+
+// Compose4 chains four stages into one, see Compose2.
+func Compose4[A any, B any, C any, D any, E any](first Stage[A, B], second Stage[B, C], third Stage[C, D], fourth Stage[D, E]) Stage[A, E] {
+	return Compose2(Compose3(first, second, third), fourth)
+}
+
+// Then chains next after s, for stages that keep the same type. Use Compose2
+// when the type changes, since methods can't have type parameters of their
+// own.
+func (s Stage[In, Out]) Then(next Stage[Out, Out]) Stage[In, Out] {
+	return Compose2(s, next)
+}
@@ -0,0 +1,54 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestCompose(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	parse := pipeline.NewStage(strconv.Atoi, pipeline.WithOrderedOutput())
+	square := pipeline.NewStage(func(n int) (int, error) { return n * n, nil }, pipeline.WithOrderedOutput())
+	format := pipeline.NewStageCtx(func(_ context.Context, n int) (string, error) {
+		if n > 100 {
+			return "", errBad
+		}
+		return "#" + strconv.Itoa(n), nil
+	}, pipeline.WithOrderedOutput())
+	positive := pipeline.Lift(func(ctx context.Context, in <-chan int) <-chan int {
+		return pipeline.Filter(ctx, in, func(n int) bool { return n > 0 })
+	})
+
+	tests := []struct {
+		name  string
+		stage pipeline.Stage[string, string]
+		want  []string
+	}{
+		{name: "compose3", stage: pipeline.Compose3(parse, square, format), want: []string{"#4", "#1", "#9"}},
+		{name: "compose4", stage: pipeline.Compose4(parse, positive, square, format), want: []string{"#4", "#9"}},
+		{name: "then", stage: pipeline.Compose2(parse.Then(positive).Then(square), format), want: []string{"#4", "#9"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errs := pipelinetest.Run(t, context.Background(), tt.stage, []string{"2", "x", "-1", "3", "11"})
+			if !slices.Equal(out, tt.want) {
+				t.Errorf("got %v, want %v", out, tt.want)
+			}
+
+			// one error from parsing "x", one from formatting 121
+			var numErr *strconv.NumError
+			if len(errs) != 2 || !slices.ContainsFunc(errs, func(err error) bool { return errors.As(err, &numErr) }) ||
+				!slices.ContainsFunc(errs, func(err error) bool { return errors.Is(err, errBad) }) {
+				t.Errorf("got errors %v, want one from each failing stage", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ControlOption configures the handler of Manager.AdminHandler.
+type ControlOption func(*controlConfig)
+
+type controlConfig struct {
+	auth  func(r *http.Request) error
+	build func(name string, definition []byte) (Runnable, string, error)
+}
+
+// WithAuth has every request to the handler checked by auth first, e.g. for
+// a bearer token or a client certificate; the requests it returns an error
+// for are turned away with 401 Unauthorized and the error's text.
+func WithAuth(auth func(r *http.Request) error) ControlOption {
+	return func(cfg *controlConfig) {
+		cfg.auth = auth
+	}
+}
+
+// WithReconfigure lets the handler reconfigure pipelines, building the
+// replacement of the pipeline called name, and the version of its
+// definition, from the definition in the body of the request, see
+// pipelineconfig.Registry.Reconfigure.
+func WithReconfigure(build func(name string, definition []byte) (next Runnable, version string, err error)) ControlOption {
+	return func(cfg *controlConfig) {
+		cfg.build = build
+	}
+}
+
+// ManagedStatus is what Manager.AdminHandler reports about a pipeline.
+type ManagedStatus struct {
+	Status
+	// Version is the version of the pipeline's definition, see
+	// WithVersion.
+	Version string `json:"version,omitempty"`
+	// Err is what its last run returned, empty while it runs.
+	Err string `json:"error,omitempty"`
+}
+
+// maxDefinition is the most of a request's body read as a definition.
+const maxDefinition = 1 << 20
+
+// AdminHandler returns an http.Handler for operating the Manager's
+// pipelines remotely, a control plane to be mounted wherever suits:
+//
+//	http.Handle("/pipelines/", http.StripPrefix("/pipelines", m.AdminHandler(
+//		pipeline.WithAuth(checkToken),
+//		pipeline.WithReconfigure(registry.Reconfigure),
+//	)))
+//
+// It serves:
+//
+//	GET  /              the ManagedStatus of every pipeline as JSON, by name
+//	GET  /{name}        the ManagedStatus of the pipeline
+//	POST /{name}/start  Start, then the ManagedStatus
+//	POST /{name}/stop   Stop, then the ManagedStatus
+//	POST /{name}/pause  Pause, then the ManagedStatus
+//	POST /{name}/resume Resume, then the ManagedStatus
+//	PUT  /{name}        Swap in a pipeline built from the definition in the
+//	                    body, or Add one not started, then the ManagedStatus
+//
+// Stopping and swapping wait for the pipeline to flush for the grace period
+// given in the grace parameter, as for Pipeline.AdminHandler. A pipeline
+// whose definition has the version of the one in the body already isn't
+// swapped. Reconfiguring takes WithReconfigure, without it PUT answers 501
+// Not Implemented. Without WithAuth the handler has no access control of
+// its own, so don't expose it to the outside.
+func (m *Manager) AdminHandler(opts ...ControlOption) http.Handler {
+	var cfg controlConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	mux := http.NewServeMux()
+	respond := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	status := func(w http.ResponseWriter, name string) {
+		s, err := m.managedStatus(name)
+		if err != nil {
+			controlError(w, err)
+			return
+		}
+		respond(w, s)
+	}
+	action := func(do func(r *http.Request, name string) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			name := r.PathValue("name")
+			if err := do(r, name); err != nil {
+				controlError(w, err)
+				return
+			}
+			status(w, name)
+		}
+	}
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		statuses := make(map[string]ManagedStatus)
+		for _, name := range m.Names() {
+			// one removed meanwhile is left out
+			if s, err := m.managedStatus(name); err == nil {
+				statuses[name] = s
+			}
+		}
+		respond(w, statuses)
+	})
+	mux.HandleFunc("GET /{name}", func(w http.ResponseWriter, r *http.Request) {
+		status(w, r.PathValue("name"))
+	})
+	mux.HandleFunc("POST /{name}/start", action(func(r *http.Request, name string) error {
+		return m.Start(name)
+	}))
+	mux.HandleFunc("POST /{name}/pause", action(func(r *http.Request, name string) error {
+		return m.Pause(name)
+	}))
+	mux.HandleFunc("POST /{name}/resume", action(func(r *http.Request, name string) error {
+		return m.Resume(name)
+	}))
+	mux.HandleFunc("POST /{name}/stop", action(func(r *http.Request, name string) error {
+		ctx, cancel, err := graceContext(r)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		return m.Stop(ctx, name)
+	}))
+	mux.HandleFunc("PUT /{name}", action(func(r *http.Request, name string) error {
+		if cfg.build == nil {
+			return errNoReconfigure
+		}
+		ctx, cancel, err := graceContext(r)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		definition, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxDefinition))
+		if err != nil {
+			return badRequest{err}
+		}
+		next, version, err := cfg.build(name, definition)
+		if err != nil {
+			return badRequest{err}
+		}
+		return m.reconfigure(ctx, name, next, version)
+	}))
+
+	if cfg.auth == nil {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := cfg.auth(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// reconfigure swaps next in for the pipeline called name, unless it runs
+// version already, adding it if there is none.
+func (m *Manager) reconfigure(ctx context.Context, name string, next Runnable, version string) error {
+	current, err := m.Version(name)
+	if errors.Is(err, ErrUnknownPipeline) {
+		err = m.Add(name, next)
+	}
+	if err != nil {
+		return err
+	}
+	if version != "" && version == current {
+		return nil
+	}
+	return m.Swap(ctx, name, next, WithVersion(version))
+}
+
+func (m *Manager) managedStatus(name string) (ManagedStatus, error) {
+	e, err := m.lookup(name)
+	if err != nil {
+		return ManagedStatus{}, err
+	}
+
+	s := ManagedStatus{Status: e.r.Status(), Version: e.version}
+	if err := m.Err(name); err != nil {
+		s.Err = err.Error()
+	}
+	return s, nil
+}
+
+var errNoReconfigure = errors.New("pipeline: reconfiguring isn't enabled, see WithReconfigure")
+
+// badRequest is an error caused by what the client sent.
+type badRequest struct{ err error }
+
+func (e badRequest) Error() string { return e.err.Error() }
+func (e badRequest) Unwrap() error { return e.err }
+
+// controlError answers with err and the status code it calls for.
+func controlError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	var bad badRequest
+	switch {
+	case errors.As(err, &bad):
+		code = http.StatusBadRequest
+	case errors.Is(err, ErrUnknownPipeline):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrRunning), errors.Is(err, ErrPipelineExists), errors.Is(err, ErrNotPausable):
+		code = http.StatusConflict
+	case errors.Is(err, errNoReconfigure):
+		code = http.StatusNotImplemented
+	case errors.Is(err, context.DeadlineExceeded):
+		code = http.StatusGatewayTimeout
+	}
+	http.Error(w, err.Error(), code)
+}
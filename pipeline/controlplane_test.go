@@ -0,0 +1,154 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// endless returns a pipeline emitting until it is stopped.
+func endless() *pipeline.Pipeline[int] {
+	return pipeline.New(blockingSource).
+		Then(func(v int) (int, error) { return v, nil }, pipeline.WithName("id")).
+		Sink(func(int) error { return nil })
+}
+
+func TestManagerAdminHandler(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	m := pipeline.NewManager(context.Background())
+	defer m.Shutdown(context.Background())
+	if err := m.Add("flow", endless()); err != nil {
+		t.Fatal(err)
+	}
+	g := pipeline.NewGraph()
+	pipeline.AddSource(g, "numbers", pipeline.SliceSource([]int{1}))
+	pipeline.AddSink(g, "sink", func(int) error { return nil })
+	if err := m.Add("graph", g.Connect("numbers", "sink")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(m.AdminHandler(
+		pipeline.WithAuth(func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("bad token")
+			}
+			return nil
+		}),
+		pipeline.WithReconfigure(func(name string, definition []byte) (pipeline.Runnable, string, error) {
+			if string(definition) == "bad" {
+				return nil, "", errors.New("bad definition")
+			}
+			return endless(), string(definition), nil
+		}),
+	))
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		method, path string
+		body         string
+		noAuth       bool
+		wantCode     int
+		// want checks the ManagedStatus of a successful request
+		want func(s pipeline.ManagedStatus) bool
+	}{
+		{name: "no token", method: http.MethodGet, path: "/", noAuth: true, wantCode: http.StatusUnauthorized},
+		{name: "unknown", method: http.MethodGet, path: "/ship", wantCode: http.StatusNotFound},
+		{
+			name: "status", method: http.MethodGet, path: "/flow", wantCode: http.StatusOK,
+			want: func(s pipeline.ManagedStatus) bool { return !s.Running && s.Stages[0].Name == "id" },
+		},
+		{name: "start", method: http.MethodPost, path: "/flow/start", wantCode: http.StatusOK},
+		{name: "start again", method: http.MethodPost, path: "/flow/start", wantCode: http.StatusConflict},
+		{
+			name: "pause", method: http.MethodPost, path: "/flow/pause", wantCode: http.StatusOK,
+			want: func(s pipeline.ManagedStatus) bool { return s.Paused },
+		},
+		{name: "pause a graph", method: http.MethodPost, path: "/graph/pause", wantCode: http.StatusConflict},
+		{
+			name: "resume", method: http.MethodPost, path: "/flow/resume", wantCode: http.StatusOK,
+			want: func(s pipeline.ManagedStatus) bool { return !s.Paused },
+		},
+		{
+			name: "reconfigure", method: http.MethodPut, path: "/flow", body: "2", wantCode: http.StatusOK,
+			want: func(s pipeline.ManagedStatus) bool { return s.Version == "2" },
+		},
+		{name: "bad definition", method: http.MethodPut, path: "/flow", body: "bad", wantCode: http.StatusBadRequest},
+		{
+			name: "add", method: http.MethodPut, path: "/new", body: "1", wantCode: http.StatusOK,
+			want: func(s pipeline.ManagedStatus) bool { return s.Version == "1" && !s.Running },
+		},
+		{name: "bad grace", method: http.MethodPost, path: "/flow/stop?grace=soon", wantCode: http.StatusBadRequest},
+		{
+			name: "stop", method: http.MethodPost, path: "/flow/stop?grace=10s", wantCode: http.StatusOK,
+			want: func(s pipeline.ManagedStatus) bool { return !s.Running && s.Err == "" },
+		},
+		{name: "unknown method", method: http.MethodDelete, path: "/flow", wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tt.noAuth {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s pipeline.ManagedStatus
+		decodeErr := json.NewDecoder(resp.Body).Decode(&s)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantCode {
+			t.Fatalf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.wantCode)
+		}
+		if tt.want == nil {
+			continue
+		}
+		if decodeErr != nil {
+			t.Fatalf("%s: %v", tt.name, decodeErr)
+		}
+		if !tt.want(s) {
+			t.Errorf("%s: got %+v", tt.name, s)
+		}
+	}
+
+	// every pipeline is listed
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var all map[string]pipeline.ManagedStatus
+	if err := json.NewDecoder(resp.Body).Decode(&all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all["flow"].Version != "2" {
+		t.Errorf("GET / = %+v, want flow, graph and new", all)
+	}
+}
+
+func TestManagerAdminHandlerWithoutReconfigure(t *testing.T) {
+	m := pipeline.NewManager(context.Background())
+	if err := m.Add("flow", endless()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/flow", strings.NewReader("2")))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+)
+
+// CorrelationHeader is the header NewMessageFrom adopts a message's ID from,
+// and sets to it, so the ID travels on to whatever systems the message's
+// headers are forwarded to.
+const CorrelationHeader = "X-Correlation-Id"
+
+// NewMessageFrom wraps payload in a Message carrying headers, received with
+// it from a broker or an HTTP request, say. The message adopts the ID in
+// their CorrelationHeader, or gets a random one set there if there is none,
+// so a value can be followed from the system it came from through every
+// stage to the ones it goes on to.
+func NewMessageFrom[T any](payload T, headers Headers) Message[T] {
+	m := NewMessage(payload)
+	if len(headers) > 0 {
+		m.Headers = headers.Clone()
+	}
+	if id := m.Headers.Get(CorrelationHeader); id != "" {
+		m.ID = id
+	} else {
+		m.Headers.Set(CorrelationHeader, m.ID)
+	}
+
+	return m
+}
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying id, see CorrelationID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the ID of the Message a step is working on from the
+// context fn is called with, "" if the value isn't a Message or ctx didn't
+// come from a step. Steps log it as "id" with every line about the value,
+// and so does their logger, see WithLogger, when given ctx:
+//
+//	logger.InfoContext(ctx, "stored", "key", key)
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// correlationID returns the ID of v if it is a Message.
+func correlationID(v any) string {
+	if d, ok := v.(described); ok {
+		id, _ := d.metadata()
+		return id
+	}
+
+	return ""
+}
+
+// correlationHandler is a slog.Handler adding the CorrelationID of the
+// context it is given to every record.
+type correlationHandler struct {
+	slog.Handler
+}
+
+func (h correlationHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := CorrelationID(ctx); id != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("id", id))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h correlationHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return correlationHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h correlationHandler) WithGroup(name string) slog.Handler {
+	return correlationHandler{Handler: h.Handler.WithGroup(name)}
+}
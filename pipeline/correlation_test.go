@@ -0,0 +1,102 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestNewMessageFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers pipeline.Headers
+		wantID  string
+	}{
+		{name: "adopts the header", headers: pipeline.Headers{pipeline.CorrelationHeader: "abc", "k": "v"}, wantID: "abc"},
+		{name: "generates an ID", headers: pipeline.Headers{"k": "v"}},
+		{name: "no headers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := pipeline.NewMessageFrom(1, tt.headers)
+			if tt.wantID != "" && m.ID != tt.wantID {
+				t.Errorf("ID = %q, want %q", m.ID, tt.wantID)
+			}
+			if m.ID == "" {
+				t.Error("no ID")
+			}
+			if got := m.Headers.Get(pipeline.CorrelationHeader); got != m.ID {
+				t.Errorf("header = %q, want the ID %q", got, m.ID)
+			}
+			if tt.headers != nil && tt.headers.Get("k") != m.Headers.Get("k") {
+				t.Errorf("headers = %v, want %v", m.Headers, tt.headers)
+			}
+			m.Headers.Set("k", "changed")
+			if tt.headers != nil && tt.headers.Get("k") != "v" {
+				t.Error("the message shares the headers it was given")
+			}
+		})
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	var seen []string
+	fn := func(ctx context.Context, m pipeline.Message[int]) (pipeline.Message[int], error) {
+		seen = append(seen, pipeline.CorrelationID(ctx))
+		return m, errBad
+	}
+	m := pipeline.NewMessageFrom(1, pipeline.Headers{pipeline.CorrelationHeader: "abc"})
+	_, errs := pipelinetest.RunStageCtx(t, fn, []pipeline.Message[int]{m},
+		pipeline.WithName("store"), pipeline.WithLogger(logger), pipeline.WithConcurrency(1),
+		pipeline.WithRetry(2, nil))
+
+	if len(seen) != 2 || seen[0] != "abc" || seen[1] != "abc" {
+		t.Errorf("fn saw IDs %q, want abc twice", seen)
+	}
+
+	var stageErr *pipeline.StageError
+	if len(errs) != 1 || !errors.As(errs[0], &stageErr) {
+		t.Fatalf("errors = %v, want one StageError", errs)
+	}
+	if stageErr.ID != "abc" {
+		t.Errorf("StageError.ID = %q, want abc", stageErr.ID)
+	}
+	if want := "store: bad (after 2 attempts) (id abc)"; stageErr.Error() != want {
+		t.Errorf("Error() = %q, want %q", stageErr.Error(), want)
+	}
+
+	lines := out.lines()
+	if len(lines) != 1 || !strings.Contains(lines[0], "msg=retrying") || !strings.Contains(lines[0], "id=abc") {
+		t.Errorf("logged %q, want the retry with id=abc", lines)
+	}
+}
+
+func TestPipelineCorrelationID(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	m := pipeline.NewMessageFrom(1, pipeline.Headers{pipeline.CorrelationHeader: "abc"})
+	seen := make(chan string, 1)
+	p := pipeline.New(func(ctx context.Context) (<-chan pipeline.Message[int], error) {
+		return pipeline.FromSlice(ctx, []pipeline.Message[int]{m}), nil
+	}).ThenCtx(func(ctx context.Context, m pipeline.Message[int]) (pipeline.Message[int], error) {
+		seen <- pipeline.CorrelationID(ctx)
+		return m, errBad
+	}, pipeline.WithName("store"))
+
+	err := p.Run(context.Background())
+	var stageErr *pipeline.StageError
+	if !errors.As(err, &stageErr) || stageErr.ID != "abc" {
+		t.Errorf("Run() = %v, want a StageError for abc", err)
+	}
+	if id := <-seen; id != "abc" {
+		t.Errorf("fn saw ID %q, want abc", id)
+	}
+}
@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"regexp"
+	rpprof "runtime/pprof"
+	"strconv"
+)
+
+// StageGoroutines counts the goroutines of every step running in the
+// process by the "stage" profiler label they carry, see WithName. Those of
+// nested steps are counted under their full name, e.g. "enrich/lookup".
+// Goroutines outside any step aren't counted.
+func StageGoroutines() map[string]int {
+	var buf bytes.Buffer
+	// debug=1 groups goroutines with the same stack and labels, giving the
+	// number of them and their labels as text
+	if err := rpprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil
+	}
+
+	return countStageGoroutines(&buf)
+}
+
+var (
+	goroutineGroup = regexp.MustCompile(`^(\d+) @`)
+	stageLabel     = regexp.MustCompile(`"stage":("(?:[^"\\]|\\.)*")`)
+)
+
+// countStageGoroutines reads a goroutine profile written with debug=1.
+func countStageGoroutines(profile *bytes.Buffer) map[string]int {
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(profile)
+	scanner.Buffer(nil, 1<<20)
+
+	n := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := goroutineGroup.FindStringSubmatch(line); m != nil {
+			n, _ = strconv.Atoi(m[1])
+			continue
+		}
+		if m := stageLabel.FindStringSubmatch(line); m != nil && n > 0 {
+			if name, err := strconv.Unquote(m[1]); err == nil {
+				counts[name] += n
+			}
+			n = 0
+		}
+	}
+
+	return counts
+}
+
+// Edge is a channel between two parts of a pipeline, see
+// Pipeline.BlockedEdges.
+type Edge struct {
+	// From is the step, or "source", sending on the channel and To the step
+	// reading from it.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Queued is how many values were waiting on the channel the last time
+	// To read one, InFlight how many To is working on out of the Limit it
+	// may work on at a time.
+	Queued   int64 `json:"queued"`
+	InFlight int64 `json:"in_flight"`
+	Limit    int   `json:"limit"`
+	// Blocked is set if values are waiting on the channel while To is
+	// working on all it may, that is if From is held up by To, the
+	// bottleneck of the pipeline.
+	Blocked bool `json:"blocked"`
+}
+
+// BlockedEdges reports every channel between the source and the steps of a
+// running pipeline, in order, flagging those where the step reading from it
+// holds up the pipeline. It reports no queues or work while the pipeline
+// isn't running.
+func (p *Pipeline[T]) BlockedEdges() []Edge {
+	status := p.Status()
+
+	edges := make([]Edge, len(status.Stages))
+	from := "source"
+	for i, st := range status.Stages {
+		cfg := newStepConfig(p.stages[i].opts)
+		limit := cfg.concurrency
+		if cfg.scaleMax > 0 {
+			limit = cfg.scaleMax
+		}
+
+		edges[i] = Edge{
+			From:     from,
+			To:       st.Name,
+			Queued:   st.QueueDepth,
+			InFlight: st.InFlight,
+			Limit:    limit,
+			Blocked:  st.QueueDepth > 0 && st.InFlight >= int64(limit),
+		}
+		from = st.Name
+	}
+
+	return edges
+}
+
+// DebugHandler returns an http.Handler bundling everything needed to debug
+// the pipeline in production, to be mounted as it is, without stripping the
+// prefix, as the pprof handlers expect their paths:
+//
+//	http.Handle("/debug/", p.DebugHandler())
+//
+// It serves:
+//
+//	/debug/pprof/                 the net/http/pprof handlers
+//	GET /debug/pipeline/          the AdminHandler, pausing and draining
+//	                              included
+//	GET /debug/pipeline/goroutines  StageGoroutines as JSON
+//	GET /debug/pipeline/edges     BlockedEdges as JSON
+//
+// Like the AdminHandler it has no access control of its own, so don't
+// expose it to the outside.
+func (p *Pipeline[T]) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("GET /debug/pipeline/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, StageGoroutines())
+	})
+	mux.HandleFunc("GET /debug/pipeline/edges", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, p.BlockedEdges())
+	})
+	mux.Handle("/debug/pipeline/", http.StripPrefix("/debug/pipeline", p.AdminHandler()))
+
+	return mux
+}
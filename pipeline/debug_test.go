@@ -0,0 +1,85 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestDebugHandler(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	src := pipelinetest.NewSource[int]()
+	sink := pipelinetest.NewSink[int]()
+	slow := pipelinetest.NewScript[int, int](func(_ context.Context, v int) (int, error) { return v, nil }).Hang().Hang()
+	p := pipeline.New(src.Open).
+		Then(func(v int) (int, error) { return v, nil }, pipeline.WithName("fast"), pipeline.WithBuffer(10)).
+		ThenCtx(slow.Fn, pipeline.WithName("slow"), pipeline.WithConcurrency(1)).
+		Sink(sink.Handle)
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(context.Background()) }()
+
+	// one value hangs in slow while the next ones queue in front of it
+	src.Send(t, 1)
+	slow.Next(t)
+	src.Send(t, 2, 3, 4)
+	waitFor(t, "fast to pass on every value", func() bool { return p.Status().Stages[0].Processed == 4 })
+	slow.Release()
+	slow.Next(t)
+	waitFor(t, "the edge into slow to block", func() bool { return p.BlockedEdges()[1].Blocked })
+
+	edges := p.BlockedEdges()
+	if e := edges[0]; e.From != "source" || e.To != "fast" || e.Blocked {
+		t.Errorf("first edge = %+v, want an unblocked one from the source to fast", e)
+	}
+	if e := edges[1]; e.From != "fast" || e.To != "slow" || e.InFlight != 1 || e.Limit != 1 || e.Queued < 1 {
+		t.Errorf("second edge = %+v, want fast to slow with a value queued", e)
+	}
+	if n := pipeline.StageGoroutines()["slow"]; n < 1 {
+		t.Errorf("StageGoroutines()[slow] = %d, want some", n)
+	}
+
+	server := httptest.NewServer(p.DebugHandler())
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		decoded any
+	}{
+		{path: "/debug/pprof/"},
+		{path: "/debug/pprof/goroutine?debug=1"},
+		{path: "/debug/pipeline/", decoded: &pipeline.Status{}},
+		{path: "/debug/pipeline/goroutines", decoded: &map[string]int{}},
+		{path: "/debug/pipeline/edges", decoded: &[]pipeline.Edge{}},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: %s", tt.path, resp.Status)
+		}
+		if tt.decoded != nil {
+			if err := json.NewDecoder(resp.Body).Decode(tt.decoded); err != nil {
+				t.Errorf("GET %s: %v", tt.path, err)
+			}
+		}
+		resp.Body.Close()
+	}
+
+	slow.Release()
+	src.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.Values(); len(got) != 4 {
+		t.Errorf("sink got %v, want 4 values", got)
+	}
+}
@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"container/list"
+	"context"
+	"time"
+)
+
+// Dedupe drops values whose keyFn returns a key already seen within the last
+// window, so downstream processing sees each key at most once per window. A
+// key's window starts at the first value that passed; duplicates don't
+// extend it.
+//
+// Only keys seen within the last window are remembered, oldest first, so
+// memory is bounded by the number of distinct keys arriving per window. The
+// output is closed once in is closed or ctx is done.
+func Dedupe[T any, K comparable](ctx context.Context, in <-chan T, keyFn func(T) K, window time.Duration) <-chan T {
+	type seen struct {
+		key K
+		at  time.Time
+	}
+
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		clock := ClockFrom(ctx)
+		keys := make(map[K]*list.Element)
+		// oldest first, always in the order keys were admitted
+		order := list.New()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				now := clock.Now()
+				for front := order.Front(); front != nil; front = order.Front() {
+					s := front.Value.(seen)
+					if now.Sub(s.at) < window {
+						break
+					}
+					order.Remove(front)
+					delete(keys, s.key)
+				}
+
+				k := keyFn(v)
+				if _, dup := keys[k]; dup {
+					continue
+				}
+				keys[k] = order.PushBack(seen{key: k, at: now})
+
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- v:
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
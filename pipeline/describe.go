@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DiagramFormat is the text format Describe renders a topology in.
+type DiagramFormat int
+
+const (
+	// Mermaid renders a Mermaid flowchart, which GitHub and many wikis
+	// display inline.
+	Mermaid DiagramFormat = iota
+	// DOT renders a Graphviz digraph.
+	DOT
+)
+
+func (f DiagramFormat) String() string {
+	switch f {
+	case Mermaid:
+		return "Mermaid"
+	case DOT:
+		return "DOT"
+	default:
+		return "DiagramFormat(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+// Describe renders the pipeline's stages, with their names, concurrency and
+// buffer sizes, as a diagram in format, e.g. to keep the documentation of a
+// pipeline in step with its code.
+func (p *Pipeline[T]) Describe(format DiagramFormat) string {
+	var d diagram
+	prev := d.node("source")
+	for i, s := range p.stages {
+		cfg := newStepConfig(s.opts)
+		name := cfg.name
+		if name == "" {
+			name = "step " + strconv.Itoa(i+1)
+		}
+		n := d.node(name, stepDetails(cfg)...)
+		d.edge(prev, n)
+		prev = n
+	}
+	if p.sink != nil {
+		d.edge(prev, d.node("sink"))
+	}
+
+	return d.render(format)
+}
+
+// Describe renders the graph's nodes and edges as a diagram in format, see
+// Pipeline.Describe.
+func (g *Graph) Describe(format DiagramFormat) string {
+	var d diagram
+	ids := make(map[string]int, len(g.names))
+	for _, name := range g.names {
+		n := g.nodes[name]
+		details := []string{n.kind.String()}
+		if n.kind == stageNode {
+			details = append(details, stepDetails(newStepConfig(n.opts))...)
+		}
+		ids[name] = d.node(name, details...)
+	}
+	for _, name := range g.names {
+		for _, child := range g.nodes[name].children {
+			d.edge(ids[name], ids[child])
+		}
+	}
+
+	return d.render(format)
+}
+
+// stepDetails lists what a diagram shows about a step besides its name.
+func stepDetails(cfg stepConfig) []string {
+	var details []string
+	if cfg.scaleMax > 0 {
+		details = append(details, fmt.Sprintf("workers: %d-%d", cfg.scaleMin, cfg.scaleMax))
+	} else {
+		details = append(details, fmt.Sprintf("concurrency: %d", cfg.concurrency))
+	}
+	if cfg.buffer > 0 {
+		details = append(details, fmt.Sprintf("buffer: %d (%s)", cfg.buffer, cfg.backpressure))
+	}
+	if cfg.ordered {
+		details = append(details, "ordered")
+	}
+	if cfg.maxAttempts > 1 {
+		details = append(details, fmt.Sprintf("attempts: %d", cfg.maxAttempts))
+	}
+
+	return details
+}
+
+type diagram struct {
+	labels [][]string
+	edges  [][2]int
+}
+
+// node adds a node and returns its id.
+func (d *diagram) node(name string, details ...string) int {
+	d.labels = append(d.labels, append([]string{name}, details...))
+	return len(d.labels) - 1
+}
+
+func (d *diagram) edge(from, to int) {
+	d.edges = append(d.edges, [2]int{from, to})
+}
+
+func (d *diagram) render(format DiagramFormat) string {
+	var b strings.Builder
+
+	switch format {
+	case DOT:
+		b.WriteString("digraph pipeline {\n\trankdir=LR;\n\tnode [shape=box];\n")
+		escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		for id, lines := range d.labels {
+			label := escape.Replace(strings.Join(lines, "\n"))
+			fmt.Fprintf(&b, "\tn%d [label=\"%s\"];\n", id, strings.ReplaceAll(label, "\n", `\n`))
+		}
+		for _, e := range d.edges {
+			fmt.Fprintf(&b, "\tn%d -> n%d;\n", e[0], e[1])
+		}
+		b.WriteString("}\n")
+	default:
+		b.WriteString("flowchart LR\n")
+		for id, lines := range d.labels {
+			label := strings.ReplaceAll(strings.Join(lines, "<br/>"), `"`, "#quot;")
+			fmt.Fprintf(&b, "    n%d[\"%s\"]\n", id, label)
+		}
+		for _, e := range d.edges {
+			fmt.Fprintf(&b, "    n%d --> n%d\n", e[0], e[1])
+		}
+	}
+
+	return b.String()
+}
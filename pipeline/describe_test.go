@@ -0,0 +1,75 @@
+package pipeline_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestDescribe(t *testing.T) {
+	p := pipeline.New(pipeline.SliceSource([]int{1})).
+		Then(func(v int) (int, error) { return v, nil },
+			pipeline.WithName(`"parse"`),
+			pipeline.WithConcurrency(2),
+			pipeline.WithBuffer(10),
+			pipeline.WithOrderedOutput(),
+		).
+		Then(func(v int) (int, error) { return v, nil }).
+		Sink(func(int) error { return nil })
+
+	tests := []struct {
+		format pipeline.DiagramFormat
+		want   string
+	}{
+		{
+			format: pipeline.Mermaid,
+			want: `flowchart LR
+    n0["source"]
+    n1["#quot;parse#quot;<br/>concurrency: 2<br/>buffer: 10 (block)<br/>ordered"]
+    n2["step 2<br/>concurrency: 1"]
+    n3["sink"]
+    n0 --> n1
+    n1 --> n2
+    n2 --> n3
+`,
+		},
+		{
+			format: pipeline.DOT,
+			want: `digraph pipeline {
+	rankdir=LR;
+	node [shape=box];
+	n0 [label="source"];
+	n1 [label="\"parse\"\nconcurrency: 2\nbuffer: 10 (block)\nordered"];
+	n2 [label="step 2\nconcurrency: 1"];
+	n3 [label="sink"];
+	n0 -> n1;
+	n1 -> n2;
+	n2 -> n3;
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			if got := p.Describe(tt.format); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphDescribe(t *testing.T) {
+	got := diamond(nil, func(int) error { return nil }).Describe(pipeline.Mermaid)
+
+	for _, want := range []string{
+		`n0["numbers<br/>source"]`,
+		`n1["double<br/>stage<br/>concurrency: 1"]`,
+		"n0 --> n1", "n0 --> n2", "n1 --> n3", "n2 --> n3",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got\n%s\nwant it to contain %s", got, want)
+		}
+	}
+}
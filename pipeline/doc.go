@@ -0,0 +1,22 @@
+// Package pipeline provides generic building blocks for concurrent and
+// parallel pipelines built on channels.
+//
+// A pipeline starts with a source such as Producer, passes values through one
+// or more Step stages that each run a transform in parallel, and ends in a
+// sink that consumes the results. Every stage takes a context so the whole
+// pipeline can be cancelled at once, and every Step returns its errors on a
+// separate channel; Merge combines those into one stream for the sink.
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//
+//	source, err := pipeline.Producer(ctx, []string{"FOO", "BAR"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	lowered, lowerErrs := pipeline.Step(ctx, source, toLower)
+//	titled, titleErrs := pipeline.Step(ctx, lowered, toTitle)
+//
+//	pipeline.Sink(ctx, cancel, titled, pipeline.Merge(ctx, lowerErrs, titleErrs))
+package pipeline
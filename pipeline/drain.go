@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrDrained is the cause of the cancellation of a pipeline's source when
+// the pipeline is drained, see context.Cause.
+var ErrDrained = errors.New("pipeline: drained")
+
+// ErrDrainTimeout is wrapped by the error Run returns when a Drain gave up
+// waiting for the pipeline to flush and cancelled it.
+var ErrDrainTimeout = errors.New("pipeline: drain timed out")
+
+// errDrainTimeout also wraps context.Canceled, which Run returned for a
+// cancelled drain before it had a cause.
+var errDrainTimeout = fmt.Errorf("%w: %w", ErrDrainTimeout, context.Canceled)
+
+// run is the state of a pipeline while Run is in progress.
+type run struct {
+	cancel context.CancelFunc
+
+	// closed to stop reading from the source
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// guards stopSource, which cancels the context of the source with
+	// ErrDrained once intake stops
+	mu         sync.Mutex
+	stopSource context.CancelCauseFunc
+
+	// closed once Run has returned
+	done chan struct{}
+
+	// counts what the run has done, for Status, set once the source has
+	// started and every step has been given its counts
+	counter *progressCounter
+}
+
+func (r *run) stopIntake() {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		// the cause is set before Drain returns, so however the source sees
+		// its context done, it's for ErrDrained
+		if r.stopSource != nil {
+			r.stopSource(ErrDrained)
+		}
+		close(r.stop)
+	})
+}
+
+// setStopSource hands the run the function cancelling its source's context,
+// calling it straight away if intake has already stopped.
+func (r *run) setStopSource(stop context.CancelCauseFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stopSource = stop
+	select {
+	case <-r.stop:
+		stop(ErrDrained)
+	default:
+	}
+}
+
+// Drain gracefully stops a running pipeline: no more values are read from the
+// source, whose context is done with ErrDrained as its cause so it can wind
+// down, but the ones already inside the pipeline are processed and flushed
+// to the sink before Run returns nil. If ctx is done before that, the
+// pipeline is cancelled, abandoning whatever is still in flight, Run returns
+// an error wrapping ErrDrainTimeout and Drain returns the context's error.
+//
+// Drain returns nil straight away if the pipeline isn't running.
+func (p *Pipeline[T]) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	r := p.run
+	p.mu.Unlock()
+
+	if r == nil {
+		return nil
+	}
+
+	r.stopIntake()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		return ctx.Err()
+	}
+}
+
+// Shutdown is Drain with a grace period instead of a context.
+func (p *Pipeline[T]) Shutdown(grace time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	return p.Drain(ctx)
+}
+
+// gate forwards values from in until stop is closed, then closes its output
+// so the stages downstream can finish what they have and shut down. Nothing
+// is read from in while the paused valve is shut.
+func gate[T any](ctx context.Context, in <-chan T, stop <-chan struct{}, paused *valve) <-chan T {
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-paused.open():
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					// the value was read but not admitted, drop it like the
+					// rest of the unread source
+					return
+				case outChannel <- v:
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
@@ -0,0 +1,69 @@
+package pipeline
+
+import "context"
+
+// Indexed is a value together with its position in the stream it came from,
+// counting from 0.
+type Indexed[T any] struct {
+	Index int64
+	Value T
+}
+
+// Enumerate numbers the values from in in arrival order, starting at 0, so
+// their position survives stages that reorder or drop values, e.g. to
+// report the line of a file that failed to parse. The output is closed once
+// in is closed or ctx is done.
+func Enumerate[T any](ctx context.Context, in <-chan T) <-chan Indexed[T] {
+	outChannel := make(chan Indexed[T])
+
+	go func() {
+		defer close(outChannel)
+
+		var index int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- Indexed[T]{Index: index, Value: v}:
+				}
+				index++
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// MapIndexed is a Step whose fn is also handed the position of each value
+// in inputChannel, counting from 0, for formats that number their records:
+//
+//	rows, errs := pipeline.MapIndexed(ctx, lines, func(i int64, line string) (Row, error) {
+//		row, err := parseRow(line)
+//		if err != nil {
+//			return Row{}, fmt.Errorf("line %d: %w", i+1, err)
+//		}
+//		return row, nil
+//	})
+//
+// The Input of a failed value's StageError is its Indexed value, so the
+// position is at hand when reporting it even if fn doesn't mention it.
+func MapIndexed[In any, Out any](
+	ctx context.Context,
+	inputChannel <-chan In,
+	fn func(index int64, in In) (Out, error),
+	opts ...StepOption,
+) (<-chan Out, <-chan error) {
+	call := func(_ context.Context, v Indexed[In]) (Out, error) {
+		return fn(v.Index, v.Value)
+	}
+
+	return runStep(ctx, Enumerate(ctx, inputChannel), call, newStepConfig(opts))
+}
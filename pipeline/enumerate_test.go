@@ -0,0 +1,59 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestEnumerate(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.Enumerate(context.Background(), waiting("a", "b", "c")))
+	want := []pipeline.Indexed[string]{{Index: 0, Value: "a"}, {Index: 1, Value: "b"}, {Index: 2, Value: "c"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMapIndexed(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	out, errs := pipeline.MapIndexed(ctx, pipeline.FromSlice(ctx, []string{"a", "b", "", "d"}),
+		func(i int64, line string) (string, error) {
+			if line == "" {
+				return "", errBad
+			}
+			return fmt.Sprintf("%d:%s", i+1, line), nil
+		},
+		pipeline.WithConcurrency(3),
+		pipeline.WithOrderedOutput(),
+	)
+
+	failures := make(chan []error)
+	go func() {
+		var got []error
+		for err := range errs {
+			got = append(got, err)
+		}
+		failures <- got
+	}()
+
+	if got, want := pipelinetest.Collect(t, out), []string{"1:a", "2:b", "4:d"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// the position of the failed value is reported with it
+	var stageErr *pipeline.StageError
+	got := <-failures
+	if len(got) != 1 || !errors.As(got[0], &stageErr) || !errors.Is(got[0], errBad) ||
+		stageErr.Input != (pipeline.Indexed[string]{Index: 2, Value: ""}) {
+		t.Errorf("got errors %v, want %v for the value at index 2", got, errBad)
+	}
+}
@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooManyFailures is wrapped by the error a MaxFailures or MaxFailureRate
+// policy stops the pipeline with.
+var ErrTooManyFailures = errors.New("pipeline: too many failures")
+
+// ErrorPolicy decides whether a failed value stops the pipeline. The zero
+// value is FailFast. Errors marked with Fatal, or classified as ErrorFatal,
+// stop it whatever the policy.
+type ErrorPolicy struct {
+	mode        errorMode
+	maxFailures int
+	maxRate     float64
+	minValues   int
+	// maxKept bounds the errors collectErrors keeps, if above 0
+	maxKept int
+}
+
+type errorMode int
+
+const (
+	failFast errorMode = iota
+	skipErrors
+	collectErrors
+	failureThreshold
+)
+
+// FailFast stops the pipeline on the first error and reports it.
+func FailFast() ErrorPolicy {
+	return ErrorPolicy{mode: failFast}
+}
+
+// SkipErrors drops failed values and keeps the stream flowing. Nothing is
+// reported at the end.
+func SkipErrors() ErrorPolicy {
+	return ErrorPolicy{mode: skipErrors}
+}
+
+// CollectErrors keeps the stream flowing and reports every failure once it
+// has finished, joined with errors.Join. Each failure is still reachable with
+// errors.As, e.g. as a *StageError, see CollectErrorsUpTo to bound how many
+// are kept.
+func CollectErrors() ErrorPolicy {
+	return ErrorPolicy{mode: collectErrors}
+}
+
+// CollectErrorsUpTo is CollectErrors keeping only the first n failures, so
+// a run where everything fails doesn't hold on to every value. The joined
+// error ends with one saying how many more failures were left out.
+func CollectErrorsUpTo(n int) ErrorPolicy {
+	return ErrorPolicy{mode: collectErrors, maxKept: max(n, 1)}
+}
+
+// MaxFailures keeps the stream flowing until more than n values have failed,
+// then stops it with an error wrapping ErrTooManyFailures and the last
+// failure.
+func MaxFailures(n int) ErrorPolicy {
+	return ErrorPolicy{mode: failureThreshold, maxFailures: max(n, 0), maxRate: 1}
+}
+
+// MaxFailureRate keeps the stream flowing until more than rate (between 0
+// and 1) of the values seen so far have failed, then stops it with an error
+// wrapping ErrTooManyFailures and the last failure. The rate is only checked
+// once minValues values have been seen, so a single early failure doesn't
+// count as 100%.
+func MaxFailureRate(rate float64, minValues int) ErrorPolicy {
+	return ErrorPolicy{mode: failureThreshold, maxFailures: -1, maxRate: rate, minValues: minValues}
+}
+
+// errorTracker applies an ErrorPolicy to a single run.
+type errorTracker struct {
+	policy    ErrorPolicy
+	failures  int
+	successes int
+	errs      []error
+}
+
+func (t *errorTracker) succeeded() {
+	t.successes++
+}
+
+// failed records err and returns the error that should stop the run, or nil
+// to carry on. Errors marked with Fatal stop it whatever the policy.
+func (t *errorTracker) failed(err error) error {
+	t.failures++
+	if IsFatal(err) {
+		return err
+	}
+
+	switch t.policy.mode {
+	case skipErrors:
+		return nil
+	case collectErrors:
+		if t.policy.maxKept == 0 || len(t.errs) < t.policy.maxKept {
+			t.errs = append(t.errs, err)
+		}
+		return nil
+	case failureThreshold:
+		if t.policy.maxFailures >= 0 && t.failures > t.policy.maxFailures {
+			return fmt.Errorf("%w: %d values failed, last: %w", ErrTooManyFailures, t.failures, err)
+		}
+		seen := t.failures + t.successes
+		if seen >= t.policy.minValues && float64(t.failures)/float64(seen) > t.policy.maxRate {
+			return fmt.Errorf("%w: %d of %d values failed, last: %w", ErrTooManyFailures, t.failures, seen, err)
+		}
+		return nil
+	default:
+		return err
+	}
+}
+
+// result is what the run reports once the stream has finished without being
+// stopped.
+func (t *errorTracker) result() error {
+	if dropped := t.failures - len(t.errs); t.policy.mode == collectErrors && dropped > 0 {
+		return errors.Join(append(t.errs, fmt.Errorf("pipeline: %d more errors left out", dropped))...)
+	}
+	return errors.Join(t.errs...)
+}
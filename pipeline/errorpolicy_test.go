@@ -0,0 +1,96 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestFailureThresholds(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy pipeline.ErrorPolicy
+		// the values up to failing fail
+		failing int
+		// wantErr is what the error Run returns says, if it fails
+		wantErr string
+		// wantDelivered is how many values reach the sink, if Run succeeds
+		wantDelivered int
+	}{
+		{name: "under MaxFailures", policy: pipeline.MaxFailures(2), failing: 2, wantDelivered: 8},
+		{name: "over MaxFailures", policy: pipeline.MaxFailures(2), failing: 10, wantErr: "3 values failed"},
+		{name: "under MaxFailureRate", policy: pipeline.MaxFailureRate(0.5, 4), failing: 1, wantDelivered: 9},
+		{name: "over MaxFailureRate", policy: pipeline.MaxFailureRate(0.5, 4), failing: 10, wantErr: "4 of 4 values failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			sink := pipelinetest.NewSink[int]()
+			err := pipeline.New(pipeline.SliceSource(upTo(10))).
+				Then(func(v int) (int, error) {
+					if v <= tt.failing {
+						return v, errBad
+					}
+					return v, nil
+				}).
+				OnError(tt.policy).
+				Sink(sink.Handle).
+				Run(context.Background())
+
+			if tt.wantErr == "" {
+				if err != nil || len(sink.Values()) != tt.wantDelivered {
+					t.Errorf("Run = %v with %d values delivered, want nil and %d", err, len(sink.Values()), tt.wantDelivered)
+				}
+				return
+			}
+			var stageErr *pipeline.StageError
+			if !errors.Is(err, pipeline.ErrTooManyFailures) || !errors.As(err, &stageErr) || !errors.Is(err, errBad) ||
+				!strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run = %v, want %v saying %q, with the last failure", err, pipeline.ErrTooManyFailures, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCollectErrorsUpTo(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	// the sink's failures go through the policy as the steps' do
+	err := pipeline.New(pipeline.SliceSource(upTo(5))).
+		OnError(pipeline.CollectErrorsUpTo(2)).
+		Sink(func(int) error { return errBad }).
+		Run(context.Background())
+
+	var stageErr *pipeline.StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "sink" || !errors.Is(err, errBad) {
+		t.Errorf("Run = %v, want the sink's failures", err)
+	}
+	if kept := strings.Count(err.Error(), errBad.Error()); kept != 2 || !strings.Contains(err.Error(), "3 more errors left out") {
+		t.Errorf("Run = %v, want 2 failures kept and the 3 left out counted", err)
+	}
+}
+
+func TestSinkFailureThreshold(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	err := pipeline.New(pipeline.SliceSource(upTo(10))).
+		OnError(pipeline.MaxFailures(2)).
+		Sink(func(v int) error {
+			if v%2 == 0 {
+				return errBad
+			}
+			return nil
+		}).
+		Run(context.Background())
+
+	var stageErr *pipeline.StageError
+	if !errors.Is(err, pipeline.ErrTooManyFailures) || !errors.As(err, &stageErr) || stageErr.Stage != "sink" || stageErr.Input != 6 {
+		t.Errorf("Run = %v, want %v with the sink failing on 6", err, pipeline.ErrTooManyFailures)
+	}
+}
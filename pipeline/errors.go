@@ -0,0 +1,46 @@
+package pipeline
+
+import "fmt"
+
+// StageError is the error a Step emits when fn fails on a value. It records
+// which stage and which input failed so errors merged from several stages can
+// still be told apart. Use errors.As to get at it and errors.Is or Unwrap to
+// get at the error returned by fn.
+type StageError struct {
+	// Stage is the name given with WithName, or for an unnamed step of a
+	// Pipeline the "step N" it is known as there, empty for other unnamed
+	// steps.
+	Stage string
+	// Input is the value fn failed on, and ID its ID if it is a Message,
+	// see CorrelationID.
+	Input any
+	ID    string
+	// Attempts is how many times fn was called on Input, more than one
+	// when the step retries.
+	Attempts int
+	// Err is the error returned by the last attempt.
+	Err error
+
+	// raw is the value the step was handed, which within a Pipeline carries
+	// what the run needs to tell which of its values failed
+	raw any
+}
+
+func (e *StageError) Error() string {
+	msg := e.Err.Error()
+	if e.Attempts > 1 {
+		msg = fmt.Sprintf("%s (after %d attempts)", msg, e.Attempts)
+	}
+	if e.ID != "" {
+		msg = fmt.Sprintf("%s (id %s)", msg, e.ID)
+	}
+	if e.Stage != "" {
+		msg = e.Stage + ": " + msg
+	}
+
+	return msg
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IdempotencyStore remembers the idempotency keys of the values a sink has
+// committed, see ExactlyOnce. Implementations must be safe for concurrent
+// use.
+type IdempotencyStore interface {
+	// Committed reports whether key has been committed.
+	Committed(ctx context.Context, key string) (bool, error)
+	// Commit records key as committed.
+	Commit(ctx context.Context, key string) error
+}
+
+// ExactlyOnce wraps sink so values whose idempotency key, as told by keyFn,
+// has already been committed to store are skipped, and every value sink
+// handles has its key committed, so values processed again by a retry, a
+// redelivery or a restart from a checkpoint don't repeat sink's side
+// effects:
+//
+//	sink := pipeline.ExactlyOnce(ctx, chargeCustomer, func(o Order) string {
+//		return o.ID
+//	}, pipeline.NewFileIdempotencyStore("charged.keys"))
+//	err := pipeline.New(source).Then(transform).Sink(sink).Run(ctx)
+//
+// A key is committed right after sink succeeds, so a crash in between still
+// repeats that one value; a store committing in the same transaction as
+// sink's writes closes the gap. Values with the same key handed over at the
+// same time, e.g. by replicas sharing a store, can both get through. Errors
+// from the store are returned as the sink's.
+func ExactlyOnce[T any](ctx context.Context, sink func(T) error, keyFn func(T) string, store IdempotencyStore) func(T) error {
+	return func(v T) error {
+		key := keyFn(v)
+		done, err := store.Committed(ctx, key)
+		if err != nil {
+			return fmt.Errorf("pipeline: looking up idempotency key %q: %w", key, err)
+		}
+		if done {
+			return nil
+		}
+
+		if err := sink(v); err != nil {
+			return err
+		}
+		if err := store.Commit(ctx, key); err != nil {
+			return fmt.Errorf("pipeline: committing idempotency key %q: %w", key, err)
+		}
+		return nil
+	}
+}
+
+// MemoryIdempotencyStore keeps committed keys in memory, which covers the
+// retries and redeliveries of a single process. It keeps every key it is
+// given. The zero value is ready to use.
+type MemoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// Committed reports whether key has been committed.
+func (s *MemoryIdempotencyStore) Committed(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+// Commit records key.
+func (s *MemoryIdempotencyStore) Commit(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil {
+		s.keys = make(map[string]struct{})
+	}
+	s.keys[key] = struct{}{}
+	return nil
+}
+
+// FileIdempotencyStore keeps committed keys in a file, one per line, so
+// they survive the process restarting. The keys are loaded into memory when
+// the store is first used and every Commit is synced to disk before it
+// returns.
+type FileIdempotencyStore struct {
+	path string
+
+	mu   sync.Mutex
+	keys map[string]struct{}
+	file *os.File
+	torn bool
+}
+
+// NewFileIdempotencyStore returns an IdempotencyStore keeping its keys at
+// path. The file is created on the first Commit.
+func NewFileIdempotencyStore(path string) *FileIdempotencyStore {
+	return &FileIdempotencyStore{path: path}
+}
+
+// Committed reports whether key has been committed.
+func (s *FileIdempotencyStore) Committed(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+// Commit appends key to the file.
+func (s *FileIdempotencyStore) Commit(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.keys[key]; ok {
+		return nil
+	}
+
+	if s.file == nil {
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+	// quoted, so keys can hold any bytes, newlines included
+	line := strconv.Quote(key) + "\n"
+	if s.torn {
+		line = "\n" + line
+	}
+	if _, err := s.file.WriteString(line); err != nil {
+		// part of the line may have made it
+		s.torn = true
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		// the line may be lost, or only part of it
+		s.torn = true
+		return err
+	}
+	s.torn = false
+
+	s.keys[key] = struct{}{}
+	return nil
+}
+
+// Close closes the file.
+func (s *FileIdempotencyStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// load reads the keys from the file unless they have been already. It must
+// be called with mu held.
+func (s *FileIdempotencyStore) load() error {
+	if s.keys != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("pipeline: reading idempotency keys from %s: %w", s.path, err)
+	}
+
+	keys := make(map[string]struct{})
+	for _, line := range strings.Split(string(data), "\n") {
+		// a line torn by a crash mid-write was never committed
+		if key, err := strconv.Unquote(line); err == nil {
+			keys[key] = struct{}{}
+		}
+	}
+	// the next key goes on a line of its own, after any torn one
+	s.torn = len(data) > 0 && data[len(data)-1] != '\n'
+
+	s.keys = keys
+	return nil
+}
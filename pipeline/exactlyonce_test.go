@@ -0,0 +1,116 @@
+package pipeline_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestExactlyOnce(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(t *testing.T) pipeline.IdempotencyStore
+	}{
+		{
+			name: "memory",
+			store: func(*testing.T) pipeline.IdempotencyStore {
+				return &pipeline.MemoryIdempotencyStore{}
+			},
+		},
+		{
+			name: "file",
+			store: func(t *testing.T) pipeline.IdempotencyStore {
+				s := pipeline.NewFileIdempotencyStore(filepath.Join(t.TempDir(), "keys"))
+				t.Cleanup(func() { s.Close() })
+				return s
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var mu sync.Mutex
+			var handled []string
+			sink := pipeline.ExactlyOnce(ctx, func(s string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				handled = append(handled, s)
+				return nil
+			}, func(s string) string { return s }, tt.store(t))
+
+			// redeliveries, handed over concurrently
+			var wg sync.WaitGroup
+			for _, v := range []string{"a", "b", "a", "c", "b", "a"} {
+				if err := sink(v); err != nil {
+					t.Fatal(err)
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := sink(v); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			slices.Sort(handled)
+			if want := []string{"a", "b", "c"}; !slices.Equal(handled, want) {
+				t.Errorf("sink handled %v, want %v", handled, want)
+			}
+		})
+	}
+}
+
+func TestFileIdempotencyStoreRestart(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		want     []string
+		notWant  []string
+	}{
+		{name: "new file", want: []string{"x"}},
+		{name: "committed keys", existing: "\"a\"\n\"b\\nc\"\n", want: []string{"a", "b\nc", "x"}},
+		{name: "torn last line", existing: "\"a\"\n\"b", want: []string{"a", "x"}, notWant: []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "keys")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := pipeline.NewFileIdempotencyStore(path)
+			if err := s.Commit(ctx, "x"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// as after a restart
+			s = pipeline.NewFileIdempotencyStore(path)
+			defer s.Close()
+			for _, key := range tt.want {
+				if ok, err := s.Committed(ctx, key); err != nil || !ok {
+					t.Errorf("Committed(%q) = %v, %v, want true", key, ok, err)
+				}
+			}
+			for _, key := range tt.notWant {
+				if ok, err := s.Committed(ctx, key); err != nil || ok {
+					t.Errorf("Committed(%q) = %v, %v, want false", key, ok, err)
+				}
+			}
+		})
+	}
+}
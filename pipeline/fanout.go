@@ -0,0 +1,217 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"reflect"
+)
+
+// FanOutMode selects how FanOut spreads values over its outputs.
+type FanOutMode int
+
+const (
+	// Broadcast sends every value to every output.
+	Broadcast FanOutMode = iota
+	// RoundRobin sends each value to a single output, taking turns.
+	RoundRobin
+)
+
+// FanOut splits in into n outputs so parallel branches of a pipeline can
+// work on the same stream and later be recombined with Merge.
+//
+// In Broadcast mode a value is only read from in once every output has taken
+// the previous one, so all branches must keep reading or the others stall.
+// In RoundRobin mode a slow branch only holds up the values that are its
+// turn. All outputs are closed once in is closed or ctx is done.
+func FanOut[T any](ctx context.Context, in <-chan T, n int, mode FanOutMode) []<-chan T {
+	if n < 1 {
+		n = 1
+	}
+
+	outs, result := makeOutputs[T](n)
+	send := sender[T](ctx)
+
+	go func() {
+		defer closeAll(outs)
+
+		next := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				if mode == RoundRobin {
+					if !send(outs[next], v) {
+						return
+					}
+					next = (next + 1) % n
+					continue
+				}
+
+				for _, out := range outs {
+					if !send(out, v) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return result
+}
+
+// PartitionBy splits in into n outputs by key: every value whose keyFn
+// returns the same key goes to the same output, so a worker reading one
+// output sees all of the values for its keys and can keep per-key state.
+// A slow output holds up every value destined for it. All outputs are closed
+// once in is closed or ctx is done.
+func PartitionBy[T any, K comparable](ctx context.Context, in <-chan T, keyFn func(T) K, n int) []<-chan T {
+	if n < 1 {
+		n = 1
+	}
+
+	outs, result := makeOutputs[T](n)
+	send := sender[T](ctx)
+
+	go func() {
+		defer closeAll(outs)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				if !send(outs[partition(keyFn(v), n)], v) {
+					return
+				}
+			}
+		}
+	}()
+
+	return result
+}
+
+// partition hashes key onto one of n partitions. Keys that are equal hash
+// the same, 0.0 and -0.0 included, which printing them wouldn't.
+func partition[K comparable](key K, n int) int {
+	h := fnv32a(offset32)
+	switch k := any(key).(type) {
+	case string:
+		h.writeString(k)
+	case int:
+		h.writeUint(uint64(k))
+	default:
+		h.writeValue(reflect.ValueOf(k))
+	}
+
+	return int(uint32(h) % uint32(n))
+}
+
+// fnv32a is an FNV-1a hash, which unlike hash/fnv's doesn't allocate.
+type fnv32a uint32
+
+const (
+	offset32 = 2166136261
+	prime32  = 16777619
+)
+
+func (h *fnv32a) writeString(s string) {
+	for i := 0; i < len(s); i++ {
+		*h = (*h ^ fnv32a(s[i])) * prime32
+	}
+}
+
+func (h *fnv32a) writeUint(v uint64) {
+	for range 8 {
+		*h = (*h ^ fnv32a(byte(v))) * prime32
+		v >>= 8
+	}
+}
+
+func (h *fnv32a) writeFloat(f float64) {
+	if f == 0 {
+		// -0.0 == 0.0, so they must hash the same
+		f = 0
+	}
+	h.writeUint(math.Float64bits(f))
+}
+
+// writeValue hashes a comparable value by what == compares.
+func (h *fnv32a) writeValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			h.writeUint(1)
+		} else {
+			h.writeUint(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		h.writeUint(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		h.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		h.writeFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		h.writeFloat(real(c))
+		h.writeFloat(imag(c))
+	case reflect.String:
+		h.writeString(v.String())
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		h.writeUint(uint64(v.Pointer()))
+	case reflect.Array:
+		for i := range v.Len() {
+			h.writeValue(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			h.writeValue(v.Field(i))
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			h.writeUint(0)
+			return
+		}
+		// values of different types are never equal, hashing the type
+		// only spreads them further
+		h.writeString(v.Elem().Type().String())
+		h.writeValue(v.Elem())
+	}
+}
+
+func makeOutputs[T any](n int) ([]chan T, []<-chan T) {
+	outs := make([]chan T, n)
+	result := make([]<-chan T, n)
+	for i := range outs {
+		outs[i] = make(chan T)
+		result[i] = outs[i]
+	}
+
+	return outs, result
+}
+
+func closeAll[T any](outs []chan T) {
+	for _, out := range outs {
+		close(out)
+	}
+}
+
+// sender returns a function sending v on out that gives up once ctx is done,
+// reporting whether the value was sent.
+func sender[T any](ctx context.Context) func(out chan<- T, v T) bool {
+	return func(out chan<- T, v T) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case out <- v:
+			return true
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package pipeline_test
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// partitioned runs PartitionBy over values by keyFn and returns the output
+// every value ended up on.
+func partitioned[T comparable, K comparable](t *testing.T, values []T, keyFn func(T) K) map[T][]int {
+	t.Helper()
+
+	outs := pipeline.PartitionBy(context.Background(), waiting(values...), keyFn, 8)
+	var mu sync.Mutex
+	got := make(map[T][]int)
+	var wg sync.WaitGroup
+	for i, out := range outs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range out {
+				mu.Lock()
+				got[v] = append(got[v], i)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return got
+}
+
+func TestPartitionBy(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	values := []string{"a", "b", "a", "c", "b", "a"}
+	got := partitioned(t, values, func(s string) string { return s })
+	for v, outs := range got {
+		for _, out := range outs[1:] {
+			if out != outs[0] {
+				t.Errorf("%q went to outputs %v, want one", v, outs)
+				break
+			}
+		}
+	}
+	if n := len(got["a"]) + len(got["b"]) + len(got["c"]); n != len(values) {
+		t.Errorf("got %d values, want %d", n, len(values))
+	}
+}
+
+// TestPartitionByEqualKeys checks keys that are equal but print differently
+// go to the same output.
+func TestPartitionByEqualKeys(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	type point struct{ x, y float64 }
+	negZero := math.Copysign(0, -1)
+	tests := []struct {
+		name string
+		a, b point
+	}{
+		{name: "signed zero", a: point{x: 0}, b: point{x: negZero}},
+		{name: "signed zeros", a: point{x: 0, y: 0}, b: point{x: negZero, y: negZero}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the values tell the inputs apart, the key is what they share
+			type keyed struct {
+				id  int
+				key point
+			}
+			got := partitioned(t, []keyed{{1, tt.a}, {2, tt.b}}, func(k keyed) point { return k.key })
+			if a, b := got[keyed{1, tt.a}], got[keyed{2, tt.b}]; len(a) != 1 || len(b) != 1 || a[0] != b[0] {
+				t.Errorf("keys %v and %v went to outputs %v and %v, want the same", tt.a, tt.b, a, b)
+			}
+		})
+	}
+}
+
+// fannedOut reads every output concurrently, as FanOut needs, and returns
+// what each one received.
+func fannedOut[T any](outs []<-chan T) [][]T {
+	got := make([][]T, len(outs))
+	var wg sync.WaitGroup
+	for i, out := range outs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range out {
+				got[i] = append(got[i], v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return got
+}
+
+func TestFanOut(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	tests := []struct {
+		name string
+		mode pipeline.FanOutMode
+		n    int
+		want [][]int
+	}{
+		{name: "broadcast", mode: pipeline.Broadcast, n: 3, want: [][]int{{1, 2, 3, 4, 5}, {1, 2, 3, 4, 5}, {1, 2, 3, 4, 5}}},
+		{name: "round robin", mode: pipeline.RoundRobin, n: 2, want: [][]int{{1, 3, 5}, {2, 4}}},
+		{name: "low n counts as 1", mode: pipeline.RoundRobin, n: 0, want: [][]int{{1, 2, 3, 4, 5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fannedOut(pipeline.FanOut(context.Background(), waiting(1, 2, 3, 4, 5), tt.n, tt.mode))
+			if !slices.EqualFunc(got, tt.want, slices.Equal[[]int]) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFanOutStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int, 1)
+	defer close(in)
+	in <- 1
+
+	// nobody reads the second output, so the broadcast is stuck sending to it
+	outs := pipeline.FanOut(ctx, in, 2, pipeline.Broadcast)
+	if got := pipelinetest.Receive(t, outs[0]); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	cancel()
+	// the second output may still take the 1, but nothing comes after it
+	if got := fannedOut(outs); len(got[0]) != 0 {
+		t.Errorf("got %v after cancelling, want nothing more", got[0])
+	}
+}
@@ -0,0 +1,36 @@
+package pipeline
+
+import "context"
+
+// Filter passes on only the values from in for which pred returns true, in
+// the order they arrive. The output is closed once in is closed or ctx is
+// done.
+func Filter[T any](ctx context.Context, in <-chan T, pred func(T) bool) <-chan T {
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				if !pred(v) {
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- v:
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
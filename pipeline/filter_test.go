@@ -0,0 +1,35 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestFilter(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	even := func(v int) bool { return v%2 == 0 }
+	got := pipelinetest.Collect(t, pipeline.Filter(context.Background(), waiting(1, 2, 3, 4, 6, 7), even))
+	if want := []int{2, 4, 6}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFilterStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	defer close(in)
+
+	out := pipeline.Filter(ctx, in, func(int) bool { return true })
+	assertNothing(t, out)
+	cancel()
+	if got := pipelinetest.Collect(t, out); len(got) != 0 {
+		t.Errorf("got %v after cancelling, want nothing", got)
+	}
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand/v2"
+	"sync"
+)
+
+// FlagProvider decides at runtime whether a feature flag is on, e.g. backed
+// by a feature flag service or by Flags, so an experimental step can be
+// rolled out gradually and switched off at once without a deploy, see
+// WithFlag and Toggle. It is asked for every value and must be safe for
+// concurrent use.
+type FlagProvider interface {
+	// Enabled reports whether flag is on for the value with key, the
+	// CorrelationID of the value if it is a Message, "" otherwise, so the
+	// provider can keep a value, or a customer, on the same side of a
+	// split.
+	Enabled(ctx context.Context, flag, key string) bool
+}
+
+// FlagFunc adapts a func to a FlagProvider.
+type FlagFunc func(ctx context.Context, flag, key string) bool
+
+// Enabled calls f.
+func (f FlagFunc) Enabled(ctx context.Context, flag, key string) bool {
+	return f(ctx, flag, key)
+}
+
+// WithFlag only runs the step's fn on the values flag is on for, passing
+// the others on unchanged, so it only suits steps emitting the type they
+// read; on any other the values the flag is off for fail with an error
+// wrapping ErrUnexpectedType. The flag is asked on every attempt at a
+// value, before the step's own middleware.
+func WithFlag(flags FlagProvider, flag string) StepOption {
+	return func(cfg *stepConfig) {
+		mw := Middleware(func(next StepFunc) StepFunc {
+			return func(ctx context.Context, in any) (any, error) {
+				if !flags.Enabled(ctx, flag, CorrelationID(ctx)) {
+					return in, nil
+				}
+				return next(ctx, in)
+			}
+		})
+		cfg.middleware = append([]Middleware{mw}, cfg.middleware...)
+	}
+}
+
+// Toggle returns a fn for a step running on on the values flag is on for
+// and off on the others, e.g. to A/B test a new version of a transform on
+// some of the traffic:
+//
+//	out, errs := pipeline.StepCtx(ctx, in, pipeline.Toggle(flags, "new-pricing", price, priceV2))
+func Toggle[In any, Out any](flags FlagProvider, flag string, off, on func(context.Context, In) (Out, error)) func(context.Context, In) (Out, error) {
+	return func(ctx context.Context, v In) (Out, error) {
+		if flags.Enabled(ctx, flag, CorrelationID(ctx)) {
+			return on(ctx, v)
+		}
+		return off(ctx, v)
+	}
+}
+
+// Flags is a FlagProvider holding the flags in memory, switched with Set and
+// SetPercent, e.g. from an admin endpoint. Flags it was never told about
+// are off. Its zero value is ready to use and it is safe for concurrent use.
+type Flags struct {
+	mu sync.RWMutex
+	// percent is how much of the traffic every flag is on for, 0 to 100
+	percent map[string]float64
+}
+
+var _ FlagProvider = (*Flags)(nil)
+
+// Set switches flag on or off for every value.
+func (f *Flags) Set(flag string, on bool) {
+	if on {
+		f.SetPercent(flag, 100)
+	} else {
+		f.SetPercent(flag, 0)
+	}
+}
+
+// SetPercent switches flag on for percent percent of the values. Values with
+// the same key are always on the same side, and stay on as percent grows;
+// those without one are picked at random.
+func (f *Flags) SetPercent(flag string, percent float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.percent == nil {
+		f.percent = make(map[string]float64)
+	}
+	f.percent[flag] = min(max(percent, 0), 100)
+}
+
+// Enabled implements FlagProvider.
+func (f *Flags) Enabled(_ context.Context, flag, key string) bool {
+	f.mu.RLock()
+	percent := f.percent[flag]
+	f.mu.RUnlock()
+
+	switch {
+	case percent <= 0:
+		return false
+	case percent >= 100:
+		return true
+	case key == "":
+		return rand.Float64()*100 < percent
+	}
+
+	// the flag's name is hashed in too so a key isn't on the same side of
+	// every split
+	h := fnv.New64a()
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return float64(h.Sum64()%10000)/100 < percent
+}
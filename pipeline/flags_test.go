@@ -0,0 +1,175 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestWithFlag(t *testing.T) {
+	double := func(v int) (int, error) { return 2 * v, nil }
+
+	tests := []struct {
+		name string
+		on   bool
+		want []int
+	}{
+		{name: "off", want: []int{1, 2, 3}},
+		{name: "on", on: true, want: []int{2, 4, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var flags pipeline.Flags
+			flags.Set("double", tt.on)
+
+			got, errs := pipelinetest.RunStage(t, double, []int{1, 2, 3}, pipeline.WithFlag(&flags, "double"))
+			if len(errs) > 0 {
+				t.Fatalf("errors: %v", errs)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithFlagSwitchedWhileRunning(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	var flags pipeline.Flags
+	flags.Set("double", true)
+	in := make(chan int)
+	out, errs := pipeline.Step(context.Background(), in, func(v int) (int, error) { return 2 * v, nil },
+		pipeline.WithFlag(&flags, "double"))
+	go func() {
+		for err := range errs {
+			t.Errorf("error: %v", err)
+		}
+	}()
+
+	in <- 1
+	if got := pipelinetest.Receive(t, out); got != 2 {
+		t.Errorf("with the flag on got %d, want 2", got)
+	}
+	// killed at once, with no restart
+	flags.Set("double", false)
+	in <- 1
+	if got := pipelinetest.Receive(t, out); got != 1 {
+		t.Errorf("with the flag off got %d, want 1", got)
+	}
+	close(in)
+	pipelinetest.Collect(t, out)
+}
+
+func TestWithFlagOnAnotherType(t *testing.T) {
+	var flags pipeline.Flags
+	_, errs := pipelinetest.RunStage(t, func(v int) (string, error) { return strconv.Itoa(v), nil }, []int{1},
+		pipeline.WithFlag(&flags, "off"))
+	if len(errs) != 1 {
+		t.Errorf("errors = %v, want one for passing an int on as a string", errs)
+	}
+}
+
+func TestToggle(t *testing.T) {
+	var flags pipeline.Flags
+	flags.SetPercent("v2", 50)
+
+	a := func(context.Context, pipeline.Message[int]) (string, error) { return "a", nil }
+	b := func(context.Context, pipeline.Message[int]) (string, error) { return "b", nil }
+	fn := pipeline.Toggle(&flags, "v2", a, b)
+
+	messages := make([]pipeline.Message[int], 1000)
+	for i := range messages {
+		messages[i] = pipeline.NewMessage(i)
+	}
+	sides := func() map[string]string {
+		got := make(map[string]string, len(messages))
+		for _, m := range messages {
+			side, err := fn(pipeline.WithCorrelationID(context.Background(), m.ID), m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[m.ID] = side
+		}
+		return got
+	}
+
+	first := sides()
+	var onB int
+	for _, side := range first {
+		if side == "b" {
+			onB++
+		}
+	}
+	if onB < 400 || onB > 600 {
+		t.Errorf("%d of %d values ran b, want about half", onB, len(messages))
+	}
+
+	// a value stays on its side, and those on b stay there as it grows
+	for id, side := range sides() {
+		if side != first[id] {
+			t.Fatalf("message %s moved from %s to %s", id, first[id], side)
+		}
+	}
+	flags.SetPercent("v2", 80)
+	for id, side := range sides() {
+		if first[id] == "b" && side != "b" {
+			t.Fatalf("message %s left b as the split grew", id)
+		}
+	}
+}
+
+func TestFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(f *pipeline.Flags)
+		key  string
+		want bool
+	}{
+		{name: "unknown", set: func(*pipeline.Flags) {}},
+		{name: "on", set: func(f *pipeline.Flags) { f.Set("flag", true) }, want: true},
+		{name: "off again", set: func(f *pipeline.Flags) { f.Set("flag", true); f.Set("flag", false) }},
+		{name: "over 100 percent", set: func(f *pipeline.Flags) { f.SetPercent("flag", 150) }, key: "k", want: true},
+		{name: "negative percent", set: func(f *pipeline.Flags) { f.SetPercent("flag", -5) }, key: "k"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f pipeline.Flags
+			tt.set(&f)
+			for range 100 {
+				if got := f.Enabled(context.Background(), "flag", tt.key); got != tt.want {
+					t.Fatalf("Enabled = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFlagsConcurrently(t *testing.T) {
+	var f pipeline.Flags
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				f.SetPercent("flag", float64((i*j)%100))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				f.Enabled(context.Background(), "flag", strconv.Itoa(j))
+			}
+		}()
+	}
+	wg.Wait()
+}
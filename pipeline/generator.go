@@ -0,0 +1,96 @@
+package pipeline
+
+import "context"
+
+// Generator produces values for as long as it likes, e.g. a polling loop or
+// a socket read, handing each one to emit. emit blocks until the value has
+// been taken and fails with the context's error once ctx is done, at which
+// point the generator should return. A generator that runs until it is
+// stopped returns nil or ctx's error; any other error is reported as a
+// failure of the source.
+type Generator[T any] func(ctx context.Context, emit func(T) error) error
+
+// FromGenerator runs gen in a goroutine of its own and sends the values it
+// emits on the returned channel:
+//
+//	readings, errs := pipeline.FromGenerator(ctx, func(ctx context.Context, emit func(Reading) error) error {
+//		for {
+//			r, err := sensor.Read(ctx)
+//			if err != nil {
+//				return err
+//			}
+//			if err := emit(r); err != nil {
+//				return err
+//			}
+//		}
+//	})
+//
+// If gen fails while ctx isn't done its error is sent on the returned error
+// channel before the values are closed, so, as with FromFunc, both have to
+// be read together. Both channels are closed once gen has returned.
+func FromGenerator[T any](ctx context.Context, gen Generator[T]) (<-chan T, <-chan error) {
+	errorChannel := make(chan error)
+	values := generate(ctx, gen, func(err error) {
+		select {
+		case <-ctx.Done():
+		case errorChannel <- err:
+		}
+	}, func() {
+		close(errorChannel)
+	})
+
+	return values, errorChannel
+}
+
+// GeneratorSource returns a Source running gen, see FromGenerator. When the
+// pipeline is drained gen's context is done, so it can wind down, and if gen
+// fails the error is handled by the pipeline like any failed value, as a
+// *StageError of the stage "source", before the source is closed.
+func GeneratorSource[T any](gen Generator[T]) Source[T] {
+	return func(ctx context.Context) (<-chan T, error) {
+		return generate(ctx, gen, sourceErrors(ctx), func() {}), nil
+	}
+}
+
+// generate runs gen, reporting its failure before closing the output and
+// calling done.
+func generate[T any](ctx context.Context, gen Generator[T], report func(error), done func()) <-chan T {
+	outChannel := make(chan T)
+	emit := func(v T) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case outChannel <- v:
+			return nil
+		}
+	}
+
+	go func() {
+		defer done()
+		defer close(outChannel)
+
+		if err := gen(ctx, emit); err != nil && ctx.Err() == nil {
+			report(err)
+		}
+	}()
+
+	return outChannel
+}
+
+type sourceErrorsKey struct{}
+
+// withSourceErrors returns a copy of ctx for starting a pipeline's source
+// with, through which a GeneratorSource reports its failure to report.
+func withSourceErrors(ctx context.Context, report func(error)) context.Context {
+	return context.WithValue(ctx, sourceErrorsKey{}, report)
+}
+
+// sourceErrors returns the function a source started with ctx reports its
+// failure to, see withSourceErrors.
+func sourceErrors(ctx context.Context) func(error) {
+	if report, ok := ctx.Value(sourceErrorsKey{}).(func(error)); ok {
+		return report
+	}
+	// outside Run there is nobody to report to
+	return func(error) {}
+}
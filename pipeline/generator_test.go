@@ -0,0 +1,117 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// countTo emits 1, 2, 3... up to n, or forever if n is 0, then fails with
+// errBad.
+func countTo(n int) pipeline.Generator[int] {
+	return func(ctx context.Context, emit func(int) error) error {
+		for i := 1; n == 0 || i <= n; i++ {
+			if err := emit(i); err != nil {
+				return err
+			}
+		}
+		return errBad
+	}
+}
+
+func TestFromGenerator(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	values, errs := pipeline.FromGenerator(context.Background(), countTo(3))
+
+	var got []int
+	var failures []error
+	for values != nil || errs != nil {
+		select {
+		case v, ok := <-values:
+			if !ok {
+				values = nil
+				continue
+			}
+			got = append(got, v)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			failures = append(failures, err)
+		}
+	}
+
+	if !slices.Equal(got, []int{1, 2, 3}) || len(failures) != 1 || !errors.Is(failures[0], errBad) {
+		t.Errorf("got %v and errors %v, want [1 2 3] and %v", got, failures, errBad)
+	}
+}
+
+// TestFromGeneratorStops checks a generator stopped by its context isn't
+// reported as failing.
+func TestFromGeneratorStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	values, errs := pipeline.FromGenerator(ctx, countTo(0))
+	if got := pipelinetest.Receive(t, values); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	cancel()
+	pipelinetest.Collect(t, values)
+	if failures := pipelinetest.Collect(t, errs); len(failures) != 0 {
+		t.Errorf("got errors %v after cancelling, want none", failures)
+	}
+}
+
+func TestGeneratorSourceFails(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	sink := pipelinetest.NewSink[int]()
+	err := pipeline.New(pipeline.GeneratorSource(countTo(2))).
+		OnError(pipeline.CollectErrors()).
+		Sink(sink.Handle).
+		Run(context.Background())
+
+	var stageErr *pipeline.StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "source" || !errors.Is(err, errBad) {
+		t.Errorf("Run = %v, want the source's failure", err)
+	}
+	if got := sink.Values(); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("sink got %v, want [1 2]", got)
+	}
+}
+
+// TestGeneratorSourceDrain checks draining a pipeline stops its generator,
+// which is told why.
+func TestGeneratorSourceDrain(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	cause := make(chan error, 1)
+	source := pipeline.GeneratorSource(func(ctx context.Context, emit func(int) error) error {
+		err := countTo(0)(ctx, emit)
+		cause <- context.Cause(ctx)
+		return err
+	})
+	sink := pipelinetest.NewSink[int]()
+	p := pipeline.New(source).Sink(sink.Handle)
+
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+	sink.Next(t)
+
+	if err := p.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run = %v, want nil", err)
+	}
+	if err := <-cause; !errors.Is(err, pipeline.ErrDrained) {
+		t.Errorf("generator stopped with cause %v, want %v", err, pipeline.ErrDrained)
+	}
+}
@@ -0,0 +1,479 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Graph runs stages that don't form a single chain: a node's output can feed
+// several stages and a stage can read from several nodes, so diamond shaped
+// flows with branches and joins can be wired without plumbing the channels by
+// hand:
+//
+//	g := pipeline.NewGraph()
+//	pipeline.AddSource(g, "orders", pipeline.SliceSource(orders))
+//	pipeline.AddStage(g, "price", price)
+//	pipeline.AddStage(g, "stock", checkStock)
+//	pipeline.AddSink(g, "store", store)
+//	g.Connect("orders", "price").
+//		Connect("orders", "stock").
+//		Connect("price", "store").
+//		Connect("stock", "store")
+//	err := g.Run(ctx)
+//
+// A node with several outgoing edges sends every value down each of them, as
+// with Tee; a node with several incoming edges reads them all, as with Merge.
+// Nodes are added with the AddSource, AddStage and AddSink functions since
+// methods can't have type parameters; the types on either end of an edge are
+// checked when it is connected.
+//
+// Like a Pipeline, a Graph can be drained and inspected while it runs, so a
+// Manager can run it.
+type Graph struct {
+	nodes map[string]*graphNode
+	// names in the order they were added, so runs are deterministic
+	names []string
+	// the first error made while building, reported by Validate and Run
+	err error
+	// checks are what ValidateContext runs
+	checks []check
+
+	mu  sync.Mutex
+	run *run
+	// counter counts the current run, or the last one until the next
+	// starts, which ended at ended
+	counter *progressCounter
+	ended   time.Time
+}
+
+var _ Runnable = (*Graph)(nil)
+
+type nodeKind int
+
+const (
+	sourceNode nodeKind = iota
+	stageNode
+	sinkNode
+)
+
+func (k nodeKind) String() string {
+	switch k {
+	case sourceNode:
+		return "source"
+	case stageNode:
+		return "stage"
+	default:
+		return "sink"
+	}
+}
+
+type graphNode struct {
+	name string
+	kind nodeKind
+	// in and out are the types the node reads and emits, nil if it doesn't
+	in, out reflect.Type
+
+	source func(ctx context.Context) (<-chan any, error)
+	stage  func(ctx context.Context, in <-chan any) (<-chan any, <-chan error)
+	sink   func(v any) error
+	// opts are the step options of a stage, kept for Describe
+	opts []StepOption
+
+	parents, children []string
+}
+
+// NewGraph returns an empty Graph.
+func NewGraph() *Graph {
+	return &Graph{nodes: make(map[string]*graphNode)}
+}
+
+// AddSource adds a node named name that emits the values of source.
+func AddSource[T any](g *Graph, name string, source Source[T]) *Graph {
+	return g.add(&graphNode{
+		name: name,
+		kind: sourceNode,
+		out:  reflect.TypeFor[T](),
+		source: func(ctx context.Context) (<-chan any, error) {
+			values, err := source(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			return mapChannel(ctx, values, func(v T) any { return v }), nil
+		},
+	})
+}
+
+// AddStage adds a node named name that runs fn on every value it reads, like
+// StepCtx with the given options. The node's name is used as the step's name
+// unless the options set another.
+func AddStage[In any, Out any](g *Graph, name string, fn func(context.Context, In) (Out, error), opts ...StepOption) *Graph {
+	opts = append([]StepOption{WithName(name)}, opts...)
+
+	return g.add(&graphNode{
+		name: name,
+		kind: stageNode,
+		in:   reflect.TypeFor[In](),
+		out:  reflect.TypeFor[Out](),
+		opts: opts,
+		stage: func(ctx context.Context, in <-chan any) (<-chan any, <-chan error) {
+			call := func(ctx context.Context, v any) (any, error) {
+				in, err := as[In](v)
+				if err != nil {
+					return nil, err
+				}
+				return fn(ctx, in)
+			}
+
+			return StepCtx(ctx, in, call, opts...)
+		},
+	})
+}
+
+// AddSink adds a node named name that hands every value it reads to sink.
+// Each sink is called from a single goroutine of its own.
+func AddSink[T any](g *Graph, name string, sink func(T) error) *Graph {
+	return g.add(&graphNode{
+		name: name,
+		kind: sinkNode,
+		in:   reflect.TypeFor[T](),
+		sink: func(v any) error {
+			in, err := as[T](v)
+			if err != nil {
+				return err
+			}
+			return sink(in)
+		},
+	})
+}
+
+func (g *Graph) add(n *graphNode) *Graph {
+	if _, ok := g.nodes[n.name]; ok {
+		g.fail(fmt.Errorf("pipeline: node %q added twice", n.name))
+		return g
+	}
+	g.nodes[n.name] = n
+	g.names = append(g.names, n.name)
+	return g
+}
+
+func (g *Graph) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// Connect sends the output of the node named from to the node named to.
+// Both must already have been added, and what from emits must be assignable
+// to what to reads. Values of nodes emitting any, which could be anything,
+// are checked one by one instead, failing with ErrUnexpectedType.
+func (g *Graph) Connect(from, to string) *Graph {
+	src, ok := g.nodes[from]
+	if !ok {
+		g.fail(fmt.Errorf("pipeline: connect %q -> %q: no node %q", from, to, from))
+		return g
+	}
+	dst, ok := g.nodes[to]
+	if !ok {
+		g.fail(fmt.Errorf("pipeline: connect %q -> %q: no node %q", from, to, to))
+		return g
+	}
+	if src.out == nil {
+		g.fail(fmt.Errorf("pipeline: connect %q -> %q: %q is a sink", from, to, from))
+		return g
+	}
+	if dst.in == nil {
+		g.fail(fmt.Errorf("pipeline: connect %q -> %q: %q is a source", from, to, to))
+		return g
+	}
+	if !src.out.AssignableTo(dst.in) && src.out != reflect.TypeFor[any]() {
+		g.fail(fmt.Errorf("pipeline: connect %q -> %q: %q emits %s but %q reads %s", from, to, from, src.out, to, dst.in))
+		return g
+	}
+
+	src.children = append(src.children, to)
+	dst.parents = append(dst.parents, from)
+	return g
+}
+
+// Validate reports the first mistake made while building the graph, a node
+// that isn't connected on both ends (sources only need an output and sinks
+// only an input) or a cycle.
+func (g *Graph) Validate() error {
+	_, err := g.sorted()
+	return err
+}
+
+// sorted validates the graph and returns its nodes so that every node comes
+// after the nodes feeding it.
+func (g *Graph) sorted() ([]*graphNode, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	if len(g.nodes) == 0 {
+		return nil, fmt.Errorf("pipeline: empty graph")
+	}
+
+	indegree := make(map[string]int, len(g.nodes))
+	var ready []string
+	for _, name := range g.names {
+		n := g.nodes[name]
+		if n.kind != sourceNode && len(n.parents) == 0 {
+			return nil, fmt.Errorf("pipeline: %s %q has no input", n.kind, name)
+		}
+		if n.kind != sinkNode && len(n.children) == 0 {
+			return nil, fmt.Errorf("pipeline: %s %q has no output", n.kind, name)
+		}
+		indegree[name] = len(n.parents)
+		if len(n.parents) == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	order := make([]*graphNode, 0, len(g.nodes))
+	for len(ready) > 0 {
+		n := g.nodes[ready[0]]
+		ready = ready[1:]
+		order = append(order, n)
+
+		for _, child := range n.children {
+			indegree[child]--
+			if indegree[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+
+	if len(order) < len(g.nodes) {
+		for _, name := range g.names {
+			if indegree[name] > 0 {
+				return nil, fmt.Errorf("pipeline: graph has a cycle through %q", name)
+			}
+		}
+	}
+
+	return order, nil
+}
+
+// Run validates the graph, starts every node and blocks until all sinks have
+// handled every value. The first error from any stage or sink cancels the
+// whole graph and is returned, sink failures as a *StageError named after the
+// sink and the failure of a GeneratorSource as one named after the source.
+// If ctx is done first, its cause is returned, see context.Cause. The
+// error that stopped the graph is the cause of the cancellation its nodes
+// see. If a Drain gives up waiting, an error wrapping ErrDrainTimeout is
+// returned.
+//
+// A Graph runs once at a time; calling Run again while it is running
+// returns ErrRunning.
+func (g *Graph) Run(ctx context.Context) error {
+	order, err := g.sorted()
+	if err != nil {
+		return err
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	runCtx := ctx
+
+	clock := ClockFrom(ctx)
+	counter := &progressCounter{clock: clock, start: clock.Now()}
+	r := &run{
+		cancel: func() {
+			cancel(errDrainTimeout)
+		},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		counter: counter,
+	}
+	g.mu.Lock()
+	if g.run != nil {
+		g.mu.Unlock()
+		return ErrRunning
+	}
+	g.run, g.counter = r, counter
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.run = nil
+		g.ended = clock.Now()
+		g.mu.Unlock()
+		close(r.done)
+	}()
+
+	group, ctx := errgroup.WithContext(ctx)
+	// the sources are stopped as soon as intake is, so they can wind down
+	// while the rest of the graph drains
+	sourceCtx, stopSources := context.WithCancelCause(ctx)
+	defer stopSources(nil)
+	r.setStopSource(stopSources)
+	// the first source to fail stops the graph, as a failed stage does
+	sourceErr := make(chan error, 1)
+	inputs := make(map[string][]<-chan any, len(order))
+	var stepErrors []<-chan error
+
+	for _, n := range order {
+		var out <-chan any
+		switch n.kind {
+		case sourceNode:
+			out, err = n.source(withSourceErrors(sourceCtx, func(err error) {
+				err = &StageError{Stage: n.name, Err: err}
+				select {
+				case sourceErr <- err:
+					counter.failed.Add(1)
+					cancel(err)
+				default:
+				}
+			}))
+			if err != nil {
+				// stop whatever has been started already
+				cancel(err)
+				group.Wait()
+				return err
+			}
+			out = mapChannel(ctx, gate(ctx, out, r.stop, nil), func(v any) any {
+				counter.produced.Add(1)
+				return v
+			})
+		case stageNode:
+			var errs <-chan error
+			out, errs = n.stage(ctx, Merge(ctx, inputs[n.name]...))
+			stepErrors = append(stepErrors, errs)
+		case sinkNode:
+			in := Merge(ctx, inputs[n.name]...)
+			group.Go(func() error {
+				for v := range in {
+					if err := n.sink(v); err != nil {
+						counter.failed.Add(1)
+						return &StageError{Stage: n.name, Input: v, ID: correlationID(v), Attempts: 1, Err: err}
+					}
+					counter.done.Add(1)
+				}
+				return nil
+			})
+			continue
+		}
+
+		if len(n.children) == 1 {
+			inputs[n.children[0]] = append(inputs[n.children[0]], out)
+			continue
+		}
+		for i, c := range Tee(ctx, out, len(n.children), 0) {
+			child := n.children[i]
+			inputs[child] = append(inputs[child], c)
+		}
+	}
+
+	errs := Merge(ctx, stepErrors...)
+	group.Go(func() error {
+		if err, ok := <-errs; ok {
+			counter.failed.Add(1)
+			return err
+		}
+		return nil
+	})
+
+	err = group.Wait()
+	if cause := context.Cause(runCtx); errors.Is(cause, ErrDrainTimeout) {
+		return cause
+	}
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-sourceErr:
+		return err
+	default:
+	}
+	return context.Cause(parent)
+}
+
+// Drain gracefully stops a running graph as Pipeline.Drain does a pipeline:
+// no more values are read from its sources, whose contexts are done with
+// ErrDrained as their cause, but the ones already inside the graph are
+// flushed to the sinks before Run returns nil. If ctx is done before that,
+// the graph is cancelled and Drain returns the context's error.
+//
+// Drain returns nil straight away if the graph isn't running.
+func (g *Graph) Drain(ctx context.Context) error {
+	g.mu.Lock()
+	r := g.run
+	g.mu.Unlock()
+
+	if r == nil {
+		return nil
+	}
+
+	r.stopIntake()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		return ctx.Err()
+	}
+}
+
+// Status returns a snapshot of the graph's stages and, while it runs, of the
+// values its sources emitted and its sinks handled. A graph doesn't count
+// what each of its stages does, so the counts of the stages are 0. It is
+// safe to call from any goroutine.
+func (g *Graph) Status() Status {
+	g.mu.Lock()
+	r := g.run
+	g.mu.Unlock()
+
+	s := Status{Running: r != nil}
+	for _, name := range g.names {
+		n := g.nodes[name]
+		if n.kind != stageNode {
+			continue
+		}
+		cfg := newStepConfig(n.opts)
+		s.Stages = append(s.Stages, StageStatus{Name: cfg.name, Details: stepDetails(cfg)})
+	}
+	if r == nil {
+		return s
+	}
+
+	s.Started = r.counter.start
+	s.Produced, s.Done, s.Failed = r.counter.produced.Load(), r.counter.done.Load(), r.counter.failed.Load()
+	return s
+}
+
+// Stats returns a snapshot of the current run or, once it has returned, of
+// the last one, as Status counts, without any stages. It is the zero Stats
+// if the graph has never run.
+func (g *Graph) Stats() Stats {
+	g.mu.Lock()
+	counter, ended := g.counter, g.ended
+	running := g.run != nil
+	g.mu.Unlock()
+
+	if counter == nil {
+		return Stats{}
+	}
+
+	progress := counter.snapshot()
+	s := Stats{
+		Running:  running,
+		Started:  counter.start,
+		Uptime:   progress.Elapsed,
+		Produced: progress.Produced,
+		Done:     progress.Done,
+		Failed:   progress.Failed,
+	}
+	if !running {
+		s.Uptime = ended.Sub(counter.start)
+	}
+	return s
+}
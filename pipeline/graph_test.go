@@ -0,0 +1,276 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// diamond feeds the numbers to a doubling and a negating stage, both of which
+// feed the sink.
+func diamond(numbers []int, sink func(int) error) *pipeline.Graph {
+	g := pipeline.NewGraph()
+	pipeline.AddSource(g, "numbers", pipeline.SliceSource(numbers))
+	pipeline.AddStage(g, "double", func(_ context.Context, v int) (int, error) { return 2 * v, nil })
+	pipeline.AddStage(g, "negate", func(_ context.Context, v int) (int, error) { return -v, nil })
+	pipeline.AddSink(g, "sink", sink)
+
+	return g.Connect("numbers", "double").
+		Connect("numbers", "negate").
+		Connect("double", "sink").
+		Connect("negate", "sink")
+}
+
+func TestGraphRun(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	var mu sync.Mutex
+	var got []int
+	err := diamond([]int{1, 2, 3}, func(v int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, v)
+		return nil
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(got)
+	if want := []int{-3, -2, -1, 2, 4, 6}; !slices.Equal(got, want) {
+		t.Errorf("sink got %v, want %v", got, want)
+	}
+}
+
+func TestGraphSinkFailureStopsTheGraph(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	boom := errors.New("boom")
+	numbers := make([]int, 1000)
+	err := diamond(numbers, func(int) error { return boom }).Run(context.Background())
+
+	var stageErr *pipeline.StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "sink" || !errors.Is(err, boom) {
+		t.Errorf("Run returned %v, want the sink's failure", err)
+	}
+}
+
+func TestGraphSourceFailureStopsTheGraph(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	g := pipeline.NewGraph()
+	pipeline.AddSource(g, "numbers", pipeline.GeneratorSource(func(_ context.Context, emit func(int) error) error {
+		if err := emit(1); err != nil {
+			return err
+		}
+		return errBad
+	}))
+	pipeline.AddSink(g, "sink", func(int) error { return nil })
+	err := g.Connect("numbers", "sink").Run(context.Background())
+
+	var stageErr *pipeline.StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "numbers" || !errors.Is(err, errBad) {
+		t.Errorf("Run returned %v, want the source's failure", err)
+	}
+}
+
+func TestGraphValidate(t *testing.T) {
+	noop := func(_ context.Context, v int) (int, error) { return v, nil }
+
+	tests := []struct {
+		name  string
+		build func(g *pipeline.Graph)
+		want  string
+	}{
+		{
+			name:  "empty",
+			build: func(*pipeline.Graph) {},
+			want:  "empty graph",
+		},
+		{
+			name: "type mismatch",
+			build: func(g *pipeline.Graph) {
+				pipeline.AddSource(g, "words", pipeline.SliceSource([]string{"a"}))
+				pipeline.AddSink(g, "sink", func(int) error { return nil })
+				g.Connect("words", "sink")
+			},
+			want: "emits string but",
+		},
+		{
+			name: "unconnected stage",
+			build: func(g *pipeline.Graph) {
+				pipeline.AddSource(g, "numbers", pipeline.SliceSource([]int{1}))
+				pipeline.AddStage(g, "a", noop)
+				pipeline.AddSink(g, "sink", func(int) error { return nil })
+				g.Connect("numbers", "sink")
+			},
+			want: `stage "a" has no input`,
+		},
+		{
+			name: "cycle",
+			build: func(g *pipeline.Graph) {
+				pipeline.AddSource(g, "numbers", pipeline.SliceSource([]int{1}))
+				pipeline.AddStage(g, "a", noop)
+				pipeline.AddStage(g, "b", noop)
+				pipeline.AddSink(g, "sink", func(int) error { return nil })
+				g.Connect("numbers", "a").Connect("a", "b").Connect("b", "a").Connect("b", "sink")
+			},
+			want: "cycle",
+		},
+		{
+			name: "duplicate node",
+			build: func(g *pipeline.Graph) {
+				pipeline.AddStage(g, "a", noop)
+				pipeline.AddStage(g, "a", noop)
+			},
+			want: "added twice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := pipeline.NewGraph()
+			tt.build(g)
+
+			err := g.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate returned %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphInterfaceEdges(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	// a nil error is a valid value of an interface typed edge
+	var got []error
+	g := pipeline.NewGraph()
+	pipeline.AddSource(g, "errors", pipeline.SliceSource([]error{nil, errors.New("x")}))
+	pipeline.AddSink(g, "sink", func(err error) error {
+		got = append(got, err)
+		return nil
+	})
+	if err := g.Connect("errors", "sink").Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 || got[0] != nil || got[1] == nil {
+		t.Errorf("sink got %v, want [<nil> x]", got)
+	}
+}
+
+func TestGraphUntypedEdges(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	var got []int
+	g := pipeline.NewGraph()
+	pipeline.AddSource(g, "values", pipeline.SliceSource([]any{1, 2, "three"}))
+	pipeline.AddSink(g, "ints", func(v int) error {
+		got = append(got, v)
+		return nil
+	})
+
+	// the edge is allowed, the string fails once it arrives
+	err := g.Connect("values", "ints").Run(context.Background())
+	if !errors.Is(err, pipeline.ErrUnexpectedType) {
+		t.Errorf("Run() = %v, want ErrUnexpectedType", err)
+	}
+	if !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("sink got %v, want [1 2]", got)
+	}
+}
+
+// blockingGraph runs blockingSource through a stage into sink, reporting
+// on cause why the source was stopped.
+func blockingGraph(sink func(int) error, cause chan<- error) *pipeline.Graph {
+	source := func(ctx context.Context) (<-chan int, error) {
+		out, err := blockingSource(ctx)
+		go func() {
+			<-ctx.Done()
+			cause <- context.Cause(ctx)
+		}()
+		return out, err
+	}
+
+	g := pipeline.NewGraph()
+	pipeline.AddSource(g, "numbers", source)
+	pipeline.AddStage(g, "id", func(_ context.Context, v int) (int, error) { return v, nil }, pipeline.WithConcurrency(2))
+	pipeline.AddSink(g, "sink", sink)
+	return g.Connect("numbers", "id").Connect("id", "sink")
+}
+
+func TestGraphDrain(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	cause := make(chan error, 1)
+	g := blockingGraph(func(int) error { return nil }, cause)
+	if s := g.Stats(); !s.Started.IsZero() || s.Produced != 0 {
+		t.Errorf("Stats before running = %+v, want the zero Stats", s)
+	}
+
+	ran := make(chan error, 1)
+	go func() { ran <- g.Run(context.Background()) }()
+	waitFor(t, "the graph to run", func() bool { return g.Status().Done > 0 })
+
+	s := g.Status()
+	if !s.Running || s.Started.IsZero() || s.Produced < s.Done {
+		t.Errorf("Status = %+v, want a running graph", s)
+	}
+	if len(s.Stages) != 1 || s.Stages[0].Name != "id" || !slices.Contains(s.Stages[0].Details, "concurrency: 2") {
+		t.Errorf("Stages = %+v, want the id stage with its options", s.Stages)
+	}
+	if err := g.Run(context.Background()); !errors.Is(err, pipeline.ErrRunning) {
+		t.Errorf("second Run = %v, want ErrRunning", err)
+	}
+
+	if err := g.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ran; err != nil {
+		t.Errorf("Run after Drain = %v, want nil", err)
+	}
+	if err := <-cause; !errors.Is(err, pipeline.ErrDrained) {
+		t.Errorf("source stopped with %v, want ErrDrained", err)
+	}
+
+	stats := g.Stats()
+	if stats.Running || stats.Done == 0 || stats.Produced != stats.Done || stats.Uptime <= 0 {
+		t.Errorf("Stats after Drain = %+v, want everything produced handled", stats)
+	}
+	if g.Status().Running {
+		t.Error("Status reports the drained graph running")
+	}
+}
+
+func TestGraphDrainTimeout(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	// the sink holds on to its first value past the drain's deadline
+	release := make(chan struct{})
+	g := blockingGraph(func(int) error {
+		<-release
+		return nil
+	}, make(chan error, 1))
+
+	ran := make(chan error, 1)
+	go func() { ran <- g.Run(context.Background()) }()
+	waitFor(t, "the graph to run", func() bool { return g.Status().Produced > 0 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	if err := g.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain = %v, want the context's error", err)
+	}
+	if err := <-ran; !errors.Is(err, pipeline.ErrDrainTimeout) {
+		t.Errorf("Run = %v, want ErrDrainTimeout", err)
+	}
+}
@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs a pipeline wired by hand from Step, Merge and the like the way
+// Pipeline.Run runs a built one, so the caller doesn't have to cancel the
+// stages, watch their error channels and drive the sink loop itself:
+//
+//	g, ctx := pipeline.NewGroup(ctx)
+//	parsed, errs := pipeline.Step(ctx, pipeline.FromSlice(ctx, lines), parse)
+//	stored, storeErrs := pipeline.Step(ctx, parsed, store)
+//	g.Errors(errs, storeErrs)
+//	pipeline.Consume(g, stored, report)
+//	err := g.Wait()
+//
+// It is an errgroup.Group for pipelines: the first error cancels ctx, and
+// with it every stage started with ctx, and is what Wait returns once every
+// watched error channel has been closed, that is once every stage has wound
+// down, and everything started with Go and Consume has returned.
+type Group struct {
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	once sync.Once
+	err  error
+}
+
+// NewGroup returns a Group and the context to start the stages with, which
+// is cancelled as soon as one of them fails, with the failure as its cause,
+// or once Wait returns.
+func NewGroup(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group{ctx: ctx, cancel: cancel}, ctx
+}
+
+// fail records err if it is the group's first error and cancels the group.
+func (g *Group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel(err)
+	})
+}
+
+// Go runs fn in a goroutine of its own, failing the group with what it
+// returns, as errgroup.Group.Go does.
+func (g *Group) Go(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Errors watches every one of errs until it is closed, failing the group
+// with the first error any of them carries.
+func (g *Group) Errors(errs ...<-chan error) {
+	for _, c := range errs {
+		g.Go(func() error {
+			// drained to the end even after the first error, so Wait only
+			// returns once the stage has closed it
+			for err := range c {
+				g.fail(err)
+			}
+			return nil
+		})
+	}
+}
+
+// Consume calls handle with every value from values in a goroutine of its
+// own, until values is closed or the group's context is done. The first
+// error handle returns fails the group.
+func Consume[T any](g *Group, values <-chan T, handle func(T) error) {
+	g.Go(func() error {
+		for {
+			select {
+			case <-g.ctx.Done():
+				return nil
+			case v, ok := <-values:
+				if !ok {
+					return nil
+				}
+				if err := handle(v); err != nil {
+					return err
+				}
+			}
+		}
+	})
+}
+
+// Wait waits for every stage and goroutine of the group, see Group, and
+// returns the first error, if any.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(context.Canceled)
+	return g.err
+}
@@ -0,0 +1,102 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestGroup(t *testing.T) {
+	errHandle := errors.New("handle")
+	errGo := errors.New("go")
+
+	tests := []struct {
+		name string
+		// fail is the value the step fails on, handleFail the one the
+		// consumer fails on, 0 for none
+		fail, handleFail int
+		goErr            error
+		want             error
+	}{
+		{name: "ok"},
+		{name: "step fails", fail: 3, want: errBad},
+		{name: "consumer fails", handleFail: 2, want: errHandle},
+		{name: "go fails", goErr: errGo, want: errGo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			var mu sync.Mutex
+			var got []int
+			g, ctx := pipeline.NewGroup(context.Background())
+			src := pipeline.FromSlice(ctx, []int{1, 2, 3, 4, 5})
+			values, errs := pipeline.Step(ctx, src, func(v int) (int, error) {
+				if v == tt.fail {
+					return 0, errBad
+				}
+				return v, nil
+			}, pipeline.WithConcurrency(1))
+			g.Errors(errs)
+			pipeline.Consume(g, values, func(v int) error {
+				if v == tt.handleFail {
+					return errHandle
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, v)
+				return nil
+			})
+			g.Go(func() error { return tt.goErr })
+
+			err := g.Wait()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Wait = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && !slices.Equal(got, []int{1, 2, 3, 4, 5}) {
+				t.Errorf("consumed %v", got)
+			}
+			if ctx.Err() == nil {
+				t.Error("the group's context is still live after Wait")
+			}
+		})
+	}
+}
+
+// TestGroupWaits checks that Wait, like errgroup's, only returns once the
+// stages cancelled by the first error have wound down.
+func TestGroupWaits(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	const workers = 4
+	var started, finished atomic.Int32
+	g, ctx := pipeline.NewGroup(context.Background())
+	values, errs := pipeline.StepCtx(ctx, blockingChannel(ctx), func(ctx context.Context, v int) (int, error) {
+		if started.Add(1) == workers {
+			return 0, errBad
+		}
+		<-ctx.Done()
+		finished.Add(1)
+		return 0, ctx.Err()
+	}, pipeline.WithConcurrency(workers))
+	g.Errors(errs)
+	pipeline.Consume(g, values, func(int) error { return nil })
+
+	if err := g.Wait(); !errors.Is(err, errBad) {
+		t.Fatalf("Wait = %v, want %v", err, errBad)
+	}
+	if got := finished.Load(); got != started.Load()-1 {
+		t.Errorf("Wait returned with %d of %d hanging calls finished", got, started.Load()-1)
+	}
+}
+
+func blockingChannel(ctx context.Context) <-chan int {
+	out, _ := blockingSource(ctx)
+	return out
+}
@@ -0,0 +1,24 @@
+package pipeline
+
+// TransportHeaders are the headers ExtractHeaders copies from the transport
+// a value arrived over, and the keys it stores them under: trace context,
+// for OpenTelemetry's propagators, the correlation ID, see NewMessageFrom,
+// and the content type.
+var TransportHeaders = []string{"traceparent", "tracestate", "baggage", CorrelationHeader, "Content-Type"}
+
+// ExtractHeaders returns the TransportHeaders get has a value for, get
+// looking them up by name in the headers of an incoming request or broker
+// message. It must ignore case, as http.Header.Get does, since transports
+// differ in how they spell them. Sources hand the result to NewMessageFrom
+// so the metadata travels with the value to the steps and sinks that pass
+// it on.
+func ExtractHeaders(get func(key string) string) Headers {
+	headers := Headers{}
+	for _, key := range TransportHeaders {
+		if v := get(key); v != "" {
+			headers.Set(key, v)
+		}
+	}
+
+	return headers
+}
@@ -0,0 +1,88 @@
+package pipeline_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestExtractHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   pipeline.Headers
+	}{
+		{name: "none", header: http.Header{"Accept": {"*/*"}}, want: pipeline.Headers{}},
+		{
+			name: "any case",
+			header: http.Header{
+				"Traceparent":      {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+				"X-Correlation-Id": {"abc"},
+				"Content-Type":     {"application/json"},
+				"Authorization":    {"secret"},
+			},
+			want: pipeline.Headers{
+				"traceparent":              "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+				pipeline.CorrelationHeader: "abc",
+				"Content-Type":             "application/json",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pipeline.ExtractHeaders(tt.header.Get)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestNewMessageWebhook(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	hook := pipeline.NewMessageWebhook(1, 1<<10, func(b []byte) (string, error) { return string(b), nil })
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Correlation-Id", "abc")
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST: %s", resp.Status)
+	}
+	hook.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	values, err := hook.Source()(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := pipelinetest.Collect(t, values)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	m := msgs[0]
+	if m.Payload != "hello" || m.ID != "abc" || m.Headers.Get("traceparent") == "" {
+		t.Errorf("got %+v, want hello with the request's ID and trace context", m)
+	}
+}
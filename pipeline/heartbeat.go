@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// StageState is what a step was doing between two heartbeats.
+type StageState int
+
+const (
+	// StageActive steps finished values since the last heartbeat.
+	StageActive StageState = iota
+	// StageIdle steps finished nothing and had nothing to work on: there
+	// was no work.
+	StageIdle
+	// StageStalled steps finished nothing though they had values in
+	// flight: the work is stuck.
+	StageStalled
+)
+
+func (s StageState) String() string {
+	switch s {
+	case StageActive:
+		return "active"
+	case StageIdle:
+		return "idle"
+	case StageStalled:
+		return "stalled"
+	default:
+		return "unknown"
+	}
+}
+
+// Heartbeat is what a step did since its last heartbeat, see
+// Pipeline.Heartbeat.
+type Heartbeat struct {
+	Stage string
+	State StageState
+	// Processed, Failed and Skipped count the values the step finished
+	// since the last heartbeat.
+	Processed int64
+	Failed    int64
+	Skipped   int64
+	// InFlight and Queued are as for StageProgress, at the time of the
+	// heartbeat.
+	InFlight int64
+	Queued   int64
+	At       time.Time
+}
+
+// Heartbeat calls beat with a Heartbeat for every step, in order, every
+// interval while the pipeline runs, telling a step with no work, StageIdle,
+// apart from one whose work is stuck, StageStalled, so monitoring doesn't
+// page anyone about a quiet night. beat is called from a goroutine of its
+// own and never after Run has returned.
+func (p *Pipeline[T]) Heartbeat(interval time.Duration, beat func(Heartbeat)) *Pipeline[T] {
+	p.heartbeatEvery = interval
+	p.heartbeat = beat
+	return p
+}
+
+// heartbeat calls beat for the steps counted by counter every interval until
+// the returned func is called, which waits for it to stop.
+func heartbeat(ctx context.Context, counter *progressCounter, interval time.Duration, beat func(Heartbeat)) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := counter.clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		// last is what every step had finished at the previous heartbeat
+		type finished struct{ processed, failed, skipped int64 }
+		last := make([]finished, len(counter.stages))
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C():
+				for i, counts := range counter.stages {
+					f := finished{counts.processed.Load(), counts.failed.Load(), counts.skipped.Load()}
+					h := Heartbeat{
+						Stage:     counter.names[i],
+						Processed: f.processed - last[i].processed,
+						Failed:    f.failed - last[i].failed,
+						Skipped:   f.skipped - last[i].skipped,
+						InFlight:  counts.inFlight.Load(),
+						Queued:    counts.queued.Load(),
+						At:        now,
+					}
+					last[i] = f
+
+					switch {
+					case h.Processed+h.Failed+h.Skipped > 0:
+						h.State = StageActive
+					case h.InFlight > 0:
+						h.State = StageStalled
+					default:
+						h.State = StageIdle
+					}
+					beat(h)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,89 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestHeartbeat(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	beats := make(chan pipeline.Heartbeat, 10)
+	src := pipelinetest.NewSource[int]()
+	sink := pipelinetest.NewSink[int]()
+	step := pipelinetest.NewScript(func(_ context.Context, v int) (int, error) { return v, nil })
+	p := pipeline.New(src.Open).
+		ThenCtx(step.Fn, pipeline.WithName("work"), pipeline.WithConcurrency(1)).
+		Sink(sink.Handle).
+		Heartbeat(time.Minute, func(h pipeline.Heartbeat) { beats <- h })
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	clock.WaitForTimers(1)
+
+	beat := func() pipeline.Heartbeat {
+		t.Helper()
+		clock.Advance(time.Minute)
+		h := pipelinetest.Receive(t, beats)
+		if h.Stage != "work" {
+			t.Errorf("heartbeat for %q, want work", h.Stage)
+		}
+		return h
+	}
+
+	tests := []struct {
+		name          string
+		do            func()
+		wantState     pipeline.StageState
+		wantProcessed int64
+		wantInFlight  int64
+	}{
+		{
+			name: "active",
+			do: func() {
+				src.Send(t, 1, 2)
+				sink.Next(t)
+				sink.Next(t)
+			},
+			wantState:     pipeline.StageActive,
+			wantProcessed: 2,
+		},
+		{name: "idle", do: func() {}, wantState: pipeline.StageIdle},
+		{
+			name: "stalled",
+			do: func() {
+				step.Hang()
+				src.Send(t, 3)
+				waitFor(t, "the call to hang", func() bool { return len(step.Calls()) == 3 })
+			},
+			wantState:    pipeline.StageStalled,
+			wantInFlight: 1,
+		},
+		{
+			name: "recovered",
+			do: func() {
+				step.Release()
+				sink.Next(t)
+			},
+			wantState:     pipeline.StageActive,
+			wantProcessed: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt.do()
+		h := beat()
+		if h.State != tt.wantState || h.Processed != tt.wantProcessed || h.InFlight != tt.wantInFlight {
+			t.Errorf("%s: got %+v, want %s with %d processed and %d in flight", tt.name, h, tt.wantState, tt.wantProcessed, tt.wantInFlight)
+		}
+	}
+
+	src.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// Hooks are called as a step, or a whole Pipeline, goes through its
+// lifecycle, so audit logs or notifications can follow along without
+// wrapping every transform. Any of them may be nil.
+//
+// Hooks are called synchronously from the goroutines doing the work, item
+// hooks from several at once, so they must be safe for concurrent use and
+// quick; a slow hook slows the step down.
+type Hooks struct {
+	// OnStageStart is called once a step starts reading its input.
+	OnStageStart func(stage string)
+	// OnItemProcessed is called after fn succeeded on input, having taken
+	// elapsed, retries included.
+	OnItemProcessed func(stage string, input any, elapsed time.Duration)
+	// OnItemError is called with every failure the step reports. For a
+	// Pipeline it is called once the failure reaches Run, sink failures
+	// included, before the ErrorPolicy decides what it means.
+	OnItemError func(err *StageError)
+	// OnItemDropped is called with every value the step drops and why, so
+	// load shedding can be counted or the values kept elsewhere. Steps only
+	// drop the results their WithBackpressure policy discards, the channel
+	// stages that drop values report to WithDropHook instead.
+	OnItemDropped func(stage string, value any, reason DropReason)
+	// OnStageDone is called once a step has handled every value, right
+	// before its channels are closed.
+	OnStageDone func(stage string)
+	// OnPipelineDone is called with the error Run returns, once it is about
+	// to return. Steps don't call it.
+	OnPipelineDone func(err error)
+}
+
+// DropReason is why a value was dropped, see Hooks.OnItemDropped.
+type DropReason int
+
+const (
+	// DroppedOldest is a result discarded by a step's DropOldest policy to
+	// make room in its full output buffer.
+	DroppedOldest DropReason = iota
+	// DroppedNewest is a result discarded by a step's DropNewest policy
+	// because its output buffer was full.
+	DroppedNewest
+	// DroppedExpired is a value Join left unmatched for longer than its
+	// ttl.
+	DroppedExpired
+	// DroppedSampled is a value Sample left out of its sample.
+	DroppedSampled
+	// DroppedOverflow is the value with the lowest priority a full
+	// PriorityQueue dropped with OverflowDropLowest.
+	DroppedOverflow
+	// DroppedThrottled is a value Throttle dropped with ThrottleDrop for
+	// arriving too soon.
+	DroppedThrottled
+)
+
+func (r DropReason) String() string {
+	switch r {
+	case DroppedOldest:
+		return "drop-oldest"
+	case DroppedNewest:
+		return "drop-newest"
+	case DroppedExpired:
+		return "expired"
+	case DroppedSampled:
+		return "sampled"
+	case DroppedOverflow:
+		return "overflow"
+	case DroppedThrottled:
+		return "throttled"
+	default:
+		return "unknown"
+	}
+}
+
+type dropHookKey struct{}
+
+// WithDropHook returns a copy of ctx that makes the channel stages started
+// with it that drop values, Join, Sample, PriorityQueue and Throttle, call
+// hook with every one of them and why, as Hooks.OnItemDropped does for
+// steps. The stage is the StageName of ctx, "" outside a named step.
+func WithDropHook(ctx context.Context, hook func(stage string, value any, reason DropReason)) context.Context {
+	return context.WithValue(ctx, dropHookKey{}, hook)
+}
+
+// dropHook returns what a channel stage started with ctx calls with the
+// values it drops, which does nothing if ctx carries no hook.
+func dropHook(ctx context.Context) func(value any, reason DropReason) {
+	hook, _ := ctx.Value(dropHookKey{}).(func(string, any, DropReason))
+	if hook == nil {
+		return func(any, DropReason) {}
+	}
+
+	stage := StageName(ctx)
+	return func(value any, reason DropReason) {
+		hook(stage, value, reason)
+	}
+}
+
+// WithHooks calls h as the step goes through its lifecycle, see Hooks.
+func WithHooks(h Hooks) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.hooks = h
+	}
+}
+
+// Hooks calls h as the pipeline and its steps go through their lifecycle,
+// see Hooks, on top of any hooks the steps have of their own. Unnamed steps
+// are reported as "step 1", "step 2" and so on.
+func (p *Pipeline[T]) Hooks(h Hooks) *Pipeline[T] {
+	p.hooks = h
+	return p
+}
+
+// withPipelineHooks is used by Pipeline to call its hooks, but for
+// OnItemError, which it leaves to Run, along with the step's own.
+func withPipelineHooks(h Hooks) StepOption {
+	h.OnItemError = nil
+	return func(cfg *stepConfig) {
+		cfg.hooks = cfg.hooks.and(h)
+	}
+}
+
+// and returns hooks calling h's, then next's.
+func (h Hooks) and(next Hooks) Hooks {
+	return Hooks{
+		OnStageStart:    chain1(h.OnStageStart, next.OnStageStart),
+		OnItemProcessed: chain3(h.OnItemProcessed, next.OnItemProcessed),
+		OnItemError:     chain1(h.OnItemError, next.OnItemError),
+		OnItemDropped:   chain3(h.OnItemDropped, next.OnItemDropped),
+		OnStageDone:     chain1(h.OnStageDone, next.OnStageDone),
+		OnPipelineDone:  chain1(h.OnPipelineDone, next.OnPipelineDone),
+	}
+}
+
+func chain1[A any](f, g func(A)) func(A) {
+	switch {
+	case f == nil:
+		return g
+	case g == nil:
+		return f
+	}
+	return func(a A) {
+		f(a)
+		g(a)
+	}
+}
+
+func chain3[A, B, C any](f, g func(A, B, C)) func(A, B, C) {
+	switch {
+	case f == nil:
+		return g
+	case g == nil:
+		return f
+	}
+	return func(a A, b B, c C) {
+		f(a, b, c)
+		g(a, b, c)
+	}
+}
@@ -0,0 +1,201 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestPipelineHooksKeepStepHooks(t *testing.T) {
+	tests := []struct {
+		name          string
+		pipelineHooks bool
+	}{
+		{name: "step hooks only"},
+		{name: "step and pipeline hooks", pipelineHooks: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stepCalls, pipelineCalls atomic.Int64
+			step := pipeline.Hooks{
+				OnItemProcessed: func(string, any, time.Duration) { stepCalls.Add(1) },
+			}
+
+			p := pipeline.New(pipeline.SliceSource([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})).
+				Then(func(v int) (int, error) { return v, nil }, pipeline.WithHooks(step)).
+				Sink(func(int) error { return nil })
+			if tt.pipelineHooks {
+				p.Hooks(pipeline.Hooks{
+					OnItemProcessed: func(string, any, time.Duration) { pipelineCalls.Add(1) },
+				})
+			}
+			if err := p.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := stepCalls.Load(); got != 10 {
+				t.Errorf("step OnItemProcessed called %d times, want 10", got)
+			}
+			want := int64(0)
+			if tt.pipelineHooks {
+				want = 10
+			}
+			if got := pipelineCalls.Load(); got != want {
+				t.Errorf("pipeline OnItemProcessed called %d times, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestPipelineHooksReportFailuresOnce(t *testing.T) {
+	boom := errors.New("boom")
+	var failures atomic.Int64
+
+	err := pipeline.New(pipeline.SliceSource([]int{1, 2, 3})).
+		Then(func(v int) (int, error) {
+			if v == 2 {
+				return 0, boom
+			}
+			return v, nil
+		}, pipeline.WithName("check")).
+		Hooks(pipeline.Hooks{
+			OnItemError: func(*pipeline.StageError) { failures.Add(1) },
+		}).
+		Sink(func(int) error { return nil }).
+		Run(context.Background())
+	if !errors.Is(err, boom) {
+		t.Fatalf("Run returned %v, want %v", err, boom)
+	}
+
+	if got := failures.Load(); got != 1 {
+		t.Errorf("OnItemError called %d times, want 1", got)
+	}
+}
+
+// TestPipelineStepHooksSeeValues checks a step's own OnItemError hook is
+// handed the value that failed, not how the Pipeline wraps it.
+func TestPipelineStepHooksSeeValues(t *testing.T) {
+	boom := errors.New("boom")
+	var failed atomic.Value
+
+	err := pipeline.New(pipeline.SliceSource([]int{1, 2, 3})).
+		Then(func(v int) (int, error) {
+			if v == 2 {
+				return 0, boom
+			}
+			return v, nil
+		}, pipeline.WithHooks(pipeline.Hooks{
+			OnItemError: func(err *pipeline.StageError) { failed.Store(err.Input) },
+		})).
+		Sink(func(int) error { return nil }).
+		Run(context.Background())
+	if !errors.Is(err, boom) {
+		t.Fatalf("Run returned %v, want %v", err, boom)
+	}
+
+	if got := failed.Load(); got != 2 {
+		t.Errorf("OnItemError called with %#v, want 2", got)
+	}
+}
+
+// drops is a drop hook keeping what it was told.
+type drops struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (d *drops) hook(stage string, value any, reason pipeline.DropReason) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.list = append(d.list, fmt.Sprintf("%s%v %s", stage, value, reason))
+}
+
+func (d *drops) get() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.list)
+}
+
+func TestDropHook(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, t *testing.T, clock *pipelinetest.FakeClock)
+		want []string
+	}{
+		{
+			name: "sample",
+			run: func(ctx context.Context, t *testing.T, _ *pipelinetest.FakeClock) {
+				pipelinetest.Collect(t, pipeline.Sample(ctx, waiting(1, 2, 3, 4, 5), pipeline.SampleEvery(2)))
+			},
+			want: []string{"2 sampled", "4 sampled"},
+		},
+		{
+			name: "priority queue",
+			run: func(ctx context.Context, t *testing.T, _ *pipelinetest.FakeClock) {
+				in := make(chan int)
+				out := pipeline.PriorityQueue(ctx, in, func(v int) int { return v }, 1, pipeline.OverflowDropLowest)
+				in <- 2
+				in <- 1
+				in <- 3
+				close(in)
+				pipelinetest.Collect(t, out)
+			},
+			want: []string{"1 overflow", "2 overflow"},
+		},
+		{
+			name: "throttle",
+			run: func(ctx context.Context, t *testing.T, _ *pipelinetest.FakeClock) {
+				in := make(chan int)
+				out := pipeline.Throttle(ctx, in, time.Minute, pipeline.ThrottleDrop)
+				in <- 1
+				pipelinetest.Receive(t, out)
+				in <- 2
+				close(in)
+				pipelinetest.Collect(t, out)
+			},
+			want: []string{"2 throttled"},
+		},
+		{
+			name: "join",
+			run: func(ctx context.Context, t *testing.T, clock *pipelinetest.FakeClock) {
+				left, right := make(chan int), make(chan int)
+				key := func(v int) int { return v }
+				out := pipeline.Join(ctx, left, right, key, key, time.Minute)
+				left <- 1
+				clock.WaitForTimers(1)
+				clock.Advance(30 * time.Second)
+				left <- 2
+				clock.Advance(30 * time.Second)
+				// 1 has expired once the timer is set again for 2
+				clock.WaitForTimers(1)
+				close(left)
+				close(right)
+				pipelinetest.Collect(t, out)
+			},
+			want: []string{"1 expired"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, clock := fakeContext(t)
+			d := &drops{}
+
+			tt.run(pipeline.WithDropHook(ctx, d.hook), t, clock)
+			if got := d.get(); !slices.Equal(got, tt.want) {
+				t.Errorf("dropped %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import "context"
+
+// ChanSource returns a Source reading the values sent on ch, for producers
+// that already hand their output to a channel, until ch is closed.
+//
+// The pipeline reads ch only as fast as its first step takes values, so a
+// producer sending on an unbuffered ch blocks until the pipeline is ready,
+// and one with a buffer does once the buffer is full; nothing is dropped.
+// Once the pipeline is drained or ctx is done it stops reading, leaving
+// whatever is still in ch, so the producer must have a way of its own to
+// stop, e.g. the same ctx, rather than block on ch forever.
+func ChanSource[T any](ch <-chan T) Source[T] {
+	return ItemSource(ch, func(v T) (T, error) { return v, nil })
+}
+
+// ItemSource returns a Source reading the items sent on items until it is
+// closed, split into a value or an error by split, for streams whose
+// failures come down the same channel as their values, as with ReactiveX
+// libraries. An RxGo Observable is read through the channel Observe
+// returns:
+//
+//	source := pipeline.ItemSource(observable.Observe(), func(item rxgo.Item) (Order, error) {
+//		if item.E != nil {
+//			return Order{}, item.E
+//		}
+//		return item.V.(Order), nil
+//	})
+//
+// An error is handled by the pipeline like any failed value, as a
+// *StageError of the stage "source", see GeneratorSource, and the items
+// after it are still read, so a stream ending on its first error has to
+// close items itself, as RxGo's do. Backpressure and stopping are as for
+// ChanSource; an Observable stops once the context it was observed with,
+// see rxgo.WithContext, is done.
+func ItemSource[I any, T any](items <-chan I, split func(I) (T, error)) Source[T] {
+	return func(ctx context.Context) (<-chan T, error) {
+		report := sourceErrors(ctx)
+
+		outChannel := make(chan T)
+		go func() {
+			defer close(outChannel)
+			for {
+				var item I
+				var ok bool
+				select {
+				case <-ctx.Done():
+					return
+				case item, ok = <-items:
+					if !ok {
+						return
+					}
+				}
+
+				v, err := split(item)
+				if err != nil {
+					report(err)
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- v:
+				}
+			}
+		}()
+
+		return outChannel, nil
+	}
+}
+
+// ChanSink returns a Sink handler sending every value to out, for consumers
+// that read their input from a channel:
+//
+//	out := make(chan Order)
+//	go func() {
+//		defer close(out)
+//		errs <- pipeline.New(source).Then(enrich).Sink(pipeline.ChanSink(ctx, out)).Run(ctx)
+//	}()
+//	for order := range out {
+//		...
+//	}
+//
+// A value is only handled once it has been received, so a consumer reading
+// out slowly slows the pipeline down to its pace, as Block does for a step,
+// and one that stops reading stalls it; nothing is buffered beyond out's
+// own buffer or dropped. Once ctx is done the value being sent fails with
+// ctx's cause, so a consumer that gives up should cancel ctx. out is left
+// for the caller to close, once Run has returned.
+func ChanSink[T any](ctx context.Context, out chan<- T) func(T) error {
+	return ItemSink(ctx, out, func(v T) T { return v })
+}
+
+// ItemSink is ChanSink for consumers reading items rather than bare values,
+// each made by item, as with ReactiveX libraries. An RxGo Observable is
+// made from the channel, with an error item for a failed run:
+//
+//	items := make(chan rxgo.Item)
+//	go func() {
+//		defer close(items)
+//		err := p.Sink(pipeline.ItemSink(ctx, items, func(o Order) rxgo.Item { return rxgo.Of(o) })).Run(ctx)
+//		if err != nil {
+//			items <- rxgo.Error(err)
+//		}
+//	}()
+//	observable := rxgo.FromChannel(items)
+//
+// Backpressure is as for ChanSink: the pipeline goes no faster than the
+// items are received.
+func ItemSink[T any, I any](ctx context.Context, out chan<- I, item func(T) I) func(T) error {
+	return func(v T) error {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case out <- item(v):
+			return nil
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// item is shaped like the items of ReactiveX libraries.
+type item struct {
+	V any
+	E error
+}
+
+func splitItem(i item) (int, error) {
+	if i.E != nil {
+		return 0, i.E
+	}
+	return i.V.(int), nil
+}
+
+func TestInteropSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		source func(ctx context.Context) pipeline.Source[int]
+		want   []int
+		// failed are the errors the source reported
+		failed []error
+	}{
+		{
+			name: "channel",
+			source: func(ctx context.Context) pipeline.Source[int] {
+				return pipeline.ChanSource(pipeline.FromSlice(ctx, []int{1, 2, 3}))
+			},
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "buffered channel",
+			source: func(context.Context) pipeline.Source[int] {
+				ch := make(chan int, 3)
+				ch <- 1
+				ch <- 2
+				close(ch)
+				return pipeline.ChanSource(ch)
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "items",
+			source: func(ctx context.Context) pipeline.Source[int] {
+				items := pipeline.FromSlice(ctx, []item{{V: 1}, {E: errBad}, {V: 2}})
+				return pipeline.ItemSource(items, splitItem)
+			},
+			want:   []int{1, 2},
+			failed: []error{errBad},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var mu sync.Mutex
+			var got []int
+			var failed []error
+			err := pipeline.New(tt.source(ctx)).
+				Sink(func(v int) error {
+					mu.Lock()
+					defer mu.Unlock()
+					got = append(got, v)
+					return nil
+				}).
+				DeadLetter(func(err *pipeline.StageError) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if err.Stage != "source" {
+						t.Errorf("failure of %q, want the source's", err.Stage)
+					}
+					failed = append(failed, err.Err)
+					return nil
+				}).
+				Run(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.want) || !slices.Equal(failed, tt.failed) {
+				t.Errorf("got %v and failures %v, want %v and %v", got, failed, tt.want, tt.failed)
+			}
+		})
+	}
+}
+
+func TestChanSourceStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a producer that never closes its channel is left behind once the
+	// pipeline is done with it
+	ch := make(chan int)
+	produced := make(chan struct{})
+	go func() {
+		defer close(produced)
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- i:
+			}
+		}
+	}()
+
+	err := pipeline.New(pipeline.ChanSource(ch)).
+		Sink(func(v int) error {
+			if v == 3 {
+				cancel()
+			}
+			return nil
+		}).
+		Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v, want it cancelled", err)
+	}
+	<-produced
+}
+
+func TestInteropSinks(t *testing.T) {
+	tests := []struct {
+		name string
+		// sink sends the pipeline's values on to a consumer reading n of them
+		sink func(ctx context.Context, n int) (func(int) error, func() []int)
+	}{
+		{
+			name: "channel",
+			sink: func(ctx context.Context, n int) (func(int) error, func() []int) {
+				out := make(chan int)
+				got := make(chan []int)
+				go func() {
+					var values []int
+					for range n {
+						values = append(values, <-out)
+					}
+					got <- values
+				}()
+				return pipeline.ChanSink(ctx, out), func() []int { return <-got }
+			},
+		},
+		{
+			name: "items",
+			sink: func(ctx context.Context, n int) (func(int) error, func() []int) {
+				out := make(chan item, 1)
+				got := make(chan []int)
+				go func() {
+					var values []int
+					for range n {
+						i := <-out
+						values = append(values, i.V.(int))
+					}
+					got <- values
+				}()
+				return pipeline.ItemSink(ctx, out, func(v int) item { return item{V: v} }), func() []int { return <-got }
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+
+			// the consumer reads 3 values, then stops, stalling the sink
+			// until it gives up
+			sink, received := tt.sink(ctx, 3)
+			values := []int{1, 2, 3, 4, 5}
+			errs := make(chan error)
+			go func() {
+				errs <- pipeline.New(pipeline.SliceSource(values)).Sink(sink).Run(ctx)
+			}()
+
+			if got := received(); !slices.Equal(got, values[:3]) {
+				t.Errorf("consumer got %v, want %v", got, values[:3])
+			}
+			cancel(errBad)
+			if err := <-errs; !errors.Is(err, errBad) {
+				t.Errorf("Run = %v, want the consumer's cause", err)
+			}
+		})
+	}
+}
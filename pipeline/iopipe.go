@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// FromReader emits the tokens read from r, split by split, so files, stdin and
+// network streams can be pipeline sources. A nil split reads lines, as
+// bufio.ScanLines does. A read error, including a token longer than
+// bufio.MaxScanTokenSize, is sent on the returned error channel, after which
+// both channels are closed, as they are at the end of r or once ctx is done.
+//
+// A Read that blocks can't be interrupted by ctx; close r to unblock it.
+func FromReader(ctx context.Context, r io.Reader, split bufio.SplitFunc) (<-chan string, <-chan error) {
+	scanner := bufio.NewScanner(r)
+	if split != nil {
+		scanner.Split(split)
+	}
+
+	return FromFunc(ctx, func() (string, bool, error) {
+		if scanner.Scan() {
+			return scanner.Text(), true, nil
+		}
+
+		// Err is nil at the end of r
+		return "", false, scanner.Err()
+	})
+}
+
+// ToReader exposes a stream of byte chunks as an io.ReadCloser, so pipeline
+// output can be handed to anything that reads: HTTP bodies, exec stdin,
+// archive writers and so on.
+//
+// Reads block until the next chunk arrives. The reader returns io.EOF once in
+// is closed, or the context's error if ctx is done first. Closing the reader
+// early stops the goroutine draining in.
+func ToReader(ctx context.Context, in <-chan []byte) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					pw.Close()
+					return
+				}
+				// Write only fails once the read side has been closed
+				if _, err := pw.Write(chunk); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return pr
+}
+
+// FromWriter returns an io.WriteCloser whose written bytes come out of the
+// returned channel as chunks of at most chunkSize bytes, so anything that
+// writes (exec stdout, io.Copy, encoders) can feed a pipeline.
+//
+// Writes block until the pipeline has taken the data. Closing the writer
+// closes the channel once the remaining bytes have been emitted; if ctx is
+// done first, pending and future writes fail with the context's error.
+// A chunkSize of zero or less uses 32KiB chunks.
+func FromWriter(ctx context.Context, chunkSize int) (io.WriteCloser, <-chan []byte) {
+	if chunkSize <= 0 {
+		chunkSize = 32 * 1024
+	}
+
+	pr, pw := io.Pipe()
+	outChannel := make(chan []byte)
+	done := make(chan struct{})
+
+	// a blocked Read won't notice cancellation on its own
+	go func() {
+		select {
+		case <-ctx.Done():
+			pr.CloseWithError(ctx.Err())
+		case <-done:
+		}
+	}()
+
+	go func() {
+		defer close(outChannel)
+		defer close(done)
+
+		for {
+			// each chunk gets its own buffer since downstream stages may hold on to it
+			buf := make([]byte, chunkSize)
+			n, err := pr.Read(buf)
+			if n > 0 {
+				select {
+				case <-ctx.Done():
+					pr.CloseWithError(ctx.Err())
+					return
+				case outChannel <- buf[:n]:
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return pw, outChannel
+}
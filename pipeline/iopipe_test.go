@@ -0,0 +1,184 @@
+package pipeline_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// collectBoth reads values and errs together, as a source with an error
+// channel has to be read, until both are closed.
+func collectBoth[T any](t *testing.T, values <-chan T, errs <-chan error) ([]T, []error) {
+	t.Helper()
+
+	failures := make(chan []error)
+	go func() {
+		var got []error
+		for err := range errs {
+			got = append(got, err)
+		}
+		failures <- got
+	}()
+
+	return pipelinetest.Collect(t, values), <-failures
+}
+
+// xLines reads as the line "x" over and over.
+type xLines struct{}
+
+func (xLines) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = "x\n"[i%2]
+	}
+	return len(p) / 2 * 2, nil
+}
+
+func TestFromReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       io.Reader
+		split   bufio.SplitFunc
+		want    []string
+		wantErr error
+	}{
+		{name: "lines", r: strings.NewReader("a b\nc\n\nd"), want: []string{"a b", "c", "", "d"}},
+		{name: "words", r: strings.NewReader("a b\nc\n\nd"), split: bufio.ScanWords, want: []string{"a", "b", "c", "d"}},
+		{
+			name:    "read error",
+			r:       io.MultiReader(strings.NewReader("a\n"), iotest.ErrReader(errBad)),
+			want:    []string{"a"},
+			wantErr: errBad,
+		},
+		{
+			name:    "line too long",
+			r:       strings.NewReader("a\n" + strings.Repeat("x", bufio.MaxScanTokenSize) + "\nb\n"),
+			want:    []string{"a"},
+			wantErr: bufio.ErrTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			lines, errs := pipeline.FromReader(context.Background(), tt.r, tt.split)
+			got, failures := collectBoth(t, lines, errs)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			switch {
+			case tt.wantErr == nil && len(failures) > 0:
+				t.Errorf("got errors %v, want none", failures)
+			case tt.wantErr != nil && (len(failures) != 1 || !errors.Is(failures[0], tt.wantErr)):
+				t.Errorf("got errors %v, want %v", failures, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFromReaderCancelled(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, errs := pipeline.FromReader(ctx, xLines{}, nil)
+	if got := pipelinetest.Receive(t, lines); got != "x" {
+		t.Errorf("got %q, want %q", got, "x")
+	}
+
+	cancel()
+	pipelinetest.Collect(t, lines)
+	if failures := pipelinetest.Collect(t, errs); len(failures) != 0 {
+		t.Errorf("got errors %v after cancelling, want none", failures)
+	}
+}
+
+func TestToReader(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	r := pipeline.ToReader(context.Background(), waiting([]byte("ab"), []byte("cd")))
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "abcd" {
+		t.Errorf("read %q, %v, want %q", got, err, "abcd")
+	}
+}
+
+func TestToReaderCancelled(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan []byte)
+	r := pipeline.ToReader(ctx, in)
+	in <- []byte("ab")
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, err := r.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read after cancelling = %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestToReaderClosed checks closing the reader stops the goroutine draining
+// in once the next chunk comes.
+func TestToReaderClosed(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	in := make(chan []byte)
+	r := pipeline.ToReader(context.Background(), in)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	in <- []byte("ab")
+
+	if _, err := r.Read(make([]byte, 2)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Read after closing = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestFromWriter(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	w, out := pipeline.FromWriter(context.Background(), 4)
+	go func() {
+		// the reads of the chunks split a single write
+		io.WriteString(w, "abcdefghij")
+		w.Close()
+	}()
+
+	var got []string
+	for _, chunk := range pipelinetest.Collect(t, out) {
+		got = append(got, string(chunk))
+	}
+	if want := []string{"abcd", "efgh", "ij"}; !slices.Equal(got, want) {
+		t.Errorf("got chunks %q, want %q", got, want)
+	}
+}
+
+func TestFromWriterCancelled(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, out := pipeline.FromWriter(ctx, 0)
+	go io.WriteString(w, "ab")
+	if got := pipelinetest.Receive(t, out); string(got) != "ab" {
+		t.Errorf("got %q, want %q", got, "ab")
+	}
+
+	cancel()
+	if chunks := pipelinetest.Collect(t, out); len(chunks) != 0 {
+		t.Errorf("got %q after cancelling, want nothing", chunks)
+	}
+	if _, err := io.WriteString(w, "cd"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Write after cancelling = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// Join matches values from left and right by key, e.g. to enrich events with
+// the records they refer to. A value waits until a value with the same key
+// arrives on the other side, and the two are emitted together as a Pair.
+// Values with equal keys on the same side are matched in arrival order, one
+// to one.
+//
+// A value left unmatched for ttl is dropped, so keys that never show up on
+// the other side don't pile up, and handed to the hook of WithDropHook as
+// DroppedExpired; a ttl of zero or less keeps them until the end. The output
+// is closed once both inputs are closed or ctx is done.
+func Join[L any, R any, K comparable](
+	ctx context.Context,
+	left <-chan L,
+	right <-chan R,
+	leftKey func(L) K,
+	rightKey func(R) K,
+	ttl time.Duration,
+) <-chan Pair[L, R] {
+	outChannel := make(chan Pair[L, R])
+
+	go func() {
+		defer close(outChannel)
+
+		lefts := make(map[K][]timed[L])
+		rights := make(map[K][]timed[R])
+		var expiries deadlineHeap[joinKey[K]]
+
+		clock := ClockFrom(ctx)
+		drop := dropHook(ctx)
+		timer := clock.NewTimer(ttl)
+		timer.Stop()
+		defer timer.Stop()
+
+		track := func(k K, isLeft bool, at time.Time) {
+			if ttl <= 0 {
+				return
+			}
+			wasEmpty := expiries.Len() == 0
+			expiries.push(deadline[joinKey[K]]{at: at.Add(ttl), key: joinKey[K]{key: k, left: isLeft}})
+			if wasEmpty {
+				timer.Reset(ttl)
+			}
+		}
+
+		expire := func(now time.Time) {
+			for expiries.Len() > 0 && !expiries.peek().at.After(now) {
+				k := expiries.pop().key
+				// entries for matched values are stale, dropping from the
+				// front only removes values that have really waited ttl
+				if k.left {
+					lefts[k.key] = dropExpired(lefts[k.key], now.Add(-ttl), drop)
+					if len(lefts[k.key]) == 0 {
+						delete(lefts, k.key)
+					}
+				} else {
+					rights[k.key] = dropExpired(rights[k.key], now.Add(-ttl), drop)
+					if len(rights[k.key]) == 0 {
+						delete(rights, k.key)
+					}
+				}
+			}
+			if expiries.Len() > 0 {
+				timer.Reset(expiries.peek().at.Sub(clock.Now()))
+			}
+		}
+
+		send := func(p Pair[L, R]) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case outChannel <- p:
+				return true
+			}
+		}
+
+		for left != nil || right != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-timer.C():
+				expire(now)
+			case l, ok := <-left:
+				if !ok {
+					left = nil
+					continue
+				}
+
+				k := leftKey(l)
+				if waiting := rights[k]; len(waiting) > 0 {
+					rights[k] = waiting[1:]
+					if len(rights[k]) == 0 {
+						delete(rights, k)
+					}
+					if !send(Pair[L, R]{First: l, Second: waiting[0].v}) {
+						return
+					}
+					continue
+				}
+
+				now := clock.Now()
+				lefts[k] = append(lefts[k], timed[L]{at: now, v: l})
+				track(k, true, now)
+			case r, ok := <-right:
+				if !ok {
+					right = nil
+					continue
+				}
+
+				k := rightKey(r)
+				if waiting := lefts[k]; len(waiting) > 0 {
+					lefts[k] = waiting[1:]
+					if len(lefts[k]) == 0 {
+						delete(lefts, k)
+					}
+					if !send(Pair[L, R]{First: waiting[0].v, Second: r}) {
+						return
+					}
+					continue
+				}
+
+				now := clock.Now()
+				rights[k] = append(rights[k], timed[R]{at: now, v: r})
+				track(k, false, now)
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+type joinKey[K comparable] struct {
+	key  K
+	left bool
+}
+
+type timed[T any] struct {
+	at time.Time
+	v  T
+}
+
+// dropExpired removes the values at the front of queue that arrived at or
+// before cutoff, handing them to drop. Queues are in arrival order, so it
+// stops at the first newer one.
+func dropExpired[T any](queue []timed[T], cutoff time.Time, drop func(any, DropReason)) []timed[T] {
+	i := 0
+	for i < len(queue) && !queue[i].at.After(cutoff) {
+		drop(queue[i].v, DroppedExpired)
+		i++
+	}
+
+	return queue[i:]
+}
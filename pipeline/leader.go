@@ -0,0 +1,104 @@
+package pipeline
+
+import "context"
+
+// Elector elects one of the instances of a pipeline its leader, e.g.
+// pipelineredis.Leader.
+type Elector interface {
+	// Campaign waits for the instance to be elected, trying again past
+	// failures, and returns a channel closed once it is no longer the
+	// leader: once it lost the election, or resigned, which it does once
+	// ctx is done. It returns ctx's error if ctx is done first.
+	Campaign(ctx context.Context) (lost <-chan struct{}, err error)
+}
+
+// LeaderSource returns a Source running source only on the instance elected
+// leader among the replicas of a pipeline, for sources that must only run
+// once at a time, such as cron triggers, while the replicas are there to
+// take over:
+//
+//	leader := pipelineredis.NewLeader(client, "nightly-export", hostname, 10*time.Second)
+//	p := pipeline.New(pipeline.LeaderSource(leader, pipeline.CronSource(schedule)))
+//
+// The replicas that aren't leader emit nothing and wait to be elected. The
+// leader stops source as soon as it learns it lost the election, discarding
+// what source still emits, and campaigns again. The output channel is closed
+// once ctx is done, once source fails to open on the leader, the error being
+// handled by the pipeline like any failed value, as a *StageError of the
+// stage "source", or once source finishes on the leader, which then resigns.
+//
+// A replica elected after that runs source again from the start, nothing
+// tells the others it already finished. A finite source, such as a full
+// table scan, must therefore either pick up where the last leader left off,
+// e.g. from a checkpoint, or the replicas be stopped once one of them
+// finished it.
+func LeaderSource[T any](elector Elector, source Source[T]) Source[T] {
+	return func(ctx context.Context) (<-chan T, error) {
+		report := sourceErrors(ctx)
+
+		out := make(chan T)
+		go func() {
+			defer close(out)
+			for {
+				finished, err := lead(ctx, elector, source, out)
+				if err != nil && ctx.Err() == nil {
+					report(err)
+				}
+				if err != nil || finished {
+					return
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+// lead waits to be elected and runs source for as long as the instance is
+// the leader, reporting whether source finished. It returns an error once
+// ctx is done or if source fails to open, having resigned.
+func lead[T any](ctx context.Context, elector Elector, source Source[T], out chan<- T) (finished bool, err error) {
+	term, resign := context.WithCancel(ctx)
+	defer resign()
+
+	lost, err := elector.Campaign(term)
+	if err != nil {
+		return false, err
+	}
+	// resigning and waiting for it keeps the terms of the instance apart
+	defer func() {
+		resign()
+		<-lost
+	}()
+
+	values, err := source(term)
+	if err != nil {
+		return false, err
+	}
+	// source stops with the term, don't leave it blocked on a send
+	defer func() {
+		resign()
+		for range values {
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-lost:
+			return false, nil
+		case v, ok := <-values:
+			if !ok {
+				return true, nil
+			}
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-lost:
+				return false, nil
+			case out <- v:
+			}
+		}
+	}
+}
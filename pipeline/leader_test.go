@@ -0,0 +1,191 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// elector is an Elector the test elects and deposes the instance of.
+type elector struct {
+	elect     chan chan struct{}
+	campaigns atomic.Int32
+	resigns   atomic.Int32
+}
+
+func newElector() *elector {
+	return &elector{elect: make(chan chan struct{})}
+}
+
+func (e *elector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	e.campaigns.Add(1)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case depose := <-e.elect:
+		lost := make(chan struct{})
+		go func() {
+			defer close(lost)
+			select {
+			case <-ctx.Done():
+				e.resigns.Add(1)
+			case <-depose:
+			}
+		}()
+		return lost, nil
+	}
+}
+
+// win elects the instance, returning a func deposing it.
+func (e *elector) win(t *testing.T) func() {
+	t.Helper()
+
+	depose := make(chan struct{})
+	select {
+	case e.elect <- depose:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not campaigning")
+	}
+	return func() { close(depose) }
+}
+
+// counter is a source counting up until it is stopped, keeping track of
+// whether it runs.
+type counter struct {
+	running atomic.Int32
+	opened  atomic.Int32
+}
+
+func (c *counter) source(ctx context.Context) (<-chan int, error) {
+	c.opened.Add(1)
+	c.running.Add(1)
+	out := make(chan int)
+	go func() {
+		defer c.running.Add(-1)
+		defer close(out)
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- i:
+			}
+		}
+	}()
+	return out, nil
+}
+
+func TestLeaderSource(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := newElector()
+	c := &counter{}
+	out, err := pipeline.LeaderSource(e, c.source)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a replica that isn't leader emits nothing
+	assertNothing(t, out)
+	if c.opened.Load() != 0 {
+		t.Fatal("source opened before being elected")
+	}
+
+	depose := e.win(t)
+	if got := pipelinetest.Receive(t, out); got != 0 {
+		t.Errorf("got %d, want 0", got)
+	}
+
+	// losing the election stops the source, winning again starts it over
+	depose()
+	waitFor(t, "source stopped", func() bool { return c.running.Load() == 0 })
+	drain(out)
+	assertNothing(t, out)
+
+	e.win(t)
+	if got := pipelinetest.Receive(t, out); got != 0 {
+		t.Errorf("after being elected again got %d, want the source started over at 0", got)
+	}
+	if got := c.opened.Load(); got != 2 {
+		t.Errorf("source opened %d times, want 2", got)
+	}
+
+	cancel()
+	pipelinetest.Collect(t, out)
+	if got := e.resigns.Load(); got != 1 {
+		t.Errorf("resigned %d times, want once when ctx was done", got)
+	}
+}
+
+// drain reads what out has ready.
+func drain[T any](out <-chan T) {
+	for {
+		select {
+		case <-out:
+		case <-time.After(20 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// TestLeaderSourceFinishes has a finite source finish on the leader, after
+// which a replica elected next runs it again from the start.
+func TestLeaderSourceFinishes(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	e := newElector()
+	source := pipeline.LeaderSource(e, pipeline.SliceSource([]int{1, 2, 3}))
+	first, err := source(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.win(t)
+	if got := pipelinetest.Collect(t, first); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("got %v, want [1 2 3]", got)
+	}
+	if got := e.resigns.Load(); got != 1 {
+		t.Errorf("resigned %d times, want once the source finished", got)
+	}
+
+	second, err := source(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.win(t)
+	if got := pipelinetest.Collect(t, second); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("the next leader got %v, want [1 2 3] again", got)
+	}
+}
+
+func TestLeaderSourceOpenFails(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	e := newElector()
+	failing := func(ctx context.Context) (<-chan int, error) { return nil, errBad }
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(pipeline.LeaderSource(e, failing)).Run(context.Background())
+	}()
+
+	// it resigns and the run fails rather than campaigning again
+	e.win(t)
+	err := <-done
+	var stageErr *pipeline.StageError
+	if !errors.Is(err, errBad) || !errors.As(err, &stageErr) || stageErr.Stage != "source" {
+		t.Errorf("Run returned %v, want %v from the source", err, errBad)
+	}
+	if got := e.resigns.Load(); got != 1 {
+		t.Errorf("resigned %d times, want once", got)
+	}
+	if got := e.campaigns.Load(); got != 1 {
+		t.Errorf("campaigned %d times, want once", got)
+	}
+}
@@ -0,0 +1,103 @@
+package pipeline_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// failOnce fails the first call on every value, so a step retrying it logs
+// "retrying" at debug level once per value.
+func failOnce() func(int) (int, error) {
+	var tried sync.Map
+	return func(v int) (int, error) {
+		if _, ok := tried.LoadOrStore(v, true); !ok {
+			return 0, errBad
+		}
+		return v, nil
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelDebug)
+
+	retry := pipeline.WithRetry(2, pipeline.ConstantBackoff(0))
+	err := pipeline.New(pipeline.SliceSource([]int{1, 2})).
+		Then(failOnce(), retry).
+		Then(failOnce(), retry, pipeline.WithName("noisy"), pipeline.WithLogLevel(level)).
+		Then(failOnce(), retry, pipeline.WithName("quiet")).
+		Logger(logger.With("pipeline", "orders")).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var retries []string
+	for _, line := range out.lines() {
+		if strings.Contains(line, `msg=retrying`) {
+			retries = append(retries, line)
+		}
+	}
+	if len(retries) != 2 {
+		t.Fatalf("got retries logged %q, want only the two of the noisy step", retries)
+	}
+	for _, line := range retries {
+		if !strings.Contains(line, "pipeline=orders stage=noisy") {
+			t.Errorf("got %q, want the pipeline and stage attributes", line)
+		}
+	}
+}
+
+func TestLogLevelTurnedDown(t *testing.T) {
+	tests := []struct {
+		name  string
+		level slog.Level
+		want  int
+	}{
+		{name: "debug", level: slog.LevelDebug, want: 3},
+		{name: "info", level: slog.LevelInfo, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out syncBuffer
+			logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			pipelinetest.RunStage(t, failOnce(), []int{1, 2, 3},
+				pipeline.WithRetry(2, pipeline.ConstantBackoff(0)),
+				pipeline.WithLogger(logger),
+				pipeline.WithLogLevel(tt.level))
+
+			got := strings.Count(strings.Join(out.lines(), "\n"), "msg=retrying")
+			if got != tt.want {
+				t.Errorf("got %d retries logged, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnnamedStepLogs(t *testing.T) {
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	err := pipeline.New(pipeline.SliceSource([]int{1})).
+		Then(func(v int) (int, error) { return v, nil }).
+		Then(failOnce(), pipeline.WithRetry(2, pipeline.ConstantBackoff(0))).
+		Logger(logger).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.lines(); len(got) != 1 || !strings.Contains(got[0], `stage="step 2"`) {
+		t.Errorf("got %q, want the retry logged under its step's label", got)
+	}
+}
@@ -0,0 +1,576 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+)
+
+// ErrUnknownPipeline is returned by a Manager asked about a name it has no
+// pipeline for.
+var ErrUnknownPipeline = errors.New("pipeline: unknown pipeline")
+
+// ErrPipelineExists is returned by Manager.Add for a name already taken.
+var ErrPipelineExists = errors.New("pipeline: pipeline already exists")
+
+// ErrNotPausable is returned by Manager.Pause and Manager.Resume for a
+// pipeline that can't be paused, such as a Graph.
+var ErrNotPausable = errors.New("pipeline: pipeline can't be paused")
+
+// Runnable is a pipeline a Manager can run, as every *Pipeline is.
+type Runnable interface {
+	Run(ctx context.Context) error
+	Drain(ctx context.Context) error
+	Status() Status
+	Stats() Stats
+}
+
+var _ Runnable = (*Pipeline[any])(nil)
+
+// pauser is implemented by the pipelines that can be paused, as every
+// *Pipeline can.
+type pauser interface {
+	Pause()
+	Resume()
+}
+
+// sharer is implemented by the pipelines that can take a Manager's shared
+// limits.
+type sharer interface {
+	share(limits *sharedLimits)
+}
+
+// sharedLimits bound the calls of every step they are given to together,
+// on top of each step's own limits.
+type sharedLimits struct {
+	workers *semaphore.Weighted
+	limiter *rate.Limiter
+	// parent are the limits these are nested in, such as the Manager's
+	// for those of a Template, nil if none
+	parent *sharedLimits
+}
+
+// acquire waits for the limits, then those they are nested in, to let a
+// call through, returning the func that hands back what it took.
+func (l *sharedLimits) acquire(ctx context.Context) (func(), error) {
+	if l.limiter != nil {
+		if err := l.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	release := func() {}
+	if l.workers != nil {
+		if err := l.workers.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+		release = func() { l.workers.Release(1) }
+	}
+	if l.parent == nil {
+		return release, nil
+	}
+
+	releaseParent, err := l.parent.acquire(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return func() {
+		releaseParent()
+		release()
+	}, nil
+}
+
+// empty reports whether the limits don't limit anything.
+func (l *sharedLimits) empty() bool {
+	return l == nil || l.workers == nil && l.limiter == nil && l.parent.empty()
+}
+
+// ManagerOption configures a Manager.
+type ManagerOption func(*sharedLimits)
+
+// WithWorkerBudget lets the steps of all of a Manager's pipelines run at
+// most n calls at a time between them, whatever their own concurrency, so
+// one busy flow can't starve the others of CPU or connections. A step
+// waiting for the budget holds its own worker meanwhile.
+func WithWorkerBudget(n int) ManagerOption {
+	return func(l *sharedLimits) {
+		l.workers = semaphore.NewWeighted(int64(max(n, 1)))
+	}
+}
+
+// WithSharedRateLimit throttles the calls of all of a Manager's pipelines'
+// steps together to r per second with bursts of up to burst, e.g. for an
+// API quota they all draw on, see WithRateLimit. A burst below 1 is taken
+// as 1.
+func WithSharedRateLimit(r rate.Limit, burst int) ManagerOption {
+	return func(l *sharedLimits) {
+		l.limiter = rate.NewLimiter(r, max(burst, 1))
+	}
+}
+
+// Manager owns several named pipelines, e.g. the ingestion flows of one
+// service, starting and stopping them individually and sharing limits
+// between them:
+//
+//	m := pipeline.NewManager(ctx, pipeline.WithWorkerBudget(32))
+//	if err := m.Add("orders", orders); err != nil {
+//		return err
+//	}
+//	if err := m.Start("orders"); err != nil {
+//		return err
+//	}
+//	...
+//	err := m.Swap(ctx, "orders", ordersV2)
+//	...
+//	err = m.Shutdown(ctx)
+//
+// A Manager is safe for concurrent use.
+type Manager struct {
+	ctx    context.Context
+	limits *sharedLimits
+
+	// ops serializes starting and stopping, mu guards pipelines
+	ops       sync.Mutex
+	mu        sync.Mutex
+	pipelines map[string]*managed
+}
+
+// managed is a pipeline of a Manager and its latest run.
+type managed struct {
+	r Runnable
+	// version is the version of the definition r was built from, see
+	// WithVersion
+	version string
+	// limits are the shared limits r is subject to, the Manager's unless
+	// it is an instance of a Template
+	limits *sharedLimits
+	// done is closed once the latest run has returned, nil if it was never
+	// started
+	done   chan struct{}
+	cancel context.CancelFunc
+	err    error
+}
+
+func (e *managed) running() bool {
+	if e.done == nil {
+		return false
+	}
+
+	select {
+	case <-e.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// NewManager returns a Manager running its pipelines with ctx, cancelling
+// it stops them all.
+func NewManager(ctx context.Context, opts ...ManagerOption) *Manager {
+	limits := &sharedLimits{}
+	for _, opt := range opts {
+		opt(limits)
+	}
+
+	return &Manager{ctx: ctx, limits: limits, pipelines: make(map[string]*managed)}
+}
+
+// Add hands r to the Manager under name without starting it. A *Pipeline
+// is subject to the Manager's shared limits from then on.
+func (m *Manager) Add(name string, r Runnable) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.add(name, r, m.limits)
+}
+
+// add adds r under name subject to limits. It must be called with mu held.
+func (m *Manager) add(name string, r Runnable, limits *sharedLimits) error {
+	if _, ok := m.pipelines[name]; ok {
+		return fmt.Errorf("%w: %s", ErrPipelineExists, name)
+	}
+	adopt(r, limits)
+	m.pipelines[name] = &managed{r: r, limits: limits}
+	return nil
+}
+
+// Start runs the pipeline called name in a goroutine of its own. It returns
+// ErrRunning if the pipeline is already running; how its last run ended is
+// kept for Err.
+func (m *Manager) Start(name string) error {
+	m.ops.Lock()
+	defer m.ops.Unlock()
+
+	e, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	return m.start(e)
+}
+
+// Stop drains the pipeline called name, see Pipeline.Drain, and waits for
+// it to return. It returns nil if the pipeline isn't running.
+func (m *Manager) Stop(ctx context.Context, name string) error {
+	m.ops.Lock()
+	defer m.ops.Unlock()
+
+	e, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	return stop(ctx, e)
+}
+
+// SwapOption configures a Manager.Swap.
+type SwapOption func(*swapConfig)
+
+type swapConfig struct {
+	version string
+	overlap time.Duration
+	compare func(old, next Stats)
+}
+
+// WithVersion records v as the version of the definition the replacement
+// was built from, for Version.
+func WithVersion(v string) SwapOption {
+	return func(cfg *swapConfig) {
+		cfg.version = v
+	}
+}
+
+// WithOverlap starts the replacement of a running pipeline before the old
+// one is drained and runs both for d, e.g. to try a new version of a flow
+// reading from a consumer group alongside the old one, then calls compare,
+// if not nil, with the Stats of both before draining the old one.
+func WithOverlap(d time.Duration, compare func(old, next Stats)) SwapOption {
+	return func(cfg *swapConfig) {
+		cfg.overlap = d
+		cfg.compare = compare
+	}
+}
+
+// Swap replaces the pipeline called name with next, e.g. to roll out a new
+// version of a flow without restarting the service. A pipeline that is
+// running is drained first, so the two never run at once and next, if it
+// checkpoints to the same place, carries on where the old one stopped; next
+// is then started in its place. If the drain fails the old pipeline stays.
+//
+// With WithOverlap next is started first instead and the old pipeline only
+// drained once the two have run together for a while; Swap returns once it
+// is, with the error draining it failed with, next running regardless.
+func (m *Manager) Swap(ctx context.Context, name string, next Runnable, opts ...SwapOption) error {
+	var cfg swapConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	m.ops.Lock()
+	defer m.ops.Unlock()
+
+	e, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	wasRunning := e.running()
+	if wasRunning && cfg.overlap > 0 {
+		return m.overlap(ctx, name, e, next, cfg)
+	}
+	if err := stop(ctx, e); err != nil {
+		return fmt.Errorf("pipeline: stopping %s: %w", name, err)
+	}
+
+	replaced := m.replace(name, e, next, cfg.version)
+	if !wasRunning {
+		return nil
+	}
+	return m.start(replaced)
+}
+
+// overlap swaps old, running, for next as set with WithOverlap. It must be
+// called with ops held.
+func (m *Manager) overlap(ctx context.Context, name string, old *managed, next Runnable, cfg swapConfig) error {
+	replaced := m.replace(name, old, next, cfg.version)
+	if err := m.start(replaced); err != nil {
+		return err
+	}
+
+	timer := ClockFrom(ctx).NewTimer(cfg.overlap)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+	case <-timer.C():
+		if cfg.compare != nil {
+			cfg.compare(old.r.Stats(), next.Stats())
+		}
+	}
+
+	if err := stop(ctx, old); err != nil {
+		return fmt.Errorf("pipeline: stopping the old %s: %w", name, err)
+	}
+	return nil
+}
+
+// replace makes next the pipeline called name in place of old.
+func (m *Manager) replace(name string, old *managed, next Runnable, version string) *managed {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	adopt(next, old.limits)
+	replaced := &managed{r: next, version: version, limits: old.limits}
+	m.pipelines[name] = replaced
+	return replaced
+}
+
+// Version returns the version the pipeline called name was last swapped in
+// with, see WithVersion, empty if it wasn't.
+func (m *Manager) Version(name string) (string, error) {
+	e, err := m.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return e.version, nil
+}
+
+// Pause pauses the pipeline called name, see Pipeline.Pause, returning
+// ErrNotPausable if it can't be.
+func (m *Manager) Pause(name string) error {
+	p, err := m.pauser(name)
+	if err != nil {
+		return err
+	}
+	p.Pause()
+	return nil
+}
+
+// Resume resumes the pipeline called name, see Pipeline.Resume, returning
+// ErrNotPausable if it can't be paused.
+func (m *Manager) Resume(name string) error {
+	p, err := m.pauser(name)
+	if err != nil {
+		return err
+	}
+	p.Resume()
+	return nil
+}
+
+func (m *Manager) pauser(name string) (pauser, error) {
+	e, err := m.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := e.r.(pauser)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotPausable, name)
+	}
+	return p, nil
+}
+
+// Remove stops the pipeline called name, as Stop does, and forgets it.
+func (m *Manager) Remove(ctx context.Context, name string) error {
+	m.ops.Lock()
+	defer m.ops.Unlock()
+
+	e, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	if err := stop(ctx, e); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.pipelines, name)
+	m.mu.Unlock()
+	return nil
+}
+
+// Names returns the names of the Manager's pipelines, sorted.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.pipelines))
+	for name := range m.pipelines {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Status returns the Status of every pipeline by name.
+func (m *Manager) Status() map[string]Status {
+	runnables := m.runnables()
+	statuses := make(map[string]Status, len(runnables))
+	for name, r := range runnables {
+		statuses[name] = r.Status()
+	}
+	return statuses
+}
+
+// Stats returns the Stats of every pipeline by name, for a service to
+// report on all its flows at once.
+func (m *Manager) Stats() map[string]Stats {
+	runnables := m.runnables()
+	stats := make(map[string]Stats, len(runnables))
+	for name, r := range runnables {
+		stats[name] = r.Stats()
+	}
+	return stats
+}
+
+// Err returns what the last run of the pipeline called name returned, nil
+// while it runs.
+func (m *Manager) Err(name string) error {
+	e, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return e.err
+}
+
+// Shutdown drains every running pipeline at once and waits for them, see
+// Stop, returning what went wrong by name.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.ops.Lock()
+	defer m.ops.Unlock()
+
+	m.mu.Lock()
+	running := make(map[string]*managed, len(m.pipelines))
+	for name, e := range m.pipelines {
+		running[name] = e
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(running))
+	var errsMu sync.Mutex
+	for name, e := range running {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stop(ctx, e); err != nil {
+				errsMu.Lock()
+				errs = append(errs, fmt.Errorf("pipeline: stopping %s: %w", name, err))
+				errsMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// runnables returns the Manager's pipelines by name, to be asked about
+// without holding mu.
+func (m *Manager) runnables() map[string]Runnable {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runnables := make(map[string]Runnable, len(m.pipelines))
+	for name, e := range m.pipelines {
+		runnables[name] = e.r
+	}
+	return runnables
+}
+
+func (m *Manager) lookup(name string) (*managed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.pipelines[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPipeline, name)
+	}
+	return e, nil
+}
+
+// adopt subjects r to limits, if it can take them.
+func adopt(r Runnable, limits *sharedLimits) {
+	if s, ok := r.(sharer); ok && !limits.empty() {
+		s.share(limits)
+	}
+}
+
+// start must be called with ops held.
+func (m *Manager) start(e *managed) error {
+	if e.running() {
+		return ErrRunning
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	done := make(chan struct{})
+	m.mu.Lock()
+	e.done, e.cancel, e.err = done, cancel, nil
+	m.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		err := e.r.Run(ctx)
+		m.mu.Lock()
+		e.err = err
+		m.mu.Unlock()
+	}()
+
+	return nil
+}
+
+// stopRetry is how long stop waits before draining again a pipeline that
+// hadn't got as far as running the first time.
+const stopRetry = 10 * time.Millisecond
+
+// stop drains e's run, if any, and waits for it to return, cancelling it
+// once ctx is done. It must be called with ops held.
+func stop(ctx context.Context, e *managed) error {
+	if !e.running() {
+		return nil
+	}
+
+	clock := ClockFrom(ctx)
+	for {
+		err := e.r.Drain(ctx)
+		if err != nil {
+			// Drain only cancels a run it found, make sure of it
+			e.cancel()
+			<-e.done
+			return err
+		}
+
+		// Drain returns straight away if Run hadn't started yet
+		timer := clock.NewTimer(stopRetry)
+		select {
+		case <-e.done:
+			timer.Stop()
+			return nil
+		case <-ctx.Done():
+			timer.Stop()
+			e.cancel()
+			<-e.done
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+func (p *Pipeline[T]) share(limits *sharedLimits) {
+	p.shared = limits
+}
+
+// withSharedLimits subjects the step's calls to limits as well.
+func withSharedLimits(limits *sharedLimits) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.shared = limits
+	}
+}
@@ -0,0 +1,307 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// waitFor fails the test if cond doesn't hold within ten seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// counting returns a pipeline emitting until it is stopped, counting in
+// active how many of its sources are running at a time.
+func counting(active *atomic.Int32, overlap *atomic.Bool) *pipeline.Pipeline[int] {
+	source := func(ctx context.Context) (<-chan int, error) {
+		if active.Add(1) > 1 {
+			overlap.Store(true)
+		}
+		out, err := blockingSource(ctx)
+		done := make(chan int)
+		go func() {
+			defer active.Add(-1)
+			defer close(done)
+			for v := range out {
+				select {
+				case <-ctx.Done():
+				case done <- v:
+				}
+			}
+		}()
+		return done, err
+	}
+
+	return pipeline.New(source).
+		Then(func(v int) (int, error) { return v, nil }).
+		Sink(func(int) error { return nil })
+}
+
+func TestManagerLookups(t *testing.T) {
+	m := pipeline.NewManager(context.Background())
+	if err := m.Add("a", pipeline.New(blockingSource)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{name: "add taken", call: func() error { return m.Add("a", pipeline.New(blockingSource)) }, want: pipeline.ErrPipelineExists},
+		{name: "start unknown", call: func() error { return m.Start("b") }, want: pipeline.ErrUnknownPipeline},
+		{name: "stop unknown", call: func() error { return m.Stop(context.Background(), "b") }, want: pipeline.ErrUnknownPipeline},
+		{name: "swap unknown", call: func() error { return m.Swap(context.Background(), "b", pipeline.New(blockingSource)) }, want: pipeline.ErrUnknownPipeline},
+		{name: "err unknown", call: func() error { return m.Err("b") }, want: pipeline.ErrUnknownPipeline},
+		{name: "stop not running", call: func() error { return m.Stop(context.Background(), "a") }},
+		{name: "remove", call: func() error { return m.Remove(context.Background(), "a") }},
+		{name: "removed", call: func() error { return m.Start("a") }, want: pipeline.ErrUnknownPipeline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagerStartStop(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	m := pipeline.NewManager(context.Background())
+	var active atomic.Int32
+	var overlap atomic.Bool
+	for _, name := range []string{"b", "a"} {
+		if err := m.Add(name, counting(&active, &overlap)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := m.Names(); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Names = %v", got)
+	}
+
+	if err := m.Start("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("a"); !errors.Is(err, pipeline.ErrRunning) {
+		t.Errorf("second Start = %v, want ErrRunning", err)
+	}
+	waitFor(t, "a to make progress", func() bool { return m.Stats()["a"].Done > 0 })
+
+	status := m.Status()
+	if !status["a"].Running || status["b"].Running {
+		t.Errorf("Status = %+v, want only a running", status)
+	}
+	if stats := m.Stats(); !stats["a"].Running || stats["b"].Running || stats["b"].Done != 0 {
+		t.Errorf("Stats = %+v, want only a running", stats)
+	}
+
+	if err := m.Stop(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Err("a"); err != nil {
+		t.Errorf("Err after Stop = %v", err)
+	}
+	if active.Load() != 0 || m.Status()["a"].Running {
+		t.Errorf("a still running after Stop")
+	}
+
+	// a stopped pipeline can be started again
+	if err := m.Start("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if active.Load() != 0 {
+		t.Errorf("%d sources still running after Shutdown", active.Load())
+	}
+}
+
+func TestManagerSwap(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	m := pipeline.NewManager(context.Background())
+	// old and next share the counts, so any overlap between them shows
+	var active atomic.Int32
+	var overlap atomic.Bool
+	old := counting(&active, &overlap)
+	if err := m.Add("flow", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("flow"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the old pipeline to run", func() bool { return old.Stats().Done > 0 })
+
+	next := counting(&active, &overlap)
+	if err := m.Swap(context.Background(), "flow", next); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the new pipeline to run", func() bool { return next.Stats().Done > 0 })
+	if old.Status().Running {
+		t.Error("the old pipeline is still running")
+	}
+	if overlap.Load() {
+		t.Error("the old and new pipelines ran at once")
+	}
+
+	// swapping a stopped pipeline doesn't start its replacement
+	if err := m.Stop(context.Background(), "flow"); err != nil {
+		t.Fatal(err)
+	}
+	// the source's goroutine may still be on its way out
+	waitFor(t, "the stopped pipeline's source to return", func() bool { return active.Load() == 0 })
+	idle := counting(&active, &overlap)
+	if err := m.Swap(context.Background(), "flow", idle); err != nil {
+		t.Fatal(err)
+	}
+	if idle.Status().Running || active.Load() != 0 {
+		t.Error("Swap started the replacement of a stopped pipeline")
+	}
+}
+
+func TestManagerSwapOverlap(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	m := pipeline.NewManager(context.Background())
+	var active atomic.Int32
+	var overlap atomic.Bool
+	old := counting(&active, &overlap)
+	if err := m.Add("flow", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("flow"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the old pipeline to run", func() bool { return old.Stats().Done > 0 })
+
+	next := counting(&active, &overlap)
+	compared := make(chan [2]pipeline.Stats, 1)
+	swapped := make(chan error, 1)
+	go func() {
+		swapped <- m.Swap(ctx, "flow", next, pipeline.WithVersion("2"),
+			pipeline.WithOverlap(time.Minute, func(old, next pipeline.Stats) {
+				compared <- [2]pipeline.Stats{old, next}
+			}))
+	}()
+
+	// both run until the overlap is over
+	waitFor(t, "the new pipeline to run", func() bool { return next.Stats().Done > 0 })
+	clock.WaitForTimers(1)
+	if !old.Status().Running {
+		t.Error("the old pipeline was stopped before the overlap was over")
+	}
+	clock.Advance(time.Minute)
+	if err := <-swapped; err != nil {
+		t.Fatal(err)
+	}
+
+	stats := <-compared
+	if !stats[0].Running || !stats[1].Running || stats[0].Done == 0 || stats[1].Done == 0 {
+		t.Errorf("compared %+v, want the Stats of both running", stats)
+	}
+	if !overlap.Load() {
+		t.Error("the old and new pipelines never ran at once")
+	}
+	if old.Status().Running || !next.Status().Running {
+		t.Error("want the old pipeline drained and the new one running")
+	}
+	if v, err := m.Version("flow"); v != "2" || err != nil {
+		t.Errorf("Version = %q, %v, want 2", v, err)
+	}
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerWorkerBudget(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	const budget = 2
+	m := pipeline.NewManager(context.Background(), pipeline.WithWorkerBudget(budget))
+
+	var calls, most atomic.Int32
+	work := func(v int) (int, error) {
+		n := calls.Add(1)
+		defer calls.Add(-1)
+		for {
+			prev := most.Load()
+			if n <= prev || most.CompareAndSwap(prev, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return v, nil
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		p := pipeline.New(blockingSource).
+			Then(work, pipeline.WithConcurrency(8)).
+			Sink(func(int) error { return nil })
+		if err := m.Add(name, p); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Start(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "every pipeline to make progress", func() bool {
+		for _, s := range m.Stats() {
+			if s.Done < 5 {
+				return false
+			}
+		}
+		return true
+	})
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := most.Load(); got > budget {
+		t.Errorf("%d calls ran at once, want at most %d", got, budget)
+	}
+}
+
+func TestManagerSharedRateLimitNoBurst(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	m := pipeline.NewManager(context.Background(), pipeline.WithSharedRateLimit(rate.Limit(1000), 0))
+	p := pipeline.New(blockingSource).
+		Then(func(v int) (int, error) { return v, nil }).
+		Sink(func(int) error { return nil })
+	if err := m.Add("a", p); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("a"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "values to get through", func() bool { return m.Stats()["a"].Done >= 3 })
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := m.Stats()["a"].Failed; got != 0 {
+		t.Errorf("%d values failed, want a burst of 0 taken as 1", got)
+	}
+}
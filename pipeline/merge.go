@@ -0,0 +1,234 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Merge fans in several channels into one. The returned channel is closed
+// once every input is closed or ctx is done. Values from different inputs are
+// interleaved in whatever order they arrive, see FairMerge, WeightedMerge and
+// OrderedMerge for more say in it.
+func Merge[T any](ctx context.Context, cs ...<-chan T) <-chan T {
+	var wg sync.WaitGroup
+	out := make(chan T)
+
+	output := func(c <-chan T) {
+		defer wg.Done()
+		for {
+			var n T
+			var ok bool
+			select {
+			case n, ok = <-c:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case out <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	wg.Add(len(cs))
+	for _, c := range cs {
+		go output(c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// FairMerge fans in several channels into one, taking turns: while several
+// inputs have values waiting, each of them gets one value through before any
+// gets a second, so a busy input can't crowd out the others the way it can
+// with Merge. Values are only read as fast as the output is, so a slow
+// consumer holds up every input alike. The returned channel is closed once
+// every input is closed or ctx is done.
+func FairMerge[T any](ctx context.Context, cs ...<-chan T) <-chan T {
+	weights := make([]int, len(cs))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	return WeightedMerge(ctx, weights, cs...)
+}
+
+// WeightedMerge is FairMerge with a priority per input: while several inputs
+// have values waiting, cs[i] gets up to weights[i] values through per turn,
+// so an input weighted 3 gets three times the share of one weighted 1, yet
+// none of them starves. Inputs without a weight, or with one below 1, are
+// weighted 1. See Prioritize for a strict priority between two inputs.
+func WeightedMerge[T any](ctx context.Context, weights []int, cs ...<-chan T) <-chan T {
+	outChannel := make(chan T)
+	inputs := slices.Clone(cs)
+	credits := make([]int, len(cs))
+	for i := range credits {
+		credits[i] = 1
+		if i < len(weights) && weights[i] > 1 {
+			credits[i] = weights[i]
+		}
+	}
+
+	go func() {
+		defer close(outChannel)
+
+		// turn is the input whose turn it is, left the number of values it
+		// may still get through this turn
+		turn, left := 0, 0
+		if len(inputs) > 0 {
+			left = credits[0]
+		}
+		open := len(inputs)
+
+		// received takes note of a value, or the end, of input i
+		received := func(i int, ok bool) {
+			if !ok {
+				inputs[i] = nil
+				open--
+				return
+			}
+			if i != turn {
+				turn, left = i, credits[i]
+			}
+			if left--; left <= 0 {
+				turn = (turn + 1) % len(inputs)
+				left = credits[turn]
+			}
+		}
+
+		// next reads a value, trying the inputs in turn before waiting on
+		// all of them
+		next := func() (T, bool) {
+			for open > 0 {
+				for k := range inputs {
+					i := (turn + k) % len(inputs)
+					if inputs[i] == nil {
+						continue
+					}
+					select {
+					case v, ok := <-inputs[i]:
+						received(i, ok)
+						if ok {
+							return v, true
+						}
+					default:
+					}
+				}
+				if open == 0 {
+					break
+				}
+
+				cases := make([]reflect.SelectCase, 0, open+1)
+				indexes := make([]int, 0, open)
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+				for i, in := range inputs {
+					if in != nil {
+						cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(in)})
+						indexes = append(indexes, i)
+					}
+				}
+				chosen, value, ok := reflect.Select(cases)
+				if chosen == 0 {
+					break
+				}
+				received(indexes[chosen-1], ok)
+				if ok {
+					// a nil interface value has no dynamic type to assert
+					v, _ := value.Interface().(T)
+					return v, true
+				}
+			}
+
+			var zero T
+			return zero, false
+		}
+
+		for {
+			v, ok := next()
+			if !ok {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case outChannel <- v:
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// OrderedMerge merges inputs that are each sorted by cmp, e.g. by timestamp,
+// into one sorted output, as the merge step of a merge sort does. It waits
+// for a value from every open input before emitting the smallest of them,
+// so an input with nothing to say holds up the rest. Equal values are
+// emitted in the order of their inputs. The returned channel is closed once
+// every input is closed or ctx is done.
+func OrderedMerge[T any](ctx context.Context, cmp func(a, b T) int, cs ...<-chan T) <-chan T {
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		// heads holds the next value of every open input
+		type head struct {
+			value T
+			input int
+		}
+		heads := make([]head, 0, len(cs))
+
+		read := func(i int) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case v, ok := <-cs[i]:
+				if ok {
+					heads = append(heads, head{value: v, input: i})
+				}
+				return true
+			}
+		}
+		for i := range cs {
+			if !read(i) {
+				return
+			}
+		}
+
+		for len(heads) > 0 {
+			smallest := 0
+			for i, h := range heads[1:] {
+				c := cmp(h.value, heads[smallest].value)
+				if c < 0 || c == 0 && h.input < heads[smallest].input {
+					smallest = i + 1
+				}
+			}
+			h := heads[smallest]
+			heads = slices.Delete(heads, smallest, smallest+1)
+
+			select {
+			case <-ctx.Done():
+				return
+			case outChannel <- h.value:
+			}
+			if !read(h.input) {
+				return
+			}
+		}
+	}()
+
+	return outChannel
+}
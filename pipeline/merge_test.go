@@ -0,0 +1,206 @@
+package pipeline_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// waiting returns a closed channel holding values, as an input with all of
+// them waiting to be read.
+func waiting[T any](values ...T) <-chan T {
+	c := make(chan T, len(values))
+	for _, v := range values {
+		c <- v
+	}
+	close(c)
+	return c
+}
+
+func TestMerge(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.Merge(context.Background(), waiting(1, 2), waiting[int](), waiting(3)))
+	slices.Sort(got)
+	if !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("got %v, want 1, 2 and 3", got)
+	}
+}
+
+func TestWeightedMerge(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	tests := []struct {
+		name    string
+		weights []int
+		inputs  [][]int
+		want    []int
+	}{
+		{
+			name:    "taking turns",
+			weights: []int{1, 1, 1},
+			inputs:  [][]int{{1, 2, 3, 4, 5, 6}, {10, 20}, {100, 200}},
+			want:    []int{1, 10, 100, 2, 20, 200, 3, 4, 5, 6},
+		},
+		{
+			name:    "three to one",
+			weights: []int{3, 1},
+			inputs:  [][]int{{1, 2, 3, 4, 5, 6}, {10, 20, 30}},
+			want:    []int{1, 2, 3, 10, 4, 5, 6, 20, 30},
+		},
+		{
+			name:    "missing and low weights count as 1",
+			weights: []int{0},
+			inputs:  [][]int{{1, 2}, {10, 20}},
+			want:    []int{1, 10, 2, 20},
+		},
+		{
+			name:   "no inputs",
+			inputs: nil,
+		},
+		{
+			name:    "empty inputs",
+			weights: []int{2, 2},
+			inputs:  [][]int{{}, {10, 20}},
+			want:    []int{10, 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := make([]<-chan int, len(tt.inputs))
+			for i, in := range tt.inputs {
+				cs[i] = waiting(in...)
+			}
+
+			got := pipelinetest.Collect(t, pipeline.WeightedMerge(context.Background(), tt.weights, cs...))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFairMerge(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.FairMerge(context.Background(), waiting(1, 2, 3, 4), waiting(10, 20)))
+	if want := []int{1, 10, 2, 20, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestFairMergeNil sends a nil error once the merge is waiting on its inputs,
+// rather than finding it waiting, so it is received the slow way.
+func TestFairMergeNil(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errs := make(chan error)
+	go func() {
+		defer close(errs)
+		time.Sleep(10 * time.Millisecond)
+		errs <- nil
+		errs <- errBad
+	}()
+
+	got := pipelinetest.Collect(t, pipeline.FairMerge(context.Background(), errs, waiting[error]()))
+	if len(got) != 2 || got[0] != nil || !errors.Is(got[1], errBad) {
+		t.Errorf("got %v, want nil and %v", got, errBad)
+	}
+}
+
+func TestOrderedMerge(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	type value struct {
+		key, input int
+	}
+	byKey := func(a, b value) int { return cmp.Compare(a.key, b.key) }
+
+	tests := []struct {
+		name   string
+		inputs [][]value
+		want   []value
+	}{
+		{
+			name: "interleaved",
+			inputs: [][]value{
+				{{1, 0}, {4, 0}, {7, 0}},
+				{{2, 1}, {5, 1}},
+				{{3, 2}, {6, 2}, {8, 2}},
+			},
+			want: []value{{1, 0}, {2, 1}, {3, 2}, {4, 0}, {5, 1}, {6, 2}, {7, 0}, {8, 2}},
+		},
+		{
+			name:   "ties in the order of the inputs",
+			inputs: [][]value{{{1, 0}, {2, 0}}, {{1, 1}, {2, 1}}},
+			want:   []value{{1, 0}, {1, 1}, {2, 0}, {2, 1}},
+		},
+		{
+			name:   "one input runs out",
+			inputs: [][]value{{{5, 0}}, {{1, 1}, {2, 1}, {9, 1}}},
+			want:   []value{{1, 1}, {2, 1}, {5, 0}, {9, 1}},
+		},
+		{
+			name:   "empty input",
+			inputs: [][]value{{}, {{1, 1}}},
+			want:   []value{{1, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := make([]<-chan value, len(tt.inputs))
+			for i, in := range tt.inputs {
+				cs[i] = waiting(in...)
+			}
+
+			got := pipelinetest.Collect(t, pipeline.OrderedMerge(context.Background(), byKey, cs...))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergesStop checks every merge closes its output once ctx is done, with
+// its inputs still open and holding nothing.
+func TestMergesStop(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	tests := []struct {
+		name  string
+		merge func(context.Context, ...<-chan int) <-chan int
+	}{
+		{name: "merge", merge: pipeline.Merge[int]},
+		{name: "fair", merge: pipeline.FairMerge[int]},
+		{name: "weighted", merge: func(ctx context.Context, cs ...<-chan int) <-chan int {
+			return pipeline.WeightedMerge(ctx, []int{2, 1}, cs...)
+		}},
+		{name: "ordered", merge: func(ctx context.Context, cs ...<-chan int) <-chan int {
+			return pipeline.OrderedMerge(ctx, cmp.Compare[int], cs...)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			a, b := make(chan int), make(chan int)
+			defer close(a)
+			defer close(b)
+
+			out := tt.merge(ctx, a, b)
+			assertNothing(t, out)
+			cancel()
+			if got := pipelinetest.Collect(t, out); len(got) != 0 {
+				t.Errorf("got %v after cancelling, want nothing", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Message wraps a value travelling through a pipeline with metadata that
+// stays with it from stage to stage, so sinks and error handlers can
+// correlate outputs back to the inputs and external systems they came from.
+//
+// Wrap values with Wrap or NewMessage, and lift their transforms with
+// MapMessage so the metadata is carried over to the results. A failing
+// message is reported as the Input of its StageError, ID and all.
+//
+// A message can carry a callback telling its source when it is done with,
+// see OnAck.
+type Message[T any] struct {
+	// ID identifies the message. NewMessage generates a random one and
+	// NewMessageFrom adopts one from the headers it is given; set it to an
+	// upstream identifier, e.g. a broker message ID, to correlate with the
+	// outside world. Steps pass it to fn as its CorrelationID.
+	ID string
+	// Payload is the value being processed.
+	Payload T
+	// CreatedAt is when the message entered the pipeline.
+	CreatedAt time.Time
+	// Headers carries string metadata such as content types or trace
+	// context.
+	Headers Headers
+
+	ack *acker
+}
+
+// acker runs a message's OnAck callback once, however many copies of the
+// message settle it.
+type acker struct {
+	once sync.Once
+	fn   func(error)
+}
+
+// OnAck returns a copy of m that calls fn once it has been settled by Ack or
+// Nack, e.g. to acknowledge or reject it with the broker it was received
+// from:
+//
+//	msg := pipeline.NewMessage(job).OnAck(func(err error) {
+//		if err != nil {
+//			delivery.Nack(false, true)
+//			return
+//		}
+//		delivery.Ack(false)
+//	})
+//
+// Pipeline settles the messages it runs once they leave it: Ack once the
+// sink has taken one, or once a step skipped it, see ErrorSkip, and Nack
+// with its StageError once it has failed, after any DeadLetter handler has
+// run. Messages still in flight when a run stops are left unsettled. Only
+// the first Ack or Nack calls fn; messages made from m with Derive or
+// MapMessage share it, so settling any of them settles them all.
+func (m Message[T]) OnAck(fn func(err error)) Message[T] {
+	m.ack = &acker{fn: fn}
+	return m
+}
+
+// Ack settles m as done with, calling its OnAck callback with a nil error.
+// It does nothing if m has no callback or has been settled already.
+func (m Message[T]) Ack() {
+	m.settle(nil)
+}
+
+// Nack settles m as failed with err, calling its OnAck callback with err.
+// It does nothing if m has no callback or has been settled already.
+func (m Message[T]) Nack(err error) {
+	m.settle(err)
+}
+
+func (m Message[T]) settle(err error) {
+	if m.ack == nil {
+		return
+	}
+
+	m.ack.once.Do(func() {
+		m.ack.fn(err)
+	})
+}
+
+// settler is implemented by every Message.
+type settler interface {
+	settle(err error)
+}
+
+// settle settles v with err if it is a Message.
+func settle(v any, err error) {
+	if s, ok := v.(settler); ok {
+		s.settle(err)
+	}
+}
+
+// Headers is string metadata attached to a Message. Its Get, Set and Keys
+// methods match OpenTelemetry's propagation.TextMapCarrier, so trace context
+// can be injected into and extracted from it directly.
+type Headers map[string]string
+
+// Get returns the value for key, or "" if it isn't set.
+func (h Headers) Get(key string) string {
+	return h[key]
+}
+
+// Set sets key to value.
+func (h Headers) Set(key, value string) {
+	h[key] = value
+}
+
+// Keys lists the keys that are set, in no particular order.
+func (h Headers) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// Clone returns a copy of h that can be changed independently.
+func (h Headers) Clone() Headers {
+	clone := make(Headers, len(h))
+	for k, v := range h {
+		clone[k] = v
+	}
+
+	return clone
+}
+
+// NewMessage wraps payload in a Message with a random ID, the current time
+// and no headers.
+func NewMessage[T any](payload T) Message[T] {
+	return Message[T]{
+		ID:        newMessageID(),
+		Payload:   payload,
+		CreatedAt: time.Now(),
+		Headers:   Headers{},
+	}
+}
+
+// Derive returns a message carrying payload and a copy of m's metadata. The
+// headers are cloned, so stages changing them don't affect each other, and
+// the OnAck callback is shared.
+func Derive[In any, Out any](m Message[In], payload Out) Message[Out] {
+	return Message[Out]{
+		ID:        m.ID,
+		Payload:   payload,
+		CreatedAt: m.CreatedAt,
+		Headers:   m.Headers.Clone(),
+		ack:       m.ack,
+	}
+}
+
+// MapMessage lifts fn to work on messages for use with Step: fn sees the
+// payload and its result is wrapped with the metadata of the input message.
+func MapMessage[In any, Out any](fn func(In) (Out, error)) func(Message[In]) (Message[Out], error) {
+	return func(m Message[In]) (Message[Out], error) {
+		out, err := fn(m.Payload)
+		if err != nil {
+			return Message[Out]{}, err
+		}
+
+		return Derive(m, out), nil
+	}
+}
+
+// Wrap turns every value read from in into a NewMessage. The output is
+// closed once in is closed or ctx is done.
+func Wrap[T any](ctx context.Context, in <-chan T) <-chan Message[T] {
+	return mapChannel(ctx, in, NewMessage[T])
+}
+
+// Payloads unwraps the payload of every message read from in. The output is
+// closed once in is closed or ctx is done.
+func Payloads[T any](ctx context.Context, in <-chan Message[T]) <-chan T {
+	return mapChannel(ctx, in, func(m Message[T]) T {
+		return m.Payload
+	})
+}
+
+// mapChannel sends fn of every value read from in, in order.
+func mapChannel[In any, Out any](ctx context.Context, in <-chan In, fn func(In) Out) <-chan Out {
+	outChannel := make(chan Out)
+
+	go func() {
+		defer close(outChannel)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- fn(v):
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+func newMessageID() string {
+	var b [16]byte
+	// crypto/rand.Read only fails if the OS can't provide randomness
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b[:])
+}
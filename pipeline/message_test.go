@@ -0,0 +1,72 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestAckOnce(t *testing.T) {
+	var calls []error
+	m := pipeline.NewMessage(1).OnAck(func(err error) { calls = append(calls, err) })
+
+	// a derived message shares the callback
+	pipeline.Derive(m, "one").Nack(errBad)
+	m.Ack()
+	m.Nack(errBad)
+	if len(calls) != 1 || !errors.Is(calls[0], errBad) {
+		t.Errorf("OnAck called with %v, want %v once", calls, errBad)
+	}
+
+	// without a callback there is nothing to settle
+	pipeline.NewMessage(1).Ack()
+}
+
+// TestPipelineSettles checks a pipeline acks the messages its sink takes or
+// its steps skip, and nacks the ones that fail with their error.
+func TestPipelineSettles(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	var mu sync.Mutex
+	settled := make(map[int]error)
+	messages := make([]pipeline.Message[int], 4)
+	for i := range messages {
+		messages[i] = pipeline.NewMessage(i + 1).OnAck(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := settled[i+1]; ok {
+				t.Errorf("message %d settled twice", i+1)
+			}
+			settled[i+1] = err
+		})
+	}
+
+	err := pipeline.New(pipeline.SliceSource(messages)).
+		Then(pipeline.MapMessage(func(v int) (int, error) {
+			switch v {
+			case 2:
+				return 0, errBad
+			case 3:
+				return 0, pipeline.Skip(errBad)
+			}
+			return v * 10, nil
+		})).
+		OnError(pipeline.CollectErrors()).
+		Sink(func(pipeline.Message[int]) error { return nil }).
+		Run(context.Background())
+	if !errors.Is(err, errBad) {
+		t.Fatalf("Run = %v, want %v", err, errBad)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var stageErr *pipeline.StageError
+	if len(settled) != 4 || settled[1] != nil || settled[3] != nil || settled[4] != nil ||
+		!errors.As(settled[2], &stageErr) || !errors.Is(settled[2], errBad) {
+		t.Errorf("settled %v, want only message 2 nacked with its StageError", settled)
+	}
+}
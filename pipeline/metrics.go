@@ -0,0 +1,55 @@
+package pipeline
+
+import "time"
+
+// StageMetrics receives measurements from a step, see WithMetrics. Every
+// method is given the step's name, as set with WithName, or for an unnamed
+// step of a Pipeline the "step N" it is known as there, so one
+// implementation can serve all the stages of a pipeline. Implementations must
+// be safe for concurrent use. The pipelineprom package provides one backed by
+// Prometheus.
+type StageMetrics interface {
+	// ItemIn is called for every value the step reads from its input.
+	ItemIn(stage string)
+	// ItemOut is called for every result the step produces.
+	ItemOut(stage string)
+	// ItemError is called for every value that finally fails.
+	ItemError(stage string)
+	// Retry is called every time a failed value is attempted again.
+	Retry(stage string)
+	// InFlight is called with +1 when a worker picks up a value and -1 when
+	// it is done with it.
+	InFlight(stage string, delta int)
+	// QueueDepth is called with the number of values waiting in the step's
+	// input channel each time one is read.
+	QueueDepth(stage string, depth int)
+	// Latency is called with how long a value took to process, retries
+	// included.
+	Latency(stage string, d time.Duration)
+}
+
+// WithMetrics reports the step's throughput, errors, retries, concurrency
+// and latency to m.
+func WithMetrics(m StageMetrics) StepOption {
+	return func(cfg *stepConfig) {
+		if m != nil {
+			cfg.metrics = m
+		}
+	}
+}
+
+// skipMetrics is implemented by the StageMetrics that count skipped values
+// apart from failed ones, which the others are told about as errors.
+type skipMetrics interface {
+	ItemSkipped(stage string)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ItemIn(string)                 {}
+func (noopMetrics) ItemOut(string)                {}
+func (noopMetrics) ItemError(string)              {}
+func (noopMetrics) Retry(string)                  {}
+func (noopMetrics) InFlight(string, int)          {}
+func (noopMetrics) QueueDepth(string, int)        {}
+func (noopMetrics) Latency(string, time.Duration) {}
@@ -0,0 +1,111 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// recordingMetrics counts the calls it gets by method and stage.
+type recordingMetrics struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (m *recordingMetrics) record(method, stage string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = make(map[string]int)
+	}
+	m.calls[method+" "+stage]++
+}
+
+func (m *recordingMetrics) count(method, stage string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method+" "+stage]
+}
+
+func (m *recordingMetrics) ItemIn(stage string)                   { m.record("in", stage) }
+func (m *recordingMetrics) ItemOut(stage string)                  { m.record("out", stage) }
+func (m *recordingMetrics) ItemError(stage string)                { m.record("error", stage) }
+func (m *recordingMetrics) Retry(stage string)                    { m.record("retry", stage) }
+func (m *recordingMetrics) InFlight(string, int)                  {}
+func (m *recordingMetrics) QueueDepth(string, int)                {}
+func (m *recordingMetrics) Latency(stage string, _ time.Duration) { m.record("latency", stage) }
+
+// skipRecordingMetrics counts skips apart from errors.
+type skipRecordingMetrics struct {
+	recordingMetrics
+}
+
+func (m *skipRecordingMetrics) ItemSkipped(stage string) { m.record("skipped", stage) }
+
+func TestPipelineStepMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		metrics     func() (pipeline.StageMetrics, *recordingMetrics)
+		wantSkipped int
+		wantErrors  int
+	}{
+		{
+			name: "skips counted apart",
+			metrics: func() (pipeline.StageMetrics, *recordingMetrics) {
+				m := &skipRecordingMetrics{}
+				return m, &m.recordingMetrics
+			},
+			wantSkipped: 2,
+		},
+		{
+			name: "skips reported as errors",
+			metrics: func() (pipeline.StageMetrics, *recordingMetrics) {
+				m := &recordingMetrics{}
+				return m, m
+			},
+			wantErrors: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rec := tt.metrics()
+			// the step is unnamed, its metrics go by the label Pipeline gives it
+			result, err := pipeline.New(pipeline.SliceSource([]int{1, 2, 3, 4})).
+				Then(func(v int) (int, error) {
+					if v%2 == 0 {
+						return 0, pipeline.Skip(errors.New("even"))
+					}
+					return v, nil
+				}, pipeline.WithMetrics(m)).
+				Sink(func(int) error { return nil }).
+				RunResult(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := rec.count("in", "step 1"); got != 4 {
+				t.Errorf("ItemIn(step 1) called %d times, want 4", got)
+			}
+			if got := rec.count("out", "step 1"); got != 2 {
+				t.Errorf("ItemOut(step 1) called %d times, want 2", got)
+			}
+			if got := rec.count("skipped", "step 1"); got != tt.wantSkipped {
+				t.Errorf("ItemSkipped(step 1) called %d times, want %d", got, tt.wantSkipped)
+			}
+			if got := rec.count("error", "step 1"); got != tt.wantErrors {
+				t.Errorf("ItemError(step 1) called %d times, want %d", got, tt.wantErrors)
+			}
+			if got := rec.count("in", ""); got != 0 {
+				t.Errorf("ItemIn called %d times with no stage name", got)
+			}
+			if result.Skipped != 2 || result.Stages[0].Skipped != 2 {
+				t.Errorf("result counts %d skipped, %d in the step, want 2", result.Skipped, result.Stages[0].Skipped)
+			}
+		})
+	}
+}
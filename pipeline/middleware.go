@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrUnexpectedType is wrapped by the error a call fails with when a value
+// handed around untyped, as middleware does, turns out not to be of the type
+// the step expects.
+var ErrUnexpectedType = errors.New("pipeline: unexpected type")
+
+// StepFunc is the untyped form of a step's fn that middleware wraps. The
+// input and output are the step's In and Out values.
+type StepFunc func(ctx context.Context, in any) (any, error)
+
+// Middleware wraps every call of a step's fn, e.g. to log, measure, refresh
+// an auth token or serve from a cache, without changing the function itself.
+// It calls next to carry on to fn, or returns without calling it to cut the
+// call short.
+type Middleware func(next StepFunc) StepFunc
+
+// WithMiddleware wraps the step's fn in mw. The first middleware given is the
+// outermost, and repeated WithMiddleware options add to the chain. Middleware
+// runs once per attempt, inside retries, timeouts and panic recovery. Its
+// output must be of the step's Out type, anything else fails the call with
+// an error wrapping ErrUnexpectedType.
+func WithMiddleware(mw ...Middleware) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.middleware = append(cfg.middleware, mw...)
+	}
+}
+
+// applyMiddleware wraps fn in the chain mw.
+func applyMiddleware[In any, Out any](fn func(context.Context, In) (Out, error), mw []Middleware) func(context.Context, In) (Out, error) {
+	next := StepFunc(func(ctx context.Context, v any) (any, error) {
+		in, err := as[In](v)
+		if err != nil {
+			return nil, fmt.Errorf("middleware passed on: %w", err)
+		}
+		return fn(ctx, in)
+	})
+	for i := len(mw) - 1; i >= 0; i-- {
+		next = mw[i](next)
+	}
+
+	return func(ctx context.Context, in In) (Out, error) {
+		v, err := next(ctx, in)
+		if err != nil {
+			out, _ := v.(Out)
+			return out, err
+		}
+		out, err := as[Out](v)
+		if err != nil {
+			return out, fmt.Errorf("middleware returned: %w", err)
+		}
+		return out, nil
+	}
+}
+
+// as returns v, handed around as an any, as a T. A nil v stands for the zero
+// value of a T that can be nil, such as a pointer or an interface.
+func as[T any](v any) (T, error) {
+	t, ok := v.(T)
+	if ok || v == nil && nillable(reflect.TypeFor[T]()) {
+		return t, nil
+	}
+
+	return t, fmt.Errorf("%w: got %T, want %s", ErrUnexpectedType, v, reflect.TypeFor[T]())
+}
+
+func nillable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return true
+	default:
+		return false
+	}
+}
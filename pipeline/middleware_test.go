@@ -0,0 +1,85 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestMiddleware(t *testing.T) {
+	double := func(v int) (int, error) { return 2 * v, nil }
+
+	tests := []struct {
+		name     string
+		mw       pipeline.Middleware
+		want     []int
+		wantType bool
+	}{
+		{
+			name: "pass through",
+			mw:   func(next pipeline.StepFunc) pipeline.StepFunc { return next },
+			want: []int{2, 4},
+		},
+		{
+			name: "short circuit",
+			mw: func(pipeline.StepFunc) pipeline.StepFunc {
+				return func(context.Context, any) (any, error) { return 7, nil }
+			},
+			want: []int{7, 7},
+		},
+		{
+			name: "wrong output type",
+			mw: func(next pipeline.StepFunc) pipeline.StepFunc {
+				return func(ctx context.Context, v any) (any, error) {
+					out, err := next(ctx, v)
+					return strconv.Itoa(out.(int)), err
+				}
+			},
+			wantType: true,
+		},
+		{
+			name: "wrong input type",
+			mw: func(next pipeline.StepFunc) pipeline.StepFunc {
+				return func(ctx context.Context, v any) (any, error) {
+					return next(ctx, "one")
+				}
+			},
+			wantType: true,
+		},
+		{
+			name: "nil output",
+			mw: func(pipeline.StepFunc) pipeline.StepFunc {
+				return func(context.Context, any) (any, error) { return nil, nil }
+			},
+			wantType: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errs := pipelinetest.RunStage(t, double, []int{1, 2}, pipeline.WithMiddleware(tt.mw))
+
+			if !tt.wantType {
+				if len(errs) > 0 {
+					t.Fatal(errs)
+				}
+				if len(out) != len(tt.want) || out[0] != tt.want[0] || out[1] != tt.want[1] {
+					t.Errorf("got %v, want %v", out, tt.want)
+				}
+				return
+			}
+			if len(out) != 0 || len(errs) != 2 {
+				t.Fatalf("got %v and errors %v, want 2 errors", out, errs)
+			}
+			for _, err := range errs {
+				if !errors.Is(err, pipeline.ErrUnexpectedType) {
+					t.Errorf("got %v, want an ErrUnexpectedType", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// StepOption configures a Step.
+type StepOption func(*stepConfig)
+
+type stepConfig struct {
+	name string
+	// label is what the step is known as in contexts, profiles and hooks,
+	// its name unless Pipeline gave it another one
+	label       string
+	concurrency int
+	ordered     bool
+	maxAttempts int
+	backoff     BackoffStrategy
+	limiter     *rate.Limiter
+	shared      *sharedLimits
+	breaker     *breaker
+	classify    ErrorClassifier
+	itemTimeout time.Duration
+	budget      time.Duration
+	metrics     StageMetrics
+	tracer      Tracer
+	logger      *slog.Logger
+	logLevel    slog.Leveler
+
+	buffer       int
+	backpressure BackpressurePolicy
+
+	crashOnPanic bool
+	workerPool   bool
+	workerInit   func(context.Context) (any, error)
+	workerClose  func(any)
+	// firstWorker is the WorkerID of the step's first worker, for steps
+	// made of several runSteps
+	firstWorker int
+
+	scaleMin      int
+	scaleMax      int
+	scaleInterval time.Duration
+	scaleHook     func(ScaleEvent)
+
+	middleware []Middleware
+
+	// inputView turns a value into what the step reports to its tracer
+	// and hooks
+	inputView func(any) any
+	// reportSkips sends skipped values on as errors marked with skipped
+	// rather than dropping them
+	reportSkips bool
+
+	hooks     Hooks
+	reporters []ErrorReporter
+	// dropped is told about every result the step's WithBackpressure drops,
+	// see withDropped
+	dropped func(any)
+	// observe is told about every value the step finishes, see SLOs
+	observe func(elapsed time.Duration, err error)
+}
+
+func newStepConfig(opts []StepOption) stepConfig {
+	cfg := stepConfig{
+		// use all CPU cores to maximize efficiency
+		concurrency: runtime.NumCPU(),
+		maxAttempts: 1,
+		metrics:     noopMetrics{},
+		logger:      slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.label == "" {
+		cfg.label = cfg.name
+	}
+	if cfg.logLevel != nil {
+		cfg.logger = slog.New(levelHandler{Handler: cfg.logger.Handler(), level: cfg.logLevel})
+	}
+	cfg.logger = slog.New(correlationHandler{Handler: cfg.logger.Handler()})
+	if cfg.label != "" {
+		cfg.logger = cfg.logger.With("stage", cfg.label)
+	}
+
+	return cfg
+}
+
+// WithName names the step. The name is reported in the StageError of every
+// value that fails in it, and in its logs, metrics and traces. fn can read it
+// from its context with StageName, and the step's goroutines carry it as the
+// "stage" profiler label, see runtime/pprof.
+func WithName(name string) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.name = name
+	}
+}
+
+// WithLogger makes the step log to l instead of slog.Default(). Steps only
+// log retries, at debug level, and recovered panics; failures themselves are
+// reported on the error channel. Named steps add a "stage" attribute, as do
+// the unnamed steps of a Pipeline with their "step N" label.
+func WithLogger(l *slog.Logger) StepOption {
+	return func(cfg *stepConfig) {
+		if l != nil {
+			cfg.logger = l
+		}
+	}
+}
+
+// WithLogLevel makes the step log at level and above whatever the level of
+// its logger, so one noisy step can be turned down, or one under suspicion
+// turned up to slog.LevelDebug without drowning the logs in everybody
+// else's. Pass a *slog.LevelVar to change it while the step runs.
+//
+// Turning a step up only works with handlers that leave filtering by level
+// to Enabled, as slog's own do.
+func WithLogLevel(level slog.Leveler) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.logLevel = level
+	}
+}
+
+// levelHandler is a slog.Handler logging at level and above, whatever the
+// level of the one it wraps.
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h levelHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// WithConcurrency sets how many values the step processes in parallel. It
+// defaults to runtime.NumCPU(); values below 1 keep the default. See
+// WithAutoscale for a limit that follows the load.
+func WithConcurrency(n int) StepOption {
+	return func(cfg *stepConfig) {
+		if n >= 1 {
+			cfg.concurrency = n
+		}
+	}
+}
+
+// WithOrderedOutput makes the step emit results, and errors, in the order
+// their inputs arrived rather than the order they finish. A slow value holds
+// back the ones after it, so throughput drops to that of the slowest value in
+// each window of concurrent work.
+func WithOrderedOutput() StepOption {
+	return func(cfg *stepConfig) {
+		cfg.ordered = true
+	}
+}
+
+// withoutMiddleware is used by Pipeline, which applies the middleware itself.
+func withoutMiddleware(cfg *stepConfig) {
+	cfg.middleware = nil
+}
+
+// withLabel is used by Pipeline to give unnamed steps a label, see
+// stepConfig.label.
+func withLabel(label string) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.label = label
+	}
+}
+
+// reportSkips is used by Pipeline, which needs to know about skipped values
+// to checkpoint past them.
+func reportSkips(cfg *stepConfig) {
+	cfg.reportSkips = true
+}
+
+// withDropped is used by Pipeline, which needs to know about dropped values
+// to stop holding them.
+func withDropped(dropped func(any)) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.dropped = dropped
+	}
+}
+
+// input returns what the step reports about the input v, see withInputView.
+func (cfg *stepConfig) input(v any) any {
+	if cfg.inputView != nil {
+		return cfg.inputView(v)
+	}
+	return v
+}
+
+// withInputView is used by Pipeline to hide the wrapping of the values it
+// passes through its steps.
+func withInputView(view func(any) any) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.inputView = view
+	}
+}
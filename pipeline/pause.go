@@ -0,0 +1,79 @@
+package pipeline
+
+import "sync"
+
+// Pause stops the pipeline from reading new values from its source, e.g.
+// during a maintenance window of a downstream system. Values already inside
+// the pipeline are still processed and handed to the sink, and every channel
+// stays open, so Resume carries on where the pipeline left off. Pausing a
+// pipeline that isn't running makes its next Run start paused.
+//
+// Drain and Shutdown still work on a paused pipeline.
+func (p *Pipeline[T]) Pause() {
+	p.valve.pause()
+}
+
+// Resume lets a paused pipeline read from its source again.
+func (p *Pipeline[T]) Resume() {
+	p.valve.resume()
+}
+
+// Paused reports whether the pipeline is paused.
+func (p *Pipeline[T]) Paused() bool {
+	return p.valve.isPaused()
+}
+
+// valve holds back a gate while paused. The zero value is open.
+type valve struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+}
+
+var openValve = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+func (v *valve) pause() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.paused {
+		v.paused = true
+		v.resumed = make(chan struct{})
+	}
+}
+
+func (v *valve) resume() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.paused {
+		v.paused = false
+		close(v.resumed)
+	}
+}
+
+func (v *valve) isPaused() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.paused
+}
+
+// open returns a channel that is closed while the valve is open.
+func (v *valve) open() <-chan struct{} {
+	if v == nil {
+		return openValve
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.paused {
+		return openValve
+	}
+	return v.resumed
+}
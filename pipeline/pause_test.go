@@ -0,0 +1,80 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestPauseResume(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	in := make(chan int)
+	sink := pipelinetest.NewSink[int]()
+	p := pipeline.New(func(context.Context) (<-chan int, error) { return in, nil }).
+		Then(func(v int) (int, error) { return v, nil }).
+		Sink(sink.Handle)
+
+	// paused before it runs, the pipeline starts paused
+	p.Pause()
+	if !p.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+
+	select {
+	case in <- 1:
+		t.Fatal("source read while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.Resume()
+	if p.Paused() {
+		t.Fatal("Paused() = true after Resume")
+	}
+	in <- 1
+	if got := sink.Next(t); got != 1 {
+		t.Errorf("got %d after resuming, want 1", got)
+	}
+
+	close(in)
+	if err := <-done; err != nil {
+		t.Errorf("Run = %v, want nil", err)
+	}
+}
+
+// TestPauseKeepsInFlight checks values already inside a pipeline reach the
+// sink while it is paused.
+func TestPauseKeepsInFlight(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	src := pipelinetest.NewSource[int]()
+	release := make(chan struct{})
+	sink := pipelinetest.NewSink[int]()
+	p := pipeline.New(src.Open).
+		Then(func(v int) (int, error) {
+			<-release
+			return v, nil
+		}).
+		Sink(sink.Handle)
+
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+
+	src.Send(t, 1)
+	p.Pause()
+	close(release)
+	if got := sink.Next(t); got != 1 {
+		t.Errorf("got %d while paused, want 1", got)
+	}
+
+	p.Resume()
+	src.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Run = %v, want nil", err)
+	}
+}
@@ -0,0 +1,580 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Source starts the producing end of a pipeline. The returned channel must be
+// closed once the source is exhausted or ctx is done.
+type Source[T any] func(ctx context.Context) (<-chan T, error)
+
+// SliceSource returns a Source that emits values in order, see FromSlice.
+func SliceSource[T any](values []T) Source[T] {
+	return func(ctx context.Context) (<-chan T, error) {
+		return FromSlice(ctx, values), nil
+	}
+}
+
+// SeqSource returns a Source that emits the values yielded by seq, see
+// FromSeq.
+func SeqSource[T any](seq iter.Seq[T]) Source[T] {
+	return func(ctx context.Context) (<-chan T, error) {
+		return FromSeq(ctx, seq), nil
+	}
+}
+
+// ErrRunning is returned by Run when the pipeline is already running.
+var ErrRunning = errors.New("pipeline: already running")
+
+// Pipeline wires a source, a chain of steps and a sink together so the
+// channels, error merging and cancellation don't have to be plumbed by hand:
+//
+//	err := pipeline.New(pipeline.SliceSource(values)).
+//		Then(transformA).
+//		Then(transformB, pipeline.WithConcurrency(4)).
+//		Sink(handler).
+//		Run(ctx)
+//
+// Every step maps T to T. Nothing runs until Run is called.
+type Pipeline[T any] struct {
+	source     Source[T]
+	stages     []stage[T]
+	sink       func(T) error
+	deadLetter func(*StageError) error
+	policy     *ErrorPolicy
+	classify   ErrorClassifier
+
+	checkpointer    Checkpointer
+	checkpointEvery time.Duration
+
+	progress      func(Progress)
+	progressEvery time.Duration
+	total         int64
+
+	summaryEvery  time.Duration
+	summaryLogger *slog.Logger
+	logger        *slog.Logger
+
+	stallAfter  time.Duration
+	stallCancel bool
+
+	alertEvery time.Duration
+	alertFire  func(Alert)
+	alertRules []AlertRule
+
+	heartbeatEvery time.Duration
+	heartbeat      func(Heartbeat)
+
+	sloEvery  time.Duration
+	sloBreach func(SLOReport)
+	slos      []SLO
+
+	replay    *replayConfig
+	hooks     Hooks
+	reporters []ErrorReporter
+
+	admitLimit int64
+	admitSize  func(T) int64
+
+	recordTo    io.Writer
+	recordCodec Codec[T]
+
+	timeout  time.Duration
+	deadline time.Time
+
+	// shared are the limits of the Manager the pipeline was added to
+	shared *sharedLimits
+	// checks are what Validate runs
+	checks []check
+
+	mu  sync.Mutex
+	run *run
+	// counter counts the current run, or the last one until the next
+	// starts, which ended at ended
+	counter *progressCounter
+	ended   time.Time
+	// slo tracks the SLOs of the current run, or of the last one
+	slo   *sloTracker
+	valve valve
+}
+
+type stage[T any] struct {
+	fn   func(context.Context, T) (T, error)
+	opts []StepOption
+}
+
+// New starts building a pipeline reading from source.
+func New[T any](source Source[T]) *Pipeline[T] {
+	return &Pipeline[T]{source: source}
+}
+
+// Then appends a step running fn with the given options.
+func (p *Pipeline[T]) Then(fn func(T) (T, error), opts ...StepOption) *Pipeline[T] {
+	if fn == nil {
+		// left nil for Validate to report
+		return p.ThenCtx(nil, opts...)
+	}
+	return p.ThenCtx(func(_ context.Context, v T) (T, error) {
+		return fn(v)
+	}, opts...)
+}
+
+// ThenCtx appends a step running a context-aware fn, see StepCtx.
+func (p *Pipeline[T]) ThenCtx(fn func(context.Context, T) (T, error), opts ...StepOption) *Pipeline[T] {
+	p.stages = append(p.stages, stage[T]{fn: fn, opts: opts})
+	return p
+}
+
+// Sink sets the handler called with every value leaving the last step. The
+// handler is called from a single goroutine. Without a sink the results are
+// discarded.
+func (p *Pipeline[T]) Sink(handler func(T) error) *Pipeline[T] {
+	p.sink = handler
+	return p
+}
+
+// DeadLetter switches the pipeline from failing fast to dead-lettering: a
+// value that fails in a step or in the sink is handed to handler together
+// with its error, and the rest of the stream keeps flowing. Sink failures are
+// reported with the stage name "sink". If handler itself returns an error the
+// pipeline is cancelled and Run returns it.
+//
+// An ErrorPolicy set with OnError still applies to dead-lettered values, so a
+// pipeline can dead-letter and give up after too many failures.
+func (p *Pipeline[T]) DeadLetter(handler func(*StageError) error) *Pipeline[T] {
+	p.deadLetter = handler
+	return p
+}
+
+// OnError sets what a failed value means for the run. Without it the
+// pipeline uses FailFast, or SkipErrors once a DeadLetter handler is set.
+func (p *Pipeline[T]) OnError(policy ErrorPolicy) *Pipeline[T] {
+	p.policy = &policy
+	return p
+}
+
+// Logger makes the pipeline's steps log to l, unless they have a logger of
+// their own, see WithLogger. Give it the attributes every line should have,
+// e.g. slog.With("pipeline", "orders"); steps add their "stage".
+func (p *Pipeline[T]) Logger(l *slog.Logger) *Pipeline[T] {
+	p.logger = l
+	return p
+}
+
+// Run starts the pipeline and blocks until every value has been handled by
+// the sink. Failures from any step or from the sink are handled according to
+// the pipeline's ErrorPolicy, by default the first one cancels the pipeline
+// and is returned. If ctx is done first, its cause is returned, see
+// context.Cause, if the pipeline's Timeout or Deadline passes first, an
+// error wrapping ErrDeadlineExceeded, and if a Drain gives up waiting, an
+// error wrapping ErrDrainTimeout. Use Drain or Shutdown from another
+// goroutine to stop a running pipeline gracefully.
+//
+// Once Run returns the contexts of the source and the steps are cancelled
+// with what it returned as their cause, or context.Canceled if it returned
+// nil, so work still winding down can tell why.
+//
+// A Pipeline runs once at a time; calling Run again while it is running
+// returns ErrRunning. See RunResult for a summary of the run.
+func (p *Pipeline[T]) Run(ctx context.Context) error {
+	_, err := p.RunResult(ctx)
+	return err
+}
+
+// RunResult is Run, also returning a Result summing up what the run did,
+// whichever way it ended.
+func (p *Pipeline[T]) RunResult(ctx context.Context) (Result, error) {
+	clock := ClockFrom(ctx)
+	counter := &progressCounter{clock: clock, start: clock.Now(), total: p.total}
+	err := p.execute(ctx, counter)
+	return newResult(counter, clock.Now().Sub(counter.start), err), err
+}
+
+// execute does the work behind Run, counting what it does in counter.
+func (p *Pipeline[T]) execute(ctx context.Context, counter *progressCounter) (err error) {
+	clock := counter.clock
+	ctx, cancelDeadline := p.withDeadline(ctx)
+	defer cancelDeadline()
+	// steps and sources see why the run ended through context.Cause
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer func() {
+		cancel(err)
+	}()
+
+	r := &run{
+		cancel: func() {
+			cancel(errDrainTimeout)
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	p.mu.Lock()
+	if p.run != nil {
+		p.mu.Unlock()
+		return ErrRunning
+	}
+	p.run = r
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.run = nil
+		if p.counter == counter {
+			p.ended = clock.Now()
+		}
+		p.mu.Unlock()
+		close(r.done)
+	}()
+	if p.hooks.OnPipelineDone != nil {
+		// deferred before anything changing err, so it sees what Run returns
+		defer func() {
+			p.hooks.OnPipelineDone(err)
+		}()
+	}
+
+	var offset int64
+	if p.checkpointer != nil {
+		if offset, err = p.checkpointer.Load(ctx); err != nil {
+			return fmt.Errorf("pipeline: loading checkpoint: %w", err)
+		}
+	}
+	progress := newWatermark(offset)
+	saved := offset
+	save := func(ctx context.Context) error {
+		next := progress.offset()
+		if p.checkpointer == nil || next == saved {
+			return nil
+		}
+		if err := p.checkpointer.Save(ctx, next); err != nil {
+			return fmt.Errorf("pipeline: saving checkpoint: %w", err)
+		}
+		saved = next
+		return nil
+	}
+	// whatever was handled stays handled, however the run ends
+	defer func() {
+		err = errors.Join(err, save(context.WithoutCancel(ctx)))
+	}()
+
+	// the source is stopped as soon as intake is, so it can wind down while
+	// the rest of the pipeline drains, and reports failures to the loop below
+	sourceCtx, stopSource := context.WithCancelCause(ctx)
+	defer func() {
+		stopSource(err)
+	}()
+	r.setStopSource(stopSource)
+	sourceErrs := make(chan error)
+	report := func(err error) {
+		select {
+		case <-ctx.Done():
+		case sourceErrs <- err:
+		}
+	}
+	sourceCtx = withSourceErrors(sourceCtx, func(err error) {
+		report(&StageError{Stage: "source", Err: err})
+	})
+
+	source, err := p.source(sourceCtx)
+	if err != nil {
+		return err
+	}
+	values := sequence(ctx, gate(ctx, source, r.stop, &p.valve), offset, &counter.produced)
+	if p.recordTo != nil {
+		var recorded <-chan struct{}
+		values, recorded = record(ctx, values, p.recordTo, p.recordCodec, report)
+		defer func() {
+			cancel(err)
+			<-recorded
+		}()
+	}
+	admitted := newAdmission(p.admitLimit, p.admitSize)
+	values = admitted.admit(ctx, values)
+
+	// steps run on sequenced values so Run knows which ones are done, the
+	// wrapping is hidden from everything the steps report
+	view := withInputView(func(v any) any {
+		return v.(sequenced[T]).value
+	})
+	// the values the steps' backpressure drops are done as they are, the
+	// loop below may be stuck in the sink meanwhile
+	drop := withDropped(func(v any) {
+		dropped := v.(sequenced[T])
+		progress.mark(dropped.seq)
+		admitted.release(dropped)
+	})
+	var slo *sloTracker
+	if p.sloEvery > 0 && len(p.slos) > 0 {
+		slo = newSLOTracker(clock, p.sloEvery, p.slos, p.sloBreach)
+	}
+	stepErrors := make([]<-chan error, 0, len(p.stages))
+	for i, s := range p.stages {
+		cfg := newStepConfig(s.opts)
+		fn := s.fn
+		// middleware is applied here so it sees the values themselves
+		if len(cfg.middleware) > 0 {
+			fn = applyMiddleware(fn, cfg.middleware)
+		}
+		call := func(ctx context.Context, v sequenced[T]) (sequenced[T], error) {
+			out, err := fn(ctx, v.value)
+			v.value = out
+			return v, err
+		}
+		opts := append(s.opts[:len(s.opts):len(s.opts)], view, drop, withoutMiddleware, reportSkips)
+		if p.classify != nil {
+			// before the step's own options, so its own classifier wins
+			opts = append([]StepOption{WithErrorClassifier(p.classify)}, opts...)
+		}
+		if p.logger != nil {
+			// before the step's own options, so its own logger wins
+			opts = append([]StepOption{WithLogger(p.logger)}, opts...)
+		}
+		name := cfg.name
+		if name == "" {
+			name = "step " + strconv.Itoa(i+1)
+		}
+		opts = append(opts, withLabel(name), withPipelineHooks(p.hooks))
+		// the Watchdog logs with the step's logger, stage attribute and all
+		logger := newStepConfig(opts).logger
+		opts = append(opts, withCounts(counter.stage(name, logger)))
+		if slo != nil {
+			if observe := slo.observer(name); observe != nil {
+				opts = append(opts, observe)
+			}
+		}
+		for _, r := range p.reporters {
+			opts = append(opts, WithErrorReporter(r))
+		}
+		if p.shared != nil {
+			opts = append(opts, withSharedLimits(p.shared))
+		}
+		var errs <-chan error
+		values, errs = StepCtx(ctx, values, call, opts...)
+		stepErrors = append(stepErrors, errs)
+	}
+	errs := Merge(ctx, stepErrors...)
+	// only once every step has its counts, snapshots read them
+	p.mu.Lock()
+	r.counter = counter
+	p.counter, p.ended = counter, time.Time{}
+	if slo != nil {
+		p.slo = slo
+	}
+	p.mu.Unlock()
+
+	tracker := &errorTracker{policy: p.errorPolicy()}
+	defer counter.update(tracker)
+
+	var tick <-chan time.Time
+	if p.checkpointer != nil && p.checkpointEvery > 0 {
+		ticker := clock.NewTicker(p.checkpointEvery)
+		defer ticker.Stop()
+		tick = ticker.C()
+	}
+
+	var stalled <-chan error
+	if p.stallAfter > 0 {
+		stalled = watch(ctx, counter, p.stallAfter, p.stallCancel)
+	}
+	if p.alertEvery > 0 && p.alertFire != nil && len(p.alertRules) > 0 {
+		defer alert(ctx, counter, p.alertEvery, p.alertRules, p.alertFire)()
+	}
+	if slo != nil {
+		defer slo.run(ctx)()
+	}
+	if p.heartbeatEvery > 0 && p.heartbeat != nil {
+		defer heartbeat(ctx, counter, p.heartbeatEvery, p.heartbeat)()
+	}
+	if p.summaryEvery > 0 {
+		logger := cmp.Or(p.summaryLogger, p.logger, slog.Default())
+		stopSummary := summarize(ctx, counter, p.summaryEvery, logger)
+		defer func() {
+			counter.update(tracker)
+			stopSummary(err)
+		}()
+	}
+
+	var progressTick <-chan time.Time
+	if p.progress != nil {
+		defer func() {
+			counter.update(tracker)
+			p.progress(counter.snapshot())
+		}()
+		if p.progressEvery > 0 {
+			ticker := clock.NewTicker(p.progressEvery)
+			defer ticker.Stop()
+			progressTick = ticker.C()
+		}
+	}
+
+	replay := &replayBuffer[T]{cfg: p.replay, clock: clock}
+	defer replay.stop()
+	state := &runState[T]{tracker: tracker, progress: progress, replay: replay, admitted: admitted, counter: counter, ctx: ctx}
+
+	// keep going until both the results and the errors have been drained, an
+	// error that happened just before the last result would be lost otherwise,
+	// and every value held for redelivery has been delivered
+	for values != nil || errs != nil || replay.len() > 0 {
+		counter.update(tracker)
+		in := values
+		if replay.full() {
+			in = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-tick:
+			if err := save(ctx); err != nil {
+				return err
+			}
+		case <-progressTick:
+			p.progress(counter.snapshot())
+		case err := <-stalled:
+			return err
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if err := p.fail(state, err); err != nil {
+				return err
+			}
+		case err := <-sourceErrs:
+			if err := p.fail(state, err); err != nil {
+				return err
+			}
+		case <-replay.due():
+			r := replay.next()
+			if err := p.deliver(state, r.value, r.attempts+1); err != nil {
+				return err
+			}
+		case v, ok := <-in:
+			if !ok {
+				values = nil
+				continue
+			}
+			if err := p.deliver(state, v, 1); err != nil {
+				return err
+			}
+		}
+	}
+
+	// a cancelled run may end with its channels closed rather than through
+	// ctx.Done above, its cause still wins over any errors kept
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return tracker.result()
+}
+
+// deliver hands v to the sink for the given attempt, returning the error
+// that should stop the run or nil to carry on. A value the sink fails on is
+// held for redelivery if the pipeline runs AtLeastOnce.
+func (p *Pipeline[T]) deliver(state *runState[T], v sequenced[T], attempt int) error {
+	if p.sink != nil {
+		if err := p.sink(v.value); err != nil {
+			class := classify(p.classify, err)
+			if state.replay.hold(v, attempt, class) {
+				return nil
+			}
+
+			switch class {
+			case ErrorSkip:
+				err = &skippedError{err: err}
+			case ErrorFatal:
+				err = Fatal(err)
+			}
+			stageErr := &StageError{Stage: "sink", Input: v.value, ID: correlationID(v.value), Attempts: attempt, Err: err}
+			if class != ErrorSkip {
+				reportError(state.ctx, p.reporters, "sink", v.value, stageErr)
+			}
+			return p.fail(state, stageErr)
+		}
+	}
+
+	state.tracker.succeeded()
+	state.done(v)
+	settle(v.value, nil)
+	return nil
+}
+
+// runState is what a run keeps track of as values leave it.
+type runState[T any] struct {
+	tracker  *errorTracker
+	progress *watermark
+	replay   *replayBuffer[T]
+	admitted *admission[T]
+	counter  *progressCounter
+	// ctx is the run's, for error reporters
+	ctx context.Context
+}
+
+// done records that v has left the run for good.
+func (s *runState[T]) done(v sequenced[T]) {
+	s.progress.mark(v.seq)
+	s.admitted.release(v)
+}
+
+func (p *Pipeline[T]) errorPolicy() ErrorPolicy {
+	if p.policy != nil {
+		return *p.policy
+	}
+	if p.deadLetter != nil {
+		return SkipErrors()
+	}
+	return FailFast()
+}
+
+// fail decides what a failed value means for the run, returning the error
+// that should stop it or nil to carry on. Values that don't stop the run
+// count as done for checkpointing, as do skipped ones, which aren't reported
+// at all. Failed values are settled with their error whatever happens to
+// the run, skipped ones as if they had succeeded.
+func (p *Pipeline[T]) fail(state *runState[T], err error) error {
+	var value *sequenced[T]
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		if v, ok := stageErr.raw.(sequenced[T]); ok {
+			value = &v
+		}
+	} else {
+		stageErr = &StageError{Err: err}
+	}
+
+	var skipped *skippedError
+	if errors.As(err, &skipped) {
+		state.counter.skipped.Add(1)
+		if value != nil {
+			state.done(*value)
+		}
+		settle(stageErr.Input, nil)
+		return nil
+	}
+	defer settle(stageErr.Input, err)
+	if p.hooks.OnItemError != nil {
+		p.hooks.OnItemError(stageErr)
+	}
+
+	if p.deadLetter != nil {
+		if err := p.deadLetter(stageErr); err != nil {
+			return err
+		}
+	}
+	if err := state.tracker.failed(err); err != nil {
+		return err
+	}
+
+	if value != nil {
+		state.done(*value)
+	}
+	return nil
+}
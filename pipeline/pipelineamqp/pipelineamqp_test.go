@@ -0,0 +1,192 @@
+package pipelineamqp
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+var errBad = errors.New("bad")
+
+// fakeChannel hands out deliveries, or fails to consume with err.
+type fakeChannel struct {
+	deliveries chan amqp.Delivery
+	err        error
+}
+
+func (c *fakeChannel) ConsumeWithContext(context.Context, string, string, bool, bool, bool, bool, amqp.Table) (<-chan amqp.Delivery, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.deliveries, nil
+}
+
+func (c *fakeChannel) Close() error { return nil }
+
+// acks records the deliveries acknowledged and rejected.
+type acks struct {
+	mu     sync.Mutex
+	acked  []uint64
+	nacked []uint64
+}
+
+func (a *acks) Ack(tag uint64, _ bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked = append(a.acked, tag)
+	return nil
+}
+
+func (a *acks) Nack(tag uint64, _ bool, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if requeue {
+		a.nacked = append(a.nacked, tag)
+	}
+	return nil
+}
+
+func (a *acks) Reject(tag uint64, requeue bool) error { return a.Nack(tag, false, requeue) }
+
+func (a *acks) get() (acked, nacked []uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	acked, nacked = slices.Clone(a.acked), slices.Clone(a.nacked)
+	slices.Sort(acked)
+	slices.Sort(nacked)
+	return acked, nacked
+}
+
+// closedChannel returns a channel that has delivered ds and been closed.
+func closedChannel(ds ...amqp.Delivery) *fakeChannel {
+	c := &fakeChannel{deliveries: make(chan amqp.Delivery, len(ds))}
+	for _, d := range ds {
+		c.deliveries <- d
+	}
+	close(c.deliveries)
+	return c
+}
+
+func TestMessageSource(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	a := &acks{}
+	c := &Consumer{channel: closedChannel(
+		amqp.Delivery{Acknowledger: a, DeliveryTag: 1, Body: []byte("ok"), ContentType: "application/json",
+			Headers: amqp.Table{"traceparent": "00-abc-def-01", "x-correlation-id": []byte("from-header")}},
+		amqp.Delivery{Acknowledger: a, DeliveryTag: 2, Body: []byte("ok"), CorrelationId: "from-property"},
+		amqp.Delivery{Acknowledger: a, DeliveryTag: 3, Body: []byte("bad")},
+	), queue: "orders"}
+
+	var mu sync.Mutex
+	var got []pipeline.Message[amqp.Delivery]
+	err := pipeline.New(c.MessageSource()).
+		Then(func(m pipeline.Message[amqp.Delivery]) (pipeline.Message[amqp.Delivery], error) {
+			if string(m.Payload.Body) == "bad" {
+				return m, errBad
+			}
+			return m, nil
+		}).
+		OnError(pipeline.CollectErrors()).
+		Sink(func(m pipeline.Message[amqp.Delivery]) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, m)
+			return nil
+		}).
+		Run(context.Background())
+
+	// the deliveries closing fails the source
+	if !errors.Is(err, errBad) || !errors.Is(err, ErrClosed) || !errors.Is(c.Err(), ErrClosed) {
+		t.Errorf("Run = %v, Err = %v, want %v and %v", err, c.Err(), errBad, ErrClosed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	slices.SortFunc(got, func(a, b pipeline.Message[amqp.Delivery]) int {
+		return int(a.Payload.DeliveryTag) - int(b.Payload.DeliveryTag)
+	})
+	if len(got) != 2 {
+		t.Fatalf("sink got %d messages, want 2", len(got))
+	}
+	if h := got[0].Headers; got[0].ID != "from-header" || h.Get("traceparent") != "00-abc-def-01" || h.Get("Content-Type") != "application/json" {
+		t.Errorf("first message has ID %q and headers %v", got[0].ID, h)
+	}
+	if got[1].ID != "from-property" {
+		t.Errorf("second message has ID %q, want the delivery's CorrelationId", got[1].ID)
+	}
+
+	acked, nacked := a.get()
+	if !slices.Equal(acked, []uint64{1, 2}) || !slices.Equal(nacked, []uint64{3}) {
+		t.Errorf("acked %v and requeued %v, want [1 2] and [3]", acked, nacked)
+	}
+}
+
+func TestSourceConsumeFails(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	c := &Consumer{channel: &fakeChannel{err: errBad}, queue: "orders"}
+	err := pipeline.New(c.Source()).Sink(func(amqp.Delivery) error { return nil }).Run(context.Background())
+
+	var stageErr *pipeline.StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "source" || !errors.Is(err, errBad) || !errors.Is(c.Err(), errBad) {
+		t.Errorf("Run = %v, Err = %v, want the source failing with %v", err, c.Err(), errBad)
+	}
+}
+
+// TestSourceStops checks a source stopped by its context isn't reported as
+// failing, with the channel still open.
+func TestSourceStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	a := &acks{}
+	ch := &fakeChannel{deliveries: make(chan amqp.Delivery)}
+	c := &Consumer{channel: ch, queue: "orders"}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(c.Source()).
+			Sink(c.Sink(func(amqp.Delivery) error {
+				cancel()
+				return nil
+			})).
+			Run(ctx)
+	}()
+	ch.deliveries <- amqp.Delivery{Acknowledger: a, DeliveryTag: 1}
+
+	if err := <-done; !errors.Is(err, context.Canceled) || c.Err() != nil {
+		t.Errorf("Run = %v, Err = %v, want %v and no error kept", err, c.Err(), context.Canceled)
+	}
+	if acked, _ := a.get(); !slices.Equal(acked, []uint64{1}) {
+		t.Errorf("acked %v, want [1]", acked)
+	}
+}
+
+func TestSink(t *testing.T) {
+	a := &acks{}
+	c := &Consumer{channel: &fakeChannel{}, queue: "orders"}
+	sink := c.Sink(func(d amqp.Delivery) error {
+		if d.DeliveryTag == 2 {
+			return errBad
+		}
+		return nil
+	})
+
+	if err := sink(amqp.Delivery{Acknowledger: a, DeliveryTag: 1}); err != nil {
+		t.Errorf("sink(1) = %v", err)
+	}
+	if err := sink(amqp.Delivery{Acknowledger: a, DeliveryTag: 2}); !errors.Is(err, errBad) {
+		t.Errorf("sink(2) = %v, want %v", err, errBad)
+	}
+	if acked, nacked := a.get(); !slices.Equal(acked, []uint64{1}) || !slices.Equal(nacked, []uint64{2}) {
+		t.Errorf("acked %v and requeued %v, want [1] and [2]", acked, nacked)
+	}
+}
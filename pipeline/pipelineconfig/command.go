@@ -0,0 +1,193 @@
+package pipelineconfig
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+const usage = `usage: pipelinectl run [flags] config.yaml
+
+Runs the pipeline the config file describes.
+
+Flags:
+`
+
+// Main is the pipelinectl command line tool for the components of r, for
+// programs shipping their own sources, stages and sinks to build theirs
+// from:
+//
+//	func main() {
+//		r := pipelineconfig.NewRegistry()
+//		pipelineconfig.RegisterStage(r, "price", price)
+//		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//		defer stop()
+//		os.Exit(pipelineconfig.Main(ctx, r, os.Args[1:], os.Stdout, os.Stderr))
+//	}
+//
+// It takes the arguments after the program name,
+//
+//	run [-dry-run] [-log-level level] [-env prefix] [-set key=value]...
+//	    [-concurrency [stage=]n]... config.yaml
+//
+// and returns the exit code: 0 once the pipeline has run, 1 if it failed
+// and 2 for bad arguments or config files. -env overrides the tunables of
+// the stages with the environment variables starting with the prefix, see
+// Config.SetEnv, then -set with the values given, see Config.Set, and may
+// be repeated; everything wrong with them is reported at once.
+// -concurrency overrides the concurrency of the stage named, or given a
+// bare number of every other stage, and may be repeated. -dry-run builds
+// the pipeline and runs the checks of its nodes, see RegisterCheck, instead
+// of running it, printing it as a Mermaid diagram if they pass, or every
+// problem they found and exiting with 1 if not. Logs go to stderr, at info
+// level and above unless -log-level says otherwise, through slog.Default,
+// which Main replaces.
+func Main(ctx context.Context, r *Registry, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("pipelinectl run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	dryRun := flags.Bool("dry-run", false, "build and check the pipeline and print it instead of running it")
+	var level slog.Level
+	flags.TextVar(&level, "log-level", slog.LevelInfo, "log `level`: debug, info, warn or error")
+	env := flags.String("env", "", "override tunables with the environment variables starting with `prefix`_")
+	var set setFlag
+	flags.Var(&set, "set", "override a tunable, `[stage.]key=value`")
+	concurrency := concurrencyFlag{}
+	flags.Var(concurrency, "concurrency", "`[stage=]n` values processed at a time by stage, or by every stage")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level})))
+
+	cfg, err := Read(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var errs []error
+	if *env != "" {
+		errs = append(errs, cfg.SetEnv(*env, os.Environ()))
+	}
+	for _, kv := range set {
+		key, value, _ := strings.Cut(kv, "=")
+		errs = append(errs, cfg.Set(key, value))
+	}
+	if err := errors.Join(errs...); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if err := concurrency.apply(&cfg); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	g, err := r.Build(cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if *dryRun {
+		if err := g.ValidateContext(ctx); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprint(stdout, g.Describe(pipeline.Mermaid))
+		return 0
+	}
+	if err := g.Run(ctx); err != nil {
+		slog.Error("pipeline failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// setFlag are the key=value pairs of -set, in order.
+type setFlag []string
+
+func (f *setFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *setFlag) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return errors.New("want key=value")
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+// concurrencyFlag is the concurrency of stages by name, "" for every one.
+type concurrencyFlag map[string]int
+
+func (f concurrencyFlag) String() string {
+	var parts []string
+	for stage, n := range f {
+		parts = append(parts, stage+"="+strconv.Itoa(n))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f concurrencyFlag) Set(s string) error {
+	stage, value, ok := strings.Cut(s, "=")
+	if !ok {
+		stage, value = "", s
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return errors.New("concurrency must be a positive number")
+	}
+
+	f[stage] = n
+	return nil
+}
+
+// apply overrides the concurrency of cfg's stages, failing for stages it
+// doesn't have.
+func (f concurrencyFlag) apply(cfg *Config) error {
+	for stage := range f {
+		if stage != "" && !hasStage(cfg, stage) {
+			return fmt.Errorf("pipelineconfig: -concurrency: no stage %q", stage)
+		}
+	}
+	for i := range cfg.Stages {
+		n, ok := f[cfg.Stages[i].Name]
+		if !ok {
+			n, ok = f[""]
+		}
+		if ok {
+			cfg.Stages[i].Concurrency = n
+		}
+	}
+
+	return nil
+}
+
+func hasStage(cfg *Config, name string) bool {
+	for _, n := range cfg.Stages {
+		if n.Name == name {
+			return true
+		}
+	}
+	return false
+}
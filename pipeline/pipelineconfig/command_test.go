@@ -0,0 +1,122 @@
+package pipelineconfig_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineconfig"
+)
+
+func TestMainCommand(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	config := `
+sources:
+  - name: numbers
+stages:
+  - name: double
+    inputs: [numbers]
+  - name: again
+    func: double
+    inputs: [double]
+sinks:
+  - name: collect
+    inputs: [again]
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		failing bool
+		// checks are what the checks of the components called so return
+		checks     map[string]error
+		env        []string
+		wantCode   int
+		wantOut    []string
+		wantErr    string
+		wantValues []int
+	}{
+		{name: "no command", wantCode: 2, wantErr: "usage"},
+		{name: "no config", args: []string{"run"}, wantCode: 2, wantErr: "usage"},
+		{name: "run", args: []string{"run", path}, wantValues: []int{4, 8, 12}},
+		{
+			name:    "dry run",
+			args:    []string{"run", "-dry-run", "-concurrency", "3", "-concurrency", "again=1", path},
+			wantOut: []string{"double<br/>stage<br/>concurrency: 3", "again<br/>stage<br/>concurrency: 1"},
+		},
+		{
+			name:    "dry run checks pass",
+			args:    []string{"run", "-dry-run", path},
+			checks:  map[string]error{"numbers": nil, "double": nil},
+			wantOut: []string{"flowchart"},
+		},
+		{
+			name:     "dry run checks fail",
+			args:     []string{"run", "-dry-run", path},
+			checks:   map[string]error{"numbers": errors.New("unreachable"), "collect": errors.New("denied")},
+			wantCode: 1,
+			wantErr:  "pipeline: checking numbers: unreachable\npipeline: checking collect: denied",
+		},
+		{
+			name:    "env and set",
+			args:    []string{"run", "-dry-run", "-env", "APP", "-set", "again.buffer=8", path},
+			env:     []string{"APP_CONCURRENCY", "5"},
+			wantOut: []string{"double<br/>stage<br/>concurrency: 5", "again<br/>stage<br/>concurrency: 5<br/>buffer: 8"},
+		},
+		{
+			name:     "bad env and set",
+			args:     []string{"run", "-env", "APP", "-set", "triple.buffer=8", "-set", "buffer=-1", path},
+			env:      []string{"APP_DOUBLE_TIMEOUT", "soon"},
+			wantCode: 2,
+			wantErr:  `APP_DOUBLE_TIMEOUT: "soon" is not a duration` + "\n" + `pipelineconfig: triple.buffer: no stage "triple"`,
+		},
+		{name: "negative value", args: []string{"run", "-set", "buffer=-1", path}, wantCode: 2, wantErr: "buffer -1 is negative"},
+		{name: "unknown stage", args: []string{"run", "-concurrency", "triple=2", path}, wantCode: 2, wantErr: `no stage "triple"`},
+		{name: "bad concurrency", args: []string{"run", "-concurrency", "0", path}, wantCode: 2, wantErr: "positive"},
+		{name: "bad log level", args: []string{"run", "-log-level", "loud", path}, wantCode: 2, wantErr: "log-level"},
+		{name: "missing config", args: []string{"run", path + ".missing"}, wantCode: 2, wantErr: "no such file"},
+		{name: "failing run", args: []string{"run", "-log-level", "error", path}, failing: true, wantCode: 1, wantErr: "pipeline failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < len(tt.env); i += 2 {
+				t.Setenv(tt.env[i], tt.env[i+1])
+			}
+			r, got := registry()
+			if tt.failing {
+				pipelineconfig.RegisterStage(r, "double", func(int) (int, error) { return 0, errors.New("bad") })
+			}
+			for name, err := range tt.checks {
+				pipelineconfig.RegisterCheck(r, name, func(context.Context, pipelineconfig.Params) error { return err })
+			}
+
+			var stdout, stderr bytes.Buffer
+			code := pipelineconfig.Main(context.Background(), r, tt.args, &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d; stderr:\n%s", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("no %q in stdout:\n%s", want, stdout.String())
+				}
+			}
+			if !strings.Contains(stderr.String(), tt.wantErr) {
+				t.Errorf("no %q in stderr:\n%s", tt.wantErr, stderr.String())
+			}
+			if tt.wantValues != nil && !slices.Equal(got(), tt.wantValues) {
+				t.Errorf("sink got %v, want %v", got(), tt.wantValues)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package pipelineconfig
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tunables set the tunable of a stage a key names, the tunable's name in
+// config files with the fields of nested ones after a dot, parsing value.
+var tunables = map[string]func(n *Node, value string) error{
+	"concurrency":  intTunable(func(n *Node) *int { return &n.Concurrency }),
+	"buffer":       intTunable(func(n *Node) *int { return &n.Buffer }),
+	"ordered":      boolTunable(func(n *Node) *bool { return &n.Ordered }),
+	"worker_pool":  boolTunable(func(n *Node) *bool { return &n.WorkerPool }),
+	"timeout":      durationTunable(func(n *Node) *Duration { return &n.Timeout }),
+	"budget":       durationTunable(func(n *Node) *Duration { return &n.Budget }),
+	"backpressure": func(n *Node, value string) error { n.Backpressure = value; return nil },
+
+	"retry.attempts":    intTunable(func(n *Node) *int { return &retry(n).Attempts }),
+	"retry.backoff":     durationTunable(func(n *Node) *Duration { return &retry(n).Backoff }),
+	"retry.max_backoff": durationTunable(func(n *Node) *Duration { return &retry(n).MaxBackoff }),
+
+	"rate_limit.per_second": floatTunable(func(n *Node) *float64 { return &rateLimit(n).PerSecond }),
+	"rate_limit.burst":      intTunable(func(n *Node) *int { return &rateLimit(n).Burst }),
+
+	"autoscale.min":      intTunable(func(n *Node) *int { return &autoscale(n).Min }),
+	"autoscale.max":      intTunable(func(n *Node) *int { return &autoscale(n).Max }),
+	"autoscale.interval": durationTunable(func(n *Node) *Duration { return &autoscale(n).Interval }),
+
+	"circuit_breaker.threshold": intTunable(func(n *Node) *int { return &circuitBreaker(n).Threshold }),
+	"circuit_breaker.cooldown":  durationTunable(func(n *Node) *Duration { return &circuitBreaker(n).Cooldown }),
+}
+
+func intTunable(field func(*Node) *int) func(*Node, string) error {
+	return func(n *Node, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*field(n) = v
+		return nil
+	}
+}
+
+func floatTunable(field func(*Node) *float64) func(*Node, string) error {
+	return func(n *Node, value string) error {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*field(n) = v
+		return nil
+	}
+}
+
+func boolTunable(field func(*Node) *bool) func(*Node, string) error {
+	return func(n *Node, value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field(n) = v
+		return nil
+	}
+}
+
+func durationTunable(field func(*Node) *Duration) func(*Node, string) error {
+	return func(n *Node, value string) error {
+		var d Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("%q is not a duration", value)
+		}
+		*field(n) = d
+		return nil
+	}
+}
+
+func retry(n *Node) *Retry {
+	if n.Retry == nil {
+		n.Retry = &Retry{}
+	}
+	return n.Retry
+}
+
+func rateLimit(n *Node) *RateLimit {
+	if n.RateLimit == nil {
+		n.RateLimit = &RateLimit{}
+	}
+	return n.RateLimit
+}
+
+func autoscale(n *Node) *Autoscale {
+	if n.Autoscale == nil {
+		n.Autoscale = &Autoscale{}
+	}
+	return n.Autoscale
+}
+
+func circuitBreaker(n *Node) *CircuitBreaker {
+	if n.CircuitBreaker == nil {
+		n.CircuitBreaker = &CircuitBreaker{}
+	}
+	return n.CircuitBreaker
+}
+
+// Set overrides a tunable of cfg's stages with value, parsed as the
+// tunable's type. The key is the tunable's name in config files, with the
+// fields of nested ones after a dot, for every stage, or the stage's name
+// and a dot before that for one stage:
+//
+//	cfg.Set("concurrency", "4")
+//	cfg.Set("price.retry.attempts", "5")
+//
+// Set doesn't check the value makes sense, see Validate.
+func (cfg *Config) Set(key, value string) error {
+	stage, tunable := "", key
+	if _, ok := tunables[key]; !ok {
+		// the longest tunable the key ends in, stage names may have dots
+		// in them too
+		tunable = ""
+		for t := range tunables {
+			if strings.HasSuffix(key, "."+t) && len(t) > len(tunable) {
+				stage, tunable = strings.TrimSuffix(key, "."+t), t
+			}
+		}
+	}
+	if _, ok := tunables[tunable]; !ok {
+		return fmt.Errorf("pipelineconfig: %s: unknown tunable", key)
+	}
+	if stage != "" && !hasStage(cfg, stage) {
+		return fmt.Errorf("pipelineconfig: %s: no stage %q", key, stage)
+	}
+
+	if err := cfg.set(stage, tunable, value); err != nil {
+		return fmt.Errorf("pipelineconfig: %s: %w", key, err)
+	}
+	return nil
+}
+
+// set sets tunable of the stage called stage, or of every stage if empty.
+func (cfg *Config) set(stage, tunable, value string) error {
+	for i := range cfg.Stages {
+		if stage != "" && cfg.Stages[i].Name != stage {
+			continue
+		}
+		if err := tunables[tunable](&cfg.Stages[i], value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetEnv overrides the tunables of cfg's stages with the variables of
+// environ, as os.Environ returns them, whose names start with prefix and an
+// underscore, twelve-factor style. The rest of the name is the key Set takes
+// in upper case, with underscores for dots and for anything in stage names
+// but letters and digits:
+//
+//	ORDERS_CONCURRENCY=4
+//	ORDERS_PRICE_RETRY_ATTEMPTS=5
+//
+// SetEnv reports every variable it couldn't apply at once, and doesn't check
+// the values make sense, see Validate.
+func (cfg *Config) SetEnv(prefix string, environ []string) error {
+	// a stage's own variables are matched first, longest names first in
+	// case one stage's name starts with another's
+	stages := make([]string, 0, len(cfg.Stages))
+	for _, n := range cfg.Stages {
+		stages = append(stages, n.Name)
+	}
+	slices.SortFunc(stages, func(a, b string) int { return len(b) - len(a) })
+	keys := make(map[string]string, len(tunables))
+	for tunable := range tunables {
+		keys[envName(tunable)] = tunable
+	}
+
+	var errs []error
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		rest, ok := strings.CutPrefix(name, prefix+"_")
+		if !ok {
+			continue
+		}
+
+		stage, tunable, ok := "", keys[rest], keys[rest] != ""
+		for _, s := range stages {
+			if ok {
+				break
+			}
+			if t, found := strings.CutPrefix(rest, envName(s)+"_"); found && keys[t] != "" {
+				stage, tunable, ok = s, keys[t], true
+			}
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("pipelineconfig: %s: no stage tunable by that name", name))
+			continue
+		}
+		if err := cfg.set(stage, tunable, value); err != nil {
+			errs = append(errs, fmt.Errorf("pipelineconfig: %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// envName is the environment variable name for s.
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// Validate checks every value of cfg's tunables makes sense and that its
+// nodes are named, reporting everything wrong at once.
+func (cfg Config) Validate() error {
+	var errs []error
+	bad := func(n Node, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("pipelineconfig: stage %q: %s", n.Name, fmt.Sprintf(format, args...)))
+	}
+
+	for _, nodes := range [][]Node{cfg.Sources, cfg.Stages, cfg.Sinks} {
+		for _, n := range nodes {
+			if n.Name == "" {
+				errs = append(errs, errors.New("pipelineconfig: a node has no name"))
+			}
+		}
+	}
+
+	for _, n := range cfg.Stages {
+		if n.Concurrency < 0 {
+			bad(n, "concurrency %d is negative", n.Concurrency)
+		}
+		if n.Buffer < 0 {
+			bad(n, "buffer %d is negative", n.Buffer)
+		}
+		if n.Timeout < 0 {
+			bad(n, "timeout %s is negative", time.Duration(n.Timeout))
+		}
+		if n.Budget < 0 {
+			bad(n, "budget %s is negative", time.Duration(n.Budget))
+		}
+		if _, ok := backpressure[n.Backpressure]; n.Backpressure != "" && !ok {
+			bad(n, "unknown backpressure %q", n.Backpressure)
+		}
+		if r := n.Retry; r != nil {
+			if r.Attempts < 1 {
+				bad(n, "retry attempts %d is less than 1", r.Attempts)
+			}
+			if r.Backoff < 0 {
+				bad(n, "retry backoff %s is negative", time.Duration(r.Backoff))
+			}
+			if r.MaxBackoff > 0 && r.MaxBackoff < r.Backoff {
+				bad(n, "retry max_backoff %s is less than backoff %s", time.Duration(r.MaxBackoff), time.Duration(r.Backoff))
+			}
+		}
+		if r := n.RateLimit; r != nil {
+			if r.PerSecond <= 0 {
+				bad(n, "rate_limit per_second %g is not positive", r.PerSecond)
+			}
+			if r.Burst < 0 {
+				bad(n, "rate_limit burst %d is negative", r.Burst)
+			}
+		}
+		if a := n.Autoscale; a != nil {
+			if a.Min < 1 {
+				bad(n, "autoscale min %d is less than 1", a.Min)
+			}
+			if a.Max < a.Min {
+				bad(n, "autoscale max %d is less than min %d", a.Max, a.Min)
+			}
+			if a.Interval <= 0 {
+				bad(n, "autoscale interval %s is not positive", time.Duration(a.Interval))
+			}
+		}
+		if b := n.CircuitBreaker; b != nil {
+			if b.Threshold < 1 {
+				bad(n, "circuit_breaker threshold %d is less than 1", b.Threshold)
+			}
+			if b.Cooldown <= 0 {
+				bad(n, "circuit_breaker cooldown %s is not positive", time.Duration(b.Cooldown))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,176 @@
+package pipelineconfig_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineconfig"
+)
+
+// stages returns a Config with a stage for every name.
+func stages(names ...string) pipelineconfig.Config {
+	var cfg pipelineconfig.Config
+	for _, name := range names {
+		cfg.Stages = append(cfg.Stages, pipelineconfig.Node{Name: name})
+	}
+	return cfg
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		check   func(cfg pipelineconfig.Config) bool
+		wantErr string
+	}{
+		{
+			name: "every stage", key: "concurrency", value: "4",
+			check: func(cfg pipelineconfig.Config) bool {
+				return cfg.Stages[0].Concurrency == 4 && cfg.Stages[1].Concurrency == 4
+			},
+		},
+		{
+			name: "one stage", key: "price.retry.attempts", value: "5",
+			check: func(cfg pipelineconfig.Config) bool {
+				return cfg.Stages[0].Retry.Attempts == 5 && cfg.Stages[1].Retry == nil
+			},
+		},
+		{
+			name: "stage with a dot", key: "store.v2.timeout", value: "2s",
+			check: func(cfg pipelineconfig.Config) bool {
+				return time.Duration(cfg.Stages[1].Timeout) == 2*time.Second
+			},
+		},
+		{
+			name: "bool", key: "price.ordered", value: "true",
+			check: func(cfg pipelineconfig.Config) bool { return cfg.Stages[0].Ordered },
+		},
+		{
+			name: "float", key: "rate_limit.per_second", value: "2.5",
+			check: func(cfg pipelineconfig.Config) bool { return cfg.Stages[1].RateLimit.PerSecond == 2.5 },
+		},
+		{name: "unknown tunable", key: "price.speed", value: "1", wantErr: "unknown tunable"},
+		{name: "unknown stage", key: "ship.buffer", value: "1", wantErr: `no stage "ship"`},
+		{name: "not a number", key: "buffer", value: "big", wantErr: `"big" is not a whole number`},
+		{name: "not a duration", key: "budget", value: "5", wantErr: `"5" is not a duration`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := stages("price", "store.v2")
+			err := cfg.Set(tt.key, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Set = %v, want an error with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("Set(%q, %q) gave %+v", tt.key, tt.value, cfg.Stages)
+			}
+		})
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	cfg := stages("price", "price-check")
+	err := cfg.SetEnv("APP", []string{
+		"HOME=/root",
+		"APP_CONCURRENCY=3",
+		"APP_PRICE_CHECK_BUFFER=8",
+		"APP_PRICE_RETRY_MAX_BACKOFF=1s",
+		"APP_PRICE_BUFFER=x",
+		"APP_SHIP_BUFFER=1",
+		"APP_PRICE_SPEED=1",
+	})
+
+	var got []string
+	for _, n := range cfg.Stages {
+		got = append(got, n.Name)
+		if n.Concurrency != 3 {
+			t.Errorf("%s has concurrency %d, want 3", n.Name, n.Concurrency)
+		}
+	}
+	if price, check := cfg.Stages[0], cfg.Stages[1]; price.Buffer != 0 || check.Buffer != 8 {
+		t.Errorf("buffers %d and %d, want 0 and 8", price.Buffer, check.Buffer)
+	}
+	if r := cfg.Stages[0].Retry; r == nil || time.Duration(r.MaxBackoff) != time.Second {
+		t.Errorf("price retry %+v, want a max backoff of 1s", r)
+	}
+
+	// every bad variable is reported
+	for _, want := range []string{`APP_PRICE_BUFFER: "x" is not a whole number`, "APP_SHIP_BUFFER", "APP_PRICE_SPEED"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("SetEnv = %v, want it to report %s", err, want)
+		}
+	}
+	if !slices.Equal(got, []string{"price", "price-check"}) {
+		t.Errorf("stages %v changed", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		node pipelineconfig.Node
+		want []string
+	}{
+		{name: "valid", node: pipelineconfig.Node{
+			Name: "ok", Concurrency: 2, Backpressure: "drop-oldest",
+			Retry:     &pipelineconfig.Retry{Attempts: 3, Backoff: pipelineconfig.Duration(time.Second)},
+			Autoscale: &pipelineconfig.Autoscale{Min: 1, Max: 4, Interval: pipelineconfig.Duration(time.Second)},
+		}},
+		{
+			name: "everything wrong",
+			node: pipelineconfig.Node{
+				Concurrency: -1, Buffer: -2, Backpressure: "sometimes",
+				Retry:          &pipelineconfig.Retry{Attempts: 0, Backoff: pipelineconfig.Duration(time.Second), MaxBackoff: pipelineconfig.Duration(time.Millisecond)},
+				RateLimit:      &pipelineconfig.RateLimit{PerSecond: 0},
+				Autoscale:      &pipelineconfig.Autoscale{Min: 4, Max: 2},
+				CircuitBreaker: &pipelineconfig.CircuitBreaker{Threshold: 0},
+			},
+			want: []string{
+				"a node has no name",
+				"concurrency -1 is negative",
+				"buffer -2 is negative",
+				`unknown backpressure "sometimes"`,
+				"retry attempts 0 is less than 1",
+				"retry max_backoff 1ms is less than backoff 1s",
+				"rate_limit per_second 0 is not positive",
+				"autoscale max 2 is less than min 4",
+				"autoscale interval 0s is not positive",
+				"circuit_breaker threshold 0 is less than 1",
+				"circuit_breaker cooldown 0s is not positive",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pipelineconfig.Config{Stages: []pipelineconfig.Node{tt.node}}.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate = nil")
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tt.want) {
+				t.Errorf("Validate reported %d problems, want %d:\n%v", got, len(tt.want), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate = %v, want it to report %q", err, want)
+				}
+			}
+		})
+	}
+}
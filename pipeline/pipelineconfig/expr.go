@@ -0,0 +1,63 @@
+package pipelineconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// errFiltered is what a filter stage skips the values it drops with.
+var errFiltered = errors.New("pipelineconfig: filtered out")
+
+// exprEnv is what expressions are evaluated against, the value as item.
+type exprEnv struct {
+	Item any `expr:"item"`
+}
+
+// compile compiles src, an expression in the language of
+// github.com/expr-lang/expr.
+func compile(src string, opts ...expr.Option) (*vm.Program, error) {
+	return expr.Compile(src, append([]expr.Option{expr.Env(exprEnv{})}, opts...)...)
+}
+
+// addExpression adds the stage n describes with Map or Filter to g.
+func addExpression(g *pipeline.Graph, n Node, opts []pipeline.StepOption) error {
+	if n.Func != "" || (n.Map != "" && n.Filter != "") {
+		return errors.New("only one of func, map and filter may be set")
+	}
+	if len(n.Params) > 0 {
+		return errors.New("expressions take no params")
+	}
+
+	if n.Map != "" {
+		program, err := compile(n.Map)
+		if err != nil {
+			return fmt.Errorf("map: %w", err)
+		}
+		pipeline.AddStage(g, n.Name, func(_ context.Context, v any) (any, error) {
+			return expr.Run(program, exprEnv{Item: v})
+		}, opts...)
+		return nil
+	}
+
+	program, err := compile(n.Filter, expr.AsBool())
+	if err != nil {
+		return fmt.Errorf("filter: %w", err)
+	}
+	pipeline.AddStage(g, n.Name, func(_ context.Context, v any) (any, error) {
+		keep, err := expr.Run(program, exprEnv{Item: v})
+		if err != nil {
+			return nil, err
+		}
+		if keep != true {
+			return nil, pipeline.Skip(errFiltered)
+		}
+		return v, nil
+	}, opts...)
+	return nil
+}
@@ -0,0 +1,120 @@
+package pipelineconfig_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineconfig"
+)
+
+type order struct {
+	Amount   int
+	Customer string
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		want       []string
+		wantErr    string
+		wantRunErr error
+	}{
+		{
+			name: "filter and map",
+			config: `
+sources:
+  - name: orders
+stages:
+  - name: large
+    inputs: [orders]
+    filter: item.Amount > 100
+  - name: customer
+    inputs: [large]
+    map: lower(item.Customer)
+sinks:
+  - name: names
+    inputs: [customer]
+`,
+			want: []string{"ada", "grace"},
+		},
+		{
+			name: "map to the wrong type",
+			config: `
+sources:
+  - name: orders
+stages:
+  - name: amount
+    inputs: [orders]
+    map: item.Amount
+sinks:
+  - name: names
+    inputs: [amount]
+`,
+			wantRunErr: pipeline.ErrUnexpectedType,
+		},
+		{
+			name:    "bad expression",
+			config:  "sources:\n  - name: orders\nstages:\n  - name: large\n    inputs: [orders]\n    filter: item.Amount >\n",
+			wantErr: `stage "large": filter:`,
+		},
+		{
+			name:    "not a condition",
+			config:  "sources:\n  - name: orders\nstages:\n  - name: large\n    inputs: [orders]\n    filter: '\"yes\"'\n",
+			wantErr: `stage "large": filter:`,
+		},
+		{
+			name:    "func and expression",
+			config:  "sources:\n  - name: orders\nstages:\n  - name: large\n    func: double\n    inputs: [orders]\n    map: item\n",
+			wantErr: "only one of func, map and filter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := pipelineconfig.ParseYAML([]byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var got []string
+			r := pipelineconfig.NewRegistry()
+			pipelineconfig.RegisterSource(r, "orders", pipeline.SliceSource([]order{
+				{Amount: 150, Customer: "Ada"},
+				{Amount: 20, Customer: "Alan"},
+				{Amount: 300, Customer: "Grace"},
+			}))
+			pipelineconfig.RegisterSink(r, "names", func(s string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, s)
+				return nil
+			})
+
+			g, err := r.Build(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Build() = %v, want an error about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = g.Run(context.Background())
+			if !errors.Is(err, tt.wantRunErr) {
+				t.Fatalf("Run() = %v, want %v", err, tt.wantRunErr)
+			}
+			slices.Sort(got)
+			if tt.want != nil && !slices.Equal(got, tt.want) {
+				t.Errorf("sink got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
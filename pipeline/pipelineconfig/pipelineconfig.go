@@ -0,0 +1,399 @@
+// Package pipelineconfig builds a pipeline.Graph from a YAML or JSON file, so
+// the wiring and tuning of a pipeline can change without recompiling. The
+// functions the nodes run are registered in code under a name and the file
+// refers to them by that name:
+//
+//	r := pipelineconfig.NewRegistry()
+//	pipelineconfig.RegisterSource(r, "orders", pipeline.SliceSource(orders))
+//	pipelineconfig.RegisterStage(r, "price", price)
+//	pipelineconfig.RegisterSink(r, "store", store)
+//
+//	g, err := pipelineconfig.Load("pipeline.yaml", r)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	err = g.Run(ctx)
+//
+// with pipeline.yaml reading:
+//
+//	sources:
+//	  - name: orders
+//	stages:
+//	  - name: price
+//	    inputs: [orders]
+//	    concurrency: 8
+//	    buffer: 16
+//	    retry:
+//	      attempts: 3
+//	      backoff: 100ms
+//	      max_backoff: 2s
+//	    rate_limit:
+//	      per_second: 50
+//	      burst: 10
+//	    backpressure: drop-oldest
+//	sinks:
+//	  - name: store
+//	    inputs: [price]
+//
+// Simple stages can be written in the config file instead, as expressions in
+// the language of github.com/expr-lang/expr on the value, item: a map stage
+// emits what its expression evaluates to and a filter stage only passes on
+// the values its expression is true for.
+//
+//	stages:
+//	  - name: large
+//	    inputs: [orders]
+//	    filter: item.Amount > 100
+//	  - name: customer
+//	    inputs: [large]
+//	    map: lower(item.Customer)
+//
+// Such stages read and emit any, so what they emit is checked against what
+// the nodes they feed read value by value, see pipeline.Graph.Connect.
+//
+// Connectors take their credentials as SecretParam params, which name a
+// secret rather than hold it, resolved through the SecretsProvider of the
+// Registry when the file is built:
+//
+//	r.SetSecrets(pipelinevault.New(vaultAddr, vaultToken), 5*time.Minute)
+//	pipelineconfig.RegisterSinkFactory(r, "postgres", []pipelineconfig.Param{
+//		{Name: "password", Type: pipelineconfig.SecretParam, Required: true},
+//	}, func(p pipelineconfig.Params) (func(Order) error, error) {
+//		return newPostgresSink(p.Secret("password")), nil
+//	})
+//
+// with the node reading password: orders-db#password.
+//
+// The tunables of the stages can be overridden once the file is read, from
+// the environment with Config.SetEnv, so a container can be configured
+// twelve-factor style, or with Config.Set, and are checked by Build, see
+// Config.Validate:
+//
+//	cfg, err := pipelineconfig.Read("pipeline.yaml")
+//	...
+//	// ORDERS_PRICE_CONCURRENCY=8 sets the concurrency of the price stage
+//	if err := cfg.SetEnv("ORDERS", os.Environ()); err != nil {
+//		log.Fatal(err)
+//	}
+//	g, err := r.Build(cfg)
+//
+// A file can give the version of the definition, version: 3 say, so a
+// service can roll out a new one with Swap, which builds the file and swaps
+// it into a pipeline.Manager unless the version running is the same:
+//
+//	if err := pipelineconfig.Swap(ctx, m, "orders", "pipeline.yaml", r); err != nil {
+//		log.Print(err)
+//	}
+package pipelineconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Config is the topology of a pipeline.
+type Config struct {
+	// Version identifies this definition of the pipeline, see Swap.
+	Version string `json:"version" yaml:"version"`
+
+	Sources []Node `json:"sources" yaml:"sources"`
+	Stages  []Node `json:"stages" yaml:"stages"`
+	Sinks   []Node `json:"sinks" yaml:"sinks"`
+}
+
+// Node is a source, stage or sink of the pipeline. The step options only
+// apply to stages.
+type Node struct {
+	// Name identifies the node in Inputs.
+	Name string `json:"name" yaml:"name"`
+	// Func is the registered function the node runs, Name if empty.
+	Func string `json:"func" yaml:"func"`
+	// Inputs are the names of the nodes feeding this one.
+	Inputs []string `json:"inputs" yaml:"inputs"`
+	// Params configure a function registered with a factory, see
+	// RegisterStageFactory.
+	Params map[string]any `json:"params" yaml:"params"`
+	// Map and Filter make a stage run an expression instead of a
+	// registered function, see the package documentation.
+	Map    string `json:"map" yaml:"map"`
+	Filter string `json:"filter" yaml:"filter"`
+
+	Concurrency int      `json:"concurrency" yaml:"concurrency"`
+	Buffer      int      `json:"buffer" yaml:"buffer"`
+	Ordered     bool     `json:"ordered" yaml:"ordered"`
+	WorkerPool  bool     `json:"worker_pool" yaml:"worker_pool"`
+	Timeout     Duration `json:"timeout" yaml:"timeout"`
+	Budget      Duration `json:"budget" yaml:"budget"`
+	Retry       *Retry   `json:"retry" yaml:"retry"`
+	// Backpressure is "block", the default, "drop-oldest" or
+	// "drop-newest", see pipeline.BackpressurePolicy.
+	Backpressure   string          `json:"backpressure" yaml:"backpressure"`
+	RateLimit      *RateLimit      `json:"rate_limit" yaml:"rate_limit"`
+	Autoscale      *Autoscale      `json:"autoscale" yaml:"autoscale"`
+	CircuitBreaker *CircuitBreaker `json:"circuit_breaker" yaml:"circuit_breaker"`
+}
+
+// Retry configures pipeline.WithRetry. Backoff is constant unless MaxBackoff
+// is set, in which case it is exponential from Backoff up to MaxBackoff.
+type Retry struct {
+	Attempts   int      `json:"attempts" yaml:"attempts"`
+	Backoff    Duration `json:"backoff" yaml:"backoff"`
+	MaxBackoff Duration `json:"max_backoff" yaml:"max_backoff"`
+}
+
+// RateLimit configures pipeline.WithRateLimit.
+type RateLimit struct {
+	PerSecond float64 `json:"per_second" yaml:"per_second"`
+	Burst     int     `json:"burst" yaml:"burst"`
+}
+
+// Autoscale configures pipeline.WithAutoscale.
+type Autoscale struct {
+	Min      int      `json:"min" yaml:"min"`
+	Max      int      `json:"max" yaml:"max"`
+	Interval Duration `json:"interval" yaml:"interval"`
+}
+
+// CircuitBreaker configures pipeline.WithCircuitBreaker.
+type CircuitBreaker struct {
+	Threshold int      `json:"threshold" yaml:"threshold"`
+	Cooldown  Duration `json:"cooldown" yaml:"cooldown"`
+}
+
+// Duration is a time.Duration written as a string such as "1.5s" in config
+// files.
+type Duration time.Duration
+
+// UnmarshalText parses d with time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText formats d like time.Duration.String.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Load reads the config file at path, see Read, and builds it with r.
+func Load(path string, r *Registry) (*pipeline.Graph, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Build(cfg)
+}
+
+// Swap loads the config file at path with r and swaps the graph into m as
+// the pipeline called name, with the file's Version, see
+// pipeline.Manager.Swap and the options it takes, e.g. pipeline.WithOverlap
+// to run both versions for a while. A pipeline m doesn't have yet is added
+// without being started. Nothing is swapped if the file has a Version and it
+// is the one m runs already.
+func Swap(ctx context.Context, m *pipeline.Manager, name, path string, r *Registry, opts ...pipeline.SwapOption) error {
+	cfg, err := Read(path)
+	if err != nil {
+		return err
+	}
+
+	current, err := m.Version(name)
+	known := err == nil
+	if err != nil && !errors.Is(err, pipeline.ErrUnknownPipeline) {
+		return err
+	}
+	if known && cfg.Version != "" && cfg.Version == current {
+		return nil
+	}
+
+	g, err := r.Build(cfg)
+	if err != nil {
+		return err
+	}
+	if !known {
+		// swapped in below for its version, which Add doesn't take
+		if err := m.Add(name, g); err != nil {
+			return err
+		}
+	}
+	return m.Swap(ctx, name, g, append(opts, pipeline.WithVersion(cfg.Version))...)
+}
+
+// Reconfigure builds the pipeline called name from definition, a config
+// file's contents in YAML or JSON, returning it with the definition's
+// Version, for pipeline.WithReconfigure.
+func (r *Registry) Reconfigure(name string, definition []byte) (pipeline.Runnable, string, error) {
+	cfg, err := ParseYAML(definition)
+	if err != nil {
+		return nil, "", fmt.Errorf("pipelineconfig: %s: %w", name, err)
+	}
+	g, err := r.Build(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return g, cfg.Version, nil
+}
+
+// Read reads the config file at path, YAML unless its extension is .json,
+// for changing it before Build.
+func Read(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if filepath.Ext(path) == ".json" {
+		cfg, err = ParseJSON(data)
+	} else {
+		cfg, err = ParseYAML(data)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("pipelineconfig: %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// ParseYAML decodes a Config from YAML, rejecting unknown fields.
+func ParseYAML(data []byte) (Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(&cfg)
+	return cfg, err
+}
+
+// ParseJSON decodes a Config from JSON, rejecting unknown fields.
+func ParseJSON(data []byte) (Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&cfg)
+	return cfg, err
+}
+
+// Build turns cfg into a Graph, looking up the functions of its nodes in r.
+// cfg is validated, see Config.Validate, and so is the graph, see
+// pipeline.Graph.Validate.
+func (r *Registry) Build(cfg Config) (*pipeline.Graph, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	g := pipeline.NewGraph()
+
+	for _, n := range cfg.Sources {
+		if err := r.add(g, sourceKind, n, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range cfg.Stages {
+		opts, err := n.options()
+		if err != nil {
+			return nil, fmt.Errorf("pipelineconfig: stage %q: %w", n.Name, err)
+		}
+		if n.Map != "" || n.Filter != "" {
+			if err := addExpression(g, n, opts); err != nil {
+				return nil, fmt.Errorf("pipelineconfig: stage %q: %w", n.Name, err)
+			}
+			continue
+		}
+		if err := r.add(g, stageKind, n, opts); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range cfg.Sinks {
+		if err := r.add(g, sinkKind, n, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, nodes := range [][]Node{cfg.Stages, cfg.Sinks} {
+		for _, n := range nodes {
+			for _, in := range n.Inputs {
+				g.Connect(in, n.Name)
+			}
+		}
+	}
+
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (n Node) fn() string {
+	if n.Func != "" {
+		return n.Func
+	}
+	return n.Name
+}
+
+func (n Node) options() ([]pipeline.StepOption, error) {
+	var opts []pipeline.StepOption
+	if n.Concurrency > 0 {
+		opts = append(opts, pipeline.WithConcurrency(n.Concurrency))
+	}
+	if n.Buffer > 0 {
+		opts = append(opts, pipeline.WithBuffer(n.Buffer))
+	}
+	if n.Ordered {
+		opts = append(opts, pipeline.WithOrderedOutput())
+	}
+	if n.Timeout > 0 {
+		opts = append(opts, pipeline.WithItemTimeout(time.Duration(n.Timeout)))
+	}
+	if n.Retry != nil {
+		backoff := pipeline.ConstantBackoff(time.Duration(n.Retry.Backoff))
+		if n.Retry.MaxBackoff > 0 {
+			backoff = pipeline.ExponentialBackoff(time.Duration(n.Retry.Backoff), time.Duration(n.Retry.MaxBackoff))
+		}
+		opts = append(opts, pipeline.WithRetry(n.Retry.Attempts, backoff))
+	}
+	if n.WorkerPool {
+		opts = append(opts, pipeline.WithWorkerPool())
+	}
+	if n.Budget > 0 {
+		opts = append(opts, pipeline.WithBudget(time.Duration(n.Budget)))
+	}
+	if n.Backpressure != "" {
+		policy, ok := backpressure[n.Backpressure]
+		if !ok {
+			return nil, fmt.Errorf("unknown backpressure %q", n.Backpressure)
+		}
+		opts = append(opts, pipeline.WithBackpressure(policy))
+	}
+	if n.RateLimit != nil {
+		opts = append(opts, pipeline.WithRateLimit(rate.Limit(n.RateLimit.PerSecond), max(n.RateLimit.Burst, 1)))
+	}
+	if n.Autoscale != nil {
+		opts = append(opts, pipeline.WithAutoscale(n.Autoscale.Min, n.Autoscale.Max, time.Duration(n.Autoscale.Interval)))
+	}
+	if n.CircuitBreaker != nil {
+		opts = append(opts, pipeline.WithCircuitBreaker(n.CircuitBreaker.Threshold, time.Duration(n.CircuitBreaker.Cooldown)))
+	}
+
+	return opts, nil
+}
+
+// backpressure are the pipeline.BackpressurePolicy values by name.
+var backpressure = map[string]pipeline.BackpressurePolicy{
+	pipeline.Block.String():      pipeline.Block,
+	pipeline.DropOldest.String(): pipeline.DropOldest,
+	pipeline.DropNewest.String(): pipeline.DropNewest,
+}
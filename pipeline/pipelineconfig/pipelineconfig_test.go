@@ -0,0 +1,266 @@
+package pipelineconfig_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineconfig"
+)
+
+// registry registers a source of 1, 2 and 3, a "double" stage and a sink
+// collecting into the returned func's result.
+func registry() (*pipelineconfig.Registry, func() []int) {
+	var mu sync.Mutex
+	var got []int
+
+	r := pipelineconfig.NewRegistry()
+	pipelineconfig.RegisterSource(r, "numbers", pipeline.SliceSource([]int{1, 2, 3}))
+	pipelineconfig.RegisterStage(r, "double", func(v int) (int, error) { return v * 2, nil })
+	pipelineconfig.RegisterSink(r, "collect", func(v int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, v)
+		return nil
+	})
+
+	return r, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		slices.Sort(got)
+		return got
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		config      string
+		wantDetails []string
+		wantErr     string
+	}{
+		{
+			name: "yaml",
+			file: "pipeline.yaml",
+			config: `
+sources:
+  - name: numbers
+stages:
+  - name: double
+    inputs: [numbers]
+    buffer: 16
+    backpressure: drop-oldest
+    retry:
+      attempts: 3
+      backoff: 1ms
+    rate_limit:
+      per_second: 1000
+    autoscale:
+      min: 1
+      max: 4
+      interval: 1s
+    circuit_breaker:
+      threshold: 5
+      cooldown: 1s
+sinks:
+  - name: out
+    func: collect
+    inputs: [double]
+`,
+			wantDetails: []string{"workers: 1-4", "buffer: 16 (drop-oldest)", "attempts: 3"},
+		},
+		{
+			name: "json",
+			file: "pipeline.json",
+			config: `{
+	"sources": [{"name": "numbers"}],
+	"stages": [{"name": "double", "inputs": ["numbers"], "concurrency": 2, "ordered": true}],
+	"sinks": [{"name": "collect", "inputs": ["double"]}]
+}`,
+			wantDetails: []string{"concurrency: 2", "ordered"},
+		},
+		{
+			name:    "unknown field",
+			file:    "pipeline.yaml",
+			config:  "sources:\n  - name: numbers\n    concurency: 2\n",
+			wantErr: "concurency",
+		},
+		{
+			name:    "unknown function",
+			file:    "pipeline.yaml",
+			config:  "sources:\n  - name: letters\n",
+			wantErr: `no source registered as "letters"`,
+		},
+		{
+			name: "unknown backpressure",
+			file: "pipeline.yaml",
+			config: `
+sources:
+  - name: numbers
+stages:
+  - name: double
+    inputs: [numbers]
+    backpressure: drop-all
+`,
+			wantErr: `unknown backpressure "drop-all"`,
+		},
+		{
+			name: "unknown input",
+			file: "pipeline.yaml",
+			config: `
+sources:
+  - name: numbers
+sinks:
+  - name: collect
+    inputs: [double]
+`,
+			wantErr: "double",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			r, got := registry()
+			g, err := pipelineconfig.Load(path, r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() = %v, want an error about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diagram := g.Describe(pipeline.Mermaid)
+			for _, want := range tt.wantDetails {
+				if !strings.Contains(diagram, want) {
+					t.Errorf("no %q in\n%s", want, diagram)
+				}
+			}
+			if err := g.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if want := []int{2, 4, 6}; !slices.Equal(got(), want) {
+				t.Errorf("sink got %v, want %v", got(), want)
+			}
+		})
+	}
+}
+
+func TestSwap(t *testing.T) {
+	r := pipelineconfig.NewRegistry()
+	pipelineconfig.RegisterSource(r, "ticks", func(ctx context.Context) (<-chan int, error) {
+		out := make(chan int)
+		go func() {
+			defer close(out)
+			for i := 0; ; i++ {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- i:
+				}
+			}
+		}()
+		return out, nil
+	})
+	pipelineconfig.RegisterStage(r, "double", func(v int) (int, error) { return v * 2, nil })
+	pipelineconfig.RegisterSink(r, "discard", func(int) error { return nil })
+
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	write := func(version, stage string) {
+		t.Helper()
+		config := "version: " + version + `
+sources:
+  - name: ticks
+stages:
+  - name: ` + stage + `
+    func: double
+    inputs: [ticks]
+sinks:
+  - name: discard
+    inputs: [` + stage + `]
+`
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stages := func(m *pipeline.Manager) string {
+		var names []string
+		for _, st := range m.Status()["flow"].Stages {
+			names = append(names, st.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	ctx := context.Background()
+	m := pipeline.NewManager(ctx)
+	defer m.Shutdown(ctx)
+
+	// a new pipeline is added, not started
+	write("1", "first")
+	if err := pipelineconfig.Swap(ctx, m, "flow", path, r); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Version("flow"); v != "1" || m.Status()["flow"].Running {
+		t.Fatalf("version %q, running %v, want version 1 not running", v, m.Status()["flow"].Running)
+	}
+	if err := m.Start("flow"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same version isn't swapped, whatever the file says
+	write("1", "changed")
+	if err := pipelineconfig.Swap(ctx, m, "flow", path, r); err != nil {
+		t.Fatal(err)
+	}
+	if got := stages(m); got != "first" {
+		t.Errorf("stages %q after swapping in the same version, want first", got)
+	}
+
+	write("2", "second")
+	if err := pipelineconfig.Swap(ctx, m, "flow", path, r); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Version("flow"); v != "2" || stages(m) != "second" {
+		t.Errorf("version %q with stages %q, want version 2 with second", v, stages(m))
+	}
+	for start := time.Now(); !m.Status()["flow"].Running; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the new version isn't running")
+		}
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	r, got := registry()
+
+	runnable, version, err := r.Reconfigure("flow", []byte(`{"version": "3", "sources": [{"name": "numbers"}], "sinks": [{"name": "collect", "inputs": ["numbers"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "3" {
+		t.Errorf("version %q, want 3", version)
+	}
+	if err := runnable.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got(), []int{1, 2, 3}) {
+		t.Errorf("sink got %v, want [1 2 3]", got())
+	}
+
+	if _, _, err := r.Reconfigure("flow", []byte("sources: [")); err == nil || !strings.Contains(err.Error(), "flow") {
+		t.Errorf("Reconfigure of a bad definition = %v, want an error naming the pipeline", err)
+	}
+}
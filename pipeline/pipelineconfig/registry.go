@@ -0,0 +1,457 @@
+package pipelineconfig
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Default is the registry packages of components register theirs with, in
+// an init func, so that every program importing them can refer to them:
+//
+//	func init() {
+//		pipelineconfig.RegisterSinkFactory(pipelineconfig.Default, "postgres", postgresParams, newPostgresSink)
+//	}
+//
+// Every Registry falls back to Default for the names it has nothing
+// registered under itself.
+var Default = NewRegistry()
+
+// Registry maps the names used in config files to functions, or to the
+// factories making them from the params of a node.
+type Registry struct {
+	mu         sync.RWMutex
+	components map[componentKey]component
+	// checks are the preflight checks of components by name, see
+	// RegisterCheck
+	checks    map[string]func(ctx context.Context, params Params) error
+	secrets   pipeline.SecretsProvider
+	secretTTL time.Duration
+}
+
+type kind int
+
+const (
+	sourceKind kind = iota
+	stageKind
+	sinkKind
+)
+
+func (k kind) String() string {
+	switch k {
+	case sourceKind:
+		return "source"
+	case stageKind:
+		return "stage"
+	default:
+		return "sink"
+	}
+}
+
+type componentKey struct {
+	kind kind
+	name string
+}
+
+// component adds a node to a graph. It is given the node's params, checked
+// against and completed from the schema, when there is one.
+type component struct {
+	schema []Param
+	add    func(g *pipeline.Graph, node string, params Params, opts []pipeline.StepOption) error
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		components: make(map[componentKey]component),
+		checks:     make(map[string]func(context.Context, Params) error),
+	}
+}
+
+func (r *Registry) register(k kind, name string, c component) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.components[componentKey{kind: k, name: name}] = c
+}
+
+func (r *Registry) lookup(k kind, name string) (component, bool) {
+	r.mu.RLock()
+	c, ok := r.components[componentKey{kind: k, name: name}]
+	r.mu.RUnlock()
+
+	if !ok && r != Default {
+		return Default.lookup(k, name)
+	}
+	return c, ok
+}
+
+// add adds the node n of kind k to g.
+func (r *Registry) add(g *pipeline.Graph, k kind, n Node, opts []pipeline.StepOption) error {
+	c, ok := r.lookup(k, n.fn())
+	if !ok {
+		return fmt.Errorf("pipelineconfig: %s %q: no %s registered as %q", k, n.Name, k, n.fn())
+	}
+	params, err := check(c.schema, n.Params)
+	if err == nil {
+		err = r.resolveSecrets(c.schema, params)
+	}
+	if err != nil {
+		return fmt.Errorf("pipelineconfig: %s %q: %w", k, n.Name, err)
+	}
+	if err := c.add(g, n.Name, params, opts); err != nil {
+		return fmt.Errorf("pipelineconfig: %s %q: %w", k, n.Name, err)
+	}
+	if check, ok := r.check(n.fn()); ok {
+		g.Check(n.Name, func(ctx context.Context) error {
+			return check(ctx, params)
+		})
+	}
+
+	return nil
+}
+
+// RegisterCheck makes the graphs r builds check every node running the
+// source, stage or sink called name with check, given the node's params,
+// when validated, e.g. connecting to the database a sink writes to, see
+// pipeline.Graph.ValidateContext and the -dry-run of Main.
+func RegisterCheck(r *Registry, name string, check func(ctx context.Context, params Params) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[name] = check
+}
+
+func (r *Registry) check(name string) (func(context.Context, Params) error, bool) {
+	r.mu.RLock()
+	check, ok := r.checks[name]
+	r.mu.RUnlock()
+
+	if !ok && r != Default {
+		return Default.check(name)
+	}
+	return check, ok
+}
+
+// SetSecrets makes r resolve the SecretParam params of nodes through p,
+// caching their values for ttl, see pipeline.NewSecret. Registries without
+// a provider of their own use Default's.
+func (r *Registry) SetSecrets(p pipeline.SecretsProvider, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.secrets, r.secretTTL = p, ttl
+}
+
+func (r *Registry) secretsProvider() (pipeline.SecretsProvider, time.Duration) {
+	r.mu.RLock()
+	p, ttl := r.secrets, r.secretTTL
+	r.mu.RUnlock()
+
+	if p == nil && r != Default {
+		return Default.secretsProvider()
+	}
+	return p, ttl
+}
+
+// resolveSecrets replaces the names of the secrets params holds with the
+// secrets, resolving them so that a node naming a missing one fails to
+// build rather than once the pipeline runs.
+func (r *Registry) resolveSecrets(schema []Param, params Params) error {
+	for _, param := range schema {
+		name, ok := params[param.Name].(string)
+		if param.Type != SecretParam || !ok {
+			continue
+		}
+		p, ttl := r.secretsProvider()
+		if p == nil {
+			return fmt.Errorf("param %q: no secrets provider, see Registry.SetSecrets", param.Name)
+		}
+		secret := pipeline.NewSecret(p, name, ttl)
+		if _, err := secret.Value(context.Background()); err != nil {
+			return fmt.Errorf("param %q: %w", param.Name, err)
+		}
+		params[param.Name] = secret
+	}
+	return nil
+}
+
+// Component is a name registered with a Registry, see Registry.Components.
+type Component struct {
+	// Kind is "source", "stage" or "sink".
+	Kind   string
+	Name   string
+	Params []Param
+}
+
+// Components lists what is registered with r, and with Default, by kind and
+// name, e.g. for a tool to document what its config files can refer to.
+func (r *Registry) Components() []Component {
+	seen := make(map[componentKey]bool)
+	var list []Component
+	for _, reg := range []*Registry{r, Default} {
+		reg.mu.RLock()
+		for k, c := range reg.components {
+			if !seen[k] {
+				seen[k] = true
+				list = append(list, Component{Kind: k.kind.String(), Name: k.name, Params: c.schema})
+			}
+		}
+		reg.mu.RUnlock()
+	}
+
+	slices.SortFunc(list, func(a, b Component) int {
+		return cmp.Or(cmp.Compare(kindOrder[a.Kind], kindOrder[b.Kind]), cmp.Compare(a.Name, b.Name))
+	})
+	return list
+}
+
+var kindOrder = map[string]int{"source": 0, "stage": 1, "sink": 2}
+
+// RegisterSource makes source available to config files under name.
+func RegisterSource[T any](r *Registry, name string, source pipeline.Source[T]) {
+	RegisterSourceFactory(r, name, nil, func(Params) (pipeline.Source[T], error) {
+		return source, nil
+	})
+}
+
+// RegisterStage makes fn available to config files under name.
+func RegisterStage[In any, Out any](r *Registry, name string, fn func(In) (Out, error)) {
+	RegisterStageCtx(r, name, func(_ context.Context, in In) (Out, error) {
+		return fn(in)
+	})
+}
+
+// RegisterStageCtx makes a context-aware fn available to config files under
+// name.
+func RegisterStageCtx[In any, Out any](r *Registry, name string, fn func(context.Context, In) (Out, error)) {
+	RegisterStageFactory(r, name, nil, func(Params) (func(context.Context, In) (Out, error), error) {
+		return fn, nil
+	})
+}
+
+// RegisterSink makes sink available to config files under name.
+func RegisterSink[T any](r *Registry, name string, sink func(T) error) {
+	RegisterSinkFactory(r, name, nil, func(Params) (func(T) error, error) {
+		return sink, nil
+	})
+}
+
+// RegisterSourceFactory makes the sources factory returns available to
+// config files under name: every node using it gets a source of its own,
+// made from its params, which must match schema.
+func RegisterSourceFactory[T any](r *Registry, name string, schema []Param, factory func(Params) (pipeline.Source[T], error)) {
+	r.register(sourceKind, name, component{schema: schema, add: func(g *pipeline.Graph, node string, params Params, _ []pipeline.StepOption) error {
+		source, err := factory(params)
+		if err != nil {
+			return err
+		}
+		pipeline.AddSource(g, node, source)
+		return nil
+	}})
+}
+
+// RegisterStageFactory makes the functions factory returns available to
+// config files under name, like RegisterSourceFactory:
+//
+//	pipelineconfig.RegisterStageFactory(r, "http-enrich", []pipelineconfig.Param{
+//		{Name: "url", Type: pipelineconfig.StringParam, Required: true},
+//		{Name: "timeout", Type: pipelineconfig.DurationParam, Default: 5 * time.Second},
+//	}, func(p pipelineconfig.Params) (func(context.Context, Order) (Order, error), error) {
+//		return newEnricher(p.String("url"), p.Duration("timeout")), nil
+//	})
+//
+// with a node in the config file reading:
+//
+//	stages:
+//	  - name: enrich
+//	    func: http-enrich
+//	    inputs: [orders]
+//	    params:
+//	      url: https://enrich.internal
+func RegisterStageFactory[In any, Out any](r *Registry, name string, schema []Param, factory func(Params) (func(context.Context, In) (Out, error), error)) {
+	r.register(stageKind, name, component{schema: schema, add: func(g *pipeline.Graph, node string, params Params, opts []pipeline.StepOption) error {
+		fn, err := factory(params)
+		if err != nil {
+			return err
+		}
+		pipeline.AddStage(g, node, fn, opts...)
+		return nil
+	}})
+}
+
+// RegisterSinkFactory makes the sinks factory returns available to config
+// files under name, like RegisterSourceFactory.
+func RegisterSinkFactory[T any](r *Registry, name string, schema []Param, factory func(Params) (func(T) error, error)) {
+	r.register(sinkKind, name, component{schema: schema, add: func(g *pipeline.Graph, node string, params Params, _ []pipeline.StepOption) error {
+		sink, err := factory(params)
+		if err != nil {
+			return err
+		}
+		pipeline.AddSink(g, node, sink)
+		return nil
+	}})
+}
+
+// ParamType is the type of a Param.
+type ParamType int
+
+const (
+	StringParam ParamType = iota
+	IntParam
+	FloatParam
+	BoolParam
+	// DurationParam is a time.Duration written as a string such as "1.5s".
+	DurationParam
+	// SecretParam is a *pipeline.Secret, written as the name of the secret
+	// in the provider of the Registry, see Registry.SetSecrets, so config
+	// files don't hold credentials.
+	SecretParam
+)
+
+func (t ParamType) String() string {
+	switch t {
+	case StringParam:
+		return "string"
+	case IntParam:
+		return "int"
+	case FloatParam:
+		return "float"
+	case BoolParam:
+		return "bool"
+	case DurationParam:
+		return "duration"
+	case SecretParam:
+		return "secret"
+	default:
+		return "unknown"
+	}
+}
+
+// Param describes a param factories take: its name, type and whether a node
+// must set it, or else the Default it takes, which is of the Go type its
+// Params getter returns.
+type Param struct {
+	Name     string
+	Type     ParamType
+	Required bool
+	Default  any
+	Doc      string
+}
+
+// Params are the params of a node, checked against the factory's schema:
+// every one of them is set, to the value of the getter for its type, unless
+// it is optional without a default.
+type Params map[string]any
+
+// String returns the string param name, "" if it isn't set.
+func (p Params) String(name string) string {
+	s, _ := p[name].(string)
+	return s
+}
+
+// Int returns the int param name, 0 if it isn't set.
+func (p Params) Int(name string) int {
+	n, _ := p[name].(int)
+	return n
+}
+
+// Float returns the float param name, 0 if it isn't set.
+func (p Params) Float(name string) float64 {
+	f, _ := p[name].(float64)
+	return f
+}
+
+// Bool returns the bool param name, false if it isn't set.
+func (p Params) Bool(name string) bool {
+	b, _ := p[name].(bool)
+	return b
+}
+
+// Duration returns the duration param name, 0 if it isn't set.
+func (p Params) Duration(name string) time.Duration {
+	d, _ := p[name].(time.Duration)
+	return d
+}
+
+// Secret returns the secret param name, nil if it isn't set.
+func (p Params) Secret(name string) *pipeline.Secret {
+	s, _ := p[name].(*pipeline.Secret)
+	return s
+}
+
+// check checks the params of a node against schema, converting them to the
+// types of their getters and filling in defaults.
+func check(schema []Param, values map[string]any) (Params, error) {
+	params := make(Params, len(schema))
+	known := make(map[string]bool, len(schema))
+	for _, param := range schema {
+		known[param.Name] = true
+
+		v, ok := values[param.Name]
+		if !ok {
+			if param.Required {
+				return nil, fmt.Errorf("param %q is required", param.Name)
+			}
+			if param.Default != nil {
+				params[param.Name] = param.Default
+			}
+			continue
+		}
+		converted, err := convert(param.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("param %q: %w", param.Name, err)
+		}
+		params[param.Name] = converted
+	}
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown param %q", name)
+		}
+	}
+
+	return params, nil
+}
+
+// convert converts v, as decoded from YAML or JSON, to the Go type of t.
+func convert(t ParamType, v any) (any, error) {
+	switch t {
+	case StringParam, SecretParam:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case IntParam:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case float64:
+			// JSON numbers
+			if n == math.Trunc(n) {
+				return int(n), nil
+			}
+		}
+	case FloatParam:
+		switch n := v.(type) {
+		case int:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+	case BoolParam:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case DurationParam:
+		if s, ok := v.(string); ok {
+			return time.ParseDuration(s)
+		}
+	}
+
+	return nil, fmt.Errorf("%v is not a %s", v, t)
+}
@@ -0,0 +1,183 @@
+package pipelineconfig_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineconfig"
+)
+
+func TestFactories(t *testing.T) {
+	schema := []pipelineconfig.Param{
+		{Name: "factor", Type: pipelineconfig.IntParam, Required: true},
+		{Name: "offset", Type: pipelineconfig.FloatParam, Default: 0.5},
+		{Name: "delay", Type: pipelineconfig.DurationParam, Default: time.Duration(0)},
+		{Name: "negate", Type: pipelineconfig.BoolParam},
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		json    bool
+		want    []float64
+		wantErr string
+	}{
+		{name: "defaults", config: "params: {factor: 2}", want: []float64{2.5, 4.5}},
+		{name: "every param", config: "params: {factor: 3, offset: 1, delay: 1ms, negate: true}", want: []float64{-5, -2}},
+		{name: "json numbers", config: `{"name": "scale", "inputs": ["numbers"], "params": {"factor": 2, "offset": 1.5}}`, json: true, want: []float64{3.5, 5.5}},
+		{name: "missing", config: "params: {offset: 1}", wantErr: `stage "scale": param "factor" is required`},
+		{name: "unknown", config: "params: {factor: 2, scale: 3}", wantErr: `unknown param "scale"`},
+		{name: "wrong type", config: "params: {factor: two}", wantErr: `param "factor": two is not a int`},
+		{name: "fractional int", config: `{"name": "scale", "inputs": ["numbers"], "params": {"factor": 2.5}}`, json: true, wantErr: "is not a int"},
+		{name: "bad duration", config: "params: {factor: 2, delay: soon}", wantErr: `param "delay"`},
+		{name: "factory fails", config: "params: {factor: 0}", wantErr: "factor must not be 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg pipelineconfig.Config
+			var err error
+			if tt.json {
+				cfg, err = pipelineconfig.ParseJSON([]byte(`{"sources": [{"name": "numbers"}], "stages": [` + tt.config + `], "sinks": [{"name": "collect", "inputs": ["scale"]}]}`))
+			} else {
+				cfg, err = pipelineconfig.ParseYAML([]byte("sources: [{name: numbers}]\nstages:\n  - name: scale\n    inputs: [numbers]\n    " + tt.config + "\nsinks: [{name: collect, inputs: [scale]}]\n"))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var got []float64
+			r := pipelineconfig.NewRegistry()
+			pipelineconfig.RegisterSource(r, "numbers", pipeline.SliceSource([]int{1, 2}))
+			pipelineconfig.RegisterStageFactory(r, "scale", schema, func(p pipelineconfig.Params) (func(context.Context, int) (float64, error), error) {
+				factor, offset := p.Int("factor"), p.Float("offset")
+				if factor == 0 {
+					return nil, errors.New("factor must not be 0")
+				}
+				if p.Bool("negate") {
+					factor = -factor
+				}
+				delay := p.Duration("delay")
+				return func(_ context.Context, v int) (float64, error) {
+					time.Sleep(delay)
+					return float64(v*factor) + offset, nil
+				}, nil
+			})
+			pipelineconfig.RegisterSink(r, "collect", func(v float64) error {
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, v)
+				return nil
+			})
+
+			g, err := r.Build(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Build() = %v, want an error about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := g.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sink got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	pipelineconfig.RegisterSink(pipelineconfig.Default, "test-discard", func(int) error { return nil })
+
+	r, _ := registry()
+	cfg, err := pipelineconfig.ParseYAML([]byte("sources: [{name: numbers}]\nsinks: [{name: out, func: test-discard, inputs: [numbers]}]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Build(cfg); err != nil {
+		t.Fatalf("Build() = %v, want the sink found in Default", err)
+	}
+
+	var names []string
+	for _, c := range r.Components() {
+		names = append(names, c.Kind+" "+c.Name)
+	}
+	want := []string{"source numbers", "stage double", "sink collect", "sink test-discard"}
+	if !slices.Equal(names, want) {
+		t.Errorf("Components() = %q, want %q", names, want)
+	}
+}
+
+func TestSecretParams(t *testing.T) {
+	secrets := pipeline.SecretsFunc(func(_ context.Context, name string) (string, error) {
+		if name == "db#password" {
+			return "hunter2", nil
+		}
+		return "", pipeline.ErrSecretNotFound
+	})
+
+	tests := []struct {
+		name    string
+		secrets pipeline.SecretsProvider
+		params  string
+		wantErr string
+	}{
+		{name: "resolved", secrets: secrets, params: "{password: db#password}"},
+		{name: "missing", secrets: secrets, params: "{password: db#nope}", wantErr: `param "password": pipeline: secret "db#nope"`},
+		{name: "no provider", params: "{password: db#password}", wantErr: "no secrets provider"},
+		{name: "required", secrets: secrets, params: "{}", wantErr: `param "password" is required`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := pipelineconfig.ParseYAML([]byte("sources: [{name: numbers}]\nsinks: [{name: db, inputs: [numbers], params: " + tt.params + "}]\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got string
+			r := pipelineconfig.NewRegistry()
+			if tt.secrets != nil {
+				r.SetSecrets(tt.secrets, time.Minute)
+			}
+			pipelineconfig.RegisterSource(r, "numbers", pipeline.SliceSource([]int{1}))
+			pipelineconfig.RegisterSinkFactory(r, "db", []pipelineconfig.Param{
+				{Name: "password", Type: pipelineconfig.SecretParam, Required: true},
+			}, func(p pipelineconfig.Params) (func(int) error, error) {
+				password := p.Secret("password")
+				return func(int) error {
+					v, err := password.Value(context.Background())
+					got = v
+					return err
+				}, nil
+			})
+
+			g, err := r.Build(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Build() = %v, want an error about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := g.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got != "hunter2" {
+				t.Errorf("sink got password %q, want hunter2", got)
+			}
+		})
+	}
+}
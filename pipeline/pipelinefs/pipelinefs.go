@@ -0,0 +1,215 @@
+// Package pipelinefs feeds a pipeline with the files dropped into a set of
+// directories, watching them with fsnotify:
+//
+//	w, err := pipelinefs.NewWatcher(time.Second, "/var/spool/incoming")
+//	if err != nil {
+//		return err
+//	}
+//	defer w.Close()
+//
+//	err = pipeline.New(w.Source()).Then(ingest).Sink(archive).Run(ctx)
+//	err = errors.Join(err, w.Err())
+//
+// Writing a file usually produces a burst of events, so they are debounced:
+// a file is only emitted once it has been left alone for the debounce
+// period. Only the directories themselves are watched, not the ones below
+// them, and events for directories are ignored.
+package pipelinefs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Op is what happened to a file reported by a Watcher.
+type Op int
+
+const (
+	// Created reports a file that appeared in a watched directory, created
+	// there or moved in. It may have been written to since.
+	Created Op = iota + 1
+	// Written reports a file that already existed being written to.
+	Written
+)
+
+func (op Op) String() string {
+	switch op {
+	case Created:
+		return "created"
+	case Written:
+		return "written"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a file created or written in a watched directory.
+type Event struct {
+	Path string
+	Op   Op
+}
+
+// Watcher emits the files created or written in a set of directories, see
+// the package documentation.
+type Watcher struct {
+	watcher  *fsnotify.Watcher
+	debounce time.Duration
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewWatcher starts watching dirs, emitting a file once debounce has passed
+// since its last event. A debounce of 0 emits every event as it arrives.
+func NewWatcher(debounce time.Duration, dirs ...string) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	return &Watcher{watcher: watcher, debounce: max(debounce, 0)}, nil
+}
+
+// pendingFile is a file waiting out the debounce period.
+type pendingFile struct {
+	op  Op
+	due time.Time
+}
+
+// Source returns a pipeline.Source emitting the watched files' events. Its
+// channel is closed once ctx is done, dropping the files still waiting to be
+// emitted, or once Close is called or watching fails, after emitting them,
+// see Err.
+func (w *Watcher) Source() pipeline.Source[Event] {
+	return func(ctx context.Context) (<-chan Event, error) {
+		outChannel := make(chan Event)
+
+		go func() {
+			defer close(outChannel)
+
+			pending := make(map[string]*pendingFile)
+			clock := pipeline.ClockFrom(ctx)
+			timer := clock.NewTimer(0)
+			timer.Stop()
+			defer timer.Stop()
+
+			// emit sends the files that are due, or all of them if all is set
+			emit := func(all bool) bool {
+				now := clock.Now()
+				var next time.Time
+				for path, p := range pending {
+					if !all && p.due.After(now) {
+						if next.IsZero() || p.due.Before(next) {
+							next = p.due
+						}
+						continue
+					}
+
+					select {
+					case <-ctx.Done():
+						return false
+					case outChannel <- Event{Path: path, Op: p.op}:
+					}
+					delete(pending, path)
+				}
+				if !next.IsZero() {
+					timer.Reset(next.Sub(clock.Now()))
+				}
+				return true
+			}
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C():
+					if !emit(false) {
+						return
+					}
+				case err, ok := <-w.watcher.Errors:
+					if !ok {
+						emit(true)
+						return
+					}
+					w.setErr(err)
+					emit(true)
+					return
+				case e, ok := <-w.watcher.Events:
+					if !ok {
+						emit(true)
+						return
+					}
+
+					switch {
+					case e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename):
+						// gone before it settled, nothing to emit
+						delete(pending, e.Name)
+						continue
+					case e.Has(fsnotify.Create):
+						if info, err := os.Stat(e.Name); err != nil || info.IsDir() {
+							continue
+						}
+						pending[e.Name] = &pendingFile{op: Created}
+					case e.Has(fsnotify.Write):
+						if _, ok := pending[e.Name]; !ok {
+							pending[e.Name] = &pendingFile{op: Written}
+						}
+					default:
+						continue
+					}
+
+					pending[e.Name].due = clock.Now().Add(w.debounce)
+					if w.debounce == 0 {
+						if !emit(false) {
+							return
+						}
+						continue
+					}
+					// a later due time never moves the timer back, the timer
+					// reschedules itself for whatever is left when it fires
+					if len(pending) == 1 {
+						timer.Reset(w.debounce)
+					}
+				}
+			}
+		}()
+
+		return outChannel, nil
+	}
+}
+
+// Err returns the error that stopped the source, if any.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Close stops watching. The source emits the files still waiting out the
+// debounce period and closes its channel.
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
+
+func (w *Watcher) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err == nil && !errors.Is(err, fsnotify.ErrClosed) {
+		w.err = err
+	}
+}
@@ -0,0 +1,100 @@
+package pipelinefs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinefs"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestWatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		debounce time.Duration
+		setup    func(t *testing.T, dir string)
+		write    func(t *testing.T, dir string)
+		want     pipelinefs.Event
+	}{
+		{
+			name:     "created file, debounced",
+			debounce: 50 * time.Millisecond,
+			write: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "a.csv"), "1")
+				writeFile(t, filepath.Join(dir, "a.csv"), "2")
+			},
+			want: pipelinefs.Event{Path: "a.csv", Op: pipelinefs.Created},
+		},
+		{
+			name:     "written file",
+			debounce: 50 * time.Millisecond,
+			setup: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "b.csv"), "1")
+			},
+			write: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "b.csv"), "2")
+			},
+			want: pipelinefs.Event{Path: "b.csv", Op: pipelinefs.Written},
+		},
+		{
+			name:     "directories are ignored",
+			debounce: 50 * time.Millisecond,
+			write: func(t *testing.T, dir string) {
+				if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, filepath.Join(dir, "c.csv"), "1")
+			},
+			want: pipelinefs.Event{Path: "c.csv", Op: pipelinefs.Created},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			dir := t.TempDir()
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+			w, err := pipelinefs.NewWatcher(tt.debounce, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := w.Source()(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.write(t, dir)
+			got := pipelinetest.Receive(t, events)
+			got.Path = filepath.Base(got.Path)
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if rest := pipelinetest.Collect(t, events); len(rest) > 0 {
+				t.Errorf("got more events %+v", rest)
+			}
+			if err := w.Err(); err != nil {
+				t.Errorf("Err returned %v", err)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,354 @@
+package pipelinegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// ErrWorkersLost is wrapped by the error reported for a value every worker
+// it was handed to went away with, see WithMaxAttempts.
+var ErrWorkersLost = errors.New("pipelinegrpc: workers lost")
+
+// Coordinator hands out the values of a pipeline stage as units of work to
+// the workers connected to it, which run Work, turning a pipeline into a
+// small distributed job runner. Unlike RemoteStep, which sends every value
+// to the one service it opened a stream to, the workers dial in to the
+// coordinator, as many as there are, and may come and go: a unit is handed
+// to the next worker with room for it, and the units of a worker that went
+// away, whose stream broke, are handed to the others again.
+//
+// The coordinator serves the workers from a bidirectional streaming RPC
+// exchanging Envelopes, calling Serve for every worker's stream:
+//
+//	coordinator := pipelinegrpc.NewCoordinator(codec, resultCodec)
+//
+//	func (s *server) Work(stream pb.Coordinator_WorkServer) error {
+//		return coordinator.Serve(adapt(stream))
+//	}
+//
+//	results, errs := coordinator.Stage()(ctx, values)
+//
+// A Coordinator runs one stage, once: the workers are told there is no more
+// work, their streams closed, once it is done.
+type Coordinator[T any, R any] struct {
+	in  pipeline.Codec[T]
+	out pipeline.Codec[R]
+	cfg config
+
+	units   chan *unit[T]
+	requeue chan *unit[T]
+	results chan outcome[T]
+	done    chan struct{}
+	started atomic.Bool
+}
+
+// unit is a value handed out to workers.
+type unit[T any] struct {
+	key   string
+	data  []byte
+	value T
+	// attempts counts the workers it was handed to
+	attempts int
+}
+
+type outcome[T any] struct {
+	unit   *unit[T]
+	result *Envelope
+}
+
+// NewCoordinator returns a Coordinator encoding the values it hands out with
+// in and decoding the results with out. WithMaxInFlight sets how many units
+// a worker is handed at a time and WithMaxAttempts how many workers a unit
+// is handed to.
+func NewCoordinator[T any, R any](in pipeline.Codec[T], out pipeline.Codec[R], opts ...Option) *Coordinator[T, R] {
+	cfg := config{maxInFlight: 100, maxAttempts: 3}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Coordinator[T, R]{
+		in:      in,
+		out:     out,
+		cfg:     cfg,
+		units:   make(chan *unit[T]),
+		requeue: make(chan *unit[T]),
+		results: make(chan outcome[T]),
+		done:    make(chan struct{}),
+	}
+}
+
+// Stage returns the pipeline.Stage handing its values out to the workers and
+// emitting their results in the order they arrive. Values wait for a worker
+// to connect, none are read from the input while one is waiting. A value a
+// worker failed on is reported as a *pipeline.StageError with the value as
+// Input and a *RemoteError, one that MaxAttempts workers went away with
+// with ErrWorkersLost. The stage is done once its input is closed and every
+// value's result has arrived, or once ctx is done.
+func (c *Coordinator[T, R]) Stage() pipeline.Stage[T, R] {
+	return func(ctx context.Context, in <-chan T) (<-chan R, <-chan error) {
+		outChannel := make(chan R)
+		errorChannel := make(chan error)
+
+		go func() {
+			defer close(outChannel)
+			defer close(errorChannel)
+
+			if !c.started.CompareAndSwap(false, true) {
+				select {
+				case <-ctx.Done():
+				case errorChannel <- errors.New("pipelinegrpc: coordinator already ran its stage"):
+				}
+				return
+			}
+			defer close(c.done)
+
+			c.run(ctx, in, outChannel, errorChannel)
+		}()
+
+		return outChannel, errorChannel
+	}
+}
+
+func (c *Coordinator[T, R]) run(ctx context.Context, in <-chan T, out chan<- R, errs chan<- error) {
+	report := func(err error) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case errs <- err:
+			return true
+		}
+	}
+
+	// queue are the units waiting for a worker, those handed back by
+	// workers that went away first
+	var queue []*unit[T]
+	n, outstanding := 0, 0
+	for in != nil || outstanding > 0 {
+		recv := in
+		var units chan *unit[T]
+		var next *unit[T]
+		if len(queue) > 0 {
+			recv = nil
+			units, next = c.units, queue[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok := <-recv:
+			if !ok {
+				in = nil
+				continue
+			}
+			data, err := c.in.Encode(v)
+			if err != nil {
+				if !report(&pipeline.StageError{Input: v, Attempts: 1, Err: err}) {
+					return
+				}
+				continue
+			}
+			n++
+			queue = append(queue, &unit[T]{key: strconv.Itoa(n), data: data, value: v})
+			outstanding++
+		case units <- next:
+			next.attempts++
+			queue = queue[1:]
+		case u := <-c.requeue:
+			if u.attempts >= c.cfg.maxAttempts {
+				outstanding--
+				if !report(&pipeline.StageError{Input: u.value, Attempts: u.attempts, Err: ErrWorkersLost}) {
+					return
+				}
+				continue
+			}
+			queue = append([]*unit[T]{u}, queue...)
+		case o := <-c.results:
+			outstanding--
+			if o.result.Error != "" {
+				if !report(&pipeline.StageError{Input: o.unit.value, Attempts: o.unit.attempts, Err: &RemoteError{Msg: o.result.Error}}) {
+					return
+				}
+				continue
+			}
+			r, err := c.out.Decode(o.result.Data)
+			if err != nil {
+				if !report(&pipeline.StageError{Input: o.unit.value, Attempts: o.unit.attempts, Err: err}) {
+					return
+				}
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- r:
+			}
+		}
+	}
+}
+
+// Serve hands units to the worker at the other end of stream and passes on
+// its results until the stage is done, when it returns nil and the stream
+// should be closed to tell the worker, or until the stream breaks, when the
+// worker's units are handed to the others and it returns the error the
+// stream broke with. Call it from the handler of the RPC.
+func (c *Coordinator[T, R]) Serve(stream ServerStream[Envelope, Envelope]) error {
+	var mu sync.Mutex
+	assigned := make(map[string]*unit[T])
+
+	// slots bounds the units the worker has, received the error receiving
+	// broke off with
+	slots := make(chan struct{}, c.cfg.maxInFlight)
+	received := make(chan error, 1)
+	go func() {
+		for {
+			e, err := stream.Recv()
+			if err != nil {
+				received <- err
+				return
+			}
+
+			mu.Lock()
+			u, ok := assigned[e.Key]
+			delete(assigned, e.Key)
+			mu.Unlock()
+			if !ok {
+				// handed back already, or not a unit at all
+				continue
+			}
+			<-slots
+
+			select {
+			case <-c.done:
+				received <- nil
+				return
+			case c.results <- outcome[T]{unit: u, result: e}:
+			}
+		}
+	}()
+
+	// gone hands back the units of a worker that went away
+	gone := func(err error) error {
+		mu.Lock()
+		units := make([]*unit[T], 0, len(assigned))
+		for _, u := range assigned {
+			units = append(units, u)
+		}
+		clear(assigned)
+		mu.Unlock()
+
+		for _, u := range units {
+			select {
+			case <-c.done:
+				return nil
+			case c.requeue <- u:
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return nil
+		case err := <-received:
+			return gone(err)
+		case slots <- struct{}{}:
+		}
+
+		select {
+		case <-c.done:
+			return nil
+		case err := <-received:
+			return gone(err)
+		case u := <-c.units:
+			mu.Lock()
+			assigned[u.key] = u
+			mu.Unlock()
+			if err := stream.Send(&Envelope{Key: u.key, Data: u.data}); err != nil {
+				return gone(err)
+			}
+		}
+	}
+}
+
+// Work connects to a Coordinator with open and runs fn on the units it is
+// handed, decoded with in, sending back the results encoded with out, like
+// Serve does for a RemoteStep, with up to the number set with WithWorkers
+// at a time. It returns nil once the coordinator has no more work and
+// closes the stream, or ctx's error once ctx is done. A broken stream is
+// opened again as set with WithReconnect, the count of attempts starting
+// over once a unit arrives, otherwise Work returns the error it broke with.
+func Work[T any, R any](
+	ctx context.Context,
+	open func(ctx context.Context) (Stream[Envelope, Envelope], error),
+	fn func(context.Context, T) (R, error),
+	in pipeline.Codec[T],
+	out pipeline.Codec[R],
+	opts ...Option,
+) error {
+	cfg := config{workers: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	failures := 0
+	for {
+		received, err := work(ctx, open, fn, in, out, cfg.workers)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			return nil
+		}
+
+		if received > 0 {
+			failures = 0
+		}
+		failures++
+		if failures > cfg.reconnects {
+			return err
+		}
+		if cfg.backoff != nil {
+			timer := pipeline.ClockFrom(ctx).NewTimer(cfg.backoff(failures))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C():
+			}
+		}
+	}
+}
+
+// work runs one stream to the coordinator, reporting how many units it was
+// handed.
+func work[T any, R any](
+	ctx context.Context,
+	open func(ctx context.Context) (Stream[Envelope, Envelope], error),
+	fn func(context.Context, T) (R, error),
+	in pipeline.Codec[T],
+	out pipeline.Codec[R],
+	workers int,
+) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := open(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("pipelinegrpc: opening stream: %w", err)
+	}
+	defer stream.CloseSend()
+
+	return process(ctx, stream, fn, in, out, workers)
+}
@@ -0,0 +1,223 @@
+package pipelinegrpc_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinegrpc"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// dial returns a func opening a stream to c for a worker, served by Serve
+// like the RPC handler would.
+func dial(c *pipelinegrpc.Coordinator[int, string]) func(context.Context) (pipelinegrpc.Stream[pipelinegrpc.Envelope, pipelinegrpc.Envelope], error) {
+	return func(ctx context.Context) (pipelinegrpc.Stream[pipelinegrpc.Envelope, pipelinegrpc.Envelope], error) {
+		p := &pipe{
+			ctx:       ctx,
+			requests:  make(chan *pipelinegrpc.Envelope, 16),
+			responses: make(chan *pipelinegrpc.Envelope, 16),
+		}
+		go func() {
+			_ = c.Serve(server{p})
+			close(p.responses)
+		}()
+		return client{p}, nil
+	}
+}
+
+// workers runs Work for every fn until it returns, collecting what it
+// returned with.
+type workers struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+func (w *workers) start(ctx context.Context, c *pipelinegrpc.Coordinator[int, string], fn func(context.Context, int) (string, error), opts ...pipelinegrpc.Option) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		err := pipelinegrpc.Work(ctx, dial(c), fn, pipeline.JSONCodec[int](), pipeline.JSONCodec[string](), opts...)
+		w.mu.Lock()
+		w.errs = append(w.errs, err)
+		w.mu.Unlock()
+	}()
+}
+
+func (w *workers) wait() []error {
+	w.wg.Wait()
+	return w.errs
+}
+
+func itoa(ctx context.Context, n int) (string, error) {
+	return strconv.Itoa(n), nil
+}
+
+func values(n int) []int {
+	vs := make([]int, n)
+	for i := range vs {
+		vs[i] = i
+	}
+	return vs
+}
+
+func itoas(vs []int) []string {
+	ss := make([]string, len(vs))
+	for i, v := range vs {
+		ss[i] = strconv.Itoa(v)
+	}
+	slices.Sort(ss)
+	return ss
+}
+
+func TestCoordinator(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	c := pipelinegrpc.NewCoordinator(pipeline.JSONCodec[int](), pipeline.JSONCodec[string](), pipelinegrpc.WithMaxInFlight(4))
+	var w workers
+	for range 3 {
+		w.start(context.Background(), c, itoa, pipelinegrpc.WithWorkers(2))
+	}
+
+	input := values(50)
+	results, errs := pipelinetest.Run(t, context.Background(), c.Stage(), input)
+	if len(errs) > 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	slices.Sort(results)
+	if want := itoas(input); !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+
+	for _, err := range w.wait() {
+		if err != nil {
+			t.Errorf("Work = %v, want nil once the coordinator is done", err)
+		}
+	}
+}
+
+func TestCoordinatorRemoteError(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	c := pipelinegrpc.NewCoordinator(pipeline.JSONCodec[int](), pipeline.JSONCodec[string]())
+	var w workers
+	w.start(context.Background(), c, func(ctx context.Context, n int) (string, error) {
+		if n == 2 {
+			return "", errors.New("two")
+		}
+		return strconv.Itoa(n), nil
+	})
+
+	results, errs := pipelinetest.Run(t, context.Background(), c.Stage(), values(4))
+	slices.Sort(results)
+	if want := []string{"0", "1", "3"}; !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+	var se *pipeline.StageError
+	var re *pipelinegrpc.RemoteError
+	if len(errs) != 1 || !errors.As(errs[0], &se) || !errors.As(errs[0], &re) || se.Input != 2 {
+		t.Errorf("errors = %v, want a StageError with a RemoteError for 2", errs)
+	}
+	w.wait()
+}
+
+func TestCoordinatorWorkerLost(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	c := pipelinegrpc.NewCoordinator(pipeline.JSONCodec[int](), pipeline.JSONCodec[string](), pipelinegrpc.WithMaxInFlight(2))
+
+	// the first worker takes units and never finishes them, then goes away
+	ctx, kill := context.WithCancel(context.Background())
+	took := make(chan int, 2)
+	var w workers
+	w.start(ctx, c, func(ctx context.Context, n int) (string, error) {
+		took <- n
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, pipelinegrpc.WithWorkers(2))
+
+	in := make(chan int)
+	out, errs := c.Stage()(context.Background(), in)
+	go func() {
+		defer close(in)
+		for _, v := range values(10) {
+			in <- v
+		}
+	}()
+
+	lost := []int{pipelinetest.Receive(t, took), pipelinetest.Receive(t, took)}
+	kill()
+	w.start(context.Background(), c, itoa)
+
+	go func() {
+		for err := range errs {
+			t.Errorf("error: %v", err)
+		}
+	}()
+	results := pipelinetest.Collect(t, out)
+	slices.Sort(results)
+	if want := itoas(values(10)); !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v, with %v handed to the second worker", results, want, lost)
+	}
+
+	returned := w.wait()
+	if !slices.ContainsFunc(returned, func(err error) bool { return errors.Is(err, context.Canceled) }) {
+		t.Errorf("Work = %v, want the first worker to return context.Canceled", returned)
+	}
+}
+
+func TestCoordinatorMaxAttempts(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	// with a unit in flight at a time, only 3 is counted against
+	c := pipelinegrpc.NewCoordinator(pipeline.JSONCodec[int](), pipeline.JSONCodec[string](),
+		pipelinegrpc.WithMaxAttempts(2), pipelinegrpc.WithMaxInFlight(1))
+
+	// 3 takes down every worker it is handed to, a new one takes its place
+	var w workers
+	stop := make(chan struct{})
+	var spawn func()
+	spawn = func() {
+		ctx, die := context.WithCancel(context.Background())
+		w.start(ctx, c, func(ctx context.Context, n int) (string, error) {
+			if n == 3 {
+				die()
+				select {
+				case <-stop:
+				default:
+					spawn()
+				}
+				return "", ctx.Err()
+			}
+			return strconv.Itoa(n), nil
+		})
+	}
+	spawn()
+
+	results, errs := pipelinetest.Run(t, context.Background(), c.Stage(), values(6))
+	close(stop)
+
+	slices.Sort(results)
+	if want := []string{"0", "1", "2", "4", "5"}; !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+	var se *pipeline.StageError
+	if len(errs) != 1 || !errors.Is(errs[0], pipelinegrpc.ErrWorkersLost) || !errors.As(errs[0], &se) || se.Input != 3 || se.Attempts != 2 {
+		t.Errorf("errors = %v, want ErrWorkersLost for 3 after 2 attempts", errs)
+	}
+	w.wait()
+}
+
+func TestCoordinatorStageOnce(t *testing.T) {
+	c := pipelinegrpc.NewCoordinator(pipeline.JSONCodec[int](), pipeline.JSONCodec[string]())
+	pipelinetest.Run(t, context.Background(), c.Stage(), nil)
+
+	if _, errs := pipelinetest.Run(t, context.Background(), c.Stage(), nil); len(errs) != 1 {
+		t.Errorf("errors = %v, want one for running the stage again", errs)
+	}
+}
@@ -0,0 +1,336 @@
+// Package pipelinegrpc runs a pipeline stage in another service over a
+// bidirectional gRPC stream: every value is sent as a request and the stage
+// emits the responses, matched back to their requests by a correlation key.
+//
+//	stage := pipelinegrpc.NewStage(
+//		func(ctx context.Context) (pipelinegrpc.Stream[pb.Request, pb.Response], error) {
+//			return client.Transform(ctx)
+//		},
+//		func(r *pb.Request) string { return r.Id },
+//		func(r *pb.Response) string { return r.Id },
+//		pipelinegrpc.WithMaxInFlight(64),
+//		pipelinegrpc.WithReconnect(5, pipeline.ExponentialBackoff(100*time.Millisecond, 5*time.Second)),
+//	)
+//	responses, errs := stage(ctx, requests)
+//
+// The client returned by a generated method for a bidirectional streaming
+// RPC, grpc.BidiStreamingClient[Req, Resp], satisfies Stream.
+//
+// If the stream breaks, a new one is opened and every request still waiting
+// for its response is sent again, so the service must cope with seeing a
+// request more than once.
+//
+// RemoteStep and Serve build on it to offload a step to dedicated machines:
+// values are encoded with a pipeline.Codec into an Envelope, worked on by
+// the workers and their results or errors sent back. A Coordinator does the
+// same for workers dialing in with Work, as many as there are, handing the
+// work of those going away to the others.
+package pipelinegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Stream is the client side of a bidirectional stream.
+type Stream[Req any, Resp any] interface {
+	Send(*Req) error
+	Recv() (*Resp, error)
+	CloseSend() error
+}
+
+// ErrUnknownResponse is wrapped by the error reported for a response whose
+// key doesn't match any request waiting for one.
+var ErrUnknownResponse = errors.New("pipelinegrpc: response for unknown request")
+
+// Option configures a stage.
+type Option func(*config)
+
+type config struct {
+	maxInFlight int
+	reconnects  int
+	backoff     pipeline.BackoffStrategy
+	workers     int
+	maxAttempts int
+}
+
+// WithMaxInFlight sets how many requests may wait for their response at a
+// time, 100 by default. Reading input pauses while the limit is reached.
+// For a Coordinator it is how many units every worker may have at a time.
+func WithMaxInFlight(n int) Option {
+	return func(cfg *config) {
+		if n >= 1 {
+			cfg.maxInFlight = n
+		}
+	}
+}
+
+// WithWorkers sets how many values Serve and Work work on at a time, 1 by
+// default. It has no effect on stages.
+func WithWorkers(n int) Option {
+	return func(cfg *config) {
+		if n >= 1 {
+			cfg.workers = n
+		}
+	}
+}
+
+// WithMaxAttempts sets how many workers a Coordinator hands a unit to before
+// giving up on it, 3 by default, in case it is the unit that brings them
+// down. Every unit a worker had when it went away counts, there is no
+// telling which brought it down, so keep WithMaxInFlight low if units may.
+func WithMaxAttempts(n int) Option {
+	return func(cfg *config) {
+		if n >= 1 {
+			cfg.maxAttempts = n
+		}
+	}
+}
+
+// WithReconnect sets how many times in a row the stream is reopened after
+// breaking, waiting as told by backoff before each attempt. By default a
+// broken stream fails the stage. The count starts over once a response
+// arrives on the new stream.
+func WithReconnect(attempts int, backoff pipeline.BackoffStrategy) Option {
+	return func(cfg *config) {
+		cfg.reconnects = max(attempts, 0)
+		cfg.backoff = backoff
+	}
+}
+
+// NewStage returns a pipeline.Stage sending every value it reads on a stream
+// opened with open and emitting the responses, in the order they arrive.
+// reqKey and respKey give the key a request and its response share.
+//
+// The stage's output and error channels are closed once its input is closed
+// and every response has arrived, once ctx is done, or after the stream
+// broke for good, which is reported on the error channel.
+func NewStage[Req any, Resp any](
+	open func(ctx context.Context) (Stream[Req, Resp], error),
+	reqKey func(*Req) string,
+	respKey func(*Resp) string,
+	opts ...Option,
+) pipeline.Stage[*Req, *Resp] {
+	cfg := config{maxInFlight: 100}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(ctx context.Context, in <-chan *Req) (<-chan *Resp, <-chan error) {
+		outChannel := make(chan *Resp)
+		errorChannel := make(chan error)
+
+		go func() {
+			defer close(outChannel)
+			defer close(errorChannel)
+
+			c := &conn[Req, Resp]{
+				cfg:      cfg,
+				open:     open,
+				reqKey:   reqKey,
+				respKey:  respKey,
+				pending:  make(map[string]*Req),
+				received: make(chan received[Resp]),
+			}
+			if err := c.run(ctx, in, outChannel, errorChannel); err != nil {
+				select {
+				case <-ctx.Done():
+				case errorChannel <- err:
+				}
+			}
+		}()
+
+		return outChannel, errorChannel
+	}
+}
+
+type received[Resp any] struct {
+	stream int
+	resp   *Resp
+	err    error
+}
+
+// conn is the state of a running stage.
+type conn[Req any, Resp any] struct {
+	cfg     config
+	open    func(ctx context.Context) (Stream[Req, Resp], error)
+	reqKey  func(*Req) string
+	respKey func(*Resp) string
+
+	stream Stream[Req, Resp]
+	cancel context.CancelFunc
+	// id tells responses from an abandoned stream apart
+	id       int
+	received chan received[Resp]
+
+	// pending are the requests waiting for a response, order is the order
+	// they were sent in for resending
+	pending map[string]*Req
+	order   []string
+}
+
+func (c *conn[Req, Resp]) run(ctx context.Context, in <-chan *Req, out chan<- *Resp, errs chan<- error) error {
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+	// the stream is replaced on reconnects, cancel whichever is current
+	defer func() { c.cancel() }()
+
+	failures := 0
+	closed := false
+	for in != nil || len(c.pending) > 0 {
+		// stop reading while the window is full, a nil channel is never
+		// ready
+		recv := in
+		if len(c.pending) >= c.cfg.maxInFlight {
+			recv = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case req, ok := <-recv:
+			if !ok {
+				// the last response may have arrived already, fall through
+				// to closing the stream
+				in = nil
+				break
+			}
+			key := c.reqKey(req)
+			c.pending[key] = req
+			c.order = append(c.order, key)
+			if err := c.stream.Send(req); err != nil {
+				// the receiving side sees the break too and reconnects
+				continue
+			}
+		case r := <-c.received:
+			if r.stream != c.id {
+				continue
+			}
+			if r.err != nil {
+				if errors.Is(r.err, io.EOF) && closed {
+					return nil
+				}
+				failures++
+				if failures > c.cfg.reconnects {
+					return fmt.Errorf("pipelinegrpc: stream broke: %w", r.err)
+				}
+				var err error
+				if failures, err = c.reconnect(ctx, failures); err != nil {
+					return err
+				}
+				continue
+			}
+
+			failures = 0
+			key := c.respKey(r.resp)
+			if _, ok := c.pending[key]; !ok {
+				select {
+				case <-ctx.Done():
+					return nil
+				case errs <- fmt.Errorf("%w %q", ErrUnknownResponse, key):
+				}
+				continue
+			}
+			delete(c.pending, key)
+			if len(c.order) > 2*c.cfg.maxInFlight {
+				c.compact()
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case out <- r.resp:
+			}
+		}
+
+		if in == nil && len(c.pending) == 0 && !closed {
+			closed = true
+			c.stream.CloseSend()
+		}
+	}
+
+	return nil
+}
+
+// connect opens a new stream and starts receiving from it.
+func (c *conn[Req, Resp]) connect(ctx context.Context) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, err := c.open(streamCtx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("pipelinegrpc: opening stream: %w", err)
+	}
+
+	c.id++
+	c.stream, c.cancel = stream, cancel
+	go func(id int) {
+		for {
+			resp, err := stream.Recv()
+			select {
+			case <-streamCtx.Done():
+				return
+			case c.received <- received[Resp]{stream: id, resp: resp, err: err}:
+			}
+			if err != nil {
+				return
+			}
+		}
+	}(c.id)
+
+	return nil
+}
+
+// reconnect replaces a broken stream and sends the pending requests again.
+// Failing to open a stream counts as another failure, it returns the updated
+// count.
+func (c *conn[Req, Resp]) reconnect(ctx context.Context, failures int) (int, error) {
+	for {
+		c.cancel()
+
+		if c.cfg.backoff != nil {
+			timer := pipeline.ClockFrom(ctx).NewTimer(c.cfg.backoff(failures))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return failures, nil
+			case <-timer.C():
+			}
+		}
+
+		err := c.connect(ctx)
+		if err == nil {
+			break
+		}
+		failures++
+		if failures > c.cfg.reconnects {
+			return failures, err
+		}
+	}
+
+	c.compact()
+	for _, key := range c.order {
+		if err := c.stream.Send(c.pending[key]); err != nil {
+			// the new stream broke already, its receiver reports it
+			break
+		}
+	}
+
+	return failures, nil
+}
+
+// compact drops the keys of answered requests from order, keeping the send
+// order of the rest.
+func (c *conn[Req, Resp]) compact() {
+	order := c.order[:0]
+	for _, key := range c.order {
+		if _, ok := c.pending[key]; ok {
+			order = append(order, key)
+		}
+	}
+	c.order = order
+}
@@ -0,0 +1,177 @@
+package pipelinegrpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinegrpc"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+type msg struct {
+	Key string
+	N   int
+}
+
+var errBroken = errors.New("connection reset")
+
+// echo is a stream answering every request with ten times its N, breaking
+// after breakAfter responses unless it is 0.
+type echo struct {
+	ctx        context.Context
+	requests   chan *msg
+	breakAfter int
+	// stray is a response for no request sent first
+	stray     bool
+	answered  int
+	closeOnce sync.Once
+}
+
+func (e *echo) Send(m *msg) error {
+	select {
+	case <-e.ctx.Done():
+		return e.ctx.Err()
+	case e.requests <- m:
+		return nil
+	}
+}
+
+func (e *echo) Recv() (*msg, error) {
+	if e.stray {
+		e.stray = false
+		return &msg{Key: "stray"}, nil
+	}
+	if e.breakAfter > 0 && e.answered == e.breakAfter {
+		return nil, errBroken
+	}
+	select {
+	case <-e.ctx.Done():
+		return nil, e.ctx.Err()
+	case m, ok := <-e.requests:
+		if !ok {
+			return nil, io.EOF
+		}
+		e.answered++
+		return &msg{Key: m.Key, N: m.N * 10}, nil
+	}
+}
+
+func (e *echo) CloseSend() error {
+	e.closeOnce.Do(func() { close(e.requests) })
+	return nil
+}
+
+// opening is what happens when a stream is opened: it fails with err, or
+// opens an echo breaking after breakAfter responses.
+type opening struct {
+	err        error
+	breakAfter int
+	stray      bool
+}
+
+func TestNewStage(t *testing.T) {
+	backoff := pipelinegrpc.WithReconnect(2, pipeline.ConstantBackoff(time.Millisecond))
+
+	tests := []struct {
+		name string
+		// openings are the streams opened in turn, the last one for every
+		// stream opened after
+		openings []opening
+		opts     []pipelinegrpc.Option
+		wantErr  error
+		// opened is how many times a stream was opened
+		opened int
+	}{
+		{name: "every response", openings: []opening{{}}, opened: 1},
+		{name: "window of one", openings: []opening{{}}, opts: []pipelinegrpc.Option{pipelinegrpc.WithMaxInFlight(1)}, opened: 1},
+		{
+			name:     "reconnected with the pending requests resent",
+			openings: []opening{{breakAfter: 3}, {breakAfter: 3}, {}},
+			opts:     []pipelinegrpc.Option{backoff},
+			opened:   3,
+		},
+		{
+			name:     "reconnected after failing to open",
+			openings: []opening{{breakAfter: 3}, {err: errBroken}, {}},
+			opts:     []pipelinegrpc.Option{backoff},
+			opened:   3,
+		},
+		{
+			name:     "broke without reconnecting",
+			openings: []opening{{breakAfter: 3}},
+			wantErr:  errBroken,
+			opened:   1,
+		},
+		{
+			name:     "broke for good",
+			openings: []opening{{breakAfter: 1}, {err: errBroken}},
+			opts:     []pipelinegrpc.Option{backoff},
+			wantErr:  errBroken,
+			// the break and the two failed openings use up the reconnects
+			opened: 3,
+		},
+		{
+			name:     "stray response",
+			openings: []opening{{stray: true}},
+			wantErr:  pipelinegrpc.ErrUnknownResponse,
+			opened:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			var mu sync.Mutex
+			opened := 0
+			open := func(ctx context.Context) (pipelinegrpc.Stream[msg, msg], error) {
+				mu.Lock()
+				defer mu.Unlock()
+				o := tt.openings[min(opened, len(tt.openings)-1)]
+				opened++
+				if o.err != nil {
+					return nil, o.err
+				}
+				return &echo{ctx: ctx, requests: make(chan *msg, 16), breakAfter: o.breakAfter, stray: o.stray}, nil
+			}
+			stage := pipelinegrpc.NewStage(open, func(m *msg) string { return m.Key }, func(m *msg) string { return m.Key }, tt.opts...)
+
+			var inputs []*msg
+			for i := range 10 {
+				inputs = append(inputs, &msg{Key: strconv.Itoa(i), N: i})
+			}
+			out, errs := pipelinetest.Run(t, context.Background(), stage, inputs)
+
+			if tt.wantErr != nil {
+				if len(errs) != 1 || !errors.Is(errs[0], tt.wantErr) {
+					t.Errorf("failed with %v, want %v", errs, tt.wantErr)
+				}
+			} else if len(errs) > 0 {
+				t.Errorf("failed with %v", errs)
+			}
+			if tt.wantErr == nil || errors.Is(tt.wantErr, pipelinegrpc.ErrUnknownResponse) {
+				// every request is answered once, however often it was sent
+				var got []int
+				for _, m := range out {
+					got = append(got, m.N)
+				}
+				slices.Sort(got)
+				if want := []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}; !slices.Equal(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if opened != tt.opened {
+				t.Errorf("opened %d streams, want %d", opened, tt.opened)
+			}
+		})
+	}
+}
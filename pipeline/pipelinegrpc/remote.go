@@ -0,0 +1,296 @@
+package pipelinegrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Envelope is the message RemoteStep and Serve exchange: a value encoded
+// with a pipeline.Codec under the key its result comes back with, or, on
+// the way back, the error the worker failed on it with. A service carrying
+// them needs a message of the same three fields and a bidirectional
+// streaming RPC sending and returning it, with a thin adapter around the
+// generated client and server to satisfy Stream and ServerStream:
+//
+//	message Envelope {
+//	  string key = 1;
+//	  bytes data = 2;
+//	  string error = 3;
+//	}
+//
+//	service Worker {
+//	  rpc Process(stream Envelope) returns (stream Envelope);
+//	}
+type Envelope struct {
+	Key   string
+	Data  []byte
+	Error string
+}
+
+// RemoteError is the error a worker failed on a value with, see RemoteStep.
+type RemoteError struct {
+	Msg string
+}
+
+func (e *RemoteError) Error() string {
+	return "pipelinegrpc: remote: " + e.Msg
+}
+
+// RemoteStep returns a pipeline.Stage offloading a step, a CPU-heavy one
+// say, to worker services running it with Serve: every value is encoded with
+// in and sent on a stream opened with open, and the results the workers send
+// back are decoded with out and emitted in the order they arrive. A value
+// the worker failed on is reported as a *pipeline.StageError with the value
+// as Input and a *RemoteError. The options are those of NewStage.
+func RemoteStep[T any, R any](
+	open func(ctx context.Context) (Stream[Envelope, Envelope], error),
+	in pipeline.Codec[T],
+	out pipeline.Codec[R],
+	opts ...Option,
+) pipeline.Stage[T, R] {
+	key := func(e *Envelope) string { return e.Key }
+	stage := NewStage(open, key, key, opts...)
+
+	return func(ctx context.Context, values <-chan T) (<-chan R, <-chan error) {
+		outChannel := make(chan R)
+		errorChannel := make(chan error)
+
+		// sent are the values waiting for their result, to report them
+		// with the errors they fail with
+		var mu sync.Mutex
+		sent := make(map[string]T)
+
+		requests := make(chan *Envelope)
+		encodeErrs := make(chan error)
+		go func() {
+			defer close(requests)
+			defer close(encodeErrs)
+
+			n := 0
+			for v := range values {
+				data, err := in.Encode(v)
+				if err != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case encodeErrs <- &pipeline.StageError{Input: v, Attempts: 1, Err: err}:
+					}
+					continue
+				}
+
+				n++
+				e := &Envelope{Key: strconv.Itoa(n), Data: data}
+				mu.Lock()
+				sent[e.Key] = v
+				mu.Unlock()
+
+				select {
+				case <-ctx.Done():
+					return
+				case requests <- e:
+				}
+			}
+		}()
+
+		responses, errs := stage(ctx, requests)
+
+		go func() {
+			defer close(outChannel)
+			defer close(errorChannel)
+
+			report := func(err error) bool {
+				select {
+				case <-ctx.Done():
+					return false
+				case errorChannel <- err:
+					return true
+				}
+			}
+
+			for responses != nil || errs != nil || encodeErrs != nil {
+				select {
+				case err, ok := <-encodeErrs:
+					if !ok {
+						encodeErrs = nil
+						continue
+					}
+					if !report(err) {
+						return
+					}
+				case err, ok := <-errs:
+					if !ok {
+						errs = nil
+						continue
+					}
+					if !report(err) {
+						return
+					}
+				case e, ok := <-responses:
+					if !ok {
+						responses = nil
+						continue
+					}
+
+					mu.Lock()
+					v := sent[e.Key]
+					delete(sent, e.Key)
+					mu.Unlock()
+
+					if e.Error != "" {
+						if !report(&pipeline.StageError{Input: v, Attempts: 1, Err: &RemoteError{Msg: e.Error}}) {
+							return
+						}
+						continue
+					}
+					r, err := out.Decode(e.Data)
+					if err != nil {
+						if !report(&pipeline.StageError{Input: v, Attempts: 1, Err: err}) {
+							return
+						}
+						continue
+					}
+
+					select {
+					case <-ctx.Done():
+						return
+					case outChannel <- r:
+					}
+				}
+			}
+		}()
+
+		return outChannel, errorChannel
+	}
+}
+
+// ServerStream is the server side of a bidirectional stream.
+// grpc.BidiStreamingServer[Req, Resp] satisfies it.
+type ServerStream[Req any, Resp any] interface {
+	Context() context.Context
+	Recv() (*Req, error)
+	Send(*Resp) error
+}
+
+// Serve runs fn on every value a RemoteStep sends on stream, decoded with in,
+// and sends back its result encoded with out, or the error fn failed with.
+// Up to the number of values set with WithWorkers, one by default, are
+// worked on at a time and their results sent as they are done. It returns
+// once the client has closed its side of the stream and every result has
+// been sent, nil then, or once the stream breaks, with the error it broke
+// with. A client may go away as soon as it has every result, so a stream
+// that breaks after the client closed its side doesn't count. Call it from
+// the handler of the RPC:
+//
+//	func (s *server) Process(stream pb.Worker_ProcessServer) error {
+//		return pipelinegrpc.Serve(adapt(stream), resize, codec, codec, pipelinegrpc.WithWorkers(8))
+//	}
+func Serve[T any, R any](
+	stream ServerStream[Envelope, Envelope],
+	fn func(context.Context, T) (R, error),
+	in pipeline.Codec[T],
+	out pipeline.Codec[R],
+	opts ...Option,
+) error {
+	cfg := config{workers: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	_, err := process(stream.Context(), stream, fn, in, out, cfg.workers)
+	return err
+}
+
+// duplex is the side of a stream receiving values and sending back results,
+// the server side for Serve and the client side for Work.
+type duplex interface {
+	Recv() (*Envelope, error)
+	Send(*Envelope) error
+}
+
+// process runs fn on the values received on stream until it is closed, up
+// to workers of them at a time, reporting how many it received.
+func process[T any, R any](
+	ctx context.Context,
+	stream duplex,
+	fn func(context.Context, T) (R, error),
+	in pipeline.Codec[T],
+	out pipeline.Codec[R],
+	workers int,
+) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		sending sync.Mutex // streams allow one Send at a time
+		sendErr error
+	)
+	send := func(e *Envelope) {
+		sending.Lock()
+		defer sending.Unlock()
+
+		if sendErr != nil {
+			return
+		}
+		if err := stream.Send(e); err != nil {
+			sendErr = err
+			cancel()
+		}
+	}
+
+	slots := make(chan struct{}, workers)
+	received := 0
+	var recvErr error
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				recvErr = err
+			}
+			break
+		}
+		received++
+
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(req *Envelope) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			resp := &Envelope{Key: req.Key}
+			if v, err := in.Decode(req.Data); err != nil {
+				resp.Error = err.Error()
+			} else if r, err := fn(ctx, v); err != nil {
+				resp.Error = err.Error()
+			} else if resp.Data, err = out.Encode(r); err != nil {
+				resp.Error = err.Error()
+			}
+			if ctx.Err() != nil {
+				// shutting down rather than failing, whoever sent the
+				// value is gone or hands it to another worker
+				return
+			}
+			send(resp)
+		}(req)
+	}
+	wg.Wait()
+
+	sending.Lock()
+	defer sending.Unlock()
+	if sendErr != nil {
+		return received, sendErr
+	}
+	return received, recvErr
+}
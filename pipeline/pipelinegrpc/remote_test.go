@@ -0,0 +1,270 @@
+package pipelinegrpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinegrpc"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// pipe connects the two sides of an in-memory stream, like a bidirectional
+// RPC would. Its channels are buffered like the flow control windows of a
+// transport, or a client sending while the worker is busy would wait for it.
+type pipe struct {
+	ctx       context.Context
+	requests  chan *pipelinegrpc.Envelope
+	responses chan *pipelinegrpc.Envelope
+	closeOnce sync.Once
+}
+
+type client struct{ *pipe }
+
+func (c client) Send(e *pipelinegrpc.Envelope) error {
+	select {
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	case c.requests <- e:
+		return nil
+	}
+}
+
+func (c client) Recv() (*pipelinegrpc.Envelope, error) {
+	select {
+	case <-c.ctx.Done():
+		return nil, c.ctx.Err()
+	case e, ok := <-c.responses:
+		if !ok {
+			return nil, io.EOF
+		}
+		return e, nil
+	}
+}
+
+func (c client) CloseSend() error {
+	c.closeOnce.Do(func() { close(c.requests) })
+	return nil
+}
+
+type server struct{ *pipe }
+
+func (s server) Context() context.Context { return s.ctx }
+
+func (s server) Send(e *pipelinegrpc.Envelope) error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case s.responses <- e:
+		return nil
+	}
+}
+
+func (s server) Recv() (*pipelinegrpc.Envelope, error) {
+	select {
+	case <-s.ctx.Done():
+		// like a transport, deliver what was sent before the stream broke
+		select {
+		case e, ok := <-s.requests:
+			return received(e, ok)
+		default:
+			return nil, s.ctx.Err()
+		}
+	case e, ok := <-s.requests:
+		return received(e, ok)
+	}
+}
+
+func received(e *pipelinegrpc.Envelope, ok bool) (*pipelinegrpc.Envelope, error) {
+	if !ok {
+		return nil, io.EOF
+	}
+	return e, nil
+}
+
+// worker returns a func opening streams to a worker serving fn, and a func
+// waiting for the worker to return from Serve.
+func worker(t *testing.T, fn func(context.Context, int) (string, error), opts ...pipelinegrpc.Option) (func(context.Context) (pipelinegrpc.Stream[pipelinegrpc.Envelope, pipelinegrpc.Envelope], error), func() error) {
+	t.Helper()
+
+	served := make(chan error, 1)
+	open := func(ctx context.Context) (pipelinegrpc.Stream[pipelinegrpc.Envelope, pipelinegrpc.Envelope], error) {
+		p := &pipe{
+			ctx:       ctx,
+			requests:  make(chan *pipelinegrpc.Envelope, 16),
+			responses: make(chan *pipelinegrpc.Envelope, 16),
+		}
+		go func() {
+			err := pipelinegrpc.Serve(server{p}, fn, pipeline.JSONCodec[int](), pipeline.JSONCodec[string](), opts...)
+			close(p.responses)
+			served <- err
+		}()
+		return client{p}, nil
+	}
+
+	return open, func() error {
+		select {
+		case err := <-served:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Serve didn't return")
+			return nil
+		}
+	}
+}
+
+func TestRemoteStep(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errOdd := errors.New("odd")
+	open, served := worker(t, func(ctx context.Context, n int) (string, error) {
+		if n%2 == 1 {
+			return "", errOdd
+		}
+		return strconv.Itoa(n * 10), nil
+	})
+
+	stage := pipelinegrpc.RemoteStep(open, pipeline.JSONCodec[int](), pipeline.JSONCodec[string]())
+	results, errs := pipelinetest.Run(t, context.Background(), stage, []int{1, 2, 3, 4})
+
+	slices.Sort(results)
+	if want := []string{"20", "40"}; !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+
+	var failed []int
+	for _, err := range errs {
+		var se *pipeline.StageError
+		var re *pipelinegrpc.RemoteError
+		if !errors.As(err, &se) || !errors.As(err, &re) {
+			t.Fatalf("error %v isn't a StageError with a RemoteError", err)
+		}
+		if re.Msg != "odd" {
+			t.Errorf("RemoteError.Msg = %q, want %q", re.Msg, "odd")
+		}
+		failed = append(failed, se.Input.(int))
+	}
+	slices.Sort(failed)
+	if want := []int{1, 3}; !slices.Equal(failed, want) {
+		t.Errorf("failed inputs = %v, want %v", failed, want)
+	}
+
+	if err := served(); err != nil {
+		t.Errorf("Serve = %v, want nil once the client is done", err)
+	}
+}
+
+func TestRemoteStepDecodeError(t *testing.T) {
+	open, served := worker(t, func(ctx context.Context, n int) (string, error) {
+		return "not a number", nil
+	})
+
+	// the worker sends strings the client can't decode as ints
+	stage := pipelinegrpc.RemoteStep(open, pipeline.JSONCodec[int](), pipeline.JSONCodec[int]())
+	results, errs := pipelinetest.Run(t, context.Background(), stage, []int{7})
+
+	if len(results) != 0 {
+		t.Errorf("results = %v, want none", results)
+	}
+	var se *pipeline.StageError
+	if len(errs) != 1 || !errors.As(errs[0], &se) || se.Input != 7 {
+		t.Errorf("errors = %v, want a StageError for 7", errs)
+	}
+	if err := served(); err != nil {
+		t.Errorf("Serve = %v, want nil", err)
+	}
+}
+
+func TestServeWorkers(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []pipelinegrpc.Option
+		want int32
+	}{
+		{name: "default", want: 1},
+		{name: "workers", opts: []pipelinegrpc.Option{pipelinegrpc.WithWorkers(3)}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, most atomic.Int32
+			release := make(chan struct{})
+			open, served := worker(t, func(ctx context.Context, n int) (string, error) {
+				now := running.Add(1)
+				defer running.Add(-1)
+				for {
+					m := most.Load()
+					if now <= m || most.CompareAndSwap(m, now) {
+						break
+					}
+				}
+				<-release
+				return strconv.Itoa(n), nil
+			}, tt.opts...)
+
+			stage := pipelinegrpc.RemoteStep(open, pipeline.JSONCodec[int](), pipeline.JSONCodec[string]())
+			in := make(chan int)
+			out, errs := stage(context.Background(), in)
+			go func() {
+				defer close(in)
+				for i := range 6 {
+					in <- i
+				}
+			}()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for running.Load() < tt.want && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			// give any worker beyond the limit a chance to start
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+
+			go func() {
+				for range errs {
+				}
+			}()
+			if got := len(pipelinetest.Collect(t, out)); got != 6 {
+				t.Errorf("got %d results, want 6", got)
+			}
+			if got := most.Load(); got != tt.want {
+				t.Errorf("%d values worked on at a time, want %d", got, tt.want)
+			}
+			if err := served(); err != nil {
+				t.Errorf("Serve = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestServeStreamBroken(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &pipe{
+		ctx:       ctx,
+		requests:  make(chan *pipelinegrpc.Envelope),
+		responses: make(chan *pipelinegrpc.Envelope),
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- pipelinegrpc.Serve(server{p}, func(ctx context.Context, n int) (int, error) {
+			return n, nil
+		}, pipeline.JSONCodec[int](), pipeline.JSONCodec[int]())
+	}()
+
+	cancel()
+	select {
+	case err := <-served:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Serve = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve didn't return once the stream broke")
+	}
+}
@@ -0,0 +1,280 @@
+// Package pipelinekafka feeds a pipeline from a Kafka consumer group with
+// at-least-once delivery: a message's offset is only committed once it, and
+// every message fetched before it from the same partition, has been
+// processed.
+//
+//	c := pipelinekafka.NewConsumer(kafka.ReaderConfig{
+//		Brokers: []string{"localhost:9092"},
+//		GroupID: "enricher",
+//		Topic:   "orders",
+//	})
+//	defer c.Close()
+//
+//	err := pipeline.New(c.Source()).
+//		Then(enrich, pipeline.WithConcurrency(8)).
+//		Sink(c.Sink(store)).
+//		Run(ctx)
+//
+// Steps must keep the Topic, Partition and Offset of the messages they
+// return, they are what the commit is worked out from. Messages that fail
+// are not committed, so the group picks them up again
+// after a restart. A pipeline that carries on past failures, e.g. with a
+// DeadLetter handler, must Ack the messages it gives up on or the commits of
+// their partition stall.
+package pipelinekafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Consumer reads a topic as a member of a consumer group and commits its
+// offsets as messages are acknowledged.
+type Consumer struct {
+	reader reader
+
+	mu         sync.Mutex
+	partitions map[partition]*offsets
+	err        error
+}
+
+// reader is the part of a *kafka.Reader a Consumer uses.
+type reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Config() kafka.ReaderConfig
+	Close() error
+}
+
+type partition struct {
+	topic string
+	id    int
+}
+
+// offsets tracks the messages fetched from a partition that aren't committed
+// yet, in the order they were fetched.
+type offsets struct {
+	pending []int64
+	done    map[int64]bool
+}
+
+// NewConsumer returns a Consumer reading with cfg, which must set GroupID.
+// Automatic commits are left off, whatever cfg.CommitInterval says: offsets
+// are committed by Ack.
+func NewConsumer(cfg kafka.ReaderConfig) *Consumer {
+	cfg.CommitInterval = 0
+
+	return &Consumer{
+		reader:     kafka.NewReader(cfg),
+		partitions: make(map[partition]*offsets),
+	}
+}
+
+// Check connects to the brokers of the Consumer's config, one after the
+// other until one answers, and looks the topic up, to see the cluster is
+// reachable and has it before reading, see pipeline.Pipeline.Check.
+func (c *Consumer) Check(ctx context.Context) error {
+	cfg := c.reader.Config()
+	dialer := cfg.Dialer
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
+	var errs []error
+	for _, broker := range cfg.Brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		_, err = conn.ReadPartitions(cfg.Topic)
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("pipelinekafka: topic %s: %w", cfg.Topic, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("pipelinekafka: no broker reachable: %w", errors.Join(errs...))
+}
+
+// Source returns a pipeline.Source emitting the messages of the group's
+// partitions. It stops once ctx is done or fetching fails, which fails the
+// run as a failure of the source, see pipeline.GeneratorSource, and is kept
+// for Err.
+func (c *Consumer) Source() pipeline.Source[kafka.Message] {
+	return pipeline.GeneratorSource(func(ctx context.Context, emit func(kafka.Message) error) error {
+		for {
+			m, err := c.fetch(ctx)
+			if err != nil {
+				return err
+			}
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// MessageSource is Source for pipelines of pipeline.Messages: every message
+// carries the pipeline.TransportHeaders of its Kafka headers, trace context
+// and correlation ID included, and is acknowledged with Ack once the
+// pipeline settles it, see pipeline.Message.OnAck, so no Sink is needed. A
+// failure to fetch fails the run as with Source, and so does a failing
+// commit while the source is running. One failing once it has stopped, as
+// the pipeline drains, is only kept for Err.
+func (c *Consumer) MessageSource() pipeline.Source[pipeline.Message[kafka.Message]] {
+	return pipeline.GeneratorSource(func(ctx context.Context, emit func(pipeline.Message[kafka.Message]) error) error {
+		// a failed commit stops the fetching, with the failure as its cause
+		fetchCtx, stop := context.WithCancelCause(ctx)
+		defer stop(nil)
+
+		for {
+			m, err := c.fetch(fetchCtx)
+			if err != nil {
+				if ctx.Err() == nil && fetchCtx.Err() != nil {
+					return context.Cause(fetchCtx)
+				}
+				return err
+			}
+
+			msg := pipeline.NewMessageFrom(m, pipeline.ExtractHeaders(func(key string) string {
+				return header(m, key)
+			}))
+			msg = msg.OnAck(func(err error) {
+				if err != nil {
+					return
+				}
+				if err := c.Ack(context.WithoutCancel(ctx), m); err != nil {
+					c.setErr(err)
+					stop(err)
+				}
+			})
+			if err := emit(msg); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// fetch fetches the next message and tracks it, keeping the error for Err
+// if that fails.
+func (c *Consumer) fetch(ctx context.Context) (kafka.Message, error) {
+	m, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return m, ctx.Err()
+		}
+		err = fmt.Errorf("pipelinekafka: fetching: %w", err)
+		c.setErr(err)
+		return m, err
+	}
+
+	c.track(m)
+	return m, nil
+}
+
+// header returns the value of m's header key, ignoring case.
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
+
+// Sink returns a pipeline sink that runs handler on every message and Acks
+// it once handler succeeds. A message handler fails on is left uncommitted
+// and its error returned.
+func (c *Consumer) Sink(handler func(kafka.Message) error) func(kafka.Message) error {
+	return func(m kafka.Message) error {
+		if err := handler(m); err != nil {
+			return err
+		}
+
+		return c.Ack(context.Background(), m)
+	}
+}
+
+// Ack marks m as processed. Once every message fetched before m from its
+// partition has been acknowledged too, the partition's offset is committed.
+func (c *Consumer) Ack(ctx context.Context, m kafka.Message) error {
+	commit, ok := c.settle(m)
+	if !ok {
+		return nil
+	}
+
+	if err := c.reader.CommitMessages(ctx, commit); err != nil {
+		return fmt.Errorf("pipelinekafka: committing %s/%d at %d: %w", commit.Topic, commit.Partition, commit.Offset, err)
+	}
+	return nil
+}
+
+// Err returns the error that stopped the source, if any, which is also
+// what failed the run.
+func (c *Consumer) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// Close leaves the consumer group and closes the connection.
+func (c *Consumer) Close() error {
+	return c.reader.Close()
+}
+
+func (c *Consumer) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !errors.Is(err, context.Canceled) {
+		c.err = err
+	}
+}
+
+func (c *Consumer) track(m kafka.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := partition{topic: m.Topic, id: m.Partition}
+	p, ok := c.partitions[key]
+	if !ok {
+		p = &offsets{done: make(map[int64]bool)}
+		c.partitions[key] = p
+	}
+	p.pending = append(p.pending, m.Offset)
+}
+
+// settle records m as done and returns the message whose offset can now be
+// committed, if the front of its partition moved.
+func (c *Consumer) settle(m kafka.Message) (kafka.Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.partitions[partition{topic: m.Topic, id: m.Partition}]
+	if !ok {
+		return m, false
+	}
+	p.done[m.Offset] = true
+
+	committed := int64(-1)
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		committed = p.pending[0]
+		delete(p.done, committed)
+		p.pending = p.pending[1:]
+	}
+	if committed < 0 {
+		return m, false
+	}
+
+	return kafka.Message{Topic: m.Topic, Partition: m.Partition, Offset: committed}, true
+}
@@ -0,0 +1,253 @@
+package pipelinekafka
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// fakeReader hands out msgs, then fails with err, or blocks until ctx is
+// done without one. It records the offsets committed.
+type fakeReader struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	err       error
+	commitErr error
+	committed []int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.msgs) > 0 {
+		m := r.msgs[0]
+		r.msgs = r.msgs[1:]
+		r.mu.Unlock()
+		return m, nil
+	}
+	err := r.err
+	r.mu.Unlock()
+
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.commitErr != nil {
+		return r.commitErr
+	}
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Config() kafka.ReaderConfig { return kafka.ReaderConfig{} }
+func (r *fakeReader) Close() error               { return nil }
+
+// fakeConsumer returns a Consumer reading from r.
+func fakeConsumer(r *fakeReader) *Consumer {
+	return &Consumer{reader: r, partitions: make(map[partition]*offsets)}
+}
+
+// fetched returns n messages of partition 0 at offsets 0 to n-1.
+func fetched(n int) []kafka.Message {
+	msgs := make([]kafka.Message, n)
+	for i := range msgs {
+		msgs[i] = kafka.Message{Topic: "orders", Offset: int64(i)}
+	}
+	return msgs
+}
+
+func TestSettle(t *testing.T) {
+	msg := func(partition int, offset int64) kafka.Message {
+		return kafka.Message{Topic: "orders", Partition: partition, Offset: offset}
+	}
+
+	tests := []struct {
+		name    string
+		fetched []kafka.Message
+		acked   []kafka.Message
+		// commits has the offset committed by every ack, -1 for none
+		commits []int64
+	}{
+		{
+			name:    "in order",
+			fetched: []kafka.Message{msg(0, 1), msg(0, 2), msg(0, 3)},
+			acked:   []kafka.Message{msg(0, 1), msg(0, 2), msg(0, 3)},
+			commits: []int64{1, 2, 3},
+		},
+		{
+			name:    "out of order",
+			fetched: []kafka.Message{msg(0, 1), msg(0, 2), msg(0, 3)},
+			acked:   []kafka.Message{msg(0, 3), msg(0, 2), msg(0, 1)},
+			commits: []int64{-1, -1, 3},
+		},
+		{
+			name:    "gap held back",
+			fetched: []kafka.Message{msg(0, 1), msg(0, 2), msg(0, 3)},
+			acked:   []kafka.Message{msg(0, 1), msg(0, 3), msg(0, 2)},
+			commits: []int64{1, -1, 3},
+		},
+		{
+			name:    "partitions apart",
+			fetched: []kafka.Message{msg(0, 1), msg(1, 1), msg(0, 2)},
+			acked:   []kafka.Message{msg(0, 2), msg(1, 1), msg(0, 1)},
+			commits: []int64{-1, 1, 2},
+		},
+		{
+			name:    "never fetched",
+			fetched: []kafka.Message{msg(0, 1)},
+			acked:   []kafka.Message{msg(1, 1), msg(0, 1)},
+			commits: []int64{-1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Consumer{partitions: make(map[partition]*offsets)}
+			for _, m := range tt.fetched {
+				c.track(m)
+			}
+
+			for i, m := range tt.acked {
+				commit, ok := c.settle(m)
+				got := int64(-1)
+				if ok {
+					got = commit.Offset
+					if commit.Topic != m.Topic || commit.Partition != m.Partition {
+						t.Errorf("ack %d committed %s/%d, want %s/%d", i, commit.Topic, commit.Partition, m.Topic, m.Partition)
+					}
+				}
+				if got != tt.commits[i] {
+					t.Errorf("ack %d of offset %d committed %d, want %d", i, m.Offset, got, tt.commits[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSettleConcurrently(t *testing.T) {
+	c := &Consumer{partitions: make(map[partition]*offsets)}
+	const n = 100
+	for i := range n {
+		c.track(kafka.Message{Topic: "orders", Offset: int64(i)})
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	last := int64(-1)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			commit, ok := c.settle(kafka.Message{Topic: "orders", Offset: int64(n - 1 - i)})
+			if ok {
+				mu.Lock()
+				last = max(last, commit.Offset)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if last != n-1 {
+		t.Errorf("committed up to %d, want %d", last, n-1)
+	}
+	if p := c.partitions[partition{topic: "orders"}]; len(p.pending) != 0 || len(p.done) != 0 {
+		t.Errorf("%d offsets pending and %d done left over, want none", len(p.pending), len(p.done))
+	}
+}
+
+func TestHeader(t *testing.T) {
+	m := kafka.Message{Headers: []kafka.Header{
+		{Key: "Traceparent", Value: []byte("00-abc-def-01")},
+		{Key: "x-correlation-id", Value: []byte("42")},
+	}}
+
+	tests := []struct {
+		key, want string
+	}{
+		{key: "traceparent", want: "00-abc-def-01"},
+		{key: "X-Correlation-ID", want: "42"},
+		{key: "missing", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := header(m, tt.key); got != tt.want {
+				t.Errorf("header(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceFetchError(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errFetch := errors.New("fetch")
+	r := &fakeReader{msgs: fetched(3), err: errFetch}
+	c := fakeConsumer(r)
+
+	var got []int64
+	err := pipeline.New(c.Source()).
+		Sink(c.Sink(func(m kafka.Message) error {
+			got = append(got, m.Offset)
+			return nil
+		})).
+		Run(context.Background())
+	if !errors.Is(err, errFetch) {
+		t.Errorf("Run returned %v, want %v", err, errFetch)
+	}
+	if !errors.Is(c.Err(), errFetch) {
+		t.Errorf("Err() = %v, want %v", c.Err(), errFetch)
+	}
+	// the failure may stop the run before every message fetched got through
+	if !slices.Equal(got, []int64{0, 1, 2}[:len(got)]) {
+		t.Errorf("handled %v, want the messages fetched before failing in order", got)
+	}
+}
+
+func TestMessageSourceFetchError(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errFetch := errors.New("fetch")
+	r := &fakeReader{msgs: fetched(3), err: errFetch}
+	c := fakeConsumer(r)
+
+	err := pipeline.New(c.MessageSource()).Run(context.Background())
+	if !errors.Is(err, errFetch) {
+		t.Errorf("Run returned %v, want %v", err, errFetch)
+	}
+	if !errors.Is(c.Err(), errFetch) {
+		t.Errorf("Err() = %v, want %v", c.Err(), errFetch)
+	}
+}
+
+func TestMessageSourceCommitError(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errCommit := errors.New("commit")
+	r := &fakeReader{msgs: fetched(3), commitErr: errCommit}
+	c := fakeConsumer(r)
+
+	err := pipeline.New(c.MessageSource()).Run(context.Background())
+	if !errors.Is(err, errCommit) {
+		t.Errorf("Run returned %v, want %v", err, errCommit)
+	}
+	if !errors.Is(c.Err(), errCommit) {
+		t.Errorf("Err() = %v, want %v", c.Err(), errCommit)
+	}
+}
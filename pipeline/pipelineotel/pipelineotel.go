@@ -0,0 +1,125 @@
+// Package pipelineotel traces pipeline steps with OpenTelemetry.
+//
+// Every call of a traced step's fn gets its own span carrying the stage name
+// and attempt number. To follow a value through all of the steps in one
+// trace, wrap the values in Item with Items and the transforms with Traced:
+// each step's span then becomes the parent of the next step's span for the
+// same value.
+//
+//	tracer := pipelineotel.New(otel.GetTracerProvider())
+//
+//	items := pipelineotel.Items(ctx, source)
+//	parsed, parseErrs := pipeline.StepCtx(ctx, items, pipelineotel.Traced(parse),
+//		pipeline.WithName("parse"), pipeline.WithTracer(tracer))
+//	stored, storeErrs := pipeline.StepCtx(ctx, parsed, pipelineotel.Traced(store),
+//		pipeline.WithName("store"), pipeline.WithTracer(tracer))
+package pipelineotel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+const instrumentationName = "github.com/Joshswooft/go-pipeline-article/pipeline"
+
+// Tracer implements pipeline.Tracer on top of an OpenTelemetry tracer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ pipeline.Tracer = (*Tracer)(nil)
+
+// New returns a Tracer creating its spans with tp.
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// StartCall implements pipeline.Tracer. The span is a child of the span
+// carried by the input if it is an Item, or of the span in ctx otherwise.
+func (t *Tracer) StartCall(ctx context.Context, call pipeline.CallInfo) (context.Context, func(error)) {
+	parent := ctx
+	if carrier, ok := call.Input.(interface{ SpanContext() trace.SpanContext }); ok {
+		if sc := carrier.SpanContext(); sc.IsValid() {
+			parent = trace.ContextWithSpanContext(ctx, sc)
+		}
+	}
+
+	name := call.Stage
+	if name == "" {
+		name = "pipeline.step"
+	}
+
+	callCtx, span := t.tracer.Start(parent, name, trace.WithAttributes(
+		attribute.String("pipeline.stage", call.Stage),
+		attribute.Int("pipeline.attempt", call.Attempt),
+	))
+	clock := pipeline.ClockFrom(parent)
+	start := clock.Now()
+
+	return callCtx, func(err error) {
+		span.SetAttributes(attribute.Int64("pipeline.duration_ms", clock.Now().Sub(start).Milliseconds()))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// Item is a value travelling through a pipeline together with the span
+// context of the step that produced it.
+type Item[T any] struct {
+	Trace trace.SpanContext
+	Value T
+}
+
+// SpanContext returns the span context the next traced step continues from.
+func (i Item[T]) SpanContext() trace.SpanContext {
+	return i.Trace
+}
+
+// Items wraps every value read from in as an Item continuing the span in ctx,
+// if any, so the first traced step becomes part of the caller's trace. The
+// output is closed once in is closed or ctx is done.
+func Items[T any](ctx context.Context, in <-chan T) <-chan Item[T] {
+	outChannel := make(chan Item[T])
+	sc := trace.SpanContextFromContext(ctx)
+
+	go func() {
+		defer close(outChannel)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- Item[T]{Trace: sc, Value: v}:
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// Traced adapts fn to work on Items for pipeline.StepCtx. The result carries
+// the span of the call that produced it, so the next traced step picks up
+// where this one left off.
+func Traced[In any, Out any](fn func(context.Context, In) (Out, error)) func(context.Context, Item[In]) (Item[Out], error) {
+	return func(ctx context.Context, in Item[In]) (Item[Out], error) {
+		out, err := fn(ctx, in.Value)
+		return Item[Out]{Trace: trace.SpanContextFromContext(ctx), Value: out}, err
+	}
+}
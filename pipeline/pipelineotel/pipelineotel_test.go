@@ -0,0 +1,287 @@
+package pipelineotel_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineotel"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+var errBad = errors.New("bad value")
+
+// recorder is a TracerProvider keeping every span it starts.
+type recorder struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+func (r *recorder) Tracer(string, ...trace.TracerOption) trace.Tracer { return tracer{r: r} }
+
+type tracer struct {
+	embedded.Tracer
+	r *recorder
+}
+
+func (t tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	r := t.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg := trace.NewSpanStartConfig(opts...)
+	parent := trace.SpanContextFromContext(ctx)
+	traceID := parent.TraceID()
+	if !parent.IsValid() {
+		traceID = trace.TraceID{byte(len(r.spans) + 1)}
+	}
+	s := &span{
+		r:      r,
+		name:   name,
+		parent: parent,
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     trace.SpanID{byte(len(r.spans) + 1)},
+			TraceFlags: trace.FlagsSampled,
+		}),
+		attrs: cfg.Attributes(),
+	}
+	r.spans = append(r.spans, s)
+
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (r *recorder) recorded() []span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]span, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = *s
+	}
+	return spans
+}
+
+type span struct {
+	noop.Span
+	r *recorder
+
+	name       string
+	parent, sc trace.SpanContext
+	attrs      []attribute.KeyValue
+	status     codes.Code
+	err        error
+	ended      bool
+}
+
+func (s *span) SpanContext() trace.SpanContext { return s.sc }
+
+func (s *span) SetAttributes(kv ...attribute.KeyValue) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.attrs = append(s.attrs, kv...)
+}
+
+func (s *span) SetStatus(code codes.Code, _ string) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.status = code
+}
+
+func (s *span) RecordError(err error, _ ...trace.EventOption) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.err = err
+}
+
+func (s *span) End(...trace.SpanEndOption) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.ended = true
+}
+
+func (s span) attr(key string) attribute.Value {
+	for _, kv := range s.attrs {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// root is the span context of the caller the tests trace from.
+var root = trace.NewSpanContext(trace.SpanContextConfig{
+	TraceID:    trace.TraceID{0xff},
+	SpanID:     trace.SpanID{0xff},
+	TraceFlags: trace.FlagsSampled,
+})
+
+func TestStartCall(t *testing.T) {
+	upstream := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0xee},
+		SpanID:  trace.SpanID{0xee},
+	})
+
+	tests := []struct {
+		name       string
+		call       pipeline.CallInfo
+		err        error
+		wantName   string
+		wantParent trace.SpanContext
+		wantStatus codes.Code
+	}{
+		{
+			name:       "named stage",
+			call:       pipeline.CallInfo{Stage: "parse", Attempt: 2, Input: 1},
+			wantName:   "parse",
+			wantParent: root,
+		},
+		{
+			name:       "unnamed stage",
+			call:       pipeline.CallInfo{Attempt: 1, Input: 1},
+			wantName:   "pipeline.step",
+			wantParent: root,
+		},
+		{
+			name:       "failed",
+			call:       pipeline.CallInfo{Stage: "parse", Attempt: 1, Input: 1},
+			err:        errBad,
+			wantName:   "parse",
+			wantParent: root,
+			wantStatus: codes.Error,
+		},
+		{
+			name:       "continues an item",
+			call:       pipeline.CallInfo{Stage: "store", Attempt: 1, Input: pipelineotel.Item[int]{Trace: upstream, Value: 1}},
+			wantName:   "store",
+			wantParent: upstream,
+		},
+		{
+			name:       "item without a span",
+			call:       pipeline.CallInfo{Stage: "store", Attempt: 1, Input: pipelineotel.Item[int]{Value: 1}},
+			wantName:   "store",
+			wantParent: root,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			ctx := trace.ContextWithSpanContext(context.Background(), root)
+
+			callCtx, end := pipelineotel.New(r).StartCall(ctx, tt.call)
+			end(tt.err)
+
+			spans := r.recorded()
+			if len(spans) != 1 {
+				t.Fatalf("started %d spans, want 1", len(spans))
+			}
+			s := spans[0]
+			if got := trace.SpanContextFromContext(callCtx); !got.Equal(s.sc) {
+				t.Errorf("call context carries %v, want the call's span", got)
+			}
+			if s.name != tt.wantName {
+				t.Errorf("span name %q, want %q", s.name, tt.wantName)
+			}
+			if !s.parent.Equal(tt.wantParent) {
+				t.Errorf("span parent %v, want %v", s.parent.SpanID(), tt.wantParent.SpanID())
+			}
+			if got := s.attr("pipeline.stage").AsString(); got != tt.call.Stage {
+				t.Errorf("pipeline.stage = %q, want %q", got, tt.call.Stage)
+			}
+			if got := s.attr("pipeline.attempt").AsInt64(); got != int64(tt.call.Attempt) {
+				t.Errorf("pipeline.attempt = %d, want %d", got, tt.call.Attempt)
+			}
+			if s.attr("pipeline.duration_ms").Type() != attribute.INT64 {
+				t.Errorf("no pipeline.duration_ms")
+			}
+			if s.status != tt.wantStatus || !errors.Is(s.err, tt.err) {
+				t.Errorf("span status %v with error %v, want %v with %v", s.status, s.err, tt.wantStatus, tt.err)
+			}
+			if !s.ended {
+				t.Errorf("span not ended")
+			}
+		})
+	}
+}
+
+func TestTracedFollowsValues(t *testing.T) {
+	r := &recorder{}
+	tracer := pipelineotel.New(r)
+	ctx := trace.ContextWithSpanContext(context.Background(), root)
+
+	source := make(chan int)
+	go func() {
+		defer close(source)
+		for i := 1; i <= 3; i++ {
+			source <- i
+		}
+	}()
+
+	items := pipelineotel.Items(ctx, source)
+	doubled, doubleErrs := pipeline.StepCtx(ctx, items, pipelineotel.Traced(func(_ context.Context, v int) (int, error) {
+		return v * 2, nil
+	}), pipeline.WithName("double"), pipeline.WithTracer(tracer))
+	checked, checkErrs := pipeline.StepCtx(ctx, doubled, pipelineotel.Traced(func(_ context.Context, v int) (int, error) {
+		if v == 6 {
+			return 0, errBad
+		}
+		return v, nil
+	}), pipeline.WithName("check"), pipeline.WithTracer(tracer))
+
+	errs := make(chan []error)
+	go func() {
+		errs <- pipelinetest.Collect(t, pipeline.Merge(ctx, doubleErrs, checkErrs))
+	}()
+	out := pipelinetest.Collect(t, checked)
+	if failed := <-errs; len(failed) != 1 {
+		t.Errorf("got errors %v, want one", failed)
+	}
+
+	spans := r.recorded()
+	byID := make(map[trace.SpanID]span, len(spans))
+	for _, s := range spans {
+		byID[s.sc.SpanID()] = s
+	}
+	for _, item := range out {
+		if s, ok := byID[item.Trace.SpanID()]; !ok || s.name != "check" {
+			t.Errorf("result %d carries span %v, want its check span", item.Value, item.Trace.SpanID())
+		}
+	}
+
+	var checks, failed int
+	for _, s := range spans {
+		if s.sc.TraceID() != root.TraceID() {
+			t.Errorf("span %s left the caller's trace", s.name)
+		}
+		switch s.name {
+		case "double":
+			if !s.parent.Equal(root) {
+				t.Errorf("double span's parent %v, want the caller's span", s.parent.SpanID())
+			}
+		case "check":
+			checks++
+			if parent, ok := byID[s.parent.SpanID()]; !ok || parent.name != "double" {
+				t.Errorf("check span's parent %v isn't a double span", s.parent.SpanID())
+			}
+			if s.status == codes.Error {
+				failed++
+			}
+		default:
+			t.Errorf("unexpected span %q", s.name)
+		}
+	}
+	if checks != 3 || failed != 1 || len(spans) != 6 {
+		t.Errorf("got %d spans, %d of check with %d failed, want 6, 3 and 1", len(spans), checks, failed)
+	}
+}
@@ -0,0 +1,128 @@
+// Package pipelineprom exports per-stage pipeline metrics to Prometheus.
+//
+//	metrics := pipelineprom.New("myapp")
+//	prometheus.MustRegister(metrics)
+//
+//	out, errs := pipeline.Step(ctx, in, fn,
+//		pipeline.WithName("enrich"),
+//		pipeline.WithMetrics(metrics),
+//	)
+//
+// Every metric carries a "stage" label with the step's name. Batch jobs over
+// before they can be scraped push them to a Pushgateway instead, see
+// PushEvery.
+package pipelineprom
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Metrics implements pipeline.StageMetrics with Prometheus counters, gauges
+// and a latency histogram. It is a prometheus.Collector, so it can be
+// registered with any registry.
+type Metrics struct {
+	itemsIn    *prometheus.CounterVec
+	itemsOut   *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	retries    *prometheus.CounterVec
+	inFlight   *prometheus.GaugeVec
+	queueDepth *prometheus.GaugeVec
+	latency    *prometheus.HistogramVec
+}
+
+var _ pipeline.StageMetrics = (*Metrics)(nil)
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// New creates the pipeline metrics under namespace. Nothing is registered
+// until the returned Metrics is handed to a registry.
+func New(namespace string) *Metrics {
+	labels := []string{"stage"}
+	counter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pipeline",
+			Name:      name,
+			Help:      help,
+		}, labels)
+	}
+	gauge := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "pipeline",
+			Name:      name,
+			Help:      help,
+		}, labels)
+	}
+
+	return &Metrics{
+		itemsIn:    counter("items_in_total", "Values read by the stage."),
+		itemsOut:   counter("items_out_total", "Results produced by the stage."),
+		errors:     counter("errors_total", "Values that failed in the stage."),
+		retries:    counter("retries_total", "Retried attempts in the stage."),
+		inFlight:   gauge("in_flight", "Values currently being processed by the stage."),
+		queueDepth: gauge("queue_depth", "Values waiting in the stage's input channel."),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "pipeline",
+			Name:      "item_duration_seconds",
+			Help:      "Time taken to process a value, retries included.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+	}
+}
+
+// Handler returns an http.Handler serving only these metrics, for programs
+// that don't otherwise use Prometheus. Register Metrics with your own
+// registry instead to serve them alongside other metrics.
+func (m *Metrics) Handler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.itemsIn, m.itemsOut, m.errors, m.retries,
+		m.inFlight, m.queueDepth, m.latency,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// The methods below implement pipeline.StageMetrics.
+
+func (m *Metrics) ItemIn(stage string)    { m.itemsIn.WithLabelValues(stage).Inc() }
+func (m *Metrics) ItemOut(stage string)   { m.itemsOut.WithLabelValues(stage).Inc() }
+func (m *Metrics) ItemError(stage string) { m.errors.WithLabelValues(stage).Inc() }
+func (m *Metrics) Retry(stage string)     { m.retries.WithLabelValues(stage).Inc() }
+
+func (m *Metrics) InFlight(stage string, delta int) {
+	m.inFlight.WithLabelValues(stage).Add(float64(delta))
+}
+
+func (m *Metrics) QueueDepth(stage string, depth int) {
+	m.queueDepth.WithLabelValues(stage).Set(float64(depth))
+}
+
+func (m *Metrics) Latency(stage string, d time.Duration) {
+	m.latency.WithLabelValues(stage).Observe(d.Seconds())
+}
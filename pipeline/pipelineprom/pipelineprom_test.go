@@ -0,0 +1,82 @@
+package pipelineprom_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineprom"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+var errOdd = errors.New("odd value")
+
+// scrape returns the exposition served by the metrics' Handler.
+func scrape(t *testing.T, metrics *pipelineprom.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := pipelineprom.New("test")
+	pipelinetest.RunStageCtx(t, func(_ context.Context, v int) (int, error) {
+		if v%2 == 1 {
+			return 0, errOdd
+		}
+		return v, nil
+	}, []int{1, 2, 3, 4, 6}, pipeline.WithName("even"), pipeline.WithMetrics(metrics))
+	got := scrape(t, metrics)
+
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "values read", line: `test_pipeline_items_in_total{stage="even"} 5`},
+		{name: "results", line: `test_pipeline_items_out_total{stage="even"} 3`},
+		{name: "failures", line: `test_pipeline_errors_total{stage="even"} 2`},
+		{name: "nothing left in flight", line: `test_pipeline_in_flight{stage="even"} 0`},
+		{name: "every latency observed", line: `test_pipeline_item_duration_seconds_count{stage="even"} 5`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(got, tt.line+"\n") {
+				t.Errorf("scrape lacks %s:\n%s", tt.line, got)
+			}
+		})
+	}
+}
+
+func TestMetricsStages(t *testing.T) {
+	metrics := pipelineprom.New("test")
+	metrics.ItemIn("parse")
+	metrics.ItemIn("parse")
+	metrics.ItemIn("store")
+	metrics.Retry("store")
+	metrics.QueueDepth("store", 7)
+	got := scrape(t, metrics)
+
+	for _, line := range []string{
+		`test_pipeline_items_in_total{stage="parse"} 2`,
+		`test_pipeline_items_in_total{stage="store"} 1`,
+		`test_pipeline_retries_total{stage="store"} 1`,
+		`test_pipeline_queue_depth{stage="store"} 7`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("scrape lacks %s:\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, `retries_total{stage="parse"}`) {
+		t.Errorf("retries reported for a stage that never retried:\n%s", got)
+	}
+}
@@ -0,0 +1,63 @@
+package pipelineprom
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Pusher returns a push.Pusher pushing these metrics to the Pushgateway at
+// url under job, for pipelines that don't run long enough to be scraped.
+// Set grouping labels, auth and the like on it before handing it to
+// PushEvery.
+func (m *Metrics) Pusher(url, job string) *push.Pusher {
+	return push.New(url, job).Collector(m)
+}
+
+// PushEvery pushes with pusher every interval until the returned func is
+// called, which pushes once more, so the Pushgateway ends up with the final
+// counts, and returns the error of that last push:
+//
+//	stop := pipelineprom.PushEvery(ctx, metrics.Pusher(gateway, "nightly-import"), 15*time.Second)
+//	err := p.Run(ctx)
+//	if pushErr := stop(); pushErr != nil {
+//		log.Printf("pushing metrics: %v", pushErr)
+//	}
+//
+// A failed push in between is made up for by the next one. With an interval
+// of 0 only the final push is made. The final push is made with a context
+// that isn't cancelled with ctx, as ctx is often done by the time a run
+// returns.
+func PushEvery(ctx context.Context, pusher *push.Pusher, interval time.Duration) func() error {
+	pushCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		if interval <= 0 {
+			<-pushCtx.Done()
+			return
+		}
+
+		ticker := pipeline.ClockFrom(pushCtx).NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pushCtx.Done():
+				return
+			case <-ticker.C():
+				_ = pusher.PushContext(pushCtx)
+			}
+		}
+	}()
+
+	return func() error {
+		cancel()
+		<-done
+
+		return pusher.PushContext(context.WithoutCancel(ctx))
+	}
+}
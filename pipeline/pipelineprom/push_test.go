@@ -0,0 +1,93 @@
+package pipelineprom_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineprom"
+)
+
+// gateway records the bodies pushed to it.
+type gateway struct {
+	mu     sync.Mutex
+	pushes []string
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if r.Method != http.MethodPut || r.URL.Path != "/metrics/job/batch" {
+		http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pushes = append(g.pushes, string(body))
+}
+
+func (g *gateway) received() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.pushes...)
+}
+
+func TestPushEvery(t *testing.T) {
+	tests := []struct {
+		name       string
+		interval   time.Duration
+		wantPushes int
+	}{
+		{name: "final push only", interval: 0, wantPushes: 1},
+		{name: "interval pushes", interval: time.Millisecond, wantPushes: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &gateway{}
+			server := httptest.NewServer(gw)
+			defer server.Close()
+
+			metrics := pipelineprom.New("test")
+			stop := pipelineprom.PushEvery(context.Background(), metrics.Pusher(server.URL, "batch"), tt.interval)
+			if tt.interval > 0 {
+				deadline := time.Now().Add(10 * time.Second)
+				for len(gw.received()) == 0 && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			metrics.ItemOut("parse")
+			if err := stop(); err != nil {
+				t.Fatal(err)
+			}
+
+			pushes := gw.received()
+			if len(pushes) < tt.wantPushes {
+				t.Fatalf("%d pushes, want at least %d", len(pushes), tt.wantPushes)
+			}
+			if last := pushes[len(pushes)-1]; !strings.Contains(last, "test_pipeline_items_out_total") {
+				t.Errorf("final push lacks the final counts:\n%s", last)
+			}
+		})
+	}
+}
+
+func TestPushEveryCancelled(t *testing.T) {
+	gw := &gateway{}
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := pipelineprom.PushEvery(ctx, pipelineprom.New("test").Pusher(server.URL, "batch"), time.Hour)
+	cancel()
+	if err := stop(); err != nil {
+		t.Fatalf("final push after ctx was cancelled: %v", err)
+	}
+	if n := len(gw.received()); n != 1 {
+		t.Errorf("%d pushes, want the final one", n)
+	}
+}
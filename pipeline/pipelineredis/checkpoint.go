@@ -0,0 +1,78 @@
+package pipelineredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Checkpointer keeps the offsets of pipeline.Pipeline.Checkpoint in a Redis
+// list, the last saved first, so pipelines running on machines without a
+// disk of their own can resume, and be rewound to an offset kept before
+// the last, see pipeline.CheckpointHistory.
+type Checkpointer struct {
+	client redis.UniversalClient
+	key    string
+	keep   int
+}
+
+var (
+	_ pipeline.Checkpointer      = (*Checkpointer)(nil)
+	_ pipeline.CheckpointHistory = (*Checkpointer)(nil)
+)
+
+// NewCheckpointer returns a Checkpointer keeping the last keep offsets, at
+// least one, in the list at key.
+func NewCheckpointer(client redis.UniversalClient, key string, keep int) *Checkpointer {
+	return &Checkpointer{client: client, key: key, keep: max(keep, 1)}
+}
+
+// Load returns the last offset saved, 0 if there is none.
+func (c *Checkpointer) Load(ctx context.Context) (int64, error) {
+	offset, err := c.client.LIndex(ctx, c.key, 0).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("pipelineredis: loading checkpoint %s: %w", c.key, err)
+	}
+
+	return offset, nil
+}
+
+// Save adds offset at the head of the list and drops the ones past keep, in
+// a transaction, so the list is never seen half updated.
+func (c *Checkpointer) Save(ctx context.Context, offset int64) error {
+	_, err := c.client.TxPipelined(ctx, func(tx redis.Pipeliner) error {
+		tx.LPush(ctx, c.key, offset)
+		tx.LTrim(ctx, c.key, 0, int64(c.keep-1))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("pipelineredis: saving checkpoint %s: %w", c.key, err)
+	}
+
+	return nil
+}
+
+// Checkpoints returns the offsets kept, the last saved first.
+func (c *Checkpointer) Checkpoints(ctx context.Context) ([]int64, error) {
+	values, err := c.client.LRange(ctx, c.key, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("pipelineredis: loading checkpoints %s: %w", c.key, err)
+	}
+
+	offsets := make([]int64, len(values))
+	for i, v := range values {
+		if offsets[i], err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("pipelineredis: invalid checkpoint in %s: %w", c.key, err)
+		}
+	}
+
+	return offsets, nil
+}
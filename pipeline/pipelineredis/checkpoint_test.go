@@ -0,0 +1,64 @@
+package pipelineredis_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineredis"
+)
+
+func TestCheckpointer(t *testing.T) {
+	tests := []struct {
+		name string
+		keep int
+		want []int64
+	}{
+		{name: "last", keep: 1, want: []int64{3}},
+		{name: "below one", keep: 0, want: []int64{3}},
+		{name: "keep", keep: 2, want: []int64{3, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client, _ := newFakeRedis(t)
+			cp := pipelineredis.NewCheckpointer(client, "orders:offset", tt.keep)
+
+			if offset, err := cp.Load(ctx); offset != 0 || err != nil {
+				t.Fatalf("Load before any Save = %d, %v, want 0, nil", offset, err)
+			}
+			for offset := int64(1); offset <= 3; offset++ {
+				if err := cp.Save(ctx, offset); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if offset, err := cp.Load(ctx); offset != 3 || err != nil {
+				t.Errorf("Load = %d, %v, want 3, nil", offset, err)
+			}
+			got, err := cp.Checkpoints(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Checkpoints = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointerDown(t *testing.T) {
+	ctx := context.Background()
+	client, fake := newFakeRedis(t)
+	fake.setDown(true)
+
+	cp := pipelineredis.NewCheckpointer(client, "orders:offset", 1)
+	if _, err := cp.Load(ctx); !errors.Is(err, errDown) {
+		t.Errorf("Load error = %v, want %v", err, errDown)
+	}
+	if err := cp.Save(ctx, 1); !errors.Is(err, errDown) {
+		t.Errorf("Save error = %v, want %v", err, errDown)
+	}
+}
@@ -0,0 +1,222 @@
+package pipelineredis_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var errDown = errors.New("redis is down")
+
+// fakeRedis is the little of Redis the tests need, served from memory by a
+// hook so the client never connects anywhere.
+type fakeRedis struct {
+	mu    sync.Mutex
+	down  bool
+	zsets map[string]map[string]float64
+	lists map[string][]string
+	locks map[string]fakeLock
+}
+
+// fakeLock is a key set by the scripts of Leader.
+type fakeLock struct {
+	holder  string
+	expires time.Time
+}
+
+func newFakeRedis(t *testing.T) (*redis.Client, *fakeRedis) {
+	t.Helper()
+
+	f := &fakeRedis{
+		zsets: make(map[string]map[string]float64),
+		lists: make(map[string][]string),
+		locks: make(map[string]fakeLock),
+	}
+	client := redis.NewClient(&redis.Options{Addr: "fake:6379"})
+	client.AddHook(f)
+	t.Cleanup(func() { client.Close() })
+
+	return client, f
+}
+
+func (f *fakeRedis) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+// holder returns who holds the lock at key, "" if nobody does.
+func (f *fakeRedis) holder(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if l := f.locks[key]; time.Now().Before(l.expires) {
+		return l.holder
+	}
+	return ""
+}
+
+func (f *fakeRedis) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("fake redis doesn't dial")
+	}
+}
+
+func (f *fakeRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		f.process(cmd)
+		return cmd.Err()
+	}
+}
+
+func (f *fakeRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		var first error
+		for _, cmd := range cmds {
+			f.process(cmd)
+			if first == nil {
+				first = cmd.Err()
+			}
+		}
+		return first
+	}
+}
+
+func (f *fakeRedis) process(cmd redis.Cmder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.down {
+		cmd.SetErr(errDown)
+		return
+	}
+
+	args := make([]string, len(cmd.Args()))
+	for i, a := range cmd.Args() {
+		args[i] = fmt.Sprint(a)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "multi", "exec":
+		// commands apply one at a time anyway
+	case "ping":
+		cmd.(*redis.StatusCmd).SetVal("PONG")
+	case "lpush":
+		for _, v := range args[2:] {
+			f.lists[args[1]] = append([]string{v}, f.lists[args[1]]...)
+		}
+		cmd.(*redis.IntCmd).SetVal(int64(len(f.lists[args[1]])))
+	case "ltrim":
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		list := f.lists[args[1]]
+		f.lists[args[1]] = list[min(start, len(list)):min(stop+1, len(list))]
+		cmd.(*redis.StatusCmd).SetVal("OK")
+	case "lindex":
+		i, _ := strconv.Atoi(args[2])
+		if list := f.lists[args[1]]; i < len(list) {
+			cmd.(*redis.StringCmd).SetVal(list[i])
+		} else {
+			cmd.SetErr(redis.Nil)
+		}
+	case "lrange":
+		// only ever the whole list
+		cmd.(*redis.StringSliceCmd).SetVal(slices.Clone(f.lists[args[1]]))
+	case "zadd":
+		set := f.zsets[args[1]]
+		if set == nil {
+			set = make(map[string]float64)
+			f.zsets[args[1]] = set
+		}
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := set[args[i+1]]; !ok {
+				added++
+			}
+			set[args[i+1]] = score(args[i])
+		}
+		cmd.(*redis.IntCmd).SetVal(int64(added))
+	case "zrem":
+		removed := 0
+		for _, m := range args[2:] {
+			if _, ok := f.zsets[args[1]][m]; ok {
+				delete(f.zsets[args[1]], m)
+				removed++
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(int64(removed))
+	case "zremrangebyscore":
+		removed := 0
+		for m, s := range f.zsets[args[1]] {
+			if inRange(s, args[2], args[3]) {
+				delete(f.zsets[args[1]], m)
+				removed++
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(int64(removed))
+	case "zcard":
+		cmd.(*redis.IntCmd).SetVal(int64(len(f.zsets[args[1]])))
+	case "zrangebyscore":
+		var members []string
+		for m, s := range f.zsets[args[1]] {
+			if inRange(s, args[2], args[3]) {
+				members = append(members, m)
+			}
+		}
+		set := f.zsets[args[1]]
+		slices.SortFunc(members, func(a, b string) int {
+			return cmp.Or(cmp.Compare(set[a], set[b]), strings.Compare(a, b))
+		})
+		cmd.(*redis.StringSliceCmd).SetVal(members)
+	case "eval":
+		// the scripts of Leader: eval script 1 key holder [ttl]
+		key, holder := args[3], args[4]
+		l := f.locks[key]
+		held := time.Now().Before(l.expires)
+		n := 0
+		switch {
+		case strings.Contains(args[1], "del"):
+			if held && l.holder == holder {
+				delete(f.locks, key)
+				n = 1
+			}
+		case !held || l.holder == holder:
+			ttl, _ := strconv.Atoi(args[5])
+			f.locks[key] = fakeLock{holder: holder, expires: time.Now().Add(time.Duration(ttl) * time.Millisecond)}
+			n = 1
+		}
+		cmd.(*redis.Cmd).SetVal(int64(n))
+	default:
+		cmd.SetErr(fmt.Errorf("fake redis doesn't know %s", args[0]))
+	}
+}
+
+// score parses a sorted set bound, "(" marking it exclusive.
+func score(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimPrefix(s, "("), 64)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func inRange(s float64, lo, hi string) bool {
+	above := s >= score(lo)
+	if strings.HasPrefix(lo, "(") {
+		above = s > score(lo)
+	}
+	below := s <= score(hi)
+	if strings.HasPrefix(hi, "(") {
+		below = s < score(hi)
+	}
+	return above && below
+}
@@ -0,0 +1,101 @@
+package pipelineredis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// acquireScript takes the lock if it is free, or extends it if it is held
+// by the caller already.
+const acquireScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+if redis.call("set", KEYS[1], ARGV[1], "nx", "px", ARGV[2]) then
+	return 1
+end
+return 0
+`
+
+// releaseScript frees the lock if it is held by the caller.
+const releaseScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`
+
+// Leader elects one instance of a pipeline leader with a lock in Redis, for
+// pipeline.LeaderSource. The leader holds the lock for a ttl and renews it
+// every third of the ttl, the others try to take it as often. A leader that
+// fails to renew the lock, Redis being out of reach say, gives up the
+// leadership at once, while the lock keeps the others out until it
+// expires, so two instances only lead at a time if one is stalled for
+// longer than the ttl.
+type Leader struct {
+	client redis.UniversalClient
+	key    string
+	self   string
+	ttl    time.Duration
+}
+
+var _ pipeline.Elector = (*Leader)(nil)
+
+// NewLeader returns a Leader campaigning as self for the lock at key.
+func NewLeader(client redis.UniversalClient, key, self string, ttl time.Duration) *Leader {
+	return &Leader{client: client, key: key, self: self, ttl: ttl}
+}
+
+// Campaign implements pipeline.Elector: it tries to take the lock every
+// third of the ttl until it has it, then renews it as often until renewing
+// fails, or ctx is done, when it releases it.
+func (l *Leader) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	ticker := pipeline.ClockFrom(ctx).NewTicker(l.ttl / 3)
+	for !l.acquire(ctx) {
+		select {
+		case <-ctx.Done():
+			ticker.Stop()
+			return nil, ctx.Err()
+		case <-ticker.C():
+		}
+	}
+
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				l.release(ctx)
+				return
+			case <-ticker.C():
+				if !l.acquire(ctx) {
+					if ctx.Err() != nil {
+						l.release(ctx)
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return lost, nil
+}
+
+// acquire reports whether the instance holds the lock, failures to reach
+// Redis counting as not.
+func (l *Leader) acquire(ctx context.Context) bool {
+	n, err := l.client.Eval(ctx, acquireScript, []string{l.key}, l.self, l.ttl.Milliseconds()).Int()
+	return err == nil && n == 1
+}
+
+// release frees the lock on resigning, likely because ctx is done.
+func (l *Leader) release(ctx context.Context) {
+	l.client.Eval(context.WithoutCancel(ctx), releaseScript, []string{l.key}, l.self)
+}
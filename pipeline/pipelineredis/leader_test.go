@@ -0,0 +1,120 @@
+package pipelineredis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineredis"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+const ttl = 60 * time.Millisecond
+
+// elected returns a channel with the result of campaigning as self once
+// there is one.
+func elected(ctx context.Context, l *pipelineredis.Leader) <-chan (<-chan struct{}) {
+	result := make(chan (<-chan struct{}), 1)
+	go func() {
+		lost, err := l.Campaign(ctx)
+		if err != nil {
+			close(result)
+			return
+		}
+		result <- lost
+	}()
+	return result
+}
+
+// waitClosed fails the test if lost isn't closed soon.
+func waitClosed(t *testing.T, lost <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership not given up")
+	}
+}
+
+func TestLeaderFailover(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	client, fake := newFakeRedis(t)
+
+	ctxA, resignA := context.WithCancel(context.Background())
+	defer resignA()
+	lostA, err := pipelineredis.NewLeader(client, "export", "a", ttl).Campaign(ctxA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctxB, resignB := context.WithCancel(context.Background())
+	defer resignB()
+	b := elected(ctxB, pipelineredis.NewLeader(client, "export", "b", ttl))
+
+	// a keeps the lock past its ttl by renewing it
+	select {
+	case <-b:
+		t.Fatal("b was elected while a leads")
+	case <-lostA:
+		t.Fatal("a lost the lock while renewing it")
+	case <-time.After(3 * ttl):
+	}
+	if got := fake.holder("export"); got != "a" {
+		t.Fatalf("lock held by %q, want a", got)
+	}
+
+	resignA()
+	waitClosed(t, lostA)
+	lostB := pipelinetest.Receive(t, b)
+	if got := fake.holder("export"); got != "b" {
+		t.Errorf("lock held by %q after a resigned, want b", got)
+	}
+
+	resignB()
+	waitClosed(t, lostB)
+	if got := fake.holder("export"); got != "" {
+		t.Errorf("lock held by %q after b resigned, want nobody", got)
+	}
+}
+
+func TestLeaderLosesRedis(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	client, fake := newFakeRedis(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost, err := pipelineredis.NewLeader(client, "export", "a", ttl).Campaign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.setDown(true)
+	select {
+	case <-lost:
+	case <-time.After(ttl):
+		t.Fatal("leader didn't give up the leadership within the ttl of failing to renew")
+	}
+}
+
+func TestLeaderCampaignCancelled(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	client, _ := newFakeRedis(t)
+
+	ctxA, resignA := context.WithCancel(context.Background())
+	defer resignA()
+	lostA, err := pipelineredis.NewLeader(client, "export", "a", ttl).Campaign(ctxA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ttl)
+	defer cancel()
+	if _, err := pipelineredis.NewLeader(client, "export", "b", ttl).Campaign(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Campaign error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	resignA()
+	waitClosed(t, lostA)
+}
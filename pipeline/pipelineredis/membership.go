@@ -0,0 +1,94 @@
+package pipelineredis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Membership keeps track of the instances of a pipeline in a sorted set, for
+// pipeline.ShardedSource to share shards out between them. Every instance
+// joins under a name of its own and stays a member while it renews its
+// registration, so one that dies drops out after the ttl. Instances compare
+// their clocks with the registrations, which must be well within the ttl of
+// each other.
+type Membership struct {
+	client redis.UniversalClient
+	key    string
+	self   string
+	ttl    time.Duration
+}
+
+var _ pipeline.Membership = (*Membership)(nil)
+
+// NewMembership returns the Membership of the instances registered under key
+// as self.
+func NewMembership(client redis.UniversalClient, key, self string, ttl time.Duration) *Membership {
+	return &Membership{client: client, key: key, self: self, ttl: ttl}
+}
+
+// Join registers the instance and renews its registration every third of
+// the ttl until leave is called, which removes it, or ctx is done, after
+// which it expires. Failing to renew is left to the next try.
+func (m *Membership) Join(ctx context.Context) (leave func(), err error) {
+	if err := m.renew(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := pipeline.ClockFrom(ctx).NewTicker(m.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				_ = m.renew(ctx)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		// the instance is leaving, likely because ctx is done
+		m.client.ZRem(context.WithoutCancel(ctx), m.key, m.self)
+	}, nil
+}
+
+// renew registers the instance until the ttl from now and drops those whose
+// registration ran out.
+func (m *Membership) renew(ctx context.Context) error {
+	now := pipeline.ClockFrom(ctx).Now()
+	if err := m.client.ZAdd(ctx, m.key, redis.Z{Score: float64(now.Add(m.ttl).UnixMilli()), Member: m.self}).Err(); err != nil {
+		return fmt.Errorf("pipelineredis: joining %s: %w", m.key, err)
+	}
+	if err := m.client.ZRemRangeByScore(ctx, m.key, "-inf", strconv.FormatInt(now.UnixMilli(), 10)).Err(); err != nil {
+		return fmt.Errorf("pipelineredis: joining %s: %w", m.key, err)
+	}
+
+	return nil
+}
+
+// Members returns the names of the instances registered, whether they joined
+// through this Membership or another.
+func (m *Membership) Members(ctx context.Context) ([]string, error) {
+	members, err := m.client.ZRangeByScore(ctx, m.key, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(pipeline.ClockFrom(ctx).Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("pipelineredis: members of %s: %w", m.key, err)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,88 @@
+package pipelineredis_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineredis"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestMembership(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+	client, _ := newFakeRedis(t)
+
+	a := pipelineredis.NewMembership(client, "orders", "a", time.Minute)
+	b := pipelineredis.NewMembership(client, "orders", "b", time.Minute)
+
+	leaveA, err := a.Join(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaveB, err := b.Join(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leaveB()
+
+	members, err := b.Members(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(members)
+	if want := []string{"a", "b"}; !slices.Equal(members, want) {
+		t.Errorf("members = %v, want %v", members, want)
+	}
+
+	leaveA()
+	if members, _ := b.Members(ctx); !slices.Equal(members, []string{"b"}) {
+		t.Errorf("members after a left = %v, want [b]", members)
+	}
+}
+
+func TestMembershipExpires(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newFakeRedis(t)
+
+	// a registration that ran out, as an instance that died leaves it
+	expired := float64(time.Now().Add(-time.Second).UnixMilli())
+	client.ZAdd(ctx, "orders", redis.Z{Score: expired, Member: "dead"})
+
+	m := pipelineredis.NewMembership(client, "orders", "a", time.Minute)
+	if members, _ := m.Members(ctx); len(members) != 0 {
+		t.Errorf("members = %v, want the expired one left out", members)
+	}
+
+	leave, err := m.Join(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leave()
+
+	if n := client.ZCard(ctx, "orders").Val(); n != 1 {
+		t.Errorf("%d registrations, want the expired one dropped on joining", n)
+	}
+	if members, _ := m.Members(ctx); !slices.Equal(members, []string{"a"}) {
+		t.Errorf("members = %v, want [a]", members)
+	}
+}
+
+func TestMembershipDown(t *testing.T) {
+	ctx := context.Background()
+	client, fake := newFakeRedis(t)
+	fake.setDown(true)
+
+	m := pipelineredis.NewMembership(client, "orders", "a", time.Minute)
+	if _, err := m.Join(ctx); !errors.Is(err, errDown) {
+		t.Errorf("Join error = %v, want %v", err, errDown)
+	}
+	if _, err := m.Members(ctx); !errors.Is(err, errDown) {
+		t.Errorf("Members error = %v, want %v", err, errDown)
+	}
+}
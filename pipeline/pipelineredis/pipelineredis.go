@@ -0,0 +1,332 @@
+// Package pipelineredis feeds a pipeline from a Redis stream as a member of
+// a consumer group, with at-least-once delivery, and writes pipeline results
+// to a stream, for deployments too small to be worth running Kafka for:
+//
+//	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	c := pipelineredis.NewConsumer(client, "orders", "enricher", hostname,
+//		pipelineredis.WithReclaim(time.Minute),
+//	)
+//	p := pipelineredis.NewProducer(client, "enriched", 100_000)
+//
+//	err := pipeline.New(c.Source()).
+//		Then(enrich, pipeline.WithConcurrency(8)).
+//		Sink(c.Sink(func(m redis.XMessage) error {
+//			_, err := p.Add(ctx, m.Values)
+//			return err
+//		})).
+//		Run(ctx)
+//
+// An entry is acknowledged, and so leaves the group's pending entries list,
+// once it has been processed. One that fails stays pending: the consumer
+// reads it again when it restarts, and, with WithReclaim, any consumer of the
+// group claims it once it has been idle long enough, so entries of a
+// consumer that died aren't lost. A pipeline that carries on past failures,
+// e.g. with a DeadLetter handler, should Ack the entries it gives up on or
+// they are redelivered forever.
+//
+// Membership registers the instances of a pipeline for
+// pipeline.ShardedSource to share shards out between them, and Leader
+// elects one of them to run a pipeline.LeaderSource. Checkpointer keeps the
+// checkpoints of a pipeline in a list.
+//
+// Consumer groups need Redis 5 and WithReclaim needs Redis 6.2.
+package pipelineredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Option configures a Consumer.
+type Option func(*config)
+
+type config struct {
+	count     int64
+	block     time.Duration
+	reclaim   time.Duration
+	startFrom string
+}
+
+// WithBatchSize sets how many entries are read from Redis at a time, 100 by
+// default.
+func WithBatchSize(n int64) Option {
+	return func(cfg *config) {
+		if n >= 1 {
+			cfg.count = n
+		}
+	}
+}
+
+// WithBlock sets how long a read waits for new entries before trying again,
+// 5s by default. It bounds how long the source takes to notice its context
+// is done and how often pending entries are checked for reclaiming.
+func WithBlock(d time.Duration) Option {
+	return func(cfg *config) {
+		if d > 0 {
+			cfg.block = d
+		}
+	}
+}
+
+// WithReclaim claims the entries of the group that have been pending for
+// longer than minIdle, delivered to a consumer that never acknowledged them,
+// and emits them again. It should be well above the longest an entry takes
+// to process, or entries still being worked on are delivered twice. By
+// default a consumer only picks up the entries left pending to its own name.
+func WithReclaim(minIdle time.Duration) Option {
+	return func(cfg *config) {
+		cfg.reclaim = minIdle
+	}
+}
+
+// WithStartFrom sets the ID the group starts reading from if the Consumer
+// creates it, "0" for the whole stream by default or "$" for the entries
+// added from then on. A group that exists keeps its position.
+func WithStartFrom(id string) Option {
+	return func(cfg *config) {
+		cfg.startFrom = id
+	}
+}
+
+// Consumer reads a stream as a member of a consumer group and acknowledges
+// its entries as they are processed.
+type Consumer struct {
+	client redis.UniversalClient
+	stream string
+	group  string
+	name   string
+	cfg    config
+}
+
+// NewConsumer returns a Consumer reading stream as the consumer name of
+// group. The name must be unique within the group and stay the same across
+// restarts, e.g. a hostname, so the entries left pending to it are picked up
+// again. The group is created, along with the stream, if it doesn't exist.
+func NewConsumer(client redis.UniversalClient, stream, group, name string, opts ...Option) *Consumer {
+	cfg := config{count: 100, block: 5 * time.Second, startFrom: "0"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Consumer{client: client, stream: stream, group: group, name: name, cfg: cfg}
+}
+
+// Check pings Redis, to see it is reachable with the client's credentials
+// before reading the stream, see pipeline.Pipeline.Check.
+func (c *Consumer) Check(ctx context.Context) error {
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("pipelineredis: %w", err)
+	}
+	return nil
+}
+
+// Source returns a pipeline.Source emitting the entries still pending to the
+// consumer, then new ones as they are added, along with the ones reclaimed,
+// see WithReclaim. A failure to read stops the source, see
+// pipeline.GeneratorSource.
+func (c *Consumer) Source() pipeline.Source[redis.XMessage] {
+	source := pipeline.GeneratorSource(c.read)
+
+	return func(ctx context.Context) (<-chan redis.XMessage, error) {
+		if err := c.createGroup(ctx); err != nil {
+			return nil, err
+		}
+
+		return source(ctx)
+	}
+}
+
+// Sink returns a pipeline sink that runs handler on every entry and Acks it
+// once handler succeeds. An entry handler fails on is left pending and its
+// error returned.
+func (c *Consumer) Sink(handler func(redis.XMessage) error) func(redis.XMessage) error {
+	return func(m redis.XMessage) error {
+		if err := handler(m); err != nil {
+			return err
+		}
+
+		return c.Ack(context.Background(), m)
+	}
+}
+
+// Ack marks m as processed, removing it from the group's pending entries.
+func (c *Consumer) Ack(ctx context.Context, m redis.XMessage) error {
+	if err := c.client.XAck(ctx, c.stream, c.group, m.ID).Err(); err != nil {
+		return fmt.Errorf("pipelineredis: acknowledging %s: %w", m.ID, err)
+	}
+
+	return nil
+}
+
+func (c *Consumer) createGroup(ctx context.Context) error {
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, c.cfg.startFrom).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("pipelineredis: creating group %s: %w", c.group, err)
+	}
+
+	return nil
+}
+
+// read emits the consumer's own pending entries, then loops reading new
+// ones and, every so often, reclaiming idle ones.
+func (c *Consumer) read(ctx context.Context, emit func(redis.XMessage) error) error {
+	if err := c.readPending(ctx, emit); err != nil {
+		return err
+	}
+
+	clock := pipeline.ClockFrom(ctx)
+	var lastClaim time.Time
+	for {
+		if c.cfg.reclaim > 0 && clock.Now().Sub(lastClaim) >= c.cfg.reclaim/2 {
+			if err := c.reclaim(ctx, emit); err != nil {
+				return err
+			}
+			lastClaim = clock.Now()
+		}
+
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.name,
+			Streams:  []string{c.stream, ">"},
+			Count:    c.cfg.count,
+			Block:    c.cfg.block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return c.readErr(ctx, err)
+		}
+
+		for _, s := range streams {
+			for _, m := range s.Messages {
+				if err := emit(m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// readPending emits the entries delivered to the consumer before it last
+// stopped that it never acknowledged.
+func (c *Consumer) readPending(ctx context.Context, emit func(redis.XMessage) error) error {
+	after := "0"
+	for {
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.name,
+			Streams:  []string{c.stream, after},
+			Count:    c.cfg.count,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return c.readErr(ctx, err)
+		}
+
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return nil
+		}
+		for _, m := range streams[0].Messages {
+			after = m.ID
+			if err := c.emitLive(ctx, m, emit); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reclaim claims and emits the group's entries that have been pending for
+// longer than the reclaim interval.
+func (c *Consumer) reclaim(ctx context.Context, emit func(redis.XMessage) error) error {
+	start := "0-0"
+	for {
+		messages, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: c.name,
+			MinIdle:  c.cfg.reclaim,
+			Start:    start,
+			Count:    c.cfg.count,
+		}).Result()
+		if err != nil {
+			return c.readErr(ctx, err)
+		}
+
+		for _, m := range messages {
+			if err := c.emitLive(ctx, m, emit); err != nil {
+				return err
+			}
+		}
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// emitLive emits m unless it was deleted from the stream while pending, in
+// which case there is nothing to process and it is acknowledged instead.
+func (c *Consumer) emitLive(ctx context.Context, m redis.XMessage, emit func(redis.XMessage) error) error {
+	if m.Values == nil {
+		return c.Ack(ctx, m)
+	}
+
+	return emit(m)
+}
+
+func (c *Consumer) readErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return fmt.Errorf("pipelineredis: reading %s: %w", c.stream, err)
+}
+
+// Producer adds pipeline results to a stream.
+type Producer struct {
+	client redis.UniversalClient
+	stream string
+	maxLen int64
+}
+
+// NewProducer returns a Producer adding to stream, which is created if it
+// doesn't exist. If maxLen is above 0 the stream is trimmed to about that
+// many entries as they are added, so it doesn't grow without bound.
+func NewProducer(client redis.UniversalClient, stream string, maxLen int64) *Producer {
+	return &Producer{client: client, stream: stream, maxLen: maxLen}
+}
+
+// Sink returns a pipeline sink adding every value to the stream as an entry
+// with its fields, see Add. Entries are added with ctx.
+func (p *Producer) Sink(ctx context.Context) func(map[string]any) error {
+	return func(values map[string]any) error {
+		_, err := p.Add(ctx, values)
+		return err
+	}
+}
+
+// Add adds an entry with the fields in values to the stream and returns its
+// ID.
+func (p *Producer) Add(ctx context.Context, values map[string]any) (string, error) {
+	id, err := p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: p.maxLen > 0,
+		Values: values,
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("pipelineredis: adding to %s: %w", p.stream, err)
+	}
+
+	return id, nil
+}
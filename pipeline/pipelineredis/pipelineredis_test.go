@@ -0,0 +1,31 @@
+package pipelineredis_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelineredis"
+)
+
+func TestConsumerCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		down    bool
+		wantErr bool
+	}{
+		{name: "reachable"},
+		{name: "down", down: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeRedis(t)
+			fake.setDown(tt.down)
+			c := pipelineredis.NewConsumer(client, "orders", "enricher", "host-1")
+
+			if err := c.Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Check = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
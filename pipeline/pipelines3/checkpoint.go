@@ -0,0 +1,113 @@
+package pipelines3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// CheckpointClient is the part of *s3.Client a Checkpointer uses.
+type CheckpointClient interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Checkpointer keeps the offsets of pipeline.Pipeline.Checkpoint in an S3
+// object, the last saved first, one per line, so pipelines running on
+// machines without a disk of their own can resume, and be rewound to an
+// offset kept before the last, see pipeline.CheckpointHistory. Every Save
+// replaces the whole object, which S3 does atomically.
+type Checkpointer struct {
+	client CheckpointClient
+	bucket string
+	key    string
+	keep   int
+}
+
+var (
+	_ pipeline.Checkpointer      = (*Checkpointer)(nil)
+	_ pipeline.CheckpointHistory = (*Checkpointer)(nil)
+)
+
+// NewCheckpointer returns a Checkpointer keeping the last keep offsets, at
+// least one, in the object at key of bucket.
+func NewCheckpointer(client CheckpointClient, bucket, key string, keep int) *Checkpointer {
+	return &Checkpointer{client: client, bucket: bucket, key: key, keep: max(keep, 1)}
+}
+
+// Load returns the last offset saved, 0 if there is none.
+func (c *Checkpointer) Load(ctx context.Context) (int64, error) {
+	offsets, err := c.Checkpoints(ctx)
+	if err != nil || len(offsets) == 0 {
+		return 0, err
+	}
+
+	return offsets[0], nil
+}
+
+// Checkpoints returns the offsets kept, the last saved first, none if the
+// object doesn't exist yet.
+func (c *Checkpointer) Checkpoints(ctx context.Context) ([]int64, error) {
+	out, err := c.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(c.key)})
+	var missing *types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pipelines3: loading checkpoint %s: %w", c.key, err)
+	}
+	defer out.Body.Close()
+
+	b, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("pipelines3: loading checkpoint %s: %w", c.key, err)
+	}
+
+	var offsets []int64
+	for _, line := range strings.Fields(string(b)) {
+		offset, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pipelines3: invalid checkpoint in %s: %w", c.key, err)
+		}
+		offsets = append(offsets, offset)
+	}
+
+	return offsets, nil
+}
+
+// Save writes offset to the object, ahead of the ones kept before it.
+func (c *Checkpointer) Save(ctx context.Context, offset int64) error {
+	offsets := []int64{offset}
+	if c.keep > 1 {
+		previous, err := c.Checkpoints(ctx)
+		if err != nil {
+			return err
+		}
+		offsets = append(offsets, previous[:min(len(previous), c.keep-1)]...)
+	}
+
+	var b strings.Builder
+	for _, offset := range offsets {
+		b.WriteString(strconv.FormatInt(offset, 10) + "\n")
+	}
+
+	_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.key),
+		Body:   strings.NewReader(b.String()),
+	})
+	if err != nil {
+		return fmt.Errorf("pipelines3: saving checkpoint %s: %w", c.key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package pipelines3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelines3"
+)
+
+// objects is an in-memory bucket.
+type objects struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	err  error
+}
+
+func (o *objects) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return nil, o.err
+	}
+	data, ok := o.data[*params.Bucket+"/"+*params.Key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (o *objects) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return nil, o.err
+	}
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	o.data[*params.Bucket+"/"+*params.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestCheckpointer(t *testing.T) {
+	tests := []struct {
+		name string
+		keep int
+		want []int64
+	}{
+		{name: "last", keep: 1, want: []int64{3}},
+		{name: "below one", keep: -1, want: []int64{3}},
+		{name: "keep", keep: 2, want: []int64{3, 2}},
+		{name: "keep more than saved", keep: 5, want: []int64{3, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bucket := &objects{data: make(map[string][]byte)}
+			cp := pipelines3.NewCheckpointer(bucket, "state", "orders/offset", tt.keep)
+
+			if offset, err := cp.Load(ctx); offset != 0 || err != nil {
+				t.Fatalf("Load before any Save = %d, %v, want 0, nil", offset, err)
+			}
+			for offset := int64(1); offset <= 3; offset++ {
+				if err := cp.Save(ctx, offset); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if offset, err := cp.Load(ctx); offset != 3 || err != nil {
+				t.Errorf("Load = %d, %v, want 3, nil", offset, err)
+			}
+			got, err := cp.Checkpoints(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Checkpoints = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointerErrors(t *testing.T) {
+	ctx := context.Background()
+	errDenied := errors.New("access denied")
+
+	bucket := &objects{data: map[string][]byte{"state/orders/offset": []byte("12\nnope\n")}}
+	cp := pipelines3.NewCheckpointer(bucket, "state", "orders/offset", 2)
+	if _, err := cp.Load(ctx); err == nil {
+		t.Error("Load of a corrupt checkpoint succeeded")
+	}
+
+	bucket.err = errDenied
+	if _, err := cp.Load(ctx); !errors.Is(err, errDenied) {
+		t.Errorf("Load error = %v, want %v", err, errDenied)
+	}
+	if err := cp.Save(ctx, 1); !errors.Is(err, errDenied) {
+		t.Errorf("Save error = %v, want %v", err, errDenied)
+	}
+}
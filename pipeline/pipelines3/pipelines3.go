@@ -0,0 +1,285 @@
+// Package pipelines3 feeds a pipeline from the objects under a prefix of an
+// S3 bucket, or any storage speaking the S3 API, for bulk reprocessing of
+// bucket data:
+//
+//	b := pipelines3.NewBucket(s3.NewFromConfig(cfg), "events", "2024/06/",
+//		pipelines3.WithConcurrency(8),
+//	)
+//
+//	err := pipeline.New(b.Contents()).Then(decode).Sink(store).Run(ctx)
+//	err = errors.Join(err, b.Err())
+//
+// Keys emits the objects listed, Contents streams what they hold in chunks.
+// Listing pages through the results, so prefixes holding millions of objects
+// are never held in memory at once.
+//
+// Checkpointer keeps the checkpoints of a pipeline in an object.
+package pipelines3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Client is the part of *s3.Client a Bucket uses.
+type Client interface {
+	s3.ListObjectsV2APIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Object is an object listed under the prefix.
+type Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// Chunk is a piece of an object's contents, starting Offset bytes into it.
+// Last is set on the final chunk of every object, including the single empty
+// chunk of an empty one.
+type Chunk struct {
+	Key    string
+	Offset int64
+	Data   []byte
+	Last   bool
+}
+
+// Option configures a Bucket.
+type Option func(*config)
+
+type config struct {
+	pageSize    int32
+	concurrency int
+	chunkSize   int
+}
+
+// WithPageSize sets how many objects are asked for per listing request. By
+// default the storage decides, S3 returns up to 1000.
+func WithPageSize(n int32) Option {
+	return func(cfg *config) {
+		if n >= 1 {
+			cfg.pageSize = n
+		}
+	}
+}
+
+// WithConcurrency sets how many objects Contents reads at a time, 1 by
+// default. Chunks of different objects interleave when it is above 1, those
+// of a single object are still emitted in order.
+func WithConcurrency(n int) Option {
+	return func(cfg *config) {
+		if n >= 1 {
+			cfg.concurrency = n
+		}
+	}
+}
+
+// WithChunkSize sets the size of the chunks Contents emits, 1MiB by default.
+func WithChunkSize(n int) Option {
+	return func(cfg *config) {
+		if n >= 1 {
+			cfg.chunkSize = n
+		}
+	}
+}
+
+// Bucket reads the objects under a prefix of a bucket.
+type Bucket struct {
+	client Client
+	bucket string
+	prefix string
+	cfg    config
+
+	mu  sync.Mutex
+	err error
+}
+
+// Check lists a single object under the prefix, to see the bucket is
+// reachable and readable with the client's credentials before reading it,
+// see pipeline.Pipeline.Check.
+func (b *Bucket) Check(ctx context.Context) error {
+	_, err := b.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(b.bucket),
+		Prefix:  aws.String(b.prefix),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return fmt.Errorf("pipelines3: listing %s/%s: %w", b.bucket, b.prefix, err)
+	}
+	return nil
+}
+
+// NewBucket returns a Bucket reading the objects whose key starts with prefix.
+func NewBucket(client Client, bucket, prefix string, opts ...Option) *Bucket {
+	cfg := config{concurrency: 1, chunkSize: 1 << 20}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Bucket{client: client, bucket: bucket, prefix: prefix, cfg: cfg}
+}
+
+// Keys returns a pipeline.Source emitting the objects under the prefix, in
+// the order the storage lists them. It stops once ctx is done or listing
+// fails, see Err.
+func (b *Bucket) Keys() pipeline.Source[Object] {
+	return func(ctx context.Context) (<-chan Object, error) {
+		outChannel := make(chan Object)
+
+		go func() {
+			defer close(outChannel)
+
+			b.setErr(ctx, b.list(ctx, outChannel))
+		}()
+
+		return outChannel, nil
+	}
+}
+
+// Contents returns a pipeline.Source emitting the contents of the objects
+// under the prefix as chunks, see WithChunkSize and WithConcurrency. It stops
+// once ctx is done or listing or reading an object fails, see Err.
+func (b *Bucket) Contents() pipeline.Source[Chunk] {
+	return func(ctx context.Context) (<-chan Chunk, error) {
+		outChannel := make(chan Chunk)
+
+		go func() {
+			defer close(outChannel)
+
+			g, gctx := errgroup.WithContext(ctx)
+			objects := make(chan Object)
+			g.Go(func() error {
+				defer close(objects)
+				return b.list(gctx, objects)
+			})
+			for range b.cfg.concurrency {
+				g.Go(func() error {
+					for obj := range objects {
+						if err := b.stream(gctx, obj.Key, outChannel); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			}
+
+			b.setErr(ctx, g.Wait())
+		}()
+
+		return outChannel, nil
+	}
+}
+
+// Err returns the error that stopped a source, if any.
+func (b *Bucket) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.err
+}
+
+// setErr keeps err unless it only reports that ctx is done.
+func (b *Bucket) setErr(ctx context.Context, err error) {
+	if err == nil || ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *Bucket) list(ctx context.Context, out chan<- Object) error {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(b.bucket), Prefix: aws.String(b.prefix)}
+	if b.cfg.pageSize > 0 {
+		input.MaxKeys = aws.Int32(b.cfg.pageSize)
+	}
+
+	pages := s3.NewListObjectsV2Paginator(b.client, input)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("pipelines3: listing %s/%s: %w", b.bucket, b.prefix, err)
+		}
+
+		for _, o := range page.Contents {
+			obj := Object{
+				Key:          aws.ToString(o.Key),
+				Size:         aws.ToInt64(o.Size),
+				ETag:         aws.ToString(o.ETag),
+				LastModified: aws.ToTime(o.LastModified),
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case out <- obj:
+			}
+		}
+	}
+
+	return nil
+}
+
+// stream emits the contents of the object at key. It reads a chunk ahead so
+// the final one can be marked Last.
+func (b *Bucket) stream(ctx context.Context, key string, out chan<- Chunk) error {
+	resp, err := b.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(b.bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("pipelines3: getting %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	var offset int64
+	data, err := readChunk(resp.Body, b.cfg.chunkSize)
+	if err != nil {
+		return fmt.Errorf("pipelines3: reading %s: %w", key, err)
+	}
+	for {
+		// a short chunk is the last one, only a full one needs a look ahead
+		var next []byte
+		if len(data) == b.cfg.chunkSize {
+			if next, err = readChunk(resp.Body, b.cfg.chunkSize); err != nil {
+				return fmt.Errorf("pipelines3: reading %s: %w", key, err)
+			}
+		}
+
+		chunk := Chunk{Key: key, Offset: offset, Data: data, Last: len(next) == 0}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- chunk:
+		}
+		if chunk.Last {
+			return nil
+		}
+
+		offset += int64(len(data))
+		data = next
+	}
+}
+
+// readChunk reads up to size bytes, fewer only at the end of r.
+func readChunk(r io.Reader, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+
+	return buf[:n], err
+}
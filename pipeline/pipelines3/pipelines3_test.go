@@ -0,0 +1,74 @@
+package pipelines3_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelines3"
+)
+
+// ListObjectsV2 lists the keys of the bucket under the prefix in order, at
+// most MaxKeys at a time, 2 unless set, so listing pages.
+func (o *objects) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return nil, o.err
+	}
+
+	var keys []string
+	for k := range o.data {
+		bucket, key, _ := strings.Cut(k, "/")
+		if bucket == aws.ToString(params.Bucket) && strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	start, _ := strconv.Atoi(aws.ToString(params.ContinuationToken))
+	end := min(start+int(aws.ToInt32(params.MaxKeys)), len(keys))
+	if params.MaxKeys == nil {
+		end = min(start+2, len(keys))
+	}
+	out := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(keys))}
+	if end < len(keys) {
+		out.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	for _, key := range keys[start:end] {
+		data := o.data[aws.ToString(params.Bucket)+"/"+key]
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(key), Size: aws.Int64(int64(len(data)))})
+	}
+	return out, nil
+}
+
+func TestBucketCheck(t *testing.T) {
+	denied := errors.New("AccessDenied")
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "readable"},
+		{name: "denied", err: denied, wantErr: denied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &objects{data: map[string][]byte{"events/2024/a": []byte("a")}, err: tt.err}
+			b := pipelines3.NewBucket(client, "events", "2024/")
+
+			if err := b.Check(context.Background()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
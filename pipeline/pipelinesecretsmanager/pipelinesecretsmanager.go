@@ -0,0 +1,82 @@
+// Package pipelinesecretsmanager resolves the secrets of pipeline connectors
+// from AWS Secrets Manager:
+//
+//	secrets := pipelinesecretsmanager.New(secretsmanager.NewFromConfig(cfg))
+//	password := pipeline.NewSecret(secrets, "prod/orders-db#password", 5*time.Minute)
+//
+// A secret is named by its name or ARN in Secrets Manager. The string of
+// its current version is returned, or given a # and a key after the name,
+// the value of that key of the JSON object the string holds, as the
+// console stores key/value secrets. Every resolution reads the current
+// version, so secrets Secrets Manager rotates are picked up once a
+// pipeline.Secret's ttl is up.
+package pipelinesecretsmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Client is the part of *secretsmanager.Client a Provider uses.
+type Client interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// Provider is a pipeline.SecretsProvider reading secrets from Secrets
+// Manager.
+type Provider struct {
+	client Client
+}
+
+var _ pipeline.SecretsProvider = (*Provider)(nil)
+
+// New returns a Provider reading secrets with client.
+func New(client Client) *Provider {
+	return &Provider{client: client}
+}
+
+// Secret implements pipeline.SecretsProvider.
+func (p *Provider) Secret(ctx context.Context, name string) (string, error) {
+	id, key, hasKey := strings.Cut(name, "#")
+
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", fmt.Errorf("%w: %s", pipeline.ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("pipelinesecretsmanager: %w", err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("pipelinesecretsmanager: %s is a binary secret", id)
+	}
+	if !hasKey {
+		return *out.SecretString, nil
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal([]byte(*out.SecretString), &values); err != nil {
+		return "", fmt.Errorf("pipelinesecretsmanager: %s isn't a JSON object: %w", id, err)
+	}
+	v, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", pipeline.ErrSecretNotFound, name)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("pipelinesecretsmanager: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,73 @@
+package pipelinesecretsmanager_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinesecretsmanager"
+)
+
+// fakeClient holds secrets by id, nil for binary ones.
+type fakeClient map[string]*string
+
+func (c fakeClient) GetSecretValue(_ context.Context, in *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	id := aws.ToString(in.SecretId)
+	if id == "denied" {
+		return nil, errors.New("AccessDeniedException")
+	}
+	s, ok := c[id]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("not found")}
+	}
+	return &secretsmanager.GetSecretValueOutput{Name: in.SecretId, SecretString: s}, nil
+}
+
+func TestSecret(t *testing.T) {
+	p := pipelinesecretsmanager.New(fakeClient{
+		"api-key":  aws.String("abc123"),
+		"orders":   aws.String(`{"username":"orders","password":"hunter2","port":5432}`),
+		"binary":   nil,
+		"not-json": aws.String("plain"),
+	})
+
+	tests := []struct {
+		name     string
+		secret   string
+		want     string
+		notFound bool
+		wantErr  bool
+	}{
+		{name: "string", secret: "api-key", want: "abc123"},
+		{name: "key", secret: "orders#password", want: "hunter2"},
+		{name: "not a string", secret: "orders#port", want: "5432"},
+		{name: "missing key", secret: "orders#host", notFound: true},
+		{name: "missing secret", secret: "billing", notFound: true},
+		{name: "binary", secret: "binary", wantErr: true},
+		{name: "key of a plain string", secret: "not-json#password", wantErr: true},
+		{name: "denied", secret: "denied", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Secret(context.Background(), tt.secret)
+			switch {
+			case tt.notFound:
+				if !errors.Is(err, pipeline.ErrSecretNotFound) {
+					t.Errorf("Secret = %q, %v, want ErrSecretNotFound", got, err)
+				}
+			case tt.wantErr:
+				if err == nil || errors.Is(err, pipeline.ErrSecretNotFound) {
+					t.Errorf("Secret = %q, %v, want an error", got, err)
+				}
+			case got != tt.want || err != nil:
+				t.Errorf("Secret = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Package pipelinesql lands pipeline results in a database/sql database,
+// batching them and writing each batch in its own transaction:
+//
+//	w := pipelinesql.NewWriter(db, insertOrders,
+//		pipelinesql.WithBatchSize(500),
+//		pipelinesql.WithFlushInterval(time.Second),
+//		pipelinesql.WithRetry(3, pipeline.ExponentialBackoff(100*time.Millisecond, 5*time.Second)),
+//	)
+//
+//	err := pipeline.New(source).Then(transform).Sink(w.Sink(ctx)).Run(ctx)
+//	err = errors.Join(err, w.Close(ctx))
+//
+// where insertOrders writes a batch inside the transaction it is given:
+//
+//	func insertOrders(ctx context.Context, tx *sql.Tx, batch []Order) error {
+//		stmt, err := tx.PrepareContext(ctx, "INSERT INTO orders (id, total) VALUES ($1, $2)")
+//		if err != nil {
+//			return err
+//		}
+//		defer stmt.Close()
+//		for _, o := range batch {
+//			if _, err := stmt.ExecContext(ctx, o.ID, o.Total); err != nil {
+//				return err
+//			}
+//		}
+//		return nil
+//	}
+package pipelinesql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Option configures a Writer.
+type Option func(*config)
+
+type config struct {
+	batchSize     int
+	flushInterval time.Duration
+	maxAttempts   int
+	backoff       pipeline.BackoffStrategy
+	txOptions     *sql.TxOptions
+}
+
+// WithBatchSize sets how many values are written per transaction, 100 by
+// default.
+func WithBatchSize(n int) Option {
+	return func(cfg *config) {
+		if n >= 1 {
+			cfg.batchSize = n
+		}
+	}
+}
+
+// WithFlushInterval also writes a partial batch once d has passed since its
+// first value arrived, so a slow trickle of values still lands promptly. By
+// default partial batches wait until they fill up or the Writer is closed.
+func WithFlushInterval(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.flushInterval = d
+	}
+}
+
+// WithRetry retries a batch whose transaction fails up to maxAttempts times
+// in total, waiting between attempts as told by backoff. Every attempt runs
+// in a fresh transaction. Errors marked with pipeline.Permanent are not
+// retried.
+func WithRetry(maxAttempts int, backoff pipeline.BackoffStrategy) Option {
+	return func(cfg *config) {
+		cfg.maxAttempts = max(maxAttempts, 1)
+		cfg.backoff = backoff
+	}
+}
+
+// WithTxOptions sets the options the transactions are started with.
+func WithTxOptions(opts *sql.TxOptions) Option {
+	return func(cfg *config) {
+		cfg.txOptions = opts
+	}
+}
+
+// Writer buffers values and writes them to the database in batches. It is
+// safe for concurrent use.
+type Writer[T any] struct {
+	db    *sql.DB
+	write func(ctx context.Context, tx *sql.Tx, batch []T) error
+	cfg   config
+
+	mu    sync.Mutex
+	batch []T
+	// stopTimer stops the interval timer of the batch, nil if there is none
+	stopTimer func()
+	// err is the failure of a batch flushed by the interval timer, reported
+	// by the next call
+	err error
+}
+
+// NewWriter returns a Writer handing every batch to write, inside a
+// transaction that is committed if write succeeds and rolled back if not.
+func NewWriter[T any](db *sql.DB, write func(ctx context.Context, tx *sql.Tx, batch []T) error, opts ...Option) *Writer[T] {
+	cfg := config{batchSize: 100, maxAttempts: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Writer[T]{db: db, write: write, cfg: cfg}
+}
+
+// Check pings the database, to see it is reachable with the credentials of
+// the DB before writing to it, see pipeline.Pipeline.Check.
+func (w *Writer[T]) Check(ctx context.Context) error {
+	if err := w.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("pipelinesql: %w", err)
+	}
+	return nil
+}
+
+// Sink returns a pipeline sink adding every value to the Writer, see Add.
+// Batches are written with ctx.
+func (w *Writer[T]) Sink(ctx context.Context) func(T) error {
+	return func(v T) error {
+		return w.Add(ctx, v)
+	}
+}
+
+// Add buffers v, writing the batch if it is full. It returns the error of
+// that write, or of an earlier batch flushed by the interval timer.
+func (w *Writer[T]) Add(ctx context.Context, v T) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.takeErr(); err != nil {
+		return err
+	}
+
+	w.batch = append(w.batch, v)
+	if len(w.batch) >= w.cfg.batchSize {
+		return w.flush(ctx)
+	}
+	if len(w.batch) == 1 && w.cfg.flushInterval > 0 {
+		w.startTimer(ctx)
+	}
+
+	return nil
+}
+
+// Flush writes the buffered values, if any, also returning the error of an
+// earlier batch flushed by the interval timer.
+func (w *Writer[T]) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return errors.Join(w.takeErr(), w.flush(ctx))
+}
+
+// Close writes the buffered values. Call it once the pipeline has finished so
+// the last partial batch isn't lost.
+func (w *Writer[T]) Close(ctx context.Context) error {
+	return w.Flush(ctx)
+}
+
+func (w *Writer[T]) takeErr() error {
+	err := w.err
+	w.err = nil
+	return err
+}
+
+// startTimer flushes the batch once the flush interval of ctx's clock has
+// passed, unless it is flushed before. It must be called with mu held.
+func (w *Writer[T]) startTimer(ctx context.Context) {
+	timer := pipeline.ClockFrom(ctx).NewTimer(w.cfg.flushInterval)
+	stopped := make(chan struct{})
+	w.stopTimer = func() {
+		timer.Stop()
+		close(stopped)
+	}
+
+	go func() {
+		select {
+		case <-stopped:
+			return
+		case <-timer.C():
+		}
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		select {
+		case <-stopped:
+			// flushed while waiting for mu
+			return
+		default:
+		}
+		if err := w.flush(context.WithoutCancel(ctx)); err != nil && w.err == nil {
+			w.err = err
+		}
+	}()
+}
+
+// flush must be called with mu held. A batch that can't be written is
+// dropped, its error says how many values it held.
+func (w *Writer[T]) flush(ctx context.Context) error {
+	if w.stopTimer != nil {
+		w.stopTimer()
+		w.stopTimer = nil
+	}
+	if len(w.batch) == 0 {
+		return nil
+	}
+
+	batch := w.batch
+	w.batch = nil
+
+	attempt := 1
+	for {
+		err := w.writeBatch(ctx, batch)
+		if err == nil {
+			return nil
+		}
+		if attempt >= w.cfg.maxAttempts || pipeline.IsPermanent(err) || ctx.Err() != nil {
+			return fmt.Errorf("pipelinesql: writing batch of %d: %w", len(batch), err)
+		}
+
+		if w.cfg.backoff != nil {
+			timer := pipeline.ClockFrom(ctx).NewTimer(w.cfg.backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("pipelinesql: writing batch of %d: %w", len(batch), err)
+			case <-timer.C():
+			}
+		}
+		attempt++
+	}
+}
+
+func (w *Writer[T]) writeBatch(ctx context.Context, batch []T) error {
+	tx, err := w.db.BeginTx(ctx, w.cfg.txOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := w.write(ctx, tx, batch); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
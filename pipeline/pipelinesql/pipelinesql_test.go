@@ -0,0 +1,189 @@
+package pipelinesql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinesql"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// fakeDriver opens connections whose transactions commit and roll back
+// without doing anything, counting the commits.
+type fakeDriver struct {
+	mu      sync.Mutex
+	commits int
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)         { return fakeTx(c), nil }
+
+type fakeTx struct{ d *fakeDriver }
+
+func (tx fakeTx) Commit() error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	tx.d.commits++
+	return nil
+}
+
+func (fakeTx) Rollback() error { return nil }
+
+// newDB returns a DB on a fakeDriver, closed once the test ends.
+func newDB(t *testing.T) (*sql.DB, *fakeDriver) {
+	d := &fakeDriver{}
+	db := sql.OpenDB(connector{d})
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+type connector struct{ d *fakeDriver }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.d }
+
+var errWrite = errors.New("write failed")
+
+// batches records the batches written, failing the first fail attempts.
+type batches struct {
+	fail    int
+	written chan []int
+}
+
+func (b *batches) write(_ context.Context, _ *sql.Tx, batch []int) error {
+	if b.fail > 0 {
+		b.fail--
+		return errWrite
+	}
+	b.written <- slices.Clone(batch)
+	return nil
+}
+
+func TestWriterBatches(t *testing.T) {
+	db, d := newDB(t)
+	b := &batches{written: make(chan []int, 10)}
+	w := pipelinesql.NewWriter(db, b.write, pipelinesql.WithBatchSize(2))
+
+	err := pipeline.New(func(ctx context.Context) (<-chan int, error) {
+		return pipeline.FromSlice(ctx, []int{1, 2, 3, 4, 5}), nil
+	}).Sink(w.Sink(context.Background())).Run(context.Background())
+	if err := errors.Join(err, w.Close(context.Background())); err != nil {
+		t.Fatal(err)
+	}
+
+	close(b.written)
+	var got [][]int
+	for batch := range b.written {
+		got = append(got, batch)
+	}
+	if want := [][]int{{1, 2}, {3, 4}, {5}}; !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("wrote %v, want %v", got, want)
+	}
+	if d.commits != 3 {
+		t.Errorf("committed %d transactions, want 3", d.commits)
+	}
+}
+
+func TestWriterFakeClock(t *testing.T) {
+	tests := []struct {
+		name string
+		fail int
+		opts []pipelinesql.Option
+		// wait is how long the clock is advanced by for the batch to land
+		wait time.Duration
+	}{
+		{
+			name: "flush interval",
+			opts: []pipelinesql.Option{pipelinesql.WithFlushInterval(time.Minute)},
+			wait: time.Minute,
+		},
+		{
+			name: "retry backoff",
+			fail: 1,
+			opts: []pipelinesql.Option{pipelinesql.WithRetry(2, pipeline.ConstantBackoff(time.Hour))},
+			wait: time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			clock := pipelinetest.NewFakeClock(time.Time{})
+			ctx := pipeline.WithClock(context.Background(), clock)
+			db, _ := newDB(t)
+			b := &batches{fail: tt.fail, written: make(chan []int, 1)}
+			w := pipelinesql.NewWriter(db, b.write, append(tt.opts, pipelinesql.WithBatchSize(10))...)
+
+			if err := w.Add(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			flushed := make(chan error, 1)
+			if tt.fail > 0 {
+				// the retry waits inside Flush
+				go func() { flushed <- w.Flush(ctx) }()
+			} else {
+				flushed <- nil
+			}
+
+			clock.WaitForTimers(1)
+			clock.Advance(tt.wait - time.Nanosecond)
+			select {
+			case batch := <-b.written:
+				t.Fatalf("wrote %v before %v passed", batch, tt.wait)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			clock.Advance(time.Nanosecond)
+			if got := pipelinetest.Receive(t, b.written); !slices.Equal(got, []int{1}) {
+				t.Errorf("wrote %v, want [1]", got)
+			}
+			if err := <-flushed; err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestWriterFlushedFirst(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	clock := pipelinetest.NewFakeClock(time.Time{})
+	ctx := pipeline.WithClock(context.Background(), clock)
+	db, _ := newDB(t)
+	b := &batches{written: make(chan []int, 2)}
+	w := pipelinesql.NewWriter(db, b.write, pipelinesql.WithBatchSize(10), pipelinesql.WithFlushInterval(time.Minute))
+
+	if err := w.Add(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	clock.WaitForTimers(1)
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the interval of a batch flushed before it is up flushes nothing more
+	clock.Advance(time.Minute)
+	if got := pipelinetest.Receive(t, b.written); !slices.Equal(got, []int{1}) {
+		t.Errorf("wrote %v, want [1]", got)
+	}
+	select {
+	case batch := <-b.written:
+		t.Errorf("wrote %v again once the interval was up", batch)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
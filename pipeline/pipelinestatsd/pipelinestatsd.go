@@ -0,0 +1,220 @@
+// Package pipelinestatsd pushes per-stage pipeline metrics to a StatsD
+// server, for batch pipelines that finish before anything could scrape
+// them.
+//
+//	metrics, err := pipelinestatsd.Dial("localhost:8125", "myapp", 10*time.Second)
+//	if err != nil {
+//		return err
+//	}
+//	defer metrics.Close()
+//
+//	out, errs := pipeline.Step(ctx, in, fn,
+//		pipeline.WithName("enrich"),
+//		pipeline.WithMetrics(metrics),
+//	)
+//
+// Metrics are named prefix.pipeline.<stage>.<metric>, with any characters
+// StatsD gives a meaning to in the stage name replaced by underscores.
+package pipelinestatsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// maxPacket is how large a datagram Flush sends at most, small enough not
+// to be fragmented on an ethernet link.
+const maxPacket = 1432
+
+// Metrics implements pipeline.StageMetrics by counting in memory and sending
+// what it has counted to StatsD with every Flush: counters of the values
+// read, produced, failed and retried, gauges of the values in flight and
+// queued, and the latency of every value as a timer.
+type Metrics struct {
+	conn   net.Conn
+	prefix string
+
+	mu     sync.Mutex
+	stages map[string]*stage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// stage is what has been counted for a stage since the last Flush.
+type stage struct {
+	itemsIn, itemsOut, errors, retries int64
+	inFlight, queueDepth               int64
+	latencies                          []time.Duration
+}
+
+var _ pipeline.StageMetrics = (*Metrics)(nil)
+
+// Dial returns Metrics sending to the StatsD server at addr over UDP, every
+// interval and once more on Close. With an interval of 0 they are only sent
+// by Flush and Close.
+func Dial(addr, prefix string, interval time.Duration) (*Metrics, error) {
+	return DialContext(context.Background(), addr, prefix, interval)
+}
+
+// DialContext is Dial timing the interval with ctx's Clock, see
+// pipeline.ClockFrom. ctx is only used for dialing and the Clock, the
+// Metrics keep sending until Close.
+func DialContext(ctx context.Context, addr, prefix string, interval time.Duration) (*Metrics, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("pipelinestatsd: %w", err)
+	}
+
+	m := &Metrics{
+		conn:   conn,
+		prefix: prefix,
+		stages: make(map[string]*stage),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if interval <= 0 {
+		close(m.done)
+		return m, nil
+	}
+	go m.run(pipeline.ClockFrom(ctx).NewTicker(interval))
+
+	return m, nil
+}
+
+func (m *Metrics) run(ticker pipeline.Ticker) {
+	defer close(m.done)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C():
+			// a lost flush is made up for by the next one
+			_ = m.Flush()
+		}
+	}
+}
+
+// Close sends what has been counted since the last Flush and closes the
+// connection. The Metrics must not be used afterwards.
+func (m *Metrics) Close() error {
+	close(m.stop)
+	<-m.done
+
+	err := m.Flush()
+	if cerr := m.conn.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// Flush sends what has been counted since the last Flush, which counters and
+// timers then start over from.
+func (m *Metrics) Flush() error {
+	m.mu.Lock()
+	var lines []string
+	for name, s := range m.stages {
+		key := m.prefix + ".pipeline." + sanitize(name) + "."
+		counter := func(metric string, n int64) {
+			if n > 0 {
+				lines = append(lines, fmt.Sprintf("%s%s:%d|c", key, metric, n))
+			}
+		}
+		counter("items_in", s.itemsIn)
+		counter("items_out", s.itemsOut)
+		counter("errors", s.errors)
+		counter("retries", s.retries)
+		lines = append(lines,
+			fmt.Sprintf("%sin_flight:%d|g", key, s.inFlight),
+			fmt.Sprintf("%squeue_depth:%d|g", key, s.queueDepth),
+		)
+		for _, d := range s.latencies {
+			lines = append(lines, fmt.Sprintf("%sitem_duration:%g|ms", key, float64(d)/float64(time.Millisecond)))
+		}
+
+		// gauges keep their value
+		*s = stage{inFlight: s.inFlight, queueDepth: s.queueDepth}
+	}
+	m.mu.Unlock()
+
+	var packet bytes.Buffer
+	send := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := m.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxPacket {
+			if err := send(); err != nil {
+				return fmt.Errorf("pipelinestatsd: %w", err)
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if err := send(); err != nil {
+		return fmt.Errorf("pipelinestatsd: %w", err)
+	}
+
+	return nil
+}
+
+// sanitize replaces the characters StatsD separates names, values and types
+// with in name.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', '\n', ' ', '/':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// update calls fn with the counts of stage under the lock.
+func (m *Metrics) update(name string, fn func(s *stage)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stages[name]
+	if !ok {
+		s = &stage{}
+		m.stages[name] = s
+	}
+	fn(s)
+}
+
+// The methods below implement pipeline.StageMetrics.
+
+func (m *Metrics) ItemIn(name string)    { m.update(name, func(s *stage) { s.itemsIn++ }) }
+func (m *Metrics) ItemOut(name string)   { m.update(name, func(s *stage) { s.itemsOut++ }) }
+func (m *Metrics) ItemError(name string) { m.update(name, func(s *stage) { s.errors++ }) }
+func (m *Metrics) Retry(name string)     { m.update(name, func(s *stage) { s.retries++ }) }
+
+func (m *Metrics) InFlight(name string, delta int) {
+	m.update(name, func(s *stage) { s.inFlight += int64(delta) })
+}
+
+func (m *Metrics) QueueDepth(name string, depth int) {
+	m.update(name, func(s *stage) { s.queueDepth = int64(depth) })
+}
+
+func (m *Metrics) Latency(name string, d time.Duration) {
+	m.update(name, func(s *stage) { s.latencies = append(s.latencies, d) })
+}
@@ -0,0 +1,161 @@
+package pipelinestatsd_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinestatsd"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// listen returns the address of a StatsD server and a func returning the
+// datagrams it has received once no more arrive.
+func listen(t *testing.T) (string, func() []string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.LocalAddr().String(), func() []string {
+		var packets []string
+		buf := make([]byte, 64*1024)
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return packets
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	addr, received := listen(t)
+	metrics, err := pipelinestatsd.Dial(addr, "app", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn := func(v int) (int, error) {
+		if v == 2 {
+			return 0, errors.New("bad")
+		}
+		return v, nil
+	}
+	pipelinetest.RunStage(t, fn, []int{1, 2, 3}, pipeline.WithName("parse.v1"), pipeline.WithMetrics(metrics))
+	if err := metrics.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, p := range received() {
+		lines = append(lines, strings.Split(p, "\n")...)
+	}
+	for _, want := range []string{
+		"app.pipeline.parse_v1.items_in:3|c",
+		"app.pipeline.parse_v1.items_out:2|c",
+		"app.pipeline.parse_v1.errors:1|c",
+		"app.pipeline.parse_v1.in_flight:0|g",
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("no %q in %q", want, lines)
+		}
+	}
+	timers := 0
+	for _, l := range lines {
+		if strings.HasPrefix(l, "app.pipeline.parse_v1.item_duration:") && strings.HasSuffix(l, "|ms") {
+			timers++
+		}
+	}
+	if timers != 3 {
+		t.Errorf("%d timings, want 3", timers)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	tests := []struct {
+		name        string
+		latencies   int
+		wantPackets int
+	}{
+		{name: "nothing counted"},
+		{name: "one packet", latencies: 10, wantPackets: 1},
+		{name: "split into packets", latencies: 200, wantPackets: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, received := listen(t)
+			metrics, err := pipelinestatsd.Dial(addr, "app", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer metrics.Close()
+
+			for range tt.latencies {
+				metrics.Latency("s", time.Millisecond)
+			}
+			if err := metrics.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			packets := received()
+			if len(packets) < tt.wantPackets || (tt.wantPackets <= 1 && len(packets) != tt.wantPackets) {
+				t.Fatalf("%d packets, want %d", len(packets), tt.wantPackets)
+			}
+			for _, p := range packets {
+				if len(p) > 1432 {
+					t.Errorf("packet of %d bytes", len(p))
+				}
+			}
+
+			// timers start over, gauges are sent again
+			if err := metrics.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range received() {
+				if strings.Contains(p, "item_duration") {
+					t.Errorf("timings sent twice: %q", p)
+				}
+			}
+		})
+	}
+}
+
+func TestInterval(t *testing.T) {
+	addr, received := listen(t)
+	clock := pipelinetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := pipeline.WithClock(context.Background(), clock)
+	metrics, err := pipelinestatsd.DialContext(ctx, addr, "app", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics.ItemIn("s")
+	clock.WaitForTimers(1)
+	if packets := received(); len(packets) > 0 {
+		t.Fatalf("sent %q before the interval was up", packets)
+	}
+	clock.Advance(time.Minute)
+	counted := func(p string) bool { return strings.Contains(p, "app.pipeline.s.items_in:1|c") }
+	if packets := received(); !slices.ContainsFunc(packets, counted) {
+		t.Errorf("sent %q after the interval, want the count", packets)
+	}
+
+	if err := metrics.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range received() {
+		if strings.Contains(p, "items_in") {
+			t.Errorf("counted again by the flush of Close: %q", p)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package pipelinetest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// ErrInjected is the error Chaos fails calls with unless it is given another
+// one.
+var ErrInjected = errors.New("pipelinetest: injected failure")
+
+// ErrDropped is wrapped, marked with pipeline.Skip, by the error of the calls
+// Chaos drops.
+var ErrDropped = errors.New("pipelinetest: injected drop")
+
+// ErrPoison is the error the calls on a poison pill fail with, see
+// Chaos.Poison.
+var ErrPoison = errors.New("pipelinetest: poison pill")
+
+// Chaos injects faults into the calls of a step, so a test can check that
+// its retries, dead-lettering and error policy hold up when things go wrong:
+//
+//	chaos := pipelinetest.Chaos{Seed: 1, ErrorRate: 0.2, DelayRate: 0.1, MaxDelay: 50 * time.Millisecond}
+//	err := pipeline.New(source).
+//		Then(enrich, chaos.Option(), pipeline.WithRetry(5, nil)).
+//		Run(ctx)
+//
+// Every call is delayed, dropped and failed independently with the given
+// rates, between 0 and 1, in that order. Faults are injected around fn, so
+// an injected failure is retried like a real one and a dropped call never
+// reaches fn. FlakyDownstream, SlowSink and PoisonPill are the failures
+// pipelines run into most, ready made.
+type Chaos struct {
+	// Seed makes the faults the same from one run to the next, as far as
+	// the order of concurrent calls allows. A zero Seed picks a random one.
+	Seed int64
+
+	// DelayRate is how often a call is delayed, by up to MaxDelay.
+	DelayRate float64
+	MaxDelay  time.Duration
+
+	// DropRate is how often a value is dropped: the call fails with an error
+	// marked with pipeline.Skip, so by default the value is skipped without
+	// being reported, see pipeline.ErrorSkip.
+	DropRate float64
+
+	// ErrorRate is how often a call fails with Err, or ErrInjected if Err is
+	// nil.
+	ErrorRate float64
+	Err       error
+
+	// Poison, if set, picks the values every call fails on, with ErrPoison,
+	// however often they are retried.
+	Poison func(in any) bool
+
+	// Enabled, if set, switches the faults on and off: none are injected
+	// while it reports false, so a test can start a pipeline healthy and
+	// break it halfway through, e.g. with the Load method of an atomic.Bool.
+	Enabled func() bool
+}
+
+// FlakyDownstream is a service that fails a fifth of the calls and is slow
+// to answer another fifth, by up to maxDelay, as a struggling dependency
+// does. Retries should see a step through it.
+func FlakyDownstream(seed int64, maxDelay time.Duration) Chaos {
+	return Chaos{Seed: seed, ErrorRate: 0.2, DelayRate: 0.2, MaxDelay: maxDelay}
+}
+
+// SlowSink is a destination taking up to maxDelay for every value, which
+// should show as backpressure, not lost values. Hand it to ChaosSink.
+func SlowSink(seed int64, maxDelay time.Duration) Chaos {
+	return Chaos{Seed: seed, DelayRate: 1, MaxDelay: maxDelay}
+}
+
+// PoisonPill is a value no attempt gets through, which should end up
+// dead-lettered, or failing the run, instead of being retried forever or
+// holding up the values behind it.
+func PoisonPill(poison func(in any) bool) Chaos {
+	return Chaos{Poison: poison}
+}
+
+// ChaosSink returns sink with c's faults injected into its calls, for a
+// pipeline's Sink, which has no step options. The delays are on the real
+// clock, a sink has no context to get another from.
+func ChaosSink[T any](c Chaos, sink func(T) error) func(T) error {
+	fn := c.Middleware()(func(_ context.Context, in any) (any, error) {
+		return nil, sink(in.(T))
+	})
+	return func(v T) error {
+		_, err := fn(context.Background(), v)
+		return err
+	}
+}
+
+// Option returns a step option injecting c's faults into every call of the
+// step's fn, see pipeline.WithMiddleware.
+func (c Chaos) Option() pipeline.StepOption {
+	return pipeline.WithMiddleware(c.Middleware())
+}
+
+// Middleware returns middleware injecting c's faults, for steps run other
+// than with Option. Every Middleware has random numbers of its own.
+func (c Chaos) Middleware() pipeline.Middleware {
+	seed := c.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	// rolls draws, under a lock since calls run concurrently, the decisions
+	// for a call
+	rolls := func() (delay time.Duration, drop, fail bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if rng.Float64() < c.DelayRate && c.MaxDelay > 0 {
+			delay = time.Duration(rng.Int63n(int64(c.MaxDelay) + 1))
+		}
+		drop = rng.Float64() < c.DropRate
+		fail = rng.Float64() < c.ErrorRate
+		return delay, drop, fail
+	}
+
+	injected := c.Err
+	if injected == nil {
+		injected = ErrInjected
+	}
+
+	return func(next pipeline.StepFunc) pipeline.StepFunc {
+		return func(ctx context.Context, in any) (any, error) {
+			if c.Enabled != nil && !c.Enabled() {
+				return next(ctx, in)
+			}
+			if c.Poison != nil && c.Poison(in) {
+				return nil, ErrPoison
+			}
+			delay, drop, fail := rolls()
+
+			if delay > 0 {
+				timer := pipeline.ClockFrom(ctx).NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				case <-timer.C():
+				}
+			}
+			if drop {
+				return nil, pipeline.Skip(ErrDropped)
+			}
+			if fail {
+				return nil, injected
+			}
+
+			return next(ctx, in)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package pipelinetest_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestChaosScenarios(t *testing.T) {
+	identity := func(v int) (int, error) { return v, nil }
+
+	tests := []struct {
+		name string
+		step []pipeline.StepOption
+		// sink wraps the pipeline's sink
+		sink func(func(int) error) func(int) error
+		// delivered and dead are the values that must reach the sink and be
+		// dead-lettered
+		delivered, dead []int
+		deadErr         error
+	}{
+		{
+			name:      "flaky downstream retried",
+			step:      []pipeline.StepOption{pipelinetest.FlakyDownstream(1, time.Millisecond).Option(), pipeline.WithRetry(10, nil)},
+			delivered: []int{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			name: "slow sink",
+			sink: func(sink func(int) error) func(int) error {
+				return pipelinetest.ChaosSink(pipelinetest.SlowSink(1, 2*time.Millisecond), sink)
+			},
+			delivered: []int{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			name: "poison pill",
+			step: []pipeline.StepOption{
+				pipelinetest.PoisonPill(func(in any) bool { return in == 3 }).Option(),
+				pipeline.WithRetry(3, nil),
+			},
+			delivered: []int{1, 2, 4, 5, 6, 7, 8},
+			dead:      []int{3},
+			deadErr:   pipelinetest.ErrPoison,
+		},
+		{
+			name:    "everything fails",
+			step:    []pipeline.StepOption{pipelinetest.Chaos{Seed: 1, ErrorRate: 1, Err: errOdd}.Option()},
+			dead:    []int{1, 2, 3, 4, 5, 6, 7, 8},
+			deadErr: errOdd,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			var mu sync.Mutex
+			var delivered, dead []int
+			sink := func(v int) error {
+				mu.Lock()
+				defer mu.Unlock()
+				delivered = append(delivered, v)
+				return nil
+			}
+			if tt.sink != nil {
+				sink = tt.sink(sink)
+			}
+
+			err := pipeline.New(func(ctx context.Context) (<-chan int, error) {
+				return pipeline.FromSlice(ctx, []int{1, 2, 3, 4, 5, 6, 7, 8}), nil
+			}).
+				Then(identity, append(tt.step, pipeline.WithConcurrency(4))...).
+				Sink(sink).
+				DeadLetter(func(err *pipeline.StageError) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if !errors.Is(err, tt.deadErr) {
+						t.Errorf("dead-lettered %v, want %v", err, tt.deadErr)
+					}
+					dead = append(dead, err.Input.(int))
+					return nil
+				}).
+				Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			slices.Sort(delivered)
+			slices.Sort(dead)
+			if !slices.Equal(delivered, tt.delivered) || !slices.Equal(dead, tt.dead) {
+				t.Errorf("delivered %v and dead-lettered %v, want %v and %v", delivered, dead, tt.delivered, tt.dead)
+			}
+		})
+	}
+}
+
+func TestChaosEnabled(t *testing.T) {
+	var enabled atomic.Bool
+	chaos := pipelinetest.Chaos{Seed: 1, ErrorRate: 1, Enabled: enabled.Load}
+	double := func(v int) (int, error) { return v * 2, nil }
+
+	out, errs := pipelinetest.RunStep(t, double, []int{1, 2}, chaos.Option())
+	if !slices.Equal(out, []int{2, 4}) || errs[0] != nil || errs[1] != nil {
+		t.Errorf("switched off: got %v, %v, want no faults", out, errs)
+	}
+
+	enabled.Store(true)
+	_, errs = pipelinetest.RunStep(t, double, []int{1, 2}, chaos.Option())
+	for i, err := range errs {
+		if !errors.Is(err, pipelinetest.ErrInjected) {
+			t.Errorf("switched on: call %d = %v, want ErrInjected", i, err)
+		}
+	}
+}
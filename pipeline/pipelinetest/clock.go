@@ -0,0 +1,173 @@
+package pipelinetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// FakeClock is a pipeline.Clock whose time only moves when told to, so
+// windows, batches and timeouts can be tested without sleeping:
+//
+//	clock := pipelinetest.NewFakeClock(time.Time{})
+//	ctx := pipeline.WithClock(context.Background(), clock)
+//	windows := pipeline.TumblingWindow(ctx, in, time.Minute)
+//
+//	in <- 1
+//	in <- 2
+//	clock.WaitForTimers(1)
+//	clock.Advance(time.Minute)
+//	got := pipelinetest.Receive(t, windows) // [1 2]
+//
+// Stages create their timers in their own goroutines, WaitForTimers makes
+// sure a timer exists before the time it waits for is advanced past.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// NewFakeClock returns a FakeClock reading now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d, firing every timer and ticker due by
+// then. A ticker due several times over fires once, like a time.Ticker whose
+// receiver fell behind.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	waiters := c.waiters[:0]
+	for _, t := range c.waiters {
+		if t.when.After(c.now) {
+			waiters = append(waiters, t)
+			continue
+		}
+
+		select {
+		case t.ch <- t.when:
+		default:
+		}
+		if t.period > 0 {
+			// skip the ticks that were missed
+			for !t.when.After(c.now) {
+				t.when = t.when.Add(t.period)
+			}
+			waiters = append(waiters, t)
+		}
+	}
+	c.waiters = waiters
+}
+
+// WaitForTimers blocks until at least n timers and tickers are waiting to
+// fire.
+func (c *FakeClock) WaitForTimers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// NewTimer returns a timer firing once the clock has been advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) pipeline.Timer {
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker returns a ticker firing every time the clock has been advanced
+// by another d.
+func (c *FakeClock) NewTicker(d time.Duration) pipeline.Ticker {
+	if d <= 0 {
+		panic("pipelinetest: non-positive interval for NewTicker")
+	}
+
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1), period: d}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t.when = c.now.Add(d)
+	c.add(t)
+	return fakeTicker{t}
+}
+
+// add must be called with mu held.
+func (c *FakeClock) add(t *fakeTimer) {
+	c.waiters = append(c.waiters, t)
+	c.cond.Broadcast()
+}
+
+// remove must be called with mu held, it reports whether t was waiting.
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer is both the timers and the tickers of a FakeClock, a ticker has
+// a period.
+type fakeTimer struct {
+	clock  *FakeClock
+	ch     chan time.Time
+	when   time.Time
+	period time.Duration
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+type fakeTicker struct{ *fakeTimer }
+
+func (t fakeTicker) Stop() { t.fakeTimer.Stop() }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	// like a Go 1.23 timer, no stale time is left to receive
+	select {
+	case <-t.ch:
+	default:
+	}
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	select {
+	case <-t.ch:
+	default:
+	}
+	active := t.clock.remove(t)
+
+	t.when = t.clock.now.Add(d)
+	if d <= 0 {
+		t.ch <- t.when
+		return active
+	}
+	t.clock.add(t)
+	return active
+}
@@ -0,0 +1,127 @@
+package pipelinetest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// fired returns the time ch has ready, if any. A FakeClock fires its timers
+// as it is advanced, so there is no waiting.
+func fired(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case at := <-ch:
+		return at, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// run moves the clock along, checking the timers it made with fire
+		run func(t *testing.T, clock *pipelinetest.FakeClock, fire func(ch <-chan time.Time, want time.Duration))
+	}{
+		{
+			name: "timer",
+			run: func(t *testing.T, clock *pipelinetest.FakeClock, fire func(<-chan time.Time, time.Duration)) {
+				timer := clock.NewTimer(time.Minute)
+				clock.Advance(time.Minute - time.Nanosecond)
+				fire(timer.C(), -1)
+				clock.Advance(time.Nanosecond)
+				fire(timer.C(), time.Minute)
+				clock.Advance(time.Hour)
+				fire(timer.C(), -1)
+			},
+		},
+		{
+			name: "timer stopped",
+			run: func(t *testing.T, clock *pipelinetest.FakeClock, fire func(<-chan time.Time, time.Duration)) {
+				timer := clock.NewTimer(time.Minute)
+				if !timer.Stop() {
+					t.Error("Stop = false, want the timer stopped while waiting")
+				}
+				clock.Advance(time.Hour)
+				fire(timer.C(), -1)
+				if timer.Stop() {
+					t.Error("Stop = true, want it already stopped")
+				}
+			},
+		},
+		{
+			name: "timer reset",
+			run: func(t *testing.T, clock *pipelinetest.FakeClock, fire func(<-chan time.Time, time.Duration)) {
+				timer := clock.NewTimer(time.Minute)
+				clock.Advance(30 * time.Second)
+				timer.Reset(time.Minute)
+				clock.Advance(30 * time.Second)
+				fire(timer.C(), -1)
+				clock.Advance(30 * time.Second)
+				fire(timer.C(), 90*time.Second)
+			},
+		},
+		{
+			name: "timer due",
+			run: func(t *testing.T, clock *pipelinetest.FakeClock, fire func(<-chan time.Time, time.Duration)) {
+				fire(clock.NewTimer(0).C(), 0)
+			},
+		},
+		{
+			name: "ticker",
+			run: func(t *testing.T, clock *pipelinetest.FakeClock, fire func(<-chan time.Time, time.Duration)) {
+				ticker := clock.NewTicker(time.Second)
+				clock.Advance(time.Second)
+				fire(ticker.C(), time.Second)
+				clock.Advance(time.Second)
+				fire(ticker.C(), 2*time.Second)
+				// like a time.Ticker, the ticks missed make one
+				clock.Advance(5 * time.Second)
+				fire(ticker.C(), 3*time.Second)
+				fire(ticker.C(), -1)
+				clock.Advance(time.Second)
+				fire(ticker.C(), 8*time.Second)
+
+				ticker.Stop()
+				clock.Advance(time.Minute)
+				fire(ticker.C(), -1)
+			},
+		},
+		{
+			name: "waiting for timers",
+			run: func(t *testing.T, clock *pipelinetest.FakeClock, fire func(<-chan time.Time, time.Duration)) {
+				timers := make(chan pipeline.Timer)
+				go func() {
+					timers <- clock.NewTimer(time.Second)
+				}()
+				clock.WaitForTimers(1)
+				clock.Advance(time.Second)
+				fire((<-timers).C(), time.Second)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := pipelinetest.NewFakeClock(start)
+			// fire checks ch fired at want into the test, -1 for not at all
+			fire := func(ch <-chan time.Time, want time.Duration) {
+				t.Helper()
+				at, ok := fired(ch)
+				switch {
+				case want < 0 && ok:
+					t.Errorf("fired at %v, want it not to", at.Sub(start))
+				case want >= 0 && !ok:
+					t.Errorf("didn't fire at %v", clock.Now().Sub(start))
+				case ok && at.Sub(start) != want:
+					t.Errorf("fired at %v, want %v", at.Sub(start), want)
+				}
+			}
+			tt.run(t, clock, fire)
+		})
+	}
+}
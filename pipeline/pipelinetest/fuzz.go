@@ -0,0 +1,130 @@
+package pipelinetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// maxChunk bounds the bytes a value given to Fuzz is decoded from.
+const maxChunk = 8
+
+// Fuzz fuzzes the pipeline build makes, checking what should hold whatever
+// it is fed:
+//
+//	func FuzzOrders(f *testing.F) {
+//		f.Add([]byte("\x03\x40\x01\x05o-123\x04o-77"))
+//		pipelinetest.Fuzz(f, parseOrder, func(p *pipeline.Pipeline[Order], faults pipeline.StepOption) *pipeline.Pipeline[Order] {
+//			return p.Then(validate, faults).Then(enrich, faults, pipeline.WithRetry(3, nil))
+//		})
+//	}
+//
+// run with go test -fuzz FuzzOrders. Every input the fuzzer comes up with is
+// a workload: values, decoded by value from chunks of the input, a point to
+// cancel the run at and how often the steps given faults fail, see
+// FuzzRun. The seed corpus is run as a plain test without -fuzz.
+func Fuzz[T any](f *testing.F, value func(data []byte) T, build func(p *pipeline.Pipeline[T], faults pipeline.StepOption) *pipeline.Pipeline[T]) {
+	f.Helper()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		FuzzRun(t, data, value, build)
+	})
+}
+
+// FuzzRun runs the workload data decodes into through the pipeline build
+// makes, for fuzz tests taking other arguments than Fuzz does. The first
+// byte of data is how many values reach the sink before the run is
+// cancelled, 0 for not cancelling it; the second and third are
+// how often, out of 256, and with what seed the calls of the steps given
+// faults fail with ErrInjected, see Chaos. Values are decoded from the
+// rest, each from as many of the bytes following one as it says, up to
+// seven.
+//
+// build must only add steps, the pipeline's sink and dead-letter handler
+// are FuzzRun's. The test fails if
+//   - a step panics,
+//   - Run hasn't returned within ten seconds, or returns an error other
+//     than the cancellation,
+//   - goroutines are left running once it has, see VerifyNoLeaks,
+//   - values are lost or made up: unless the run is cancelled every value
+//     reaches the sink or is dead-lettered, exactly once between them.
+//     Steps skipping values on purpose, see pipeline.Skip, break it.
+func FuzzRun[T any](t testing.TB, data []byte, value func(data []byte) T, build func(p *pipeline.Pipeline[T], faults pipeline.StepOption) *pipeline.Pipeline[T]) {
+	t.Helper()
+	VerifyNoLeaks(t)
+
+	var header [3]byte
+	data = data[copy(header[:], data):]
+	cancelAfter := int(header[0])
+	faults := Chaos{Seed: int64(header[2]) + 1, ErrorRate: float64(header[1]) / 256}.Option()
+
+	var inputs []T
+	for len(data) > 0 {
+		n := min(int(data[0])%maxChunk, len(data)-1)
+		inputs = append(inputs, value(data[1:1+n]))
+		data = data[1+n:]
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu           sync.Mutex
+		sank, failed int
+		panicked     *pipeline.PanicError
+	)
+	p := build(pipeline.New(func(ctx context.Context) (<-chan T, error) {
+		return pipeline.FromSlice(ctx, inputs), nil
+	}), faults).
+		Sink(func(T) error {
+			mu.Lock()
+			defer mu.Unlock()
+			sank++
+			if sank == cancelAfter {
+				cancel()
+			}
+			return nil
+		}).
+		DeadLetter(func(err *pipeline.StageError) error {
+			mu.Lock()
+			defer mu.Unlock()
+			failed++
+			if panicked == nil {
+				errors.As(err, &panicked)
+			}
+			return nil
+		})
+
+	ran := make(chan error, 1)
+	go func() {
+		ran <- p.Run(ctx)
+	}()
+	var err error
+	select {
+	case err = <-ran:
+	case <-time.After(timeout):
+		t.Fatalf("pipelinetest: pipeline still running after %s over %d values", timeout, len(inputs))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if panicked == nil {
+		errors.As(err, &panicked)
+	}
+	cancelled := ctx.Err() != nil
+	switch {
+	case panicked != nil:
+		t.Fatalf("pipelinetest: %v\n\n%s", panicked, panicked.Stack)
+	case err != nil && !(cancelled && errors.Is(err, context.Canceled)):
+		t.Fatalf("pipelinetest: Run = %v over %d values", err, len(inputs))
+	case sank+failed > len(inputs):
+		t.Fatalf("pipelinetest: %d values reached the sink and %d were dead-lettered out of %d", sank, failed, len(inputs))
+	case !cancelled && sank+failed < len(inputs):
+		t.Fatalf("pipelinetest: %d values reached the sink and %d were dead-lettered out of %d, %d were lost",
+			sank, failed, len(inputs), len(inputs)-sank-failed)
+	}
+}
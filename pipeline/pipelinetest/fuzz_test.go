@@ -0,0 +1,91 @@
+package pipelinetest_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// sum adds up the bytes of a value.
+func sum(data []byte) int {
+	n := 0
+	for _, b := range data {
+		n += int(b)
+	}
+	return n
+}
+
+func FuzzPipeline(f *testing.F) {
+	f.Add([]byte(""))
+	f.Add([]byte("\x00\x00\x00\x03abc\x01d\x00"))
+	f.Add([]byte("\x02\x80\x07\x03abc\x01d\x07abcdefg\x02hi"))
+	f.Add([]byte("\x00\xff\x01\x03abc\x01d\x02ef\x02gh"))
+
+	pipelinetest.Fuzz(f, sum, func(p *pipeline.Pipeline[int], faults pipeline.StepOption) *pipeline.Pipeline[int] {
+		return p.
+			Then(func(v int) (int, error) { return v * 2, nil }, faults, pipeline.WithConcurrency(4)).
+			Then(func(v int) (int, error) { return v + 1, nil }, faults, pipeline.WithRetry(3, nil))
+	})
+}
+
+func TestFuzzRunFails(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		fn   func(int) (int, error)
+		// want is part of the failure, "" for none
+		want string
+	}{
+		{
+			name: "holds",
+			data: "\x00\x40\x01\x01a\x01b\x01c",
+			fn:   func(v int) (int, error) { return v, nil },
+		},
+		{
+			name: "cancelled",
+			data: "\x01\x00\x00\x01a\x01b\x01c\x01d",
+			fn:   func(v int) (int, error) { return v, nil },
+		},
+		{
+			name: "panics",
+			data: "\x00\x00\x00\x01a\x02bc",
+			fn: func(v int) (int, error) {
+				if v > 'a' {
+					panic("too big")
+				}
+				return v, nil
+			},
+			want: "panic: too big",
+		},
+		{
+			name: "loses values",
+			data: "\x00\x00\x00\x01a\x02bc",
+			fn: func(v int) (int, error) {
+				if v > 'a' {
+					return 0, pipeline.Skip(errors.New("too big"))
+				}
+				return v, nil
+			},
+			want: "1 were lost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := fails(t, func(t testing.TB) {
+				pipelinetest.FuzzRun(t, []byte(tt.data), sum, func(p *pipeline.Pipeline[int], faults pipeline.StepOption) *pipeline.Pipeline[int] {
+					return p.Then(tt.fn, faults)
+				})
+			})
+			switch {
+			case tt.want == "" && failure != "":
+				t.Errorf("failed with %q, want it to pass", failure)
+			case !strings.Contains(failure, tt.want):
+				t.Errorf("failed with %q, want %q", failure, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package pipelinetest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+var update = flag.Bool("pipelinetest.update", false, "rewrite the golden files of pipelinetest.Golden and RunGolden with what the tests got")
+
+// maxDiff is how many differing lines a golden file mismatch reports.
+const maxDiff = 20
+
+// RunGolden runs stage over the values of the JSON lines file fixture, see
+// ReadJSONL, and compares what it emitted with the golden file
+// testdata/name.golden, see Golden. The errors it emitted are part of the
+// output, a line "error: " followed by the error's message each, so the
+// failures of an ETL job are pinned down as well as its results:
+//
+//	func TestNormalize(t *testing.T) {
+//		pipelinetest.RunGolden(t, pipeline.NewStage(normalize), "testdata/orders.jsonl", "normalized")
+//	}
+func RunGolden[In any, Out any](t testing.TB, stage pipeline.Stage[In, Out], fixture, name string) {
+	t.Helper()
+
+	out, errs := Run(t, context.Background(), stage, ReadJSONL[In](t, fixture))
+	lines := encodeLines(t, out)
+	for _, err := range errs {
+		lines = append(lines, "error: "+strings.ReplaceAll(err.Error(), "\n", `\n`))
+	}
+	compareGolden(t, name, lines)
+}
+
+// Golden compares got, a line of JSON each, with the golden file
+// testdata/name.golden. The lines are sorted on both sides, so outputs of
+// concurrent stages, which arrive in any order, match as long as they hold
+// the same values. Run the test with -pipelinetest.update to write got to
+// the file instead, creating it, then review and commit the change.
+func Golden[T any](t testing.TB, name string, got []T) {
+	t.Helper()
+
+	compareGolden(t, name, encodeLines(t, got))
+}
+
+// ReadJSONL returns the values of the file at path, a line of JSON each,
+// for the fixtures of Golden tests. Blank lines are skipped.
+func ReadJSONL[T any](t testing.TB, path string) []T {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("pipelinetest: %v", err)
+	}
+	defer f.Close()
+
+	var values []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var v T
+		if err := json.Unmarshal(line, &v); err != nil {
+			t.Fatalf("pipelinetest: %s:%d: %v", path, n, err)
+		}
+		values = append(values, v)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("pipelinetest: reading %s: %v", path, err)
+	}
+
+	return values
+}
+
+func encodeLines[T any](t testing.TB, values []T) []string {
+	t.Helper()
+
+	lines := make([]string, 0, len(values))
+	for _, v := range values {
+		line, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("pipelinetest: encoding %v: %v", v, err)
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// compareGolden compares the sorted lines with the golden file name, or
+// writes them to it with -pipelinetest.update.
+func compareGolden(t testing.TB, name string, lines []string) {
+	t.Helper()
+
+	slices.Sort(lines)
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		var buf bytes.Buffer
+		for _, line := range lines {
+			buf.WriteString(line + "\n")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("pipelinetest: %v", err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("pipelinetest: %v", err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("pipelinetest: no golden file %s, run the test with -pipelinetest.update to create it", path)
+	}
+	if err != nil {
+		t.Fatalf("pipelinetest: %v", err)
+	}
+	var want []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			want = append(want, line)
+		}
+	}
+	slices.Sort(want)
+
+	if diff := diffLines(want, lines); len(diff) > 0 {
+		t.Fatalf("pipelinetest: output differs from %s (- missing, + unexpected), run the test with -pipelinetest.update to accept it:\n%s",
+			path, strings.Join(diff, "\n"))
+	}
+}
+
+// diffLines returns the lines of sorted want missing from sorted got, with
+// a "- " in front, and those of got that aren't in want, with a "+ ", up to
+// maxDiff of them.
+func diffLines(want, got []string) []string {
+	var diff []string
+	add := func(line string) {
+		if len(diff) < maxDiff {
+			diff = append(diff, line)
+		} else if len(diff) == maxDiff {
+			diff = append(diff, "...")
+		}
+	}
+
+	for len(want) > 0 || len(got) > 0 {
+		switch {
+		case len(got) == 0 || len(want) > 0 && want[0] < got[0]:
+			add("- " + want[0])
+			want = want[1:]
+		case len(want) == 0 || got[0] < want[0]:
+			add("+ " + got[0])
+			got = got[1:]
+		default:
+			want, got = want[1:], got[1:]
+		}
+	}
+	return diff
+}
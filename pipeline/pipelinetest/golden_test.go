@@ -0,0 +1,97 @@
+package pipelinetest_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+type order struct {
+	ID    int `json:"id"`
+	Total int `json:"total"`
+}
+
+// withTax adds a tenth to the total of an order, failing on negative ones.
+func withTax(o order) (order, error) {
+	if o.Total < 0 {
+		return order{}, errors.New("negative total")
+	}
+	o.Total += o.Total / 10
+	return o, nil
+}
+
+func TestRunGolden(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	// concurrent, so the output is in any order
+	stage := pipeline.NewStage(withTax, pipeline.WithConcurrency(4), pipeline.WithName("tax"))
+	pipelinetest.RunGolden(t, stage, "testdata/orders.jsonl", "taxed")
+}
+
+func TestGoldenFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		golden string
+		got    []order
+		want   []string
+	}{
+		{
+			name:   "differs",
+			golden: "taxed",
+			got:    []order{{ID: 1, Total: 11}, {ID: 3, Total: 8}, {ID: 4, Total: 13}},
+			want:   []string{"- error: tax: negative total", `- {"id":3,"total":7}`, `+ {"id":3,"total":8}`},
+		},
+		{
+			name:   "missing",
+			golden: "missing",
+			got:    []order{{ID: 1}},
+			want:   []string{"no golden file testdata/missing.golden", "-pipelinetest.update"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := fails(t, func(t testing.TB) {
+				pipelinetest.Golden(t, tt.golden, tt.got)
+			})
+			for _, want := range tt.want {
+				if !strings.Contains(failure, want) {
+					t.Errorf("failed with %q, want %q in it", failure, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := flag.Set("pipelinetest.update", "true"); err != nil {
+		t.Fatal(err)
+	}
+	pipelinetest.Golden(t, "new", []order{{ID: 2, Total: 1}, {ID: 1, Total: 2}})
+	if err := flag.Set("pipelinetest.update", "false"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile("testdata/new.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "{\"id\":1,\"total\":2}\n{\"id\":2,\"total\":1}\n"; got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+	// what was written now matches
+	pipelinetest.Golden(t, "new", []order{{ID: 1, Total: 2}, {ID: 2, Total: 1}})
+}
@@ -0,0 +1,77 @@
+package pipelinetest
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// VerifyNoLeaks fails the test if goroutines started during it are still
+// running once it has finished, which for a pipeline usually means a stage
+// that didn't close its channels or a send nobody will ever receive. Call it
+// first thing in the test:
+//
+//	func TestEnrich(t *testing.T) {
+//		pipelinetest.VerifyNoLeaks(t)
+//		...
+//	}
+//
+// Goroutines get up to a second to wind down after the test returns. Tests
+// calling it must not run in parallel with others, their goroutines would
+// count as leaked.
+func VerifyNoLeaks(t testing.TB) {
+	t.Helper()
+
+	before := goroutines()
+	t.Cleanup(func() {
+		var leaked []string
+		deadline := time.Now().Add(time.Second)
+		for {
+			leaked = leaked[:0]
+			for id, stack := range goroutines() {
+				if _, ok := before[id]; !ok && !ignoredGoroutine(stack) {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if len(leaked) > 0 {
+			t.Errorf("pipelinetest: %d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+	})
+}
+
+// goroutines returns the stack of every goroutine by its header, which
+// starts with its id.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		header, _, _ := bytes.Cut(stack, []byte(" ["))
+		stacks[string(header)] = string(stack)
+	}
+	return stacks
+}
+
+// ignoredGoroutine reports whether stack belongs to the goroutine checking
+// for leaks or to the testing package itself.
+func ignoredGoroutine(stack string) bool {
+	return strings.Contains(stack, "pipelinetest.goroutines(") ||
+		strings.Contains(stack, "testing.(*T).Run(") ||
+		strings.Contains(stack, "testing.tRunner.func1")
+}
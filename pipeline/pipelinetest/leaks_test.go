@@ -0,0 +1,87 @@
+package pipelinetest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// cleanups is a testing.TB running its cleanups when asked to, rather than
+// once the test is over, and keeping the errors they report.
+type cleanups struct {
+	testing.TB
+	fns    []func()
+	errors []string
+}
+
+func (c *cleanups) Cleanup(fn func()) { c.fns = append(c.fns, fn) }
+
+func (c *cleanups) Errorf(format string, args ...any) {
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+func (c *cleanups) finish() {
+	for i := len(c.fns) - 1; i >= 0; i-- {
+		c.fns[i]()
+	}
+}
+
+func TestVerifyNoLeaks(t *testing.T) {
+	tests := []struct {
+		name string
+		// start starts the goroutines of the test, returning what stops
+		// those still running
+		start  func() (stop func())
+		leaked bool
+	}{
+		{
+			name:  "nothing started",
+			start: func() func() { return func() {} },
+		},
+		{
+			name: "finished",
+			start: func() func() {
+				done := make(chan struct{})
+				go close(done)
+				<-done
+				return func() {}
+			},
+		},
+		{
+			name: "winding down",
+			start: func() func() {
+				go time.Sleep(50 * time.Millisecond)
+				return func() {}
+			},
+		},
+		{
+			name: "blocked",
+			start: func() func() {
+				release := make(chan struct{})
+				go func() { <-release }()
+				return func() { close(release) }
+			},
+			leaked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &cleanups{TB: t}
+			pipelinetest.VerifyNoLeaks(c)
+			stop := tt.start()
+			c.finish()
+			stop()
+
+			if leaked := len(c.errors) > 0; leaked != tt.leaked {
+				t.Errorf("reported leaks %v, want leaked %v", c.errors, tt.leaked)
+			}
+			if tt.leaked && (len(c.errors) != 1 || !strings.Contains(c.errors[0], "1 goroutines leaked")) {
+				t.Errorf("reported %v, want the blocked goroutine", c.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package pipelinetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Source is a mock pipeline source the test feeds by hand, so it decides
+// when every value goes in and can check what happened to it before sending
+// the next one:
+//
+//	src := pipelinetest.NewSource[int]()
+//	sink := pipelinetest.NewSink[int]()
+//	p := pipeline.New(src.Open).Then(double).Sink(sink.Handle)
+//	go p.Run(ctx)
+//
+//	src.Send(t, 1)
+//	if got := sink.Next(t); got != 2 {
+//		t.Fatalf("got %d, want 2", got)
+//	}
+//	src.Close()
+type Source[T any] struct {
+	values chan T
+	close  sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewSource returns a Source with nothing sent yet.
+func NewSource[T any]() *Source[T] {
+	return &Source[T]{values: make(chan T)}
+}
+
+// Open is the pipeline.Source to run, it returns the values sent with Send,
+// or the error set with FailWith.
+func (s *Source[T]) Open(context.Context) (<-chan T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.values, nil
+}
+
+// FailWith makes Open fail with err, for testing a source that can't start.
+func (s *Source[T]) FailWith(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// Send hands values to whatever reads the source one at a time, returning
+// once the last one has been taken. The test fails if a value isn't taken
+// within ten seconds.
+func (s *Source[T]) Send(t testing.TB, values ...T) {
+	t.Helper()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for i, v := range values {
+		select {
+		case <-deadline.C:
+			t.Fatalf("pipelinetest: source value %d not taken after %s", i, timeout)
+		case s.values <- v:
+		}
+	}
+}
+
+// Close ends the source, as if it had run out of values. It is safe to call
+// more than once.
+func (s *Source[T]) Close() {
+	s.close.Do(func() { close(s.values) })
+}
+
+// Sink is a mock pipeline sink recording what it receives. Its Handle can be
+// scripted, see Script, to fail or hang on demand.
+type Sink[T any] struct {
+	script *Script[T, struct{}]
+}
+
+// NewSink returns a Sink taking every value.
+func NewSink[T any]() *Sink[T] {
+	return &Sink[T]{script: NewScript[T, struct{}](nil)}
+}
+
+// Handle is the sink handler to run, see pipeline.Pipeline.Sink. It does
+// what Fail and Hang have lined up, taking the value otherwise.
+func (s *Sink[T]) Handle(v T) error {
+	_, err := s.script.Fn(context.Background(), v)
+	return err
+}
+
+// Fail makes the next call of Handle that isn't already scripted fail with
+// err. The value still counts as received.
+func (s *Sink[T]) Fail(err error) *Sink[T] {
+	s.script.Fail(err)
+	return s
+}
+
+// Hang makes the next call of Handle that isn't already scripted block until
+// Release is called, so the test can check what the pipeline does while its
+// sink is stuck. A hanging sink must be released before the test ends.
+func (s *Sink[T]) Hang() *Sink[T] {
+	s.script.Hang()
+	return s
+}
+
+// Release lets the calls of Handle that are hanging carry on.
+func (s *Sink[T]) Release() {
+	s.script.Release()
+}
+
+// Values returns every value Handle has been called with so far, in order.
+func (s *Sink[T]) Values() []T {
+	return s.script.Calls()
+}
+
+// Next waits for Handle to be called with the value after the last one Next
+// returned, see Script.Next.
+func (s *Sink[T]) Next(t testing.TB) T {
+	t.Helper()
+
+	return s.script.Next(t)
+}
+
+// Script is a step function that does what the test lines up for each call,
+// in the order the calls are made, and runs fn for the calls it has nothing
+// lined up for:
+//
+//	enrich := pipelinetest.NewScript(lookup).
+//		Fail(errTimeout). // the first call fails
+//		Hang()            // the second hangs until its context is done
+//	p := pipeline.New(src.Open).ThenCtx(enrich.Fn, pipeline.WithRetry(3, nil))
+//
+// A Script is safe for concurrent use, as its Fn is called concurrently by
+// the step's workers.
+type Script[In any, Out any] struct {
+	fn func(context.Context, In) (Out, error)
+
+	mu      sync.Mutex
+	actions []action[Out]
+	calls   []In
+	// called is closed and replaced whenever a call is made, for Next
+	called chan struct{}
+	next   int
+	// release is closed and replaced by Release
+	release chan struct{}
+}
+
+// action is what a Script does with a call.
+type action[Out any] struct {
+	out  Out
+	err  error
+	hang bool
+}
+
+// NewScript returns a Script running fn, which takes the step's context, for
+// the calls nothing is lined up for. With a nil fn those calls return the
+// zero Out.
+func NewScript[In any, Out any](fn func(context.Context, In) (Out, error)) *Script[In, Out] {
+	if fn == nil {
+		fn = func(context.Context, In) (Out, error) {
+			var zero Out
+			return zero, nil
+		}
+	}
+
+	return &Script[In, Out]{fn: fn, called: make(chan struct{}), release: make(chan struct{})}
+}
+
+// Succeed lines up a call returning out.
+func (s *Script[In, Out]) Succeed(out Out) *Script[In, Out] {
+	return s.then(action[Out]{out: out})
+}
+
+// Fail lines up a call failing with err.
+func (s *Script[In, Out]) Fail(err error) *Script[In, Out] {
+	return s.then(action[Out]{err: err})
+}
+
+// Hang lines up a call blocking until its context is done, when it returns
+// the context's error, or until Release is called, when it carries on to fn.
+// It stands in for a hung call, e.g. to test WithItemTimeout or the
+// Watchdog.
+func (s *Script[In, Out]) Hang() *Script[In, Out] {
+	return s.then(action[Out]{hang: true})
+}
+
+func (s *Script[In, Out]) then(a action[Out]) *Script[In, Out] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.actions = append(s.actions, a)
+	return s
+}
+
+// Release lets the calls that are hanging carry on to fn.
+func (s *Script[In, Out]) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.release)
+	s.release = make(chan struct{})
+}
+
+// Fn is the step function to run, see pipeline.StepCtx.
+func (s *Script[In, Out]) Fn(ctx context.Context, in In) (Out, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, in)
+	close(s.called)
+	s.called = make(chan struct{})
+
+	a, scripted := action[Out]{}, false
+	if len(s.actions) > 0 {
+		a, scripted = s.actions[0], true
+		s.actions = s.actions[1:]
+	}
+	release := s.release
+	s.mu.Unlock()
+
+	switch {
+	case !scripted:
+		return s.fn(ctx, in)
+	case a.hang:
+		select {
+		case <-ctx.Done():
+			return a.out, ctx.Err()
+		case <-release:
+			return s.fn(ctx, in)
+		}
+	default:
+		return a.out, a.err
+	}
+}
+
+// Calls returns the inputs of every call made so far, in the order the calls
+// were made.
+func (s *Script[In, Out]) Calls() []In {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]In(nil), s.calls...)
+}
+
+// Next waits for the call after the one the last Next returned to be made
+// and returns its input, so a test can go through the calls one at a time.
+// The test fails if no call is made within ten seconds.
+func (s *Script[In, Out]) Next(t testing.TB) In {
+	t.Helper()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		if s.next < len(s.calls) {
+			in := s.calls[s.next]
+			s.next++
+			s.mu.Unlock()
+			return in
+		}
+		called, n := s.called, s.next
+		s.mu.Unlock()
+
+		select {
+		case <-deadline.C:
+			t.Fatalf("pipelinetest: call %d not made after %s", n+1, timeout)
+		case <-called:
+		}
+	}
+}
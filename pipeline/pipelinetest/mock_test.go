@@ -0,0 +1,138 @@
+package pipelinetest_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func double(_ context.Context, v int) (int, error) { return 2 * v, nil }
+
+func TestScript(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errScripted := errors.New("scripted")
+	script := pipelinetest.NewScript(double).
+		Fail(errScripted).
+		Succeed(-1).
+		Hang()
+
+	ctx := context.Background()
+	tests := []struct {
+		in      int
+		want    int
+		wantErr error
+	}{
+		{in: 1, wantErr: errScripted},
+		{in: 2, want: -1},
+		{in: 3, wantErr: context.DeadlineExceeded}, // hangs until the timeout
+		{in: 4, want: 8},                           // nothing left lined up
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		got, err := script.Fn(ctx, tt.in)
+		cancel()
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && got != tt.want) {
+			t.Errorf("call with %d: got %d, %v, want %d, %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if got := script.Calls(); !slices.Equal(got, []int{1, 2, 3, 4}) {
+		t.Errorf("Calls = %v", got)
+	}
+	for want := 1; want <= 4; want++ {
+		if got := script.Next(t); got != want {
+			t.Errorf("Next = %d, want %d", got, want)
+		}
+	}
+}
+
+func TestScriptRelease(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	script := pipelinetest.NewScript(double).Hang().Hang().Hang()
+	out, errs := pipeline.StepCtx(context.Background(), pipeline.FromSlice(context.Background(), []int{1, 2, 3}), script.Fn,
+		pipeline.WithConcurrency(3), pipeline.WithOrderedOutput())
+
+	// every call is made and hangs, in whatever order the workers make them
+	for range 3 {
+		script.Next(t)
+	}
+	select {
+	case v := <-out:
+		t.Fatalf("got %d while every call hangs", v)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	script.Release()
+	if got := pipelinetest.Collect(t, out); !slices.Equal(got, []int{2, 4, 6}) {
+		t.Errorf("got %v after the release, want [2 4 6]", got)
+	}
+	if got := pipelinetest.Collect(t, errs); len(got) != 0 {
+		t.Errorf("got errors %v", got)
+	}
+}
+
+// TestStepByStep goes through a pipeline one value at a time, checking its
+// Status between values without sleeping.
+func TestStepByStep(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errSink := errors.New("sink down")
+	src := pipelinetest.NewSource[int]()
+	sink := pipelinetest.NewSink[int]().Fail(errSink)
+	p := pipeline.New(src.Open).
+		ThenCtx(double, pipeline.WithConcurrency(1)).
+		Sink(sink.Handle).
+		OnError(pipeline.SkipErrors())
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(context.Background()) }()
+
+	src.Send(t, 1)
+	if got := sink.Next(t); got != 2 {
+		t.Fatalf("sink got %d, want 2", got)
+	}
+	src.Send(t, 2)
+	if got := sink.Next(t); got != 4 {
+		t.Fatalf("sink got %d, want 4", got)
+	}
+
+	// the sink hangs with 6 until released, holding up the values after it
+	sink.Hang()
+	src.Send(t, 3)
+	if got := sink.Next(t); got != 6 {
+		t.Fatalf("sink got %d, want 6", got)
+	}
+	if s := p.Status(); s.Done != 1 || s.Failed != 1 {
+		t.Errorf("Status while the sink hangs = %+v, want 1 done and 1 failed", s)
+	}
+	sink.Release()
+
+	src.Send(t, 4)
+	if got := sink.Next(t); got != 8 {
+		t.Fatalf("sink got %d, want 8", got)
+	}
+	src.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.Values(); !slices.Equal(got, []int{2, 4, 6, 8}) {
+		t.Errorf("sink values = %v", got)
+	}
+}
+
+func TestSourceFailWith(t *testing.T) {
+	errDown := errors.New("down")
+	src := pipelinetest.NewSource[int]()
+	src.FailWith(errDown)
+
+	err := pipeline.New(src.Open).Sink(pipelinetest.NewSink[int]().Handle).Run(context.Background())
+	if !errors.Is(err, errDown) {
+		t.Errorf("Run = %v, want %v", err, errDown)
+	}
+}
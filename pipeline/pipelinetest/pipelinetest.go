@@ -0,0 +1,225 @@
+// Package pipelinetest helps unit-test pipeline stages without wiring up
+// channels and contexts by hand:
+//
+//	func TestDouble(t *testing.T) {
+//		pipelinetest.VerifyNoLeaks(t)
+//
+//		out, errs := pipelinetest.RunStage(t, double, []int{1, 2, 3})
+//		if !slices.Equal(out, []int{2, 4, 6}) || len(errs) != 0 {
+//			t.Fatalf("got %v, %v", out, errs)
+//		}
+//	}
+//
+// RunStep does the same but pairs every input with its result or error, for
+// table tests of transforms that fail on some inputs.
+//
+// Whole pipelines can be run against a mock Source and Sink, with Script
+// standing in for steps that should fail or hang on demand, and stepped
+// through one value at a time. Stages that wait on time can be driven by a
+// FakeClock instead of sleeping, see pipeline.WithClock. Fuzz feeds a
+// pipeline random values, cancellations and failures under go test -fuzz,
+// RunGolden pins a stage's output over a fixture down in a golden file and
+// RunRecorded re-drives a step on the calls pipeline.RecordStep recorded.
+package pipelinetest
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// timeout is how long a helper waits for a stage before failing the test,
+// a stage that takes longer is assumed to be stuck.
+const timeout = 10 * time.Second
+
+// RunStage runs fn as a step over inputs and returns every result and error
+// it produced. The step's output is ordered, see pipeline.WithOrderedOutput,
+// so the results come back in the order of their inputs whatever opts say
+// about concurrency. The test fails if the step hasn't finished within ten
+// seconds.
+func RunStage[In any, Out any](t testing.TB, fn func(In) (Out, error), inputs []In, opts ...pipeline.StepOption) ([]Out, []error) {
+	t.Helper()
+
+	return Run(t, context.Background(), pipeline.NewStage(fn, stageOptions(opts)...), inputs)
+}
+
+// RunStageCtx is RunStage for context-aware transforms, see pipeline.StepCtx.
+func RunStageCtx[In any, Out any](t testing.TB, fn func(context.Context, In) (Out, error), inputs []In, opts ...pipeline.StepOption) ([]Out, []error) {
+	t.Helper()
+
+	return Run(t, context.Background(), pipeline.NewStageCtx(fn, stageOptions(opts)...), inputs)
+}
+
+// RunStep runs fn as a step over inputs and returns what became of each
+// input at the same index: out[i] is the result of inputs[i] and errs[i] the
+// error it failed with instead, if any. The step's output is ordered and
+// unbuffered whatever opts say, so results and errors arrive in input order
+// and can be paired up. The test fails if the step emitted more or fewer
+// results than it was given inputs, as it does for an ErrorClassifier that
+// skips values, a dropping BackpressurePolicy or WithBudget running out, or
+// if it hasn't finished within ten seconds.
+func RunStep[In any, Out any](t testing.TB, fn func(In) (Out, error), inputs []In, opts ...pipeline.StepOption) ([]Out, []error) {
+	t.Helper()
+
+	opts = append(stageOptions(opts), pipeline.WithBuffer(0), pipeline.WithBackpressure(pipeline.Block))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values, failures := pipeline.Step(ctx, pipeline.FromSlice(ctx, inputs), fn, opts...)
+
+	out := make([]Out, 0, len(inputs))
+	errs := make([]error, 0, len(inputs))
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	var zero Out
+	for values != nil || failures != nil {
+		select {
+		case <-deadline.C:
+			t.Fatalf("pipelinetest: step still running after %s, handled %d of %d inputs so far", timeout, len(out), len(inputs))
+		case v, ok := <-values:
+			if !ok {
+				values = nil
+				continue
+			}
+			out = append(out, v)
+			errs = append(errs, nil)
+		case err, ok := <-failures:
+			if !ok {
+				failures = nil
+				continue
+			}
+			out = append(out, zero)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(out) != len(inputs) {
+		t.Fatalf("pipelinetest: step emitted %d results for %d inputs", len(out), len(inputs))
+	}
+	return out, errs
+}
+
+func stageOptions(opts []pipeline.StepOption) []pipeline.StepOption {
+	return append([]pipeline.StepOption{pipeline.WithOrderedOutput()}, opts...)
+}
+
+// Run starts stage with ctx, feeds it inputs and returns everything it
+// emitted, in the order it was emitted. Use it for composed stages, or to
+// pass a context carrying a FakeClock. The test fails if the stage hasn't
+// closed its channels within ten seconds.
+func Run[In any, Out any](t testing.TB, ctx context.Context, stage pipeline.Stage[In, Out], inputs []In) ([]Out, []error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	values, errs := stage(ctx, pipeline.FromSlice(ctx, inputs))
+
+	var out []Out
+	var failures []error
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for values != nil || errs != nil {
+		select {
+		case <-deadline.C:
+			t.Fatalf("pipelinetest: stage still running after %s, got %d results and %d errors so far", timeout, len(out), len(failures))
+		case v, ok := <-values:
+			if !ok {
+				values = nil
+				continue
+			}
+			out = append(out, v)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			failures = append(failures, err)
+		}
+	}
+
+	return out, failures
+}
+
+// Collect reads in until it is closed and returns what it received. The test
+// fails if in is still open after ten seconds.
+func Collect[T any](t testing.TB, in <-chan T) []T {
+	t.Helper()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	var out []T
+	for {
+		select {
+		case <-deadline.C:
+			t.Fatalf("pipelinetest: channel still open after %s, received %d values so far", timeout, len(out))
+		case v, ok := <-in:
+			if !ok {
+				return out
+			}
+			out = append(out, v)
+		}
+	}
+}
+
+// Receive returns the next value from in, failing the test if in is closed
+// or nothing arrives within ten seconds. It is for stepping through a
+// stage's output while moving a FakeClock along.
+func Receive[T any](t testing.TB, in <-chan T) T {
+	t.Helper()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	select {
+	case <-deadline.C:
+		t.Fatalf("pipelinetest: nothing received after %s", timeout)
+	case v, ok := <-in:
+		if !ok {
+			t.Fatalf("pipelinetest: channel closed")
+		}
+		return v
+	}
+	panic("unreachable")
+}
+
+// RunRecorded runs fn as a step over the values a step was given in the
+// recording at path, made with pipeline.RecordStep in production, to
+// reproduce a bug locally on the exact same data. Like RunStep it returns
+// what became of each value at the same index, next to the recorded call,
+// so a fix can be checked against what the step did back then:
+//
+//	calls, out, errs := pipelinetest.RunRecorded(t, "testdata/enrich.jsonl", codec, codec, enrich)
+//	for i, call := range calls {
+//		if call.Err != "" && errs[i] != nil {
+//			t.Errorf("%v still fails: %v", call.In, errs[i])
+//		}
+//	}
+//
+// The test fails if the recording can't be read.
+func RunRecorded[In any, Out any](t testing.TB, path string, in pipeline.Codec[In], out pipeline.Codec[Out], fn func(In) (Out, error), opts ...pipeline.StepOption) ([]pipeline.Call[In, Out], []Out, []error) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("pipelinetest: %v", err)
+	}
+	defer f.Close()
+	calls, err := pipeline.ReadCalls(f, in, out)
+	if err != nil {
+		t.Fatalf("pipelinetest: %s: %v", path, err)
+	}
+
+	inputs := make([]In, len(calls))
+	for i, call := range calls {
+		inputs[i] = call.In
+	}
+	results, errs := RunStep(t, fn, inputs, opts...)
+	return calls, results, errs
+}
@@ -0,0 +1,186 @@
+package pipelinetest_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// recorder is a testing.TB catching the failure of a helper, which must be
+// called from a goroutine of its own, see fails.
+type recorder struct {
+	testing.TB
+	failure string
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.failure = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// fails runs helper with a recorder and returns what it failed with, "" if
+// it didn't.
+func fails(t *testing.T, helper func(testing.TB)) string {
+	r := &recorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		helper(r)
+	}()
+	<-done
+	return r.failure
+}
+
+var errOdd = errors.New("odd")
+
+// halveEven halves even numbers and fails on odd ones, the higher the number
+// the faster.
+func halveEven(v int) (int, error) {
+	time.Sleep(time.Duration(10-v) * time.Millisecond)
+	if v%2 != 0 {
+		return 0, errOdd
+	}
+	return v / 2, nil
+}
+
+func TestRunStep(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	tests := []struct {
+		name string
+		opts []pipeline.StepOption
+	}{
+		{name: "default"},
+		{name: "concurrent", opts: []pipeline.StepOption{pipeline.WithConcurrency(8)}},
+		{name: "buffered", opts: []pipeline.StepOption{pipeline.WithConcurrency(8), pipeline.WithBuffer(4)}},
+		{name: "worker pool", opts: []pipeline.StepOption{pipeline.WithConcurrency(3), pipeline.WithWorkerPool()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+			out, errs := pipelinetest.RunStep(t, halveEven, inputs, tt.opts...)
+
+			if len(out) != len(inputs) || len(errs) != len(inputs) {
+				t.Fatalf("got %d results and %d errors for %d inputs", len(out), len(errs), len(inputs))
+			}
+			for i, v := range inputs {
+				var stageErr *pipeline.StageError
+				switch {
+				case v%2 != 0:
+					if !errors.Is(errs[i], errOdd) || !errors.As(errs[i], &stageErr) || stageErr.Input != v || out[i] != 0 {
+						t.Errorf("input %d: got %v, %v, want it to fail", v, out[i], errs[i])
+					}
+				case errs[i] != nil || out[i] != v/2:
+					t.Errorf("input %d: got %v, %v, want %d", v, out[i], errs[i], v/2)
+				}
+			}
+		})
+	}
+}
+
+func TestRunStepMismatch(t *testing.T) {
+	skipOdd := pipeline.WithErrorClassifier(func(err error) pipeline.ErrorClass {
+		return pipeline.ErrorSkip
+	})
+
+	failure := fails(t, func(t testing.TB) {
+		pipelinetest.RunStep(t, halveEven, []int{1, 2, 3}, skipOdd)
+	})
+	if !strings.Contains(failure, "1 results for 3 inputs") {
+		t.Errorf("got failure %q, want the skipped values pointed out", failure)
+	}
+}
+
+func TestRunRecorded(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	path := filepath.Join(t.TempDir(), "halve.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := pipeline.JSONCodec[int]()
+	pipelinetest.RunStage(t, halveEven, []int{4, 3, 2}, pipeline.RecordStep(f, codec, codec))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fix takes odd numbers too
+	fixed := func(v int) (int, error) { return v / 2, nil }
+	calls, out, errs := pipelinetest.RunRecorded(t, path, codec, codec, fixed)
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+	for i, call := range calls {
+		switch {
+		case errs[i] != nil:
+			t.Errorf("%d: got %v, want it fixed", call.In, errs[i])
+		case call.Err == "" && out[i] != call.Out:
+			t.Errorf("%d: got %d, want %d as recorded", call.In, out[i], call.Out)
+		case call.Err != "" && call.In != 3:
+			t.Errorf("%d failed when recorded with %s, want only 3 to", call.In, call.Err)
+		}
+	}
+}
+
+func TestCollectReceive(t *testing.T) {
+	tests := []struct {
+		name string
+		// helper reads from a channel that has 1 and 2 sent on it, then
+		// closed
+		helper func(t testing.TB, in <-chan int) []int
+		want   []int
+		fails  string
+	}{
+		{
+			name:   "collected",
+			helper: func(t testing.TB, in <-chan int) []int { return pipelinetest.Collect(t, in) },
+			want:   []int{1, 2},
+		},
+		{
+			name: "received",
+			helper: func(t testing.TB, in <-chan int) []int {
+				first := pipelinetest.Receive(t, in)
+				return append([]int{first}, pipelinetest.Collect(t, in)...)
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "received past the end",
+			helper: func(t testing.TB, in <-chan int) []int {
+				pipelinetest.Collect(t, in)
+				return []int{pipelinetest.Receive(t, in)}
+			},
+			fails: "channel closed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make(chan int, 2)
+			in <- 1
+			in <- 2
+			close(in)
+
+			var got []int
+			failure := fails(t, func(t testing.TB) {
+				got = tt.helper(t, in)
+			})
+			if !strings.Contains(failure, tt.fails) || (tt.fails == "") != (failure == "") {
+				t.Errorf("failed with %q, want %q", failure, tt.fails)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package pipelinevault resolves the secrets of pipeline connectors from the
+// KV version 2 secrets engine of HashiCorp Vault, over its HTTP API:
+//
+//	secrets := pipelinevault.New("https://vault.internal:8200", os.Getenv("VAULT_TOKEN"))
+//	password := pipeline.NewSecret(secrets, "orders-db#password", 5*time.Minute)
+//
+// A secret is named by its path under the mount, "secret" unless WithMount
+// says otherwise, then a # and the key of its data to return, "value" if
+// there is none. Every resolution reads the latest version, so secrets
+// rotated in Vault are picked up once a pipeline.Secret's ttl is up.
+package pipelinevault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// Option configures a Provider.
+type Option func(*Provider)
+
+// WithMount sets the path the KV engine is mounted at, "secret" by default.
+func WithMount(mount string) Option {
+	return func(p *Provider) {
+		p.mount = strings.Trim(mount, "/")
+	}
+}
+
+// WithNamespace sets the Vault Enterprise namespace secrets are read from.
+func WithNamespace(ns string) Option {
+	return func(p *Provider) {
+		p.namespace = ns
+	}
+}
+
+// WithHTTPClient sets the client requests are made with,
+// http.DefaultClient by default.
+func WithHTTPClient(c *http.Client) Option {
+	return func(p *Provider) {
+		p.client = c
+	}
+}
+
+// Provider is a pipeline.SecretsProvider reading secrets from Vault.
+type Provider struct {
+	addr      string
+	token     string
+	mount     string
+	namespace string
+	client    *http.Client
+}
+
+var _ pipeline.SecretsProvider = (*Provider)(nil)
+
+// New returns a Provider reading from the Vault server at addr, such as
+// "https://vault.internal:8200", with token.
+func New(addr, token string, opts ...Option) *Provider {
+	p := &Provider{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		mount:  "secret",
+		client: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Secret implements pipeline.SecretsProvider.
+func (p *Provider) Secret(ctx context.Context, name string) (string, error) {
+	path, key, ok := strings.Cut(name, "#")
+	if !ok {
+		key = "value"
+	}
+
+	u := p.addr + "/v1/" + p.mount + "/data/" + (&url.URL{Path: strings.Trim(path, "/")}).EscapedPath()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("pipelinevault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("pipelinevault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", pipeline.ErrSecretNotFound, name)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("pipelinevault: reading %s: %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("pipelinevault: reading %s: %w", path, err)
+	}
+	v, ok := body.Data.Data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", pipeline.ErrSecretNotFound, name)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	// anything but a string is handed over as the JSON it was stored as
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("pipelinevault: reading %s: %w", path, err)
+	}
+	return string(data), nil
+}
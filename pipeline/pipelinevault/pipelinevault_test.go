@@ -0,0 +1,65 @@
+package pipelinevault_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinevault"
+)
+
+func TestSecret(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/orders-db":
+			w.Write([]byte(`{"data":{"data":{"password":"hunter2","value":"default","port":5432},"metadata":{"version":3}}}`))
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name     string
+		token    string
+		secret   string
+		want     string
+		notFound bool
+		wantErr  bool
+	}{
+		{name: "key", token: "token", secret: "orders-db#password", want: "hunter2"},
+		{name: "default key", token: "token", secret: "orders-db", want: "default"},
+		{name: "not a string", token: "token", secret: "orders-db#port", want: "5432"},
+		{name: "missing key", token: "token", secret: "orders-db#user", notFound: true},
+		{name: "missing path", token: "token", secret: "billing-db#password", notFound: true},
+		{name: "denied", token: "wrong", secret: "orders-db#password", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := pipelinevault.New(srv.URL+"/", tt.token, pipelinevault.WithMount("/kv/"), pipelinevault.WithNamespace("team"),
+				pipelinevault.WithHTTPClient(srv.Client()))
+
+			got, err := p.Secret(context.Background(), tt.secret)
+			switch {
+			case tt.notFound:
+				if !errors.Is(err, pipeline.ErrSecretNotFound) {
+					t.Errorf("Secret = %q, %v, want ErrSecretNotFound", got, err)
+				}
+			case tt.wantErr:
+				if err == nil || errors.Is(err, pipeline.ErrSecretNotFound) {
+					t.Errorf("Secret = %q, %v, want an error", got, err)
+				}
+			case got != tt.want || err != nil:
+				t.Errorf("Secret = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
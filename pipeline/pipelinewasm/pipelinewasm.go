@@ -0,0 +1,235 @@
+// Package pipelinewasm runs WebAssembly modules as the transforms of pipeline
+// steps, with github.com/tetratelabs/wazero, so logic users upload, or that
+// can't be trusted, runs in a pipeline without access to anything but the
+// value it is handed:
+//
+//	m, err := pipelinewasm.Compile(ctx, wasm, pipelinewasm.WithMemoryLimit(16))
+//	if err != nil {
+//		return err
+//	}
+//	defer m.Close(ctx)
+//
+//	fn := pipelinewasm.Transform(m, pipeline.JSONCodec[Order](), pipeline.JSONCodec[Order]())
+//	out, errs := pipeline.StepCtx(ctx, orders, fn, pipeline.WithConcurrency(4))
+//
+// A module is sandboxed: it may import nothing but the fail function below,
+// no WASI, so it has no clock, files or network, its memory is capped and
+// a call is abandoned once its context is done, however long the module
+// loops.
+//
+// The ABI between the step and the module passes every value as the bytes
+// a pipeline.Codec encodes it to. The module exports:
+//
+//	memory                                  its memory
+//	alloc(size i32) -> ptr i32              room for size bytes
+//	transform(ptr i32, size i32) -> i64     the result of the value at ptr
+//
+// For every value the step calls alloc for the room to write the value's
+// encoding to, then transform with where it wrote it, which returns where
+// the encoding of the result is in memory, its pointer in the high 32 bits
+// and its size in the low ones. The module may reuse its memory from one
+// value to the next. To fail a value instead, transform calls the function
+// it imports from the "pipeline" module
+//
+//	fail(ptr i32, size i32)
+//
+// with the error's message before returning. A trap fails the value too.
+package pipelinewasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// FailedError is the error a module failed a value with, calling fail.
+type FailedError struct {
+	Msg string
+}
+
+func (e *FailedError) Error() string {
+	return "pipelinewasm: module failed: " + e.Msg
+}
+
+// Option configures a Module.
+type Option func(*config)
+
+type config struct {
+	memoryPages uint32
+}
+
+// WithMemoryLimit caps the memory of every instance of the module at pages
+// pages of 64KiB, 16MiB by default.
+func WithMemoryLimit(pages uint32) Option {
+	return func(cfg *config) {
+		cfg.memoryPages = pages
+	}
+}
+
+// Module is a compiled WebAssembly module following the ABI of the package
+// documentation. It runs values in instances of its own, as many as are
+// called at once, so it is safe for concurrent use.
+type Module struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+
+	mu sync.Mutex
+	// idle are the instances not running a value
+	idle []api.Module
+}
+
+// call is the state of a value's call, for fail.
+type call struct {
+	failed *FailedError
+}
+
+type callKey struct{}
+
+// Compile compiles wasm, a binary WebAssembly module, checking it exports
+// what the ABI needs.
+func Compile(ctx context.Context, wasm []byte, opts ...Option) (*Module, error) {
+	cfg := config{memoryPages: 256}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(cfg.memoryPages).
+		WithCloseOnContextDone(true))
+	_, err := runtime.NewHostModuleBuilder("pipeline").
+		NewFunctionBuilder().WithFunc(fail).Export("fail").
+		Instantiate(ctx)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("pipelinewasm: %w", err)
+	}
+
+	compiled, err := runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("pipelinewasm: compiling: %w", err)
+	}
+	for _, name := range []string{"alloc", "transform"} {
+		if _, ok := compiled.ExportedFunctions()[name]; !ok {
+			runtime.Close(ctx)
+			return nil, fmt.Errorf("pipelinewasm: module doesn't export %s", name)
+		}
+	}
+	if len(compiled.ExportedMemories()) == 0 {
+		runtime.Close(ctx)
+		return nil, errors.New("pipelinewasm: module doesn't export its memory")
+	}
+
+	return &Module{runtime: runtime, compiled: compiled}, nil
+}
+
+// fail is the function modules import to fail a value.
+func fail(ctx context.Context, m api.Module, ptr, size uint32) {
+	c, ok := ctx.Value(callKey{}).(*call)
+	if !ok {
+		return
+	}
+	msg, _ := m.Memory().Read(ptr, size)
+	c.failed = &FailedError{Msg: string(msg)}
+}
+
+// Close frees the module and its instances, to be called once no more
+// values are run.
+func (m *Module) Close(ctx context.Context) error {
+	return m.runtime.Close(ctx)
+}
+
+// Run runs the module on data, the encoding of a value, returning the
+// encoding of the result.
+func (m *Module) Run(ctx context.Context, data []byte) ([]byte, error) {
+	inst, err := m.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &call{}
+	result, err := run(context.WithValue(ctx, callKey{}, c), inst, data)
+	if err != nil {
+		// a trap may have left the instance in any state
+		inst.Close(context.WithoutCancel(ctx))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("pipelinewasm: %w", err)
+	}
+
+	m.mu.Lock()
+	m.idle = append(m.idle, inst)
+	m.mu.Unlock()
+	if c.failed != nil {
+		return nil, c.failed
+	}
+	return result, nil
+}
+
+// instance returns an idle instance, or a new one if there is none.
+func (m *Module) instance(ctx context.Context) (api.Module, error) {
+	m.mu.Lock()
+	if n := len(m.idle); n > 0 {
+		inst := m.idle[n-1]
+		m.idle = m.idle[:n-1]
+		m.mu.Unlock()
+		return inst, nil
+	}
+	m.mu.Unlock()
+
+	// instances are anonymous so there can be any number of them
+	inst, err := m.runtime.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return nil, fmt.Errorf("pipelinewasm: instantiating: %w", err)
+	}
+	return inst, nil
+}
+
+func run(ctx context.Context, inst api.Module, data []byte) ([]byte, error) {
+	res, err := inst.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !inst.Memory().Write(ptr, data) {
+		return nil, fmt.Errorf("alloc returned %d, out of memory for %d bytes", ptr, len(data))
+	}
+
+	res, err = inst.ExportedFunction("transform").Call(ctx, uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	ptr, size := uint32(res[0]>>32), uint32(res[0])
+	result, ok := inst.Memory().Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("transform returned %d bytes at %d, out of memory", size, ptr)
+	}
+	// result is a view of the instance's memory, which the next value
+	// overwrites
+	return append([]byte(nil), result...), nil
+}
+
+// Transform returns a func for pipeline.StepCtx, or pipeline.AddStage and
+// the like, running m on every value, encoded with in, and decoding the
+// result with out. A value m fails is failed with a *FailedError.
+func Transform[T any, R any](m *Module, in pipeline.Codec[T], out pipeline.Codec[R]) func(context.Context, T) (R, error) {
+	return func(ctx context.Context, v T) (R, error) {
+		var zero R
+		data, err := in.Encode(v)
+		if err != nil {
+			return zero, err
+		}
+		result, err := m.Run(ctx, data)
+		if err != nil {
+			return zero, err
+		}
+		return out.Decode(result)
+	}
+}
@@ -0,0 +1,128 @@
+package pipelinewasm_test
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinewasm"
+)
+
+// upper is testdata/upper.wat assembled.
+//
+//go:embed testdata/upper.wasm
+var upper []byte
+
+func compile(t *testing.T) *pipelinewasm.Module {
+	t.Helper()
+
+	m, err := pipelinewasm.Compile(context.Background(), upper, pipelinewasm.WithMemoryLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close(context.Background()) })
+	return m
+}
+
+func TestTransform(t *testing.T) {
+	m := compile(t)
+	fn := pipelinewasm.Transform(m, pipeline.JSONCodec[string](), pipeline.JSONCodec[string]())
+
+	tests := []struct {
+		name    string
+		value   string
+		timeout time.Duration
+		want    string
+		wantErr func(err error) bool
+	}{
+		{name: "transformed", value: "abc", want: "ABC"},
+		{name: "failed", value: "a!b", wantErr: func(err error) bool {
+			var failed *pipelinewasm.FailedError
+			return errors.As(err, &failed) && strings.Contains(failed.Msg, "!")
+		}},
+		{name: "trap", value: "#", wantErr: func(err error) bool {
+			var failed *pipelinewasm.FailedError
+			return err != nil && !errors.As(err, &failed)
+		}},
+		{name: "endless loop", value: "~", timeout: 50 * time.Millisecond, wantErr: func(err error) bool {
+			return errors.Is(err, context.DeadlineExceeded)
+		}},
+		{name: "too big for its memory", value: strings.Repeat("a", 1<<16), wantErr: func(err error) bool {
+			return err != nil && strings.Contains(err.Error(), "out of memory")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			got, err := fn(ctx, tt.value)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("got %q, %v, want an error", got, err)
+				}
+			} else if got != tt.want || err != nil {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+
+			// whatever happened to the last value, the next one runs
+			if got, err := fn(context.Background(), "next"); got != "NEXT" || err != nil {
+				t.Errorf("next value got %q, %v, want NEXT", got, err)
+			}
+		})
+	}
+}
+
+func TestTransformConcurrently(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	m := compile(t)
+
+	values := make([]string, 100)
+	want := make([]string, len(values))
+	for i := range values {
+		values[i] = strings.Repeat("x", i)
+		want[i] = strings.Repeat("X", i)
+	}
+	fn := pipelinewasm.Transform(m, pipeline.JSONCodec[string](), pipeline.JSONCodec[string]())
+
+	got, errs := pipelinetest.RunStageCtx(t, fn, values, pipeline.WithConcurrency(8))
+	if len(errs) > 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		wasm    []byte
+		wantErr string
+	}{
+		{name: "not wasm", wasm: []byte("hello"), wantErr: "compiling"},
+		{name: "no exports", wasm: []byte("\x00asm\x01\x00\x00\x00"), wantErr: "doesn't export alloc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pipelinewasm.Compile(context.Background(), tt.wasm)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Compile = %v, want an error with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
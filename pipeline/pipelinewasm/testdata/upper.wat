@@ -0,0 +1,41 @@
+;; upper.wasm, the module the tests run, assembled from this. It upper cases
+;; the ASCII letters of a value, fails values with a "!" in them, traps on
+;; a "#" and loops forever on a "~".
+(module
+  (import "pipeline" "fail" (func $fail (param i32 i32)))
+  (memory (export "memory") 1)
+
+  ;; every value is written at 1024
+  (func (export "alloc") (param $size i32) (result i32)
+    i32.const 1024)
+
+  (func (export "transform") (param $ptr i32) (param $size i32) (result i64)
+    (local $i i32) (local $b i32)
+    block $done
+      loop $next
+        (br_if $done (i32.ge_u (local.get $i) (local.get $size)))
+        (local.set $b (i32.load8_u (i32.add (local.get $ptr) (local.get $i))))
+
+        (if (i32.eq (local.get $b) (i32.const 33)) ;; !
+          (then
+            (call $fail (local.get $ptr) (local.get $size))
+            (return (i64.const 0))))
+        (if (i32.eq (local.get $b) (i32.const 35)) ;; #
+          (then unreachable))
+        (if (i32.eq (local.get $b) (i32.const 126)) ;; ~
+          (then (loop $forever (br $forever))))
+
+        (if (i32.le_u (i32.sub (local.get $b) (i32.const 97)) (i32.const 25)) ;; a-z
+          (then
+            (i32.store8 (i32.add (local.get $ptr) (local.get $i))
+              (i32.sub (local.get $b) (i32.const 32)))))
+
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        br $next
+      end
+    end
+
+    ;; the value is upper cased where it is
+    (i64.or
+      (i64.shl (i64.extend_i32_u (local.get $ptr)) (i64.const 32))
+      (i64.extend_i32_u (local.get $size)))))
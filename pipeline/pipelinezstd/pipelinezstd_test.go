@@ -0,0 +1,90 @@
+package pipelinezstd_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinezstd"
+)
+
+type order struct {
+	ID   int
+	Note string
+}
+
+func TestCodec(t *testing.T) {
+	codec := pipelinezstd.Codec(pipeline.JSONCodec[order]())
+
+	tests := []struct {
+		name string
+		v    order
+	}{
+		{name: "empty", v: order{}},
+		{name: "small", v: order{ID: 1, Note: "x"}},
+		{name: "compressible", v: order{ID: 2, Note: strings.Repeat("abc", 1000)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := codec.Encode(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := codec.Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.v {
+				t.Errorf("round trip gave %+v, want %+v", got, tt.v)
+			}
+		})
+	}
+}
+
+func TestCodecCompresses(t *testing.T) {
+	codec := pipelinezstd.Codec(pipeline.JSONCodec[order]())
+	v := order{Note: strings.Repeat("abc", 1000)}
+
+	data, err := codec.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 200 {
+		t.Errorf("encoded to %d bytes, want it compressed", len(data))
+	}
+}
+
+func TestCodecCorrupt(t *testing.T) {
+	codec := pipelinezstd.Codec(pipeline.JSONCodec[order]())
+
+	if _, err := codec.Decode(bytes.Repeat([]byte{0xff}, 16)); err == nil {
+		t.Error("decoding garbage succeeded")
+	}
+}
+
+func TestCodecConcurrent(t *testing.T) {
+	codec := pipelinezstd.Codec(pipeline.JSONCodec[order]())
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				v := order{ID: i*100 + j, Note: strings.Repeat("n", j)}
+				data, err := codec.Encode(v)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got, err := codec.Decode(data); err != nil || got != v {
+					t.Errorf("round trip gave %+v, %v, want %+v", got, err, v)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
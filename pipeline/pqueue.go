@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"container/heap"
+	"context"
+	"strconv"
+)
+
+// OverflowPolicy decides what PriorityQueue does with a value arriving while
+// its buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops reading the input until there is room again.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropLowest admits the value and drops the one with the lowest
+	// priority, which may be the value itself. Among equal priorities the
+	// most recent arrival is dropped. Dropped values are handed to the hook
+	// of WithDropHook as DroppedOverflow.
+	OverflowDropLowest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropLowest:
+		return "drop lowest"
+	default:
+		return "OverflowPolicy(" + strconv.Itoa(int(p)) + ")"
+	}
+}
+
+// PriorityQueue buffers up to capacity values from in and always emits the
+// one with the highest priority(v) first, so urgent values jump ahead of the
+// bulk backfill traffic sharing the same pipeline. Values of equal priority
+// come out in the order they arrived. What happens when the buffer is full is
+// up to overflow.
+//
+// Reordering only happens between values that are waiting together, so put
+// the queue in front of the slow part of the pipeline where a backlog builds
+// up. The output is closed once in is closed and the buffer has been emitted,
+// or once ctx is done.
+func PriorityQueue[T any](ctx context.Context, in <-chan T, priority func(T) int, capacity int, overflow OverflowPolicy) <-chan T {
+	outChannel := make(chan T)
+	capacity = max(capacity, 1)
+
+	go func() {
+		defer close(outChannel)
+
+		drop := dropHook(ctx)
+		queue := &priorityHeap[T]{}
+		var seq uint64
+		for in != nil || queue.Len() > 0 {
+			// a nil channel is never ready, so only read while there is room
+			// or room can be made, and only send while there is something
+			recv := in
+			if queue.Len() >= capacity && overflow == OverflowBlock {
+				recv = nil
+			}
+			var send chan<- T
+			var top T
+			if queue.Len() > 0 {
+				send = outChannel
+				top = (*queue)[0].value
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				heap.Push(queue, prioritized[T]{priority: priority(v), seq: seq, value: v})
+				seq++
+				if queue.Len() > capacity {
+					dropped := heap.Remove(queue, queue.lowest()).(prioritized[T])
+					drop(dropped.value, DroppedOverflow)
+				}
+			case send <- top:
+				heap.Pop(queue)
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+type prioritized[T any] struct {
+	priority int
+	seq      uint64
+	value    T
+}
+
+// priorityHeap pops the highest priority first, the earliest arrival among
+// equals.
+type priorityHeap[T any] []prioritized[T]
+
+func (h priorityHeap[T]) Len() int { return len(h) }
+func (h priorityHeap[T]) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h priorityHeap[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *priorityHeap[T]) Push(x any)   { *h = append(*h, x.(prioritized[T])) }
+func (h *priorityHeap[T]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// lowest returns the index of the value that would be popped last.
+func (h priorityHeap[T]) lowest() int {
+	low := 0
+	for i := range h {
+		if h.Less(low, i) {
+			low = i
+		}
+	}
+	return low
+}
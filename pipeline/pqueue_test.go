@@ -0,0 +1,60 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+type job struct {
+	name     string
+	priority int
+}
+
+func TestPriorityQueue(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	in := make(chan job)
+	out := pipeline.PriorityQueue(context.Background(), in, func(j job) int { return j.priority }, 10, pipeline.OverflowBlock)
+
+	// nothing is read from out yet, so every job waits in the queue together
+	for _, j := range []job{{"backfill 1", 0}, {"urgent 1", 9}, {"backfill 2", 0}, {"normal", 5}, {"urgent 2", 9}} {
+		in <- j
+	}
+	close(in)
+
+	var got []string
+	for _, j := range pipelinetest.Collect(t, out) {
+		got = append(got, j.name)
+	}
+	if want := []string{"urgent 1", "urgent 2", "normal", "backfill 1", "backfill 2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPriorityQueueBlocks(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	in := make(chan int)
+	defer close(in)
+	out := pipeline.PriorityQueue(context.Background(), in, func(v int) int { return v }, 1, pipeline.OverflowBlock)
+
+	in <- 1
+	select {
+	case in <- 2:
+		t.Fatal("read past a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if got := pipelinetest.Receive(t, out); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	in <- 2
+	if got := pipelinetest.Receive(t, out); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import "context"
+
+// Prioritize merges a high-priority and a normal lane into one channel that
+// feeds a single step. Whenever both lanes have items waiting, the high lane
+// wins, so urgent reprocessing or control items overtake bulk traffic.
+//
+// To keep a constant stream of urgent items from starving the normal lane
+// forever, after maxBurst high-priority items in a row one waiting normal item
+// is let through. A maxBurst of zero or less disables starvation protection.
+// The output is closed once both lanes are closed or ctx is done.
+func Prioritize[T any](ctx context.Context, high <-chan T, normal <-chan T, maxBurst int) <-chan T {
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		burst := 0
+
+		// next picks the item to forward, reporting false once both lanes are
+		// closed or ctx is done. A nil channel is never ready, so closed lanes
+		// drop out of every select below.
+		next := func() (T, bool) {
+			for high != nil || normal != nil {
+				if maxBurst > 0 && burst >= maxBurst {
+					// give the normal lane a turn if it has something waiting
+					select {
+					case v, ok := <-normal:
+						if ok {
+							burst = 0
+							return v, true
+						}
+						normal = nil
+						continue
+					default:
+					}
+				}
+
+				// prefer the high lane whenever it is ready
+				select {
+				case v, ok := <-high:
+					if ok {
+						burst++
+						return v, true
+					}
+					high = nil
+					continue
+				default:
+				}
+
+				select {
+				case <-ctx.Done():
+					var zero T
+					return zero, false
+				case v, ok := <-high:
+					if ok {
+						burst++
+						return v, true
+					}
+					high = nil
+				case v, ok := <-normal:
+					if ok {
+						burst = 0
+						return v, true
+					}
+					normal = nil
+				}
+			}
+
+			var zero T
+			return zero, false
+		}
+
+		for {
+			v, ok := next()
+			if !ok {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case outChannel <- v:
+			}
+		}
+	}()
+
+	return outChannel
+}
@@ -0,0 +1,73 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestPrioritize(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	tests := []struct {
+		name         string
+		maxBurst     int
+		high, normal []int
+		want         []int
+	}{
+		{
+			name:     "high lane first",
+			maxBurst: 0,
+			high:     []int{1, 2, 3, 4, 5},
+			normal:   []int{10, 20},
+			want:     []int{1, 2, 3, 4, 5, 10, 20},
+		},
+		{
+			name:     "normal item after each burst",
+			maxBurst: 2,
+			high:     []int{1, 2, 3, 4, 5},
+			normal:   []int{10, 20},
+			want:     []int{1, 2, 10, 3, 4, 20, 5},
+		},
+		{
+			name:     "empty high lane",
+			maxBurst: 2,
+			normal:   []int{10, 20, 30},
+			want:     []int{10, 20, 30},
+		},
+		{
+			name:     "empty normal lane",
+			maxBurst: 1,
+			high:     []int{1, 2, 3},
+			want:     []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pipelinetest.Collect(t, pipeline.Prioritize(context.Background(), waiting(tt.high...), waiting(tt.normal...), tt.maxBurst))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrioritizeStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	high, normal := make(chan int), make(chan int)
+	defer close(high)
+	defer close(normal)
+
+	out := pipeline.Prioritize(ctx, high, normal, 1)
+	assertNothing(t, out)
+	cancel()
+	if got := pipelinetest.Collect(t, out); len(got) != 0 {
+		t.Errorf("got %v after cancelling, want nothing", got)
+	}
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"context"
+	"iter"
+)
+
+// Producer is the source of a pipeline. It emits each of values in order on
+// the returned channel and closes it once they have all been sent or ctx is
+// done. It is FromSlice with the signature used in the article.
+func Producer[T any](ctx context.Context, values []T) (<-chan T, error) {
+	return FromSlice(ctx, values), nil
+}
+
+// FromSlice emits each of values in order and closes the returned channel
+// once they have all been sent or ctx is done.
+func FromSlice[T any](ctx context.Context, values []T) <-chan T {
+	outChannel := make(chan T)
+
+	// wrapping in a goroutine prevents deadlock
+	go func() {
+		// good strat here is whoever opens the channel should be in charge of closing
+		// no risk of sending to a closed channel = panic!
+		defer close(outChannel)
+
+		for _, v := range values {
+			// tries to receive value from ctx if not done then moves to next branch
+			// we use another case instead of 'default' statement because we'd be stuck blocking outChannel
+			// 2nd case statement allows us to switch between trying the 2 cases.
+			select {
+			case <-ctx.Done():
+				return
+			case outChannel <- v:
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// FromSeq emits the values yielded by seq and closes the returned channel
+// once seq is exhausted or ctx is done, in which case seq is stopped.
+func FromSeq[T any](ctx context.Context, seq iter.Seq[T]) <-chan T {
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		for v := range seq {
+			select {
+			case <-ctx.Done():
+				return
+			case outChannel <- v:
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// KeyValue is a map entry emitted by FromMap.
+type KeyValue[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// FromMap emits every entry of m, in no particular order, and closes the
+// returned channel once they have all been sent or ctx is done.
+func FromMap[K comparable, V any](ctx context.Context, m map[K]V) <-chan KeyValue[K, V] {
+	return FromSeq(ctx, func(yield func(KeyValue[K, V]) bool) {
+		for k, v := range m {
+			if !yield(KeyValue[K, V]{Key: k, Value: v}) {
+				return
+			}
+		}
+	})
+}
+
+// FromFunc emits values produced by calling fn until it reports ok == false
+// or fails. A failure is sent on the returned error channel, after which
+// both channels are closed, as they are once ctx is done.
+func FromFunc[T any](ctx context.Context, fn func() (v T, ok bool, err error)) (<-chan T, <-chan error) {
+	outChannel := make(chan T)
+	errorChannel := make(chan error)
+
+	go func() {
+		defer close(outChannel)
+		defer close(errorChannel)
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			v, ok, err := fn()
+			if err != nil {
+				select {
+				case <-ctx.Done():
+				case errorChannel <- err:
+				}
+				return
+			}
+			if !ok {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case outChannel <- v:
+			}
+		}
+	}()
+
+	return outChannel, errorChannel
+}
@@ -0,0 +1,128 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestFromSeq(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.FromSeq(context.Background(), slices.Values([]int{1, 2, 3})))
+	if !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("got %v, want [1 2 3]", got)
+	}
+}
+
+// TestFromSeqStops checks cancelling the context stops the sequence.
+func TestFromSeqStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	stopped := make(chan struct{})
+	naturals := func(yield func(int) bool) {
+		defer close(stopped)
+		for i := 1; yield(i); i++ {
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	values := pipeline.FromSeq(ctx, naturals)
+	if got := pipelinetest.Receive(t, values); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	cancel()
+	pipelinetest.Collect(t, values)
+	select {
+	case <-stopped:
+	default:
+		t.Error("sequence still running after the channel closed")
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.FromMap(context.Background(), map[string]int{"a": 1, "b": 2}))
+	slices.SortFunc(got, func(a, b pipeline.KeyValue[string, int]) int { return a.Value - b.Value })
+	if want := []pipeline.KeyValue[string, int]{{Key: "a", Value: 1}, {Key: "b", Value: 2}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFromMapStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	m := make(map[int]int)
+	for i := range 100 {
+		m[i] = i
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entries := pipeline.FromMap(ctx, m)
+	pipelinetest.Receive(t, entries)
+	cancel()
+	if got := pipelinetest.Collect(t, entries); len(got) == len(m)-1 {
+		t.Errorf("got every entry after cancelling")
+	}
+}
+
+func TestFromFunc(t *testing.T) {
+	// fn counts up to 3, then stops or fails with failWith
+	tests := []struct {
+		name     string
+		failWith error
+	}{
+		{name: "exhausted"},
+		{name: "failed", failWith: errBad},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			n := 0
+			values, errs := pipeline.FromFunc(context.Background(), func() (int, bool, error) {
+				if n == 3 {
+					return 0, false, tt.failWith
+				}
+				n++
+				return n, true, nil
+			})
+			got, failures := collectBoth(t, values, errs)
+
+			if !slices.Equal(got, []int{1, 2, 3}) {
+				t.Errorf("got %v, want [1 2 3]", got)
+			}
+			switch {
+			case tt.failWith == nil && len(failures) > 0:
+				t.Errorf("got errors %v, want none", failures)
+			case tt.failWith != nil && (len(failures) != 1 || !errors.Is(failures[0], tt.failWith)):
+				t.Errorf("got errors %v, want %v", failures, tt.failWith)
+			}
+		})
+	}
+}
+
+// TestFromFuncStops checks fn isn't called again once the context is done.
+func TestFromFuncStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	values, errs := pipeline.FromFunc(ctx, func() (int, bool, error) {
+		calls++
+		if calls == 2 {
+			cancel()
+		}
+		return calls, true, nil
+	})
+	got, failures := collectBoth(t, values, errs)
+
+	if len(got) > 2 || calls != 2 || len(failures) != 0 {
+		t.Errorf("got %v and errors %v after %d calls, want fn called twice", got, failures, calls)
+	}
+}
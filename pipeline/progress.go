@@ -0,0 +1,218 @@
+package pipeline
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is a snapshot of a running pipeline, see Pipeline.Progress.
+type Progress struct {
+	// Produced is how many values the source has emitted so far.
+	Produced int64
+	// Done is how many values the sink has handled, Failed how many failed
+	// in a step or in the sink.
+	Done   int64
+	Failed int64
+	// Skipped is how many values were skipped, see ErrorSkip.
+	Skipped int64
+	// Total is the number of values set with Pipeline.Total, 0 if unknown.
+	Total int64
+	// Stages reports every step, in order.
+	Stages  []StageProgress
+	Elapsed time.Duration
+	// ETA is how much longer the run should take at the rate values have
+	// been finished so far, 0 if Total is unknown or nothing has finished
+	// yet.
+	ETA time.Duration
+}
+
+// StageProgress is how many values a step has processed, how many failed
+// and were skipped in it and how many times it retried one, its name is the
+// one set with WithName or "step N". InFlight is how many it is working on
+// and Queued how many were waiting in its input the last time it read one.
+type StageProgress struct {
+	Name      string
+	Processed int64
+	Failed    int64
+	Skipped   int64
+	Retried   int64
+	InFlight  int64
+	Queued    int64
+}
+
+// Progress calls report with a snapshot every interval while the pipeline
+// runs, and once more with the final one when Run returns, so CLIs can render
+// progress bars for long batch runs. report is called from the goroutine
+// running the pipeline and should return quickly.
+func (p *Pipeline[T]) Progress(interval time.Duration, report func(Progress)) *Pipeline[T] {
+	p.progressEvery = interval
+	p.progress = report
+	return p
+}
+
+// Total tells Progress how many values the source will emit, so it can
+// estimate when the run finishes.
+func (p *Pipeline[T]) Total(n int64) *Pipeline[T] {
+	p.total = n
+	return p
+}
+
+// progressCounter counts what a run has done for its Progress reports.
+type progressCounter struct {
+	clock    Clock
+	start    time.Time
+	total    int64
+	produced atomic.Int64
+	// done and failed mirror the run's errorTracker, which only the loop
+	// of Run may touch, for snapshots taken elsewhere
+	done    atomic.Int64
+	failed  atomic.Int64
+	skipped atomic.Int64
+	names   []string
+	stages  []*stageCounts
+}
+
+type stageCounts struct {
+	processed atomic.Int64
+	failed    atomic.Int64
+	skipped   atomic.Int64
+	retried   atomic.Int64
+	queued    atomic.Int64
+	// latencies counts the values Latency was reported for, taking
+	// latency in total and at most, in nanoseconds
+	latencies  atomic.Int64
+	latency    atomic.Int64
+	maxLatency atomic.Int64
+
+	// inFlight and active, the last time a value left the step or it picked
+	// one up while idle in Unix nanoseconds, are for the Watchdog
+	inFlight atomic.Int64
+	active   atomic.Int64
+	// consecutive is how many values have failed since the step last
+	// processed one, for Alerts
+	consecutive atomic.Int64
+	clock       Clock
+	logger      *slog.Logger
+}
+
+// touch records the step as active now.
+func (c *stageCounts) touch() {
+	c.active.Store(c.clock.Now().UnixNano())
+}
+
+// stage returns the counts of the next step, named name.
+func (c *progressCounter) stage(name string, logger *slog.Logger) *stageCounts {
+	counts := &stageCounts{clock: c.clock, logger: logger}
+	c.names = append(c.names, name)
+	c.stages = append(c.stages, counts)
+	return counts
+}
+
+// update copies the counts of tracker, it must be called from the loop of
+// Run.
+func (c *progressCounter) update(tracker *errorTracker) {
+	c.done.Store(int64(tracker.successes))
+	c.failed.Store(int64(tracker.failures))
+}
+
+// snapshot is safe to call from any goroutine.
+func (c *progressCounter) snapshot() Progress {
+	p := Progress{
+		Produced: c.produced.Load(),
+		Done:     c.done.Load(),
+		Failed:   c.failed.Load(),
+		Skipped:  c.skipped.Load(),
+		Total:    c.total,
+		Stages:   make([]StageProgress, len(c.stages)),
+		Elapsed:  c.clock.Now().Sub(c.start),
+	}
+	for i, counts := range c.stages {
+		p.Stages[i] = StageProgress{
+			Name:      c.names[i],
+			Processed: counts.processed.Load(),
+			Failed:    counts.failed.Load(),
+			Skipped:   counts.skipped.Load(),
+			Retried:   counts.retried.Load(),
+			InFlight:  counts.inFlight.Load(),
+			Queued:    counts.queued.Load(),
+		}
+	}
+
+	finished := p.Done + p.Failed
+	if p.Total > 0 && finished > 0 && finished < p.Total {
+		p.ETA = time.Duration(float64(p.Elapsed) / float64(finished) * float64(p.Total-finished))
+	}
+
+	return p
+}
+
+// countingMetrics counts a step's results for Progress and Status on top of passing
+// them on to the step's own StageMetrics.
+type countingMetrics struct {
+	StageMetrics
+	counts *stageCounts
+}
+
+func (m countingMetrics) ItemOut(stage string) {
+	m.counts.processed.Add(1)
+	m.counts.consecutive.Store(0)
+	m.counts.touch()
+	m.StageMetrics.ItemOut(stage)
+}
+
+func (m countingMetrics) ItemError(stage string) {
+	m.counts.failed.Add(1)
+	m.counts.consecutive.Add(1)
+	m.counts.touch()
+	m.StageMetrics.ItemError(stage)
+}
+
+// ItemSkipped counts a value the step skipped, see skipMetrics. StageMetrics
+// that don't count skips apart are told about it as an error, as a step
+// without counts would.
+func (m countingMetrics) ItemSkipped(stage string) {
+	m.counts.skipped.Add(1)
+	m.counts.touch()
+	if sm, ok := m.StageMetrics.(skipMetrics); ok {
+		sm.ItemSkipped(stage)
+	} else {
+		m.StageMetrics.ItemError(stage)
+	}
+}
+
+func (m countingMetrics) Retry(stage string) {
+	m.counts.retried.Add(1)
+	m.StageMetrics.Retry(stage)
+}
+
+func (m countingMetrics) InFlight(stage string, delta int) {
+	if m.counts.inFlight.Add(int64(delta)) == 1 && delta > 0 {
+		m.counts.touch()
+	}
+	m.StageMetrics.InFlight(stage, delta)
+}
+
+func (m countingMetrics) Latency(stage string, d time.Duration) {
+	m.counts.latencies.Add(1)
+	m.counts.latency.Add(int64(d))
+	for {
+		prev := m.counts.maxLatency.Load()
+		if int64(d) <= prev || m.counts.maxLatency.CompareAndSwap(prev, int64(d)) {
+			break
+		}
+	}
+	m.StageMetrics.Latency(stage, d)
+}
+
+func (m countingMetrics) QueueDepth(stage string, depth int) {
+	m.counts.queued.Store(int64(depth))
+	m.StageMetrics.QueueDepth(stage, depth)
+}
+
+// withCounts counts the step's results, it must come after any WithMetrics.
+func withCounts(counts *stageCounts) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.metrics = countingMetrics{StageMetrics: cfg.metrics, counts: counts}
+	}
+}
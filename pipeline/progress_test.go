@@ -0,0 +1,63 @@
+package pipeline_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestProgress(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	src := pipelinetest.NewSource[int]()
+	sink := pipelinetest.NewSink[int]()
+	reports := make(chan pipeline.Progress)
+	failed := make(chan *pipeline.StageError, 1)
+	done := make(chan error)
+	go func() {
+		done <- pipeline.New(src.Open).
+			Then(func(v int) (int, error) {
+				if v == 2 {
+					return v, errBad
+				}
+				return v, nil
+			}, pipeline.WithName("check"), pipeline.WithConcurrency(1)).
+			OnError(pipeline.CollectErrors()).
+			Hooks(pipeline.Hooks{OnItemError: func(err *pipeline.StageError) { failed <- err }}).
+			Sink(sink.Handle).
+			Total(4).
+			Progress(time.Second, func(p pipeline.Progress) { reports <- p }).
+			Run(ctx)
+	}()
+
+	// the run handles the tick once it's done with 2 and 3
+	src.Send(t, 1, 2, 3)
+	sink.Next(t)
+	sink.Next(t)
+	pipelinetest.Receive(t, failed)
+	clock.Advance(time.Second)
+	p := pipelinetest.Receive(t, reports)
+	if p.Produced != 3 || p.Done != 2 || p.Failed != 1 || p.Total != 4 || p.Elapsed != time.Second {
+		t.Errorf("during the run got %+v, want 3 produced, 2 done and 1 failed of 4 after 1s", p)
+	}
+	// 3 values took a second, the last one should take a third of that
+	if want := time.Second / 3; p.ETA != want {
+		t.Errorf("during the run got an ETA of %v, want %v", p.ETA, want)
+	}
+	if len(p.Stages) != 1 || p.Stages[0].Name != "check" || p.Stages[0].Processed != 2 || p.Stages[0].Failed != 1 {
+		t.Errorf("during the run got stages %+v, want check with 2 processed and 1 failed", p.Stages)
+	}
+
+	src.Send(t, 4)
+	src.Close()
+	p = pipelinetest.Receive(t, reports)
+	if p.Produced != 4 || p.Done != 3 || p.Failed != 1 || p.ETA != 0 || p.Stages[0].Processed != 3 {
+		t.Errorf("once done got %+v, want 4 produced, 3 done and 1 failed", p)
+	}
+	if err := pipelinetest.Receive(t, done); err == nil {
+		t.Error("Run = nil, want the failure of 2")
+	}
+}
@@ -0,0 +1,15 @@
+package pipeline
+
+import "golang.org/x/time/rate"
+
+// WithRateLimit throttles the step to r calls of fn per second with bursts of
+// up to burst calls, e.g. to stay under the quota of an external API. A
+// burst below 1 is taken as 1, no call could ever get through otherwise.
+// Every call counts, including retries. Workers waiting for their turn give
+// up as soon as ctx is done.
+func WithRateLimit(r rate.Limit, burst int) StepOption {
+	return func(cfg *stepConfig) {
+		// a fresh limiter per step, even when the option value is shared
+		cfg.limiter = rate.NewLimiter(r, max(burst, 1))
+	}
+}
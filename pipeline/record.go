@@ -0,0 +1,185 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// recordLine is a line of a recording: a value read from the source and
+// when it was read. Values encoded as JSON are kept as they are so the
+// recording stays readable, anything else is kept as base64 bytes.
+type recordLine struct {
+	At    time.Time       `json:"at"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Data  []byte          `json:"data,omitempty"`
+}
+
+// Record writes every value the pipeline reads from its source to w as a
+// line of JSON, encoded with codec and stamped with the time it was read,
+// so a production incident can be reproduced later against the exact same
+// inputs with ReplaySource:
+//
+//	f, err := os.Create("incident.jsonl")
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//	err = pipeline.New(source).Record(f, pipeline.JSONCodec[Order]()).Then(transform).Run(ctx)
+//
+// Values are recorded before any step sees them, and those skipped because
+// of a Checkpoint aren't recorded. Buffered lines are flushed by the time
+// Run returns. A value that can't be encoded or written stops the run with
+// a *StageError of the stage "record".
+func (p *Pipeline[T]) Record(w io.Writer, codec Codec[T]) *Pipeline[T] {
+	p.recordTo = w
+	p.recordCodec = codec
+	return p
+}
+
+// recordFlushInterval is how often Record flushes its buffer, so lines don't
+// wait in it for long when the source is quiet.
+const recordFlushInterval = time.Second
+
+// record passes on the values from in once they have been written to w,
+// closing done once it has flushed what it wrote. Failures go to report,
+// after which nothing more is passed on.
+func record[T any](ctx context.Context, in <-chan sequenced[T], w io.Writer, codec Codec[T], report func(error)) (<-chan sequenced[T], <-chan struct{}) {
+	outChannel := make(chan sequenced[T])
+	done := make(chan struct{})
+	buf := bufio.NewWriter(w)
+	clock := ClockFrom(ctx)
+
+	write := func(v T) error {
+		data, err := codec.Encode(v)
+		if err != nil {
+			return err
+		}
+		line := recordLine{At: clock.Now()}
+		line.Value, line.Data = recording(data)
+
+		b, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		_, err = buf.Write(append(b, '\n'))
+		return err
+	}
+
+	go func() {
+		defer close(done)
+		defer close(outChannel)
+		// whatever was recorded is kept, however the run ends
+		defer buf.Flush()
+
+		ticker := clock.NewTicker(recordFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				if err := buf.Flush(); err != nil {
+					report(&StageError{Stage: "record", Err: Fatal(err)})
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					if err := buf.Flush(); err != nil {
+						report(&StageError{Stage: "record", Err: Fatal(err)})
+					}
+					return
+				}
+				if err := write(v.value); err != nil {
+					report(&StageError{Stage: "record", Input: v.value, Err: Fatal(err), raw: v})
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- v:
+				}
+			}
+		}
+	}()
+
+	return outChannel, done
+}
+
+// ReplayOption configures a ReplaySource.
+type ReplayOption func(*replaySourceConfig)
+
+type replaySourceConfig struct {
+	speed float64
+}
+
+// WithReplaySpeed replays the recording with the gaps between values it was
+// recorded with, sped up by factor, e.g. 1 for the original pace or 10 for
+// ten times faster, for windows, batches and timeouts that depend on them.
+// By default values are replayed as fast as the pipeline takes them.
+func WithReplaySpeed(factor float64) ReplayOption {
+	return func(cfg *replaySourceConfig) {
+		cfg.speed = factor
+	}
+}
+
+// ReplaySource returns a Source emitting the values of a recording made by
+// Record, decoded with codec, in the order they were recorded. A line that
+// can't be decoded fails the source, see GeneratorSource.
+func ReplaySource[T any](r io.Reader, codec Codec[T], opts ...ReplayOption) Source[T] {
+	var cfg replaySourceConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return GeneratorSource(func(ctx context.Context, emit func(T) error) error {
+		lines := bufio.NewReader(r)
+		clock := ClockFrom(ctx)
+		var start, first time.Time
+
+		for n := 1; ; n++ {
+			b, err := lines.ReadBytes('\n')
+			if errors.Is(err, io.EOF) && len(b) == 0 {
+				return nil
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("pipeline: reading recording: %w", err)
+			}
+
+			var line recordLine
+			if err := json.Unmarshal(b, &line); err != nil {
+				return fmt.Errorf("pipeline: line %d of recording: %w", n, err)
+			}
+			v, err := codec.Decode(recorded(line.Value, line.Data))
+			if err != nil {
+				return fmt.Errorf("pipeline: line %d of recording: %w", n, err)
+			}
+
+			if cfg.speed > 0 {
+				if start.IsZero() {
+					start, first = clock.Now(), line.At
+				}
+				due := start.Add(time.Duration(float64(line.At.Sub(first)) / cfg.speed))
+				if wait := due.Sub(clock.Now()); wait > 0 {
+					timer := clock.NewTimer(wait)
+					select {
+					case <-ctx.Done():
+						timer.Stop()
+						return ctx.Err()
+					case <-timer.C():
+					}
+				}
+			}
+
+			if err := emit(v); err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestRecordReplay(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	var recording bytes.Buffer
+	first := pipelinetest.NewSink[string]()
+	err := pipeline.New(pipeline.SliceSource([]string{"a", "b", "c"})).
+		Record(&recording, pipeline.JSONCodec[string]()).
+		Sink(first.Handle).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(recording.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[0], `"value":"a"`) {
+		t.Fatalf("recorded %q, want a line of JSON per value", recording.String())
+	}
+
+	replayed := pipelinetest.NewSink[string]()
+	err = pipeline.New(pipeline.ReplaySource(&recording, pipeline.JSONCodec[string]())).
+		Sink(replayed.Handle).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := replayed.Values(), first.Values(); !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want the recorded %v", got, want)
+	}
+}
+
+func TestReplayBadLine(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	recording := strings.NewReader(`{"at":"2024-01-01T00:00:00Z","value":1}` + "\n" + `{"at":"2024-01-01T00:00:01Z","value":"two"}` + "\n")
+	sink := pipelinetest.NewSink[int]()
+	err := pipeline.New(pipeline.ReplaySource(recording, pipeline.JSONCodec[int]())).
+		OnError(pipeline.CollectErrors()).
+		Sink(sink.Handle).
+		Run(context.Background())
+
+	var stageErr *pipeline.StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "source" || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Run = %v, want the source failing on line 2", err)
+	}
+	if got := sink.Values(); !slices.Equal(got, []int{1}) {
+		t.Errorf("sink got %v, want [1]", got)
+	}
+}
+
+func TestReplaySpeedFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	recording := strings.NewReader(`{"at":"2024-01-01T00:00:00Z","value":1}` + "\n" + `{"at":"2024-01-01T00:00:10Z","value":2}` + "\n")
+	values, err := pipeline.ReplaySource(recording, pipeline.JSONCodec[int](), pipeline.WithReplaySpeed(2))(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pipelinetest.Receive(t, values); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	// recorded 10s apart, replayed twice as fast
+	clock.WaitForTimers(1)
+	clock.Advance(4 * time.Second)
+	assertNothing(t, values)
+	clock.Advance(time.Second)
+	if got := pipelinetest.Receive(t, values); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+	pipelinetest.Collect(t, values)
+}
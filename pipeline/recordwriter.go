@@ -0,0 +1,281 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrWriterAborted is returned by a RecordWriter written to after Abort.
+var ErrWriterAborted = errors.New("pipeline: writer aborted")
+
+// WriterOption configures a RecordWriter.
+type WriterOption func(*writerConfig)
+
+type writerConfig struct {
+	flushInterval time.Duration
+	clock         Clock
+	csvHeader     []string
+}
+
+// WithFlushInterval flushes buffered records every d, so readers tailing the
+// output see them promptly. By default records are flushed when the buffer
+// fills up and on Close.
+func WithFlushInterval(d time.Duration) WriterOption {
+	return func(cfg *writerConfig) {
+		cfg.flushInterval = d
+	}
+}
+
+// WithWriterClock times the flushes of WithFlushInterval with c rather than
+// the real clock, e.g. pipeline.ClockFrom(ctx) for the Clock a run's
+// context carries, see WithClock.
+func WithWriterClock(c Clock) WriterOption {
+	return func(cfg *writerConfig) {
+		if c != nil {
+			cfg.clock = c
+		}
+	}
+}
+
+// WithCSVHeader writes header as the first row of a CSV writer.
+func WithCSVHeader(header ...string) WriterOption {
+	return func(cfg *writerConfig) {
+		cfg.csvHeader = header
+	}
+}
+
+// RecordWriter encodes values as records onto an io.Writer, buffering them
+// in between flushes. Sink adapts it to Pipeline.Sink:
+//
+//	f, err := pipeline.CreateAtomic("out.jsonl")
+//	if err != nil {
+//		return err
+//	}
+//	w := pipeline.NewJSONLWriter[Order](f, pipeline.WithFlushInterval(time.Second))
+//	err = pipeline.New(source).Then(transform).Sink(w.Sink()).Run(ctx)
+//	if err != nil {
+//		w.Abort()
+//		return err
+//	}
+//	return w.Close()
+//
+// It is safe for concurrent use.
+type RecordWriter[T any] struct {
+	dst   io.Writer
+	write func(T) error
+	flush func() error
+
+	mu       sync.Mutex
+	err      error
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewJSONLWriter returns a RecordWriter writing every value to w as a line of
+// JSON.
+func NewJSONLWriter[T any](w io.Writer, opts ...WriterOption) *RecordWriter[T] {
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+
+	return newRecordWriter(w, newWriterConfig(opts), nil, func(v T) error {
+		return enc.Encode(v)
+	}, buf.Flush)
+}
+
+// NewCSVWriter returns a RecordWriter writing every value to w as the CSV
+// row record returns for it, see WithCSVHeader.
+func NewCSVWriter[T any](w io.Writer, record func(T) []string, opts ...WriterOption) *RecordWriter[T] {
+	cfg := newWriterConfig(opts)
+	cw := csv.NewWriter(w)
+
+	var err error
+	if cfg.csvHeader != nil {
+		err = cw.Write(cfg.csvHeader)
+	}
+
+	return newRecordWriter(w, cfg, err, func(v T) error {
+		return cw.Write(record(v))
+	}, func() error {
+		cw.Flush()
+		return cw.Error()
+	})
+}
+
+func newWriterConfig(opts []WriterOption) writerConfig {
+	cfg := writerConfig{clock: realClock{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+func newRecordWriter[T any](dst io.Writer, cfg writerConfig, err error, write func(T) error, flush func() error) *RecordWriter[T] {
+	w := &RecordWriter[T]{dst: dst, write: write, flush: flush, err: err}
+	if cfg.flushInterval > 0 {
+		w.stop, w.done = make(chan struct{}), make(chan struct{})
+		go w.flushEvery(cfg.clock.NewTicker(cfg.flushInterval))
+	}
+
+	return w
+}
+
+func (w *RecordWriter[T]) flushEvery(ticker Ticker) {
+	defer close(w.done)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C():
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = w.flush()
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Write encodes v. Once a write or flush has failed, every later call
+// returns that error.
+func (w *RecordWriter[T]) Write(v T) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.write(v)
+	return w.err
+}
+
+// Sink returns Write, for Pipeline.Sink.
+func (w *RecordWriter[T]) Sink() func(T) error {
+	return w.Write
+}
+
+// Flush writes any buffered records to the underlying writer.
+func (w *RecordWriter[T]) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.flush()
+	return w.err
+}
+
+// aborter is implemented by writers that can discard what was written to
+// them, as AtomicFile does.
+type aborter interface {
+	Abort() error
+}
+
+// Close flushes the buffered records, stops the interval flushes and, if the
+// underlying writer is an io.Closer, closes it. If the flush fails, an
+// underlying writer with an Abort method, such as an AtomicFile, is aborted
+// instead, so an incomplete output doesn't replace the previous one.
+func (w *RecordWriter[T]) Close() error {
+	w.stopFlushes()
+
+	err := w.Flush()
+	if errors.Is(err, ErrWriterAborted) {
+		// Abort has dealt with dst already
+		return err
+	}
+	if a, ok := w.dst.(aborter); ok && err != nil {
+		return errors.Join(err, a.Abort())
+	}
+	if c, ok := w.dst.(io.Closer); ok {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// Abort stops the interval flushes and discards the buffered records,
+// aborting the underlying writer if it has an Abort method and otherwise
+// closing it if it is an io.Closer. It is for when the run writing the
+// records failed.
+func (w *RecordWriter[T]) Abort() error {
+	w.stopFlushes()
+
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = ErrWriterAborted
+	}
+	w.mu.Unlock()
+
+	switch dst := w.dst.(type) {
+	case aborter:
+		return dst.Abort()
+	case io.Closer:
+		return dst.Close()
+	}
+	return nil
+}
+
+func (w *RecordWriter[T]) stopFlushes() {
+	if w.stop == nil {
+		return
+	}
+
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		<-w.done
+	})
+}
+
+// AtomicFile is a file that only appears at its path, complete, once it is
+// closed. Until then it is written to a temporary file next to it, so
+// readers never see a half-written output and a failed run leaves the
+// previous file in place.
+type AtomicFile struct {
+	*os.File
+	path string
+}
+
+// CreateAtomic starts writing the file at path, see AtomicFile.
+func CreateAtomic(path string) (*AtomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp makes the file private, give it the usual permissions
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &AtomicFile{File: f, path: path}, nil
+}
+
+// Close syncs the temporary file and renames it into place.
+func (f *AtomicFile) Close() error {
+	if err := f.File.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+
+	return os.Rename(f.File.Name(), f.path)
+}
+
+// Abort discards what was written, leaving whatever was at the path before.
+func (f *AtomicFile) Abort() error {
+	f.File.Close()
+	return os.Remove(f.File.Name())
+}
@@ -0,0 +1,145 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+type record struct {
+	ID int `json:"id"`
+}
+
+// failingFile is an AtomicFile whose writes fail once armed.
+type failingFile struct {
+	*pipeline.AtomicFile
+	fail bool
+}
+
+func (f *failingFile) Write(b []byte) (int, error) {
+	if f.fail {
+		return 0, errors.New("disk full")
+	}
+	return f.AtomicFile.Write(b)
+}
+
+func TestRecordWriterAtomicFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		finish   func(w *pipeline.RecordWriter[record], f *failingFile) error
+		wantErr  bool
+		wantFile string
+	}{
+		{
+			name: "close renames into place",
+			finish: func(w *pipeline.RecordWriter[record], _ *failingFile) error {
+				return w.Close()
+			},
+			wantFile: "{\"id\":1}\n{\"id\":2}\n",
+		},
+		{
+			name: "failed flush keeps the previous file",
+			finish: func(w *pipeline.RecordWriter[record], f *failingFile) error {
+				f.fail = true
+				return w.Close()
+			},
+			wantErr:  true,
+			wantFile: "previous\n",
+		},
+		{
+			name: "abort keeps the previous file",
+			finish: func(w *pipeline.RecordWriter[record], _ *failingFile) error {
+				if err := w.Abort(); err != nil {
+					return err
+				}
+				return w.Close()
+			},
+			wantErr:  true,
+			wantFile: "previous\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "out.jsonl")
+			if err := os.WriteFile(path, []byte("previous\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			af, err := pipeline.CreateAtomic(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := &failingFile{AtomicFile: af}
+
+			w := pipeline.NewJSONLWriter[record](f, pipeline.WithFlushInterval(time.Hour))
+			for _, r := range []record{{ID: 1}, {ID: 2}} {
+				if err := w.Write(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = tt.finish(w, f)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantFile {
+				t.Errorf("file holds %q, want %q", got, tt.wantFile)
+			}
+			if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(leftovers) > 0 {
+				t.Errorf("temporary files left behind: %v", leftovers)
+			}
+		})
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe to read while a RecordWriter flushes
+// to it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestFlushIntervalFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	_, clock := fakeContext(t)
+
+	var out lockedBuffer
+	w := pipeline.NewJSONLWriter[record](&out, pipeline.WithFlushInterval(time.Minute), pipeline.WithWriterClock(clock))
+	defer w.Close()
+	if err := w.Write(record{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.WaitForTimers(1)
+	if got := out.String(); got != "" {
+		t.Fatalf("flushed %q before the interval was up", got)
+	}
+	clock.Advance(time.Minute)
+	waitFor(t, "the record to be flushed", func() bool { return out.String() == "{\"id\":1}\n" })
+}
@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error reported when a transform panics. It is wrapped in
+// the StageError of the value that caused it.
+type PanicError struct {
+	// Value is what was passed to panic.
+	Value any
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// WithoutPanicRecovery lets a panic in fn crash the process like it would
+// outside a pipeline. By default steps recover panics and report them as a
+// PanicError, without retrying.
+func WithoutPanicRecovery() StepOption {
+	return func(cfg *stepConfig) {
+		cfg.crashOnPanic = true
+	}
+}
+
+// recoverPanics wraps fn so a panic comes back as a *PanicError.
+func recoverPanics[In any, Out any](fn func(context.Context, In) (Out, error)) func(context.Context, In) (Out, error) {
+	return func(ctx context.Context, in In) (out Out, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+
+		return fn(ctx, in)
+	}
+}
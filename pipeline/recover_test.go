@@ -0,0 +1,48 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func panicking(int) (int, error) {
+	panic("boom")
+}
+
+func TestPanicRecovered(t *testing.T) {
+	err := pipeline.New(pipeline.SliceSource([]int{1})).
+		Then(panicking, pipeline.WithRetry(3, pipeline.ConstantBackoff(0))).
+		Run(context.Background())
+
+	var stageErr *pipeline.StageError
+	var panicErr *pipeline.PanicError
+	if !errors.As(err, &stageErr) || !errors.As(err, &panicErr) || panicErr.Value != "boom" || stageErr.Attempts != 1 {
+		t.Errorf("Run = %v, want a PanicError of boom, not retried", err)
+	}
+}
+
+// TestWithoutPanicRecovery runs itself in a process of its own, which the
+// panic has to crash.
+func TestWithoutPanicRecovery(t *testing.T) {
+	if os.Getenv("PIPELINE_TEST_CRASH") == "1" {
+		pipeline.New(pipeline.SliceSource([]int{1})).
+			Then(panicking, pipeline.WithoutPanicRecovery()).
+			Run(context.Background())
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWithoutPanicRecovery$")
+	cmd.Env = append(os.Environ(), "PIPELINE_TEST_CRASH=1")
+	out, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || !strings.Contains(string(out), "panic: boom") {
+		t.Errorf("the run ended with %v and output:\n%s\nwant it crashed by the panic", err, out)
+	}
+}
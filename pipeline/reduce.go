@@ -0,0 +1,53 @@
+package pipeline
+
+import "context"
+
+// Number is the set of types Sum can add up.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Reduce is a terminal stage folding every value read from in into an
+// accumulator, starting from seed. It returns the final accumulator once in
+// is closed, or the accumulator so far and the context's cause if ctx is
+// done first, see context.Cause.
+func Reduce[T any, Acc any](ctx context.Context, in <-chan T, seed Acc, fn func(Acc, T) Acc) (Acc, error) {
+	acc := seed
+	for {
+		select {
+		case <-ctx.Done():
+			return acc, context.Cause(ctx)
+		case v, ok := <-in:
+			if !ok {
+				return acc, nil
+			}
+			acc = fn(acc, v)
+		}
+	}
+}
+
+// Count returns how many values were read from in, see Reduce.
+func Count[T any](ctx context.Context, in <-chan T) (int, error) {
+	return Reduce(ctx, in, 0, func(n int, _ T) int {
+		return n + 1
+	})
+}
+
+// Sum adds up every value read from in, see Reduce.
+func Sum[T Number](ctx context.Context, in <-chan T) (T, error) {
+	return Reduce(ctx, in, 0, func(sum T, v T) T {
+		return sum + v
+	})
+}
+
+// GroupBy collects the values read from in by the key keyFn returns for
+// them, keeping their order of arrival within each group, see Reduce.
+func GroupBy[T any, K comparable](ctx context.Context, in <-chan T, keyFn func(T) K) (map[K][]T, error) {
+	return Reduce(ctx, in, make(map[K][]T), func(groups map[K][]T, v T) map[K][]T {
+		k := keyFn(v)
+		groups[k] = append(groups[k], v)
+		return groups
+	})
+}
@@ -0,0 +1,51 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestReduce(t *testing.T) {
+	ctx := context.Background()
+
+	got, err := pipeline.Reduce(ctx, waiting("a", "b", "c"), ">", func(acc string, s string) string { return acc + s })
+	if got != ">abc" || err != nil {
+		t.Errorf("Reduce = %q, %v, want >abc, nil", got, err)
+	}
+	if n, err := pipeline.Count(ctx, waiting("a", "b", "c")); n != 3 || err != nil {
+		t.Errorf("Count = %d, %v, want 3, nil", n, err)
+	}
+	if sum, err := pipeline.Sum(ctx, waiting(1.5, 2, 3)); sum != 6.5 || err != nil {
+		t.Errorf("Sum = %v, %v, want 6.5, nil", sum, err)
+	}
+
+	groups, err := pipeline.GroupBy(ctx, waiting("apple", "bean", "avocado", "beet"), func(s string) string { return s[:1] })
+	want := map[string][]string{"a": {"apple", "avocado"}, "b": {"bean", "beet"}}
+	if err != nil || !maps.EqualFunc(groups, want, slices.Equal[[]string]) {
+		t.Errorf("GroupBy = %v, %v, want %v, nil", groups, err, want)
+	}
+}
+
+// TestReduceCancelled checks the accumulator so far is returned with the
+// context's error when ctx is done before in is closed.
+func TestReduceCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan string, 2)
+	in <- "a"
+	in <- "b"
+
+	got, err := pipeline.Reduce(ctx, in, "", func(acc string, s string) string {
+		if acc+s == "ab" {
+			cancel()
+		}
+		return acc + s
+	})
+	if !errors.Is(err, context.Canceled) || got != "ab" {
+		t.Errorf("Reduce = %q, %v, want \"ab\", %v", got, err, context.Canceled)
+	}
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import "time"
+
+// AtLeastOnce keeps the values the sink fails on with an error classified
+// as ErrorRetry in a replay buffer and hands them to the sink again, waiting
+// as told by backoff, until it takes them, so a sink in front of a queue or
+// a flaky API doesn't lose values to a transient outage. A value is only
+// failed, and handled by the ErrorPolicy and any DeadLetter, once it has been
+// tried maxAttempts times in total, or never if maxAttempts is 0 or less.
+//
+// At most buffer values are held at a time. While the buffer is full no new
+// values are handed to the sink, so the pipeline slows down to the pace the
+// sink recovers at. Values are redelivered in the order they failed in.
+//
+// A held value isn't done yet: it is only settled, see Message.OnAck, and
+// checkpointed past once the sink has taken it, so values still held when a
+// run stops are delivered again by the next one from the last Checkpoint.
+func (p *Pipeline[T]) AtLeastOnce(buffer int, maxAttempts int, backoff BackoffStrategy) *Pipeline[T] {
+	p.replay = &replayConfig{buffer: max(buffer, 1), maxAttempts: maxAttempts, backoff: backoff}
+	return p
+}
+
+type replayConfig struct {
+	buffer      int
+	maxAttempts int
+	backoff     BackoffStrategy
+}
+
+// redelivery is a value waiting in the replay buffer.
+type redelivery[T any] struct {
+	value    sequenced[T]
+	attempts int
+	due      time.Time
+}
+
+// replayBuffer holds the values to hand to the sink again, in the order
+// they failed in.
+type replayBuffer[T any] struct {
+	cfg     *replayConfig
+	clock   Clock
+	pending []redelivery[T]
+	timer   Timer
+}
+
+// hold adds v to the buffer if it is worth delivering again after attempts
+// tries that ended in an error of the given class, reporting whether it
+// did.
+func (b *replayBuffer[T]) hold(v sequenced[T], attempts int, class ErrorClass) bool {
+	if b.cfg == nil || class != ErrorRetry {
+		return false
+	}
+	if b.cfg.maxAttempts > 0 && attempts >= b.cfg.maxAttempts {
+		return false
+	}
+
+	due := b.clock.Now()
+	if b.cfg.backoff != nil {
+		due = due.Add(b.cfg.backoff(attempts))
+	}
+	b.pending = append(b.pending, redelivery[T]{value: v, attempts: attempts, due: due})
+	return true
+}
+
+// full reports whether no more values should be handed to the sink until
+// the held ones have been taken.
+func (b *replayBuffer[T]) full() bool {
+	return b.cfg != nil && len(b.pending) >= b.cfg.buffer
+}
+
+func (b *replayBuffer[T]) len() int {
+	return len(b.pending)
+}
+
+// due returns a channel receiving once the oldest held value is due, or nil
+// if there is none.
+func (b *replayBuffer[T]) due() <-chan time.Time {
+	if len(b.pending) == 0 {
+		return nil
+	}
+
+	wait := b.pending[0].due.Sub(b.clock.Now())
+	if b.timer == nil {
+		b.timer = b.clock.NewTimer(wait)
+	} else {
+		b.timer.Reset(wait)
+	}
+	return b.timer.C()
+}
+
+// next takes the oldest held value out of the buffer.
+func (b *replayBuffer[T]) next() redelivery[T] {
+	r := b.pending[0]
+	b.pending[0] = redelivery[T]{}
+	b.pending = b.pending[1:]
+	return r
+}
+
+func (b *replayBuffer[T]) stop() {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorReporter is told about every value a step fails on, with what an
+// error tracker such as Sentry, Rollbar or Bugsnag wants to group and show
+// the failure, so integrating one is a small adapter:
+//
+//	type sentryReporter struct{ hub *sentry.Hub }
+//
+//	func (r sentryReporter) ReportError(ctx context.Context, report pipeline.ErrorReport) {
+//		r.hub.WithScope(func(scope *sentry.Scope) {
+//			scope.SetTag("stage", report.Stage)
+//			scope.SetTag("message_id", report.ID)
+//			scope.SetExtra("attempts", report.Attempts)
+//			r.hub.CaptureException(report.Err)
+//		})
+//	}
+//
+// ReportError is called synchronously from the step's workers, several at
+// once, so it must be safe for concurrent use and should hand the report off
+// rather than send it itself.
+type ErrorReporter interface {
+	ReportError(ctx context.Context, report ErrorReport)
+}
+
+// ErrorReport is a failure told to an ErrorReporter.
+type ErrorReport struct {
+	// Stage is the step's name, "step 1", "step 2" and so on for the
+	// unnamed steps of a Pipeline, or "sink" for its sink.
+	Stage string
+	// Input is the value that failed, and ID and Headers its metadata if
+	// it is a Message.
+	Input   any
+	ID      string
+	Headers Headers
+	// Attempts is how many times the value was tried.
+	Attempts int
+	// Stack is the stack trace of the panic the value failed with, nil if
+	// it didn't panic.
+	Stack []byte
+	// Err is the failure, a *StageError.
+	Err error
+}
+
+// WithErrorReporter tells r about every value the step fails on, on top of
+// any other reporters the step has. Values it skips aren't reported, see
+// ErrorSkip.
+func WithErrorReporter(r ErrorReporter) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.reporters = append(cfg.reporters, r)
+	}
+}
+
+// ReportErrors tells r about every value the pipeline's steps or its sink
+// fail on, see WithErrorReporter, whatever the ErrorPolicy then makes of
+// the failure.
+func (p *Pipeline[T]) ReportErrors(r ErrorReporter) *Pipeline[T] {
+	p.reporters = append(p.reporters, r)
+	return p
+}
+
+// described is implemented by every Message.
+type described interface {
+	metadata() (id string, headers Headers)
+}
+
+func (m Message[T]) metadata() (string, Headers) {
+	return m.ID, m.Headers
+}
+
+// reportError tells reporters that input failed in stage with err.
+func reportError(ctx context.Context, reporters []ErrorReporter, stage string, input any, err *StageError) {
+	if len(reporters) == 0 {
+		return
+	}
+
+	report := ErrorReport{Stage: stage, Input: input, Attempts: err.Attempts, Err: err}
+	if d, ok := input.(described); ok {
+		report.ID, report.Headers = d.metadata()
+	}
+	var p *PanicError
+	if errors.As(err, &p) {
+		report.Stack = p.Stack
+	}
+	for _, r := range reporters {
+		r.ReportError(ctx, report)
+	}
+}
@@ -0,0 +1,167 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// reports is an ErrorReporter keeping what it was told.
+type reports struct {
+	mu   sync.Mutex
+	list []pipeline.ErrorReport
+}
+
+func (r *reports) ReportError(_ context.Context, report pipeline.ErrorReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.list = append(r.list, report)
+}
+
+func (r *reports) get() []pipeline.ErrorReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.list)
+}
+
+var errBad = errors.New("bad")
+
+func TestErrorReporter(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	tests := []struct {
+		name      string
+		fn        func(int) (int, error)
+		opts      []pipeline.StepOption
+		wantCount int
+		check     func(t *testing.T, r pipeline.ErrorReport)
+	}{
+		{
+			name:      "failure",
+			fn:        func(int) (int, error) { return 0, errBad },
+			opts:      []pipeline.StepOption{pipeline.WithName("parse")},
+			wantCount: 1,
+			check: func(t *testing.T, r pipeline.ErrorReport) {
+				if r.Stage != "parse" || r.Input != 7 || r.Attempts != 1 || r.Stack != nil || !errors.Is(r.Err, errBad) {
+					t.Errorf("report = %+v", r)
+				}
+			},
+		},
+		{
+			name:      "retried",
+			fn:        func(int) (int, error) { return 0, errBad },
+			opts:      []pipeline.StepOption{pipeline.WithRetry(3, pipeline.ConstantBackoff(0))},
+			wantCount: 1,
+			check: func(t *testing.T, r pipeline.ErrorReport) {
+				if r.Attempts != 3 {
+					t.Errorf("Attempts = %d, want 3", r.Attempts)
+				}
+			},
+		},
+		{
+			name:      "panic",
+			fn:        func(int) (int, error) { panic("boom") },
+			wantCount: 1,
+			check: func(t *testing.T, r pipeline.ErrorReport) {
+				var p *pipeline.PanicError
+				if len(r.Stack) == 0 || !errors.As(r.Err, &p) || p.Value != "boom" {
+					t.Errorf("report = %+v, want the panic and its stack", r)
+				}
+			},
+		},
+		{
+			name: "skipped",
+			fn:   func(int) (int, error) { return 0, pipeline.Skip(errBad) },
+		},
+		{
+			name: "succeeded",
+			fn:   func(v int) (int, error) { return v, nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &reports{}
+			opts := append(tt.opts, pipeline.WithErrorReporter(r))
+			pipelinetest.RunStage(t, tt.fn, []int{7}, opts...)
+
+			got := r.get()
+			if len(got) != tt.wantCount {
+				t.Fatalf("got %d reports, want %d", len(got), tt.wantCount)
+			}
+			for _, report := range got {
+				tt.check(t, report)
+			}
+		})
+	}
+}
+
+func TestErrorReporterMessage(t *testing.T) {
+	r := &reports{}
+	msg := pipeline.NewMessage(1)
+	msg.ID = "order-1"
+	msg.Headers = pipeline.Headers{"tenant": "acme"}
+
+	fail := pipeline.MapMessage(func(int) (int, error) { return 0, errBad })
+	pipelinetest.RunStage(t, fail, []pipeline.Message[int]{msg}, pipeline.WithErrorReporter(r))
+
+	got := r.get()
+	if len(got) != 1 || got[0].ID != "order-1" || got[0].Headers.Get("tenant") != "acme" {
+		t.Errorf("reports = %+v, want the message's ID and headers", got)
+	}
+}
+
+func TestPipelineReportErrors(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	r := &reports{}
+	err := pipeline.New(pipeline.SliceSource([]int{1, 2, 3, 4})).
+		Then(func(v int) (int, error) {
+			if v == 1 {
+				return 0, errBad
+			}
+			return v, nil
+		}).
+		Then(func(v int) (int, error) {
+			if v == 2 {
+				return 0, pipeline.Skip(errBad)
+			}
+			return v, nil
+		}, pipeline.WithName("filter")).
+		Sink(func(v int) error {
+			if v == 3 {
+				return errBad
+			}
+			return nil
+		}).
+		OnError(pipeline.SkipErrors()).
+		ReportErrors(r).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.get()
+	slices.SortFunc(got, func(a, b pipeline.ErrorReport) int { return a.Input.(int) - b.Input.(int) })
+	want := []struct {
+		stage string
+		input int
+	}{{"step 1", 1}, {"sink", 3}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d reports %+v, want %d", len(got), got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Stage != w.stage || got[i].Input != w.input {
+			t.Errorf("report %d = %s with %v, want %s with %d", i, got[i].Stage, got[i].Input, w.stage, w.input)
+		}
+		// the error reported is the one Run sees, value and all
+		var stageErr *pipeline.StageError
+		if !errors.As(got[i].Err, &stageErr) || stageErr.Stage != w.stage || stageErr.Input != w.input {
+			t.Errorf("report %d error %#v, want a StageError from %s with %d", i, got[i].Err, w.stage, w.input)
+		}
+	}
+}
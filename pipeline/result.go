@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+)
+
+// Result sums up a finished run, see Pipeline.RunResult, e.g. for a batch
+// job to log at the end and pick its exit code from.
+type Result struct {
+	// Produced, Done, Failed and Skipped count the values of the run as for
+	// Progress.
+	Produced int64
+	Done     int64
+	Failed   int64
+	Skipped  int64
+	// Stages reports every step, in order.
+	Stages   []StageProgress
+	Duration time.Duration
+	// Err is what the run returned.
+	Err error
+}
+
+func newResult(counter *progressCounter, d time.Duration, err error) Result {
+	p := counter.snapshot()
+	return Result{
+		Produced: p.Produced,
+		Done:     p.Done,
+		Failed:   p.Failed,
+		Skipped:  p.Skipped,
+		Stages:   p.Stages,
+		Duration: d,
+		Err:      err,
+	}
+}
+
+// Partial reports whether the run finished but some values failed on the
+// way, let through by the pipeline's ErrorPolicy or DeadLetter handler.
+func (r Result) Partial() bool {
+	return r.Err == nil && r.Failed > 0
+}
+
+// ExitCode is the exit code for a process whose work was the run: 0 if
+// every value made it, 1 if the run failed and 2 if it was Partial.
+func (r Result) ExitCode() int {
+	switch {
+	case r.Err != nil:
+		return 1
+	case r.Partial():
+		return 2
+	default:
+		return 0
+	}
+}
+
+// String returns a one-line summary of the run.
+func (r Result) String() string {
+	s := fmt.Sprintf("%d produced, %d done, %d failed, %d skipped in %s",
+		r.Produced, r.Done, r.Failed, r.Skipped, r.Duration.Round(time.Millisecond))
+	if r.Err != nil {
+		s += ": " + r.Err.Error()
+	}
+	return s
+}
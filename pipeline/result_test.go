@@ -0,0 +1,91 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestRunResult(t *testing.T) {
+	// 6 is skipped and halve fails on odd numbers
+	values := []int{2, 4, 6, 8}
+	skipSix := func(v int) (int, error) {
+		if v == 6 {
+			return 0, pipeline.Skip(errBad)
+		}
+		return v, nil
+	}
+
+	tests := []struct {
+		name   string
+		values []int
+		policy pipeline.ErrorPolicy
+		// done, failed and skipped are the counts of the result
+		done, failed, skipped int64
+		partial               bool
+		exitCode              int
+		summary               string
+	}{
+		{
+			name:     "every value made it",
+			values:   values,
+			policy:   pipeline.FailFast(),
+			done:     3,
+			skipped:  1,
+			exitCode: 0,
+			summary:  "4 produced, 3 done, 0 failed, 1 skipped in",
+		},
+		{
+			name:     "partial",
+			values:   []int{2, 3, 4},
+			policy:   pipeline.SkipErrors(),
+			done:     2,
+			failed:   1,
+			partial:  true,
+			exitCode: 2,
+			summary:  "3 produced, 2 done, 1 failed, 0 skipped in",
+		},
+		{
+			name:     "failed",
+			values:   []int{3},
+			policy:   pipeline.FailFast(),
+			failed:   1,
+			exitCode: 1,
+			summary:  "1 produced, 0 done, 1 failed, 0 skipped in",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := pipeline.New(pipeline.SliceSource(tt.values)).
+				Then(skipSix).
+				Then(halve, pipeline.WithName("halve")).
+				OnError(tt.policy).
+				RunResult(context.Background())
+
+			if !errors.Is(result.Err, err) || (err != nil) != (tt.exitCode == 1) {
+				t.Errorf("result has error %v, run returned %v", result.Err, err)
+			}
+			if result.Produced != int64(len(tt.values)) || result.Done != tt.done || result.Failed != tt.failed || result.Skipped != tt.skipped {
+				t.Errorf("got %+v, want %d done, %d failed and %d skipped", result, tt.done, tt.failed, tt.skipped)
+			}
+			if result.Partial() != tt.partial || result.ExitCode() != tt.exitCode {
+				t.Errorf("partial %v with exit code %d, want %v and %d", result.Partial(), result.ExitCode(), tt.partial, tt.exitCode)
+			}
+			if len(result.Stages) != 2 || result.Stages[1].Name != "halve" || result.Stages[0].Skipped != tt.skipped {
+				t.Errorf("stages %+v, want both steps, the skips in the first", result.Stages)
+			}
+			if s := result.String(); !strings.HasPrefix(s, tt.summary) {
+				t.Errorf("summary %q, want it to start with %q", s, tt.summary)
+			} else if err != nil && !strings.HasSuffix(s, ": "+err.Error()) {
+				t.Errorf("summary %q, want it to end with the error", s)
+			}
+			if result.Duration <= 0 {
+				t.Errorf("took %v, want the duration of the run", result.Duration)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// BackoffStrategy returns how long to wait before the given retry. The first
+// retry, i.e. the second attempt, is retry 1.
+type BackoffStrategy func(retry int) time.Duration
+
+// ConstantBackoff waits d before every retry.
+func ConstantBackoff(d time.Duration) BackoffStrategy {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff doubles the wait after every retry starting from base,
+// capped at max, and applies full jitter so that values failing together
+// don't retry in lockstep.
+func ExponentialBackoff(base, max time.Duration) BackoffStrategy {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		if d <= 0 {
+			return 0
+		}
+
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, so a step configured with
+// WithRetry reports it straight away. The original error is still reachable
+// with errors.Is and errors.As.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was marked with
+// Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// WithRetry retries fn up to maxAttempts times in total when it fails,
+// waiting between attempts as told by backoff. Only errors classified as
+// ErrorRetry are retried, which by default leaves out errors marked with
+// Permanent or Fatal and panics, see WithErrorClassifier. Only the error from
+// the final attempt is reported.
+func WithRetry(maxAttempts int, backoff BackoffStrategy) StepOption {
+	return func(cfg *stepConfig) {
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+		cfg.maxAttempts = maxAttempts
+		cfg.backoff = backoff
+	}
+}
+
+// callWithRetry runs fn on in until it succeeds, fails with an error not
+// classified as ErrorRetry, runs out of attempts or ctx is done, returning
+// how many attempts were made.
+func callWithRetry[In any, Out any](ctx context.Context, cfg stepConfig, fn func(context.Context, In) (Out, error), in In) (Out, int, error) {
+	attempt := 1
+	for {
+		if cfg.limiter != nil {
+			if err := cfg.limiter.Wait(ctx); err != nil {
+				var zero Out
+				return zero, attempt, err
+			}
+		}
+
+		if cfg.breaker != nil {
+			if err := cfg.breaker.wait(ctx); err != nil {
+				var zero Out
+				return zero, attempt, err
+			}
+		}
+
+		release := func() {}
+		if cfg.shared != nil {
+			var err error
+			if release, err = cfg.shared.acquire(ctx); err != nil {
+				var zero Out
+				return zero, attempt, err
+			}
+		}
+
+		callCtx, end := ctx, func(error) {}
+		if cfg.tracer != nil {
+			callCtx, end = cfg.tracer.StartCall(ctx, CallInfo{Stage: cfg.label, Attempt: attempt, Input: cfg.input(in)})
+		}
+
+		out, err := fn(callCtx, in)
+		release()
+		end(err)
+		class := ErrorRetry
+		if err != nil {
+			class = classify(cfg.classify, err)
+		}
+		if cfg.breaker != nil && ctx.Err() == nil {
+			// any other error still means the dependency answered
+			failed := err
+			if class != ErrorRetry {
+				failed = nil
+			}
+			cfg.breaker.record(failed, ClockFrom(ctx).Now(), cfg.logger)
+		}
+		if err == nil || attempt >= cfg.maxAttempts || class != ErrorRetry {
+			return out, attempt, err
+		}
+
+		if cfg.backoff != nil {
+			timer := ClockFrom(ctx).NewTimer(cfg.backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return out, attempt, err
+			case <-timer.C():
+			}
+		}
+		cfg.metrics.Retry(cfg.label)
+		attempt++
+		cfg.logger.DebugContext(ctx, "retrying", "attempt", attempt, "error", err)
+	}
+}
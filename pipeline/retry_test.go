@@ -0,0 +1,45 @@
+package pipeline_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := pipeline.ExponentialBackoff(100*time.Millisecond, time.Second)
+
+	// the wait doubles from base until it reaches the cap
+	ceilings := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, ceiling := range ceilings {
+		retry := i + 1
+		lowest, highest := ceiling, time.Duration(0)
+		for range 1000 {
+			d := backoff(retry)
+			if d < 0 || d > ceiling {
+				t.Fatalf("retry %d waits %v, want between 0 and %v", retry, d, ceiling)
+			}
+			lowest, highest = min(lowest, d), max(highest, d)
+		}
+
+		// with full jitter 1000 waits are all but certain to spread over
+		// the whole range
+		if lowest > ceiling/10 || highest < ceiling*9/10 {
+			t.Errorf("retry %d waits between %v and %v, want them spread over 0 to %v", retry, lowest, highest, ceiling)
+		}
+	}
+}
+
+func TestExponentialBackoffZero(t *testing.T) {
+	if d := pipeline.ExponentialBackoff(0, time.Second)(3); d != 0 {
+		t.Errorf("waits %v with a zero base, want 0", d)
+	}
+}
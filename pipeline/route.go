@@ -0,0 +1,107 @@
+package pipeline
+
+import "context"
+
+// Split sends the values from in for which pred returns true to matched and
+// the others to unmatched, e.g. valid records on to processing and invalid
+// ones off to be reported. Both outputs must be read: a value is only read
+// from in once the output it is destined for has taken it. Both are closed
+// once in is closed or ctx is done.
+func Split[T any](ctx context.Context, in <-chan T, pred func(T) bool) (matched, unmatched <-chan T) {
+	routes := Route(ctx, in, pred, true, false)
+	return routes[true], routes[false]
+}
+
+// Route sends every value from in to the output of the route routeFn
+// returns for it, e.g. a route name, so values can take different paths
+// downstream:
+//
+//	routes := pipeline.Route(ctx, orders, func(o Order) string {
+//		return o.Region
+//	}, "eu", "us")
+//	eu, us := routes["eu"], routes["us"]
+//
+// There is an output for each of routes. Values routed anywhere else are
+// dropped, as if filtered out. A slow output holds up every value destined
+// for it, and an output nobody reads stalls the rest. All outputs are closed
+// once in is closed or ctx is done.
+func Route[T any, K comparable](ctx context.Context, in <-chan T, routeFn func(T) K, routes ...K) map[K]<-chan T {
+	outs, result := makeOutputs[T](len(routes))
+	byRoute := make(map[K]chan T, len(routes))
+	channels := make(map[K]<-chan T, len(routes))
+	for i, r := range routes {
+		byRoute[r] = outs[i]
+		channels[r] = result[i]
+	}
+	send := sender[T](ctx)
+
+	go func() {
+		defer closeAll(outs)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				out, ok := byRoute[routeFn(v)]
+				if !ok {
+					continue
+				}
+				if !send(out, v) {
+					return
+				}
+			}
+		}
+	}()
+
+	return channels
+}
+
+// Outcome is a result of a RouteStep together with the route it goes to.
+type Outcome[K comparable, T any] struct {
+	Route K
+	Value T
+}
+
+// To returns an Outcome sending v to route.
+func To[K comparable, T any](route K, v T) Outcome[K, T] {
+	return Outcome[K, T]{Route: route, Value: v}
+}
+
+// RouteStep is a Step whose fn picks the output each of its results goes
+// to, so a validation-style stage can feed more than one stream downstream:
+//
+//	outputs, errs := pipeline.RouteStep(ctx, orders, func(o Order) (pipeline.Outcome[string, Order], error) {
+//		switch {
+//		case o.Total == 0:
+//			return pipeline.To("skip", o), nil
+//		case o.Total > 10_000:
+//			return pipeline.To("review", o), nil
+//		default:
+//			return pipeline.To("ok", o), nil
+//		}
+//	}, []string{"ok", "skip", "review"})
+//
+// Results are routed as by Route: there is an output for each of routes, a
+// result routed anywhere else is dropped, and an output nobody reads stalls
+// the step. Failures go to the error channel as with Step, whose options
+// apply.
+func RouteStep[In any, Out any, K comparable](
+	ctx context.Context,
+	inputChannel <-chan In,
+	fn func(In) (Outcome[K, Out], error),
+	routes []K,
+	opts ...StepOption,
+) (map[K]<-chan Out, <-chan error) {
+	outcomes, errs := Step(ctx, inputChannel, fn, opts...)
+
+	outputs := make(map[K]<-chan Out, len(routes))
+	for route, c := range Route(ctx, outcomes, func(o Outcome[K, Out]) K { return o.Route }, routes...) {
+		outputs[route] = mapChannel(ctx, c, func(o Outcome[K, Out]) Out { return o.Value })
+	}
+
+	return outputs, errs
+}
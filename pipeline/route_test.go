@@ -0,0 +1,77 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestSplit(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	even, odd := pipeline.Split(context.Background(), waiting(upTo(6)...), func(v int) bool { return v%2 == 0 })
+	got := fannedOut([]<-chan int{even, odd})
+	if !slices.Equal(got[0], []int{2, 4, 6}) || !slices.Equal(got[1], []int{1, 3, 5}) {
+		t.Errorf("got matched %v and unmatched %v, want [2 4 6] and [1 3 5]", got[0], got[1])
+	}
+}
+
+func TestRoute(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	words := waiting("apple", "bean", "cherry", "avocado", "beet")
+	routes := pipeline.Route(context.Background(), words, func(s string) byte { return s[0] }, 'a', 'b')
+	if len(routes) != 2 {
+		t.Fatalf("got %d routes, want 2", len(routes))
+	}
+
+	// nothing is routed to c, so cherry is dropped
+	got := fannedOut([]<-chan string{routes['a'], routes['b']})
+	if !slices.Equal(got[0], []string{"apple", "avocado"}) || !slices.Equal(got[1], []string{"bean", "beet"}) {
+		t.Errorf("got a %v and b %v, want [apple avocado] and [bean beet]", got[0], got[1])
+	}
+}
+
+func TestRouteStep(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	outputs, errs := pipeline.RouteStep(ctx, pipeline.FromSlice(ctx, []int{5, 0, 20000, -1, 7}),
+		func(total int) (pipeline.Outcome[string, int], error) {
+			switch {
+			case total < 0:
+				return pipeline.Outcome[string, int]{}, errBad
+			case total == 0:
+				return pipeline.To("skip", total), nil
+			case total > 10_000:
+				return pipeline.To("review", total), nil
+			default:
+				return pipeline.To("ok", total), nil
+			}
+		},
+		[]string{"ok", "review"},
+		pipeline.WithOrderedOutput(),
+	)
+
+	failures := make(chan []error)
+	go func() {
+		var got []error
+		for err := range errs {
+			got = append(got, err)
+		}
+		failures <- got
+	}()
+
+	// nothing is routed to skip, so 0 is dropped
+	got := fannedOut([]<-chan int{outputs["ok"], outputs["review"]})
+	if !slices.Equal(got[0], []int{5, 7}) || !slices.Equal(got[1], []int{20000}) {
+		t.Errorf("got ok %v and review %v, want [5 7] and [20000]", got[0], got[1])
+	}
+	if got := <-failures; len(got) != 1 || !errors.Is(got[0], errBad) {
+		t.Errorf("got errors %v, want %v", got, errBad)
+	}
+}
@@ -0,0 +1,101 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// Run replaces wiring steps up by hand: it starts the source, every step and
+// the sink and returns the first error, having cancelled everything else.
+func ExamplePipeline_Run() {
+	parse := func(s string) (string, error) {
+		if _, err := strconv.Atoi(s); err != nil {
+			return "", fmt.Errorf("parsing %q: %w", s, err)
+		}
+		return s, nil
+	}
+
+	err := pipeline.New(pipeline.SliceSource([]string{"1", "2", "x"})).
+		Then(parse, pipeline.WithName("parse")).
+		Sink(func(string) error { return nil }).
+		Run(context.Background())
+	fmt.Println(err)
+	// Output: parse: parsing "x": strconv.Atoi: parsing "x": invalid syntax
+}
+
+func TestRunJoinedErrors(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errSink := errors.New("sink")
+	err := pipeline.New(pipeline.SliceSource([]int{1, 2, 3})).
+		Then(func(v int) (int, error) {
+			if v == 1 {
+				return 0, errBad
+			}
+			return v, nil
+		}).
+		Sink(func(v int) error {
+			if v == 3 {
+				return errSink
+			}
+			return nil
+		}).
+		OnError(pipeline.CollectErrors()).
+		Run(context.Background())
+
+	if !errors.Is(err, errBad) || !errors.Is(err, errSink) {
+		t.Errorf("Run = %v, want both failures joined", err)
+	}
+}
+
+// TestRunCancelledWhileDraining cancels the run from its sink, giving the
+// source and the steps time to wind down and close their channels before
+// the sink returns, so Run finds them closed as well as ctx done; whichever
+// it notices first, it returns ctx's cause.
+func TestRunCancelledWhileDraining(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	errStop := errors.New("stop")
+	tests := []struct {
+		name    string
+		collect bool
+		cause   error
+		want    error
+	}{
+		{name: "cancelled", want: context.Canceled},
+		{name: "with a cause", cause: errStop, want: errStop},
+		{name: "collecting errors", collect: true, cause: errStop, want: errStop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				ctx, cancel := context.WithCancelCause(context.Background())
+				p := pipeline.New(pipeline.SliceSource([]int{1, 2, 3, 4, 5, 6, 7, 8})).
+					Then(func(v int) (int, error) { return v, nil }, pipeline.WithConcurrency(4)).
+					Sink(func(v int) error {
+						if v == 2 {
+							cancel(tt.cause)
+							time.Sleep(time.Millisecond)
+						}
+						return nil
+					})
+				if tt.collect {
+					p = p.OnError(pipeline.CollectErrors())
+				}
+
+				if err := p.Run(ctx); !errors.Is(err, tt.want) {
+					t.Fatalf("Run = %v, want %v", err, tt.want)
+				}
+				cancel(nil)
+			}
+		})
+	}
+}
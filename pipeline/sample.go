@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// Sampling decides which values Sample lets through. The zero value passes
+// every value.
+type Sampling struct {
+	mode   samplingMode
+	n      int
+	rate   float64
+	window time.Duration
+}
+
+type samplingMode int
+
+const (
+	sampleEvery samplingMode = iota
+	sampleRate
+	sampleReservoir
+)
+
+// SampleEvery passes the first value and every nth one after it, so a
+// stream of a million values yields a million/n of them at a steady rate.
+// An n of 1 or less passes every value.
+func SampleEvery(n int) Sampling {
+	return Sampling{mode: sampleEvery, n: max(n, 1)}
+}
+
+// SampleRate passes each value with probability rate, between 0 and 1,
+// independently of the others, so bursts are sampled as bursts.
+func SampleRate(rate float64) Sampling {
+	return Sampling{mode: sampleRate, rate: rate}
+}
+
+// SampleReservoir passes a uniform random sample of k values out of every
+// window, or out of the whole stream if window is 0, however many values
+// arrive in it. The sample is emitted in arrival order once the window ends,
+// or once in is closed, so memory is bounded by k rather than by the
+// stream.
+func SampleReservoir(k int, window time.Duration) Sampling {
+	return Sampling{mode: sampleReservoir, n: max(k, 0), window: window}
+}
+
+// Sample passes on a representative subset of the values from in, chosen
+// by s, e.g. for a debugging or observability branch split off with Tee
+// that can't keep up with everything:
+//
+//	branches := pipeline.Tee(ctx, events, 2, 0)
+//	go inspect(pipeline.Sample(ctx, branches[1], pipeline.SampleRate(0.01)))
+//
+// The output is closed once in is closed, after any pending reservoir
+// sample has been emitted, or once ctx is done. The values left out are
+// handed to the hook of WithDropHook as DroppedSampled.
+func Sample[T any](ctx context.Context, in <-chan T, s Sampling) <-chan T {
+	drop := dropHook(ctx)
+	if s.mode == sampleReservoir {
+		return reservoir(ctx, in, s.n, s.window, drop)
+	}
+
+	var seen int
+	return Filter(ctx, in, func(v T) bool {
+		var keep bool
+		if s.mode == sampleRate {
+			keep = rand.Float64() < s.rate
+		} else {
+			keep = s.n <= 1 || seen%s.n == 0
+			seen++
+		}
+		if !keep {
+			drop(v, DroppedSampled)
+		}
+		return keep
+	})
+}
+
+// reservoir implements SampleReservoir with Algorithm R.
+func reservoir[T any](ctx context.Context, in <-chan T, k int, window time.Duration, drop func(any, DropReason)) <-chan T {
+	// sampled values remember their position so they go out in arrival
+	// order
+	type sampled struct {
+		seq   int64
+		value T
+	}
+
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		var tick <-chan time.Time
+		if window > 0 {
+			ticker := ClockFrom(ctx).NewTicker(window)
+			defer ticker.Stop()
+			tick = ticker.C()
+		}
+
+		sample := make([]sampled, 0, k)
+		var seen int64
+		flush := func() bool {
+			slices.SortFunc(sample, func(a, b sampled) int {
+				return cmp.Compare(a.seq, b.seq)
+			})
+			for _, s := range sample {
+				select {
+				case <-ctx.Done():
+					return false
+				case outChannel <- s.value:
+				}
+			}
+			sample = sample[:0]
+			seen = 0
+
+			return true
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+				if !flush() {
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+
+				// the value replaces a random one already sampled with
+				// probability k/seen, leaving every value seen so far
+				// equally likely to be in the sample
+				seen++
+				if len(sample) < k {
+					sample = append(sample, sampled{seq: seen, value: v})
+					continue
+				}
+				if i := rand.Int63n(seen); i < int64(k) {
+					drop(sample[i].value, DroppedSampled)
+					sample[i] = sampled{seq: seen, value: v}
+				} else {
+					drop(v, DroppedSampled)
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
@@ -0,0 +1,88 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// upTo returns 1 to n.
+func upTo(n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = i + 1
+	}
+	return values
+}
+
+func TestSample(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	tests := []struct {
+		name string
+		s    pipeline.Sampling
+		want []int
+	}{
+		{name: "every 3rd", s: pipeline.SampleEvery(3), want: []int{1, 4, 7}},
+		{name: "every one", s: pipeline.SampleEvery(0), want: upTo(7)},
+		{name: "zero value", s: pipeline.Sampling{}, want: upTo(7)},
+		{name: "rate 0", s: pipeline.SampleRate(0), want: nil},
+		{name: "rate 1", s: pipeline.SampleRate(1), want: upTo(7)},
+		{name: "reservoir of the whole stream", s: pipeline.SampleReservoir(10, 0), want: upTo(7)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pipelinetest.Collect(t, pipeline.Sample(context.Background(), waiting(upTo(7)...), tt.s))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.Sample(context.Background(), waiting(upTo(10000)...), pipeline.SampleRate(0.5)))
+	if len(got) < 4000 || len(got) > 6000 {
+		t.Errorf("passed %d of 10000 values at rate 0.5", len(got))
+	}
+}
+
+func TestSampleReservoir(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.Sample(context.Background(), waiting(upTo(100)...), pipeline.SampleReservoir(5, 0)))
+	if len(got) != 5 || !slices.IsSorted(got) || got[0] < 1 || got[4] > 100 {
+		t.Errorf("got %v, want 5 of 1 to 100 in arrival order", got)
+	}
+}
+
+func TestSampleReservoirFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	in := make(chan int)
+	out := pipeline.Sample(ctx, in, pipeline.SampleReservoir(5, time.Minute))
+
+	in <- 1
+	in <- 2
+	clock.WaitForTimers(1)
+	assertNothing(t, out)
+	clock.Advance(time.Minute)
+	if got := []int{pipelinetest.Receive(t, out), pipelinetest.Receive(t, out)}; !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("got %v at the end of the window, want [1 2]", got)
+	}
+
+	// the window in progress is emitted with the input closing
+	in <- 3
+	close(in)
+	if got := pipelinetest.Collect(t, out); !slices.Equal(got, []int{3}) {
+		t.Errorf("got %v once the input closed, want [3]", got)
+	}
+}
@@ -0,0 +1,266 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FromTicker emits the current time every interval, starting one interval
+// from now, until ctx is done. Like time.Ticker it drops ticks for a slow
+// receiver rather than letting them pile up, so a run that overruns the
+// interval is followed by the next tick straight away, not by a burst.
+//
+// Feeding a chain of stages from it expresses a recurring job:
+//
+//	poll := pipeline.NewStageCtx(fetchOrders) // time.Time to []Order
+//	out, errs := pipeline.Compose3(poll, transform, store)(ctx, pipeline.FromTicker(ctx, time.Minute))
+func FromTicker(ctx context.Context, interval time.Duration) <-chan time.Time {
+	outChannel := make(chan time.Time)
+
+	go func() {
+		defer close(outChannel)
+
+		ticker := ClockFrom(ctx).NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C():
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- t:
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// TickerSource returns a Source emitting the time every interval, see
+// FromTicker. A pipeline started from it runs until ctx is done.
+func TickerSource(interval time.Duration) Source[time.Time] {
+	return func(ctx context.Context) (<-chan time.Time, error) {
+		return FromTicker(ctx, interval), nil
+	}
+}
+
+// CronSchedule is a schedule in the five field cron format: minute, hour,
+// day of month, month and day of week. Each field is a *, a value, a range
+// like 1-5 or a list of them like 1,15,30, optionally with a step like */15
+// or 8-18/2. Months and days of week can be given by their three letter
+// names, Sunday is 0 or 7. When both the day of month and the day of week
+// are restricted, a day matching either one is scheduled, as in cron.
+//
+// The descriptors @yearly (or @annually), @monthly, @weekly, @daily (or
+// @midnight) and @hourly stand for the usual expressions.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set when the field is a *, see dayMatches
+	domAny, dowAny bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonths = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronDays = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// ParseCron parses a cron expression, see CronSchedule.
+func ParseCron(expr string) (*CronSchedule, error) {
+	spec := strings.TrimSpace(expr)
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("pipeline: cron expression %q: want 5 fields, got %d", expr, len(fields))
+	}
+
+	var s CronSchedule
+	var err error
+	parse := func(field string, low, high int, names map[string]int) uint64 {
+		if err != nil {
+			return 0
+		}
+		var bits uint64
+		if bits, err = parseCronField(field, low, high, names); err != nil {
+			err = fmt.Errorf("pipeline: cron expression %q: %w", expr, err)
+		}
+		return bits
+	}
+	s.minute = parse(fields[0], 0, 59, nil)
+	s.hour = parse(fields[1], 0, 23, nil)
+	s.dom = parse(fields[2], 1, 31, nil)
+	s.month = parse(fields[3], 1, 12, cronMonths)
+	s.dow = parse(fields[4], 0, 7, cronDays)
+	if err != nil {
+		return nil, err
+	}
+
+	// 7 is another name for Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+
+	return &s, nil
+}
+
+// parseCronField returns the set of values field selects as a bit mask.
+func parseCronField(field string, low, high int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			step = n
+		}
+
+		lo, hi := low, high
+		if rng != "*" {
+			loText, hiText, isRange := strings.Cut(rng, "-")
+
+			var err error
+			if lo, err = cronValue(loText, names); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cronValue(hiText, names); err != nil {
+					return 0, fmt.Errorf("bad value in %q", part)
+				}
+			} else if hasStep {
+				// 5/15 means from 5 onwards
+				hi = high
+			}
+		}
+		if lo < low || hi > high || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, low, high)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func cronValue(text string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(text)]; ok {
+		return v, nil
+	}
+	return strconv.Atoi(text)
+}
+
+// Next returns the first scheduled time after t, in t's location, or the
+// zero time if there is none within five years, as for 0 0 30 2 *.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<t.Weekday()) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// FromCron emits the scheduled time whenever schedule comes due, in the
+// local time zone, until ctx is done. Times that pass while the receiver is
+// busy are skipped, the next one emitted is the first due after it is ready
+// again.
+//
+//	schedule, err := pipeline.ParseCron("*/15 8-18 * * mon-fri")
+//	if err != nil {
+//		return err
+//	}
+//	out, errs := pipeline.Compose2(poll, store)(ctx, pipeline.FromCron(ctx, schedule))
+func FromCron(ctx context.Context, schedule *CronSchedule) <-chan time.Time {
+	outChannel := make(chan time.Time)
+
+	go func() {
+		defer close(outChannel)
+
+		clock := ClockFrom(ctx)
+		for {
+			next := schedule.Next(clock.Now())
+			if next.IsZero() {
+				return
+			}
+
+			timer := clock.NewTimer(next.Sub(clock.Now()))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case outChannel <- next:
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// CronSource returns a Source emitting the times schedule comes due, see
+// FromCron.
+func CronSource(schedule *CronSchedule) Source[time.Time] {
+	return func(ctx context.Context) (<-chan time.Time, error) {
+		return FromCron(ctx, schedule), nil
+	}
+}
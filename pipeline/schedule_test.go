@@ -0,0 +1,95 @@
+package pipeline_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestCronNext(t *testing.T) {
+	// 1 January 2024 is a Monday
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{expr: "*/15 8-18 * * mon-fri", from: at(1, 0, 0), want: at(1, 8, 0)},
+		{expr: "*/15 8-18 * * mon-fri", from: at(1, 8, 0), want: at(1, 8, 15)},
+		{expr: "*/15 8-18 * * mon-fri", from: at(1, 18, 50), want: at(2, 8, 0)},
+		{expr: "*/15 8-18 * * mon-fri", from: at(5, 18, 45), want: at(8, 8, 0)},
+		{expr: "5/20 * * * *", from: at(1, 0, 5), want: at(1, 0, 25)},
+		{expr: "0 12 * * 7", from: at(1, 0, 0), want: at(7, 12, 0)},
+		{expr: "@daily", from: at(1, 10, 30), want: at(2, 0, 0)},
+		// a restricted day of month or day of week is enough
+		{expr: "0 0 3,15 * sun", from: at(1, 0, 0), want: at(3, 0, 0)},
+		{expr: "0 0 3,15 * sun", from: at(3, 0, 0), want: at(7, 0, 0)},
+		{expr: "0 0 30 2 *", from: at(1, 0, 0), want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		schedule, err := pipeline.ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) = %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next(%v) = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"x * * * *",
+		"* * * foo *",
+	} {
+		if _, err := pipeline.ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) = nil error, want one", expr)
+		}
+	}
+}
+
+func TestFromTickerFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+	start := clock.Now()
+
+	ticks, err := pipeline.TickerSource(time.Minute)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.WaitForTimers(1)
+	assertNothing(t, ticks)
+	clock.Advance(time.Minute)
+	if got := pipelinetest.Receive(t, ticks); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("got %v, want %v", got, start.Add(time.Minute))
+	}
+}
+
+func TestFromCronFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+	start := clock.Now()
+
+	schedule, err := pipeline.ParseCron("*/15 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := pipeline.FromCron(ctx, schedule)
+
+	clock.WaitForTimers(1)
+	clock.Advance(10 * time.Minute)
+	assertNothing(t, times)
+	clock.Advance(5 * time.Minute)
+	if got := pipelinetest.Receive(t, times); !got.Equal(start.Add(15 * time.Minute)) {
+		t.Errorf("got %v, want %v", got, start.Add(15*time.Minute))
+	}
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSecretNotFound is wrapped by the error a SecretsProvider returns for a
+// secret it doesn't have.
+var ErrSecretNotFound = errors.New("pipeline: secret not found")
+
+// SecretsProvider resolves the credentials connectors need, passwords, API
+// keys and the like, by name, so config files name them rather than hold
+// them: EnvSecrets and FileSecrets here, pipelinevault and
+// pipelinesecretsmanager for HashiCorp Vault and AWS Secrets Manager. It
+// must be safe for concurrent use.
+type SecretsProvider interface {
+	// Secret returns the current value of the secret called name, an
+	// error wrapping ErrSecretNotFound if there is none.
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// SecretsFunc adapts a func to a SecretsProvider.
+type SecretsFunc func(ctx context.Context, name string) (string, error)
+
+// Secret calls f.
+func (f SecretsFunc) Secret(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// EnvSecrets returns a SecretsProvider reading the secret called name from
+// the environment variable prefix+name.
+func EnvSecrets(prefix string) SecretsProvider {
+	return SecretsFunc(func(_ context.Context, name string) (string, error) {
+		v, ok := os.LookupEnv(prefix + name)
+		if !ok {
+			return "", fmt.Errorf("%w: $%s", ErrSecretNotFound, prefix+name)
+		}
+		return v, nil
+	})
+}
+
+// FileSecrets returns a SecretsProvider reading the secret called name from
+// the file of fsys at that path, without a trailing newline, e.g. from the
+// volume Kubernetes mounts a Secret as with os.DirFS("/etc/secrets"). Files
+// are read every time, so secrets rotated on disk are picked up.
+func FileSecrets(fsys fs.FS) SecretsProvider {
+	return SecretsFunc(func(_ context.Context, name string) (string, error) {
+		data, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+		if err != nil {
+			return "", fmt.Errorf("pipeline: reading secret: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	})
+}
+
+// Secret is a secret a connector resolves through a SecretsProvider when it
+// is set up, and again as it is rotated: its value is cached for a while,
+// then resolved anew, and Refresh resolves it at once, e.g. when the
+// credential it holds is rejected:
+//
+//	password := pipeline.NewSecret(secrets, "orders-db/password", 5*time.Minute)
+//	// resolved at start up, so a missing secret fails then
+//	pw, err := password.Value(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	db := connect(pw)
+//	...
+//	if err := db.Ping(ctx); isAuthError(err) {
+//		password.Refresh(ctx)
+//	}
+//
+// A Secret is safe for concurrent use.
+type Secret struct {
+	provider SecretsProvider
+	name     string
+	ttl      time.Duration
+
+	mu       sync.Mutex
+	value    string
+	resolved time.Time
+	ok       bool
+}
+
+// NewSecret returns the Secret called name in p, caching its value for ttl,
+// or until Refresh if ttl is 0.
+func NewSecret(p SecretsProvider, name string, ttl time.Duration) *Secret {
+	return &Secret{provider: p, name: name, ttl: ttl}
+}
+
+// Name returns the name of the secret.
+func (s *Secret) Name() string { return s.name }
+
+// Value returns the value of the secret, resolving it if it hasn't been or
+// its cached value is older than the Secret's ttl.
+func (s *Secret) Value(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ok && (s.ttl == 0 || ClockFrom(ctx).Now().Sub(s.resolved) < s.ttl) {
+		return s.value, nil
+	}
+	return s.resolve(ctx)
+}
+
+// Refresh resolves the secret again, whatever its cached value, and reports
+// whether its value changed.
+func (s *Secret) Refresh(ctx context.Context) (changed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, had := s.value, s.ok
+	v, err := s.resolve(ctx)
+	if err != nil {
+		return false, err
+	}
+	return had && v != old, nil
+}
+
+// resolve asks the provider for the secret, keeping the value cached
+// unless it fails.
+func (s *Secret) resolve(ctx context.Context) (string, error) {
+	v, err := s.provider.Secret(ctx, s.name)
+	if err != nil {
+		return "", fmt.Errorf("pipeline: secret %q: %w", s.name, err)
+	}
+	s.value, s.resolved, s.ok = v, ClockFrom(ctx).Now(), true
+	return v, nil
+}
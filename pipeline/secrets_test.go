@@ -0,0 +1,143 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestSecretsProviders(t *testing.T) {
+	t.Setenv("SECRET_DB_PASSWORD", "from-env")
+	files := fstest.MapFS{
+		"db/password": {Data: []byte("from-file\n")},
+	}
+
+	tests := []struct {
+		name     string
+		provider pipeline.SecretsProvider
+		secret   string
+		want     string
+		notFound bool
+	}{
+		{name: "env", provider: pipeline.EnvSecrets("SECRET_"), secret: "DB_PASSWORD", want: "from-env"},
+		{name: "env missing", provider: pipeline.EnvSecrets("SECRET_"), secret: "NOPE", notFound: true},
+		{name: "file", provider: pipeline.FileSecrets(files), secret: "db/password", want: "from-file"},
+		{name: "file missing", provider: pipeline.FileSecrets(files), secret: "db/nope", notFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.provider.Secret(context.Background(), tt.secret)
+			if tt.notFound {
+				if !errors.Is(err, pipeline.ErrSecretNotFound) {
+					t.Errorf("Secret = %q, %v, want ErrSecretNotFound", got, err)
+				}
+				return
+			}
+			if got != tt.want || err != nil {
+				t.Errorf("Secret = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// rotating is a SecretsProvider whose secret changes whenever rotate is
+// called, counting how often it is asked for it.
+type rotating struct {
+	mu      sync.Mutex
+	version int
+	fail    bool
+	calls   atomic.Int32
+}
+
+func (r *rotating) Secret(context.Context, string) (string, error) {
+	r.calls.Add(1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail {
+		return "", errBad
+	}
+	return "v" + strconv.Itoa(r.version), nil
+}
+
+func (r *rotating) rotate() {
+	r.mu.Lock()
+	r.version++
+	r.mu.Unlock()
+}
+
+func TestSecretRotation(t *testing.T) {
+	clock := pipelinetest.NewFakeClock(time.Unix(0, 0))
+	ctx := pipeline.WithClock(context.Background(), clock)
+	provider := &rotating{}
+	secret := pipeline.NewSecret(provider, "db", time.Minute)
+
+	value := func(want string) {
+		t.Helper()
+		if got, err := secret.Value(ctx); got != want || err != nil {
+			t.Errorf("Value = %q, %v, want %q", got, err, want)
+		}
+	}
+
+	value("v0")
+	provider.rotate()
+	// cached until the ttl is up
+	value("v0")
+	if provider.calls.Load() != 1 {
+		t.Errorf("provider asked %d times, want once while cached", provider.calls.Load())
+	}
+	clock.Advance(time.Minute)
+	value("v1")
+
+	provider.rotate()
+	if changed, err := secret.Refresh(ctx); !changed || err != nil {
+		t.Errorf("Refresh = %v, %v, want changed", changed, err)
+	}
+	value("v2")
+	if changed, err := secret.Refresh(ctx); changed || err != nil {
+		t.Errorf("Refresh = %v, %v, want unchanged", changed, err)
+	}
+
+	provider.mu.Lock()
+	provider.fail = true
+	provider.mu.Unlock()
+	if _, err := secret.Refresh(ctx); !errors.Is(err, errBad) {
+		t.Errorf("Refresh = %v, want the provider's error", err)
+	}
+	// the last value resolved stays cached
+	value("v2")
+}
+
+func TestSecretConcurrently(t *testing.T) {
+	provider := &rotating{}
+	secret := pipeline.NewSecret(provider, "db", 0)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if _, err := secret.Value(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				provider.rotate()
+				secret.Refresh(context.Background())
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"context"
+	"iter"
+)
+
+// ToSeq lets the output of a pipeline be consumed with a for range loop. The
+// sequence ends once in is closed or ctx is done. cancel should cancel the
+// context the pipeline runs with: it is called when the loop breaks early so
+// the stages upstream stop instead of blocking forever, and once the sequence
+// is exhausted. The sequence can only be ranged over once.
+func ToSeq[T any](ctx context.Context, cancel context.CancelFunc, in <-chan T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		defer cancel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok || !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ToSeq2 is ToSeq for a pipeline's results together with its errors. Each
+// result is yielded with a nil error and each error with the zero value of
+// T, in the order they arrive. The sequence ends once both channels are
+// closed or ctx is done; breaking out of the loop cancels the pipeline.
+func ToSeq2[T any](ctx context.Context, cancel context.CancelFunc, values <-chan T, errs <-chan error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer cancel()
+
+		var zero T
+		for values != nil || errs != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				if !yield(zero, err) {
+					return
+				}
+			case v, ok := <-values:
+				if !ok {
+					values = nil
+					continue
+				}
+				if !yield(v, nil) {
+					return
+				}
+			}
+		}
+	}
+}
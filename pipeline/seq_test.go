@@ -0,0 +1,76 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestToSeq(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got := slices.Collect(pipeline.ToSeq(ctx, cancel, pipeline.FromSlice(ctx, []int{1, 2, 3})))
+	if want := []int{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if ctx.Err() == nil {
+		t.Error("context not cancelled once the sequence was exhausted")
+	}
+}
+
+// TestToSeqBreak checks breaking out of the loop cancels the pipeline, so
+// its stages don't leak blocked on sending values nobody reads.
+func TestToSeqBreak(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out, errs := pipeline.Step(ctx, pipeline.FromSlice(ctx, []int{1, 2, 3, 4, 5}), func(v int) (int, error) { return v, nil })
+	for v := range pipeline.ToSeq(ctx, cancel, out) {
+		if v > 0 {
+			break
+		}
+	}
+	if ctx.Err() == nil {
+		t.Error("context not cancelled after breaking out of the loop")
+	}
+	pipelinetest.Collect(t, out)
+	pipelinetest.Collect(t, errs)
+}
+
+func TestToSeq2(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out, errs := pipeline.Step(ctx, pipeline.FromSlice(ctx, []int{1, 2, 3, 4}), func(v int) (int, error) {
+		if v%2 == 0 {
+			return 0, errBad
+		}
+		return v * 10, nil
+	})
+
+	var values []int
+	var failures int
+	for v, err := range pipeline.ToSeq2(ctx, cancel, out, errs) {
+		switch {
+		case err == nil:
+			values = append(values, v)
+		case errors.Is(err, errBad) && v == 0:
+			failures++
+		default:
+			t.Errorf("got %d, %v", v, err)
+		}
+	}
+
+	slices.Sort(values)
+	if want := []int{10, 30}; !slices.Equal(values, want) || failures != 2 {
+		t.Errorf("got %v and %d errors, want %v and 2 errors", values, failures, want)
+	}
+	if ctx.Err() == nil {
+		t.Error("context not cancelled once the sequence was exhausted")
+	}
+}
@@ -0,0 +1,225 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Membership tells ShardedSource which instances of a pipeline are running,
+// e.g. pipelineredis.Membership.
+type Membership interface {
+	Members(ctx context.Context) ([]string, error)
+}
+
+// ringPoints is how many points of a HashRing every member gets, enough to
+// spread keys within a few percent of evenly.
+const ringPoints = 128
+
+// HashRing assigns keys to members by consistent hashing: every member owns
+// the keys hashing onto its stretches of a ring, so when one joins or leaves
+// only the keys of the stretches it gains or gives up move. Every process
+// builds the same ring from the same members, whatever their order.
+type HashRing struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+// NewHashRing returns a HashRing over members.
+func NewHashRing(members []string) *HashRing {
+	r := &HashRing{owners: make(map[uint64]string, len(members)*ringPoints)}
+	for _, m := range members {
+		for i := range ringPoints {
+			h := ringHash(m + "#" + strconv.Itoa(i))
+			if owner, ok := r.owners[h]; ok {
+				// on the unlikely collision the lesser name wins, on every
+				// process
+				if m < owner {
+					r.owners[h] = m
+				}
+				continue
+			}
+			r.points = append(r.points, h)
+			r.owners[h] = m
+		}
+	}
+	slices.Sort(r.points)
+
+	return r
+}
+
+// Owner returns the member key belongs to, "" if the ring has none.
+func (r *HashRing) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	h := ringHash(key)
+	i, _ := slices.BinarySearch(r.points, h)
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[r.points[i]]
+}
+
+// ringHash must be the same in every process, unlike hash/maphash.
+func ringHash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// ShardedSource returns a Source running the sources of the shards, say the
+// partitions of a topic, that belong to self among the members of a
+// pipeline's instances, so the same binary can be scaled out with every
+// shard read by one instance. Shards are assigned with a HashRing over the
+// members, which are looked up again every interval: shards are handed
+// over as instances come and go, the source of one given up cancelled and
+// that of one taken over opened with open. Every instance must have the
+// same shards and self must be among the members, registered with
+// pipelineredis.Membership, say:
+//
+//	members := pipelineredis.NewMembership(client, "orders", hostname, 15*time.Second)
+//	leave, err := members.Join(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer leave()
+//
+//	source := pipeline.ShardedSource(hostname, partitions, members, 5*time.Second,
+//		func(partition string) pipeline.Source[Order] { ... })
+//
+// Instances find out about a change at their own time, so for up to an
+// interval a shard handed over may be read by both or neither of them; use
+// sources that carry on from a committed position and let Sink commit it.
+//
+// Failing to look up the members or to open a shard's source fails the
+// source when it starts. Later the shards are left as they are until the
+// next interval, which tries again. A shard's source that finishes isn't
+// opened again while the shard stays with self. The output channel is
+// closed once ctx is done and the shards' sources are stopped.
+func ShardedSource[T any](self string, shards []string, members Membership, interval time.Duration, open func(shard string) Source[T]) Source[T] {
+	return func(ctx context.Context) (<-chan T, error) {
+		current, err := members.Members(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: sharded source: %w", err)
+		}
+
+		s := &shardSet[T]{
+			self:    self,
+			shards:  shards,
+			open:    open,
+			out:     make(chan T),
+			running: make(map[string]context.CancelFunc),
+		}
+		if err := s.assign(ctx, current); err != nil {
+			s.stop()
+			return nil, fmt.Errorf("pipeline: sharded source: %w", err)
+		}
+
+		go func() {
+			ticker := ClockFrom(ctx).NewTicker(interval)
+			defer ticker.Stop()
+			defer s.stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C():
+					current, err := members.Members(ctx)
+					if err != nil {
+						continue
+					}
+					// shards failing to open are tried again next time
+					_ = s.assign(ctx, current)
+				}
+			}
+		}()
+
+		return s.out, nil
+	}
+}
+
+// shardSet is the state of a running ShardedSource.
+type shardSet[T any] struct {
+	self   string
+	shards []string
+	open   func(shard string) Source[T]
+	out    chan T
+	wg     sync.WaitGroup
+
+	// running cancels the source of every shard that belongs to self,
+	// also those that finished
+	running map[string]context.CancelFunc
+}
+
+// assign stops the sources of the shards self loses among members and opens
+// those of the shards it gains.
+func (s *shardSet[T]) assign(ctx context.Context, members []string) error {
+	ring := NewHashRing(members)
+	owned := make(map[string]bool)
+	for _, shard := range s.shards {
+		if ring.Owner(shard) == s.self {
+			owned[shard] = true
+		}
+	}
+
+	for shard, cancel := range s.running {
+		if !owned[shard] {
+			cancel()
+			delete(s.running, shard)
+		}
+	}
+
+	var errs []error
+	for _, shard := range s.shards {
+		if !owned[shard] || s.running[shard] != nil {
+			continue
+		}
+		if err := s.start(ctx, shard); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *shardSet[T]) start(ctx context.Context, shard string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	values, err := s.open(shard)(ctx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("shard %s: %w", shard, err)
+	}
+
+	s.running[shard] = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for v := range values {
+			select {
+			case <-ctx.Done():
+				return
+			case s.out <- v:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// stop cancels every shard's source, waits for them and closes the output.
+func (s *shardSet[T]) stop() {
+	for _, cancel := range s.running {
+		cancel()
+	}
+	s.wg.Wait()
+	close(s.out)
+}
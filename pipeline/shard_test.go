@@ -0,0 +1,243 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestHashRing(t *testing.T) {
+	keys := make([]string, 10_000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		if got := pipeline.NewHashRing(nil).Owner("a"); got != "" {
+			t.Errorf("Owner = %q, want \"\"", got)
+		}
+	})
+
+	t.Run("order", func(t *testing.T) {
+		a := pipeline.NewHashRing([]string{"a", "b", "c"})
+		b := pipeline.NewHashRing([]string{"c", "a", "b"})
+		for _, k := range keys {
+			if a.Owner(k) != b.Owner(k) {
+				t.Fatalf("%s belongs to %s and %s depending on the order of members", k, a.Owner(k), b.Owner(k))
+			}
+		}
+	})
+
+	t.Run("balance", func(t *testing.T) {
+		ring := pipeline.NewHashRing([]string{"a", "b", "c", "d"})
+		counts := make(map[string]int)
+		for _, k := range keys {
+			counts[ring.Owner(k)]++
+		}
+		for _, m := range []string{"a", "b", "c", "d"} {
+			if share := float64(counts[m]) / float64(len(keys)); share < 0.15 || share > 0.35 {
+				t.Errorf("%s owns %.0f%% of the keys, want about 25%%", m, share*100)
+			}
+		}
+	})
+
+	t.Run("join", func(t *testing.T) {
+		before := pipeline.NewHashRing([]string{"a", "b", "c"})
+		after := pipeline.NewHashRing([]string{"a", "b", "c", "d"})
+		moved := 0
+		for _, k := range keys {
+			if was, is := before.Owner(k), after.Owner(k); was != is {
+				if is != "d" {
+					t.Fatalf("%s moved from %s to %s, only keys moving to the new member should", k, was, is)
+				}
+				moved++
+			}
+		}
+		if moved == 0 {
+			t.Error("no keys moved to the new member")
+		}
+	})
+}
+
+// members is a Membership whose members the test sets.
+type members struct {
+	mu    sync.Mutex
+	names []string
+	err   error
+}
+
+func (m *members) Members(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.names), m.err
+}
+
+func (m *members) set(names ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.names = names
+}
+
+// shards runs shard sources that emit their shard's name and then wait to
+// be cancelled, keeping track of which are open.
+type shards struct {
+	mu   sync.Mutex
+	open map[string]bool
+	fail map[string]bool
+}
+
+func (s *shards) source(shard string) pipeline.Source[string] {
+	return func(ctx context.Context) (<-chan string, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail[shard] {
+			return nil, errBad
+		}
+		s.open[shard] = true
+
+		out := make(chan string)
+		go func() {
+			defer close(out)
+			select {
+			case <-ctx.Done():
+			case out <- shard:
+				<-ctx.Done()
+			}
+			s.mu.Lock()
+			delete(s.open, shard)
+			s.mu.Unlock()
+		}()
+		return out, nil
+	}
+}
+
+func (s *shards) opened() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.open {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestShardedSource(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+
+	all := []string{"p0", "p1", "p2", "p3", "p4", "p5", "p6", "p7"}
+	m := &members{names: []string{"self"}}
+	s := &shards{open: make(map[string]bool)}
+
+	out, err := pipeline.ShardedSource("self", all, m, time.Second, s.source)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for range all {
+		got = append(got, pipelinetest.Receive(t, out))
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, all) {
+		t.Fatalf("alone, read %v, want every shard", got)
+	}
+
+	// another instance joins and takes over its shards
+	ring := pipeline.NewHashRing([]string{"self", "other"})
+	var mine []string
+	for _, shard := range all {
+		if ring.Owner(shard) == "self" {
+			mine = append(mine, shard)
+		}
+	}
+	if len(mine) == 0 || len(mine) == len(all) {
+		t.Fatalf("test needs the shards split between the instances, self owns %v", mine)
+	}
+
+	m.set("self", "other")
+	clock.WaitForTimers(1)
+	clock.Advance(time.Second)
+	waitFor(t, "shards handed over", func() bool { return slices.Equal(s.opened(), mine) })
+	assertNothing(t, out)
+
+	// and leaves again, handing them back
+	m.set("self")
+	clock.WaitForTimers(1)
+	clock.Advance(time.Second)
+	got = got[:0]
+	for range len(all) - len(mine) {
+		got = append(got, pipelinetest.Receive(t, out))
+	}
+	for _, shard := range got {
+		if slices.Contains(mine, shard) {
+			t.Errorf("shard %s was opened again though it stayed", shard)
+		}
+	}
+
+	cancel()
+	pipelinetest.Collect(t, out)
+	if open := s.opened(); len(open) != 0 {
+		t.Errorf("shards %v still open after the source stopped", open)
+	}
+}
+
+func TestShardedSourceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		members *members
+		fail    map[string]bool
+	}{
+		{name: "members", members: &members{err: errBad}},
+		{name: "open", members: &members{names: []string{"self"}}, fail: map[string]bool{"p1": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			s := &shards{open: make(map[string]bool), fail: tt.fail}
+			source := pipeline.ShardedSource("self", []string{"p0", "p1"}, tt.members, time.Second, s.source)
+			if _, err := source(context.Background()); !errors.Is(err, errBad) {
+				t.Fatalf("error = %v, want %v", err, errBad)
+			}
+			waitFor(t, "shards closed", func() bool { return len(s.opened()) == 0 })
+		})
+	}
+}
+
+func TestShardedSourceRetriesOpen(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	m := &members{names: []string{"other"}}
+	s := &shards{open: make(map[string]bool), fail: map[string]bool{"p0": true}}
+	out, err := pipeline.ShardedSource("self", []string{"p0"}, m, time.Second, s.source)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// self takes over p0 but fails to open it, then succeeds next time
+	m.set("self")
+	clock.WaitForTimers(1)
+	clock.Advance(time.Second)
+	clock.WaitForTimers(1)
+	assertNothing(t, out)
+
+	s.mu.Lock()
+	s.fail = nil
+	s.mu.Unlock()
+	clock.Advance(time.Second)
+	if got := pipelinetest.Receive(t, out); got != "p0" {
+		t.Errorf("got %q, want p0", got)
+	}
+}
@@ -0,0 +1,277 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadProfile is how many values per second a simulation offers a
+// pipeline, at every point of the simulation, see Simulate.
+type LoadProfile func(at time.Duration) float64
+
+// Steady offers rate values per second throughout.
+func Steady(rate float64) LoadProfile {
+	return func(time.Duration) float64 { return rate }
+}
+
+// Ramp offers from values per second at first, growing evenly to to over
+// the given time and holding there after, to find the rate at which a
+// pipeline starts falling behind.
+func Ramp(from, to float64, over time.Duration) LoadProfile {
+	return func(at time.Duration) float64 {
+		if over <= 0 || at >= over {
+			return to
+		}
+		return from + (to-from)*float64(at)/float64(over)
+	}
+}
+
+// Burst offers base values per second, but for the first length of every
+// period of every, when it offers peak, to see how buffers soak up spikes
+// and how long the pipeline takes to recover from one.
+func Burst(base, peak float64, every, length time.Duration) LoadProfile {
+	return func(at time.Duration) float64 {
+		if every > 0 && at%every < length {
+			return peak
+		}
+		return base
+	}
+}
+
+// Simulation is how Simulate loads a pipeline.
+type Simulation[T any] struct {
+	// Load is the rate values are offered at.
+	Load LoadProfile
+	// Value returns the nth value offered, the zero value if nil.
+	Value func(n int64) T
+	// Duration is how long values are offered for, after which the
+	// pipeline is left to drain.
+	Duration time.Duration
+	// Interval is how often the pipeline is sampled, a twentieth of
+	// Duration if 0.
+	Interval time.Duration
+}
+
+// SimulationSample is what a simulated pipeline looked like at a point of
+// the simulation.
+type SimulationSample struct {
+	// At is how far into the simulation the sample was taken, and Rate the
+	// rate values were offered at then.
+	At   time.Duration
+	Rate float64
+	// Offered is how many values the load profile has offered so far, and
+	// Produced how many the pipeline has taken; the difference is the
+	// backlog building up in front of a pipeline that can't keep up.
+	Offered  int64
+	Produced int64
+	// Done, Failed and Skipped count the values of the run as for Progress,
+	// and Dropped how many results the steps' WithBackpressure policies
+	// discarded.
+	Done    int64
+	Failed  int64
+	Skipped int64
+	Dropped int64
+	// Stages reports every step, in order.
+	Stages []SimulationStage
+}
+
+// SimulationStage is the part of a SimulationSample about a step.
+type SimulationStage struct {
+	Name     string
+	InFlight int64
+	Queued   int64
+	Dropped  int64
+	// MeanLatency and MaxLatency are how long the step took over the values
+	// it processed since the previous sample, retries included, on average
+	// and at most, 0 if it processed none.
+	MeanLatency time.Duration
+	MaxLatency  time.Duration
+}
+
+// simulationTick is how often the source of a simulation catches up with
+// its load profile.
+const simulationTick = 10 * time.Millisecond
+
+// errNoLoad is returned by Simulate for a Simulation without a Load or a
+// Duration.
+var errNoLoad = errors.New("pipeline: simulation needs a load and a duration")
+
+// Simulate runs the pipeline build returns for the given source, which
+// offers values at the rate of sim's load profile, sampling how the
+// pipeline copes every interval, for capacity planning: how deep queues
+// get, what is dropped and how latencies evolve as load changes. A
+// pipeline without a Sink discards what it makes, a mock one, sleeping or
+// failing like the real one would, models what is downstream:
+//
+//	samples, err := pipeline.Simulate(ctx, pipeline.Simulation[Order]{
+//		Load:     pipeline.Burst(100, 2000, time.Minute, 5*time.Second),
+//		Duration: 5 * time.Minute,
+//	}, func(source pipeline.Source[Order]) *pipeline.Pipeline[Order] {
+//		return pipeline.New(source).
+//			Then(enrich, pipeline.WithConcurrency(8), pipeline.WithBuffer(100), pipeline.WithBackpressure(pipeline.DropOldest)).
+//			Sink(func(Order) error { time.Sleep(2 * time.Millisecond); return nil })
+//	})
+//
+// Values the pipeline isn't ready for are held back and offered as soon as
+// it is, so Offered runs ahead of Produced. Once sim's duration is up the
+// source is exhausted, and the last sample is taken when the pipeline has
+// drained, after Run returns, whose error Simulate returns along with the
+// samples. Time is kept by ctx's Clock, see ClockFrom.
+func Simulate[T any](ctx context.Context, sim Simulation[T], build func(Source[T]) *Pipeline[T]) ([]SimulationSample, error) {
+	if sim.Load == nil || sim.Duration <= 0 {
+		return nil, errNoLoad
+	}
+	interval := sim.Interval
+	if interval <= 0 {
+		interval = sim.Duration / 20
+	}
+	clock := ClockFrom(ctx)
+
+	s := &simulation{}
+	var start time.Time
+	source := GeneratorSource(func(ctx context.Context, emit func(T) error) error {
+		ticker := clock.NewTicker(simulationTick)
+		defer ticker.Stop()
+
+		// due is how many values have been offered up to offeredTo, catching
+		// up a tick at a time for those missed while emit was blocked
+		var due float64
+		var offeredTo time.Duration
+		var n int64
+		for {
+			at := clock.Now().Sub(start)
+			if at >= sim.Duration {
+				return nil
+			}
+			for ; offeredTo <= at; offeredTo += simulationTick {
+				due += sim.Load(offeredTo) * simulationTick.Seconds()
+			}
+			s.offered.Store(int64(due))
+			for ; n < int64(due); n++ {
+				var v T
+				if sim.Value != nil {
+					v = sim.Value(n)
+				}
+				if err := emit(v); err != nil {
+					return err
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C():
+			}
+		}
+	})
+
+	p := build(source)
+	p.hooks = p.hooks.and(Hooks{
+		OnItemProcessed: func(stage string, _ any, elapsed time.Duration) {
+			s.observe(stage, elapsed)
+		},
+		OnItemDropped: func(stage string, _ any, _ DropReason) {
+			s.drop(stage)
+		},
+	})
+
+	start = clock.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	var samples []SimulationSample
+	for {
+		select {
+		case err := <-done:
+			samples = append(samples, s.sample(p.Stats(), clock.Now().Sub(start), sim.Load))
+			return samples, err
+		case now := <-ticker.C():
+			samples = append(samples, s.sample(p.Stats(), now.Sub(start), sim.Load))
+		}
+	}
+}
+
+// simulation is what Simulate keeps track of on top of the pipeline's
+// Stats.
+type simulation struct {
+	offered atomic.Int64
+
+	mu     sync.Mutex
+	stages map[string]*simulatedStage
+}
+
+type simulatedStage struct {
+	dropped int64
+	// latency and max are of the values processed since the last sample
+	latency, max time.Duration
+	processed    int64
+}
+
+func (s *simulation) stage(name string) *simulatedStage {
+	if s.stages == nil {
+		s.stages = make(map[string]*simulatedStage)
+	}
+	st, ok := s.stages[name]
+	if !ok {
+		st = &simulatedStage{}
+		s.stages[name] = st
+	}
+	return st
+}
+
+func (s *simulation) observe(name string, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stage(name)
+	st.processed++
+	st.latency += elapsed
+	st.max = max(st.max, elapsed)
+}
+
+func (s *simulation) drop(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stage(name).dropped++
+}
+
+// sample turns stats into a sample taken at, starting the next interval's
+// latencies afresh.
+func (s *simulation) sample(stats Stats, at time.Duration, load LoadProfile) SimulationSample {
+	sample := SimulationSample{
+		At:       at,
+		Rate:     load(at),
+		Offered:  s.offered.Load(),
+		Produced: stats.Produced,
+		Done:     stats.Done,
+		Failed:   stats.Failed,
+		Skipped:  stats.Skipped,
+		Stages:   make([]SimulationStage, len(stats.Stages)),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, stage := range stats.Stages {
+		st := s.stage(stage.Name)
+		sample.Dropped += st.dropped
+		sample.Stages[i] = SimulationStage{
+			Name:       stage.Name,
+			InFlight:   stage.InFlight,
+			Queued:     stage.Queued,
+			Dropped:    st.dropped,
+			MaxLatency: st.max,
+		}
+		if st.processed > 0 {
+			sample.Stages[i].MeanLatency = st.latency / time.Duration(st.processed)
+		}
+		st.latency, st.max, st.processed = 0, 0, 0
+	}
+
+	return sample
+}
@@ -0,0 +1,43 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile pipeline.LoadProfile
+		at      time.Duration
+		want    float64
+	}{
+		{name: "steady", profile: pipeline.Steady(50), at: time.Hour, want: 50},
+		{name: "ramp start", profile: pipeline.Ramp(10, 110, 10*time.Second), at: 0, want: 10},
+		{name: "ramp halfway", profile: pipeline.Ramp(10, 110, 10*time.Second), at: 5 * time.Second, want: 60},
+		{name: "ramp held", profile: pipeline.Ramp(10, 110, 10*time.Second), at: time.Minute, want: 110},
+		{name: "ramp down", profile: pipeline.Ramp(100, 0, 10*time.Second), at: 2 * time.Second, want: 80},
+		{name: "burst", profile: pipeline.Burst(5, 500, time.Minute, time.Second), at: 2*time.Minute + 500*time.Millisecond, want: 500},
+		{name: "between bursts", profile: pipeline.Burst(5, 500, time.Minute, time.Second), at: 2*time.Minute + time.Second, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.profile(tt.at); got != tt.want {
+				t.Errorf("rate at %v = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimulateNeedsLoad(t *testing.T) {
+	build := func(source pipeline.Source[int]) *pipeline.Pipeline[int] { return pipeline.New(source) }
+	for _, sim := range []pipeline.Simulation[int]{{Duration: time.Second}, {Load: pipeline.Steady(1)}} {
+		if _, err := pipeline.Simulate(context.Background(), sim, build); err == nil {
+			t.Errorf("Simulate(%+v) succeeded, want an error", sim)
+		}
+	}
+}
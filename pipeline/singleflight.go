@@ -0,0 +1,39 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// WithSingleflight collapses concurrent calls of the step's fn for inputs
+// with the same keyFn(input) into one: while a call for a key is in flight,
+// other values with that key wait for it and get its result, or its error,
+// instead of calling fn themselves. This takes load off downstream APIs when
+// bursts of identical requests come through. In must be the step's input
+// type.
+//
+// The shared call runs with the context of the value that started it, so a
+// per-value timeout applies to that value's call. Results are shared as is,
+// so pointers, slices and maps in them point at the same data. Combine with
+// WithCache to also reuse results once the call has finished.
+func WithSingleflight[In any](keyFn func(In) string) StepOption {
+	return func(cfg *stepConfig) {
+		// a fresh group per step, even when the option value is shared
+		var group singleflight.Group
+
+		WithMiddleware(func(next StepFunc) StepFunc {
+			return func(ctx context.Context, v any) (any, error) {
+				in, err := as[In](v)
+				if err != nil {
+					return nil, fmt.Errorf("singleflight: %w", err)
+				}
+				out, err, _ := group.Do(keyFn(in), func() (any, error) {
+					return next(ctx, v)
+				})
+				return out, err
+			}
+		})(cfg)
+	}
+}
@@ -0,0 +1,30 @@
+package pipeline_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestWithSingleflightWrongTypes(t *testing.T) {
+	var calls atomic.Int64
+	identity := func(v int) (int, error) {
+		calls.Add(1)
+		return v, nil
+	}
+
+	// the key is declared for string inputs on an int step
+	_, errs := pipelinetest.RunStage(t, identity, []int{1},
+		pipeline.WithSingleflight(func(s string) string { return s }),
+	)
+
+	if len(errs) != 1 || !errors.Is(errs[0], pipeline.ErrUnexpectedType) {
+		t.Errorf("got errors %v, want an ErrUnexpectedType", errs)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("fn called %d times, want none", calls.Load())
+	}
+}
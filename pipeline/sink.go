@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SinkOption configures a Sink.
+type SinkOption func(*sinkConfig)
+
+type sinkConfig struct {
+	logger *slog.Logger
+	policy ErrorPolicy
+	cancel context.CancelCauseFunc
+}
+
+// WithSinkLogger makes Sink log to l instead of slog.Default().
+func WithSinkLogger(l *slog.Logger) SinkOption {
+	return func(cfg *sinkConfig) {
+		if l != nil {
+			cfg.logger = l
+		}
+	}
+}
+
+// WithSinkErrorPolicy makes Sink handle errors according to policy instead
+// of cancelling on the first one. With CollectErrors the joined failures are
+// logged once values is closed.
+func WithSinkErrorPolicy(policy ErrorPolicy) SinkOption {
+	return func(cfg *sinkConfig) {
+		cfg.policy = policy
+	}
+}
+
+// WithSinkCancelCause makes Sink cancel the pipeline through cancel, with
+// the error that stopped it as the cause, instead of through its cancelFunc,
+// so the stages can tell a failure from other reasons to stop, see
+// context.Cause.
+func WithSinkCancelCause(cancel context.CancelCauseFunc) SinkOption {
+	return func(cfg *sinkConfig) {
+		cfg.cancel = cancel
+	}
+}
+
+// Sink is the end of a pipeline. It logs every value it receives at debug
+// level and returns once values is closed or ctx is done. The first error
+// received from errs is logged and cancels the pipeline through cancelFunc,
+// see WithSinkErrorPolicy for other ways of handling errors.
+//
+// Logs go to slog.Default() unless WithSinkLogger is given.
+func Sink[T any](ctx context.Context, cancelFunc context.CancelFunc, values <-chan T, errs <-chan error, opts ...SinkOption) {
+	cfg := sinkConfig{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	logger := cfg.logger
+	tracker := &errorTracker{policy: cfg.policy}
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("pipeline stopped", "reason", context.Cause(ctx))
+			return
+
+		// the error policy decides whether an error stops the pipeline
+		case err, ok := <-errs:
+			if !ok {
+				// no more errors can arrive, stop selecting on the closed channel
+				errs = nil
+				continue
+			}
+			if stop := tracker.failed(err); stop != nil {
+				logger.Error("pipeline failed", "error", stop)
+				if cfg.cancel != nil {
+					cfg.cancel(stop)
+				} else {
+					cancelFunc()
+				}
+				continue
+			}
+			logger.Warn("value failed", "error", err)
+		case val, ok := <-values:
+			if ok {
+				tracker.succeeded()
+				logger.Debug("sink", "value", val)
+			} else {
+				if err := tracker.result(); err != nil {
+					logger.Error("pipeline finished with errors", "error", err)
+				}
+				logger.Info("done")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// SLO is a service level objective for a step: the share of the values it
+// finishes within a window that must be good, that is processed without an
+// error and, if Latency is set, within Latency. Skipped values don't count
+// either way.
+type SLO struct {
+	// Stage is the step's name, see WithName, or for an unnamed step the
+	// "step N" it is known as.
+	Stage string
+	// Name tells several SLOs of a step apart, e.g. "latency".
+	Name string
+	// Objective is the share of values that must be good, e.g. 0.999.
+	Objective float64
+	Latency   time.Duration
+	// Window is how far back compliance is measured. It is rounded up to
+	// a whole number of the intervals SLOs checks at.
+	Window time.Duration
+}
+
+// SLOReport is how a step is doing against an SLO over its window.
+type SLOReport struct {
+	SLO SLO
+	// Good and Bad count the values of the window.
+	Good int64
+	Bad  int64
+	// Compliance is the share of the values that were good, 1 if there
+	// were none.
+	Compliance float64
+	// BurnRate is how fast the window used up the error budget, the share
+	// of values the Objective allows to be bad: at 1 it runs out just as
+	// the window does, at 10 ten times as fast.
+	BurnRate float64
+	// Breached is set while Compliance is below the Objective.
+	Breached bool
+	At       time.Time
+}
+
+// SLOs tracks every step slos name against them while the pipeline runs,
+// checking every interval over their sliding windows. breach is called when
+// a step starts to miss an SLO, and again once it is met again, with
+// Breached cleared; SLOReports has the latest figures of all of them for
+// dashboards:
+//
+//	p.SLOs(10*time.Second, page,
+//		pipeline.SLO{Stage: "enrich", Name: "latency", Objective: 0.99, Latency: 200 * time.Millisecond, Window: 5 * time.Minute},
+//		pipeline.SLO{Stage: "store", Name: "errors", Objective: 0.999, Window: time.Hour})
+//
+// breach is called from a goroutine of its own, one report at a time, and
+// never after Run has returned.
+func (p *Pipeline[T]) SLOs(interval time.Duration, breach func(SLOReport), slos ...SLO) *Pipeline[T] {
+	p.sloEvery = interval
+	p.sloBreach = breach
+	p.slos = slos
+	return p
+}
+
+// SLOReports returns how the steps did against their SLOs at the latest
+// check of the current run, or of the last one until the next starts, in
+// the order the SLOs were given. It is safe to call from any goroutine.
+func (p *Pipeline[T]) SLOReports() []SLOReport {
+	p.mu.Lock()
+	tracker := p.slo
+	p.mu.Unlock()
+
+	if tracker == nil {
+		return nil
+	}
+	return tracker.reports()
+}
+
+// sloTracker counts the good and bad values of every SLO in buckets of an
+// interval each, the last of which is filling up.
+type sloTracker struct {
+	clock    Clock
+	interval time.Duration
+
+	mu     sync.Mutex
+	slos   []sloWindow
+	latest []SLOReport
+	breach func(SLOReport)
+}
+
+type sloWindow struct {
+	slo SLO
+	// good and bad are rings of buckets, current the one filling up
+	good, bad []int64
+	current   int
+}
+
+func newSLOTracker(clock Clock, interval time.Duration, slos []SLO, breach func(SLOReport)) *sloTracker {
+	t := &sloTracker{clock: clock, interval: interval, breach: breach}
+	for _, slo := range slos {
+		n := max(1, int(math.Ceil(float64(slo.Window)/float64(interval))))
+		t.slos = append(t.slos, sloWindow{slo: slo, good: make([]int64, n), bad: make([]int64, n)})
+	}
+
+	return t
+}
+
+// observer returns the option counting the values of the step named stage
+// towards its SLOs, nil if it has none.
+func (t *sloTracker) observer(stage string) StepOption {
+	var indexes []int
+	for i, w := range t.slos {
+		if w.slo.Stage == stage {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	return withObserver(func(elapsed time.Duration, err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		for _, i := range indexes {
+			w := &t.slos[i]
+			if err != nil || (w.slo.Latency > 0 && elapsed > w.slo.Latency) {
+				w.bad[w.current]++
+			} else {
+				w.good[w.current]++
+			}
+		}
+	})
+}
+
+// check reports on every SLO over its window, then starts the next bucket.
+func (t *sloTracker) check(now time.Time) {
+	t.mu.Lock()
+	reports := make([]SLOReport, len(t.slos))
+	for i := range t.slos {
+		w := &t.slos[i]
+		r := SLOReport{SLO: w.slo, Compliance: 1, At: now}
+		for j := range w.good {
+			r.Good += w.good[j]
+			r.Bad += w.bad[j]
+		}
+		if total := r.Good + r.Bad; total > 0 {
+			r.Compliance = float64(r.Good) / float64(total)
+			if budget := 1 - w.slo.Objective; budget > 0 {
+				r.BurnRate = (1 - r.Compliance) / budget
+			} else if r.Bad > 0 {
+				r.BurnRate = math.Inf(1)
+			}
+		}
+		r.Breached = r.Compliance < w.slo.Objective
+		reports[i] = r
+
+		w.current = (w.current + 1) % len(w.good)
+		w.good[w.current], w.bad[w.current] = 0, 0
+	}
+
+	previous := t.latest
+	t.latest = reports
+	t.mu.Unlock()
+
+	// unlocked, so breach may call SLOReports
+	if t.breach == nil {
+		return
+	}
+	for i, r := range reports {
+		if r.Breached != (previous != nil && previous[i].Breached) {
+			t.breach(r)
+		}
+	}
+}
+
+func (t *sloTracker) reports() []SLOReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]SLOReport(nil), t.latest...)
+}
+
+// run checks the SLOs every interval until the returned func is called,
+// which waits for it to stop.
+func (t *sloTracker) run(ctx context.Context) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := t.clock.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C():
+				t.check(now)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// withObserver is used by Pipeline to tell SLOs about every value a step
+// finishes, how long it took and whether it failed.
+func withObserver(observe func(elapsed time.Duration, err error)) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.observe = observe
+	}
+}
@@ -0,0 +1,123 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// runSLOs runs the step of script as "work" with slos checked every minute
+// until the returned func is called, which closes the source and checks
+// that the run went through.
+func runSLOs(t *testing.T, script *pipelinetest.Script[int, int], slos ...pipeline.SLO) (*pipeline.Pipeline[int], *pipelinetest.Source[int], *pipelinetest.FakeClock, <-chan pipeline.SLOReport, func()) {
+	t.Helper()
+	ctx, clock := fakeContext(t)
+
+	breaches := make(chan pipeline.SLOReport, 10)
+	src := pipelinetest.NewSource[int]()
+	p := pipeline.New(src.Open).
+		ThenCtx(script.Fn, pipeline.WithName("work"), pipeline.WithConcurrency(1)).
+		OnError(pipeline.SkipErrors()).
+		SLOs(time.Minute, func(r pipeline.SLOReport) { breaches <- r }, slos...)
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	clock.WaitForTimers(1)
+
+	return p, src, clock, breaches, func() {
+		t.Helper()
+		src.Close()
+		<-done
+	}
+}
+
+func TestSLOErrors(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	script := pipelinetest.NewScript(func(_ context.Context, v int) (int, error) { return v, nil }).
+		Fail(errBad).Fail(errBad)
+	slo := pipeline.SLO{Stage: "work", Name: "errors", Objective: 0.5, Window: 2 * time.Minute}
+	p, src, clock, breaches, stop := runSLOs(t, script, slo)
+	defer stop()
+
+	finished := func(n int) {
+		t.Helper()
+		waitFor(t, "the values to finish", func() bool {
+			s := p.Status().Stages[0]
+			return s.Processed+s.Failed == int64(n)
+		})
+	}
+
+	tests := []struct {
+		name           string
+		send           []int
+		wantGood       int64
+		wantBad        int64
+		wantBreached   bool
+		wantBreachCall bool
+		wantBurnRate   float64
+	}{
+		{name: "no values", wantBreached: false},
+		{name: "mostly failing", send: []int{1, 2, 3}, wantGood: 1, wantBad: 2, wantBreached: true, wantBreachCall: true, wantBurnRate: (2.0 / 3) / 0.5},
+		{name: "recovering", send: []int{4, 5}, wantGood: 3, wantBad: 2, wantBreachCall: true, wantBurnRate: 0.4 / 0.5},
+		{name: "failures out of the window", wantGood: 2},
+	}
+	sent := 0
+	for _, tt := range tests {
+		src.Send(t, tt.send...)
+		sent += len(tt.send)
+		finished(sent)
+		clock.Advance(time.Minute)
+
+		if tt.wantBreachCall {
+			r := pipelinetest.Receive(t, breaches)
+			if r.Breached != tt.wantBreached || r.SLO != slo {
+				t.Errorf("%s: breach called with %+v", tt.name, r)
+			}
+		}
+		waitFor(t, "the check", func() bool {
+			reports := p.SLOReports()
+			return len(reports) == 1 && reports[0].At.Equal(clock.Now())
+		})
+		r := p.SLOReports()[0]
+		if r.Good != tt.wantGood || r.Bad != tt.wantBad || r.Breached != tt.wantBreached {
+			t.Errorf("%s: got %d good, %d bad, breached %t; want %d, %d, %t", tt.name, r.Good, r.Bad, r.Breached, tt.wantGood, tt.wantBad, tt.wantBreached)
+		}
+		if diff := r.BurnRate - tt.wantBurnRate; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: burn rate %v, want %v", tt.name, r.BurnRate, tt.wantBurnRate)
+		}
+		assertNothing(t, breaches)
+	}
+}
+
+func TestSLOLatency(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	script := pipelinetest.NewScript(func(_ context.Context, v int) (int, error) { return v, nil }).
+		Hang()
+	slo := pipeline.SLO{Stage: "work", Objective: 0.9, Latency: 30 * time.Second, Window: time.Minute}
+	p, src, clock, breaches, stop := runSLOs(t, script, slo,
+		pipeline.SLO{Stage: "other", Objective: 0.9, Window: time.Minute})
+	defer stop()
+
+	// the first value takes a minute, the second none
+	src.Send(t, 1)
+	script.Next(t)
+	clock.Advance(time.Minute)
+	waitFor(t, "the check", func() bool { return len(p.SLOReports()) == 2 })
+	script.Release()
+	src.Send(t, 2)
+	waitFor(t, "the values to finish", func() bool { return p.Status().Stages[0].Processed == 2 })
+	clock.Advance(time.Minute)
+
+	r := pipelinetest.Receive(t, breaches)
+	if !r.Breached || r.Good != 1 || r.Bad != 1 || r.Compliance != 0.5 {
+		t.Errorf("breach called with %+v, want the slow value counted as bad", r)
+	}
+	if reports := p.SLOReports(); len(reports) != 2 || reports[1].Good+reports[1].Bad != 0 {
+		t.Errorf("SLOReports() = %+v, want nothing counted for other", reports)
+	}
+}
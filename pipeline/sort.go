@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"time"
+)
+
+// SortBuffered sorts the stream in chunks: it buffers up to size values, or
+// what arrived within maxWait of the first of them, see Batch, and emits them
+// ordered by less. Memory stays bounded by size, at the cost of order only
+// holding within each chunk. Values that compare equal keep their order of
+// arrival.
+func SortBuffered[T any](ctx context.Context, in <-chan T, size int, maxWait time.Duration, less func(a, b T) bool) <-chan T {
+	sorted := mapChannel(ctx, Batch(ctx, in, size, maxWait), func(batch []T) []T {
+		sort.SliceStable(batch, func(i, j int) bool {
+			return less(batch[i], batch[j])
+		})
+		return batch
+	})
+
+	return Flatten(ctx, sorted)
+}
+
+// TopK returns the k values read from in that come first according to less,
+// in that order, once in is closed. Only k values are kept in memory however
+// long the stream. If ctx is done first, the top k so far and the context's
+// cause are returned, see context.Cause.
+func TopK[T any](ctx context.Context, in <-chan T, k int, less func(a, b T) bool) ([]T, error) {
+	if k < 1 {
+		return nil, nil
+	}
+
+	// the root is the kept value that ranks last, the first to make way
+	h := &rankHeap[T]{less: less}
+	result := func() []T {
+		top := make([]T, len(h.values))
+		for i := len(top) - 1; i >= 0; i-- {
+			top[i] = heap.Pop(h).(T)
+		}
+		return top
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return result(), context.Cause(ctx)
+		case v, ok := <-in:
+			if !ok {
+				return result(), nil
+			}
+			if len(h.values) < k {
+				heap.Push(h, v)
+			} else if less(v, h.values[0]) {
+				h.values[0] = v
+				heap.Fix(h, 0)
+			}
+		}
+	}
+}
+
+type rankHeap[T any] struct {
+	values []T
+	less   func(a, b T) bool
+}
+
+func (h rankHeap[T]) Len() int           { return len(h.values) }
+func (h rankHeap[T]) Less(i, j int) bool { return h.less(h.values[j], h.values[i]) }
+func (h rankHeap[T]) Swap(i, j int)      { h.values[i], h.values[j] = h.values[j], h.values[i] }
+func (h *rankHeap[T]) Push(x any)        { h.values = append(h.values, x.(T)) }
+func (h *rankHeap[T]) Pop() any {
+	old := h.values
+	x := old[len(old)-1]
+	h.values = old[:len(old)-1]
+	return x
+}
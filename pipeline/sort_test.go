@@ -0,0 +1,63 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestSortBuffered(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	// only the tens are compared, the units tell equal values apart
+	byTens := func(a, b int) bool { return a/10 < b/10 }
+	got := pipelinetest.Collect(t, pipeline.SortBuffered(context.Background(), waiting(50, 31, 10, 32, 20, 1), 3, time.Hour, byTens))
+	if want := []int{10, 31, 50, 1, 20, 32}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want each chunk of 3 sorted, %v", got, want)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	ctx := context.Background()
+	greater := func(a, b int) bool { return a > b }
+
+	tests := []struct {
+		name   string
+		values []int
+		k      int
+		want   []int
+	}{
+		{name: "top 3", values: []int{5, 1, 9, 3, 7, 9, 2}, k: 3, want: []int{9, 9, 7}},
+		{name: "fewer than k", values: []int{2, 8}, k: 3, want: []int{8, 2}},
+		{name: "no k", values: []int{2, 8}, k: 0, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pipeline.TopK(ctx, waiting(tt.values...), tt.k, greater)
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("TopK = %v, %v, want %v, nil", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopKCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	go func() {
+		in <- 4
+		in <- 6
+		cancel()
+	}()
+
+	got, err := pipeline.TopK(ctx, in, 3, func(a, b int) bool { return a > b })
+	if !errors.Is(err, context.Canceled) || !slices.Equal(got, []int{6, 4}) {
+		t.Errorf("TopK = %v, %v, want [6 4], %v", got, err, context.Canceled)
+	}
+}
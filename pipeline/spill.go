@@ -0,0 +1,212 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spillSegmentSize is roughly how large a spill file grows before the next
+// one is started. Files are deleted as soon as they have been read back.
+const spillSegmentSize = 64 << 20
+
+// Spill sits between a producer that outpaces the rest of the pipeline and
+// the slow part, taking in values as fast as they arrive so the producer
+// never waits and nothing is dropped. Up to memory values are held in memory;
+// beyond that they are encoded with codec and appended to segment files in
+// dir, then read back in order once the consumer catches up. Values come out
+// in the order they went in.
+//
+// The files are a buffer, not a durable queue: whatever is still on disk is
+// deleted when the output closes, which happens once in is closed and
+// everything has been emitted, when ctx is done, or after a disk or codec
+// error, which is sent on the error channel first.
+func Spill[T any](ctx context.Context, in <-chan T, codec Codec[T], dir string, memory int) (<-chan T, <-chan error) {
+	outChannel := make(chan T)
+	errorChannel := make(chan error, 1)
+	memory = max(memory, 1)
+
+	go func() {
+		defer close(outChannel)
+		defer close(errorChannel)
+
+		disk := &spillFiles[T]{dir: dir, codec: codec}
+		defer disk.reset()
+
+		fail := func(err error) {
+			errorChannel <- fmt.Errorf("pipeline: spill: %w", err)
+		}
+
+		var (
+			mem     []T
+			next    T
+			hasNext bool
+		)
+		for in != nil || hasNext || len(mem) > 0 || disk.count > 0 {
+			if !hasNext {
+				switch {
+				case len(mem) > 0:
+					next, mem, hasNext = mem[0], mem[1:], true
+				case disk.count > 0:
+					v, err := disk.pop()
+					if err != nil {
+						fail(err)
+						return
+					}
+					next, hasNext = v, true
+				}
+			}
+
+			// a nil channel is never ready, so nothing is sent until there
+			// is something to send
+			var send chan<- T
+			if hasNext {
+				send = outChannel
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				// once spilling, everything goes to disk until it has been
+				// read back, otherwise values would overtake each other
+				if disk.count > 0 || len(mem) >= memory {
+					if err := disk.push(v); err != nil {
+						fail(err)
+						return
+					}
+					continue
+				}
+				mem = append(mem, v)
+			case send <- next:
+				var zero T
+				next, hasNext = zero, false
+			}
+		}
+	}()
+
+	return outChannel, errorChannel
+}
+
+// spillFiles is a queue of values in length-prefixed records across segment
+// files, written at the back and read at the front.
+type spillFiles[T any] struct {
+	dir   string
+	codec Codec[T]
+
+	segments []*spillSegment
+	writer   *os.File
+	reader   *bufio.Reader
+	readFile *os.File
+	// count is how many values are on disk and not read back yet
+	count int
+}
+
+type spillSegment struct {
+	path          string
+	size          int64
+	written, read int
+}
+
+func (s *spillFiles[T]) push(v T) error {
+	data, err := s.codec.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	if s.writer == nil || s.segments[len(s.segments)-1].size >= spillSegmentSize {
+		if err := s.roll(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	copy(record[4:], data)
+	// a single write, so the reader never sees half a record
+	if _, err := s.writer.Write(record); err != nil {
+		return err
+	}
+
+	seg := s.segments[len(s.segments)-1]
+	seg.size += int64(len(record))
+	seg.written++
+	s.count++
+	return nil
+}
+
+// roll starts a new segment file.
+func (s *spillFiles[T]) roll() error {
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.CreateTemp(s.dir, "spill-*.seg")
+	if err != nil {
+		return err
+	}
+
+	s.writer = f
+	s.segments = append(s.segments, &spillSegment{path: f.Name()})
+	return nil
+}
+
+func (s *spillFiles[T]) pop() (T, error) {
+	var zero T
+	seg := s.segments[0]
+
+	if s.reader == nil {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return zero, err
+		}
+		s.readFile, s.reader = f, bufio.NewReader(f)
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(s.reader, header[:]); err != nil {
+		return zero, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return zero, err
+	}
+	seg.read++
+	s.count--
+
+	switch {
+	case s.count == 0:
+		// everything has been read back, start afresh next time
+		s.reset()
+	case seg.read == seg.written && len(s.segments) > 1:
+		s.readFile.Close()
+		os.Remove(seg.path)
+		s.segments, s.readFile, s.reader = s.segments[1:], nil, nil
+	}
+
+	return s.codec.Decode(data)
+}
+
+// reset closes and deletes every segment file.
+func (s *spillFiles[T]) reset() {
+	if s.readFile != nil {
+		s.readFile.Close()
+	}
+	if s.writer != nil {
+		s.writer.Close()
+	}
+	for _, seg := range s.segments {
+		os.Remove(seg.path)
+	}
+
+	s.segments, s.writer, s.reader, s.readFile, s.count = nil, nil, nil, nil, 0
+}
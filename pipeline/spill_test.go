@@ -0,0 +1,128 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// failingCodec is a JSON codec failing to encode fail.
+type failingCodec struct {
+	pipeline.Codec[int]
+	fail int
+}
+
+func (c failingCodec) Encode(v int) ([]byte, error) {
+	if v == c.fail {
+		return nil, errBad
+	}
+	return c.Codec.Encode(v)
+}
+
+func TestSpill(t *testing.T) {
+	tests := []struct {
+		name   string
+		memory int
+		n      int
+		// spilled is whether the values don't all fit in memory
+		spilled bool
+	}{
+		{name: "in memory", memory: 100, n: 50},
+		{name: "spilled", memory: 10, n: 200, spilled: true},
+		{name: "spilled from the start", memory: 0, n: 200, spilled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			dir := t.TempDir()
+
+			in := make(chan int)
+			out, errs := pipeline.Spill(ctx, in, pipeline.JSONCodec[int](), dir, tt.memory)
+
+			// the producer never waits on the consumer
+			var want []int
+			for i := range tt.n {
+				select {
+				case in <- i:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("value %d not taken in", i)
+				}
+				want = append(want, i)
+			}
+			if files, _ := os.ReadDir(dir); (len(files) > 0) != tt.spilled {
+				t.Errorf("%d files in the spill directory, want spilled %v", len(files), tt.spilled)
+			}
+
+			// values spilled while others are read back stay in order
+			if got := pipelinetest.Receive(t, out); got != 0 {
+				t.Errorf("got %d first, want 0", got)
+			}
+			in <- tt.n
+			want = append(want, tt.n)
+			close(in)
+			got := append([]int{0}, pipelinetest.Collect(t, out)...)
+			if !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if failures := pipelinetest.Collect(t, errs); len(failures) > 0 {
+				t.Error(failures)
+			}
+			if files, _ := os.ReadDir(dir); len(files) > 0 {
+				t.Errorf("%d files left behind, want none", len(files))
+			}
+		})
+	}
+}
+
+func TestSpillStops(t *testing.T) {
+	tests := []struct {
+		name string
+		// stop ends the spill with some of the values on disk
+		stop    func(cancel context.CancelFunc, in chan<- int)
+		wantErr error
+	}{
+		{
+			name: "cancelled",
+			stop: func(cancel context.CancelFunc, in chan<- int) { cancel() },
+		},
+		{
+			name:    "value not encodable",
+			stop:    func(cancel context.CancelFunc, in chan<- int) { in <- -1 },
+			wantErr: errBad,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			dir := t.TempDir()
+
+			in := make(chan int)
+			out, errs := pipeline.Spill(ctx, in, failingCodec{Codec: pipeline.JSONCodec[int](), fail: -1}, dir, 1)
+			for i := range 10 {
+				in <- i
+			}
+			tt.stop(cancel, in)
+
+			pipelinetest.Collect(t, out)
+			failures := pipelinetest.Collect(t, errs)
+			if tt.wantErr == nil && len(failures) > 0 || tt.wantErr != nil && (len(failures) != 1 || !errors.Is(failures[0], tt.wantErr)) {
+				t.Errorf("failed with %v, want %v", failures, tt.wantErr)
+			}
+			if files, _ := os.ReadDir(dir); len(files) > 0 {
+				t.Errorf("%d files left behind, want none", len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+type stageNameKey struct{}
+
+// StageName returns the name of the step the call with ctx is running in,
+// see WithName, or "" outside a named step. A step started from within
+// another one, with the context its fn was called with, is named after both,
+// e.g. "enrich/lookup", so nested stages can be told apart.
+func StageName(ctx context.Context) string {
+	name, _ := ctx.Value(stageNameKey{}).(string)
+	return name
+}
+
+// withStageName returns a copy of ctx carrying the name of a step started
+// with it, nested in the name ctx already carries, and a matching "stage"
+// profiler label, so the step's goroutines can be told apart in pprof.
+func withStageName(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	if parent := StageName(ctx); parent != "" {
+		name = parent + "/" + name
+	}
+
+	ctx = context.WithValue(ctx, stageNameKey{}, name)
+	return pprof.WithLabels(ctx, pprof.Labels("stage", name))
+}
+
+// labelGoroutine sets the profiler labels of ctx on the calling goroutine if
+// the step has a label.
+func labelGoroutine(ctx context.Context, label string) {
+	if label != "" {
+		pprof.SetGoroutineLabels(ctx)
+	}
+}
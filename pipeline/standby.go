@@ -0,0 +1,283 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StandbyOption configures a Standby.
+type StandbyOption func(*standbyConfig)
+
+type standbyConfig struct {
+	follow      Checkpointer
+	followEvery time.Duration
+}
+
+// WithFollow has a Standby read the checkpoint of the pipeline from cp
+// every d while it stands by, keeping its connection to the checkpoint
+// store warm and the offset it would resume from at hand, see
+// Standby.Following.
+func WithFollow(cp Checkpointer, d time.Duration) StandbyOption {
+	return func(cfg *standbyConfig) {
+		cfg.follow = cp
+		cfg.followEvery = d
+	}
+}
+
+// Standby runs a pipeline on the one of its replicas elected leader and keeps
+// the others standing by, warm, to take over producing and processing as
+// soon as the leader's lease lapses, for high availability stream
+// processing:
+//
+//	leader := pipelineredis.NewLeader(client, "orders", hostname, 5*time.Second)
+//	cp := pipelineredis.NewCheckpointer(client, "orders:offset", 10)
+//	p := pipeline.New(source).Then(enrich).Sink(store).Checkpoint(cp, time.Second)
+//	err := pipeline.NewStandby(leader, p, pipeline.WithFollow(cp, time.Second)).Run(ctx)
+//
+// The pipeline checkpointing to a store the replicas share, the one taking
+// over carries on where the last leader saved its checkpoint, so how long
+// failing over takes is the lease's ttl; how many values are processed
+// again depends on how often the pipeline saves it. A leader that loses its
+// lease cancels its pipeline at once, so two replicas don't process the
+// same values for long, and stands by again.
+//
+// A Standby is a Runnable, so a Manager can run it, and is safe for
+// concurrent use.
+type Standby struct {
+	elector Elector
+	r       Runnable
+	cfg     standbyConfig
+
+	mu sync.Mutex
+	// done is closed once the current Run returns, nil if there is none
+	done chan struct{}
+	// resign ends the current term, or campaign
+	resign   context.CancelFunc
+	active   bool
+	stopping bool
+	// offset and followErr are what following the checkpoint last read
+	offset    int64
+	followErr error
+}
+
+var _ Runnable = (*Standby)(nil)
+
+// NewStandby returns a Standby running r on the replica elector elects.
+func NewStandby(elector Elector, r Runnable, opts ...StandbyOption) *Standby {
+	var cfg standbyConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Standby{elector: elector, r: r, cfg: cfg}
+}
+
+// Run stands by until the replica is elected, runs the pipeline for as long
+// as it is the leader and stands by again once it isn't, until ctx is done,
+// whose cause it returns, or the pipeline returns on the leader, with what
+// it returned, giving up the lease.
+func (s *Standby) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.done != nil {
+		s.mu.Unlock()
+		return ErrRunning
+	}
+	done := make(chan struct{})
+	s.done, s.stopping = done, false
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.done, s.resign, s.active = nil, nil, false
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	for {
+		finished, err := s.term(ctx)
+		if finished {
+			return err
+		}
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		s.mu.Lock()
+		stopping := s.stopping
+		s.mu.Unlock()
+		if stopping {
+			return nil
+		}
+	}
+}
+
+// term campaigns and runs the pipeline for as long as the replica is the
+// leader, reporting whether it returned, and with what.
+func (s *Standby) term(ctx context.Context) (finished bool, err error) {
+	term, resign := context.WithCancel(ctx)
+	defer resign()
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.resign = resign
+	s.mu.Unlock()
+
+	stopFollowing := s.follow(term)
+	lost, err := s.elector.Campaign(term)
+	stopFollowing()
+	if err != nil {
+		return false, nil
+	}
+	// resigning and waiting for it keeps the terms of the replica apart
+	defer func() {
+		resign()
+		<-lost
+	}()
+
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.active = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.active = false
+		s.mu.Unlock()
+	}()
+
+	ran := make(chan error, 1)
+	go func() {
+		ran <- s.r.Run(term)
+	}()
+	select {
+	case err := <-ran:
+		return true, err
+	case <-lost:
+		resign()
+		<-ran
+		return false, nil
+	}
+}
+
+// follow reads the checkpoint every followEvery until ctx is done or the
+// func it returns is called, which waits for it to stop.
+func (s *Standby) follow(ctx context.Context) (stop func()) {
+	if s.cfg.follow == nil || s.cfg.followEvery <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := ClockFrom(ctx).NewTicker(s.cfg.followEvery)
+		defer ticker.Stop()
+		for {
+			offset, err := s.cfg.follow.Load(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			s.mu.Lock()
+			if err == nil {
+				s.offset = offset
+			}
+			s.followErr = err
+			s.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// Active reports whether the replica is the leader, running the pipeline.
+func (s *Standby) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// Following returns the offset the checkpoint was at when last read while
+// standing by, see WithFollow, and the error reading it last failed with,
+// nil if it didn't.
+func (s *Standby) Following() (offset int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset, s.followErr
+}
+
+// Drain stops the Standby: the leader drains its pipeline, see
+// Pipeline.Drain, and gives up its lease, a replica standing by stops
+// campaigning. Run returns nil, or what the pipeline did. Drain returns nil
+// straight away if the Standby isn't running.
+func (s *Standby) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	done, active, resign := s.done, s.active, s.resign
+	if done != nil {
+		s.stopping = true
+	}
+	s.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+
+	if !active {
+		if resign != nil {
+			resign()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			return nil
+		}
+	}
+
+	clock := ClockFrom(ctx)
+	for {
+		if err := s.r.Drain(ctx); err != nil {
+			return err
+		}
+		// Drain returns straight away if the pipeline hadn't started yet
+		timer := clock.NewTimer(stopRetry)
+		select {
+		case <-done:
+			timer.Stop()
+			return nil
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// Status returns the Status of the pipeline, which only runs on the leader.
+func (s *Standby) Status() Status {
+	return s.r.Status()
+}
+
+// Stats returns the Stats of the pipeline.
+func (s *Standby) Stats() Stats {
+	return s.r.Stats()
+}
+
+// share subjects the pipeline to a Manager's shared limits, if it can take
+// them.
+func (s *Standby) share(limits *sharedLimits) {
+	if sh, ok := s.r.(sharer); ok {
+		sh.share(limits)
+	}
+}
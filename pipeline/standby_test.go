@@ -0,0 +1,163 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// runStandby runs s in the background, returning what Run returned on the
+// channel.
+func runStandby(ctx context.Context, s *pipeline.Standby) <-chan error {
+	ran := make(chan error, 1)
+	go func() {
+		ran <- s.Run(ctx)
+	}()
+	return ran
+}
+
+func TestStandbyFailover(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	e := newElector()
+	c := &counter{}
+	cp := &pipeline.MemoryCheckpointer{}
+	cp.Save(context.Background(), 7)
+	s := pipeline.NewStandby(e, pipeline.New(c.source).Sink(func(int) error { return nil }),
+		pipeline.WithFollow(cp, time.Millisecond))
+	ran := runStandby(context.Background(), s)
+
+	// standing by, following the leader's checkpoint
+	waitFor(t, "the checkpoint to be followed", func() bool {
+		offset, err := s.Following()
+		return offset == 7 && err == nil
+	})
+	if s.Active() || c.opened.Load() != 0 {
+		t.Fatal("the pipeline runs while standing by")
+	}
+
+	depose := e.win(t)
+	waitFor(t, "the pipeline to run on the leader", func() bool { return s.Active() && c.running.Load() == 1 })
+
+	// the lease lapses: the pipeline stops at once and the replica stands by
+	cp.Save(context.Background(), 9)
+	depose()
+	waitFor(t, "the pipeline to stop", func() bool { return !s.Active() && c.running.Load() == 0 })
+	waitFor(t, "the checkpoint to be followed again", func() bool {
+		offset, _ := s.Following()
+		return offset == 9
+	})
+
+	e.win(t)
+	waitFor(t, "the pipeline to run again", func() bool { return c.opened.Load() == 2 && c.running.Load() == 1 })
+	if err := s.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ran; err != nil {
+		t.Errorf("Run = %v, want nil once drained", err)
+	}
+	if e.resigns.Load() != 1 {
+		t.Errorf("resigned %d times, want once, once drained", e.resigns.Load())
+	}
+}
+
+func TestStandbyEnds(t *testing.T) {
+	failing := func(context.Context) (<-chan int, error) { return nil, errBad }
+
+	tests := []struct {
+		name string
+		// elect elects the replica before end ends the Standby
+		elect   bool
+		source  pipeline.Source[int]
+		end     func(cancel context.CancelFunc, s *pipeline.Standby) error
+		wantErr error
+	}{
+		{
+			name:   "drained standing by",
+			source: blockingSource,
+			end:    func(_ context.CancelFunc, s *pipeline.Standby) error { return s.Drain(context.Background()) },
+		},
+		{
+			name:    "cancelled standing by",
+			source:  blockingSource,
+			end:     func(cancel context.CancelFunc, _ *pipeline.Standby) error { cancel(); return nil },
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "cancelled leading",
+			elect:   true,
+			source:  blockingSource,
+			end:     func(cancel context.CancelFunc, _ *pipeline.Standby) error { cancel(); return nil },
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "pipeline fails",
+			elect:   true,
+			source:  failing,
+			end:     func(context.CancelFunc, *pipeline.Standby) error { return nil },
+			wantErr: errBad,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+
+			e := newElector()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s := pipeline.NewStandby(e, pipeline.New(tt.source))
+			ran := runStandby(ctx, s)
+			waitFor(t, "the replica to campaign", func() bool { return e.campaigns.Load() > 0 })
+			if tt.elect {
+				e.win(t)
+			}
+
+			if err := tt.end(cancel, s); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-ran:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Run = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run didn't return")
+			}
+			if tt.elect && e.resigns.Load() != 1 {
+				t.Errorf("resigned %d times, want once", e.resigns.Load())
+			}
+		})
+	}
+}
+
+func TestStandbyManaged(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	e := newElector()
+	m := pipeline.NewManager(context.Background(), pipeline.WithWorkerBudget(2))
+	s := pipeline.NewStandby(e, pipeline.New(blockingSource).Then(func(v int) (int, error) { return v, nil }))
+	if err := m.Add("orders", s); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("orders"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the replica to campaign", func() bool { return e.campaigns.Load() > 0 })
+	if err := s.Run(context.Background()); !errors.Is(err, pipeline.ErrRunning) {
+		t.Errorf("second Run = %v, want ErrRunning", err)
+	}
+
+	e.win(t)
+	waitFor(t, "the pipeline to run", func() bool { return m.Stats()["orders"].Done > 0 })
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Err("orders"); err != nil {
+		t.Errorf("Err = %v, want nil once drained", err)
+	}
+}
@@ -0,0 +1,206 @@
+package pipeline
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// KeyedState holds the per-key state of a StatefulStep. It is safe for
+// concurrent use, so the state can be inspected, snapshotted or trimmed while
+// the step runs.
+type KeyedState[K comparable, S any] struct {
+	mu     sync.Mutex
+	states map[K]S
+}
+
+// NewKeyedState returns a KeyedState starting out with a copy of initial,
+// which may be nil, e.g. to restore a Snapshot taken by an earlier run.
+func NewKeyedState[K comparable, S any](initial map[K]S) *KeyedState[K, S] {
+	states := maps.Clone(initial)
+	if states == nil {
+		states = make(map[K]S)
+	}
+
+	return &KeyedState[K, S]{states: states}
+}
+
+// Get returns the state of key and whether there is any.
+func (s *KeyedState[K, S]) Get(key K) (S, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key]
+	return state, ok
+}
+
+// Delete forgets the state of key, the next value for it starts from the
+// zero state, e.g. once a session has been closed.
+func (s *KeyedState[K, S]) Delete(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.states, key)
+}
+
+// Len returns how many keys have state.
+func (s *KeyedState[K, S]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.states)
+}
+
+// Snapshot returns a copy of every key's state. The copy is shallow: state
+// holding pointers, slices or maps shares them with the step.
+func (s *KeyedState[K, S]) Snapshot() map[K]S {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.states)
+}
+
+func (s *KeyedState[K, S]) set(key K, state S) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[key] = state
+}
+
+// StatefulStep is a Step whose fn is handed the current state of the value's
+// key, as returned by keyFn, and returns the key's new state along with its
+// result, for running counters, sessionization or dedupe:
+//
+//	counts := pipeline.NewKeyedState[string, int](nil)
+//	out, errs := pipeline.StatefulStep(ctx, clicks, counts,
+//		func(c Click) string { return c.UserID },
+//		func(n int, c Click) (int, UserClicks, error) {
+//			return n + 1, UserClicks{User: c.UserID, Total: n + 1}, nil
+//		},
+//	)
+//
+// A key starts from the zero value of S. When fn fails the key keeps its
+// previous state, so a retry sees the same state again. So does a key whose
+// call times out with WithItemTimeout: fn runs on in the background, but its
+// new state is dropped rather than overwriting that of later values.
+//
+// Values are partitioned by key over the step's concurrency, see
+// PartitionBy, and the values of a key are processed one at a time in
+// arrival order, so fn never sees the same key's state twice at once. The
+// output of different keys interleaves. WithAutoscale and WithOrderedOutput
+// don't apply. With WithWorkerPool every partition is a worker of its own,
+// see WorkerID.
+func StatefulStep[In any, Out any, K comparable, S any](
+	ctx context.Context,
+	inputChannel <-chan In,
+	state *KeyedState[K, S],
+	keyFn func(In) K,
+	fn func(state S, in In) (S, Out, error),
+	opts ...StepOption,
+) (<-chan Out, <-chan error) {
+	call := func(ctx context.Context, in In) (Out, error) {
+		key := keyFn(in)
+		current, _ := state.Get(key)
+
+		next, out, err := fn(current, in)
+		if err != nil {
+			return out, err
+		}
+		if !claimCall(ctx) {
+			// timed out, the key has moved on without this call
+			return out, ctx.Err()
+		}
+		state.set(key, next)
+		return out, nil
+	}
+
+	cfg := newStepConfig(opts)
+	if cfg.budget > 0 {
+		// the budget is the whole step's, not every partition's
+		return withBudget(ctx, cfg, func(ctx context.Context, cfg stepConfig) (<-chan Out, <-chan error) {
+			return runPartitions(ctx, inputChannel, keyFn, call, cfg)
+		})
+	}
+
+	return runPartitions(ctx, inputChannel, keyFn, call, cfg)
+}
+
+// runPartitions runs a step of its own working through one value at a time
+// for every partition of the input, calling the stage hooks once for them
+// all.
+func runPartitions[In any, Out any, K comparable](
+	ctx context.Context,
+	inputChannel <-chan In,
+	keyFn func(In) K,
+	call func(context.Context, In) (Out, error),
+	cfg stepConfig,
+) (<-chan Out, <-chan error) {
+	partitions := PartitionBy(ctx, inputChannel, keyFn, cfg.concurrency)
+
+	hooks := cfg.hooks
+	partitionCfg := cfg
+	partitionCfg.concurrency = 1
+	partitionCfg.scaleMax = 0
+	partitionCfg.ordered = false
+	partitionCfg.hooks.OnStageStart = nil
+	partitionCfg.hooks.OnStageDone = nil
+
+	if hooks.OnStageStart != nil {
+		hooks.OnStageStart(cfg.label)
+	}
+	outputs := make([]<-chan Out, len(partitions))
+	errs := make([]<-chan error, len(partitions))
+	for i, p := range partitions {
+		// with WithWorkerPool, every partition is a worker
+		partitionCfg.firstWorker = i
+		outputs[i], errs[i] = runStep(ctx, p, call, partitionCfg)
+	}
+	values, failures := Merge(ctx, outputs...), Merge(ctx, errs...)
+	if hooks.OnStageDone == nil {
+		return values, failures
+	}
+
+	return beforeClose(ctx, values, failures, func() {
+		hooks.OnStageDone(cfg.label)
+	})
+}
+
+// beforeClose forwards values and errs until both are closed, or ctx is
+// done, calling done right before closing the channels it returns.
+func beforeClose[T any](ctx context.Context, values <-chan T, errs <-chan error, done func()) (<-chan T, <-chan error) {
+	out := make(chan T)
+	outErrs := make(chan error)
+
+	go func() {
+		defer close(out)
+		defer close(outErrs)
+		defer done()
+
+		for values != nil || errs != nil {
+			select {
+			case v, ok := <-values:
+				if !ok {
+					values = nil
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case out <- v:
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case outErrs <- err:
+				}
+			}
+		}
+	}()
+
+	return out, outErrs
+}
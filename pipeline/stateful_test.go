@@ -0,0 +1,166 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestStatefulStepCounts(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	var inputs []string
+	for range 100 {
+		inputs = append(inputs, "a", "b", "c")
+	}
+	counts := pipeline.NewKeyedState[string, int](nil)
+	out, errs := pipeline.StatefulStep(ctx, pipeline.FromSlice(ctx, inputs), counts,
+		func(s string) string { return s },
+		func(n int, s string) (int, int, error) { return n + 1, n + 1, nil },
+		pipeline.WithConcurrency(4),
+	)
+	got := pipelinetest.Collect(t, out)
+	if failures := pipelinetest.Collect(t, errs); len(failures) > 0 {
+		t.Fatal(failures)
+	}
+
+	if len(got) != len(inputs) {
+		t.Fatalf("got %d results, want %d", len(got), len(inputs))
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if n, _ := counts.Get(key); n != 100 {
+			t.Errorf("state of %s is %d, want 100", key, n)
+		}
+	}
+}
+
+func TestStatefulStepStageHooksOnce(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	var starts, dones atomic.Int64
+	var processed atomic.Int64
+	out, errs := pipeline.StatefulStep(ctx, pipeline.FromSlice(ctx, []int{1, 2, 3, 4, 5, 6, 7, 8}),
+		pipeline.NewKeyedState[int, int](nil),
+		func(v int) int { return v },
+		func(n, v int) (int, int, error) { return n, v, nil },
+		pipeline.WithConcurrency(4),
+		pipeline.WithHooks(pipeline.Hooks{
+			OnStageStart:    func(string) { starts.Add(1) },
+			OnItemProcessed: func(string, any, time.Duration) { processed.Add(1) },
+			OnStageDone: func(string) {
+				if processed.Load() != 8 {
+					t.Errorf("OnStageDone called after %d values, want 8", processed.Load())
+				}
+				dones.Add(1)
+			},
+		}),
+	)
+	pipelinetest.Collect(t, out)
+	pipelinetest.Collect(t, errs)
+
+	if starts.Load() != 1 || dones.Load() != 1 {
+		t.Errorf("OnStageStart called %d times and OnStageDone %d times, want 1 each", starts.Load(), dones.Load())
+	}
+}
+
+func TestStatefulStepBudgetOnce(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	in := make(chan int)
+	defer close(in)
+	out, errs := pipeline.StatefulStep(ctx, in,
+		pipeline.NewKeyedState[int, int](nil),
+		func(v int) int { return v },
+		func(n, v int) (int, int, error) { return n, v, nil },
+		pipeline.WithConcurrency(4),
+		pipeline.WithBudget(10*time.Millisecond),
+	)
+	pipelinetest.Collect(t, out)
+	failures := pipelinetest.Collect(t, errs)
+
+	if len(failures) != 1 || !errors.Is(failures[0], pipeline.ErrBudgetExceeded) {
+		t.Errorf("got errors %v, want a single ErrBudgetExceeded", failures)
+	}
+}
+
+func TestStatefulStepWorkerIDs(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	ids := make(map[int]bool)
+	out, errs := pipeline.StatefulStep(ctx, pipeline.FromSlice(ctx, []int{1, 2, 3}),
+		pipeline.NewKeyedState[int, int](nil),
+		func(v int) int { return v },
+		func(n, v int) (int, int, error) { return n, v, nil },
+		pipeline.WithConcurrency(4),
+		pipeline.WithWorkerInit(func(ctx context.Context) (int, error) {
+			id, _ := pipeline.WorkerID(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			ids[id] = true
+			return id, nil
+		}),
+	)
+	pipelinetest.Collect(t, out)
+	pipelinetest.Collect(t, errs)
+
+	if len(ids) != 4 {
+		t.Errorf("workers started with ids %v, want 0 to 3", ids)
+	}
+}
+
+// TestStatefulStepTimeout checks a call that timed out doesn't overwrite the
+// state of the values after it once its fn returns.
+func TestStatefulStepTimeout(t *testing.T) {
+	counts := pipeline.NewKeyedState[string, int](nil)
+	// runs once VerifyNoLeaks has seen the timed out call return
+	t.Cleanup(func() {
+		if n, _ := counts.Get("a"); n != 1 {
+			t.Errorf("state of a is %d, want 1", n)
+		}
+	})
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	in := make(chan int)
+	started, release := make(chan struct{}), make(chan struct{})
+	out, errs := pipeline.StatefulStep(ctx, in, counts,
+		func(int) string { return "a" },
+		func(n, v int) (int, int, error) {
+			if v == 1 {
+				close(started)
+				<-release
+				return 100, v, nil
+			}
+			return n + 1, v, nil
+		},
+		pipeline.WithItemTimeout(time.Second),
+	)
+
+	in <- 1
+	<-started
+	clock.WaitForTimers(1)
+	clock.Advance(time.Second)
+	if err := pipelinetest.Receive(t, errs); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	in <- 2
+	if v := pipelinetest.Receive(t, out); v != 2 {
+		t.Errorf("got %d, want 2", v)
+	}
+	close(release)
+	close(in)
+	pipelinetest.Collect(t, out)
+	pipelinetest.Collect(t, errs)
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import "time"
+
+// Stats is a snapshot of what a pipeline's run has done, see Pipeline.Stats,
+// for an application embedding the pipeline to expose however it likes. It
+// shares nothing with the pipeline, so it can be kept and read at leisure.
+type Stats struct {
+	// Running reports whether the run is still going.
+	Running bool
+	// Started is when the run started, and Uptime how long it has been
+	// running or, once it has returned, ran for.
+	Started time.Time
+	Uptime  time.Duration
+	// Produced, Done, Failed and Skipped count the values of the run as for
+	// Progress.
+	Produced int64
+	Done     int64
+	Failed   int64
+	Skipped  int64
+	// Stages reports every step, in order.
+	Stages []StageStats
+}
+
+// StageStats is the part of Stats about a step. Its counts are those of
+// StageProgress.
+type StageStats struct {
+	Name      string
+	Processed int64
+	Failed    int64
+	Skipped   int64
+	Retried   int64
+	InFlight  int64
+	Queued    int64
+	// Rate is how many values the step has processed per second over the
+	// run.
+	Rate float64
+	// MeanLatency and MaxLatency are how long the step took over a value,
+	// retries included, on average and at most.
+	MeanLatency time.Duration
+	MaxLatency  time.Duration
+}
+
+// Stats returns a snapshot of the current run or, once it has returned, of
+// the last one. It is the zero Stats if the pipeline has never run. It is
+// safe to call from any goroutine.
+func (p *Pipeline[T]) Stats() Stats {
+	p.mu.Lock()
+	// until a starting run has built its steps the last one is reported
+	counter, ended := p.counter, p.ended
+	running := p.run != nil && p.run.counter == counter
+	p.mu.Unlock()
+
+	if counter == nil {
+		return Stats{}
+	}
+
+	progress := counter.snapshot()
+	s := Stats{
+		Running:  running,
+		Started:  counter.start,
+		Uptime:   progress.Elapsed,
+		Produced: progress.Produced,
+		Done:     progress.Done,
+		Failed:   progress.Failed,
+		Skipped:  progress.Skipped,
+		Stages:   make([]StageStats, len(progress.Stages)),
+	}
+	if !running {
+		s.Uptime = ended.Sub(counter.start)
+	}
+
+	for i, sp := range progress.Stages {
+		counts := counter.stages[i]
+		st := StageStats{
+			Name:       sp.Name,
+			Processed:  sp.Processed,
+			Failed:     sp.Failed,
+			Skipped:    sp.Skipped,
+			Retried:    sp.Retried,
+			InFlight:   sp.InFlight,
+			Queued:     sp.Queued,
+			MaxLatency: time.Duration(counts.maxLatency.Load()),
+		}
+		if n := counts.latencies.Load(); n > 0 {
+			st.MeanLatency = time.Duration(counts.latency.Load() / n)
+		}
+		if secs := s.Uptime.Seconds(); secs > 0 {
+			st.Rate = float64(sp.Processed) / secs
+		}
+		s.Stages[i] = st
+	}
+
+	return s
+}
@@ -0,0 +1,93 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestStats(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	p := pipeline.New(pipeline.SliceSource([]int{1, 2, 3, 4})).
+		Then(func(v int) (int, error) {
+			// the first value takes 10ms, the others 20ms
+			clock.Advance(time.Duration(min(v, 2)) * 10 * time.Millisecond)
+			if v == 3 {
+				return 0, errors.New("three")
+			}
+			return v, nil
+		}, pipeline.WithName("slow"), pipeline.WithConcurrency(1)).
+		Sink(func(int) error { return nil }).
+		OnError(pipeline.SkipErrors())
+
+	if s := p.Stats(); s.Running || s.Stages != nil {
+		t.Fatalf("Stats before Run = %+v", s)
+	}
+	start := clock.Now()
+	if err := p.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s := p.Stats()
+	if s.Running || !s.Started.Equal(start) || s.Uptime != 70*time.Millisecond {
+		t.Errorf("Stats = %+v, want a finished run started at %v that took 70ms", s, start)
+	}
+	if s.Produced != 4 || s.Done != 3 || s.Failed != 1 {
+		t.Errorf("Stats counts = %d produced, %d done, %d failed, want 4, 3, 1", s.Produced, s.Done, s.Failed)
+	}
+	if len(s.Stages) != 1 {
+		t.Fatalf("got %d stages, want 1", len(s.Stages))
+	}
+	st := s.Stages[0]
+	if st.Name != "slow" || st.Processed != 3 || st.Failed != 1 {
+		t.Errorf("StageStats = %+v", st)
+	}
+	if st.MeanLatency != 17500*time.Microsecond || st.MaxLatency != 20*time.Millisecond {
+		t.Errorf("latency mean %v, max %v, want 17.5ms, 20ms", st.MeanLatency, st.MaxLatency)
+	}
+	if want := 3 / 0.07; st.Rate < want-0.01 || st.Rate > want+0.01 {
+		t.Errorf("Rate = %v, want %v", st.Rate, want)
+	}
+
+	// the last run is reported until the next one has started its steps
+	clock.Advance(time.Hour)
+	if again := p.Stats(); again.Uptime != s.Uptime {
+		t.Errorf("Uptime moved to %v after the run", again.Uptime)
+	}
+}
+
+func TestStatsWhileRunning(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	p := pipeline.New(blockingSource).
+		Then(func(v int) (int, error) { return v, nil }, pipeline.WithConcurrency(4)).
+		Sink(func(int) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s := p.Stats()
+		if s.Running && s.Done > 10 && s.Stages[0].Processed > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats never showed progress: %+v", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if s := p.Stats(); s.Running || s.Uptime <= 0 {
+		t.Errorf("Stats after Run = %+v", s)
+	}
+}
@@ -0,0 +1,473 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Step is a stage of a pipeline. It reads values from inputChannel, runs fn
+// on each of them in parallel and sends the results on the returned output
+// channel, or the failure on the returned error channel as a *StageError.
+//
+// Results are emitted in the order they finish, not the order they arrived,
+// unless WithOrderedOutput is given. Both channels are closed once
+// inputChannel is closed and every in-flight value has been handled, or once
+// ctx is done.
+//
+// By default up to runtime.NumCPU() values are processed at a time, see
+// WithConcurrency.
+func Step[In any, Out any](
+	ctx context.Context,
+	inputChannel <-chan In,
+	fn func(In) (Out, error),
+	opts ...StepOption,
+) (<-chan Out, <-chan error) {
+	call := func(_ context.Context, in In) (Out, error) {
+		return fn(in)
+	}
+
+	return runStep(ctx, inputChannel, call, newStepConfig(opts))
+}
+
+// StepCtx is Step for transforms that need to observe cancellation. fn is
+// called with the step's context, or with a per-call context carrying the
+// deadline set by WithItemTimeout, so long-running work can stop early and
+// return the context's error.
+func StepCtx[In any, Out any](
+	ctx context.Context,
+	inputChannel <-chan In,
+	fn func(context.Context, In) (Out, error),
+	opts ...StepOption,
+) (<-chan Out, <-chan error) {
+	return runStep(ctx, inputChannel, fn, newStepConfig(opts))
+}
+
+// runStep does the work behind Step and StepCtx.
+func runStep[In any, Out any](
+	ctx context.Context,
+	inputChannel <-chan In,
+	fn func(context.Context, In) (Out, error),
+	cfg stepConfig,
+) (<-chan Out, <-chan error) {
+	if cfg.budget > 0 {
+		return runWithBudget(ctx, inputChannel, fn, cfg)
+	}
+	ctx = withStageName(ctx, cfg.label)
+	clock := ClockFrom(ctx)
+
+	var output <-chan Out
+	outputChannel := make(chan Out)
+	if cfg.backpressure == Block {
+		outputChannel = make(chan Out, cfg.buffer)
+		output = outputChannel
+	} else {
+		var onDrop func(Out)
+		if cfg.hooks.OnItemDropped != nil || cfg.dropped != nil {
+			onDrop = func(v Out) {
+				if cfg.hooks.OnItemDropped != nil {
+					cfg.hooks.OnItemDropped(cfg.label, cfg.input(v), cfg.backpressure.dropReason())
+				}
+				if cfg.dropped != nil {
+					cfg.dropped(v)
+				}
+			}
+		}
+		output = dropping(ctx, outputChannel, cfg.buffer, cfg.backpressure, cfg.logger, onDrop)
+	}
+	errorChannel := make(chan error)
+
+	var sem1 limiter = make(slots, cfg.concurrency)
+	var scale *scaler
+	if cfg.scaleMax > 0 {
+		scale = newScaler(cfg, func() int { return len(inputChannel) })
+		sem1 = scale.sem
+	}
+	// finished is closed once every worker has returned
+	finished := make(chan struct{})
+	if scale != nil {
+		go scale.run(ctx, finished)
+	}
+
+	call := fn
+	if len(cfg.middleware) > 0 {
+		call = applyMiddleware(call, cfg.middleware)
+	}
+	if !cfg.crashOnPanic {
+		call = recoverPanics(call)
+	}
+	if cfg.itemTimeout > 0 {
+		call = withTimeout(call, cfg.itemTimeout)
+	}
+
+	// emit hands a finished value to whoever is downstream, giving up once
+	// ctx is done
+	emit := func(r stepResult[Out]) {
+		if r.skip {
+			return
+		}
+		if r.err != nil {
+			var skipped *skippedError
+			if m, ok := cfg.metrics.(skipMetrics); ok && errors.As(r.err, &skipped) {
+				m.ItemSkipped(cfg.label)
+			} else {
+				cfg.metrics.ItemError(cfg.label)
+			}
+			select {
+			case <-ctx.Done():
+			case errorChannel <- r.err:
+			}
+			return
+		}
+
+		cfg.metrics.ItemOut(cfg.label)
+		select {
+		case <-ctx.Done():
+		case outputChannel <- r.value:
+		}
+	}
+
+	// in ordered mode workers hand their results to the reorder buffer
+	// instead, which is then in charge of releasing their semaphore slot
+	var results chan stepResult[Out]
+	if cfg.ordered {
+		results = make(chan stepResult[Out])
+		go func() {
+			defer close(outputChannel)
+			defer close(errorChannel)
+			labelGoroutine(ctx, cfg.label)
+
+			reorder(ctx, results, func(r stepResult[Out]) {
+				emit(r)
+				sem1.Release(1)
+			})
+			if cfg.hooks.OnStageDone != nil {
+				cfg.hooks.OnStageDone(cfg.label)
+			}
+		}()
+	}
+
+	// process runs call on a value and hands the result on
+	process := func(ctx context.Context, j job[In]) {
+		id := correlationID(cfg.input(j.value))
+		if id != "" {
+			ctx = WithCorrelationID(ctx, id)
+		}
+		cfg.metrics.InFlight(cfg.label, 1)
+		start := clock.Now()
+		result, attempts, err := callWithRetry(ctx, cfg, call, j.value)
+		elapsed := clock.Now().Sub(start)
+		cfg.metrics.Latency(cfg.label, elapsed)
+		if scale != nil {
+			scale.finish(elapsed)
+		}
+		cfg.metrics.InFlight(cfg.label, -1)
+
+		var skip, skipped bool
+		if err != nil {
+			var p *PanicError
+			if errors.As(err, &p) {
+				cfg.logger.ErrorContext(ctx, "recovered panic", "panic", p.Value, "stack", string(p.Stack))
+			}
+			switch classify(cfg.classify, err) {
+			case ErrorSkip:
+				skipped = true
+				cfg.logger.DebugContext(ctx, "skipping value", "error", err)
+				if cfg.reportSkips {
+					err = &skippedError{err: err}
+				} else {
+					skip = true
+				}
+			case ErrorFatal:
+				err = Fatal(err)
+			}
+			stageErr := &StageError{Stage: cfg.label, Input: cfg.input(j.value), ID: id, Attempts: attempts, Err: err, raw: j.value}
+			if !skipped {
+				if cfg.hooks.OnItemError != nil {
+					cfg.hooks.OnItemError(stageErr)
+				}
+				reportError(ctx, cfg.reporters, cfg.label, stageErr.Input, stageErr)
+			}
+			err = stageErr
+		} else if cfg.hooks.OnItemProcessed != nil {
+			cfg.hooks.OnItemProcessed(cfg.label, cfg.input(j.value), elapsed)
+		}
+		if cfg.observe != nil && !skipped {
+			cfg.observe(elapsed, err)
+		}
+		r := stepResult[Out]{seq: j.seq, value: result, err: err, skip: skip}
+
+		if !cfg.ordered {
+			emit(r)
+			// finished processing value
+			sem1.Release(1)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case results <- r:
+		}
+	}
+
+	maxWorkers := cfg.concurrency
+	if scale != nil {
+		maxWorkers = cfg.scaleMax
+	}
+
+	// dispatch reads the input and hands every value to a worker once the
+	// limiter lets it through. Workers are started as needed and then kept,
+	// picking up the next value from handoff rather than exiting, so a busy
+	// step doesn't start one per value.
+	dispatch := func(wg *sync.WaitGroup) {
+		handoff := make(chan job[In])
+		defer close(handoff)
+
+		workers := 0
+		var seq uint64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s, ok := <-inputChannel:
+				if !ok {
+					return
+				}
+				cfg.metrics.ItemIn(cfg.label)
+				cfg.metrics.QueueDepth(cfg.label, len(inputChannel))
+
+				// defer doing the work until we have available resources,
+				// this only fails once ctx is done
+				if scale != nil {
+					scale.arrive()
+					scale.setWaiting(true)
+				}
+				err := sem1.Acquire(ctx, 1)
+				if scale != nil {
+					scale.setWaiting(false)
+				}
+				if err != nil {
+					return
+				}
+
+				j := job[In]{seq: seq, value: s}
+				seq++
+
+				// an idle worker takes the value if there is one, otherwise
+				// a new one is started unless there are enough already, in
+				// which case one is about to be idle since the semaphore
+				// let this value through
+				select {
+				case handoff <- j:
+					continue
+				default:
+				}
+				if workers < maxWorkers {
+					workers++
+					wg.Add(1)
+					go func(j job[In]) {
+						defer wg.Done()
+
+						for {
+							process(ctx, j)
+
+							var ok bool
+							select {
+							case <-ctx.Done():
+								return
+							case j, ok = <-handoff:
+								if !ok {
+									return
+								}
+							}
+						}
+					}(j)
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case handoff <- j:
+				}
+			}
+		}
+	}
+
+	// pool starts every worker up front, each reading the input itself
+	pool := func(wg *sync.WaitGroup) {
+		// next hands out one value at a time and numbers it. A value only
+		// counts as taken once the limiter has let it through, as it does
+		// for dispatch, so limiter slots go out in arrival order, which the
+		// reorder buffer depends on.
+		var mu sync.Mutex
+		var seq uint64
+		next := func(ctx context.Context) (job[In], bool) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			var s In
+			select {
+			case <-ctx.Done():
+				return job[In]{}, false
+			case v, ok := <-inputChannel:
+				if !ok {
+					return job[In]{}, false
+				}
+				s = v
+			}
+			cfg.metrics.ItemIn(cfg.label)
+			cfg.metrics.QueueDepth(cfg.label, len(inputChannel))
+
+			if scale != nil {
+				scale.arrive()
+				scale.setWaiting(true)
+			}
+			err := sem1.Acquire(ctx, 1)
+			if scale != nil {
+				scale.setWaiting(false)
+			}
+			if err != nil {
+				return job[In]{}, false
+			}
+
+			j := job[In]{seq: seq, value: s}
+			seq++
+			return j, true
+		}
+
+		wg.Add(maxWorkers)
+		for id := range maxWorkers {
+			go func() {
+				defer wg.Done()
+
+				ctx := context.WithValue(ctx, workerKey{}, cfg.firstWorker+id)
+				if cfg.workerInit != nil {
+					state, err := cfg.workerInit(ctx)
+					if err != nil {
+						err = &StageError{Stage: cfg.label, Err: fmt.Errorf("starting worker %d: %w", cfg.firstWorker+id, err)}
+						select {
+						case <-ctx.Done():
+						case errorChannel <- err:
+						}
+						return
+					}
+					if cfg.workerClose != nil {
+						defer cfg.workerClose(state)
+					}
+					ctx = context.WithValue(ctx, workerStateKey{}, state)
+				}
+
+				for {
+					j, ok := next(ctx)
+					if !ok {
+						return
+					}
+					process(ctx, j)
+				}
+			}()
+		}
+	}
+
+	go func() {
+		var wg sync.WaitGroup
+
+		if cfg.ordered {
+			defer close(results)
+		} else {
+			defer close(outputChannel)
+			defer close(errorChannel)
+			if cfg.hooks.OnStageDone != nil {
+				defer cfg.hooks.OnStageDone(cfg.label)
+			}
+		}
+		// workers must finish before the channels they send on are closed
+		defer close(finished)
+		defer wg.Wait()
+
+		// the workers started from here inherit the label
+		labelGoroutine(ctx, cfg.label)
+		if cfg.hooks.OnStageStart != nil {
+			cfg.hooks.OnStageStart(cfg.label)
+		}
+
+		if cfg.workerPool {
+			pool(&wg)
+		} else {
+			dispatch(&wg)
+		}
+	}()
+
+	return output, errorChannel
+}
+
+// limiter bounds how many values a step processes at a time.
+type limiter interface {
+	Acquire(ctx context.Context, n int64) error
+	Release(n int64)
+}
+
+// slots is a limiter for a fixed concurrency. Unlike a semaphore.Weighted,
+// which autoscaling needs to resize, waiting for a slot doesn't allocate.
+type slots chan struct{}
+
+// Acquire takes a slot, n is always 1.
+func (s slots) Acquire(ctx context.Context, _ int64) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s <- struct{}{}:
+		return nil
+	}
+}
+
+// Release gives a slot back, n is always 1.
+func (s slots) Release(int64) {
+	<-s
+}
+
+// job is a value read by a step, numbered in arrival order.
+type job[In any] struct {
+	seq   uint64
+	value In
+}
+
+type stepResult[Out any] struct {
+	seq   uint64
+	value Out
+	err   error
+	// skip drops the value, it only goes through the reorder buffer to
+	// release its slot in order
+	skip bool
+}
+
+// reorder passes results to emit in sequence order, holding back any that
+// finish before their predecessors. Since a worker's semaphore slot is only
+// released once its result has been emitted, at most the step's concurrency
+// worth of results are ever held back.
+func reorder[Out any](ctx context.Context, results <-chan stepResult[Out], emit func(stepResult[Out])) {
+	pending := make(map[uint64]stepResult[Out])
+	var next uint64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r, ok := <-results:
+			if !ok {
+				return
+			}
+			pending[r.seq] = r
+
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				emit(r)
+				next++
+			}
+		}
+	}
+}
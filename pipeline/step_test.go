@@ -0,0 +1,136 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestOrderedOutput(t *testing.T) {
+	// the later a value arrives the sooner it is done, so every result comes
+	// back to the reorder buffer out of order
+	fn := func(v int) (int, error) {
+		time.Sleep(time.Duration(20-v) * time.Millisecond / 4)
+		switch {
+		case v%5 == 0:
+			return 0, errBad
+		case v%7 == 0:
+			return 0, pipeline.Skip(errBad)
+		}
+		return v * 10, nil
+	}
+	values := make([]int, 20)
+	for i := range values {
+		values[i] = i + 1
+	}
+
+	tests := []struct {
+		name string
+		opts []pipeline.StepOption
+		// buffered results can overtake the errors before them, which are
+		// sent straight away, so only the order of each is kept
+		buffered bool
+	}{
+		{name: "one worker", opts: []pipeline.StepOption{pipeline.WithConcurrency(1)}},
+		{name: "concurrent", opts: []pipeline.StepOption{pipeline.WithConcurrency(8)}},
+		{name: "more workers than values", opts: []pipeline.StepOption{pipeline.WithConcurrency(32)}},
+		{name: "buffered", opts: []pipeline.StepOption{pipeline.WithConcurrency(8), pipeline.WithBuffer(4)}, buffered: true},
+		{name: "worker pool", opts: []pipeline.StepOption{pipeline.WithConcurrency(8), pipeline.WithWorkerPool()}},
+		{
+			name: "retried",
+			opts: []pipeline.StepOption{pipeline.WithConcurrency(8), pipeline.WithRetry(2, pipeline.ConstantBackoff(time.Millisecond))},
+		},
+	}
+
+	// want is what comes out, results and errors as one stream, skips left out
+	var want []string
+	for _, v := range values {
+		switch {
+		case v%5 == 0:
+			want = append(want, "error "+strconv.Itoa(v))
+		case v%7 == 0:
+		default:
+			want = append(want, strconv.Itoa(v*10))
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			opts := append(tt.opts, pipeline.WithOrderedOutput())
+			out, errs := pipeline.Step(ctx, pipeline.FromSlice(ctx, values), fn, opts...)
+
+			// both channels are read by one loop, so the order they are
+			// written in shows
+			var got []string
+			for out != nil || errs != nil {
+				select {
+				case v, ok := <-out:
+					if !ok {
+						out = nil
+						continue
+					}
+					got = append(got, strconv.Itoa(v))
+				case err, ok := <-errs:
+					if !ok {
+						errs = nil
+						continue
+					}
+					var stageErr *pipeline.StageError
+					if !errors.As(err, &stageErr) {
+						t.Fatalf("got %v, want a *StageError", err)
+					}
+					got = append(got, "error "+strconv.Itoa(stageErr.Input.(int)))
+				}
+			}
+
+			want := want
+			if tt.buffered {
+				got, want = apart(got), apart(want)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// apart moves the errors of an output to its end, keeping the order of the
+// results and of the errors.
+func apart(output []string) []string {
+	var results, errs []string
+	for _, o := range output {
+		if strings.HasPrefix(o, "error ") {
+			errs = append(errs, o)
+		} else {
+			results = append(results, o)
+		}
+	}
+	return append(results, errs...)
+}
+
+func TestWithRateLimitNoBurst(t *testing.T) {
+	identity := func(v int) (int, error) { return v, nil }
+
+	out, errs := pipelinetest.RunStage(t, identity, []int{1, 2, 3},
+		pipeline.WithRateLimit(rate.Limit(1000), 0),
+	)
+	if len(errs) > 0 {
+		t.Fatalf("got errors %v, want a burst of 0 taken as 1", errs)
+	}
+	if !slices.Equal(out, []int{1, 2, 3}) {
+		t.Errorf("got %v, want [1 2 3]", out)
+	}
+}
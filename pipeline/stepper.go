@@ -0,0 +1,285 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trace is what became of a value run through the steps by a Stepper.
+type Trace struct {
+	// N counts the values read from the source, from 1.
+	N     int64 `json:"n"`
+	Input any   `json:"input"`
+	// Stages has what every step returned for the value, in order, up to
+	// the one it failed in, and the sink's outcome last.
+	Stages []TraceStage `json:"stages"`
+	// Err is the error the value failed with, if it did.
+	Err string `json:"error,omitempty"`
+}
+
+// TraceStage is what a step, or the sink, did with a traced value.
+type TraceStage struct {
+	Stage string `json:"stage"`
+	// Output is the value the step returned, unless it failed with Err.
+	Output  any           `json:"output,omitempty"`
+	Err     string        `json:"error,omitempty"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// Stepper runs the values of a pipeline's source through its steps one at
+// a time, on command, tracing the value after every step, to see exactly
+// how a problematic record is transformed, see Pipeline.Stepper.
+type Stepper[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	values <-chan T
+	errs   chan error
+	names  []string
+	steps  []func(context.Context, T) (T, error)
+	sink   func(T) error
+
+	mu sync.Mutex
+	n  int64
+}
+
+// Stepper starts the pipeline's source, leaving the values it emits for the
+// returned Stepper to run through the steps, one per call of its Next, from
+// a terminal, see Stepper.Interact, or over HTTP, see Stepper.ServeHTTP.
+//
+// Each value is handed to each step's fn in turn on the calling goroutine,
+// with the step's middleware but none of its other options, so it is
+// neither retried nor timed out, and a panic is reported as a *PanicError.
+// Once it has made it through every step it is handed to the sink, if any.
+// Failures are traced rather than handled, the pipeline's DeadLetter and
+// ErrorPolicy aren't involved, and nothing is counted or checkpointed.
+// Close stops the source.
+func (p *Pipeline[T]) Stepper(ctx context.Context) (*Stepper[T], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stepper[T]{ctx: ctx, cancel: cancel, errs: make(chan error), sink: p.sink}
+	for i, st := range p.stages {
+		cfg := newStepConfig(st.opts)
+		name := cfg.name
+		if name == "" {
+			name = "step " + strconv.Itoa(i+1)
+		}
+		fn := st.fn
+		if len(cfg.middleware) > 0 {
+			fn = applyMiddleware(fn, cfg.middleware)
+		}
+		s.names = append(s.names, name)
+		s.steps = append(s.steps, recoverPanics(fn))
+	}
+
+	values, err := p.source(withSourceErrors(ctx, func(err error) {
+		select {
+		case <-ctx.Done():
+		case s.errs <- err:
+		}
+	}))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s.values = values
+	return s, nil
+}
+
+// Next runs the next value of the source through the steps and returns its
+// trace. It returns io.EOF once the source is exhausted, and the source's
+// failure if it fails. It is safe to call from any goroutine, values are
+// run one at a time.
+func (s *Stepper[T]) Next() (Trace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var v T
+	select {
+	case <-s.ctx.Done():
+		return Trace{}, s.ctx.Err()
+	case err := <-s.errs:
+		return Trace{}, fmt.Errorf("pipeline: source: %w", err)
+	case value, ok := <-s.values:
+		if !ok {
+			return Trace{}, io.EOF
+		}
+		v = value
+	}
+	s.n++
+
+	trace := Trace{N: s.n, Input: v}
+	clock := ClockFrom(s.ctx)
+	for i, step := range s.steps {
+		start := clock.Now()
+		out, err := step(s.ctx, v)
+		stage := TraceStage{Stage: s.names[i], Elapsed: clock.Now().Sub(start)}
+		if err != nil {
+			stage.Err = err.Error()
+			trace.Stages = append(trace.Stages, stage)
+			trace.Err = err.Error()
+			return trace, nil
+		}
+		stage.Output = out
+		trace.Stages = append(trace.Stages, stage)
+		v = out
+	}
+
+	if s.sink != nil {
+		start := clock.Now()
+		err := s.sink(v)
+		stage := TraceStage{Stage: "sink", Elapsed: clock.Now().Sub(start)}
+		if err != nil {
+			stage.Err = err.Error()
+			trace.Err = err.Error()
+		}
+		trace.Stages = append(trace.Stages, stage)
+	}
+	return trace, nil
+}
+
+// Close stops the source. Next fails once it has.
+func (s *Stepper[T]) Close() {
+	s.cancel()
+}
+
+// Interact reads commands from r, one per line, and writes the traces of
+// the values it runs to w, for stepping through a pipeline from a
+// terminal:
+//
+//	stepper, err := p.Stepper(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer stepper.Close()
+//	return stepper.Interact(os.Stdin, os.Stdout)
+//
+// An empty line or "n" runs the next value, "n 10" the next ten, "c" every
+// value left and "q" quits. It returns once r, or the source, is exhausted,
+// or the user quits, with the source's failure if it failed.
+func (s *Stepper[T]) Interact(r io.Reader, w io.Writer) error {
+	lines := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, "> ")
+		if !lines.Scan() {
+			fmt.Fprintln(w)
+			return lines.Err()
+		}
+
+		n := 1
+		switch cmd, arg, _ := strings.Cut(strings.TrimSpace(lines.Text()), " "); cmd {
+		case "", "n", "next":
+			if arg != "" {
+				var err error
+				if n, err = strconv.Atoi(arg); err != nil || n < 1 {
+					fmt.Fprintf(w, "not a number of values: %s\n", arg)
+					continue
+				}
+			}
+		case "c", "continue":
+			n = -1
+		case "q", "quit":
+			return nil
+		default:
+			fmt.Fprintln(w, "commands: n [count] runs the next values, c runs every value left, q quits")
+			continue
+		}
+
+		for ; n != 0; n-- {
+			trace, err := s.Next()
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(w, "source exhausted")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			writeTrace(w, trace)
+		}
+	}
+}
+
+// writeTrace writes trace to w as it is shown by Interact:
+//
+//	value 1: {"id":1}
+//	  enrich: {"id":1,"name":"a"} (1.2ms)
+//	  tax: error: no rate for "a" (20µs)
+func writeTrace(w io.Writer, trace Trace) {
+	fmt.Fprintf(w, "value %d: %s\n", trace.N, formatTraced(trace.Input))
+	for _, st := range trace.Stages {
+		state := formatTraced(st.Output)
+		switch {
+		case st.Err != "":
+			state = "error: " + st.Err
+		case st.Stage == "sink":
+			state = "ok"
+		}
+		fmt.Fprintf(w, "  %s: %s (%s)\n", st.Stage, state, st.Elapsed)
+	}
+}
+
+// formatTraced formats a traced value as JSON, or with %+v if it isn't
+// encodable.
+func formatTraced(v any) string {
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%+v", v)
+}
+
+// ServeHTTP runs the next value on POST and responds with its trace as
+// JSON, for stepping through a pipeline running where there is no
+// terminal:
+//
+//	http.Handle("POST /debug/step", stepper)
+//
+// The count parameter runs several values, responding with their traces as
+// a JSON array, e.g. POST /debug/step?count=10. Once the source is
+// exhausted it responds with 410 Gone. Like the AdminHandler it has no
+// access control of its own, so don't expose it to the outside.
+func (s *Stepper[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	count := 0
+	if c := r.URL.Query().Get("count"); c != "" {
+		var err error
+		if count, err = strconv.Atoi(c); err != nil || count < 1 {
+			http.Error(w, "pipeline: bad count "+strconv.Quote(c), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var traces []Trace
+	for i := 0; i < max(count, 1); i++ {
+		trace, err := s.Next()
+		if errors.Is(err, io.EOF) && len(traces) > 0 {
+			break
+		}
+		if errors.Is(err, io.EOF) {
+			http.Error(w, "pipeline: source exhausted", http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		traces = append(traces, trace)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if count == 0 {
+		_ = json.NewEncoder(w).Encode(traces[0])
+		return
+	}
+	_ = json.NewEncoder(w).Encode(traces)
+}
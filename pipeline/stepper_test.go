@@ -0,0 +1,242 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// stepped is a pipeline to step through: values are doubled, then halved,
+// panicking on 4 once doubled, and 5 fails in the sink.
+func stepped(values ...int) *pipeline.Pipeline[int] {
+	return pipeline.New(pipeline.SliceSource(values)).
+		Then(func(v int) (int, error) { return v * 2, nil }, pipeline.WithName("double")).
+		Then(func(v int) (int, error) {
+			if v == 8 {
+				panic("eight")
+			}
+			return halve(v)
+		}).
+		Sink(func(v int) error {
+			if v == 5 {
+				return errBad
+			}
+			return nil
+		})
+}
+
+func TestStepperNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		value int
+		// stages are the steps the value went through, with what they made of it
+		stages []pipeline.TraceStage
+		err    string
+	}{
+		{
+			name:   "handled",
+			value:  1,
+			stages: []pipeline.TraceStage{{Stage: "double", Output: 2}, {Stage: "step 2", Output: 1}, {Stage: "sink"}},
+		},
+		{
+			name:   "failed in the sink",
+			value:  5,
+			stages: []pipeline.TraceStage{{Stage: "double", Output: 10}, {Stage: "step 2", Output: 5}, {Stage: "sink", Err: errBad.Error()}},
+			err:    errBad.Error(),
+		},
+		{
+			name:   "panicked",
+			value:  4,
+			stages: []pipeline.TraceStage{{Stage: "double", Output: 8}, {Stage: "step 2", Err: "panic: eight"}},
+			err:    "panic: eight",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			stepper, err := stepped(tt.value).Stepper(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stepper.Close()
+
+			trace, err := stepper.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range trace.Stages {
+				trace.Stages[i].Elapsed = 0
+			}
+			if trace.N != 1 || trace.Input != tt.value || trace.Err != tt.err || !slices.Equal(trace.Stages, tt.stages) {
+				t.Errorf("traced %+v, want %v going through %+v failing with %q", trace, tt.value, tt.stages, tt.err)
+			}
+			if _, err := stepper.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("Next = %v once exhausted, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestStepperSourceFails(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	source := pipeline.GeneratorSource(func(ctx context.Context, emit func(int) error) error {
+		return errBad
+	})
+	stepper, err := pipeline.New(source).Stepper(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stepper.Close()
+
+	if _, err := stepper.Next(); !errors.Is(err, errBad) {
+		t.Errorf("Next = %v, want the source's failure", err)
+	}
+}
+
+func TestStepperInteract(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands string
+		// want matches the output, ignoring timings
+		want string
+	}{
+		{
+			name:     "one at a time",
+			commands: "\nn\nq\n",
+			want: `> value 1: 1
+  double: 2 (-)
+  step 2: 1 (-)
+  sink: ok (-)
+> value 2: 2
+  double: 4 (-)
+  step 2: 2 (-)
+  sink: ok (-)
+> `,
+		},
+		{
+			name:     "several",
+			commands: "n 2\n",
+			want: `> value 1: 1
+  double: 2 (-)
+  step 2: 1 (-)
+  sink: ok (-)
+value 2: 2
+  double: 4 (-)
+  step 2: 2 (-)
+  sink: ok (-)
+> 
+`,
+		},
+		{
+			name:     "continued",
+			commands: "c\n",
+			want: `> value 1: 1
+  double: 2 (-)
+  step 2: 1 (-)
+  sink: ok (-)
+value 2: 2
+  double: 4 (-)
+  step 2: 2 (-)
+  sink: ok (-)
+value 3: 3
+  double: 6 (-)
+  step 2: 3 (-)
+  sink: ok (-)
+source exhausted
+`,
+		},
+		{
+			name:     "bad commands",
+			commands: "n x\nwhat\nq\n",
+			want: `> not a number of values: x
+> commands: n [count] runs the next values, c runs every value left, q quits
+> `,
+		},
+	}
+	timing := regexp.MustCompile(`\([^)]*s\)`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelinetest.VerifyNoLeaks(t)
+			stepper, err := stepped(1, 2, 3).Stepper(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stepper.Close()
+
+			var out strings.Builder
+			if err := stepper.Interact(strings.NewReader(tt.commands), &out); err != nil {
+				t.Fatal(err)
+			}
+			if got := timing.ReplaceAllString(out.String(), "(-)"); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepperServeHTTP(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	stepper, err := stepped(1, 2, 3).Stepper(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stepper.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		code   int
+		// values are the inputs of the traces responded with
+		values []float64
+	}{
+		{name: "next", method: http.MethodPost, code: http.StatusOK, values: []float64{1}},
+		{name: "not a post", method: http.MethodGet, code: http.StatusMethodNotAllowed},
+		{name: "bad count", method: http.MethodPost, query: "?count=none", code: http.StatusBadRequest},
+		{name: "more than left", method: http.MethodPost, query: "?count=5", code: http.StatusOK, values: []float64{2, 3}},
+		{name: "exhausted", method: http.MethodPost, code: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			stepper.ServeHTTP(rec, httptest.NewRequest(tt.method, "/debug/step"+tt.query, nil))
+			if rec.Code != tt.code {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var traces []pipeline.Trace
+			if tt.query == "" {
+				traces = make([]pipeline.Trace, 1)
+				err = json.Unmarshal(rec.Body.Bytes(), &traces[0])
+			} else {
+				err = json.Unmarshal(rec.Body.Bytes(), &traces)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var values []float64
+			for _, trace := range traces {
+				values = append(values, trace.Input.(float64))
+			}
+			if !slices.Equal(values, tt.values) {
+				t.Errorf("traced %v, want %v", values, tt.values)
+			}
+		})
+	}
+}
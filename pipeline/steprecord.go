@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// callLine is a line of a step's recording: a call, the value it was given,
+// what it returned and when it was made. Like recordLine, values encoded as
+// JSON are kept as they are, anything else as base64 bytes.
+type callLine struct {
+	At      time.Time       `json:"at"`
+	In      json.RawMessage `json:"in,omitempty"`
+	InData  []byte          `json:"in_data,omitempty"`
+	Out     json.RawMessage `json:"out,omitempty"`
+	OutData []byte          `json:"out_data,omitempty"`
+	Err     string          `json:"error,omitempty"`
+}
+
+// RecordStep writes every call of the step's fn to w as a line of JSON: the
+// value entering the step, encoded with in, and the one leaving it, encoded
+// with out, or the error the call failed with, stamped with the time of the
+// call. Where Record captures what a pipeline reads, RecordStep captures the
+// boundaries of a single step, so the one misbehaving in production can be
+// re-driven locally on the exact values it was given, see ReplayStep:
+//
+//	f, err := os.Create("enrich.jsonl")
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//	codec := pipeline.JSONCodec[Order]()
+//	err = pipeline.New(source).Then(enrich, pipeline.RecordStep(f, codec, codec)).Run(ctx)
+//
+// RecordStep is middleware, so every attempt of a retried call is a line of
+// its own, see WithMiddleware. Lines are written as the calls return, one
+// write each, in the order they do. A call whose line can't be encoded or
+// written fails with a Fatal error.
+func RecordStep[In any, Out any](w io.Writer, in Codec[In], out Codec[Out]) StepOption {
+	var mu sync.Mutex
+
+	return WithMiddleware(func(next StepFunc) StepFunc {
+		return func(ctx context.Context, v any) (any, error) {
+			line := callLine{At: ClockFrom(ctx).Now()}
+			result, err := next(ctx, v)
+
+			if recErr := encodeCall(&line, v, result, err, in, out); recErr != nil {
+				return result, Fatal(fmt.Errorf("pipeline: recording call: %w", recErr))
+			}
+			b, recErr := json.Marshal(line)
+			if recErr != nil {
+				return result, Fatal(fmt.Errorf("pipeline: recording call: %w", recErr))
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if _, recErr := w.Write(append(b, '\n')); recErr != nil {
+				return result, Fatal(fmt.Errorf("pipeline: recording call: %w", recErr))
+			}
+			return result, err
+		}
+	})
+}
+
+// encodeCall fills in the line of a call given v, returning result or
+// failing with err.
+func encodeCall[In any, Out any](line *callLine, v, result any, err error, in Codec[In], out Codec[Out]) error {
+	value, convErr := as[In](v)
+	if convErr != nil {
+		return convErr
+	}
+	data, encErr := in.Encode(value)
+	if encErr != nil {
+		return encErr
+	}
+	line.In, line.InData = recording(data)
+
+	if err != nil {
+		line.Err = err.Error()
+		return nil
+	}
+	output, convErr := as[Out](result)
+	if convErr != nil {
+		return convErr
+	}
+	if data, encErr = out.Encode(output); encErr != nil {
+		return encErr
+	}
+	line.Out, line.OutData = recording(data)
+	return nil
+}
+
+// Call is a call of a step read back from a recording made with RecordStep.
+type Call[In any, Out any] struct {
+	At time.Time
+	In In
+	// Out is what the call returned, unless it failed with an error whose
+	// message is Err.
+	Out Out
+	Err string
+}
+
+// ReadCalls returns the calls of the recording of a step made with
+// RecordStep, decoded with in and out, in the order they were recorded.
+func ReadCalls[In any, Out any](r io.Reader, in Codec[In], out Codec[Out]) ([]Call[In, Out], error) {
+	lines := bufio.NewReader(r)
+
+	var calls []Call[In, Out]
+	for n := 1; ; n++ {
+		b, err := lines.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(b) == 0 {
+			return calls, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return calls, fmt.Errorf("pipeline: reading recording: %w", err)
+		}
+
+		var line callLine
+		if err := json.Unmarshal(b, &line); err != nil {
+			return calls, fmt.Errorf("pipeline: line %d of recording: %w", n, err)
+		}
+		call := Call[In, Out]{At: line.At, Err: line.Err}
+		if call.In, err = in.Decode(recorded(line.In, line.InData)); err != nil {
+			return calls, fmt.Errorf("pipeline: line %d of recording: %w", n, err)
+		}
+		if line.Out != nil || line.OutData != nil {
+			if call.Out, err = out.Decode(recorded(line.Out, line.OutData)); err != nil {
+				return calls, fmt.Errorf("pipeline: line %d of recording: %w", n, err)
+			}
+		}
+		calls = append(calls, call)
+	}
+}
+
+// ReplayStep returns a Source emitting the values a step was given, read
+// from a recording made with RecordStep, decoded with codec, to run the step
+// on them again:
+//
+//	err := pipeline.New(pipeline.ReplayStep(f, codec)).Then(enrich).Sink(print).Run(ctx)
+//
+// A value retried is emitted once per attempt recorded for it. A line that
+// can't be decoded fails the source, see GeneratorSource.
+func ReplayStep[In any](r io.Reader, codec Codec[In]) Source[In] {
+	return GeneratorSource(func(ctx context.Context, emit func(In) error) error {
+		calls, err := ReadCalls(r, codec, discardCodec{})
+		for _, call := range calls {
+			if err := emit(call.In); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+// discardCodec decodes every value as nil, for reading recordings without
+// their outputs.
+type discardCodec struct{}
+
+func (discardCodec) Encode(any) ([]byte, error) { return nil, nil }
+func (discardCodec) Decode([]byte) (any, error) { return nil, nil }
+
+// recorded returns the bytes of a value of a recording, kept as JSON in raw
+// or as data.
+func recorded(raw json.RawMessage, data []byte) []byte {
+	if raw != nil {
+		return raw
+	}
+	return data
+}
+
+// recording returns how data, encoded by a codec, is kept in a recording.
+func recording(data []byte) (json.RawMessage, []byte) {
+	if json.Valid(data) {
+		return data, nil
+	}
+	return nil, data
+}
@@ -0,0 +1,132 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// halve halves even numbers and fails on odd ones.
+func halve(v int) (int, error) {
+	if v%2 != 0 {
+		return 0, errBad
+	}
+	return v / 2, nil
+}
+
+func TestRecordStep(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec pipeline.Codec[int]
+		opts  []pipeline.StepOption
+		// want are the values of the calls recorded, in the order made
+		want []pipeline.Call[int, int]
+		// line is part of the first line of the recording
+		line string
+	}{
+		{
+			name:  "json",
+			codec: pipeline.JSONCodec[int](),
+			want:  []pipeline.Call[int, int]{{In: 2, Out: 1}, {In: 3, Err: errBad.Error()}, {In: 4, Out: 2}},
+			line:  `"in":2,"out":1`,
+		},
+		{
+			name:  "binary",
+			codec: pipeline.GzipCodec(pipeline.JSONCodec[int]()),
+			want:  []pipeline.Call[int, int]{{In: 2, Out: 1}, {In: 3, Err: errBad.Error()}, {In: 4, Out: 2}},
+			line:  `"in_data":"`,
+		},
+		{
+			name:  "retried",
+			codec: pipeline.JSONCodec[int](),
+			opts:  []pipeline.StepOption{pipeline.WithRetry(2, nil)},
+			want: []pipeline.Call[int, int]{
+				{In: 2, Out: 1}, {In: 3, Err: errBad.Error()}, {In: 3, Err: errBad.Error()}, {In: 4, Out: 2},
+			},
+			line: `"in":2,"out":1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := append(tt.opts, pipeline.RecordStep(&buf, tt.codec, tt.codec))
+			pipelinetest.RunStage(t, halve, []int{2, 3, 4}, opts...)
+
+			if first, _, _ := strings.Cut(buf.String(), "\n"); !strings.Contains(first, tt.line) {
+				t.Errorf("first line %s, want %s in it", first, tt.line)
+			}
+			calls, err := pipeline.ReadCalls(bytes.NewReader(buf.Bytes()), tt.codec, tt.codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range calls {
+				if calls[i].At.IsZero() {
+					t.Errorf("call %d has no time", i)
+				}
+				calls[i].At = tt.want[0].At
+			}
+			if !slices.Equal(calls, tt.want) {
+				t.Errorf("recorded %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayStep(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	var buf bytes.Buffer
+	codec := pipeline.JSONCodec[int]()
+	err := pipeline.New(func(ctx context.Context) (<-chan int, error) {
+		return pipeline.FromSlice(ctx, []int{1, 2, 3, 4}), nil
+	}).
+		Then(func(v int) (int, error) { return v * 10, nil }).
+		Then(halve, pipeline.RecordStep(&buf, codec, codec)).
+		DeadLetter(func(*pipeline.StageError) error { return nil }).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the recorded step is re-driven on its own with what it was given
+	var got []int
+	err = pipeline.New(pipeline.ReplayStep(&buf, codec)).
+		Sink(func(v int) error { got = append(got, v); return nil }).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	if want := []int{10, 20, 30, 40}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestRecordStepFails(t *testing.T) {
+	codec := pipeline.JSONCodec[int]()
+	err := pipeline.New(func(ctx context.Context) (<-chan int, error) {
+		return pipeline.FromSlice(ctx, []int{2}), nil
+	}).
+		Then(halve, pipeline.RecordStep(failingWriter{}, codec, codec), pipeline.WithRetry(3, nil)).
+		Run(context.Background())
+	var stageErr *pipeline.StageError
+	if !errors.As(err, &stageErr) || stageErr.Attempts != 1 || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Run = %v, want the recording's failure, not retried", err)
+	}
+
+	_, err = pipeline.ReadCalls(strings.NewReader("{\"in\":1}\nnot json\n"), codec, codec)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ReadCalls = %v, want the broken line pointed out", err)
+	}
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// LogSummary logs a one-line summary of the run with logger every interval
+// while the pipeline runs, and once more when Run returns, so a long-running
+// job has a heartbeat in plain logs without any metrics set up:
+//
+//	level=INFO msg="pipeline running" elapsed=1m0s produced=5210 done=5180 failed=3 parse.processed=5200 parse.failed=3 parse.in_flight=8 parse.rate=86.5
+//
+// A step's rate is how many values it processed per second since the last
+// summary. A nil logger logs with the pipeline's Logger, or slog.Default.
+func (p *Pipeline[T]) LogSummary(interval time.Duration, logger *slog.Logger) *Pipeline[T] {
+	p.summaryEvery = interval
+	p.summaryLogger = logger
+	return p
+}
+
+// summarize logs summaries of the run counted by counter every interval
+// until ctx is done. The returned func stops it and logs the last summary
+// with what the run returned.
+func summarize(ctx context.Context, counter *progressCounter, interval time.Duration, logger *slog.Logger) func(err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	// processed is what every step had processed at the last summary
+	processed := make([]int64, len(counter.stages))
+	last := counter.start
+	log := func(msg string, extra ...any) {
+		p := counter.snapshot()
+		now := counter.start.Add(p.Elapsed)
+		secs := now.Sub(last).Seconds()
+		last = now
+
+		args := append([]any{
+			"elapsed", p.Elapsed.Round(time.Millisecond),
+			"produced", p.Produced,
+			"done", p.Done,
+			"failed", p.Failed,
+		}, extra...)
+		for i, s := range p.Stages {
+			var rate float64
+			if secs > 0 {
+				rate = float64(s.Processed-processed[i]) / secs
+			}
+			processed[i] = s.Processed
+			args = append(args, slog.Group(s.Name,
+				"processed", s.Processed,
+				"failed", s.Failed,
+				"in_flight", s.InFlight,
+				"rate", math.Round(rate*10)/10,
+			))
+		}
+		logger.Info(msg, args...)
+	}
+
+	go func() {
+		defer close(done)
+
+		ticker := counter.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				log("pipeline running")
+			}
+		}
+	}()
+
+	return func(err error) {
+		cancel()
+		<-done
+
+		if err != nil {
+			log("pipeline stopped", "error", err)
+			return
+		}
+		log("pipeline finished")
+	}
+}
@@ -0,0 +1,113 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+// syncBuffer is a bytes.Buffer for loggers writing from several goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+}
+
+func TestLogSummary(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	src := pipelinetest.NewSource[int]()
+	sink := pipelinetest.NewSink[int]()
+	p := pipeline.New(src.Open).
+		Then(func(v int) (int, error) {
+			if v < 0 {
+				return 0, errBad
+			}
+			return v, nil
+		}, pipeline.WithName("check"), pipeline.WithConcurrency(1)).
+		Sink(sink.Handle).
+		OnError(pipeline.SkipErrors()).
+		LogSummary(10*time.Second, logger)
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	for v := range 20 {
+		src.Send(t, v)
+		sink.Next(t)
+	}
+	// the checkpoint-free run has the summary ticker as its only timer
+	clock.WaitForTimers(1)
+	clock.Advance(10 * time.Second)
+	waitFor(t, "the first summary", func() bool { return len(out.lines()) == 1 && out.lines()[0] != "" })
+
+	src.Send(t, -1)
+	src.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	lines := out.lines()
+	wants := []string{
+		`level=INFO msg="pipeline running" elapsed=10s produced=20 done=20 failed=0 check.processed=20 check.failed=0 check.in_flight=0 check.rate=2`,
+		`level=INFO msg="pipeline finished" elapsed=10s produced=21 done=20 failed=1 check.processed=20 check.failed=1 check.in_flight=0 check.rate=0`,
+	}
+	if len(lines) != len(wants) {
+		t.Fatalf("got lines %q, want %d", lines, len(wants))
+	}
+	for i, want := range wants {
+		if lines[i] != want {
+			t.Errorf("line %d:\n got %s\nwant %s", i, lines[i], want)
+		}
+	}
+}
+
+func TestLogSummaryError(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+	err := pipeline.New(pipeline.SliceSource([]int{1})).
+		Then(func(int) (int, error) { return 0, errBad }).
+		LogSummary(time.Hour, logger).
+		Run(context.Background())
+	if !errors.Is(err, errBad) {
+		t.Fatalf("Run = %v", err)
+	}
+
+	lines := out.lines()
+	if len(lines) != 1 || !strings.Contains(lines[0], `msg="pipeline stopped"`) || !strings.Contains(lines[0], "error=") ||
+		!strings.Contains(lines[0], `"step 1.failed"=1`) {
+		t.Errorf("got %q, want the run stopping with its error", lines)
+	}
+}
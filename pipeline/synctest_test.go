@@ -0,0 +1,305 @@
+//go:build go1.25
+
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestSynctest(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     func(ctx context.Context) error
+		wantErr error
+		// took is how long the run takes, in the bubble's virtual time
+		took time.Duration
+	}{
+		{
+			name: "throttled with retries",
+			run: func(ctx context.Context) error {
+				failures := 0
+				return pipeline.New(func(ctx context.Context) (<-chan int, error) {
+					return pipeline.Throttle(ctx, pipeline.FromSlice(ctx, []int{1, 2, 3, 4, 5}), time.Second, pipeline.ThrottleQueue), nil
+				}).
+					Then(func(v int) (int, error) {
+						if v == 3 && failures < 2 {
+							failures++
+							return 0, errBad
+						}
+						return v, nil
+					}, pipeline.WithRetry(3, pipeline.ConstantBackoff(time.Minute)), pipeline.WithItemTimeout(time.Hour)).
+					Sink(func(int) error { return nil }).
+					Run(ctx)
+			},
+			took: 2*time.Minute + 2*time.Second,
+		},
+		{
+			name: "timed out",
+			run: func(ctx context.Context) error {
+				// a source busy emitting would keep virtual time from
+				// passing, this one waits for a value that never comes
+				idle := func(ctx context.Context) (<-chan int, error) {
+					out := make(chan int)
+					go func() {
+						defer close(out)
+						<-ctx.Done()
+					}()
+					return out, nil
+				}
+				return pipeline.New(idle).Timeout(24 * time.Hour).Run(ctx)
+			},
+			wantErr: context.DeadlineExceeded,
+			took:    24 * time.Hour,
+		},
+		{
+			name: "item timed out",
+			run: func(ctx context.Context) error {
+				return pipeline.New(func(ctx context.Context) (<-chan int, error) {
+					return pipeline.FromSlice(ctx, []int{1}), nil
+				}).
+					ThenCtx(func(ctx context.Context, v int) (int, error) {
+						<-ctx.Done()
+						return 0, ctx.Err()
+					}, pipeline.WithItemTimeout(time.Hour)).
+					Run(ctx)
+			},
+			wantErr: context.DeadlineExceeded,
+			took:    time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				start := time.Now()
+				if err := tt.run(context.Background()); !errors.Is(err, tt.wantErr) {
+					t.Errorf("Run = %v, want %v", err, tt.wantErr)
+				}
+				if took := time.Since(start); took != tt.took {
+					t.Errorf("took %v, want %v", took, tt.took)
+				}
+			})
+		})
+	}
+}
+
+func TestSynctestBatch(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		in := make(chan int)
+		batches := pipeline.Batch(ctx, in, 10, time.Minute)
+		in <- 1
+		in <- 2
+
+		time.Sleep(time.Minute - time.Nanosecond)
+		synctest.Wait()
+		select {
+		case b := <-batches:
+			t.Fatalf("got %v before maxWait", b)
+		default:
+		}
+
+		time.Sleep(time.Nanosecond)
+		synctest.Wait()
+		select {
+		case b := <-batches:
+			if !slices.Equal(b, []int{1, 2}) {
+				t.Errorf("got %v, want [1 2]", b)
+			}
+		default:
+			t.Fatal("no batch once maxWait passed")
+		}
+		close(in)
+	})
+}
+
+// TestSynctestDebounce drives Debounce with a FakeClock, waiting for it to
+// take in every value before moving the clock.
+func TestSynctestDebounce(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, clock := fakeContext(t)
+		in := make(chan int)
+		out := pipeline.Debounce(ctx, in, time.Second)
+		ready := func() (int, bool) {
+			synctest.Wait()
+			select {
+			case v := <-out:
+				return v, true
+			default:
+				return 0, false
+			}
+		}
+
+		// every value restarts the wait, the burst comes out as its last
+		in <- 1
+		synctest.Wait()
+		clock.Advance(500 * time.Millisecond)
+		in <- 2
+		synctest.Wait()
+		clock.Advance(time.Second - time.Nanosecond)
+		if v, ok := ready(); ok {
+			t.Fatalf("got %d before the input went quiet", v)
+		}
+		clock.Advance(time.Nanosecond)
+		if v, ok := ready(); !ok || v != 2 {
+			t.Fatalf("got %d, %t once quiet, want 2", v, ok)
+		}
+
+		// closing the input flushes the value still waiting
+		in <- 3
+		close(in)
+		if v, ok := ready(); !ok || v != 3 {
+			t.Fatalf("got %d, %t once closed, want 3", v, ok)
+		}
+		if rest := pipelinetest.Collect(t, out); len(rest) != 0 {
+			t.Errorf("got %v after the flush, want nothing", rest)
+		}
+	})
+}
+
+func TestSynctestSingleflight(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var calls atomic.Int64
+		release := make(chan struct{})
+		square := func(v int) (int, error) {
+			calls.Add(1)
+			<-release
+			return v * v, nil
+		}
+
+		// every value is in flight before the shared call is let through,
+		// either calling fn or waiting for the call of its key
+		go func() {
+			synctest.Wait()
+			close(release)
+		}()
+		out, errs := pipelinetest.RunStage(t, square, []int{3, 3, 3, 4},
+			pipeline.WithConcurrency(4),
+			pipeline.WithSingleflight(strconv.Itoa),
+		)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if want := []int{9, 9, 9, 16}; !slices.Equal(out, want) {
+			t.Errorf("got %v, want %v", out, want)
+		}
+		if calls.Load() != 2 {
+			t.Errorf("fn called %d times, want once per key", calls.Load())
+		}
+	})
+}
+
+func TestSynctestSimulate(t *testing.T) {
+	sleep := func(d time.Duration) func(int) (int, error) {
+		return func(v int) (int, error) {
+			time.Sleep(d)
+			return v, nil
+		}
+	}
+
+	tests := []struct {
+		name  string
+		load  pipeline.LoadProfile
+		build func(source pipeline.Source[int]) *pipeline.Pipeline[int]
+		// check looks at the samples of the simulation
+		check func(t *testing.T, samples []pipeline.SimulationSample)
+	}{
+		{
+			name: "keeping up",
+			load: pipeline.Steady(100),
+			build: func(source pipeline.Source[int]) *pipeline.Pipeline[int] {
+				return pipeline.New(source).Then(sleep(time.Millisecond))
+			},
+			check: func(t *testing.T, samples []pipeline.SimulationSample) {
+				for _, s := range samples {
+					if s.Offered-s.Produced > 1 || s.Stages[0].Queued > 1 {
+						t.Errorf("at %v offered %d, produced %d and queued %d, want no backlog", s.At, s.Offered, s.Produced, s.Stages[0].Queued)
+					}
+				}
+				// the last sample may follow the previous one too closely to see
+				// a value processed
+				for _, s := range samples[:len(samples)-1] {
+					if s.Stages[0].MeanLatency != time.Millisecond || s.Stages[0].MaxLatency != time.Millisecond {
+						t.Errorf("at %v latencies %v and %v, want 1ms", s.At, s.Stages[0].MeanLatency, s.Stages[0].MaxLatency)
+					}
+				}
+				if last := samples[len(samples)-1]; last.Offered != 100 || last.Done != 100 {
+					t.Errorf("offered %d and done %d, want 100", last.Offered, last.Done)
+				}
+			},
+		},
+		{
+			name: "falling behind",
+			load: pipeline.Ramp(0, 400, time.Second),
+			build: func(source pipeline.Source[int]) *pipeline.Pipeline[int] {
+				return pipeline.New(source).Then(sleep(5*time.Millisecond), pipeline.WithConcurrency(1))
+			},
+			check: func(t *testing.T, samples []pipeline.SimulationSample) {
+				var backlog int64
+				for i, s := range samples {
+					if i > 0 && s.Rate < samples[i-1].Rate {
+						t.Errorf("rate fell to %v at %v, want it ramping up", s.Rate, s.At)
+					}
+					backlog = max(backlog, s.Offered-s.Produced)
+				}
+				// the step handles 200 a second, half what is offered at the end
+				if backlog < 20 {
+					t.Errorf("backlog of at most %d, want it building up", backlog)
+				}
+				if last := samples[len(samples)-1]; last.Done != last.Offered {
+					t.Errorf("done %d of %d once drained, want every value", last.Done, last.Offered)
+				}
+			},
+		},
+		{
+			name: "shedding a burst",
+			load: pipeline.Burst(10, 1000, 500*time.Millisecond, 100*time.Millisecond),
+			build: func(source pipeline.Source[int]) *pipeline.Pipeline[int] {
+				return pipeline.New(source).
+					Then(sleep(0), pipeline.WithName("shed"), pipeline.WithBuffer(10), pipeline.WithBackpressure(pipeline.DropNewest)).
+					Sink(func(int) error { time.Sleep(5 * time.Millisecond); return nil })
+			},
+			check: func(t *testing.T, samples []pipeline.SimulationSample) {
+				last := samples[len(samples)-1]
+				if last.Dropped == 0 || last.Stages[0].Dropped != last.Dropped || last.Stages[0].Name != "shed" {
+					t.Errorf("dropped %d, %+v, want the burst shed by the step", last.Dropped, last.Stages[0])
+				}
+				if last.Done+last.Dropped != last.Produced {
+					t.Errorf("done %d and dropped %d of %d, want every value accounted for", last.Done, last.Dropped, last.Produced)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				samples, err := pipeline.Simulate(context.Background(), pipeline.Simulation[int]{
+					Load:     tt.load,
+					Duration: time.Second,
+					Interval: 100 * time.Millisecond,
+				}, tt.build)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(samples) < 10 {
+					t.Fatalf("took %d samples, want one every 100ms", len(samples))
+				}
+				tt.check(t, samples)
+			})
+		})
+	}
+}
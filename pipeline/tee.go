@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+)
+
+// Tee duplicates every value from in to n independent outputs, each with its
+// own buffer of up to buffer values, so one stream can feed e.g. both a
+// metrics branch and a processing branch.
+//
+// Consumers may fall up to buffer values behind the fastest one; beyond
+// that the slowest consumer holds up the rest, as nothing is ever dropped.
+// Unlike FanOut in Broadcast mode, a value is handed to every consumer that
+// can take it as soon as it arrives rather than to one output after another.
+// All outputs are closed once in is closed or ctx is done.
+func Tee[T any](ctx context.Context, in <-chan T, n int, buffer int) []<-chan T {
+	if n < 1 {
+		n = 1
+	}
+	if buffer < 0 {
+		buffer = 0
+	}
+
+	outs := make([]chan T, n)
+	result := make([]<-chan T, n)
+	for i := range outs {
+		outs[i] = make(chan T, buffer)
+		result[i] = outs[i]
+	}
+
+	go func() {
+		defer closeAll(outs)
+
+		pending := make([]chan T, 0, n)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				// fill every buffer with room straight away
+				pending = pending[:0]
+				for _, out := range outs {
+					select {
+					case out <- v:
+					default:
+						pending = append(pending, out)
+					}
+				}
+
+				if !sendAll(ctx, pending, v) {
+					return
+				}
+			}
+		}
+	}()
+
+	return result
+}
+
+// sendAll sends v on every channel in outs in whatever order they become
+// ready, reporting false if ctx is done first.
+func sendAll[T any](ctx context.Context, outs []chan T, v T) bool {
+	if len(outs) == 0 {
+		return true
+	}
+
+	cases := make([]reflect.SelectCase, 0, len(outs)+1)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+	value := reflect.ValueOf(&v).Elem()
+	for _, out := range outs {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(out), Send: value})
+	}
+
+	for len(cases) > 1 {
+		chosen, _, _ := reflect.Select(cases)
+		if chosen == 0 {
+			return false
+		}
+		cases = append(cases[:chosen], cases[chosen+1:]...)
+	}
+
+	return true
+}
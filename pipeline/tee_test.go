@@ -0,0 +1,57 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestTee(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	want := []int{1, 2, 3}
+	got := fannedOut(pipeline.Tee(context.Background(), waiting(want...), 3, 0))
+	for i, values := range got {
+		if !slices.Equal(values, want) {
+			t.Errorf("output %d got %v, want %v", i, values, want)
+		}
+	}
+}
+
+// TestTeeBuffer checks a consumer can run ahead of the others by as many
+// values as the buffer holds.
+func TestTeeBuffer(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	want := []int{1, 2, 3}
+	outs := pipeline.Tee(context.Background(), waiting(want...), 2, len(want))
+	if got := pipelinetest.Collect(t, outs[0]); !slices.Equal(got, want) {
+		t.Errorf("first output got %v, want %v", got, want)
+	}
+	if got := pipelinetest.Collect(t, outs[1]); !slices.Equal(got, want) {
+		t.Errorf("second output got %v, want %v", got, want)
+	}
+}
+
+func TestTeeStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int, 1)
+	defer close(in)
+	in <- 1
+
+	// nobody reads the second output, so the tee is stuck sending to it
+	outs := pipeline.Tee(ctx, in, 2, 0)
+	if got := pipelinetest.Receive(t, outs[0]); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	cancel()
+	// the second output may still take the 1, but nothing comes after it
+	if got := fannedOut(outs); len(got[0]) != 0 {
+		t.Errorf("got %v after cancelling, want nothing more", got[0])
+	}
+}
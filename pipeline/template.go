@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Template makes pipelines of a Manager from a single definition, one per
+// set of params, e.g. one per input file or per customer:
+//
+//	perFile := pipeline.NewTemplate(m, "import", func(path string) (pipeline.Runnable, error) {
+//		return pipeline.New(lines(path)).Then(parse).Sink(store), nil
+//	}, pipeline.WithWorkerBudget(8))
+//	for _, path := range paths {
+//		if err := perFile.Instantiate(filepath.Base(path), path); err != nil {
+//			return err
+//		}
+//	}
+//
+// Every instance is a pipeline of the Manager called name/key, so they are
+// stopped, swapped and reported on like any other. The ManagerOptions of a
+// Template, such as WithWorkerBudget, limit its instances between them, on
+// top of the Manager's own limits, so all of them together can't take more
+// than their share. A Template is safe for concurrent use.
+type Template[P any] struct {
+	m      *Manager
+	name   string
+	build  func(params P) (Runnable, error)
+	limits *sharedLimits
+
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// NewTemplate returns the Template of m called name making its instances
+// with build.
+func NewTemplate[P any](m *Manager, name string, build func(params P) (Runnable, error), opts ...ManagerOption) *Template[P] {
+	limits := &sharedLimits{parent: m.limits}
+	for _, opt := range opts {
+		opt(limits)
+	}
+
+	return &Template[P]{m: m, name: name, build: build, limits: limits, keys: make(map[string]bool)}
+}
+
+// Name returns the name of the Manager's pipeline that is the instance
+// called key.
+func (t *Template[P]) Name(key string) string {
+	return t.name + "/" + key
+}
+
+// Instantiate builds the instance called key from params, adds it to the
+// Manager and starts it. It returns ErrPipelineExists if there already is
+// an instance called key, running or not.
+func (t *Template[P]) Instantiate(key string, params P) error {
+	r, err := t.build(params)
+	if err != nil {
+		return fmt.Errorf("pipeline: building %s: %w", t.Name(key), err)
+	}
+
+	t.m.mu.Lock()
+	err = t.m.add(t.Name(key), r, t.limits)
+	t.m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.keys[key] = true
+	t.mu.Unlock()
+	return t.m.Start(t.Name(key))
+}
+
+// Remove stops the instance called key and removes it from the Manager, see
+// Manager.Remove.
+func (t *Template[P]) Remove(ctx context.Context, key string) error {
+	if err := t.m.Remove(ctx, t.Name(key)); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	delete(t.keys, key)
+	t.mu.Unlock()
+	return nil
+}
+
+// Keys returns the keys of the instances still in the Manager, sorted.
+func (t *Template[P]) Keys() []string {
+	names := t.m.Names()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var keys []string
+	for key := range t.keys {
+		if _, found := slices.BinarySearch(names, t.Name(key)); found {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Stats returns the Stats of every instance still in the Manager, by key.
+func (t *Template[P]) Stats() map[string]Stats {
+	stats := make(map[string]Stats)
+	for name, s := range t.m.Stats() {
+		if key, ok := strings.CutPrefix(name, t.name+"/"); ok && t.has(key) {
+			stats[key] = s
+		}
+	}
+	return stats
+}
+
+func (t *Template[P]) has(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.keys[key]
+}
@@ -0,0 +1,155 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestTemplate(t *testing.T) {
+	m := pipeline.NewManager(context.Background())
+	var built []int
+	perCustomer := pipeline.NewTemplate(m, "customer", func(id int) (pipeline.Runnable, error) {
+		if id < 0 {
+			return nil, errBad
+		}
+		built = append(built, id)
+		return pipeline.New(blockingSource).Sink(func(int) error { return nil }), nil
+	})
+
+	for _, id := range []int{1, 2} {
+		if err := perCustomer.Instantiate("c"+strconv.Itoa(id), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{name: "taken", call: func() error { return perCustomer.Instantiate("c1", 3) }, want: pipeline.ErrPipelineExists},
+		{name: "build fails", call: func() error { return perCustomer.Instantiate("bad", -1) }, want: errBad},
+		{name: "remove unknown", call: func() error { return perCustomer.Remove(context.Background(), "c9") }, want: pipeline.ErrUnknownPipeline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if got, want := m.Names(), []string{"customer/c1", "customer/c2"}; !slices.Equal(got, want) {
+		t.Errorf("Manager has %q, want %q", got, want)
+	}
+	waitFor(t, "both instances running", func() bool {
+		for _, s := range m.Status() {
+			if !s.Running {
+				return false
+			}
+		}
+		return true
+	})
+	if got := perCustomer.Stats(); len(got) != 2 {
+		t.Errorf("Stats() = %v, want both instances", got)
+	}
+
+	if err := perCustomer.Remove(context.Background(), "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := perCustomer.Keys(), []string{"c2"}; !slices.Equal(got, want) {
+		t.Errorf("Keys() = %q, want %q", got, want)
+	}
+	// an instance removed through the Manager is gone from the Template too
+	if err := m.Remove(context.Background(), perCustomer.Name("c2")); err != nil {
+		t.Fatal(err)
+	}
+	if got := perCustomer.Keys(); len(got) != 0 {
+		t.Errorf("Keys() = %q, want none", got)
+	}
+	if !slices.Equal(built, []int{1, 2, 3}) {
+		t.Errorf("built %v, want every instance asked for that could be", built)
+	}
+}
+
+func TestTemplateBudget(t *testing.T) {
+	const managerBudget, templateBudget = 4, 2
+	m := pipeline.NewManager(context.Background(), pipeline.WithWorkerBudget(managerBudget))
+
+	// running counts the calls of the template's instances, of the other
+	// pipeline of the Manager and of both running at a time
+	var running, most [3]atomic.Int32
+	count := func(i int) {
+		n := running[i].Add(1)
+		for {
+			prev := most[i].Load()
+			if n <= prev || most[i].CompareAndSwap(prev, n) {
+				return
+			}
+		}
+	}
+	work := func(i int) func(int) (int, error) {
+		return func(v int) (int, error) {
+			count(i)
+			count(2)
+			defer running[i].Add(-1)
+			defer running[2].Add(-1)
+			time.Sleep(time.Millisecond)
+			return v, nil
+		}
+	}
+	newPipeline := func(i int) *pipeline.Pipeline[int] {
+		return pipeline.New(blockingSource).
+			Then(work(i), pipeline.WithConcurrency(8)).
+			Sink(func(int) error { return nil })
+	}
+
+	perFile := pipeline.NewTemplate(m, "file", func(int) (pipeline.Runnable, error) {
+		return newPipeline(0), nil
+	}, pipeline.WithWorkerBudget(templateBudget))
+	for _, key := range []string{"a", "b", "c"} {
+		if err := perFile.Instantiate(key, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Add("other", newPipeline(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("other"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "every pipeline to make progress", func() bool {
+		for _, s := range m.Stats() {
+			if s.Done < 5 {
+				return false
+			}
+		}
+		return true
+	})
+	// swapped in instances stay subject to the template's budget
+	if err := m.Swap(context.Background(), perFile.Name("a"), newPipeline(0)); err != nil {
+		t.Fatal(err)
+	}
+	done := m.Stats()[perFile.Name("a")].Done
+	waitFor(t, "the swapped instance to make progress", func() bool {
+		return m.Stats()[perFile.Name("a")].Done >= done+5
+	})
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := most[0].Load(); got > templateBudget {
+		t.Errorf("%d of the template's calls ran at once, want at most %d", got, templateBudget)
+	}
+	if got := most[2].Load(); got > managerBudget {
+		t.Errorf("%d calls ran at once, want at most %d", got, managerBudget)
+	}
+}
@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrTenantQuota is wrapped by the error a value fails with when its tenant
+// has as many values in flight as its quota allows, see TenantQuota.
+var ErrTenantQuota = errors.New("pipeline: tenant quota exceeded")
+
+// TenantQuota bounds what one tenant's values may take of a step shared
+// between tenants. Zero fields don't limit anything.
+type TenantQuota struct {
+	// Rate and Burst limit how many of the tenant's calls start per
+	// second, as WithRateLimit does for the whole step.
+	Rate  rate.Limit
+	Burst int
+	// Concurrency is how many of the tenant's calls run at a time, the
+	// others wait for their turn.
+	Concurrency int
+	// MaxInFlight is how many of the tenant's values may be running or
+	// waiting for their turn at a time; those past it fail at once with
+	// ErrTenantQuota, so a tenant's backlog can't hold up all of the step's
+	// workers.
+	MaxInFlight int
+}
+
+// TenantStats is what a tenant's values did in the steps of a
+// TenantQuotas. Calls count attempts, so a retried value counts more than
+// once.
+type TenantStats struct {
+	// InFlight is how many values are running or waiting for their turn.
+	InFlight int64
+	// Processed and Failed count the calls that returned, Rejected the
+	// values failed with ErrTenantQuota.
+	Processed int64
+	Failed    int64
+	Rejected  int64
+}
+
+// TenantQuotas enforces a quota for each tenant of the steps it is given to
+// with WithTenantQuotas, so one noisy tenant of a multi-tenant pipeline
+// can't starve the others, and counts what each tenant's values did:
+//
+//	quotas := pipeline.NewTenantQuotas(func(tenant string) pipeline.TenantQuota {
+//		if premium[tenant] {
+//			return pipeline.TenantQuota{Concurrency: 8, MaxInFlight: 64}
+//		}
+//		return pipeline.TenantQuota{Rate: 10, Burst: 10, Concurrency: 2, MaxInFlight: 16}
+//	})
+//	out, errs := pipeline.Step(ctx, events, enrich,
+//		pipeline.WithConcurrency(32),
+//		pipeline.WithTenantQuotas(quotas, func(e Event) string { return e.Tenant }))
+//
+// A value waiting for its tenant's turn holds one of the step's workers, so
+// give the step more workers than a tenant's Concurrency and bound the
+// waiting with MaxInFlight. Steps given the same TenantQuotas share the
+// quotas. A TenantQuotas keeps every tenant it has seen and is safe for
+// concurrent use.
+type TenantQuotas struct {
+	quota func(tenant string) TenantQuota
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+}
+
+type tenant struct {
+	quota   TenantQuota
+	limiter *rate.Limiter
+	// turns bounds the calls running, nil if they aren't
+	turns chan struct{}
+
+	inFlight  atomic.Int64
+	processed atomic.Int64
+	failed    atomic.Int64
+	rejected  atomic.Int64
+}
+
+// NewTenantQuotas returns a TenantQuotas asking quota for the quota of
+// every tenant the first time one of its values comes through.
+func NewTenantQuotas(quota func(tenant string) TenantQuota) *TenantQuotas {
+	return &TenantQuotas{quota: quota, tenants: make(map[string]*tenant)}
+}
+
+func (q *TenantQuotas) tenant(name string) *tenant {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t, ok := q.tenants[name]
+	if ok {
+		return t
+	}
+	t = &tenant{quota: q.quota(name)}
+	if t.quota.Rate > 0 {
+		t.limiter = rate.NewLimiter(t.quota.Rate, max(t.quota.Burst, 1))
+	}
+	if t.quota.Concurrency > 0 {
+		t.turns = make(chan struct{}, t.quota.Concurrency)
+	}
+	q.tenants[name] = t
+	return t
+}
+
+// Stats returns the TenantStats of every tenant seen so far, by tenant.
+func (q *TenantQuotas) Stats() map[string]TenantStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := make(map[string]TenantStats, len(q.tenants))
+	for name, t := range q.tenants {
+		stats[name] = TenantStats{
+			InFlight:  t.inFlight.Load(),
+			Processed: t.processed.Load(),
+			Failed:    t.failed.Load(),
+			Rejected:  t.rejected.Load(),
+		}
+	}
+	return stats
+}
+
+// WithTenantQuotas subjects the step's calls to the quota of the tenant
+// tenantFn(input) names, see TenantQuotas. In must be the step's input type.
+// The quotas apply to every attempt at a value, inside retries.
+func WithTenantQuotas[In any](quotas *TenantQuotas, tenantFn func(In) string) StepOption {
+	return WithMiddleware(func(next StepFunc) StepFunc {
+		return func(ctx context.Context, v any) (any, error) {
+			in, _ := v.(In)
+			name := tenantFn(in)
+			t := quotas.tenant(name)
+
+			n := t.inFlight.Add(1)
+			defer t.inFlight.Add(-1)
+			if t.quota.MaxInFlight > 0 && n > int64(t.quota.MaxInFlight) {
+				t.rejected.Add(1)
+				return nil, fmt.Errorf("%w: %s", ErrTenantQuota, name)
+			}
+
+			if t.limiter != nil {
+				if err := t.limiter.Wait(ctx); err != nil {
+					return nil, err
+				}
+			}
+			if t.turns != nil {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case t.turns <- struct{}{}:
+				}
+				defer func() { <-t.turns }()
+			}
+
+			out, err := next(ctx, v)
+			if err != nil {
+				t.failed.Add(1)
+			} else {
+				t.processed.Add(1)
+			}
+			return out, err
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+type tenantValue struct {
+	tenant string
+	n      int
+}
+
+func byTenant(v tenantValue) string { return v.tenant }
+
+func TestWithTenantQuotasNoisyTenant(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	quotas := pipeline.NewTenantQuotas(func(tenant string) pipeline.TenantQuota {
+		if tenant == "noisy" {
+			return pipeline.TenantQuota{Concurrency: 1, MaxInFlight: 2}
+		}
+		return pipeline.TenantQuota{}
+	})
+	release := make(chan struct{})
+	in := make(chan tenantValue)
+	out, errs := pipeline.Step(context.Background(), in, func(v tenantValue) (tenantValue, error) {
+		if v.tenant == "noisy" {
+			<-release
+		}
+		return v, nil
+	}, pipeline.WithConcurrency(8), pipeline.WithTenantQuotas(quotas, byTenant))
+
+	for i := range 4 {
+		in <- tenantValue{tenant: "noisy", n: i}
+	}
+	// two of the noisy tenant's values are past its budget, the quiet
+	// tenant's goes through while the others hold theirs
+	for range 2 {
+		if err := pipelinetest.Receive(t, errs); !errors.Is(err, pipeline.ErrTenantQuota) {
+			t.Errorf("error = %v, want ErrTenantQuota", err)
+		}
+	}
+	in <- tenantValue{tenant: "quiet"}
+	if got := pipelinetest.Receive(t, out); got.tenant != "quiet" {
+		t.Errorf("got %v first, want the quiet tenant's value", got)
+	}
+
+	stats := quotas.Stats()
+	if got, want := stats["noisy"], (pipeline.TenantStats{InFlight: 2, Rejected: 2}); got != want {
+		t.Errorf("noisy stats = %+v, want %+v", got, want)
+	}
+	if got, want := stats["quiet"], (pipeline.TenantStats{Processed: 1}); got != want {
+		t.Errorf("quiet stats = %+v, want %+v", got, want)
+	}
+
+	close(release)
+	close(in)
+	if got := pipelinetest.Collect(t, out); len(got) != 2 {
+		t.Errorf("got %v after the release, want the noisy tenant's two values", got)
+	}
+	if got, want := quotas.Stats()["noisy"], (pipeline.TenantStats{Processed: 2, Rejected: 2}); got != want {
+		t.Errorf("noisy stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithTenantQuotasConcurrency(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	limits := map[string]int{"a": 1, "b": 3}
+	quotas := pipeline.NewTenantQuotas(func(tenant string) pipeline.TenantQuota {
+		return pipeline.TenantQuota{Concurrency: limits[tenant]}
+	})
+
+	var mu sync.Mutex
+	running, most := map[string]int{}, map[string]int{}
+	fn := func(v tenantValue) (tenantValue, error) {
+		mu.Lock()
+		running[v.tenant]++
+		most[v.tenant] = max(most[v.tenant], running[v.tenant])
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running[v.tenant]--
+		mu.Unlock()
+		return v, nil
+	}
+
+	var values []tenantValue
+	for i := range 60 {
+		values = append(values, tenantValue{tenant: string(rune('a' + i%2)), n: i})
+	}
+	got, errs := pipelinetest.RunStage(t, fn, values, pipeline.WithConcurrency(8), pipeline.WithTenantQuotas(quotas, byTenant))
+	if len(errs) > 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	if len(got) != len(values) {
+		t.Errorf("got %d values, want %d", len(got), len(values))
+	}
+	for tenant, limit := range limits {
+		if most[tenant] > limit {
+			t.Errorf("tenant %s ran %d calls at once, want at most %d", tenant, most[tenant], limit)
+		}
+		if s := quotas.Stats()[tenant]; s.Processed != 30 || s.InFlight != 0 {
+			t.Errorf("tenant %s stats = %+v, want 30 processed", tenant, s)
+		}
+	}
+}
+
+func TestWithTenantQuotas(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota pipeline.TenantQuota
+		fn    func(tenantValue) (tenantValue, error)
+		want  pipeline.TenantStats
+	}{
+		{
+			name: "unlimited",
+			fn:   func(v tenantValue) (tenantValue, error) { return v, nil },
+			want: pipeline.TenantStats{Processed: 5},
+		},
+		{
+			name:  "rate limited",
+			quota: pipeline.TenantQuota{Rate: 1000, Burst: 1},
+			fn:    func(v tenantValue) (tenantValue, error) { return v, nil },
+			want:  pipeline.TenantStats{Processed: 5},
+		},
+		{
+			name: "failed",
+			fn:   func(v tenantValue) (tenantValue, error) { return v, errBad },
+			want: pipeline.TenantStats{Failed: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotas := pipeline.NewTenantQuotas(func(string) pipeline.TenantQuota { return tt.quota })
+			values := make([]tenantValue, 5)
+			for i := range values {
+				values[i] = tenantValue{tenant: "t", n: i}
+			}
+			pipelinetest.RunStage(t, tt.fn, values, pipeline.WithTenantQuotas(quotas, byTenant))
+			if got := quotas.Stats()["t"]; got != tt.want {
+				t.Errorf("stats = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTenantQuotasCancelled(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	quotas := pipeline.NewTenantQuotas(func(string) pipeline.TenantQuota {
+		return pipeline.TenantQuota{Concurrency: 1}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan tenantValue)
+	out, errs := pipeline.StepCtx(ctx, in, func(ctx context.Context, v tenantValue) (tenantValue, error) {
+		<-ctx.Done()
+		return v, ctx.Err()
+	}, pipeline.WithConcurrency(2), pipeline.WithTenantQuotas(quotas, byTenant))
+
+	in <- tenantValue{tenant: "t"}
+	in <- tenantValue{tenant: "t"}
+	waitFor(t, "both values in flight", func() bool { return quotas.Stats()["t"].InFlight == 2 })
+	// the second value stops waiting for its turn once the step is cancelled
+	cancel()
+	go func() {
+		for range errs {
+		}
+	}()
+	pipelinetest.Collect(t, out)
+	if s := quotas.Stats()["t"]; s.InFlight != 0 {
+		t.Errorf("stats = %+v after the step ended, want nothing in flight", s)
+	}
+}
@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// ThrottleMode selects what Throttle does with values arriving too soon.
+type ThrottleMode int
+
+const (
+	// ThrottleDrop discards values arriving before the interval is up,
+	// handing them to the hook of WithDropHook as DroppedThrottled.
+	ThrottleDrop ThrottleMode = iota
+	// ThrottleQueue holds values back until it is their turn. The values
+	// wait upstream, so a throttled stream applies backpressure.
+	ThrottleQueue
+)
+
+// Throttle emits at most one value from in per interval, dropping or
+// delaying the rest as told by mode, for bursty sources such as webhooks.
+// The output is closed once in is closed or ctx is done.
+func Throttle[T any](ctx context.Context, in <-chan T, interval time.Duration, mode ThrottleMode) <-chan T {
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		clock := ClockFrom(ctx)
+		drop := dropHook(ctx)
+		var next time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				if wait := next.Sub(clock.Now()); wait > 0 {
+					if mode == ThrottleDrop {
+						drop(v, DroppedThrottled)
+						continue
+					}
+
+					timer := clock.NewTimer(wait)
+					select {
+					case <-ctx.Done():
+						timer.Stop()
+						return
+					case <-timer.C():
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case outChannel <- v:
+				}
+				next = clock.Now().Add(interval)
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// Debounce waits for in to go quiet: it emits a value only once no other
+// value has followed it for quiet, so a burst of events such as file writes
+// collapses into its last value. A value still waiting when in is closed is
+// emitted straight away. The output is closed after that or once ctx is
+// done.
+func Debounce[T any](ctx context.Context, in <-chan T, quiet time.Duration) <-chan T {
+	outChannel := make(chan T)
+
+	go func() {
+		defer close(outChannel)
+
+		timer := ClockFrom(ctx).NewTimer(quiet)
+		timer.Stop()
+		defer timer.Stop()
+
+		var (
+			latest  T
+			pending bool
+		)
+		send := func() bool {
+			pending = false
+			select {
+			case <-ctx.Done():
+				return false
+			case outChannel <- latest:
+				return true
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C():
+				if pending && !send() {
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					if pending {
+						send()
+					}
+					return
+				}
+
+				latest, pending = v, true
+				timer.Reset(quiet)
+			}
+		}
+	}()
+
+	return outChannel
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// WithItemTimeout limits every call of fn to d. A call that runs longer fails
+// with an error wrapping context.DeadlineExceeded, which goes to the error
+// channel like any other failure and is retried if WithRetry is set.
+//
+// The worker moves on straight away. A plain Step fn can't be interrupted, so
+// a timed out call keeps running in the background until it returns and its
+// result is discarded; StepCtx transforms see their context expire and can
+// stop early.
+func WithItemTimeout(d time.Duration) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.itemTimeout = d
+	}
+}
+
+// withTimeout wraps fn so each call gives up after d.
+func withTimeout[In any, Out any](fn func(context.Context, In) (Out, error), d time.Duration) func(context.Context, In) (Out, error) {
+	type result struct {
+		out Out
+		err error
+	}
+
+	return func(ctx context.Context, in In) (Out, error) {
+		callCtx, cancel := withClockTimeout(ctx, d)
+		defer cancel()
+		claim := new(atomic.Int32)
+		callCtx = context.WithValue(callCtx, callClaimKey{}, claim)
+
+		// buffered so an abandoned call can still finish and exit
+		done := make(chan result, 1)
+		go func() {
+			out, err := fn(callCtx, in)
+			done <- result{out: out, err: err}
+		}()
+
+		select {
+		case r := <-done:
+			return r.out, r.err
+		case <-callCtx.Done():
+			if !claim.CompareAndSwap(callRunning, callTimedOut) {
+				// the call claimed its result first, see claimCall
+				r := <-done
+				return r.out, r.err
+			}
+
+			var zero Out
+			if err := ctx.Err(); err != nil {
+				return zero, err
+			}
+
+			return zero, fmt.Errorf("timed out after %s: %w", d, context.DeadlineExceeded)
+		}
+	}
+}
+
+// The states of a timed call's claim.
+const (
+	callRunning int32 = iota
+	callClaimed
+	callTimedOut
+)
+
+type callClaimKey struct{}
+
+// claimCall reports whether the call running with ctx may still take effect,
+// for a call that has to commit something once it's done, such as a
+// StatefulStep's new state. Under WithItemTimeout it settles the race with
+// the timeout: a claimed call's result is waited for even if the timeout
+// fires right after, while a call that has already timed out can't be
+// claimed, and its result is discarded.
+func claimCall(ctx context.Context) bool {
+	claim, ok := ctx.Value(callClaimKey{}).(*atomic.Int32)
+	if !ok {
+		return true
+	}
+
+	return claim.CompareAndSwap(callRunning, callClaimed)
+}
@@ -0,0 +1,29 @@
+package pipeline
+
+import "context"
+
+// Tracer starts a span around every call of a step's fn, see WithTracer. The
+// pipelineotel package provides an OpenTelemetry implementation.
+type Tracer interface {
+	// StartCall is called before fn runs. fn is called with the returned
+	// context, and end is called with fn's error once it returns.
+	StartCall(ctx context.Context, call CallInfo) (callCtx context.Context, end func(err error))
+}
+
+// CallInfo describes a single call of a step's fn.
+type CallInfo struct {
+	// Stage is the step's name, as set with WithName, or for an unnamed
+	// step of a Pipeline its position, e.g. "step 2".
+	Stage string
+	// Attempt counts calls for the same input, starting at 1.
+	Attempt int
+	// Input is the value fn is called with.
+	Input any
+}
+
+// WithTracer traces every call of fn, retries included, with t.
+func WithTracer(t Tracer) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.tracer = t
+	}
+}
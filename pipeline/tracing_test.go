@@ -0,0 +1,39 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+// stages records the stage of every call traced.
+type stages struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (s *stages) StartCall(ctx context.Context, call pipeline.CallInfo) (context.Context, func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen = append(s.seen, call.Stage)
+	return ctx, func(error) {}
+}
+
+func TestTracerStages(t *testing.T) {
+	tracer := &stages{}
+	identity := func(v int) (int, error) { return v, nil }
+	err := pipeline.New(pipeline.SliceSource([]int{1})).
+		Then(identity, pipeline.WithName("parse"), pipeline.WithTracer(tracer)).
+		Then(identity, pipeline.WithTracer(tracer)).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"parse", "step 2"}; !slices.Equal(tracer.seen, want) {
+		t.Errorf("traced stages %q, want %q", tracer.seen, want)
+	}
+}
@@ -0,0 +1,59 @@
+package pipeline
+
+import "context"
+
+// The helpers below compose func(In) (Out, error) transforms before they are
+// mounted as a step, so fallbacks, defaults and error wrapping don't each need
+// a tiny stage of their own.
+
+// Try lifts an infallible transform into the step signature. A panic raised
+// by fn is returned as a *PanicError instead of taking down the worker.
+func Try[In any, Out any](fn func(In) Out) func(In) (Out, error) {
+	call := recoverPanics(func(_ context.Context, in In) (Out, error) {
+		return fn(in), nil
+	})
+
+	return func(in In) (Out, error) {
+		return call(context.Background(), in)
+	}
+}
+
+// MapErr rewrites errors returned by fn, e.g. to wrap them with the input
+// that caused them. Successful results pass through untouched.
+func MapErr[In any, Out any](fn func(In) (Out, error), mapper func(In, error) error) func(In) (Out, error) {
+	return func(in In) (Out, error) {
+		out, err := fn(in)
+		if err != nil {
+			return out, mapper(in, err)
+		}
+
+		return out, nil
+	}
+}
+
+// OrElse calls fallback with the same input whenever fn fails. The fallback's
+// result, including its error, is returned as is.
+func OrElse[In any, Out any](fn func(In) (Out, error), fallback func(In) (Out, error)) func(In) (Out, error) {
+	return func(in In) (Out, error) {
+		out, err := fn(in)
+		if err != nil {
+			return fallback(in)
+		}
+
+		return out, nil
+	}
+}
+
+// Recover hands errors from fn to handler, which can swallow them by
+// returning a default value and a nil error, or return an error to keep the
+// item failing.
+func Recover[In any, Out any](fn func(In) (Out, error), handler func(In, error) (Out, error)) func(In) (Out, error) {
+	return func(in In) (Out, error) {
+		out, err := fn(in)
+		if err != nil {
+			return handler(in, err)
+		}
+
+		return out, nil
+	}
+}
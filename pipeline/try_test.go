@@ -0,0 +1,74 @@
+package pipeline_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func fails(int) (int, error) { return 0, errBad }
+
+func double(v int) (int, error) { return v * 2, nil }
+
+func TestTry(t *testing.T) {
+	fn := pipeline.Try(func(v int) int {
+		if v < 0 {
+			panic("negative")
+		}
+		return v + 1
+	})
+
+	if out, err := fn(1); out != 2 || err != nil {
+		t.Errorf("fn(1) = %d, %v, want 2, nil", out, err)
+	}
+	var p *pipeline.PanicError
+	if _, err := fn(-1); !errors.As(err, &p) || p.Value != "negative" {
+		t.Errorf("fn(-1) error = %v, want a *PanicError for the panic", err)
+	}
+}
+
+func TestMapErr(t *testing.T) {
+	wrap := func(in int, err error) error { return fmt.Errorf("item %d: %w", in, err) }
+
+	if out, err := pipeline.MapErr(double, wrap)(3); out != 6 || err != nil {
+		t.Errorf("MapErr(double)(3) = %d, %v, want 6, nil", out, err)
+	}
+	_, err := pipeline.MapErr(fails, wrap)(3)
+	if !errors.Is(err, errBad) || err.Error() != "item 3: "+errBad.Error() {
+		t.Errorf("MapErr(fails)(3) error = %v, want it wrapped with the input", err)
+	}
+}
+
+func TestOrElse(t *testing.T) {
+	if out, err := pipeline.OrElse(double, fails)(3); out != 6 || err != nil {
+		t.Errorf("OrElse(double, fails)(3) = %d, %v, want 6, nil", out, err)
+	}
+	if out, err := pipeline.OrElse(fails, double)(3); out != 6 || err != nil {
+		t.Errorf("OrElse(fails, double)(3) = %d, %v, want 6, nil", out, err)
+	}
+	if _, err := pipeline.OrElse(fails, fails)(3); !errors.Is(err, errBad) {
+		t.Errorf("OrElse(fails, fails)(3) error = %v, want %v", err, errBad)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var seen error
+	orDefault := func(in int, err error) (int, error) {
+		seen = err
+		return -in, nil
+	}
+
+	if out, err := pipeline.Recover(double, orDefault)(3); out != 6 || err != nil || seen != nil {
+		t.Errorf("Recover(double)(3) = %d, %v, want 6, nil without calling the handler", out, err)
+	}
+	if out, err := pipeline.Recover(fails, orDefault)(3); out != -3 || err != nil || seen != errBad {
+		t.Errorf("Recover(fails)(3) = %d, %v, want the handler's -3, nil", out, err)
+	}
+
+	rethrow := func(_ int, err error) (int, error) { return 0, fmt.Errorf("still: %w", err) }
+	if _, err := pipeline.Recover(fails, rethrow)(3); !errors.Is(err, errBad) {
+		t.Errorf("Recover(fails, rethrow)(3) error = %v, want it to wrap %v", err, errBad)
+	}
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// check is a preflight check of a pipeline's source, sinks or the services
+// its stages call, see Pipeline.Check.
+type check struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Check adds a check Validate runs before anything else, named after what it
+// checks, e.g. connecting to the broker the source reads from to see it is
+// reachable and takes the pipeline's credentials. The connectors of the
+// subpackages have a Check method for it:
+//
+//	p := pipeline.New(consumer.Source()).
+//		Then(enrich).
+//		Sink(writer.Sink(ctx)).
+//		Check("kafka", consumer.Check).
+//		Check("postgres", writer.Check)
+func (p *Pipeline[T]) Check(name string, fn func(ctx context.Context) error) *Pipeline[T] {
+	p.checks = append(p.checks, check{name: name, fn: fn})
+	return p
+}
+
+// Validate checks the pipeline could run without running it, for a dry run
+// before a deploy: that it has a source and every step a function, then runs
+// the checks added with Check, all at once. It reports every problem it
+// finds, joined, or nil, and never starts the source, so not a single value
+// is processed.
+func (p *Pipeline[T]) Validate(ctx context.Context) error {
+	var errs []error
+	if p.source == nil {
+		errs = append(errs, errors.New("pipeline: no source"))
+	}
+	for i, s := range p.stages {
+		if s.fn == nil {
+			errs = append(errs, fmt.Errorf("pipeline: step %d has no function", i+1))
+		}
+	}
+
+	return errors.Join(append(errs, runChecks(ctx, p.checks))...)
+}
+
+// Check adds a check ValidateContext runs, see Pipeline.Check.
+func (g *Graph) Check(name string, fn func(ctx context.Context) error) *Graph {
+	g.checks = append(g.checks, check{name: name, fn: fn})
+	return g
+}
+
+// ValidateContext is Validate followed by the checks added with Check, all
+// at once, as Pipeline.Validate does for a pipeline. It reports every
+// problem it finds, joined, or nil, without starting a single node.
+func (g *Graph) ValidateContext(ctx context.Context) error {
+	return errors.Join(g.Validate(), runChecks(ctx, g.checks))
+}
+
+// runChecks runs checks concurrently, joining what they fail with.
+func runChecks(ctx context.Context, checks []check) error {
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.fn(ctx); err != nil {
+				errs[i] = fmt.Errorf("pipeline: checking %s: %w", c.name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,122 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+)
+
+func TestPipelineValidate(t *testing.T) {
+	unreachable := errors.New("unreachable")
+	denied := errors.New("denied")
+	ok := func(context.Context) error { return nil }
+	failing := func(err error) func(context.Context) error {
+		return func(context.Context) error { return err }
+	}
+
+	tests := []struct {
+		name     string
+		pipeline func(source pipeline.Source[int]) *pipeline.Pipeline[int]
+		wantErrs []error
+		wantMsgs []string
+	}{
+		{
+			name: "valid",
+			pipeline: func(source pipeline.Source[int]) *pipeline.Pipeline[int] {
+				return pipeline.New(source).Then(func(v int) (int, error) { return v, nil }).Check("source", ok).Check("sink", ok)
+			},
+		},
+		{
+			name: "every check failing",
+			pipeline: func(source pipeline.Source[int]) *pipeline.Pipeline[int] {
+				return pipeline.New(source).Check("source", failing(unreachable)).Check("sink", failing(denied)).Check("cache", ok)
+			},
+			wantErrs: []error{unreachable, denied},
+			wantMsgs: []string{"checking source: unreachable", "checking sink: denied"},
+		},
+		{
+			name: "no source and no step function",
+			pipeline: func(pipeline.Source[int]) *pipeline.Pipeline[int] {
+				return pipeline.New[int](nil).Then(nil).Check("sink", failing(denied))
+			},
+			wantErrs: []error{denied},
+			wantMsgs: []string{"no source", "step 1 has no function"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var started atomic.Bool
+			source := func(ctx context.Context) (<-chan int, error) {
+				started.Store(true)
+				return pipeline.FromSlice(ctx, []int{1}), nil
+			}
+
+			err := tt.pipeline(source).Validate(context.Background())
+			if started.Load() {
+				t.Error("Validate started the source")
+			}
+			if len(tt.wantErrs) == 0 && len(tt.wantMsgs) == 0 && err != nil {
+				t.Fatalf("Validate = %v, want nil", err)
+			}
+			for _, want := range tt.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("Validate = %v, want it to wrap %v", err, want)
+				}
+			}
+			for _, want := range tt.wantMsgs {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate = %v, want it to report %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGraphValidateContext(t *testing.T) {
+	denied := errors.New("denied")
+	g := pipeline.NewGraph()
+	pipeline.AddSource(g, "numbers", pipeline.SliceSource([]int{1}))
+	pipeline.AddSink(g, "store", func(int) error { return nil })
+	pipeline.AddSink(g, "unconnected", func(int) error { return nil })
+	g.Connect("numbers", "store").
+		Check("store", func(context.Context) error { return denied })
+
+	err := g.ValidateContext(context.Background())
+	if !errors.Is(err, denied) {
+		t.Errorf("ValidateContext = %v, want the check's error", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), `sink "unconnected" has no input`) {
+		t.Errorf("ValidateContext = %v, want the unconnected sink reported too", err)
+	}
+}
+
+func TestValidateChecksConcurrently(t *testing.T) {
+	// each check waits for the other, so run one at a time they never end
+	aStarted, bStarted := make(chan struct{}), make(chan struct{})
+	wait := func(mine, other chan struct{}) func(context.Context) error {
+		return func(ctx context.Context) error {
+			close(mine)
+			select {
+			case <-other:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	p := pipeline.New(pipeline.SliceSource([]int{1})).
+		Check("a", wait(aStarted, bStarted)).
+		Check("b", wait(bStarted, aStarted))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.Validate(ctx); err != nil {
+		t.Errorf("Validate = %v, want the checks to run at once", err)
+	}
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStalled is wrapped by the error Run returns when the Watchdog stops a
+// stalled pipeline.
+var ErrStalled = errors.New("pipeline: stalled")
+
+// Watchdog watches the steps while the pipeline runs and flags any that has
+// had values in flight without finishing one for longer than after, which
+// usually means a call is hung or a step is deadlocked. A stalled step is
+// logged as a warning with its logger, see WithLogger, once per stall. If
+// cancel is set the pipeline is stopped too, and Run returns an error
+// wrapping ErrStalled that names the step.
+//
+// A step that is only waiting for input or for downstream to take its
+// results has nothing in flight, so it is the step holding things up that
+// gets flagged.
+func (p *Pipeline[T]) Watchdog(after time.Duration, cancel bool) *Pipeline[T] {
+	p.stallAfter = after
+	p.stallCancel = cancel
+	return p
+}
+
+// watch checks the steps counted by counter until ctx is done. It sends the
+// error stopping the run on the returned channel if cancel is set.
+func watch(ctx context.Context, counter *progressCounter, after time.Duration, cancel bool) <-chan error {
+	stalled := make(chan error, 1)
+
+	go func() {
+		ticker := counter.clock.NewTicker(max(after/4, time.Millisecond))
+		defer ticker.Stop()
+
+		// flagged keeps a stall from being logged on every tick
+		flagged := make([]bool, len(counter.stages))
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C():
+				for i, counts := range counter.stages {
+					inFlight := counts.inFlight.Load()
+					idle := now.Sub(time.Unix(0, counts.active.Load()))
+					if inFlight == 0 || idle < after {
+						flagged[i] = false
+						continue
+					}
+					if flagged[i] {
+						continue
+					}
+					flagged[i] = true
+
+					idle = idle.Round(time.Millisecond)
+					counts.logger.Warn("stage stalled", "in_flight", inFlight, "idle", idle)
+					if cancel {
+						stalled <- fmt.Errorf("%w: %s has had %d values in flight for %s without finishing any",
+							ErrStalled, counter.names[i], inFlight, idle)
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return stalled
+}
@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Webhook is an http.Handler that turns the bodies of incoming POST requests
+// into pipeline values, so a pipeline can sit directly behind a webhook
+// endpoint:
+//
+//	hook := pipeline.NewWebhook(1000, 1<<20, pipeline.JSONCodec[Event]().Decode)
+//	http.Handle("/events", hook)
+//
+//	err := pipeline.New(hook.Source()).Then(handle).Run(ctx)
+//
+// Accepted requests are answered with 202 Accepted as soon as they are
+// queued, not once the pipeline has processed them. When the queue is full
+// the request is refused with 429 Too Many Requests, so senders back off
+// rather than pile up connections.
+//
+// NewMessageWebhook wraps the values in Messages carrying the request's
+// TransportHeaders instead.
+type Webhook[T any] struct {
+	queue   chan T
+	maxBody int64
+	decode  func(*http.Request, []byte) (T, error)
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWebhook returns a Webhook queueing up to capacity values, decoded with
+// decode from request bodies of up to maxBodyBytes. Larger bodies are refused
+// with 413 Request Entity Too Large and bodies decode fails on with 400 Bad
+// Request.
+func NewWebhook[T any](capacity int, maxBodyBytes int64, decode func([]byte) (T, error)) *Webhook[T] {
+	return &Webhook[T]{
+		queue:   make(chan T, max(capacity, 0)),
+		maxBody: maxBodyBytes,
+		decode: func(_ *http.Request, body []byte) (T, error) {
+			return decode(body)
+		},
+	}
+}
+
+// NewMessageWebhook is NewWebhook for values wrapped with NewMessageFrom in
+// Messages carrying the TransportHeaders of their request, so a trace or
+// correlation ID the sender set follows the value through the pipeline.
+func NewMessageWebhook[T any](capacity int, maxBodyBytes int64, decode func([]byte) (T, error)) *Webhook[Message[T]] {
+	return &Webhook[Message[T]]{
+		queue:   make(chan Message[T], max(capacity, 0)),
+		maxBody: maxBodyBytes,
+		decode: func(r *http.Request, body []byte) (Message[T], error) {
+			v, err := decode(body)
+			if err != nil {
+				return Message[T]{}, err
+			}
+			return NewMessageFrom(v, ExtractHeaders(r.Header.Get)), nil
+		},
+	}
+}
+
+// ServeHTTP queues the value decoded from a POST request's body.
+func (h *Webhook[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.decode(r, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case h.queue <- v:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	}
+}
+
+// Source returns a Source emitting the queued values. Its channel is closed
+// once Close has been called and the queue is empty, or once ctx is done.
+func (h *Webhook[T]) Source() Source[T] {
+	return func(ctx context.Context) (<-chan T, error) {
+		outChannel := make(chan T)
+
+		go func() {
+			defer close(outChannel)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case v, ok := <-h.queue:
+					if !ok {
+						return
+					}
+
+					select {
+					case <-ctx.Done():
+						return
+					case outChannel <- v:
+					}
+				}
+			}
+		}()
+
+		return outChannel, nil
+	}
+}
+
+// Close stops accepting requests, which are refused with 503 Service
+// Unavailable from then on. Values already queued are still emitted, so a
+// pipeline reading the Source shuts down once it has handled them.
+func (h *Webhook[T]) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+}
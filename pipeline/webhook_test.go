@@ -0,0 +1,62 @@
+package pipeline_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestWebhook(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	hook := pipeline.NewWebhook(1, 8, func(body []byte) (int, error) {
+		return strconv.Atoi(string(body))
+	})
+
+	// the requests are made in order, against the same webhook
+	requests := []struct {
+		name       string
+		method     string
+		body       string
+		close      bool
+		wantStatus int
+		wantHeader string
+	}{
+		{name: "not a POST", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed, wantHeader: "Allow"},
+		{name: "too large", method: http.MethodPost, body: "123456789", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "not decoded", method: http.MethodPost, body: "one", wantStatus: http.StatusBadRequest},
+		{name: "queued", method: http.MethodPost, body: "1", wantStatus: http.StatusAccepted},
+		{name: "queue full", method: http.MethodPost, body: "2", wantStatus: http.StatusTooManyRequests, wantHeader: "Retry-After"},
+		{name: "closed", method: http.MethodPost, body: "3", close: true, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, r := range requests {
+		if r.close {
+			hook.Close()
+		}
+		w := httptest.NewRecorder()
+		hook.ServeHTTP(w, httptest.NewRequest(r.method, "/events", strings.NewReader(r.body)))
+
+		if w.Code != r.wantStatus {
+			t.Errorf("%s: status %d, want %d", r.name, w.Code, r.wantStatus)
+		}
+		if r.wantHeader != "" && w.Header().Get(r.wantHeader) == "" {
+			t.Errorf("%s: no %s header", r.name, r.wantHeader)
+		}
+	}
+
+	// the queued value is still emitted once closed
+	values, err := hook.Source()(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pipelinetest.Collect(t, values); !slices.Equal(got, []int{1}) {
+		t.Errorf("source emitted %v, want [1]", got)
+	}
+}
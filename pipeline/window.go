@@ -0,0 +1,239 @@
+package pipeline
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+// TumblingWindow groups values from in into consecutive, non-overlapping
+// windows of length d by arrival time and emits each window as a slice when
+// it ends. Windows in which nothing arrived are skipped. The window in
+// progress is emitted when in is closed; nothing more is emitted once ctx is
+// done.
+func TumblingWindow[T any](ctx context.Context, in <-chan T, d time.Duration) <-chan []T {
+	outChannel := make(chan []T)
+
+	go func() {
+		defer close(outChannel)
+
+		ticker := ClockFrom(ctx).NewTicker(d)
+		defer ticker.Stop()
+
+		var window []T
+		flush := func() bool {
+			if len(window) == 0 {
+				return true
+			}
+
+			select {
+			case <-ctx.Done():
+				return false
+			case outChannel <- window:
+			}
+			window = nil
+
+			return true
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				if !flush() {
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				window = append(window, v)
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// SlidingWindow emits, every slide, the values from in that arrived within
+// the last size, so consecutive windows overlap when slide is shorter than
+// size, e.g. for moving averages. Windows in which nothing arrived are
+// skipped. A final window is emitted when in is closed; nothing more is
+// emitted once ctx is done.
+func SlidingWindow[T any](ctx context.Context, in <-chan T, size, slide time.Duration) <-chan []T {
+	type entry struct {
+		at time.Time
+		v  T
+	}
+
+	outChannel := make(chan []T)
+
+	go func() {
+		defer close(outChannel)
+
+		clock := ClockFrom(ctx)
+		ticker := clock.NewTicker(slide)
+		defer ticker.Stop()
+
+		var entries []entry
+		emit := func(now time.Time) bool {
+			// forget whatever has slid out of the window
+			cutoff := now.Add(-size)
+			i := 0
+			for i < len(entries) && !entries[i].at.After(cutoff) {
+				i++
+			}
+			entries = entries[i:]
+
+			if len(entries) == 0 {
+				return true
+			}
+
+			// every window gets its own slice since they overlap
+			window := make([]T, len(entries))
+			for i, e := range entries {
+				window[i] = e.v
+			}
+
+			select {
+			case <-ctx.Done():
+				return false
+			case outChannel <- window:
+				return true
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C():
+				if !emit(now) {
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					emit(clock.Now())
+					return
+				}
+				entries = append(entries, entry{at: clock.Now(), v: v})
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+// SessionWindow groups values from in into per-key sessions: a session
+// collects every value whose keyFn returns its key and ends once no value
+// for that key has arrived for gap. Each session is emitted as a slice, in
+// arrival order, when it ends. Sessions still open when in is closed are
+// emitted straight away; nothing more is emitted once ctx is done.
+func SessionWindow[T any, K comparable](ctx context.Context, in <-chan T, keyFn func(T) K, gap time.Duration) <-chan []T {
+	type session struct {
+		values   []T
+		deadline time.Time
+	}
+
+	outChannel := make(chan []T)
+
+	go func() {
+		defer close(outChannel)
+
+		sessions := make(map[K]*session)
+		// one entry per arrival; entries whose deadline has since been
+		// pushed back by a later value are stale and skipped
+		var expiries deadlineHeap[K]
+
+		clock := ClockFrom(ctx)
+		timer := clock.NewTimer(gap)
+		timer.Stop()
+		defer timer.Stop()
+
+		// closeExpired emits, in expiry order, every session whose deadline
+		// is not after now.
+		closeExpired := func(now time.Time) bool {
+			for expiries.Len() > 0 && !expiries.peek().at.After(now) {
+				e := expiries.pop()
+				s, ok := sessions[e.key]
+				if !ok || !s.deadline.Equal(e.at) {
+					continue
+				}
+				delete(sessions, e.key)
+
+				select {
+				case <-ctx.Done():
+					return false
+				case outChannel <- s.values:
+				}
+			}
+
+			if expiries.Len() > 0 {
+				timer.Reset(expiries.peek().at.Sub(clock.Now()))
+			}
+
+			return true
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C():
+				if !closeExpired(clock.Now()) {
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					// every open session ends with the input
+					closeExpired(clock.Now().Add(gap))
+					return
+				}
+
+				k := keyFn(v)
+				s, exists := sessions[k]
+				if !exists {
+					s = &session{}
+					sessions[k] = s
+				}
+				s.values = append(s.values, v)
+				s.deadline = clock.Now().Add(gap)
+
+				wasEmpty := expiries.Len() == 0
+				expiries.push(deadline[K]{at: s.deadline, key: k})
+				if wasEmpty {
+					timer.Reset(gap)
+				}
+			}
+		}
+	}()
+
+	return outChannel
+}
+
+type deadline[K any] struct {
+	at  time.Time
+	key K
+}
+
+// deadlineHeap is a min-heap of deadlines. Deadlines are pushed in
+// increasing order by SessionWindow, but keeping it a heap doesn't rely on
+// that.
+type deadlineHeap[K any] []deadline[K]
+
+func (h deadlineHeap[K]) Len() int           { return len(h) }
+func (h deadlineHeap[K]) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h deadlineHeap[K]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *deadlineHeap[K]) Push(x any)        { *h = append(*h, x.(deadline[K])) }
+func (h *deadlineHeap[K]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (h *deadlineHeap[K]) push(d deadline[K]) { heap.Push(h, d) }
+func (h *deadlineHeap[K]) pop() deadline[K]   { return heap.Pop(h).(deadline[K]) }
+func (h deadlineHeap[K]) peek() deadline[K]   { return h[0] }
@@ -0,0 +1,113 @@
+package pipeline_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestTumblingWindowFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	in := make(chan int)
+	windows := pipeline.TumblingWindow(ctx, in, time.Minute)
+
+	in <- 1
+	in <- 2
+	clock.WaitForTimers(1)
+	assertNothing(t, windows)
+	clock.Advance(time.Minute)
+	if got := pipelinetest.Receive(t, windows); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("got %v, want [1 2]", got)
+	}
+
+	// an empty window is skipped
+	clock.Advance(time.Minute)
+	assertNothing(t, windows)
+
+	// the window in progress is emitted with the input closing
+	in <- 3
+	close(in)
+	if got := pipelinetest.Receive(t, windows); !slices.Equal(got, []int{3}) {
+		t.Errorf("got %v, want [3]", got)
+	}
+	pipelinetest.Collect(t, windows)
+}
+
+func TestSlidingWindowFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	in := make(chan int)
+	windows := pipeline.SlidingWindow(ctx, in, 2*time.Minute, time.Minute)
+
+	// assertNothing gives the window time to note when each value arrived
+	in <- 1
+	clock.WaitForTimers(1)
+	assertNothing(t, windows)
+	clock.Advance(30 * time.Second)
+	in <- 2
+	assertNothing(t, windows)
+
+	clock.Advance(30 * time.Second)
+	if got := pipelinetest.Receive(t, windows); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("got %v at 1m, want [1 2]", got)
+	}
+	// 1 slides out of the window, 2 is in both
+	clock.Advance(time.Minute)
+	if got := pipelinetest.Receive(t, windows); !slices.Equal(got, []int{2}) {
+		t.Errorf("got %v at 2m, want [2]", got)
+	}
+	clock.Advance(time.Minute)
+	assertNothing(t, windows)
+
+	close(in)
+	if got := pipelinetest.Collect(t, windows); len(got) != 0 {
+		t.Errorf("got %v once the input closed, want nothing", got)
+	}
+}
+
+func TestSessionWindowFakeClock(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+	ctx, clock := fakeContext(t)
+
+	in := make(chan string)
+	sessions := pipeline.SessionWindow(ctx, in, func(s string) byte { return s[0] }, time.Minute)
+
+	// assertNothing gives the window time to note when each value arrived
+	in <- "a1"
+	clock.WaitForTimers(1)
+	clock.Advance(30 * time.Second)
+	in <- "b1"
+	assertNothing(t, sessions)
+	clock.Advance(20 * time.Second)
+	in <- "a2"
+	assertNothing(t, sessions)
+
+	// a2 kept the a session open past its first deadline
+	clock.Advance(10 * time.Second)
+	clock.WaitForTimers(1)
+	assertNothing(t, sessions)
+
+	clock.Advance(30 * time.Second)
+	if got := pipelinetest.Receive(t, sessions); !slices.Equal(got, []string{"b1"}) {
+		t.Errorf("got %v at 1m30s, want [b1]", got)
+	}
+	clock.WaitForTimers(1)
+	clock.Advance(20 * time.Second)
+	if got := pipelinetest.Receive(t, sessions); !slices.Equal(got, []string{"a1", "a2"}) {
+		t.Errorf("got %v at 1m50s, want [a1 a2]", got)
+	}
+
+	// an open session ends with the input
+	in <- "c1"
+	close(in)
+	if got := pipelinetest.Receive(t, sessions); !slices.Equal(got, []string{"c1"}) {
+		t.Errorf("got %v once the input closed, want [c1]", got)
+	}
+	pipelinetest.Collect(t, sessions)
+}
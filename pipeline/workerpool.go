@@ -0,0 +1,65 @@
+package pipeline
+
+import "context"
+
+// WithWorkerPool runs the step on a fixed pool of long-lived workers, as many
+// as its concurrency, or the autoscaling maximum, all started up front and
+// each reading from the input channel itself. By default a step reads its
+// input from a single goroutine and hands the values to workers started as
+// they are needed.
+//
+// Every worker keeps its number for the life of the step, see WorkerID, so
+// a StepCtx transform can use it to pick per-worker state such as a
+// connection or a buffer.
+func WithWorkerPool() StepOption {
+	return func(cfg *stepConfig) {
+		cfg.workerPool = true
+	}
+}
+
+type workerKey struct{}
+
+// WorkerID returns the number, from 0, of the worker of a WithWorkerPool
+// step that the call with ctx is running on. ok is false outside such a
+// step.
+func WorkerID(ctx context.Context) (id int, ok bool) {
+	id, ok = ctx.Value(workerKey{}).(int)
+	return id, ok
+}
+
+// WithWorkerInit gives every worker state of its own, such as an HTTP client
+// or a prepared statement, made by init when the worker starts and reused for
+// every value it processes. A StepCtx transform gets it with WorkerState.
+// It implies WithWorkerPool.
+//
+// init is called with a context carrying the worker's WorkerID. A worker
+// whose init fails reports the error, as a *StageError, and doesn't start;
+// the others carry on, and if none start the step stops.
+func WithWorkerInit[S any](init func(ctx context.Context) (S, error)) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.workerPool = true
+		cfg.workerInit = func(ctx context.Context) (any, error) {
+			return init(ctx)
+		}
+	}
+}
+
+// WithWorkerClose releases the state made by WithWorkerInit once its worker
+// is done, after the input has been closed or the step's context is done.
+func WithWorkerClose[S any](release func(S)) StepOption {
+	return func(cfg *stepConfig) {
+		cfg.workerClose = func(state any) {
+			release(state.(S))
+		}
+	}
+}
+
+type workerStateKey struct{}
+
+// WorkerState returns the state WithWorkerInit made for the worker the call
+// with ctx is running on. ok is false outside a step with WithWorkerInit or
+// if S isn't the type init returned.
+func WorkerState[S any](ctx context.Context) (state S, ok bool) {
+	state, ok = ctx.Value(workerStateKey{}).(S)
+	return state, ok
+}
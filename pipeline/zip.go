@@ -0,0 +1,54 @@
+package pipeline
+
+import "context"
+
+// Pair holds two values that belong together.
+type Pair[A any, B any] struct {
+	First  A
+	Second B
+}
+
+// Zip pairs values from a and b by position: the first value of a with the
+// first of b, and so on. It is useful to join a pipeline branch back with the
+// input it was derived from, as long as the branch neither drops nor reorders
+// values. The output is closed as soon as either input is closed, dropping a
+// value left without a partner, or once ctx is done.
+func Zip[A any, B any](ctx context.Context, a <-chan A, b <-chan B) <-chan Pair[A, B] {
+	outChannel := make(chan Pair[A, B])
+
+	go func() {
+		defer close(outChannel)
+
+		for {
+			var p Pair[A, B]
+			// wait on whichever input hasn't delivered its half yet, so that
+			// either one closing ends the output straight away
+			needA, needB := a, b
+			for needA != nil || needB != nil {
+				var ok bool
+				select {
+				case <-ctx.Done():
+					return
+				case p.First, ok = <-needA:
+					if !ok {
+						return
+					}
+					needA = nil
+				case p.Second, ok = <-needB:
+					if !ok {
+						return
+					}
+					needB = nil
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case outChannel <- p:
+			}
+		}
+	}()
+
+	return outChannel
+}
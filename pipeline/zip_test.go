@@ -0,0 +1,49 @@
+package pipeline_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Joshswooft/go-pipeline-article/pipeline"
+	"github.com/Joshswooft/go-pipeline-article/pipeline/pipelinetest"
+)
+
+func TestZip(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	got := pipelinetest.Collect(t, pipeline.Zip(context.Background(), waiting(1, 2, 3), waiting("a", "b")))
+	want := []pipeline.Pair[int, string]{{First: 1, Second: "a"}, {First: 2, Second: "b"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestZipEitherCloses checks the output closes as soon as one input does,
+// without waiting on the other.
+func TestZipEitherCloses(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	a := make(chan int)
+	defer close(a)
+
+	if got := pipelinetest.Collect(t, pipeline.Zip(context.Background(), a, waiting[string]())); len(got) != 0 {
+		t.Errorf("got %v, want nothing", got)
+	}
+}
+
+func TestZipStops(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a, b := make(chan int), make(chan string)
+	defer close(a)
+	defer close(b)
+
+	out := pipeline.Zip(ctx, a, b)
+	assertNothing(t, out)
+	cancel()
+	if got := pipelinetest.Collect(t, out); len(got) != 0 {
+		t.Errorf("got %v after cancelling, want nothing", got)
+	}
+}